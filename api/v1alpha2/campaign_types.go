@@ -0,0 +1,374 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// CampaignLabel is on the MetricSets of a campaign, with the name of the campaign.
+// A MetricSet with the label waits until the campaign starts it (and adds the
+// CampaignStartedAnnotation), so the campaign controls how many run at once.
+const CampaignLabel = "metricset-campaign"
+
+// CampaignStartedAnnotation has the time the campaign started a MetricSet
+const CampaignStartedAnnotation = "metrics-operator/campaign-started"
+
+// States of a MetricSet of a campaign, and of the campaign
+const (
+	CampaignPending   = "Pending"
+	CampaignActive    = "Active"
+	CampaignCompleted = "Completed"
+	CampaignFailed    = "Failed"
+	CampaignInvalid   = "Invalid"
+)
+
+// maxCampaignSets limits the MetricSets of a campaign, since each has an entry
+// in the status
+var maxCampaignSets = 1000
+
+// MetricCampaignSpec defines the MetricSets of a campaign, and how many run at once
+type MetricCampaignSpec struct {
+
+	// Existing MetricSets (in the namespace of the campaign) to run. A MetricSet
+	// waits for the campaign to start it if it has the metricset-campaign label
+	// (with the name of the campaign), and otherwise starts when it is created.
+	// +optional
+	MetricSets []string `json:"metricSets,omitempty"`
+
+	// Templates of MetricSets the campaign creates, one for each combination of
+	// the values of the matrix of the template
+	// +optional
+	Templates []CampaignTemplate `json:"templates,omitempty"`
+
+	// Most MetricSets that run at once (0 runs all of them at once)
+	// +optional
+	Concurrency int32 `json:"concurrency,omitempty"`
+}
+
+// CampaignTemplate is a MetricSet spec with {{ matrix.<name> }} placeholders,
+// and the values of each
+type CampaignTemplate struct {
+
+	// Name of the template, the MetricSets are <campaign>-<name>-<index>
+	Name string `json:"name"`
+
+	// Values of each placeholder. A placeholder that is a whole value (e.g.,
+	// pods: "{{ matrix.pods }}") is replaced with the value (a number or a string),
+	// and others are replaced in the text.
+	// +optional
+	Matrix map[string][]intstr.IntOrString `json:"matrix,omitempty"`
+
+	// The MetricSet spec
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	Spec runtime.RawExtension `json:"spec"`
+}
+
+// MetricCampaignStatus has the state and results of each MetricSet of the campaign
+type MetricCampaignStatus struct {
+
+	// MetricSets of the campaign, in the order they are started
+	// +optional
+	MetricSets []CampaignMetricSet `json:"metricSets,omitempty"`
+
+	// MetricSets in each state
+	// +optional
+	Pending int32 `json:"pending,omitempty"`
+
+	// +optional
+	Active int32 `json:"active,omitempty"`
+
+	// +optional
+	Completed int32 `json:"completed,omitempty"`
+
+	// +optional
+	Failed int32 `json:"failed,omitempty"`
+
+	// Active while MetricSets are pending or active, then Completed (or Failed if
+	// one failed), or Invalid
+	// +optional
+	State string `json:"state,omitempty"`
+
+	// Why the campaign is invalid
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// CampaignMetricSet is the state of a MetricSet of a campaign, and its results
+// when it has finished
+type CampaignMetricSet struct {
+	Name string `json:"name"`
+
+	// Values of the matrix, for a MetricSet of a template
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	// Pending (waiting to start), Active, Completed, or Failed
+	State string `json:"state"`
+
+	// Seconds from creating the JobSet (or Job) until it finished
+	// +optional
+	Seconds string `json:"seconds,omitempty"`
+
+	// Why the MetricSet failed (e.g., the most common container failure), or is pending
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Results of a scaling study
+	// +optional
+	Scaling []ScalingResult `json:"scaling,omitempty"`
+}
+
+// CampaignMember is a MetricSet of a campaign: an existing MetricSet (without a
+// Set), or one the campaign creates from a template
+type CampaignMember struct {
+	Name       string
+	Parameters map[string]string
+	Set        *MetricSet
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+//+kubebuilder:printcolumn:name="Active",type=integer,JSONPath=`.status.active`
+//+kubebuilder:printcolumn:name="Completed",type=integer,JSONPath=`.status.completed`
+//+kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MetricCampaign runs MetricSets (e.g., of a sweep) with a limit on how many
+// run at once, and collects their states and results
+type MetricCampaign struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MetricCampaignSpec   `json:"spec,omitempty"`
+	Status MetricCampaignStatus `json:"status,omitempty"`
+}
+
+// Members returns the MetricSets of the campaign, the existing ones and then
+// those of each template, or an error if the campaign is not valid
+func (c *MetricCampaign) Members() ([]CampaignMember, error) {
+	if c.Spec.Concurrency < 0 {
+		return nil, fmt.Errorf("concurrency must be >= 0, found %d", c.Spec.Concurrency)
+	}
+	members := []CampaignMember{}
+	for _, name := range c.Spec.MetricSets {
+		members = append(members, CampaignMember{Name: name})
+	}
+	for _, template := range c.Spec.Templates {
+		sets, err := c.templateMembers(&template)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", template.Name, err)
+		}
+		members = append(members, sets...)
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("one or more metricSets or templates are required")
+	}
+	if len(members) > maxCampaignSets {
+		return nil, fmt.Errorf("a campaign can have up to %d MetricSets, found %d", maxCampaignSets, len(members))
+	}
+	names := map[string]bool{}
+	for _, member := range members {
+		if names[member.Name] {
+			return nil, fmt.Errorf("MetricSet %s is in the campaign more than once", member.Name)
+		}
+		names[member.Name] = true
+	}
+	return members, nil
+}
+
+// matrixRegex matches a {{ matrix.<name> }} placeholder
+var matrixRegex = regexp.MustCompile(`\{\{\s*matrix\.([A-Za-z0-9_-]+)\s*\}\}`)
+
+// templateMembers returns a MetricSet for each combination of the values of
+// the matrix of a template
+func (c *MetricCampaign) templateMembers(template *CampaignTemplate) ([]CampaignMember, error) {
+	if !aliasRegex.MatchString(template.Name) {
+		return nil, fmt.Errorf("name must be lowercase letters, numbers, and '-' (up to 20 characters)")
+	}
+	if len(template.Spec.Raw) == 0 {
+		return nil, fmt.Errorf("a spec is required")
+	}
+	keys := []string{}
+	for key, values := range template.Matrix {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("matrix %s does not have values", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Each combination, with the last key changing fastest
+	combinations := []map[string]intstr.IntOrString{{}}
+	for _, key := range keys {
+		next := []map[string]intstr.IntOrString{}
+		for _, combination := range combinations {
+			for _, value := range template.Matrix[key] {
+				expanded := map[string]intstr.IntOrString{key: value}
+				for k, v := range combination {
+					expanded[k] = v
+				}
+				next = append(next, expanded)
+			}
+		}
+		combinations = next
+		if len(combinations) > maxCampaignSets {
+			return nil, fmt.Errorf("the matrix has more than %d combinations", maxCampaignSets)
+		}
+	}
+
+	members := []CampaignMember{}
+	for i, combination := range combinations {
+		name := fmt.Sprintf("%s-%s", c.Name, template.Name)
+		if len(keys) > 0 {
+			name = fmt.Sprintf("%s-%d", name, i)
+		}
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf("MetricSet name %s is not valid: %s", name, strings.Join(errs, ", "))
+		}
+		spec, err := expandTemplate(template.Spec.Raw, combination)
+		if err != nil {
+			return nil, err
+		}
+		if spec.Canary.Enabled() {
+			return nil, fmt.Errorf("a canary runs until it is deleted, and cannot be in a campaign")
+		}
+		parameters := map[string]string{}
+		for key, value := range combination {
+			parameters[key] = value.String()
+		}
+		set := &MetricSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   c.Namespace,
+				Labels:      map[string]string{CampaignLabel: c.Name},
+				Annotations: map[string]string{},
+			},
+			Spec: *spec,
+		}
+		members = append(members, CampaignMember{Name: name, Parameters: parameters, Set: set})
+	}
+	return members, nil
+}
+
+// expandTemplate replaces the placeholders of a MetricSet spec with the values
+// of a combination of the matrix
+func expandTemplate(raw []byte, values map[string]intstr.IntOrString) (*MetricSetSpec, error) {
+	var generic interface{}
+	err := json.Unmarshal(raw, &generic)
+	if err != nil {
+		return nil, err
+	}
+	generic, err = substitute(generic, values)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unknown fields are likely typos, and are not dropped silently
+	spec := &MetricSetSpec{}
+	decoder := json.NewDecoder(bytes.NewReader(expanded))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(spec)
+	if err != nil {
+		return nil, fmt.Errorf("spec is not a valid MetricSet spec: %w", err)
+	}
+	return spec, nil
+}
+
+// substitute replaces the placeholders in the strings of a decoded value
+func substitute(value interface{}, values map[string]intstr.IntOrString) (interface{}, error) {
+	var err error
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key], err = substitute(item, values)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i], err = substitute(item, values)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case string:
+		whole := matrixRegex.FindStringSubmatch(v)
+		if whole != nil && whole[0] == v {
+			replacement, ok := values[whole[1]]
+			if !ok {
+				return nil, fmt.Errorf("matrix does not have %s", whole[1])
+			}
+			if replacement.Type == intstr.Int {
+				return replacement.IntValue(), nil
+			}
+			return replacement.StrVal, nil
+		}
+		missing := ""
+		replaced := matrixRegex.ReplaceAllStringFunc(v, func(match string) string {
+			key := matrixRegex.FindStringSubmatch(match)[1]
+			replacement, ok := values[key]
+			if !ok {
+				missing = key
+				return match
+			}
+			return replacement.String()
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("matrix does not have %s", missing)
+		}
+		return replaced, nil
+	}
+	return value, nil
+}
+
+// CampaignHeld determines if a MetricSet waits for its campaign to start it
+func (m *MetricSet) CampaignHeld() bool {
+	_, ok := m.Labels[CampaignLabel]
+	return ok && m.Annotations[CampaignStartedAnnotation] == ""
+}
+
+//+kubebuilder:object:root=true
+
+// MetricCampaignList contains a list of MetricCampaign
+type MetricCampaignList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MetricCampaign `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MetricCampaign{}, &MetricCampaignList{})
+}
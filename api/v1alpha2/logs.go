@@ -0,0 +1,22 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package v1alpha2
+
+import (
+	"github.com/converged-computing/metrics-operator/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Validation errors are logged with the reconcile of the MetricSet
+var (
+	logger *zap.SugaredLogger
+)
+
+func init() {
+	logger = logging.NewLogger("api")
+}
@@ -18,9 +18,14 @@ package v1alpha2
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -43,6 +48,10 @@ type MetricSetSpec struct {
 	// +optional
 	ServiceName string `json:"serviceName"`
 
+	// Network settings for the pod hostnames and the headless service
+	//+optional
+	Network Network `json:"network"`
+
 	// Should the job be limited to a particular number of seconds?
 	// Approximately one year. This cannot be zero or job won't start
 	// +kubebuilder:default=31500000
@@ -50,6 +59,11 @@ type MetricSetSpec struct {
 	// +optional
 	DeadlineSeconds int64 `json:"deadlineSeconds,omitempty"`
 
+	// Timeout in seconds for the main command of each entrypoint (0 is no timeout)
+	// On timeout or SIGTERM, partial results are flushed and collection ends
+	// +optional
+	CommandTimeout int32 `json:"commandTimeout,omitempty"`
+
 	// Pod spec for the application, standalone, or storage metrics
 	//+optional
 	Pod Pod `json:"pod"`
@@ -60,6 +74,11 @@ type MetricSetSpec struct {
 	// +optional
 	Pods int32 `json:"pods"`
 
+	// Pods for specific roles (replicated jobs), e.g., w: 16 for the workers of
+	// a launcher/worker metric, overriding the size the metric gives them
+	// +optional
+	Roles map[string]int32 `json:"roles,omitempty"`
+
 	// Resources include limits and requests for each pod (that include a JobSet)
 	// +optional
 	Resources ContainerResource `json:"resources"`
@@ -68,198 +87,1906 @@ type MetricSetSpec struct {
 	// Right now we just include an interactive option
 	//+optional
 	Logging Logging `json:"logging"`
-}
 
-type Logging struct {
+	// Merge compatible metrics into a single collection container
+	//+optional
+	Merge Merge `json:"merge"`
 
-	// Don't allow the application, metric, or storage test to finish
-	// This adds sleep infinity at the end to allow for interactive mode.
-	// +optional
-	Interactive bool `json:"interactive"`
+	// Shared (read-write-many) scratch volume for all containers
+	//+optional
+	Scratch Scratch `json:"scratch"`
+
+	// Results directory (per run, job, and pod) for all containers
+	//+optional
+	Results Results `json:"results"`
+
+	// Markers in the output of metrics (and framing of the output) for parsing
+	//+optional
+	Markers Markers `json:"markers"`
+
+	// Create a pod disruption budget (maxUnavailable 0) for the pods while
+	// the run is active, so drains and consolidation do not interrupt it
+	//+optional
+	DisruptionBudget bool `json:"disruptionBudget"`
+
+	// Keep the rendered JobSet and entrypoints in a config map, so the run can be
+	// traced to its exact configuration (the hash is always in the status)
+	//+optional
+	RecordRendered bool `json:"recordRendered"`
+
+	// Store large entrypoints gzip and base64 encoded in the config maps, so
+	// many metrics and addons need fewer (and smaller) config maps. They are
+	// decoded when the container starts, which needs base64 and gzip in the image.
+	//+optional
+	CompressEntrypoints bool `json:"compressEntrypoints,omitempty"`
+
+	// Debug mode: metric entrypoints wait to be released (by creating a file in
+	// the container) before the command runs, so you can exec in first
+	//+optional
+	Debug bool `json:"debug"`
+
+	// Snapshot the environment (redacted), ulimits, cgroup limits, and mounts of
+	// metric containers before the command, to snapshot.txt in the pod results
+	//+optional
+	Snapshot bool `json:"snapshot"`
+
+	// Cluster autoscaler awareness (scale-down protection and scale-up wait)
+	//+optional
+	Autoscaler Autoscaler `json:"autoscaler"`
+
+	// Estimate the cost of the run from a price table
+	//+optional
+	Cost Cost `json:"cost"`
+
+	// Profile mode runs each metric (as a short calibration) at several resource
+	// configurations, and reports the runtime of each and a recommendation
+	//+optional
+	Profile Profile `json:"profile"`
+
+	// Scaling runs the metrics at a list of pod counts, one MetricSet at a time,
+	// and reports the speedup and efficiency of each
+	//+optional
+	Scaling Scaling `json:"scaling"`
+
+	// Gang schedule the pods with a PodGroup, so a run never starts with only
+	// some of its pods scheduled
+	//+optional
+	GangScheduling GangScheduling `json:"gangScheduling"`
+
+	// Tune kernel.perf_event_paranoid on the nodes of the run, so perf addons
+	// do not need privileged metric or application containers
+	//+optional
+	PerfEvents PerfEvents `json:"perfEvents"`
+
+	// Pod Security Standard the pods must meet (privileged, baseline, or restricted).
+	// Containers are adjusted for it, and metrics or addons that cannot meet it are refused.
+	//+kubebuilder:validation:Enum=privileged;baseline;restricted
+	//+optional
+	SecurityProfile string `json:"securityProfile,omitempty"`
+
+	// Experiment identifier for the run, added to the pod labels and the metadata
+	// of each metric, so results can be joined to external experiment tracking
+	//+optional
+	ExperimentID string `json:"experimentId,omitempty"`
+
+	// Metadata (e.g., a git sha) for the run, added to the metadata of each metric
+	// and the pod annotations (and labels, for values that are valid labels)
+	//+optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Cancel the run: the JobSet is suspended so containers get SIGTERM and flush
+	// partial results, and then it is deleted (the MetricSet and its status stay)
+	//+optional
+	Cancel bool `json:"cancel,omitempty"`
+
+	// Startup order of the replicated jobs. With InOrder, the launcher (the
+	// replicated jobs that decide success) is not scheduled until the pods of
+	// the others (e.g., workers) are ready, so it does not sleep waiting for them.
+	//+kubebuilder:validation:Enum=AnyOrder;InOrder
+	//+optional
+	StartupPolicy string `json:"startupPolicy,omitempty"`
+
+	// Split the pods into this many JobSets (shards), each with its own headless
+	// service and hostlist, for runs too large for one JobSet. The shards are
+	// created suspended and started together, and results go to one run directory.
+	//+optional
+	Shards int32 `json:"shards,omitempty"`
+
+	// Acceptance runs the metrics on every node of a pool (the nodes matching the
+	// pod nodeSelector), and checks the values each node reports
+	//+optional
+	Acceptance Acceptance `json:"acceptance"`
+
+	// Canary runs the metrics periodically on a rotating subset of the nodes
+	// (matching the pod nodeSelector), and flags nodes with degraded values
+	//+optional
+	Canary Canary `json:"canary"`
+
+	// Backend is the workload that runs the pods: a JobSet, or a batch/v1 (indexed)
+	// Job for clusters without JobSet. A Job can only run metrics with one replicated
+	// job (e.g., not a launcher and workers). When unset, the backend is a JobSet if
+	// the JobSet API is installed, and otherwise a Job.
+	//+kubebuilder:validation:Enum=JobSet;Job
+	//+optional
+	Backend string `json:"backend,omitempty"`
 }
 
-// Pod attributes that can be given to an application or metric
-type Pod struct {
+// Startup policies for the replicated jobs
+const (
+	AnyOrderStartup = "AnyOrder"
+	InOrderStartup  = "InOrder"
+)
 
-	// Annotations to add to the pod
+// Backends for the pods of a MetricSet
+const (
+	JobSetBackend = "JobSet"
+	JobBackend    = "Job"
+)
+
+// Pod Security Standards for the security profile
+const (
+	PrivilegedProfile = "privileged"
+	BaselineProfile   = "baseline"
+	RestrictedProfile = "restricted"
+)
+
+// PerfEvents creates a DaemonSet (for the duration of the run) that sets
+// kernel.perf_event_paranoid on the selected nodes, and restores it after.
+// The setting is node-wide, so it applies to every pod on those nodes.
+type PerfEvents struct {
+
+	// Create the tuning DaemonSet
 	//+optional
-	Annotations map[string]string `json:"annotations"`
+	Tune bool `json:"tune"`
 
-	// Labels to add to the pod
+	// Value for kernel.perf_event_paranoid (-1 to 4), -1 allows all events
+	//+kubebuilder:default=-1
+	//+default=-1
 	//+optional
-	Labels map[string]string `json:"labels"`
+	Paranoid int32 `json:"paranoid"`
 
-	// name of service account to associate with pod
+	// Namespace for the DaemonSet (it must allow privileged pods), defaults to
+	// the namespace of the MetricSet
 	//+optional
-	ServiceAccountName string `json:"serviceAccountName"`
+	Namespace string `json:"namespace,omitempty"`
 
-	// NodeSelector labels
+	// Image for the DaemonSet (with sh)
+	//+kubebuilder:default="busybox:stable"
+	//+default="busybox:stable"
 	//+optional
-	NodeSelector map[string]string `json:"nodeSelector"`
+	Image string `json:"image,omitempty"`
 }
 
-// A container spec can belong to a metric or application
-type ContainerSpec struct {
+// Enabled determines if perf_event_paranoid is tuned for the run
+func (p *PerfEvents) Enabled() bool {
+	return p.Tune
+}
 
-	// Security context for the pod
+// Network controls the hostnames of the pods and the headless service that
+// resolves them (e.g., for MPI bootstraps that look up hostnames early)
+type Network struct {
+
+	// Have JobSet create the headless service and set the pod hostnames,
+	// instead of the operator creating the service
 	//+optional
-	SecurityContext SecurityContext `json:"securityContext"`
+	EnableDNSHostnames bool `json:"enableDNSHostnames,omitempty"`
+
+	// Subdomain of the pods (and name of the headless service), defaults to serviceName
+	//+optional
+	Subdomain string `json:"subdomain,omitempty"`
+
+	// Publish the addresses of pods that are not ready yet in the headless
+	// service, so hostnames resolve as soon as pods have an address. JobSet
+	// always does this for the service it creates.
+	//+optional
+	PublishNotReadyAddresses bool `json:"publishNotReadyAddresses,omitempty"`
 }
 
-type SecurityContext struct {
+// Gang schedulers that the PodGroup can be created for
+const (
+	CoschedulingScheduler = "coscheduling"
+	VolcanoScheduler      = "volcano"
+)
+
+// GangScheduling creates a PodGroup (for the scheduler-plugins coscheduling
+// plugin or Volcano) with a minimum of all pods in the set
+type GangScheduling struct {
 
+	// Gang scheduler to create the PodGroup for (empty does not gang schedule)
+	//+kubebuilder:validation:Enum=coscheduling;volcano
 	//+optional
-	Privileged bool `json:"privileged"`
+	Scheduler string `json:"scheduler,omitempty"`
 
+	// Name of the scheduler for the pods (defaults to scheduler-plugins-scheduler
+	// for coscheduling, and volcano for Volcano)
 	//+optional
-	AllowPtrace bool `json:"allowPtrace"`
+	SchedulerName string `json:"schedulerName,omitempty"`
 
+	// Seconds to wait for all pods to be scheduled (coscheduling only, 0 uses the default)
 	//+optional
-	AllowAdmin bool `json:"allowAdmin"`
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
 }
 
-// A Metric addon is an interface that exposes extra volumes for a metric. Examples include:
-// A storage volume to be mounted on one or more of the replicated jobs
-// A single application container.
-type MetricAddon struct {
-	Name string `json:"name"`
+// Enabled determines if gang scheduling is requested
+func (g *GangScheduling) Enabled() bool {
+	return g.Scheduler != ""
+}
 
-	// Metric Addon Options
+// GetSchedulerName returns the scheduler for the pods, or the default for the gang scheduler
+func (g *GangScheduling) GetSchedulerName() string {
+	if g.SchedulerName != "" {
+		return g.SchedulerName
+	}
+	if g.Scheduler == VolcanoScheduler {
+		return "volcano"
+	}
+	return "scheduler-plugins-scheduler"
+}
+
+// Cost estimates the cost of a run as node hours times the hourly price
+// of the instance type of each node
+type Cost struct {
+
+	// Name of a ConfigMap (in the same namespace) with hourly prices in dollars,
+	// keyed by instance type (or <instance-type>.<capacity-type>, e.g., for spot)
 	// +optional
-	Options map[string]intstr.IntOrString `json:"options"`
+	PriceTable string `json:"priceTable"`
+}
 
-	// Addon List Options
+// Profile runs each metric once for each resource configuration, at the same
+// time and in separate pods. Configurations are ordered from smallest to largest,
+// and the first that is within the tolerance of the fastest is recommended.
+type Profile struct {
+
+	// Resources (requests and limits) for the metric container, two or more
 	// +optional
-	ListOptions map[string][]intstr.IntOrString `json:"listOptions"`
+	Configurations []ContainerResources `json:"configurations,omitempty"`
 
-	// Addon Map Options
+	// Percent slower than the fastest configuration that a smaller one can be
+	// and still be recommended
+	// +kubebuilder:default=10
+	// +default=10
 	// +optional
-	MapOptions map[string]map[string]intstr.IntOrString `json:"mapOptions"`
+	Tolerance int32 `json:"tolerance,omitempty"`
+
+	// Timeout in seconds for each calibration run (0 uses the metric timeout)
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
 }
 
-// ContainerResources include limits and requests
-type ContainerResources struct {
+// Enabled determines if profile mode is requested
+func (p *Profile) Enabled() bool {
+	return len(p.Configurations) > 0
+}
+
+// ProfileAlias is the alias of the run of a metric (by index) for a configuration
+func ProfileAlias(metric, configuration int) string {
+	return fmt.Sprintf("m%d-p%d", metric, configuration)
+}
+
+const (
+	StrongScaling = "strong"
+	WeakScaling   = "weak"
+)
+
+// Scaling runs a study of the metrics at a list of pod counts. Each count is a
+// MetricSet (named <name>-<pods>) owned by this one, created when the last finished.
+type Scaling struct {
 
+	// Pod counts to run the metrics at, e.g., 1, 2, 4, 8 (the first is the baseline)
 	// +optional
-	Limits ContainerResource `json:"limits"`
+	Pods []int32 `json:"pods,omitempty"`
 
+	// Strong scaling keeps the problem size, and weak scaling grows it with the pods
+	// +kubebuilder:validation:Enum=strong;weak
+	// +kubebuilder:default="strong"
+	// +default="strong"
 	// +optional
-	Requests ContainerResource `json:"requests"`
+	Mode string `json:"mode,omitempty"`
+
+	// Problem size (per pod for weak scaling) for the {{.ProblemSize}} template variable
+	// +optional
+	ProblemSize int64 `json:"problemSize,omitempty"`
 }
 
-type Commands struct {
+// Enabled determines if a scaling study is requested
+func (s *Scaling) Enabled() bool {
+	return len(s.Pods) > 0
+}
 
-	// pre command happens at start (before anything else)
+// GetProblemSize for a number of pods, multiplied by the pods for weak scaling
+func (s *Scaling) GetProblemSize(pods int32) int64 {
+	if s.Mode == WeakScaling {
+		return s.ProblemSize * int64(pods)
+	}
+	return s.ProblemSize
+}
+
+// ScalingName is the name of the MetricSet for a pod count of a scaling study
+func ScalingName(name string, pods int32) string {
+	return fmt.Sprintf("%s-%d", name, pods)
+}
+
+// ScalingLabel is on the MetricSets of a scaling study, with the name of the study
+const ScalingLabel = "metricset-scaling"
+
+// ScalingSet returns the MetricSet for a pod count of a scaling study. The
+// service (and subdomain) are unique so the hostnames of each resolve to its pods.
+func (m *MetricSet) ScalingSet(pods int32) *MetricSet {
+	child := &MetricSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ScalingName(m.Name, pods),
+			Namespace: m.Namespace,
+			Labels:    map[string]string{ScalingLabel: m.Name},
+		},
+		Spec: *m.Spec.DeepCopy(),
+	}
+	child.Spec.Pods = pods
+	child.Spec.Scaling.Pods = nil
+	child.Spec.ServiceName = ScalingName(m.Spec.ServiceName, pods)
+	if child.Spec.Network.Subdomain != "" {
+		child.Spec.Network.Subdomain = ScalingName(m.Spec.Network.Subdomain, pods)
+	}
+	return child
+}
+
+// Acceptance runs the metrics on every node of a pool, one pod per node, and
+// compares the values each node reports (with mo_report) against thresholds or
+// the median of the pool. The nodes are found when the run is created.
+type Acceptance struct {
+
+	// Checks of the values the metrics report for each node
 	// +optional
-	Pre string `json:"pre"`
+	Checks []AcceptanceCheck `json:"checks,omitempty"`
 
-	// Command prefix to put in front of a metric main command (not applicable for all)
-	//+optional
-	Prefix string `json:"prefix"`
+	// Label the nodes with the result (metrics-operator/acceptance is passed or failed)
+	// +optional
+	LabelNodes bool `json:"labelNodes,omitempty"`
 
-	// post happens at end (after collection end)
+	// Nodes of the pool, if only some of the nodes matching the node selector
 	// +optional
-	Post string `json:"post"`
+	Nodes []string `json:"nodes,omitempty"`
 }
 
-type ContainerResource map[string]intstr.IntOrString
+// AcceptanceCheck is a value a metric reports, and the range (or tolerance from
+// the median of the pool) a node needs to be in to pass. Numbers are strings,
+// since floats are not portable in the API.
+type AcceptanceCheck struct {
 
-// The difference between benchmark and metric is subtle.
-// A metric is more a measurment, and the benchmark is the comparison value.
-// I don't have strong opinions but I think we are doing more measurment
-// not necessarily with benchmarks
+	// Name (or alias) of the metric that reports the value
+	Metric string `json:"metric"`
 
-// A metric is basically a container. It minimally provides:
-// In the simplest case, a sidecar container (e.g., service or similar)
-// Optionally: Possibly additional volumes that can be mounted in
-// With a shared process namespace, ability to monitor
+	// Name of the value, e.g., sustainedRatio
+	Value string `json:"value"`
 
-type Metric struct {
-	Name string `json:"name"`
+	// Minimum for a node to pass
+	// +optional
+	Min string `json:"min,omitempty"`
 
-	// Metric Options
-	// Metric specific options
+	// Maximum for a node to pass
 	// +optional
-	Options map[string]intstr.IntOrString `json:"options"`
+	Max string `json:"max,omitempty"`
 
-	// Use a custom container image (advanced users only)
+	// Percent a node can be worse than the median of the pool
 	// +optional
-	Image string `json:"image,omitempty"`
+	MedianTolerance int32 `json:"medianTolerance,omitempty"`
 
-	// A Metric addon can be storage (volume) or an application,
-	// It's an additional entity that can customize a replicated job,
-	// either adding assets / features or entire containers to the pod
-	//+optional
-	Addons []MetricAddon `json:"addons"`
+	// Lower values are better (e.g., a latency), for the median tolerance
+	// +optional
+	LowerIsBetter bool `json:"lowerIsBetter,omitempty"`
+}
 
-	// Metric List Options
-	// Metric specific options
+// Enabled determines if the run is a node acceptance run
+func (a *Acceptance) Enabled() bool {
+	return len(a.Checks) > 0
+}
+
+// AcceptanceLabel is the node label with the result of an acceptance run
+const AcceptanceLabel = "metrics-operator/acceptance"
+
+// Results of a node in an acceptance run
+const (
+	AcceptancePassed = "passed"
+	AcceptanceFailed = "failed"
+)
+
+// Key is the name of the value of a check in the report, <metric>/<value>
+func (c *AcceptanceCheck) Key() string {
+	return c.Metric + "/" + c.Value
+}
+
+// Canary runs the metrics periodically, each run on the next nodes of the pool
+// in turn, as an acceptance run. A node is degraded if a value fails a check,
+// where the median tolerance is from the median of the values of recent runs.
+type Canary struct {
+
+	// Seconds from the start of one run to the next
 	// +optional
-	ListOptions map[string][]intstr.IntOrString `json:"listOptions"`
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
 
-	// Metric Map Options
+	// Nodes for each run
+	// +kubebuilder:default=1
+	// +default=1
 	// +optional
-	MapOptions map[string]map[string]intstr.IntOrString `json:"mapOptions"`
+	Nodes int32 `json:"nodes,omitempty"`
 
-	// Container Spec has attributes for the container
-	//+optional
-	Attributes ContainerSpec `json:"attributes"`
+	// Checks of the values the metrics report for each node
+	// +optional
+	Checks []AcceptanceCheck `json:"checks,omitempty"`
 
-	// Resources include limits and requests for the metric container
+	// Results (of a node in a run) to keep, and compare against
+	// +kubebuilder:default=50
+	// +default=50
 	// +optional
-	Resources ContainerResources `json:"resources"`
+	History int32 `json:"history,omitempty"`
 }
 
-// Get pod labels for a metric set
-func (m *MetricSet) GetPodLabels() map[string]string {
+// Enabled determines if the MetricSet is a canary
+func (c *Canary) Enabled() bool {
+	return c.IntervalSeconds > 0
+}
 
-	// Start with those provided by the user
-	podLabels := m.Spec.Pod.Labels
+// CanaryName is the name of the MetricSet for a run of a canary
+func CanaryName(name string, run int32) string {
+	return fmt.Sprintf("%s-c%d", name, run)
+}
 
-	// This is for autoscaling, although haven't used yet
-	podLabels["cluster-name"] = m.Name
-	// This is for the headless service
-	podLabels["metricset-name"] = m.Name
-	podLabels["namespace"] = m.Namespace
-	podLabels["app.kubernetes.io/name"] = m.Name
-	return podLabels
+// The condition of a canary when a node is degraded, and its reasons
+const (
+	DegradedCondition = "Degraded"
+	CanaryDegraded    = "NodesDegraded"
+	CanaryHealthy     = "NodesHealthy"
+)
+
+// Autoscaler prepares a run for nodes provisioned by a cluster autoscaler.
+// When enabled, provisioning time is recorded for each pod.
+type Autoscaler struct {
+
+	// Annotate pods so the autoscaler does not evict them to scale down
+	// +optional
+	Protect bool `json:"protect"`
+
+	// Wait up to this many seconds for all pods to be ready before the metric
+	// command runs (0 does not wait)
+	// +optional
+	WaitSeconds int32 `json:"waitSeconds"`
+
+	// Karpenter NodePool to provision nodes from (karpenter.sh/nodepool)
+	// +optional
+	NodePool string `json:"nodePool"`
+
+	// Instance types to require for the nodes (node.kubernetes.io/instance-type)
+	// +optional
+	InstanceTypes []string `json:"instanceTypes"`
 }
 
-// MetricStatus defines the observed state of Metric
-type MetricSetStatus struct{}
+// Markers are echoed in the output of metrics so it can be parsed. They default
+// to the values the parsers expect, and can be changed if they collide with output.
+type Markers struct {
 
-//+kubebuilder:object:root=true
-//+kubebuilder:subresource:status
+	// Separator between timepoints (sections) of output
+	//+optional
+	Separator string `json:"separator,omitempty"`
 
-// MetricSet is the Schema for the metrics API
-type MetricSet struct {
-	metav1.TypeMeta   `json:",inline"`
-	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Start of the output of a metric
+	//+optional
+	CollectionStart string `json:"collectionStart,omitempty"`
 
-	Spec   MetricSetSpec   `json:"spec,omitempty"`
-	Status MetricSetStatus `json:"status,omitempty"`
+	// End of the output of a metric
+	//+optional
+	CollectionEnd string `json:"collectionEnd,omitempty"`
+
+	// Frame the output of metric commands, so it cannot be confused with the markers.
+	// With base64, each line of output is encoded between frame start and end lines.
+	//+kubebuilder:validation:Enum=base64
+	//+optional
+	Framing string `json:"framing,omitempty"`
+
+	// Collect phase markers ("init done", "timestep 100") that applications append
+	// to METRICS_OPERATOR_PHASES, and print them with the samples of metrics that
+	// sample an application, so the samples can be segmented by phase
+	//+optional
+	Phases bool `json:"phases,omitempty"`
 }
 
-// Validate a requested metricset
-func (m *MetricSet) Validate() bool {
+// Results are written under /metrics_operator_results/<set>/<run>/<job>/<pod>,
+// on an empty volume by default or an existing persistent volume claim
+type Results struct {
 
-	if m.Spec.Pod.Labels == nil {
-		m.Spec.Pod.Labels = map[string]string{}
+	// Existing persistent volume claim to write results to (empty is an empty volume)
+	// +optional
+	ClaimName string `json:"claimName"`
+
+	// Compress each pod results directory when the metric finishes
+	// +optional
+	Compress bool `json:"compress"`
+
+	// Keep only this many runs for the MetricSet on the volume (0 keeps all)
+	// +optional
+	Keep int32 `json:"keep"`
+}
+
+// Scratch provisions a shared read-write-many volume that is mounted
+// into all containers, and cleaned up when the run finishes
+type Scratch struct {
+
+	// Storage class that supports ReadWriteMany (required to enable scratch)
+	// +optional
+	StorageClassName string `json:"storageClassName"`
+
+	// Size of the volume to request
+	// +kubebuilder:default="10Gi"
+	// +default="10Gi"
+	// +optional
+	Size string `json:"size"`
+
+	// Path to mount the scratch volume in all containers
+	// +kubebuilder:default="/scratch"
+	// +default="/scratch"
+	// +optional
+	Path string `json:"path"`
+
+	// Keep the volume after the run (it is still deleted with the MetricSet)
+	// +optional
+	Keep bool `json:"keep"`
+}
+
+// Enabled determines if scratch is requested
+func (s *Scratch) Enabled() bool {
+	return s.StorageClassName != ""
+}
+
+// Enabled determines if autoscaler awareness is requested
+func (a *Autoscaler) Enabled() bool {
+	return a.Protect || a.WaitSeconds > 0 || a.NodePool != "" || len(a.InstanceTypes) > 0
+}
+
+// RecordsNodes determines if the nodes the pods run on are recorded in the status
+func (m *MetricSet) RecordsNodes() bool {
+	return m.Spec.Autoscaler.Enabled() || m.Spec.Cost.PriceTable != "" || m.HasPlacement()
+}
+
+// HasPlacement determines if any metric requests a placement of its pods
+func (m *MetricSet) HasPlacement() bool {
+	for _, metric := range m.Spec.Metrics {
+		if metric.Placement != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge lightweight sampler metrics that share an image into one container
+// with a combined entrypoint, reducing per-pod overhead
+type Merge struct {
+
+	// Enable merging of compatible metrics
+	// +optional
+	Enabled bool `json:"enabled"`
+
+	// Only merge metrics belonging to these families (defaults to all)
+	// +optional
+	Families []string `json:"families"`
+}
+
+type Logging struct {
+
+	// Don't allow the application, metric, or storage test to finish
+	// This adds sleep infinity at the end to allow for interactive mode.
+	// +optional
+	Interactive bool `json:"interactive"`
+}
+
+// Pod attributes that can be given to an application or metric
+type Pod struct {
+
+	// Annotations to add to the pod
+	//+optional
+	Annotations map[string]string `json:"annotations"`
+
+	// Labels to add to the pod
+	//+optional
+	Labels map[string]string `json:"labels"`
+
+	// name of service account to associate with pod
+	//+optional
+	ServiceAccountName string `json:"serviceAccountName"`
+
+	// NodeSelector labels
+	//+optional
+	NodeSelector map[string]string `json:"nodeSelector"`
+
+	// Operating system of the nodes (linux or windows). Windows is supported
+	// for a subset of metrics, and entrypoints are run with PowerShell.
+	//+kubebuilder:validation:Enum=linux;windows
+	//+optional
+	OS string `json:"os,omitempty"`
+
+	// Run the pod in a user namespace (hostUsers false), so root and capabilities
+	// in the containers are not root on the node. The cluster must support it.
+	//+optional
+	UserNamespaces bool `json:"userNamespaces,omitempty"`
+
+	// Run the metric and application containers as a user and group, e.g., to
+	// write to a shared filesystem (NFS or Lustre) that squashes root
+	//+optional
+	RunAs RunAs `json:"runAs,omitempty"`
+}
+
+// RunAs is the user and groups of the metric and application containers.
+// Containers that are privileged or add capabilities keep the user of their
+// image, since capabilities are only effective for root.
+type RunAs struct {
+
+	// User id (0 keeps the user of the image)
+	//+optional
+	User int64 `json:"user,omitempty"`
+
+	// Group id (0 keeps the group of the image)
+	//+optional
+	Group int64 `json:"group,omitempty"`
+
+	// Supplemental groups for the processes of the pod
+	//+optional
+	SupplementalGroups []int64 `json:"supplementalGroups,omitempty"`
+
+	// Chown the scratch, results, and checkpoint volumes to the user and group
+	// in an init container (as root) before the containers start
+	//+optional
+	Chown bool `json:"chown,omitempty"`
+
+	// Image for the chown init container (with sh)
+	//+kubebuilder:default="busybox:stable"
+	//+default="busybox:stable"
+	//+optional
+	Image string `json:"image,omitempty"`
+}
+
+// Enabled determines if the containers run as a user or group
+func (r *RunAs) Enabled() bool {
+	return r.User > 0 || r.Group > 0 || len(r.SupplementalGroups) > 0
+}
+
+// A container spec can belong to a metric or application
+type ContainerSpec struct {
+
+	// Security context for the pod
+	//+optional
+	SecurityContext SecurityContext `json:"securityContext"`
+
+	// Probes for the container
+	//+optional
+	Probes Probes `json:"probes"`
+}
+
+// Probes for readiness, liveness, and startup of a container
+type Probes struct {
+
+	//+optional
+	Readiness Probe `json:"readiness"`
+
+	//+optional
+	Liveness Probe `json:"liveness"`
+
+	//+optional
+	Startup Probe `json:"startup"`
+}
+
+// A Probe is defined by one of a command, an http path (with port), or a tcp port
+type Probe struct {
+
+	// Command to execute in the container
+	//+optional
+	Command string `json:"command"`
+
+	// HTTP path to get (requires a port)
+	//+optional
+	Path string `json:"path"`
+
+	// Port for an http or tcp probe
+	//+optional
+	Port int32 `json:"port"`
+
+	//+optional
+	InitialDelaySeconds int32 `json:"initialDelaySeconds"`
+
+	//+optional
+	PeriodSeconds int32 `json:"periodSeconds"`
+
+	//+optional
+	FailureThreshold int32 `json:"failureThreshold"`
+}
+
+// IsEmpty determines if the probe is defined
+func (p *Probe) IsEmpty() bool {
+	return p.Command == "" && p.Port == 0
+}
+
+type SecurityContext struct {
+
+	//+optional
+	Privileged bool `json:"privileged"`
+
+	//+optional
+	AllowPtrace bool `json:"allowPtrace"`
+
+	//+optional
+	AllowAdmin bool `json:"allowAdmin"`
+
+	// Add CAP_PERFMON (kernel 5.8+), to collect perf events without SYS_ADMIN
+	//+optional
+	AllowPerfmon bool `json:"allowPerfmon"`
+}
+
+// A Metric addon is an interface that exposes extra volumes for a metric. Examples include:
+// A storage volume to be mounted on one or more of the replicated jobs
+// A single application container.
+type MetricAddon struct {
+	Name string `json:"name"`
+
+	// Metric Addon Options
+	// +optional
+	Options map[string]intstr.IntOrString `json:"options"`
+
+	// Addon List Options
+	// +optional
+	ListOptions map[string][]intstr.IntOrString `json:"listOptions"`
+
+	// Addon Map Options
+	// +optional
+	MapOptions map[string]map[string]intstr.IntOrString `json:"mapOptions"`
+}
+
+// ContainerResources include limits and requests
+type ContainerResources struct {
+
+	// +optional
+	Limits ContainerResource `json:"limits"`
+
+	// +optional
+	Requests ContainerResource `json:"requests"`
+}
+
+type Commands struct {
+
+	// pre command happens at start (before anything else)
+	// +optional
+	Pre string `json:"pre"`
+
+	// Command prefix to put in front of a metric main command (not applicable for all)
+	//+optional
+	Prefix string `json:"prefix"`
+
+	// post happens at end (after collection end)
+	// +optional
+	Post string `json:"post"`
+}
+
+type ContainerResource map[string]intstr.IntOrString
+
+// The difference between benchmark and metric is subtle.
+// A metric is more a measurment, and the benchmark is the comparison value.
+// I don't have strong opinions but I think we are doing more measurment
+// not necessarily with benchmarks
+
+// A metric is basically a container. It minimally provides:
+// In the simplest case, a sidecar container (e.g., service or similar)
+// Optionally: Possibly additional volumes that can be mounted in
+// With a shared process namespace, ability to monitor
+
+type Metric struct {
+	Name string `json:"name"`
+
+	// Alias for the metric, to run the same metric more than once in a set
+	// (e.g., with different options). It is used in place of the name for
+	// entrypoints, inputs, the replicated job, and results metadata.
+	// +optional
+	Alias string `json:"alias,omitempty"`
+
+	// Metric Options
+	// Metric specific options
+	// +optional
+	Options map[string]intstr.IntOrString `json:"options"`
+
+	// Use a custom container image (advanced users only)
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// A Metric addon can be storage (volume) or an application,
+	// It's an additional entity that can customize a replicated job,
+	// either adding assets / features or entire containers to the pod
+	//+optional
+	Addons []MetricAddon `json:"addons"`
+
+	// Metric List Options
+	// Metric specific options
+	// +optional
+	ListOptions map[string][]intstr.IntOrString `json:"listOptions"`
+
+	// Metric Map Options
+	// +optional
+	MapOptions map[string]map[string]intstr.IntOrString `json:"mapOptions"`
+
+	// Inputs are files (by name) written to the config map and mounted under
+	// /metrics_operator/inputs/<metric>, e.g., an input deck for an application
+	// +optional
+	Inputs map[string]string `json:"inputs,omitempty"`
+
+	// Secrets are environment variables for the metric containers from keys of
+	// secrets, so credentials are referenced (e.g., ${TOKEN}) instead of being
+	// written into the entrypoints
+	// +optional
+	Secrets []SecretEnv `json:"secrets,omitempty"`
+
+	// Container Spec has attributes for the container
+	//+optional
+	Attributes ContainerSpec `json:"attributes"`
+
+	// Resources include limits and requests for the metric container
+	// +optional
+	Resources ContainerResources `json:"resources"`
+
+	// Shell to run the entrypoint of the metric containers with (bash or sh).
+	// The entrypoint scaffolding is POSIX sh compatible for images without bash.
+	// +kubebuilder:validation:Enum=bash;sh
+	// +optional
+	Shell string `json:"shell,omitempty"`
+
+	// Timeout in seconds for the command of this metric (overrides commandTimeout)
+	// On timeout, partial results are flushed and the metric is marked TimedOut
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// Placement of the client pods relative to the server (launcher) pod, for
+	// metrics with a client and server (e.g., network metrics). The achieved
+	// placement is recorded in the status.
+	// +kubebuilder:validation:Enum=same-node;same-zone;cross-zone;cross-region
+	// +optional
+	Placement string `json:"placement,omitempty"`
+
+	// Overrides for pods by completion index, e.g., so pods 0-3 of a replicated
+	// job get the environment and flags of IO servers and the others are clients
+	// +optional
+	Overrides []IndexOverride `json:"overrides,omitempty"`
+
+	// Checkpoints of a restartable application, so a pod that is rescheduled
+	// resumes from the latest instead of starting over
+	// +optional
+	Checkpoint Checkpoint `json:"checkpoint,omitempty"`
+}
+
+// Checkpoint is a contract with a restartable application: it writes checkpoints
+// to a directory on a persistent volume, and takes flags to restart from one.
+// Pods keep their completion index when rescheduled, so each index has its own
+// directory (METRICS_OPERATOR_CHECKPOINT_DIR) for the run.
+type Checkpoint struct {
+
+	// Existing persistent volume claim for the checkpoints (required to enable)
+	// +optional
+	ClaimName string `json:"claimName,omitempty"`
+
+	// Path to mount the claim
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Pattern (a shell glob) of checkpoints in the directory, where the most
+	// recently modified is the latest (METRICS_OPERATOR_CHECKPOINT)
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+
+	// Flags to restart from the latest checkpoint, e.g., "-restart {{.Checkpoint}}",
+	// appended to a single line command (and in METRICS_OPERATOR_RESTART_FLAGS)
+	// when there is one
+	// +optional
+	RestartFlags string `json:"restartFlags,omitempty"`
+}
+
+// Default path and pattern of checkpoints
+const (
+	CheckpointPath    = "/metrics_operator_checkpoints"
+	CheckpointPattern = "*"
+)
+
+// Enabled determines if checkpoints are requested
+func (c *Checkpoint) Enabled() bool {
+	return c.ClaimName != ""
+}
+
+// GetPath returns the path to mount the claim, or the default
+func (c *Checkpoint) GetPath() string {
+	if c.Path == "" {
+		return CheckpointPath
+	}
+	return c.Path
+}
+
+// GetPattern returns the pattern of checkpoints, or the default
+func (c *Checkpoint) GetPattern() string {
+	if c.Pattern == "" {
+		return CheckpointPattern
+	}
+	return c.Pattern
+}
+
+// validate checks the path and pattern are safe to use in the entrypoint
+func (c *Checkpoint) validate(metric string) bool {
+	if !c.Enabled() {
+		if c.Path != "" || c.Pattern != "" || c.RestartFlags != "" {
+			logger.Errorf("😥️ Checkpoint for metric %s needs a claimName.", metric)
+			return false
+		}
+		return true
+	}
+	if !strings.HasPrefix(c.GetPath(), "/") || !checkpointPathRegex.MatchString(c.GetPath()) {
+		logger.Errorf("😥️ Checkpoint path for metric %s must be an absolute path (letters, numbers, '-', '_', '.', or '/'), found %q", metric, c.GetPath())
+		return false
+	}
+	if c.GetPath() == "/metrics_operator" || strings.HasPrefix(c.GetPath(), "/metrics_operator/") {
+		logger.Errorf("😥️ Checkpoint path for metric %s cannot be under /metrics_operator, which is read-only.", metric)
+		return false
+	}
+	if !checkpointPatternRegex.MatchString(c.GetPattern()) {
+		logger.Errorf("😥️ Checkpoint pattern for metric %s must be a file name glob (letters, numbers, '-', '_', '.', '*', or '?'), found %q", metric, c.GetPattern())
+		return false
+	}
+	return true
+}
+
+// IndexOverride sets environment variables and flags for the metric containers
+// of pods with some completion indices. When more than one override matches a
+// pod, they are applied in order.
+type IndexOverride struct {
+
+	// Completion indices of the pods, e.g., "0-3", "4-" (4 and up), or "0,2,5-7"
+	Indices string `json:"indices"`
+
+	// Replicated job of the pods (e.g., w for workers), all if unset
+	// +optional
+	Job string `json:"job,omitempty"`
+
+	// Environment variables for the pods
+	// +optional
+	Env map[string]string `json:"env,omitempty"`
+
+	// Flags appended to a single line command, and in METRICS_OPERATOR_FLAGS
+	// for the command to use
+	// +optional
+	Flags string `json:"flags,omitempty"`
+}
+
+// IndexRange is a range of completion indices, where an End of -1 has no end
+type IndexRange struct {
+	Start int
+	End   int
+}
+
+// Ranges parses the completion indices of the override
+func (o *IndexOverride) Ranges() ([]IndexRange, error) {
+	ranges := []IndexRange{}
+	for _, part := range strings.Split(o.Indices, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("index %q is not a number 0 or greater", bounds[0])
+		}
+		end := start
+		if len(bounds) == 2 {
+			end = -1
+			if bounds[1] != "" {
+				end, err = strconv.Atoi(bounds[1])
+				if err != nil || end < start {
+					return nil, fmt.Errorf("range %q does not end at or after its start", part)
+				}
+			}
+		}
+		ranges = append(ranges, IndexRange{Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+// Placements of client pods relative to the server pod
+const (
+	PlacementSameNode    = "same-node"
+	PlacementSameZone    = "same-zone"
+	PlacementCrossZone   = "cross-zone"
+	PlacementCrossRegion = "cross-region"
+)
+
+// SecretEnv is an environment variable from a key of a secret in the namespace
+type SecretEnv struct {
+
+	// Name of the environment variable
+	Name string `json:"name"`
+
+	// Name of the secret
+	SecretName string `json:"secretName"`
+
+	// Key in the secret
+	Key string `json:"key"`
+}
+
+// Get pod labels for a metric set
+func (m *MetricSet) GetPodLabels() map[string]string {
+
+	// Start with those provided by the user
+	podLabels := m.Spec.Pod.Labels
+
+	// This is for autoscaling, although haven't used yet
+	podLabels["cluster-name"] = m.Name
+	// This is for the headless service
+	podLabels["metricset-name"] = m.Name
+	podLabels["namespace"] = m.Namespace
+	podLabels["app.kubernetes.io/name"] = m.Name
+	return podLabels
+}
+
+// MetricStatus defines the observed state of Metric
+type MetricSetStatus struct {
+
+	// Nodes the pods ran on, recorded when autoscaler awareness, cost, or a placement is enabled
+	// +optional
+	Nodes []NodeStatus `json:"nodes,omitempty"`
+
+	// Placement of the client pods of metrics that request one
+	// +optional
+	Placement []PlacementStatus `json:"placement,omitempty"`
+
+	// Shards (JobSets) of a sharded run, and their state
+	// +optional
+	Shards []ShardStatus `json:"shards,omitempty"`
+
+	// Estimated cost of the run, when it has finished
+	// +optional
+	Cost *CostStatus `json:"cost,omitempty"`
+
+	// The pool of an acceptance run, and the report of each node when it has finished
+	// +optional
+	Acceptance *AcceptanceStatus `json:"acceptance,omitempty"`
+
+	// Runs of a canary, and the recent results of each node
+	// +optional
+	Canary *CanaryStatus `json:"canary,omitempty"`
+
+	// Metrics that did not finish normally (e.g., TimedOut)
+	// +optional
+	Metrics []MetricState `json:"metrics,omitempty"`
+
+	// Containers that failed, grouped by how (e.g., exit code 137 on 3 of 128 pods)
+	// +optional
+	Failures *FailureStatus `json:"failures,omitempty"`
+
+	// Runtime of each configuration in profile mode, and recommendations
+	// +optional
+	Profile *ProfileStatus `json:"profile,omitempty"`
+
+	// Runtime, speedup, and efficiency of each pod count of a scaling study
+	// +optional
+	Scaling []ScalingResult `json:"scaling,omitempty"`
+
+	// The rendered JobSet and entrypoints that were created
+	// +optional
+	Rendered *RenderedStatus `json:"rendered,omitempty"`
+
+	// The options of each metric and addon after defaults were applied
+	// +optional
+	ResolvedConfig []ResolvedMetric `json:"resolvedConfig,omitempty"`
+
+	// Pods waiting to be released in debug mode (ready to exec into)
+	// +optional
+	WaitingPods []string `json:"waitingPods,omitempty"`
+
+	// Cancellation of the run (Stopping or Cancelled), when cancel is set
+	// +optional
+	Cancellation string `json:"cancellation,omitempty"`
+
+	// Conditions of the MetricSet, e.g., Preflight (False when the cluster does
+	// not have a feature or API the MetricSet needs)
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// The preflight condition, and its reasons
+const (
+	PreflightCondition   = "Preflight"
+	PreflightPassed      = "Passed"
+	PreflightUnsupported = "Unsupported"
+)
+
+// States of a cancelled run
+const (
+	CancelStopping  = "Stopping"
+	CancelCancelled = "Cancelled"
+)
+
+// RenderedStatus identifies the JobSet and entrypoints that were created for the run
+type RenderedStatus struct {
+
+	// Sha256 digest of the JobSet spec and the entrypoints
+	Hash string `json:"hash"`
+
+	// Config map with the rendered JobSet and entrypoints, if recorded
+	// +optional
+	ConfigMap string `json:"configMap,omitempty"`
+}
+
+// ResolvedMetric is a metric with all of its options (and those of its addons)
+// resolved, in the same shape as the spec, so it can be archived or reused
+type ResolvedMetric struct {
+	Name string `json:"name"`
+
+	// +optional
+	Alias string `json:"alias,omitempty"`
+
+	// The container image the metric runs
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Version of the metric (the revision of its scripts and the image tag)
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// +optional
+	Options map[string]intstr.IntOrString `json:"options,omitempty"`
+
+	// +optional
+	ListOptions map[string][]intstr.IntOrString `json:"listOptions,omitempty"`
+
+	// +optional
+	MapOptions map[string]map[string]intstr.IntOrString `json:"mapOptions,omitempty"`
+
+	// +optional
+	Addons []MetricAddon `json:"addons,omitempty"`
+}
+
+// FailureStatus summarizes the failed containers of the pods of a set
+type FailureStatus struct {
+
+	// Pods of the set that were found, and how many had a failed container
+	Pods   int32 `json:"pods"`
+	Failed int32 `json:"failed"`
+
+	// Failed containers, grouped by replicated job, container, exit code, reason,
+	// and message, from the most to the least common
+	// +optional
+	Summaries []FailureSummary `json:"summaries,omitempty"`
+}
+
+// FailureSummary is a group of containers that failed the same way
+type FailureSummary struct {
+	Job       string `json:"job"`
+	Container string `json:"container"`
+	ExitCode  int32  `json:"exitCode"`
+
+	// The reason from the kubelet, e.g., OOMKilled or Error
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// The summary the entrypoint wrote (or the last line of the log)
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Containers in the group, and the first few of their pods
+	Count int32    `json:"count"`
+	Pods  []string `json:"pods"`
+}
+
+// MetricState is the state of a metric in the set, e.g., when it timed out
+type MetricState struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// ProfileStatus has the results of profile mode, when the run has finished
+type ProfileStatus struct {
+	Results []ProfileResult `json:"results"`
+
+	// The recommended configuration for each metric that finished
+	// +optional
+	Recommendations []ProfileRecommendation `json:"recommendations,omitempty"`
+}
+
+// ProfileResult is the runtime of a metric with a resource configuration.
+// Values are strings (formatted decimals) since floats are not portable in the API.
+type ProfileResult struct {
+
+	// Metric name (or alias) and the index of the configuration
+	Metric        string `json:"metric"`
+	Configuration int32  `json:"configuration"`
+
+	// Seconds from the first metric container starting to the last finishing
+	// +optional
+	Seconds string `json:"seconds,omitempty"`
+
+	// Throughput, as runs per hour
+	// +optional
+	RunsPerHour string `json:"runsPerHour,omitempty"`
+
+	// The run did not finish normally (e.g., Failed or TimedOut) and is not compared
+	// +optional
+	State string `json:"state,omitempty"`
+}
+
+// ProfileRecommendation is the configuration recommended for a metric
+type ProfileRecommendation struct {
+	Metric        string             `json:"metric"`
+	Configuration int32              `json:"configuration"`
+	Resources     ContainerResources `json:"resources"`
+}
+
+// ScalingResult is the runtime of a metric at a pod count of a scaling study,
+// relative to the first. Values are formatted decimals.
+type ScalingResult struct {
+	Metric string `json:"metric"`
+	Pods   int32  `json:"pods"`
+
+	// Seconds from the first metric container starting to the last finishing
+	// +optional
+	Seconds string `json:"seconds,omitempty"`
+
+	// Baseline seconds divided by seconds
+	// +optional
+	Speedup string `json:"speedup,omitempty"`
+
+	// Speedup divided by the increase in pods for strong scaling, or the speedup
+	// for weak scaling (1.0 is ideal)
+	// +optional
+	Efficiency string `json:"efficiency,omitempty"`
+
+	// The run did not finish normally (e.g., Failed or TimedOut)
+	// +optional
+	State string `json:"state,omitempty"`
+}
+
+// AcceptanceStatus is the pool of nodes of an acceptance run, and the report
+type AcceptanceStatus struct {
+
+	// Nodes of the pool, found when the run was created (one pod runs on each)
+	Pool []string `json:"pool"`
+
+	// Report for each node, when the run has finished
+	// +optional
+	Nodes []NodeAcceptance `json:"nodes,omitempty"`
+
+	// Nodes that passed and failed
+	// +optional
+	Passed int32 `json:"passed,omitempty"`
+
+	// +optional
+	Failed int32 `json:"failed,omitempty"`
+}
+
+// CanaryStatus is the progress of a canary, the recent results, and the nodes
+// that were degraded in their last run
+type CanaryStatus struct {
+
+	// Runs that have finished
+	Runs int32 `json:"runs"`
+
+	// Index in the pool of the next node to run on
+	// +optional
+	Next int32 `json:"next,omitempty"`
+
+	// When the last run was created
+	// +optional
+	LastRun *metav1.Time `json:"lastRun,omitempty"`
+
+	// Results of each node in recent runs, from oldest to newest
+	// +optional
+	Results []CanaryResult `json:"results,omitempty"`
+
+	// Nodes that were degraded in their last run
+	// +optional
+	Degraded []string `json:"degraded,omitempty"`
+}
+
+// CanaryResult is the result of the checks for a node in a run of a canary
+type CanaryResult struct {
+	Run            int32 `json:"run"`
+	NodeAcceptance `json:",inline"`
+}
+
+// NodeAcceptance is the result of the checks for a node, with the values it
+// reported (by <metric>/<value>) and why it failed
+type NodeAcceptance struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+
+	// +optional
+	Values map[string]string `json:"values,omitempty"`
+
+	// +optional
+	Failures []string `json:"failures,omitempty"`
+}
+
+// CostStatus is the estimated cost of a finished run. Values are strings
+// (formatted decimals) since floats are not portable in the API.
+type CostStatus struct {
+
+	// Estimated dollars for the run (all metrics in the set)
+	Dollars string `json:"dollars"`
+
+	// Total node hours, from when the first pod started to when the JobSet finished
+	NodeHours string `json:"nodeHours"`
+
+	// Instance types without a price (not included in the dollars)
+	// +optional
+	Unpriced []string `json:"unpriced,omitempty"`
+}
+
+// NodeStatus is a node that was provisioned for (and ran) pods of the MetricSet
+type NodeStatus struct {
+	Name         string `json:"name"`
+	InstanceType string `json:"instanceType,omitempty"`
+
+	// Karpenter NodePool and capacity type (e.g., spot or on-demand), if known
+	NodePool     string `json:"nodePool,omitempty"`
+	CapacityType string `json:"capacityType,omitempty"`
+
+	// Zone and region of the node, if labeled
+	Zone   string `json:"zone,omitempty"`
+	Region string `json:"region,omitempty"`
+
+	// Names of the pods on the node
+	Pods []string `json:"pods"`
+}
+
+// PlacementStatus is the placement requested for the pods of a metric, and
+// the placement the scheduler achieved (empty until all pods are on a node)
+type PlacementStatus struct {
+	Metric    string `json:"metric"`
+	Requested string `json:"requested"`
+
+	// +optional
+	Achieved string `json:"achieved,omitempty"`
+}
+
+// ShardStatus is the state of the JobSet of a shard (queued while it waits
+// for the other shards, then active, completed, or failed)
+type ShardStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// MetricSet is the Schema for the metrics API
+type MetricSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MetricSetSpec   `json:"spec,omitempty"`
+	Status MetricSetStatus `json:"status,omitempty"`
+}
+
+// ExpandedMetrics are the metrics to run. In profile mode, each metric runs
+// once for each configuration, with an alias and the configuration resources.
+func (m *MetricSet) ExpandedMetrics() []Metric {
+	profile := m.Spec.Profile
+	if !profile.Enabled() {
+		return m.Spec.Metrics
+	}
+	metrics := []Metric{}
+	for i, metric := range m.Spec.Metrics {
+		for j, resources := range profile.Configurations {
+			run := *metric.DeepCopy()
+			run.Alias = ProfileAlias(i, j)
+			run.Resources = *resources.DeepCopy()
+			if profile.TimeoutSeconds > 0 {
+				run.TimeoutSeconds = profile.TimeoutSeconds
+			}
+			metrics = append(metrics, run)
+		}
+	}
+	return metrics
+}
+
+// RolePods returns the pods for a role (replicated job), falling back to the
+// size the metric gives it
+func (m *MetricSet) RolePods(role string, pods int32) int32 {
+	rolePods, ok := m.Spec.Roles[role]
+	if ok {
+		return rolePods
+	}
+	return pods
+}
+
+// Validate a requested metricset
+func (m *MetricSet) Validate() bool {
+
+	if m.Spec.Pod.Labels == nil {
+		m.Spec.Pod.Labels = map[string]string{}
 	}
 	if m.Spec.Pod.Annotations == nil {
 		m.Spec.Pod.Annotations = map[string]string{}
 	}
 	if len(m.Spec.Metrics) == 0 {
-		fmt.Printf("😥️ One or more metrics are required.\n")
+		logger.Error("😥️ One or more metrics are required.")
 		return false
 	}
 	if m.Spec.Pods < 1 {
-		fmt.Printf("😥️ Pods must be >= 1.")
+		logger.Error("😥️ Pods must be >= 1.")
+		return false
+	}
+	for role, pods := range m.Spec.Roles {
+		if pods < 1 {
+			logger.Errorf("😥️ Pods for role %s must be >= 1, found %d", role, pods)
+			return false
+		}
+	}
+	keys := map[string]bool{}
+	for _, metric := range m.Spec.Metrics {
+		if metric.Alias != "" && !aliasRegex.MatchString(metric.Alias) {
+			logger.Errorf("😥️ Alias %s for metric %s must be lowercase letters, numbers, and '-' (up to 20 characters).", metric.Alias, metric.Name)
+			return false
+		}
+		if keys[metric.Key()] {
+			logger.Errorf("😥️ Metric %s is included more than once, give each an alias.", metric.Key())
+			return false
+		}
+		keys[metric.Key()] = true
+		if metric.Shell != "" && metric.Shell != "bash" && metric.Shell != "sh" {
+			logger.Errorf("😥️ Shell for metric %s must be bash or sh, found %s", metric.Name, metric.Shell)
+			return false
+		}
+		if metric.TimeoutSeconds < 0 {
+			logger.Errorf("😥️ Timeout for metric %s must be 0 (none) or greater, found %d", metric.Name, metric.TimeoutSeconds)
+			return false
+		}
+		for _, secret := range metric.Secrets {
+			if !envNameRegex.MatchString(secret.Name) || secret.SecretName == "" || secret.Key == "" {
+				logger.Errorf("😥️ Secret %s for metric %s needs a valid variable name, secretName, and key.", secret.Name, metric.Name)
+				return false
+			}
+		}
+		for _, override := range metric.Overrides {
+			_, err := override.Ranges()
+			if err != nil {
+				logger.Errorf("😥️ Override indices %q for metric %s are not valid: %s", override.Indices, metric.Name, err)
+				return false
+			}
+			for name := range override.Env {
+				if !envNameRegex.MatchString(name) {
+					logger.Errorf("😥️ Override variable %s for metric %s is not a valid name.", name, metric.Name)
+					return false
+				}
+			}
+		}
+		if !metric.Checkpoint.validate(metric.Name) {
+			return false
+		}
+		for name := range metric.Inputs {
+			if !inputNameRegex.MatchString(name) || name == "." || name == ".." {
+				logger.Errorf("😥️ Input %s for metric %s must be a file name (letters, numbers, '-', '_', or '.').", name, metric.Name)
+				return false
+			}
+		}
+	}
+	if m.Spec.Pod.OS != "" && m.Spec.Pod.OS != "linux" && m.Spec.Pod.OS != "windows" {
+		logger.Errorf("😥️ Pod os must be linux or windows, found %s", m.Spec.Pod.OS)
+		return false
+	}
+	if m.IsWindows() && !m.validateWindows() {
+		return false
+	}
+	if !m.Spec.Markers.validate() {
+		return false
+	}
+	if m.Spec.Results.Keep < 0 {
+		logger.Errorf("😥️ Results keep must be 0 (keep all) or greater, found %d", m.Spec.Results.Keep)
+		return false
+	}
+	if m.Spec.Results.Keep > 0 && m.Spec.Results.ClaimName == "" {
+		logger.Error("😥️ Results keep prunes runs on a persistent volume, and needs a claimName.")
+		return false
+	}
+	if m.Spec.Autoscaler.WaitSeconds < 0 {
+		logger.Errorf("😥️ Autoscaler waitSeconds must be 0 (no wait) or greater, found %d", m.Spec.Autoscaler.WaitSeconds)
+		return false
+	}
+	if m.Spec.Network.Subdomain != "" && !subdomainRegex.MatchString(m.Spec.Network.Subdomain) {
+		logger.Errorf("😥️ Network subdomain %s must be lowercase letters, numbers, and '-' (up to 63 characters).", m.Spec.Network.Subdomain)
+		return false
+	}
+	profile := m.Spec.Profile
+	if profile.Enabled() && (len(profile.Configurations) < 2 || profile.Tolerance < 0 || profile.TimeoutSeconds < 0) {
+		logger.Error("😥️ Profile needs two or more configurations, and tolerance and timeoutSeconds of 0 or greater.")
+		return false
+	}
+	scaling := m.Spec.Scaling
+	if scaling.Mode == "" {
+		m.Spec.Scaling.Mode = StrongScaling
+	}
+	if scaling.Mode != "" && scaling.Mode != StrongScaling && scaling.Mode != WeakScaling {
+		logger.Errorf("😥️ Scaling mode must be strong or weak, found %s", scaling.Mode)
+		return false
+	}
+	if scaling.Enabled() && (profile.Enabled() || len(m.Spec.Roles) > 0) {
+		logger.Error("😥️ Scaling cannot be used with profile or sized roles.")
+		return false
+	}
+	seen := map[int32]bool{}
+	for _, pods := range scaling.Pods {
+		if pods < 1 || seen[pods] {
+			logger.Errorf("😥️ Scaling pods must be unique and >= 1, found %v", scaling.Pods)
+			return false
+		}
+		seen[pods] = true
+	}
+	gang := m.Spec.GangScheduling
+	if gang.Enabled() && gang.Scheduler != CoschedulingScheduler && gang.Scheduler != VolcanoScheduler {
+		logger.Errorf("😥️ Gang scheduler must be coscheduling or volcano, found %s", gang.Scheduler)
+		return false
+	}
+	if gang.TimeoutSeconds < 0 {
+		logger.Errorf("😥️ Gang scheduling timeoutSeconds must be 0 (default) or greater, found %d", gang.TimeoutSeconds)
+		return false
+	}
+	if len(validation.IsValidLabelValue(m.Spec.ExperimentID)) > 0 {
+		logger.Errorf("😥️ Experiment id %s must be a valid label value (up to 63 characters).", m.Spec.ExperimentID)
+		return false
+	}
+	for key := range m.Spec.Metadata {
+		if len(validation.IsQualifiedName(key)) > 0 || strings.Contains(key, "/") {
+			logger.Errorf("😥️ Metadata key %s must be a valid label name without a prefix.", key)
+			return false
+		}
+	}
+	if m.Spec.StartupPolicy == "" {
+		m.Spec.StartupPolicy = AnyOrderStartup
+	}
+	if m.Spec.StartupPolicy != AnyOrderStartup && m.Spec.StartupPolicy != InOrderStartup {
+		logger.Errorf("😥️ Startup policy must be AnyOrder or InOrder, found %s", m.Spec.StartupPolicy)
+		return false
+	}
+	if m.StartsInOrder() && gang.Enabled() {
+		logger.Error("😥️ InOrder startup cannot be used with gang scheduling (the gang would wait on the launcher).")
+		return false
+	}
+	if m.Spec.Shards < 0 {
+		logger.Errorf("😥️ Shards must be 0 (one JobSet) or greater, found %d", m.Spec.Shards)
+		return false
+	}
+	if !m.validateBackend() {
+		return false
+	}
+	if m.IsSharded() && !m.validateShards() {
+		return false
+	}
+	if m.Spec.Acceptance.Enabled() && !m.validateAcceptance() {
+		return false
+	}
+	if m.Spec.Canary.Enabled() && !m.validateCanary() {
+		return false
+	}
+	if m.Spec.SecurityProfile == "" {
+		m.Spec.SecurityProfile = PrivilegedProfile
+	}
+	profiles := map[string]bool{PrivilegedProfile: true, BaselineProfile: true, RestrictedProfile: true}
+	if !profiles[m.Spec.SecurityProfile] {
+		logger.Errorf("😥️ Security profile must be privileged, baseline, or restricted, found %s", m.Spec.SecurityProfile)
+		return false
+	}
+	perf := m.Spec.PerfEvents
+	if perf.Enabled() && (perf.Paranoid < -1 || perf.Paranoid > 4) {
+		logger.Errorf("😥️ Perf events paranoid must be between -1 and 4, found %d", perf.Paranoid)
+		return false
+	}
+	if m.Spec.Pod.UserNamespaces && m.IsWindows() {
+		logger.Error("😥️ User namespaces are not supported for Windows.")
+		return false
+	}
+	if perf.Enabled() && m.IsWindows() {
+		logger.Error("😥️ Perf events tuning is not supported for Windows.")
+		return false
+	}
+	if !m.validateRunAs() {
+		return false
+	}
+	if perf.Image == "" {
+		m.Spec.PerfEvents.Image = "busybox:stable"
+	}
+	if m.Spec.Scratch.Enabled() {
+		if m.Spec.Scratch.Size == "" {
+			m.Spec.Scratch.Size = "10Gi"
+		}
+		if m.Spec.Scratch.Path == "" {
+			m.Spec.Scratch.Path = "/scratch"
+		}
+		_, err := resource.ParseQuantity(m.Spec.Scratch.Size)
+		if err != nil {
+			logger.Errorf("😥️ Scratch size %s is not a valid quantity: %s", m.Spec.Scratch.Size, err)
+			return false
+		}
+	}
+	return true
+}
+
+// validateRunAs checks the ids, and that the chown init container (which runs
+// as root) can run
+func (m *MetricSet) validateRunAs() bool {
+	runAs := &m.Spec.Pod.RunAs
+	if runAs.User < 0 || runAs.Group < 0 {
+		logger.Errorf("😥️ The runAs user and group cannot be negative, found %d and %d", runAs.User, runAs.Group)
+		return false
+	}
+	for _, group := range runAs.SupplementalGroups {
+		if group < 0 {
+			logger.Errorf("😥️ The runAs supplemental groups cannot be negative, found %d", group)
+			return false
+		}
+	}
+	if runAs.Enabled() && m.IsWindows() {
+		logger.Error("😥️ RunAs is not supported for Windows (use the user of the image).")
+		return false
+	}
+	if runAs.Chown && runAs.User == 0 && runAs.Group == 0 {
+		logger.Error("😥️ RunAs chown requires a user or group to chown the volumes to.")
+		return false
+	}
+	if runAs.Chown && m.Spec.SecurityProfile == RestrictedProfile {
+		logger.Error("😥️ RunAs chown runs as root, which the restricted security profile does not allow.")
+		return false
+	}
+	if runAs.Image == "" {
+		runAs.Image = "busybox:stable"
+	}
+	return true
+}
+
+// Markers are echoed (in double quotes) by the entrypoints
+var markerRegex = regexp.MustCompile(`^[A-Za-z0-9][-A-Za-z0-9 _.:=#]*$`)
+
+// validate markers that are set (empty markers use the defaults)
+func (m *Markers) validate() bool {
+	set := map[string]bool{}
+	for _, marker := range []string{m.Separator, m.CollectionStart, m.CollectionEnd} {
+		if marker == "" {
+			continue
+		}
+		if !markerRegex.MatchString(marker) {
+			logger.Errorf("😥️ Marker %q must be letters, numbers, spaces, and '-', '_', '.', ':', '=', or '#'.", marker)
+			return false
+		}
+		if set[marker] {
+			logger.Error("😥️ Markers for the separator, collection start, and collection end must be different.")
+			return false
+		}
+		set[marker] = true
+	}
+	if m.Framing != "" && m.Framing != "base64" {
+		logger.Errorf("😥️ Marker framing must be base64 (or empty for none), found %s", m.Framing)
+		return false
+	}
+	return true
+}
+
+// validateWindows checks for features that need a Linux (bash or sh) entrypoint
+func (m *MetricSet) validateWindows() bool {
+	if m.Spec.CommandTimeout > 0 || m.Spec.Autoscaler.Enabled() || m.Spec.Markers.Framing != "" || m.Spec.Markers.Phases || m.Spec.Debug || m.Spec.Snapshot {
+		logger.Error("😥️ commandTimeout, autoscaler, marker framing and phases, debug, and snapshot are not supported on Windows.")
+		return false
+	}
+	for _, metric := range m.Spec.Metrics {
+		if metric.Shell != "" || metric.TimeoutSeconds > 0 || len(metric.Addons) > 0 || len(metric.Overrides) > 0 || metric.Checkpoint.Enabled() {
+			logger.Errorf("😥️ Metric %s cannot set a shell, timeoutSeconds, addons, overrides, or checkpoint on Windows.", metric.Name)
+			return false
+		}
+	}
+	return true
+}
+
+// IsWindows determines if the pods of the set run on Windows nodes
+func (m *MetricSet) IsWindows() bool {
+	return m.Spec.Pod.OS == "windows"
+}
+
+// UsesJobs determines if the pods are run by a Job instead of a JobSet
+func (m *MetricSet) UsesJobs() bool {
+	return m.Spec.Backend == JobBackend
+}
+
+// validateBackend checks that features that need a JobSet are not used with a Job
+func (m *MetricSet) validateBackend() bool {
+	if m.UsesJobs() && (m.IsSharded() || m.Spec.Acceptance.Enabled() || m.Spec.Canary.Enabled() || m.Spec.Profile.Enabled() || m.StartsInOrder() || m.Spec.GangScheduling.Enabled()) {
+		logger.Error("😥️ The Job backend cannot be used with shards, acceptance, canary, profile, InOrder startup, or gang scheduling.")
+		return false
+	}
+	return true
+}
+
+// IsSharded determines if the pods are split across more than one JobSet
+func (m *MetricSet) IsSharded() bool {
+	return m.Spec.Shards > 1
+}
+
+// ShardName is the name of the JobSet (and hostname prefix) of a shard
+func (m *MetricSet) ShardName(index int) string {
+	return fmt.Sprintf("%s-s%d", m.Name, index)
+}
+
+// validateShards checks the pods divide evenly into the shards, and that the
+// features that coordinate one JobSet are not used
+func (m *MetricSet) validateShards() bool {
+	if m.Spec.Pods%m.Spec.Shards != 0 {
+		logger.Errorf("😥️ Pods (%d) must divide evenly into shards (%d).", m.Spec.Pods, m.Spec.Shards)
+		return false
+	}
+	if len(m.Spec.Roles) > 0 || m.Spec.Profile.Enabled() || m.Spec.Scaling.Enabled() || m.Spec.GangScheduling.Enabled() {
+		logger.Error("😥️ Shards cannot be used with roles, profile, scaling, or gang scheduling.")
+		return false
+	}
+	if m.StartsInOrder() || m.Spec.Debug || m.Spec.Network.EnableDNSHostnames {
+		logger.Error("😥️ Shards cannot be used with InOrder startup, debug, or enableDNSHostnames.")
+		return false
+	}
+	if _, queued := m.Labels["kueue.x-k8s.io/queue-name"]; queued {
+		logger.Error("😥️ Shards cannot be queued with Kueue (each JobSet would be admitted on its own).")
+		return false
+	}
+	for _, metric := range m.Spec.Metrics {
+		if metric.Placement != "" {
+			logger.Errorf("😥️ Shards cannot be used with the placement of metric %s.", metric.Name)
+			return false
+		}
+		for _, addon := range metric.Addons {
+			if addon.Name == "tls" {
+				logger.Error("😥️ Shards cannot be used with the tls addon (the certificate is for one subdomain).")
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateAcceptance checks each check is for a metric of the set, with a range
+// or tolerance, and that the run is one that can have a pod on each node
+func (m *MetricSet) validateAcceptance() bool {
+	if m.IsSharded() || len(m.Spec.Roles) > 0 || m.Spec.Profile.Enabled() || m.Spec.Scaling.Enabled() || m.Spec.Autoscaler.Enabled() {
+		logger.Error("😥️ Acceptance cannot be used with shards, roles, profile, scaling, or an autoscaler.")
+		return false
+	}
+	return m.validateChecks("Acceptance", m.Spec.Acceptance.Checks)
+}
+
+// validateCanary checks the interval, nodes, and checks of a canary. Each run is
+// an acceptance run, so the same runs are not supported.
+func (m *MetricSet) validateCanary() bool {
+	canary := &m.Spec.Canary
+	if m.Spec.Acceptance.Enabled() || m.IsSharded() || len(m.Spec.Roles) > 0 || m.Spec.Profile.Enabled() || m.Spec.Scaling.Enabled() || m.Spec.Autoscaler.Enabled() {
+		logger.Error("😥️ Canary cannot be used with acceptance, shards, roles, profile, scaling, or an autoscaler.")
+		return false
+	}
+	if canary.Nodes == 0 {
+		canary.Nodes = 1
+	}
+	if canary.History == 0 {
+		canary.History = 50
+	}
+	if canary.IntervalSeconds < 60 || canary.Nodes < 1 || canary.History < 1 {
+		logger.Error("😥️ Canary intervalSeconds must be 60 or more, and nodes and history 1 or more.")
+		return false
+	}
+	if len(canary.Checks) == 0 {
+		logger.Error("😥️ Canary needs one or more checks.")
 		return false
 	}
+	return m.validateChecks("Canary", canary.Checks)
+}
+
+// validateChecks checks each check is for a value of a metric of the set, with
+// a range or tolerance
+func (m *MetricSet) validateChecks(kind string, checks []AcceptanceCheck) bool {
+	metrics := map[string]bool{}
+	for _, metric := range m.Spec.Metrics {
+		metrics[metric.Key()] = true
+	}
+	for _, check := range checks {
+		if !metrics[check.Metric] || check.Value == "" {
+			logger.Errorf("😥️ %s check %s is not a value of a metric of the set.", kind, check.Key())
+			return false
+		}
+		if check.Min == "" && check.Max == "" && check.MedianTolerance == 0 {
+			logger.Errorf("😥️ %s check %s needs a min, max, or medianTolerance.", kind, check.Key())
+			return false
+		}
+		for _, bound := range []string{check.Min, check.Max} {
+			if _, err := strconv.ParseFloat(bound, 64); bound != "" && err != nil {
+				logger.Errorf("😥️ %s check %s bound %q is not a number.", kind, check.Key(), bound)
+				return false
+			}
+		}
+		if check.MedianTolerance < 0 || check.MedianTolerance > 100 {
+			logger.Errorf("😥️ %s check %s medianTolerance must be a percent, found %d.", kind, check.Key(), check.MedianTolerance)
+			return false
+		}
+	}
 	return true
 }
 
+// StartsInOrder determines if the launcher waits for the other replicated jobs to be ready
+func (m *MetricSet) StartsInOrder() bool {
+	return m.Spec.StartupPolicy == InOrderStartup
+}
+
+// IsPrivilegedProfile determines if the pods can use privileged features (e.g., host paths)
+func (m *MetricSet) IsPrivilegedProfile() bool {
+	return m.Spec.SecurityProfile == "" || m.Spec.SecurityProfile == PrivilegedProfile
+}
+
+// Input names are used as both config map keys and file names
+var inputNameRegex = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// Secrets are exposed as environment variables
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Checkpoint paths and patterns are written into the entrypoint unquoted
+var (
+	checkpointPathRegex    = regexp.MustCompile(`^[-_./a-zA-Z0-9]+$`)
+	checkpointPatternRegex = regexp.MustCompile(`^[-_.*?a-zA-Z0-9]+$`)
+)
+
+// Aliases are used for replicated job names (and hostnames), so they are short DNS labels
+var aliasRegex = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,18}[a-z0-9])?$`)
+
+// The subdomain is a DNS label
+var subdomainRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// Key is the alias of the metric if set, otherwise the name
+func (m *Metric) Key() string {
+	if m.Alias != "" {
+		return m.Alias
+	}
+	return m.Name
+}
+
+// Subdomain is the subdomain of the pods, and the name of the headless service
+func (m *MetricSet) Subdomain() string {
+	if m.Spec.Network.Subdomain != "" {
+		return m.Spec.Network.Subdomain
+	}
+	return m.Spec.ServiceName
+}
+
+// PodGroupName is the name of the PodGroup for gang scheduling the pods
+func (m *MetricSet) PodGroupName() string {
+	return m.Name
+}
+
+// DisruptionBudgetName is the name of the pod disruption budget for the pods
+func (m *MetricSet) DisruptionBudgetName() string {
+	return fmt.Sprintf("%s-pdb", m.Name)
+}
+
+// PerfTuningName is the name of the DaemonSet that tunes perf_event_paranoid
+func (m *MetricSet) PerfTuningName() string {
+	return fmt.Sprintf("%s-perf-tuning", m.Name)
+}
+
+// PerfTuningNamespace is the namespace of the DaemonSet that tunes perf_event_paranoid
+func (m *MetricSet) PerfTuningNamespace() string {
+	if m.Spec.PerfEvents.Namespace != "" {
+		return m.Spec.PerfEvents.Namespace
+	}
+	return m.Namespace
+}
+
+// RenderedName is the name of the config map with the rendered JobSet
+func (m *MetricSet) RenderedName() string {
+	return fmt.Sprintf("%s-rendered", m.Name)
+}
+
+// ScratchClaimName is the name of the persistent volume claim for scratch
+func (m *MetricSet) ScratchClaimName() string {
+	return fmt.Sprintf("%s-scratch", m.Name)
+}
+
+// TLSSecretName is the name of the secret with the certificate for the pods
+func (m *MetricSet) TLSSecretName() string {
+	return fmt.Sprintf("%s-tls", m.Name)
+}
+
 //+kubebuilder:object:root=true
 
 // MetricSetList contains a list of MetricSet
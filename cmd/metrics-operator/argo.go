@@ -0,0 +1,38 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package main
+
+import (
+	"flag"
+
+	"github.com/converged-computing/metrics-operator/pkg/workflows"
+)
+
+// runArgo renders the MetricSets of a pipeline as an Argo Workflow
+func runArgo(args []string) error {
+	flags := flag.NewFlagSet("argo", flag.ExitOnError)
+	filename := flags.String("f", "-", "file with the MetricSets of the pipeline (- for stdin)")
+	output := flags.String("o", "-", "file to write the Workflow to (- for stdout)")
+	name := flags.String("name", "", "name of the pipeline (defaults to the first MetricSet)")
+	options := workflows.ArgoOptions{}
+	flags.StringVar(&options.ServiceAccountName, "service-account", "", "service account of the workflow pods")
+	flags.StringVar(&options.KubectlImage, "kubectl-image", workflows.DefaultKubectlImage, "image with kubectl to wait for runs")
+	poll := flags.Int("poll", workflows.DefaultPollSeconds, "seconds between checks of a running workload")
+	flags.Parse(args)
+	options.PollSeconds = int32(*poll)
+
+	pipeline, err := loadPipeline(*name, *filename)
+	if err != nil {
+		return err
+	}
+	workflow, err := workflows.NewArgoWorkflow(pipeline, options)
+	if err != nil {
+		return err
+	}
+	return writeYAML(workflow, *output)
+}
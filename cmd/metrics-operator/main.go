@@ -0,0 +1,100 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+// The metrics-operator command runs MetricSets with the operator (e.g., in CI),
+// or renders them for other orchestrators, e.g.,
+//
+//	metrics-operator run -f metrics.yaml --wait --output junit.xml
+//	metrics-operator argo -f pipeline.yaml > workflow.yaml
+//	metrics-operator tekton -f pipeline.yaml > pipeline-tekton.yaml
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/converged-computing/metrics-operator/pkg/workflows"
+
+	// Metrics are registered here! Importing registers once
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/app"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/db"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/io"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/network"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/perf"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/sys"
+)
+
+// A subcommand, run with the arguments after its name
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"argo":   {"Render MetricSets as an Argo Workflow", runArgo},
+	"tekton": {"Render MetricSets as Tekton Tasks and a Pipeline", runTekton},
+	"run":    {"Run MetricSets with the operator, and wait for and report the results", runRun},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: metrics-operator <command> [flags]\n\nCommands:\n")
+	for _, name := range []string{"run", "argo", "tekton"} {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].description)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	err := command.run(os.Args[2:])
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadPipeline reads the MetricSets of a pipeline from a file (or stdin, for -)
+func loadPipeline(name, filename string) (*workflows.Pipeline, error) {
+	var reader io.Reader = os.Stdin
+	if filename != "-" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+	return workflows.LoadPipeline(name, reader)
+}
+
+// writeYAML writes an object as YAML to a file (or stdout, for -)
+func writeYAML(object interface{}, filename string) error {
+	out, err := yaml.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return writeOutput(out, filename)
+}
+
+// writeOutput writes content to a file (or stdout, for -)
+func writeOutput(content []byte, filename string) error {
+	if filename == "-" {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	return os.WriteFile(filename, content, 0644)
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/workflows"
+)
+
+// runOptions are the flags of the run command
+type runOptions struct {
+	filename      string
+	namespace     string
+	wait          bool
+	replace       bool
+	timeout       time.Duration
+	poll          time.Duration
+	output        string
+	summary       string
+	results       string
+	baseline      string
+	tolerance     float64
+	lowerIsBetter string
+}
+
+// runRun creates MetricSets with the operator and (with --wait) waits for them,
+// reports the results, and fails if a run failed or regressed
+func runRun(args []string) error {
+	options := runOptions{}
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	flags.StringVar(&options.filename, "f", "-", "file with the MetricSets to run (- for stdin)")
+	flags.StringVar(&options.namespace, "n", "default", "namespace of MetricSets without one")
+	flags.BoolVar(&options.wait, "wait", false, "wait for the runs to finish, and report the results")
+	flags.BoolVar(&options.replace, "replace", false, "delete MetricSets of the same name first")
+	flags.DurationVar(&options.timeout, "timeout", time.Hour, "time to wait for the runs")
+	flags.DurationVar(&options.poll, "poll", 10*time.Second, "time between checks of the runs")
+	flags.StringVar(&options.output, "output", "", "file to write a JUnit XML report to")
+	flags.StringVar(&options.summary, "summary", "", "file to append a Markdown summary to (e.g., $GITHUB_STEP_SUMMARY)")
+	flags.StringVar(&options.results, "results", "", "directory to save the values and pod logs of each run to (under <name>)")
+	flags.StringVar(&options.baseline, "baseline", "", "directory with the values of a baseline run of each MetricSet (under <name>)")
+	flags.Float64Var(&options.tolerance, "tolerance", workflows.DefaultTolerance, "percent a value can be worse than its baseline")
+	flags.StringVar(&options.lowerIsBetter, "lower-is-better", "", "values where lower is better (comma separated), in addition to seconds")
+	flags.Parse(args)
+
+	var reader io.Reader = os.Stdin
+	if options.filename != "-" {
+		file, err := os.Open(options.filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+	sets, err := workflows.LoadMetricSets(reader)
+	if err != nil {
+		return err
+	}
+	if len(sets) == 0 {
+		return fmt.Errorf("there are no MetricSets to run")
+	}
+
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return err
+	}
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, api.AddToScheme, jobset.AddToScheme} {
+		err = add(scheme)
+		if err != nil {
+			return err
+		}
+	}
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.timeout)
+	defer cancel()
+	for _, set := range sets {
+		if set.Namespace == "" {
+			set.Namespace = options.namespace
+		}
+		err = createMetricSet(ctx, c, set, options)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created MetricSet %s/%s\n", set.Namespace, set.Name)
+	}
+	if !options.wait {
+		return nil
+	}
+
+	// A run that does not finish in time is a failure in the report
+	results := []*workflows.RunResult{}
+	for _, set := range sets {
+		key := types.NamespacedName{Name: set.Name, Namespace: set.Namespace}
+		result, err := workflows.WaitForMetricSet(ctx, c, key, options.poll)
+		if err != nil {
+			result = &workflows.RunResult{Name: set.Name, Namespace: set.Namespace, Failed: true, Message: err.Error()}
+		}
+		err = compareBaseline(result, options)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+	if options.results != "" {
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			err = saveResults(context.Background(), clientset, result, options.results)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return report(results, options)
+}
+
+// createMetricSet creates a MetricSet, deleting one of the same name first (and
+// waiting for it to be gone) with --replace
+func createMetricSet(ctx context.Context, c client.Client, set *api.MetricSet, options runOptions) error {
+	if options.replace {
+		existing := &api.MetricSet{}
+		key := types.NamespacedName{Name: set.Name, Namespace: set.Namespace}
+		err := c.Get(ctx, key, existing)
+		if err == nil {
+			err = c.Delete(ctx, existing, client.PropagationPolicy("Foreground"))
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			for err == nil {
+				time.Sleep(options.poll)
+				err = c.Get(ctx, key, existing)
+			}
+		}
+		if !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return c.Create(ctx, set)
+}
+
+// compareBaseline compares the values of a run to the values in the baseline
+// directory, if it has them
+func compareBaseline(result *workflows.RunResult, options runOptions) error {
+	if options.baseline == "" || result.Failed {
+		return nil
+	}
+	file, err := os.Open(filepath.Join(options.baseline, result.Name, "values"))
+	if os.IsNotExist(err) {
+		fmt.Printf("There is no baseline for %s, skipping the comparison\n", result.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	baseline, err := workflows.ParseValues(file)
+	if err != nil {
+		return err
+	}
+	lower := []string{}
+	if options.lowerIsBetter != "" {
+		lower = strings.Split(options.lowerIsBetter, ",")
+	}
+	result.Comparisons = workflows.CompareValues(baseline, result.Values, options.tolerance, lower)
+	return nil
+}
+
+// saveResults writes the values of a run, and the logs of its pods, under a
+// directory for the run, as the Tekton Tasks do
+func saveResults(ctx context.Context, clientset kubernetes.Interface, result *workflows.RunResult, directory string) error {
+	directory = filepath.Join(directory, result.Name)
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return err
+	}
+	var values bytes.Buffer
+	err = result.Values.Write(&values)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(directory, "values"), values.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+	for _, pod := range result.Pods {
+		for _, container := range pod.Spec.Containers {
+			logs, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(
+				pod.Name,
+				&corev1.PodLogOptions{Container: container.Name},
+			).DoRaw(ctx)
+			if err != nil {
+				fmt.Printf("Could not get the logs of %s/%s: %s\n", pod.Name, container.Name, err)
+				continue
+			}
+			name := pod.Name + ".log"
+			if len(pod.Spec.Containers) > 1 {
+				name = fmt.Sprintf("%s-%s.log", pod.Name, container.Name)
+			}
+			err = os.WriteFile(filepath.Join(directory, name), logs, 0644)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// report prints the results, writes the JUnit report and summary, and returns
+// an error if a run failed or regressed
+func report(results []*workflows.RunResult, options runOptions) error {
+	name := "metrics-operator"
+	failed := 0
+	for _, result := range results {
+		if result.Passed() {
+			fmt.Printf("✅ %s passed (%.1f seconds)\n", result.Name, result.Seconds)
+			continue
+		}
+		failed++
+		if result.Failed {
+			fmt.Printf("❌ %s failed: %s\n", result.Name, result.Message)
+			continue
+		}
+		for _, regression := range result.Regressions() {
+			fmt.Printf("❌ %s regressed: %s is %g, %+.1f%% from the baseline %g\n", result.Name, regression.Name, regression.Value, regression.Change, regression.Baseline)
+		}
+	}
+
+	if options.output != "" {
+		var out bytes.Buffer
+		err := workflows.WriteJUnit(&out, name, results)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(options.output, out.Bytes(), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	if options.summary != "" {
+		file, err := os.OpenFile(options.summary, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		err = workflows.WriteSummary(file, name, results)
+		if err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d runs failed or regressed", failed, len(results))
+	}
+	return nil
+}
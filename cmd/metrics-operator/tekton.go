@@ -0,0 +1,54 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/converged-computing/metrics-operator/pkg/workflows"
+)
+
+// runTekton renders the MetricSets of a pipeline as Tekton Tasks and a Pipeline
+func runTekton(args []string) error {
+	flags := flag.NewFlagSet("tekton", flag.ExitOnError)
+	filename := flags.String("f", "-", "file with the MetricSets of the pipeline (- for stdin)")
+	output := flags.String("o", "-", "file to write the Tasks and Pipeline to (- for stdout)")
+	name := flags.String("name", "", "name of the pipeline (defaults to the first MetricSet)")
+	options := workflows.TektonOptions{}
+	flags.StringVar(&options.KubectlImage, "kubectl-image", workflows.DefaultKubectlImage, "image with kubectl (and awk and GNU date) to run the steps")
+	poll := flags.Int("poll", workflows.DefaultPollSeconds, "seconds between checks of a running workload")
+	tolerance := flags.Int("tolerance", workflows.DefaultTolerance, "percent a value can be worse than its baseline")
+	lower := flags.String("lower-is-better", "", "values where lower is better (comma separated), in addition to seconds")
+	flags.Parse(args)
+	options.PollSeconds = int32(*poll)
+	options.Tolerance = int32(*tolerance)
+	if *lower != "" {
+		options.LowerIsBetter = strings.Split(*lower, ",")
+	}
+
+	pipeline, err := loadPipeline(*name, *filename)
+	if err != nil {
+		return err
+	}
+	objects, err := workflows.NewTektonPipeline(pipeline, options)
+	if err != nil {
+		return err
+	}
+	documents := []string{}
+	for _, object := range objects {
+		out, err := yaml.Marshal(object)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, string(out))
+	}
+	return writeOutput([]byte(strings.Join(documents, "---\n")), *output)
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// How often to check again for a pool without ready nodes
+var acceptanceRequeue = 30 * time.Second
+
+// ensureAcceptancePool finds the nodes of the pool (matching the node selector,
+// ready, and schedulable) when the run is created, and sizes the run to one pod
+// on each. The pool is kept in the status, so it does not change during the run.
+func (r *MetricSetReconciler) ensureAcceptancePool(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if set.Status.Acceptance == nil {
+		nodes := &corev1.NodeList{}
+		err := r.List(ctx, nodes, client.MatchingLabels(set.Spec.Pod.NodeSelector))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		pool := getAcceptancePool(nodes.Items, set.Spec.Acceptance.Nodes)
+		if len(pool) == 0 {
+			logger.Info("🟧️ No ready nodes in the acceptance pool, checking again", "NodeSelector", set.Spec.Pod.NodeSelector)
+			return ctrl.Result{RequeueAfter: acceptanceRequeue}, nil
+		}
+		set.Status.Acceptance = &api.AcceptanceStatus{Pool: pool}
+		logger.Info("✅️ Acceptance pool", "Name", set.Name, "Nodes", len(pool))
+		err = r.Status().Update(ctx, set)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	set.Spec.Pods = int32(len(set.Status.Acceptance.Pool))
+	return ctrl.Result{}, nil
+}
+
+// getAcceptancePool returns the names of the nodes that are ready and schedulable,
+// and in the list of names if there is one
+func getAcceptancePool(nodes []corev1.Node, names []string) []string {
+	pool := []string{}
+	for _, node := range nodes {
+		if node.Spec.Unschedulable || (len(names) > 0 && !containsString(names, node.Name)) {
+			continue
+		}
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == corev1.NodeReady && condition.Status == corev1.ConditionTrue {
+				pool = append(pool, node.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(pool)
+	return pool
+}
+
+// updateAcceptanceStatus checks the values each node reported when the run is
+// finished, and labels the nodes with their result if requested
+func (r *MetricSetReconciler) updateAcceptanceStatus(
+	ctx context.Context,
+	set *api.MetricSet,
+	js *jobset.JobSet,
+	cs []*specs.ContainerSpec,
+) error {
+	logger := log.FromContext(ctx)
+
+	if !set.Spec.Acceptance.Enabled() || set.Status.Acceptance == nil || len(set.Status.Acceptance.Nodes) > 0 || !isFinished(js) {
+		return nil
+	}
+
+	// Containers (by replicated job and name) and their metric
+	metrics := map[string]string{}
+	for _, c := range cs {
+		if c.Metric != "" {
+			metrics[fmt.Sprintf("%s/%s", c.JobName, c.Name)] = c.Metric
+		}
+	}
+	pods := &corev1.PodList{}
+	err := r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{"metricset-name": set.Name},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Values reported by each node, by <metric>/<value>
+	values := map[string]map[string]string{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		job := pod.Labels[jobset.ReplicatedJobNameKey]
+		for _, status := range pod.Status.ContainerStatuses {
+			metric, ok := metrics[fmt.Sprintf("%s/%s", job, status.Name)]
+			if !ok || status.State.Terminated == nil {
+				continue
+			}
+			if values[pod.Spec.NodeName] == nil {
+				values[pod.Spec.NodeName] = map[string]string{}
+			}
+			for name, value := range getReportedValues(status.State.Terminated.Message) {
+				values[pod.Spec.NodeName][metric+"/"+name] = value
+			}
+		}
+	}
+
+	checks := set.Spec.Acceptance.Checks
+	pool := set.Status.Acceptance.Pool
+	report := evaluateAcceptance(checks, pool, values, getAcceptanceMedians(checks, pool, values))
+	if set.Spec.Acceptance.LabelNodes {
+		for _, node := range report {
+			err = r.labelAcceptance(ctx, node.Name, node.Result)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	set.Status.Acceptance.Nodes = report
+	set.Status.Acceptance.Passed = 0
+	set.Status.Acceptance.Failed = 0
+	for _, node := range report {
+		if node.Result == api.AcceptancePassed {
+			set.Status.Acceptance.Passed++
+		} else {
+			set.Status.Acceptance.Failed++
+		}
+	}
+	logger.Info("📋️ Acceptance report", "Name", set.Name, "Passed", set.Status.Acceptance.Passed, "Failed", set.Status.Acceptance.Failed)
+	return r.Status().Update(ctx, set)
+}
+
+// labelAcceptance labels a node with its result. A node that is gone is skipped.
+func (r *MetricSetReconciler) labelAcceptance(ctx context.Context, name, result string) error {
+	node := &corev1.Node{}
+	err := r.Get(ctx, types.NamespacedName{Name: name}, node)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	patch := client.MergeFrom(node.DeepCopy())
+	if node.Labels == nil {
+		node.Labels = map[string]string{}
+	}
+	node.Labels[api.AcceptanceLabel] = result
+	return r.Patch(ctx, node, patch)
+}
+
+// getReportedValues parses the name=value lines a container reported (with
+// mo_report) in its termination message. Other lines (e.g., a state) are skipped.
+func getReportedValues(message string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(message, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && name != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// getAcceptanceMedians returns the median of each value of the checks, over the
+// nodes that reported it
+func getAcceptanceMedians(
+	checks []api.AcceptanceCheck,
+	nodes []string,
+	values map[string]map[string]string,
+) map[string]float64 {
+	medians := map[string]float64{}
+	for _, check := range checks {
+		found := []float64{}
+		for _, node := range nodes {
+			value, err := strconv.ParseFloat(values[node][check.Key()], 64)
+			if err == nil {
+				found = append(found, value)
+			}
+		}
+		if len(found) > 0 {
+			medians[check.Key()] = getMedian(found)
+		}
+	}
+	return medians
+}
+
+// evaluateAcceptance checks the values of each node of the pool against the
+// bounds of each check, and the median tolerance of each (e.g., from the pool).
+// A node that did not report a value (e.g., it failed or was not scheduled) fails.
+func evaluateAcceptance(
+	checks []api.AcceptanceCheck,
+	pool []string,
+	values map[string]map[string]string,
+	medians map[string]float64,
+) []api.NodeAcceptance {
+
+	report := []api.NodeAcceptance{}
+	for _, node := range pool {
+		result := api.NodeAcceptance{Name: node, Result: api.AcceptancePassed}
+		if len(values[node]) > 0 {
+			result.Values = values[node]
+		}
+		for _, check := range checks {
+			key := check.Key()
+			value, err := strconv.ParseFloat(values[node][key], 64)
+			if err != nil {
+				result.Failures = append(result.Failures, fmt.Sprintf("%s was not reported", key))
+				continue
+			}
+			minimum, err := strconv.ParseFloat(check.Min, 64)
+			if err == nil && value < minimum {
+				result.Failures = append(result.Failures, fmt.Sprintf("%s %g is below the minimum %s", key, value, check.Min))
+			}
+			maximum, err := strconv.ParseFloat(check.Max, 64)
+			if err == nil && value > maximum {
+				result.Failures = append(result.Failures, fmt.Sprintf("%s %g is above the maximum %s", key, value, check.Max))
+			}
+			median, ok := medians[key]
+			if check.MedianTolerance > 0 && ok {
+				tolerance := float64(check.MedianTolerance) / 100
+				if check.LowerIsBetter && value > median*(1+tolerance) {
+					result.Failures = append(result.Failures, fmt.Sprintf("%s %g is more than %d%% above the pool median %g", key, value, check.MedianTolerance, median))
+				}
+				if !check.LowerIsBetter && value < median*(1-tolerance) {
+					result.Failures = append(result.Failures, fmt.Sprintf("%s %g is more than %d%% below the pool median %g", key, value, check.MedianTolerance, median))
+				}
+			}
+		}
+		if len(result.Failures) > 0 {
+			result.Result = api.AcceptanceFailed
+		}
+		report = append(report, result)
+	}
+	return report
+}
+
+// getMedian returns the median of (a copy of) some values
+func getMedian(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+func TestEvaluateAcceptance(t *testing.T) {
+	pool := []string{"a", "b", "c", "d"}
+	values := map[string]map[string]string{
+		"a": {"perf-throttle/sustainedRatio": "0.95", "io-fsync/fsyncP99Ms": "4"},
+		"b": {"perf-throttle/sustainedRatio": "0.93", "io-fsync/fsyncP99Ms": "5"},
+		"c": {"perf-throttle/sustainedRatio": "0.70", "io-fsync/fsyncP99Ms": "12"},
+	}
+	tests := []struct {
+		name   string
+		checks []api.AcceptanceCheck
+		failed []string
+	}{
+		{
+			name:   "minimum",
+			checks: []api.AcceptanceCheck{{Metric: "perf-throttle", Value: "sustainedRatio", Min: "0.9"}},
+			failed: []string{"c", "d"},
+		},
+		{
+			name:   "maximum",
+			checks: []api.AcceptanceCheck{{Metric: "io-fsync", Value: "fsyncP99Ms", Max: "10"}},
+			failed: []string{"c", "d"},
+		},
+		{
+			name:   "higher is better median",
+			checks: []api.AcceptanceCheck{{Metric: "perf-throttle", Value: "sustainedRatio", MedianTolerance: 10}},
+			failed: []string{"c", "d"},
+		},
+		{
+			name:   "lower is better median",
+			checks: []api.AcceptanceCheck{{Metric: "io-fsync", Value: "fsyncP99Ms", MedianTolerance: 50, LowerIsBetter: true}},
+			failed: []string{"c", "d"},
+		},
+		{
+			name:   "loose median",
+			checks: []api.AcceptanceCheck{{Metric: "perf-throttle", Value: "sustainedRatio", MedianTolerance: 30}},
+			failed: []string{"d"},
+		},
+		{
+			name:   "not reported",
+			checks: []api.AcceptanceCheck{{Metric: "io-fsync", Value: "throughput", Min: "1"}},
+			failed: []string{"a", "b", "c", "d"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := evaluateAcceptance(test.checks, pool, values, getAcceptanceMedians(test.checks, pool, values))
+			if len(report) != len(pool) {
+				t.Fatalf("expected a result for each of %d nodes, found %d", len(pool), len(report))
+			}
+			failed := []string{}
+			for _, node := range report {
+				if node.Result == api.AcceptanceFailed {
+					failed = append(failed, node.Name)
+					if len(node.Failures) == 0 {
+						t.Errorf("node %s failed without a reason", node.Name)
+					}
+				}
+			}
+			if !reflect.DeepEqual(failed, test.failed) {
+				t.Errorf("expected failed nodes %v, found %v", test.failed, failed)
+			}
+		})
+	}
+}
+
+func TestGetReportedValues(t *testing.T) {
+	values := getReportedValues("Hung\nsustainedRatio=0.93\nthrottleEvents=0\n")
+	expected := map[string]string{"sustainedRatio": "0.93", "throttleEvents": "0"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, found %v", expected, values)
+	}
+}
+
+func TestGetAcceptancePool(t *testing.T) {
+	node := func(name string, ready corev1.ConditionStatus, unschedulable bool) corev1.Node {
+		return corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.NodeSpec{Unschedulable: unschedulable},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: ready},
+			}},
+		}
+	}
+	nodes := []corev1.Node{
+		node("c", corev1.ConditionTrue, false),
+		node("a", corev1.ConditionTrue, false),
+		node("b", corev1.ConditionFalse, false),
+		node("d", corev1.ConditionTrue, true),
+	}
+	pool := getAcceptancePool(nodes, nil)
+	if !reflect.DeepEqual(pool, []string{"a", "c"}) {
+		t.Errorf("expected the ready, schedulable nodes [a c], found %v", pool)
+	}
+	pool = getAcceptancePool(nodes, []string{"c", "d"})
+	if !reflect.DeepEqual(pool, []string{"c"}) {
+		t.Errorf("expected the ready, schedulable node of the names [c], found %v", pool)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// How often to check again if a JobSet owned by a previous MetricSet is gone
+var adoptionRequeue = 15 * time.Second
+
+// Annotation on the JobSet with the hash of the rendered JobSet and entrypoints,
+// so the status can be rebuilt from the cluster
+var renderedHashAnnotation = "metrics-operator/rendered-hash"
+
+// Adoption of an existing JobSet by a MetricSet
+const (
+	adoptionOwned    = "Owned"
+	adoptionOrphaned = "Orphaned"
+	adoptionConflict = "Conflict"
+)
+
+// findJobSet looks for a JobSet labeled for the MetricSet, e.g., when it was
+// created by another version of the operator
+func (r *MetricSetReconciler) findJobSet(
+	ctx context.Context,
+	set *api.MetricSet,
+) (*jobset.JobSet, error) {
+	jobsets := &jobset.JobSetList{}
+	err := r.List(
+		ctx,
+		jobsets,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{mctrl.MetricSetLabel: set.Name},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobsets.Items {
+		if getAdoption(set, &jobsets.Items[i]) != adoptionConflict {
+			return &jobsets.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no JobSet is labeled for MetricSet %s", set.Name)
+}
+
+// getAdoption determines if the JobSet is owned by the MetricSet, has no controller
+// (orphaned), or is controlled by something else (e.g., a deleted MetricSet of the same name)
+func getAdoption(set *api.MetricSet, js *jobset.JobSet) string {
+	owner := metav1.GetControllerOf(js)
+	if owner == nil {
+		return adoptionOrphaned
+	}
+	if owner.UID == set.UID {
+		return adoptionOwned
+	}
+	return adoptionConflict
+}
+
+// adoptJobSet verifies the owner of an existing JobSet, adopts it if it is orphaned,
+// and rebuilds the status we cannot derive from pods
+func (r *MetricSetReconciler) adoptJobSet(
+	ctx context.Context,
+	set *api.MetricSet,
+	js *jobset.JobSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	switch getAdoption(set, js) {
+	case adoptionConflict:
+		logger.Info(
+			"🟧️ JobSet is controlled by another owner, waiting for it to be deleted",
+			"Name", js.Name,
+			"Owner", metav1.GetControllerOf(js).UID,
+		)
+		return ctrl.Result{RequeueAfter: adoptionRequeue}, nil
+
+	case adoptionOrphaned:
+		logger.Info("🧲️ Adopting orphaned JobSet", "Name", js.Name)
+		err := ctrl.SetControllerReference(set, js, r.Scheme)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.Update(ctx, js)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if rebuildStatus(set, js) {
+		logger.Info("🧲️ Rebuilt MetricSet status from JobSet", "Name", js.Name)
+		return ctrl.Result{}, r.Status().Update(ctx, set)
+	}
+	return ctrl.Result{}, nil
+}
+
+// rebuildStatus restores status from the JobSet (e.g., if the MetricSet was
+// restored from a backup) and returns true if anything changed
+func rebuildStatus(set *api.MetricSet, js *jobset.JobSet) bool {
+	hash, ok := js.Annotations[renderedHashAnnotation]
+	if !ok || set.Status.Rendered != nil {
+		return false
+	}
+	set.Status.Rendered = &api.RenderedStatus{Hash: hash}
+	if set.Spec.RecordRendered {
+		set.Status.Rendered.ConfigMap = set.RenderedName()
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestGetAdoption(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "ms", UID: types.UID("current")}}
+	controller := true
+	withOwner := func(uid string) *jobset.JobSet {
+		js := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{Name: "ms"}}
+		if uid != "" {
+			js.OwnerReferences = []metav1.OwnerReference{{Kind: "MetricSet", Name: "ms", UID: types.UID(uid), Controller: &controller}}
+		}
+		return js
+	}
+	tests := []struct {
+		name     string
+		owner    string
+		expected string
+	}{
+		{name: "owned", owner: "current", expected: adoptionOwned},
+		{name: "orphaned", expected: adoptionOrphaned},
+		{name: "previous metricset", owner: "previous", expected: adoptionConflict},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adoption := getAdoption(set, withOwner(test.owner))
+			if adoption != test.expected {
+				t.Errorf("expected %s, found %s", test.expected, adoption)
+			}
+		})
+	}
+}
+
+func TestRebuildStatus(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "ms"}}
+	set.Spec.RecordRendered = true
+	js := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{renderedHashAnnotation: "abc"}}}
+	if !rebuildStatus(set, js) {
+		t.Fatal("expected the rendered status to be rebuilt")
+	}
+	if set.Status.Rendered.Hash != "abc" || set.Status.Rendered.ConfigMap != "ms-rendered" {
+		t.Errorf("unexpected rendered status %v", set.Status.Rendered)
+	}
+
+	// Existing status is not changed
+	js.Annotations[renderedHashAnnotation] = "def"
+	if rebuildStatus(set, js) || set.Status.Rendered.Hash != "abc" {
+		t.Errorf("expected the existing status to be kept, found %v", set.Status.Rendered)
+	}
+}
@@ -0,0 +1,368 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/config"
+	"github.com/go-logr/logr"
+)
+
+// How often to check again on the MetricSets of a campaign
+var campaignRequeue = 30 * time.Second
+
+// MetricCampaignReconciler runs the MetricSets of a campaign
+type MetricCampaignReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Log    logr.Logger
+
+	// Discovery for whether the JobSet API is installed (nil assumes it is)
+	Discovery discovery.DiscoveryInterface
+
+	// Events (e.g., an invalid campaign) are not recorded if nil
+	Recorder record.EventRecorder
+
+	// The JobSet API is not installed, so MetricSets without a backend use a Job
+	jobSetMissing bool
+}
+
+//+kubebuilder:rbac:groups=flux-framework.org,resources=metriccampaigns,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=flux-framework.org,resources=metriccampaigns/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=flux-framework.org,resources=metriccampaigns/finalizers,verbs=update
+
+// Reconcile starts the MetricSets of a campaign (up to its concurrency at once)
+// and records the state and results of each in the campaign status
+func (r *MetricCampaignReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !config.WatchesNamespace(req.Namespace) {
+		logger.V(1).Info("🟧️ Namespace is not watched by the operator configuration, ignoring.")
+		return ctrl.Result{}, nil
+	}
+	campaign := &api.MetricCampaign{}
+	err := r.Get(ctx, req.NamespacedName, campaign)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.V(1).Info("🟥️ MetricCampaign not found. Ignoring since object must be deleted.")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	members, err := campaign.Members()
+	if err != nil {
+		logger.Error(err, "🟥️ Your MetricCampaign config did not validate.")
+		validationRejections.WithLabelValues("campaign").Inc()
+		if r.Recorder != nil {
+			r.Recorder.Event(campaign, corev1.EventTypeWarning, "InvalidCampaign", err.Error())
+		}
+		if campaign.Status.State == api.CampaignInvalid && campaign.Status.Message == err.Error() {
+			return ctrl.Result{}, nil
+		}
+		campaign.Status = api.MetricCampaignStatus{State: api.CampaignInvalid, Message: err.Error()}
+		return ctrl.Result{}, r.Status().Update(ctx, campaign)
+	}
+
+	// The state of each MetricSet, and then the ones to start
+	statuses := []api.CampaignMetricSet{}
+	sets := []*api.MetricSet{}
+	for _, member := range members {
+		set := &api.MetricSet{}
+		err := r.Get(ctx, types.NamespacedName{Name: member.Name, Namespace: campaign.Namespace}, set)
+		if err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		if errors.IsNotFound(err) {
+			status := api.CampaignMetricSet{Name: member.Name, Parameters: member.Parameters, State: api.CampaignPending}
+			if member.Set == nil {
+				status.Message = "the MetricSet does not exist"
+			}
+			statuses = append(statuses, status)
+			sets = append(sets, nil)
+			continue
+		}
+		run, err := r.getCampaignRun(ctx, set)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		status := getCampaignSetStatus(set, run)
+		status.Parameters = member.Parameters
+		statuses = append(statuses, status)
+		sets = append(sets, set)
+	}
+
+	for _, i := range getCampaignStarts(statuses, sets, members, campaign.Spec.Concurrency) {
+		err = r.startCampaignSet(ctx, campaign, members[i], sets[i])
+		if err != nil {
+			logger.Error(err, "🟥️ Failed to start MetricSet of campaign", "Name", members[i].Name)
+			return ctrl.Result{}, err
+		}
+		statuses[i].State = api.CampaignActive
+		statuses[i].Message = ""
+	}
+
+	status := getCampaignStatus(statuses)
+	result := ctrl.Result{}
+	if status.State == api.CampaignActive {
+		result.RequeueAfter = campaignRequeue
+	}
+	if equality.Semantic.DeepEqual(status, campaign.Status) {
+		return result, nil
+	}
+	if status.State != campaign.Status.State && status.State != api.CampaignActive {
+		logger.Info("🏁️ MetricCampaign finished", "State", status.State, "Completed", status.Completed, "Failed", status.Failed)
+	}
+	campaign.Status = status
+	return result, r.Status().Update(ctx, campaign)
+}
+
+// startCampaignSet creates a MetricSet of a template, or lets an existing
+// MetricSet that waits for the campaign start
+func (r *MetricCampaignReconciler) startCampaignSet(
+	ctx context.Context,
+	campaign *api.MetricCampaign,
+	member api.CampaignMember,
+	set *api.MetricSet,
+) error {
+	logger := log.FromContext(ctx)
+	started := time.Now().UTC().Format(time.RFC3339)
+
+	if set == nil {
+		set = member.Set
+		set.Annotations[api.CampaignStartedAnnotation] = started
+		ctrl.SetControllerReference(campaign, set, r.Scheme)
+		logger.Info("🗂️ Creating MetricSet for campaign", "Name", set.Name, "Parameters", member.Parameters)
+		return r.Create(ctx, set)
+	}
+	logger.Info("🗂️ Starting MetricSet of campaign", "Name", set.Name)
+	patch := client.MergeFrom(set.DeepCopy())
+	if set.Annotations == nil {
+		set.Annotations = map[string]string{}
+	}
+	set.Annotations[api.CampaignStartedAnnotation] = started
+	return r.Patch(ctx, set, patch)
+}
+
+// getCampaignStarts returns the MetricSets to start, in order, up to the
+// concurrency. A MetricSet can be started if the campaign creates it, or if it
+// exists and waits for the campaign.
+func getCampaignStarts(
+	statuses []api.CampaignMetricSet,
+	sets []*api.MetricSet,
+	members []api.CampaignMember,
+	concurrency int32,
+) []int {
+	active := 0
+	for _, status := range statuses {
+		if status.State == api.CampaignActive {
+			active++
+		}
+	}
+	starts := []int{}
+	for i, status := range statuses {
+		if concurrency > 0 && active >= int(concurrency) {
+			break
+		}
+		if status.State != api.CampaignPending {
+			continue
+		}
+		if sets[i] == nil && members[i].Set == nil {
+			continue
+		}
+		starts = append(starts, i)
+		active++
+	}
+	return starts
+}
+
+// campaignRun is the state of the JobSet (or Job) of a MetricSet, and the
+// seconds from creating it until it finished
+type campaignRun struct {
+	state   string
+	seconds float64
+}
+
+// getCampaignRun returns the run of a MetricSet, or nil if its JobSet (or Job)
+// does not exist
+func (r *MetricCampaignReconciler) getCampaignRun(ctx context.Context, set *api.MetricSet) (*campaignRun, error) {
+	if set.CampaignHeld() || set.Spec.Scaling.Enabled() || set.IsSharded() {
+		return nil, nil
+	}
+	if set.UsesJobs() || (set.Spec.Backend == "" && r.jobSetMissing) {
+		job, err := getMetricSetJob(ctx, r.Client, set)
+		if err != nil || job == nil {
+			return nil, err
+		}
+		return getJobRun(job), nil
+	}
+	js := &jobset.JobSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.Name, Namespace: set.Namespace}, js)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return getJobSetRun(js), nil
+}
+
+// getJobSetRun returns the run of a JobSet
+func getJobSetRun(js *jobset.JobSet) *campaignRun {
+	run := &campaignRun{state: getJobSetState(js)}
+	for _, condition := range js.Status.Conditions {
+		if condition.Status == metav1.ConditionTrue &&
+			(condition.Type == string(jobset.JobSetCompleted) || condition.Type == string(jobset.JobSetFailed)) {
+			run.seconds = condition.LastTransitionTime.Sub(js.CreationTimestamp.Time).Seconds()
+		}
+	}
+	return run
+}
+
+// getJobRun returns the run of a Job
+func getJobRun(job *batchv1.Job) *campaignRun {
+	run := &campaignRun{state: getJobState(job)}
+	for _, condition := range job.Status.Conditions {
+		if condition.Status == corev1.ConditionTrue &&
+			(condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) {
+			run.seconds = condition.LastTransitionTime.Sub(job.CreationTimestamp.Time).Seconds()
+		}
+	}
+	return run
+}
+
+// getCampaignSetStatus returns the state of a MetricSet of a campaign, from its
+// status and its run (nil if the JobSet or Job does not exist yet). A scaling
+// study or sharded run is finished when the operator has its results.
+func getCampaignSetStatus(set *api.MetricSet, run *campaignRun) api.CampaignMetricSet {
+	status := api.CampaignMetricSet{Name: set.Name, State: api.CampaignActive}
+	switch {
+	case set.CampaignHeld():
+		status.State = api.CampaignPending
+		return status
+
+	case set.Spec.Canary.Enabled():
+		status.State = api.CampaignFailed
+		status.Message = "a canary runs until it is deleted, and cannot be in a campaign"
+		return status
+
+	case set.Status.Cancellation == api.CancelCancelled:
+		status.State = api.CampaignFailed
+		status.Message = "the run was cancelled"
+		return status
+
+	case set.Spec.Scaling.Enabled():
+		status.Scaling = set.Status.Scaling
+		if len(set.Status.Scaling) < len(set.Spec.Scaling.Pods)*len(set.Spec.Metrics) {
+			return status
+		}
+		status.State = api.CampaignCompleted
+		for _, result := range set.Status.Scaling {
+			if result.State != "" {
+				status.State = api.CampaignFailed
+				status.Message = fmt.Sprintf("%s at %d pods: %s", result.Metric, result.Pods, result.State)
+			}
+		}
+		return status
+
+	case set.IsSharded():
+		switch getShardedState(set) {
+		case "completed":
+			status.State = api.CampaignCompleted
+		case "failed":
+			status.State = api.CampaignFailed
+			status.Message = "a shard failed"
+		}
+		return status
+	}
+
+	if run == nil || (run.state != "completed" && run.state != "failed") {
+		return status
+	}
+
+	// An acceptance run has finished when the report of the nodes is written
+	if set.Spec.Acceptance.Enabled() && (set.Status.Acceptance == nil || len(set.Status.Acceptance.Nodes) == 0) {
+		return status
+	}
+	status.Seconds = fmt.Sprintf("%.2f", run.seconds)
+	status.State = api.CampaignCompleted
+	if run.state == "failed" {
+		status.State = api.CampaignFailed
+		status.Message = "the workload failed"
+		if set.Status.Failures != nil && len(set.Status.Failures.Summaries) > 0 {
+			summary := set.Status.Failures.Summaries[0]
+			status.Message = fmt.Sprintf("%s exited with %d on %d pods", summary.Container, summary.ExitCode, summary.Count)
+			if summary.Message != "" {
+				status.Message += ": " + summary.Message
+			}
+		}
+	}
+	if set.Status.Acceptance != nil && set.Status.Acceptance.Failed > 0 {
+		status.State = api.CampaignFailed
+		status.Message = fmt.Sprintf("%d nodes failed acceptance", set.Status.Acceptance.Failed)
+	}
+	for _, metric := range set.Status.Metrics {
+		status.State = api.CampaignFailed
+		status.Message = fmt.Sprintf("%s %s", metric.Name, metric.State)
+	}
+	return status
+}
+
+// getCampaignStatus counts the MetricSets in each state. The campaign is active
+// until each has finished, and then failed if one failed.
+func getCampaignStatus(statuses []api.CampaignMetricSet) api.MetricCampaignStatus {
+	status := api.MetricCampaignStatus{MetricSets: statuses}
+	for _, set := range statuses {
+		switch set.State {
+		case api.CampaignPending:
+			status.Pending++
+		case api.CampaignActive:
+			status.Active++
+		case api.CampaignCompleted:
+			status.Completed++
+		case api.CampaignFailed:
+			status.Failed++
+		}
+	}
+	switch {
+	case status.Pending > 0 || status.Active > 0:
+		status.State = api.CampaignActive
+	case status.Failed > 0:
+		status.State = api.CampaignFailed
+	default:
+		status.State = api.CampaignCompleted
+	}
+	return status
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MetricCampaignReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.jobSetMissing = !hasJobSet(r.Discovery)
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.MetricCampaign{}).
+		Owns(&api.MetricSet{}).
+		Complete(r)
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestCampaignMembers(t *testing.T) {
+	campaign := &api.MetricCampaign{
+		ObjectMeta: metav1.ObjectMeta{Name: "sweep", Namespace: "default"},
+		Spec: api.MetricCampaignSpec{
+			MetricSets: []string{"baseline"},
+			Templates: []api.CampaignTemplate{{
+				Name: "fio",
+				Matrix: map[string][]intstr.IntOrString{
+					"pods": {intstr.FromInt(1), intstr.FromInt(2)},
+					"size": {intstr.FromString("1M"), intstr.FromString("1G")},
+				},
+				Spec: runtime.RawExtension{Raw: []byte(`{
+					"pods": "{{ matrix.pods }}",
+					"metrics": [{"name": "io-fio", "options": {"size": "{{matrix.size}}", "prefix": "run-{{ matrix.size }}"}}]
+				}`)},
+			}},
+		},
+	}
+	members, err := campaign.Members()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 5 || members[0].Name != "baseline" || members[0].Set != nil {
+		t.Fatalf("expected the existing MetricSet and 4 of the template, found %+v", members)
+	}
+
+	// The last key of the matrix changes fastest
+	expected := []struct {
+		pods int32
+		size string
+	}{{1, "1M"}, {1, "1G"}, {2, "1M"}, {2, "1G"}}
+	for i, member := range members[1:] {
+		set := member.Set
+		if member.Name != "sweep-fio-"+string(rune('0'+i)) || set.Name != member.Name || set.Labels[api.CampaignLabel] != "sweep" {
+			t.Errorf("unexpected name %s or labels %v", member.Name, set.Labels)
+		}
+		options := set.Spec.Metrics[0].Options
+		if set.Spec.Pods != expected[i].pods || options["size"].StrVal != expected[i].size || options["prefix"].StrVal != "run-"+expected[i].size {
+			t.Errorf("expected %v, found %d pods and options %v", expected[i], set.Spec.Pods, options)
+		}
+		if member.Parameters["size"] != expected[i].size || !set.CampaignHeld() {
+			t.Errorf("unexpected parameters %v", member.Parameters)
+		}
+	}
+}
+
+func TestCampaignMembersInvalid(t *testing.T) {
+	tests := map[string]struct {
+		spec  api.MetricCampaignSpec
+		error string
+	}{
+		"empty": {
+			error: "one or more",
+		},
+		"duplicate": {
+			spec:  api.MetricCampaignSpec{MetricSets: []string{"a", "a"}},
+			error: "more than once",
+		},
+		"concurrency": {
+			spec:  api.MetricCampaignSpec{MetricSets: []string{"a"}, Concurrency: -1},
+			error: "concurrency",
+		},
+		"missing placeholder": {
+			spec: api.MetricCampaignSpec{Templates: []api.CampaignTemplate{{
+				Name: "fio",
+				Spec: runtime.RawExtension{Raw: []byte(`{"metrics": [{"name": "io-fio", "options": {"size": "{{ matrix.size }}"}}]}`)},
+			}}},
+			error: "matrix does not have size",
+		},
+		"unknown field": {
+			spec: api.MetricCampaignSpec{Templates: []api.CampaignTemplate{{
+				Name: "fio",
+				Spec: runtime.RawExtension{Raw: []byte(`{"metric": [{"name": "io-fio"}]}`)},
+			}}},
+			error: "not a valid MetricSet spec",
+		},
+		"canary": {
+			spec: api.MetricCampaignSpec{Templates: []api.CampaignTemplate{{
+				Name: "fio",
+				Spec: runtime.RawExtension{Raw: []byte(`{"metrics": [{"name": "io-fio"}], "canary": {"intervalSeconds": 3600}}`)},
+			}}},
+			error: "canary",
+		},
+		"name": {
+			spec: api.MetricCampaignSpec{Templates: []api.CampaignTemplate{{
+				Name: "Fio",
+				Spec: runtime.RawExtension{Raw: []byte(`{"metrics": [{"name": "io-fio"}]}`)},
+			}}},
+			error: "lowercase",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			campaign := &api.MetricCampaign{ObjectMeta: metav1.ObjectMeta{Name: "sweep"}, Spec: test.spec}
+			_, err := campaign.Members()
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("expected an error with %q, found %v", test.error, err)
+			}
+		})
+	}
+}
+
+func TestGetCampaignSetStatus(t *testing.T) {
+	tests := map[string]struct {
+		set     func(set *api.MetricSet)
+		run     *campaignRun
+		state   string
+		message string
+	}{
+		"held": {
+			set: func(set *api.MetricSet) {
+				set.Labels = map[string]string{api.CampaignLabel: "sweep"}
+			},
+			run:   &campaignRun{state: "completed"},
+			state: api.CampaignPending,
+		},
+		"started": {
+			set: func(set *api.MetricSet) {
+				set.Labels = map[string]string{api.CampaignLabel: "sweep"}
+				set.Annotations = map[string]string{api.CampaignStartedAnnotation: "2023-01-01T00:00:00Z"}
+			},
+			state: api.CampaignActive,
+		},
+		"running": {
+			run:   &campaignRun{state: "active"},
+			state: api.CampaignActive,
+		},
+		"completed": {
+			run:   &campaignRun{state: "completed", seconds: 90},
+			state: api.CampaignCompleted,
+		},
+		"failed": {
+			set: func(set *api.MetricSet) {
+				set.Status.Failures = &api.FailureStatus{Summaries: []api.FailureSummary{{Container: "app", ExitCode: 137, Count: 2}}}
+			},
+			run:     &campaignRun{state: "failed"},
+			state:   api.CampaignFailed,
+			message: "app exited with 137 on 2 pods",
+		},
+		"timed out": {
+			set: func(set *api.MetricSet) {
+				set.Status.Metrics = []api.MetricState{{Name: "io-fio", State: "TimedOut"}}
+			},
+			run:     &campaignRun{state: "completed"},
+			state:   api.CampaignFailed,
+			message: "io-fio TimedOut",
+		},
+		"scaling": {
+			set: func(set *api.MetricSet) {
+				set.Spec.Scaling.Pods = []int32{1, 2}
+				set.Status.Scaling = []api.ScalingResult{{Metric: "io-fio", Pods: 1, Seconds: "10"}}
+			},
+			state: api.CampaignActive,
+		},
+		"scaling failed": {
+			set: func(set *api.MetricSet) {
+				set.Spec.Scaling.Pods = []int32{1, 2}
+				set.Status.Scaling = []api.ScalingResult{{Metric: "io-fio", Pods: 1, Seconds: "10"}, {Metric: "io-fio", Pods: 2, State: "Failed"}}
+			},
+			state:   api.CampaignFailed,
+			message: "io-fio at 2 pods: Failed",
+		},
+		"cancelled": {
+			set: func(set *api.MetricSet) {
+				set.Status.Cancellation = api.CancelCancelled
+			},
+			state:   api.CampaignFailed,
+			message: "the run was cancelled",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "fio"}}
+			set.Spec.Metrics = []api.Metric{{Name: "io-fio"}}
+			if test.set != nil {
+				test.set(set)
+			}
+			status := getCampaignSetStatus(set, test.run)
+			if status.State != test.state || status.Message != test.message {
+				t.Errorf("expected %s (%q), found %s (%q)", test.state, test.message, status.State, status.Message)
+			}
+		})
+	}
+}
+
+func TestGetCampaignStarts(t *testing.T) {
+	held := &api.MetricSet{}
+	template := &api.MetricSet{}
+	members := []api.CampaignMember{{Name: "a"}, {Name: "b"}, {Name: "c", Set: template}, {Name: "d", Set: template}, {Name: "e"}}
+	sets := []*api.MetricSet{held, nil, nil, nil, held}
+	statuses := []api.CampaignMetricSet{
+		{Name: "a", State: api.CampaignActive},
+		{Name: "b", State: api.CampaignPending, Message: "the MetricSet does not exist"},
+		{Name: "c", State: api.CampaignPending},
+		{Name: "d", State: api.CampaignPending},
+		{Name: "e", State: api.CampaignPending},
+	}
+
+	// A missing MetricSet is skipped, and one is active
+	starts := getCampaignStarts(statuses, sets, members, 3)
+	if len(starts) != 2 || starts[0] != 2 || starts[1] != 3 {
+		t.Errorf("expected to start c and d, found %v", starts)
+	}
+	starts = getCampaignStarts(statuses, sets, members, 0)
+	if len(starts) != 3 || starts[2] != 4 {
+		t.Errorf("expected to start all that can start, found %v", starts)
+	}
+	starts = getCampaignStarts(statuses, sets, members, 1)
+	if len(starts) != 0 {
+		t.Errorf("expected to wait for the active MetricSet, found %v", starts)
+	}
+}
+
+func TestGetCampaignStatus(t *testing.T) {
+	status := getCampaignStatus([]api.CampaignMetricSet{{State: api.CampaignCompleted}, {State: api.CampaignPending}})
+	if status.State != api.CampaignActive || status.Pending != 1 || status.Completed != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	status = getCampaignStatus([]api.CampaignMetricSet{{State: api.CampaignCompleted}, {State: api.CampaignFailed}})
+	if status.State != api.CampaignFailed || status.Failed != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	status = getCampaignStatus([]api.CampaignMetricSet{{State: api.CampaignCompleted}})
+	if status.State != api.CampaignCompleted {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
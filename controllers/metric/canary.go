@@ -0,0 +1,241 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+// How often to check again if the run of a canary has finished
+var canaryRequeue = 30 * time.Second
+
+// Label for the MetricSets of a canary, with the name of the canary
+var canaryLabel = "metricset-canary"
+
+// getCanarySet returns the MetricSet for a run of a canary, an acceptance run on
+// some nodes. The service (and subdomain) are unique to the run.
+func getCanarySet(set *api.MetricSet, run int32, nodes []string) *api.MetricSet {
+	child := &api.MetricSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      api.CanaryName(set.Name, run),
+			Namespace: set.Namespace,
+			Labels:    map[string]string{canaryLabel: set.Name},
+		},
+		Spec: *set.Spec.DeepCopy(),
+	}
+	child.Spec.Pods = int32(len(nodes))
+	child.Spec.Acceptance = api.Acceptance{Checks: set.Spec.Canary.Checks, Nodes: nodes}
+	child.Spec.Canary = api.Canary{}
+	child.Spec.ServiceName = api.CanaryName(set.Spec.ServiceName, run)
+	if child.Spec.Network.Subdomain != "" {
+		child.Spec.Network.Subdomain = api.CanaryName(set.Spec.Network.Subdomain, run)
+	}
+	return child
+}
+
+// getCanaryNodes returns the next nodes of the pool for a run, wrapping around
+func getCanaryNodes(pool []string, next int32, count int32) []string {
+	if int(count) > len(pool) {
+		count = int32(len(pool))
+	}
+	nodes := []string{}
+	for i := int32(0); i < count; i++ {
+		nodes = append(nodes, pool[int(next+i)%len(pool)])
+	}
+	return nodes
+}
+
+// reconcileCanary runs the metrics periodically, one MetricSet (run) at a time on
+// the next nodes of the pool. When each finishes, the results of its nodes are
+// checked against recent runs, and degraded nodes get an event and the condition.
+func (r *MetricSetReconciler) reconcileCanary(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if set.Status.Canary == nil {
+		set.Status.Canary = &api.CanaryStatus{}
+	}
+	status := set.Status.Canary
+	interval := time.Duration(set.Spec.Canary.IntervalSeconds) * time.Second
+
+	child := &api.MetricSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: api.CanaryName(set.Name, status.Runs), Namespace: set.Namespace}, child)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	// The next run is created when the interval has passed since the last
+	if errors.IsNotFound(err) {
+		if status.LastRun != nil {
+			wait := time.Until(status.LastRun.Add(interval))
+			if wait > 0 {
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+		}
+		nodes := &corev1.NodeList{}
+		err = r.List(ctx, nodes, client.MatchingLabels(set.Spec.Pod.NodeSelector))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		pool := getAcceptancePool(nodes.Items, nil)
+		if len(pool) == 0 {
+			logger.Info("🟧️ No ready nodes for the canary, checking again", "NodeSelector", set.Spec.Pod.NodeSelector)
+			return ctrl.Result{RequeueAfter: canaryRequeue}, nil
+		}
+		selected := getCanaryNodes(pool, status.Next, set.Spec.Canary.Nodes)
+		child = getCanarySet(set, status.Runs, selected)
+		logger.Info("🐤️ Creating MetricSet for canary run", "Name", child.Name, "Nodes", selected)
+		ctrl.SetControllerReference(set, child, r.Scheme)
+		err = r.Create(ctx, child)
+		if err != nil {
+			logger.Error(err, "🟥️ Failed to create MetricSet for canary run", "Name", child.Name)
+			return ctrl.Result{}, err
+		}
+		now := metav1.Now()
+		status.LastRun = &now
+		status.Next = (status.Next + int32(len(selected))) % int32(len(pool))
+		return ctrl.Result{RequeueAfter: canaryRequeue}, r.Status().Update(ctx, set)
+	}
+
+	// The run is finished when its acceptance report is written
+	if child.Status.Acceptance == nil || len(child.Status.Acceptance.Nodes) == 0 {
+		return ctrl.Result{RequeueAfter: canaryRequeue}, nil
+	}
+	added := getCanaryResults(&set.Spec.Canary, status.Results, status.Runs, child.Status.Acceptance.Nodes)
+	for _, result := range added {
+		r.recordCanaryResult(set, result)
+	}
+	status.Results = append(status.Results, added...)
+	if len(status.Results) > int(set.Spec.Canary.History) {
+		status.Results = status.Results[len(status.Results)-int(set.Spec.Canary.History):]
+	}
+	status.Degraded = getDegradedNodes(status.Results)
+	status.Runs++
+	meta.SetStatusCondition(&set.Status.Conditions, getDegradedCondition(set, status.Degraded))
+	logger.Info("🐤️ Canary run finished", "Name", child.Name, "Degraded", status.Degraded)
+	err = r.Status().Update(ctx, set)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The results are in the status, so the run is not needed
+	err = r.Delete(ctx, child, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	wait := time.Until(status.LastRun.Add(interval))
+	if wait <= 0 {
+		return ctrl.Result{Requeue: true}, nil
+	}
+	return ctrl.Result{RequeueAfter: wait}, nil
+}
+
+// recordCanaryResult publishes the values of a node to the operator metrics, and
+// raises an event if it is degraded
+func (r *MetricSetReconciler) recordCanaryResult(set *api.MetricSet, result api.CanaryResult) {
+	for key, raw := range result.Values {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err == nil {
+			canaryValues.WithLabelValues(set.Namespace, set.Name, result.Name, key).Set(value)
+		}
+	}
+	degraded := 0.0
+	if result.Result == api.AcceptanceFailed {
+		degraded = 1
+		if r.Recorder != nil {
+			r.Recorder.Eventf(set, corev1.EventTypeWarning, api.CanaryDegraded, "Node %s is degraded in run %d: %s", result.Name, result.Run, strings.Join(result.Failures, "; "))
+		}
+	}
+	canaryDegraded.WithLabelValues(set.Namespace, set.Name, result.Name).Set(degraded)
+}
+
+// getCanaryResults checks the nodes of a run, where the median for a tolerance is
+// over the recent results and this run
+func getCanaryResults(
+	canary *api.Canary,
+	results []api.CanaryResult,
+	run int32,
+	report []api.NodeAcceptance,
+) []api.CanaryResult {
+
+	// Each result (not node) counts once toward the median
+	entries := []string{}
+	values := map[string]map[string]string{}
+	for i, result := range results {
+		entry := fmt.Sprintf("result-%d", i)
+		entries = append(entries, entry)
+		values[entry] = result.Values
+	}
+	nodes := []string{}
+	current := map[string]map[string]string{}
+	for i, node := range report {
+		entry := fmt.Sprintf("run-%d", i)
+		entries = append(entries, entry)
+		values[entry] = node.Values
+		nodes = append(nodes, node.Name)
+		current[node.Name] = node.Values
+	}
+	medians := getAcceptanceMedians(canary.Checks, entries, values)
+
+	added := []api.CanaryResult{}
+	for _, node := range evaluateAcceptance(canary.Checks, nodes, current, medians) {
+		added = append(added, api.CanaryResult{Run: run, NodeAcceptance: node})
+	}
+	return added
+}
+
+// getDegradedNodes returns the nodes that failed their last run
+func getDegradedNodes(results []api.CanaryResult) []string {
+	last := map[string]string{}
+	for _, result := range results {
+		last[result.Name] = result.Result
+	}
+	degraded := []string{}
+	for node, result := range last {
+		if result == api.AcceptanceFailed {
+			degraded = append(degraded, node)
+		}
+	}
+	sort.Strings(degraded)
+	return degraded
+}
+
+// getDegradedCondition is True when nodes are degraded in their last run
+func getDegradedCondition(set *api.MetricSet, degraded []string) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               api.DegradedCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             api.CanaryHealthy,
+		Message:            "No nodes are degraded in their last run",
+		ObservedGeneration: set.Generation,
+	}
+	if len(degraded) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = api.CanaryDegraded
+		condition.Message = fmt.Sprintf("Nodes are degraded in their last run: %s", strings.Join(degraded, ", "))
+	}
+	return condition
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+func TestGetCanaryNodes(t *testing.T) {
+	pool := []string{"a", "b", "c"}
+	tests := []struct {
+		next     int32
+		count    int32
+		expected []string
+	}{
+		{next: 0, count: 1, expected: []string{"a"}},
+		{next: 2, count: 2, expected: []string{"c", "a"}},
+		{next: 1, count: 5, expected: []string{"b", "c", "a"}},
+		{next: 7, count: 1, expected: []string{"b"}},
+	}
+	for _, test := range tests {
+		nodes := getCanaryNodes(pool, test.next, test.count)
+		if !reflect.DeepEqual(nodes, test.expected) {
+			t.Errorf("next %d count %d: expected %v, found %v", test.next, test.count, test.expected, nodes)
+		}
+	}
+}
+
+func TestGetCanaryResults(t *testing.T) {
+	canary := &api.Canary{
+		History: 10,
+		Checks: []api.AcceptanceCheck{
+			{Metric: "perf-throttle", Value: "sustainedOpsPerSecond", MedianTolerance: 20},
+		},
+	}
+	withValue := func(node, value string) api.NodeAcceptance {
+		return api.NodeAcceptance{Name: node, Values: map[string]string{"perf-throttle/sustainedOpsPerSecond": value}}
+	}
+
+	// Recent runs of other nodes are the baseline for the median
+	results := []api.CanaryResult{}
+	for i, node := range []string{"a", "b", "c", "d"} {
+		results = append(results, getCanaryResults(canary, results, int32(i), []api.NodeAcceptance{withValue(node, "100")})...)
+	}
+	if degraded := getDegradedNodes(results); len(degraded) != 0 {
+		t.Fatalf("expected no degraded nodes, found %v", degraded)
+	}
+
+	// A node well below the recent median is degraded, and one near it is not
+	added := getCanaryResults(canary, results, 4, []api.NodeAcceptance{withValue("e", "70"), withValue("f", "95")})
+	if len(added) != 2 || added[0].Run != 4 {
+		t.Fatalf("expected two results for run 4, found %v", added)
+	}
+	results = append(results, added...)
+	if degraded := getDegradedNodes(results); !reflect.DeepEqual(degraded, []string{"e"}) {
+		t.Errorf("expected node e to be degraded, found %v", degraded)
+	}
+
+	// A node is healthy again when its next run passes
+	results = append(results, getCanaryResults(canary, results, 5, []api.NodeAcceptance{withValue("e", "99")})...)
+	if degraded := getDegradedNodes(results); len(degraded) != 0 {
+		t.Errorf("expected no degraded nodes after node e recovered, found %v", degraded)
+	}
+}
+
+func TestGetDegradedCondition(t *testing.T) {
+	set := &api.MetricSet{}
+	condition := getDegradedCondition(set, nil)
+	if condition.Status != "False" || condition.Reason != api.CanaryHealthy {
+		t.Errorf("expected a healthy condition, found %v", condition)
+	}
+	condition = getDegradedCondition(set, []string{"a", "b"})
+	if condition.Status != "True" || condition.Reason != api.CanaryDegraded {
+		t.Errorf("expected a degraded condition, found %v", condition)
+	}
+}
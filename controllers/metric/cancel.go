@@ -0,0 +1,229 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// How often to check again if the pods of a cancelled run have stopped
+var cancelRequeue = 5 * time.Second
+
+// reconcileCancel stops a run that is cancelled. The JobSet is suspended, so the
+// Job controller deletes the pods (sending SIGTERM) and the entrypoints flush partial
+// results. When no pods are left, the JobSet is deleted.
+func (r *MetricSetReconciler) reconcileCancel(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if set.Status.Cancellation == api.CancelCancelled {
+		return ctrl.Result{}, nil
+	}
+
+	// The MetricSets of a scaling study are each cancelled
+	if set.Spec.Scaling.Enabled() {
+		err := r.cancelScaling(ctx, set)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.updateCancellation(ctx, set, api.CancelCancelled)
+	}
+
+	// As are the JobSets of a sharded run
+	if set.IsSharded() {
+		return r.cancelShards(ctx, set)
+	}
+
+	// And a run with the Job backend is stopped in the same way
+	if set.UsesJobs() {
+		return r.cancelJob(ctx, set)
+	}
+
+	js := &jobset.JobSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.Name, Namespace: set.Namespace}, js)
+	if errors.IsNotFound(err) {
+		err = r.deletePerfTuning(ctx, set)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.updateCancellation(ctx, set, api.CancelCancelled)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// A run that already finished has nothing to flush
+	if !isFinished(js) && (js.Spec.Suspend == nil || !*js.Spec.Suspend) {
+		logger.Info("🛑️ Cancelling MetricSet, suspending JobSet", "Name", js.Name)
+		suspend := true
+		js.Spec.Suspend = &suspend
+		err = r.Update(ctx, js)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: cancelRequeue}, r.updateCancellation(ctx, set, api.CancelStopping)
+	}
+
+	// Wait for the pods to flush results and terminate
+	pods := &corev1.PodList{}
+	err = r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{"metricset-name": set.Name},
+	)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if getCancelState(js, pods.Items) == api.CancelStopping {
+		return ctrl.Result{RequeueAfter: cancelRequeue}, nil
+	}
+
+	logger.Info("🛑️ MetricSet pods stopped, deleting JobSet", "Name", js.Name)
+	err = r.Delete(ctx, js, client.PropagationPolicy("Background"))
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	err = r.deletePerfTuning(ctx, set)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.updateCancellation(ctx, set, api.CancelCancelled)
+}
+
+// getCancelState returns Stopping while pods of a suspended JobSet are still running
+// (or terminating), and Cancelled when they have all stopped
+func getCancelState(js *jobset.JobSet, pods []corev1.Pod) string {
+	if isFinished(js) {
+		return api.CancelCancelled
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodPending || pod.Status.Phase == corev1.PodRunning {
+			return api.CancelStopping
+		}
+	}
+	return api.CancelCancelled
+}
+
+// cancelScaling cancels the MetricSets of a scaling study
+func (r *MetricSetReconciler) cancelScaling(ctx context.Context, set *api.MetricSet) error {
+	children := &api.MetricSetList{}
+	err := r.List(
+		ctx,
+		children,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{api.ScalingLabel: set.Name},
+	)
+	if err != nil {
+		return err
+	}
+	for i := range children.Items {
+		child := &children.Items[i]
+		if child.Spec.Cancel {
+			continue
+		}
+		child.Spec.Cancel = true
+		err = r.Update(ctx, child)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancelShards suspends the JobSets of a sharded run, and deletes them when
+// the pods of every shard have stopped
+func (r *MetricSetReconciler) cancelShards(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	shards := &jobset.JobSetList{}
+	err := r.List(
+		ctx,
+		shards,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{mctrl.MetricSetLabel: set.Name},
+		client.HasLabels{mctrl.ShardLabel},
+	)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	stopping := false
+	for i := range shards.Items {
+		js := &shards.Items[i]
+		if isFinished(js) || (js.Spec.Suspend != nil && *js.Spec.Suspend) {
+			continue
+		}
+		logger.Info("🛑️ Cancelling MetricSet, suspending JobSet shard", "Name", js.Name)
+		suspend := true
+		js.Spec.Suspend = &suspend
+		err = r.Update(ctx, js)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		stopping = true
+	}
+	if stopping {
+		return ctrl.Result{RequeueAfter: cancelRequeue}, r.updateCancellation(ctx, set, api.CancelStopping)
+	}
+
+	// The pods of all shards have the label of the MetricSet
+	pods := &corev1.PodList{}
+	err = r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{"metricset-name": set.Name},
+	)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range shards.Items {
+		if getCancelState(&shards.Items[i], pods.Items) == api.CancelStopping {
+			return ctrl.Result{RequeueAfter: cancelRequeue}, nil
+		}
+	}
+	for i := range shards.Items {
+		js := &shards.Items[i]
+		logger.Info("🛑️ MetricSet pods stopped, deleting JobSet shard", "Name", js.Name)
+		err = r.Delete(ctx, js, client.PropagationPolicy("Background"))
+		if err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	}
+	err = r.deletePerfTuning(ctx, set)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.updateCancellation(ctx, set, api.CancelCancelled)
+}
+
+// updateCancellation records the cancellation state in the status
+func (r *MetricSetReconciler) updateCancellation(ctx context.Context, set *api.MetricSet, state string) error {
+	if set.Status.Cancellation == state {
+		return nil
+	}
+	set.Status.Cancellation = state
+	return r.Status().Update(ctx, set)
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestGetCancelState(t *testing.T) {
+	withPhases := func(phases ...corev1.PodPhase) []corev1.Pod {
+		pods := []corev1.Pod{}
+		for _, phase := range phases {
+			pods = append(pods, corev1.Pod{Status: corev1.PodStatus{Phase: phase}})
+		}
+		return pods
+	}
+	tests := []struct {
+		name     string
+		pods     []corev1.Pod
+		expected string
+	}{
+		{name: "running", pods: withPhases(corev1.PodSucceeded, corev1.PodRunning), expected: api.CancelStopping},
+		{name: "pending", pods: withPhases(corev1.PodPending), expected: api.CancelStopping},
+		{name: "stopped", pods: withPhases(corev1.PodSucceeded, corev1.PodFailed), expected: api.CancelCancelled},
+		{name: "no pods", expected: api.CancelCancelled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := getCancelState(&jobset.JobSet{}, test.pods)
+			if state != test.expected {
+				t.Errorf("expected %s, found %s", test.expected, state)
+			}
+		})
+	}
+}
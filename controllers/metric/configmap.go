@@ -9,9 +9,9 @@ package controllers
 
 import (
 	"context"
-	"fmt"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/logging"
 	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 	corev1 "k8s.io/api/core/v1"
@@ -19,92 +19,90 @@ import (
 
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-// TODO this should take the final entrypoint scripts
-// ensureConfigMap ensures we've generated the read only entrypoints
+// ensureConfigMaps ensures we've generated the read only entrypoints. These are
+// usually in one config map, but can be split across several if they are large.
+// The config maps are named for the set (the MetricSet, or a shard of it).
 func (r *MetricSetReconciler) ensureConfigMaps(
 	ctx context.Context,
 	spec *api.MetricSet,
-	set *mctrl.MetricSet,
+	set *api.MetricSet,
 	containerSpecs []*specs.ContainerSpec,
-) (*corev1.ConfigMap, ctrl.Result, error) {
-
-	// Look for the config map by name
-	existing := &corev1.ConfigMap{}
-	err := r.Get(
-		ctx,
-		types.NamespacedName{
-			Name:      spec.Name,
-			Namespace: spec.Namespace,
-		},
-		existing,
-	)
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
 
+	// The shards are deterministic, and match the volumes in the JobSet
+	shards, err := mctrl.GetConfigMapShards(set, containerSpecs)
 	if err != nil {
-
-		r.Log.Info("ConfigMaps", "Status", "Not found and creating")
-
-		// Prepare lookup of entrypoints, one per application/storage,
-		// or possible multiple for a standalone metric
-		data := map[string]string{}
-
-		// Go through each container spec entrypoint
-		for _, cs := range containerSpecs {
-			r.Log.Info("⬜️ ConfigMaps", "Name", cs.EntrypointScript.Name, "Writing", cs)
-			data[cs.EntrypointScript.Name] = cs.EntrypointScript.WriteScript()
+		return ctrl.Result{}, err
+	}
+	for _, shard := range shards {
+
+		// Look for the config map by name
+		existing := &corev1.ConfigMap{}
+		err := r.Get(
+			ctx,
+			types.NamespacedName{
+				Name:      shard.Name,
+				Namespace: spec.Namespace,
+			},
+			existing,
+		)
+		if err == nil {
+			logger.V(1).Info(
+				"🎉 Found existing MetricSet ConfigMap",
+				"Namespace", existing.Namespace,
+				"Name", existing.Name,
+			)
+			continue
 		}
-
-		cm, result, err := r.getConfigMap(ctx, spec, data)
+		logger.Info("ConfigMaps", "Status", "Not found and creating", "Name", shard.Name)
+		for key, data := range shard.Data {
+			if logging.DumpEntrypoints() {
+				logger.V(1).Info("⬜️ ConfigMaps", "Name", shard.Name, "Key", key, "Data", logging.Redact(data))
+			} else {
+				logger.V(1).Info("⬜️ ConfigMaps", "Name", shard.Name, "Key", key)
+			}
+		}
+		_, result, err := r.getConfigMap(ctx, spec, shard.Name, shard.Data)
 		if err != nil {
-			r.Log.Error(
-				err, "🟥️ Failed to get config map",
-				"Namespace", cm.Namespace,
-				"Name", (*cm).Name,
-			)
+			return result, err
 		}
-		return existing, result, err
-
-	} else {
-		r.Log.Info(
-			"🎉 Found existing MetricSet ConfigMap",
-			"Namespace", existing.Namespace,
-			"Name", existing.Name,
-		)
 	}
-	return existing, ctrl.Result{}, err
+	return ctrl.Result{}, nil
 }
 
 // getConfigMap generates the config map, when does not exist
 func (r *MetricSetReconciler) getConfigMap(
 	ctx context.Context,
 	set *api.MetricSet,
+	name string,
 	data map[string]string,
 ) (*corev1.ConfigMap, ctrl.Result, error) {
+	logger := log.FromContext(ctx)
 
 	// Create the config map with respective data!
 	cm := &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      set.Name,
+			Name:      name,
 			Namespace: set.Namespace,
 		},
 		Data: data,
 	}
 	// Finally create the config map
-	r.Log.Info(
+	logger.Info(
 		"✨ Creating MetricSet ConfigMap ✨",
 		"Namespace", cm.Namespace,
 		"Name", cm.Name,
 	)
-	// Show data in the logs for debugging
-	fmt.Println(cm.Data)
-
 	// Actually create it
 	ctrl.SetControllerReference(set, cm, r.Scheme)
 	err := r.Create(ctx, cm)
 	if err != nil {
-		r.Log.Error(
+		logger.Error(
 			err, "🟥️ Failed to create MetricSet ConfigMap",
 			"Namespace", cm.Namespace,
 			"Name", (*cm).Name,
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// updateCostStatus estimates the cost of a finished run from the price table,
+// as the hours of the run (from when the first pod started) times the hourly
+// price of each node
+func (r *MetricSetReconciler) updateCostStatus(
+	ctx context.Context,
+	set *api.MetricSet,
+	js *jobset.JobSet,
+) error {
+	logger := log.FromContext(ctx)
+
+	if set.Spec.Cost.PriceTable == "" || set.Status.Cost != nil || !isFinished(js) {
+		return nil
+	}
+	table := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.Spec.Cost.PriceTable, Namespace: set.Namespace}, table)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("🟥️ Price table not found, cost will not be estimated", "Name", set.Spec.Cost.PriceTable)
+			return nil
+		}
+		return err
+	}
+
+	// Time the JobSet is suspended (e.g., queued, or held by a campaign) or
+	// waiting for pods to be scheduled is not counted
+	pods := &corev1.PodList{}
+	err = r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{mctrl.MetricSetLabel: set.Name},
+	)
+	if err != nil {
+		return err
+	}
+	hours := getFinishedTime(js).Sub(getRunStart(js, pods.Items).Time).Hours()
+	if hours < 0 {
+		hours = 0
+	}
+	cost := estimateCost(set.Status.Nodes, table.Data, hours)
+	set.Status.Cost = cost
+	logger.Info("💸️ Estimated MetricSet cost", "Name", set.Name, "Dollars", cost.Dollars, "NodeHours", cost.NodeHours)
+	return r.Status().Update(ctx, set)
+}
+
+// estimateCost multiplies the hours for each node by the hourly price of its
+// instance type, preferring a price for the capacity type (e.g., spot) if there is one
+func estimateCost(nodes []api.NodeStatus, prices map[string]string, hours float64) *api.CostStatus {
+	dollars := 0.0
+	unpriced := map[string]bool{}
+	for _, node := range nodes {
+		price, ok := getPrice(prices, node)
+		if !ok {
+			instanceType := node.InstanceType
+			if instanceType == "" {
+				instanceType = "unknown"
+			}
+			unpriced[instanceType] = true
+			continue
+		}
+		dollars += hours * price
+	}
+	cost := &api.CostStatus{
+		Dollars:   fmt.Sprintf("%.4f", dollars),
+		NodeHours: fmt.Sprintf("%.4f", hours*float64(len(nodes))),
+	}
+	for instanceType := range unpriced {
+		cost.Unpriced = append(cost.Unpriced, instanceType)
+	}
+	sort.Strings(cost.Unpriced)
+	return cost
+}
+
+// getPrice looks up the hourly price for a node in the price table
+func getPrice(prices map[string]string, node api.NodeStatus) (float64, bool) {
+	if node.InstanceType == "" {
+		return 0, false
+	}
+	keys := []string{node.InstanceType}
+	if node.CapacityType != "" {
+		keys = append([]string{fmt.Sprintf("%s.%s", node.InstanceType, node.CapacityType)}, keys...)
+	}
+	for _, key := range keys {
+		value, ok := prices[key]
+		if !ok {
+			continue
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err == nil {
+			return price, true
+		}
+	}
+	return 0, false
+}
+
+// getRunStart is when the first pod of the run started, or when the JobSet was
+// created if there are no pods (e.g., they were cleaned up)
+func getRunStart(js *jobset.JobSet, pods []corev1.Pod) metav1.Time {
+	start := metav1.Time{}
+	for _, pod := range pods {
+		if pod.Status.StartTime == nil {
+			continue
+		}
+		if start.IsZero() || pod.Status.StartTime.Before(&start) {
+			start = *pod.Status.StartTime
+		}
+	}
+	if start.IsZero() {
+		return js.CreationTimestamp
+	}
+	return start
+}
+
+// getFinishedTime is when the JobSet completed or failed
+func getFinishedTime(js *jobset.JobSet) metav1.Time {
+	for _, condition := range js.Status.Conditions {
+		if condition.Status != metav1.ConditionTrue {
+			continue
+		}
+		if condition.Type == string(jobset.JobSetCompleted) || condition.Type == string(jobset.JobSetFailed) {
+			return condition.LastTransitionTime
+		}
+	}
+	return metav1.Now()
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+func TestGetPrice(t *testing.T) {
+	prices := map[string]string{
+		"c7i.8xlarge":      "1.428",
+		"c7i.8xlarge.spot": " 0.512 ",
+		"n2-standard-32":   "not a price",
+	}
+	tests := map[string]struct {
+		node  api.NodeStatus
+		price float64
+		found bool
+	}{
+		"instance type": {
+			node:  api.NodeStatus{InstanceType: "c7i.8xlarge"},
+			price: 1.428,
+			found: true,
+		},
+		"capacity type": {
+			node:  api.NodeStatus{InstanceType: "c7i.8xlarge", CapacityType: "spot"},
+			price: 0.512,
+			found: true,
+		},
+		"capacity type without a price": {
+			node:  api.NodeStatus{InstanceType: "c7i.8xlarge", CapacityType: "on-demand"},
+			price: 1.428,
+			found: true,
+		},
+		"invalid price": {
+			node: api.NodeStatus{InstanceType: "n2-standard-32"},
+		},
+		"unknown instance type": {
+			node: api.NodeStatus{},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			price, found := getPrice(prices, test.node)
+			if price != test.price || found != test.found {
+				t.Errorf("expected %v (%v), found %v (%v)", test.price, test.found, price, found)
+			}
+		})
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	prices := map[string]string{"c7i.8xlarge": "2", "c7i.8xlarge.spot": "0.5"}
+	tests := map[string]struct {
+		nodes    []api.NodeStatus
+		hours    float64
+		expected api.CostStatus
+	}{
+		"no nodes": {
+			hours:    1,
+			expected: api.CostStatus{Dollars: "0.0000", NodeHours: "0.0000"},
+		},
+		"priced": {
+			nodes:    []api.NodeStatus{{InstanceType: "c7i.8xlarge"}, {InstanceType: "c7i.8xlarge", CapacityType: "spot"}},
+			hours:    0.5,
+			expected: api.CostStatus{Dollars: "1.2500", NodeHours: "1.0000"},
+		},
+		"unpriced": {
+			nodes:    []api.NodeStatus{{InstanceType: "c7i.8xlarge"}, {InstanceType: "m5.large"}, {}, {InstanceType: "m5.large"}},
+			hours:    2,
+			expected: api.CostStatus{Dollars: "4.0000", NodeHours: "8.0000", Unpriced: []string{"m5.large", "unknown"}},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cost := estimateCost(test.nodes, prices, test.hours)
+			if !reflect.DeepEqual(*cost, test.expected) {
+				t.Errorf("expected %+v, found %+v", test.expected, *cost)
+			}
+		})
+	}
+}
+
+func TestGetRunStart(t *testing.T) {
+	created := metav1.NewTime(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	js := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: created}}
+
+	// Without pods (or before they start) we count from creation
+	start := getRunStart(js, []corev1.Pod{{}})
+	if !start.Equal(&created) {
+		t.Errorf("expected the creation time, found %s", start)
+	}
+
+	// Otherwise time suspended or pending is not counted
+	first := metav1.NewTime(created.Add(30 * time.Minute))
+	second := metav1.NewTime(created.Add(40 * time.Minute))
+	pods := []corev1.Pod{
+		{Status: corev1.PodStatus{StartTime: &second}},
+		{},
+		{Status: corev1.PodStatus{StartTime: &first}},
+	}
+	start = getRunStart(js, pods)
+	if !start.Equal(&first) {
+		t.Errorf("expected the start of the first pod %s, found %s", first, start)
+	}
+}
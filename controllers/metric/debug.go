@@ -0,0 +1,82 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+// How often to check again for pods waiting to be released in debug mode
+var debugStatusRequeue = 10 * time.Second
+
+// updateDebugStatus records the pods that are waiting to be released in debug
+// mode. A pod is ready (with the debug readiness probe) while it waits.
+func (r *MetricSetReconciler) updateDebugStatus(
+	ctx context.Context,
+	set *api.MetricSet,
+	js *jobset.JobSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !set.Spec.Debug {
+		return ctrl.Result{}, nil
+	}
+	pods := &corev1.PodList{}
+	err := r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{"metricset-name": set.Name},
+	)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	var waiting []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning && isPodReady(&pod) {
+			waiting = append(waiting, pod.Name)
+		}
+	}
+	sort.Strings(waiting)
+
+	if !reflect.DeepEqual(waiting, set.Status.WaitingPods) {
+		set.Status.WaitingPods = waiting
+		logger.Info("🐛️ Pods waiting to be released", "Name", set.Name, "Pods", waiting)
+		err = r.Status().Update(ctx, set)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Pods are released by the user, so we keep checking until the run is done
+	if isFinished(js) {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: debugStatusRequeue}, nil
+}
+
+// isPodReady determines if a pod has the ready condition
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+// Pods listed for each group of failed containers, and the length of a message
+var (
+	failurePods    = 5
+	failureMessage = 200
+)
+
+// updateFailureStatus summarizes the failed containers of the pods of the set, so
+// "exit code 137 on 3 of 128 pods" is in the status instead of in every log
+func (r *MetricSetReconciler) updateFailureStatus(
+	ctx context.Context,
+	set *api.MetricSet,
+) error {
+	logger := log.FromContext(ctx)
+
+	pods := &corev1.PodList{}
+	err := r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{"metricset-name": set.Name},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Failures already recorded stay, since pods can be cleaned up after the run
+	if len(pods.Items) == 0 {
+		return nil
+	}
+	failures := getFailureStatus(pods.Items)
+	if failures.Failed == 0 {
+		failures = nil
+	}
+	if reflect.DeepEqual(failures, set.Status.Failures) {
+		return nil
+	}
+
+	// Each new way of failing gets an event, and not each pod that fails it
+	seen := map[string]bool{}
+	if set.Status.Failures != nil {
+		for _, summary := range set.Status.Failures.Summaries {
+			seen[getFailureKey(summary)] = true
+		}
+	}
+	set.Status.Failures = failures
+	if failures != nil {
+		for _, summary := range failures.Summaries {
+			description := describeFailure(summary, failures.Pods)
+			logger.Info("🟥️ Containers failed", "Name", set.Name, "Failure", description)
+			if r.Recorder != nil && !seen[getFailureKey(summary)] {
+				r.Recorder.Event(set, corev1.EventTypeWarning, "ContainersFailed", description)
+			}
+		}
+	}
+	return r.Status().Update(ctx, set)
+}
+
+// getFailureStatus groups the containers (and init containers) that failed by
+// replicated job, container, exit code, reason, and message. A container that
+// restarted counts by its last failure.
+func getFailureStatus(pods []corev1.Pod) *api.FailureStatus {
+	failures := &api.FailureStatus{Pods: int32(len(pods))}
+	groups := map[string]*api.FailureSummary{}
+	for _, pod := range pods {
+		failed := false
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			terminated := getFailedTermination(status)
+			if terminated == nil {
+				continue
+			}
+			failed = true
+			summary := api.FailureSummary{
+				Job:       pod.Labels[jobset.ReplicatedJobNameKey],
+				Container: status.Name,
+				ExitCode:  terminated.ExitCode,
+				Reason:    terminated.Reason,
+				Message:   getFailureMessage(terminated.Message),
+			}
+			key := getFailureKey(summary)
+			group, ok := groups[key]
+			if !ok {
+				summary.Pods = []string{}
+				group = &summary
+				groups[key] = group
+			}
+			group.Count++
+			if len(group.Pods) < failurePods {
+				group.Pods = append(group.Pods, pod.Name)
+			}
+		}
+		if failed {
+			failures.Failed++
+		}
+	}
+
+	for _, group := range groups {
+		sort.Strings(group.Pods)
+		failures.Summaries = append(failures.Summaries, *group)
+	}
+	sort.Slice(failures.Summaries, func(i, j int) bool {
+		a, b := failures.Summaries[i], failures.Summaries[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return getFailureKey(a) < getFailureKey(b)
+	})
+	return failures
+}
+
+// getFailureKey identifies how a container failed
+func getFailureKey(summary api.FailureSummary) string {
+	return fmt.Sprintf("%s/%s/%d/%s/%s", summary.Job, summary.Container, summary.ExitCode, summary.Reason, summary.Message)
+}
+
+// getFailedTermination returns the state of a container (or its last run) that
+// ended with a non-zero exit code, if any
+func getFailedTermination(status corev1.ContainerStatus) *corev1.ContainerStateTerminated {
+	for _, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+		if state.Terminated != nil && state.Terminated.ExitCode != 0 {
+			return state.Terminated
+		}
+	}
+	return nil
+}
+
+// getFailureMessage returns the last line of a termination message that is not a
+// reported value. The entrypoint writes its summary first (before the values),
+// and a container killed before it could gets the end of its log.
+func getFailureMessage(message string) string {
+	summary := ""
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimSpace(line)
+		name, _, ok := strings.Cut(line, "=")
+		if line == "" || (ok && name != "" && !strings.Contains(name, " ")) {
+			continue
+		}
+		summary = line
+	}
+	if runes := []rune(summary); len(runes) > failureMessage {
+		summary = string(runes[:failureMessage]) + "..."
+	}
+	return summary
+}
+
+// describeFailure is a one line description of a group of failed containers
+func describeFailure(summary api.FailureSummary, pods int32) string {
+	reason := ""
+	if summary.Reason != "" {
+		reason = fmt.Sprintf(" (%s)", summary.Reason)
+	}
+	description := fmt.Sprintf(
+		"%s/%s exit code %d%s on %d of %d pods, e.g., %s",
+		summary.Job, summary.Container, summary.ExitCode, reason, summary.Count, pods, strings.Join(summary.Pods, ", "),
+	)
+	if summary.Message != "" {
+		description += ": " + summary.Message
+	}
+	return description
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestGetFailureStatus(t *testing.T) {
+	terminated := func(code int32, reason, message string) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: code, Reason: reason, Message: message}}
+	}
+
+	// Of 8 pods, 3 were killed (one restarted), and one failed in its entrypoint
+	pods := []corev1.Pod{}
+	for i := 0; i < 8; i++ {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   fmt.Sprintf("m-%d", i),
+				Labels: map[string]string{jobset.ReplicatedJobNameKey: "m"},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "app", State: terminated(0, "Completed", "ratio=0.9")}},
+			},
+		}
+		status := &pod.Status.ContainerStatuses[0]
+		switch i {
+		case 1, 4:
+			status.State = terminated(137, "OOMKilled", "")
+		case 6:
+			status.State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+			status.LastTerminationState = terminated(137, "OOMKilled", "")
+		case 7:
+			status.State = terminated(1, "Error", "Failed with exit code 1 in phase solve\nratio=0.5")
+		}
+		pods = append(pods, pod)
+	}
+	failures := getFailureStatus(pods)
+	expected := &api.FailureStatus{
+		Pods:   8,
+		Failed: 4,
+		Summaries: []api.FailureSummary{
+			{Job: "m", Container: "app", ExitCode: 137, Reason: "OOMKilled", Count: 3, Pods: []string{"m-1", "m-4", "m-6"}},
+			{Job: "m", Container: "app", ExitCode: 1, Reason: "Error", Message: "Failed with exit code 1 in phase solve", Count: 1, Pods: []string{"m-7"}},
+		},
+	}
+	if !reflect.DeepEqual(failures, expected) {
+		t.Errorf("expected %+v, found %+v", expected, failures)
+	}
+	description := describeFailure(failures.Summaries[0], failures.Pods)
+	if description != "m/app exit code 137 (OOMKilled) on 3 of 8 pods, e.g., m-1, m-4, m-6" {
+		t.Errorf("unexpected description %q", description)
+	}
+}
+
+func TestGetFailureMessage(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{message: "", expected: ""},
+		{message: "ratio=0.9\nops=100", expected: ""},
+		{message: "DriversNotReady gdrdrv:missing\nratio=0.9", expected: "DriversNotReady gdrdrv:missing"},
+		{message: "starting\nMPI_Init failed: error = 12\n", expected: "MPI_Init failed: error = 12"},
+	}
+	for _, test := range tests {
+		found := getFailureMessage(test.message)
+		if found != test.expected {
+			t.Errorf("message %q: expected %q, found %q", test.message, test.expected, found)
+		}
+	}
+}
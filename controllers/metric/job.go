@@ -0,0 +1,302 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// hasJobSet determines if the JobSet API is installed. Without discovery (e.g.,
+// in tests) we assume that it is.
+func hasJobSet(dc discovery.DiscoveryInterface) bool {
+	if dc == nil {
+		return true
+	}
+	resources, err := dc.ServerResourcesForGroupVersion(jobset.GroupVersion.String())
+	if err != nil || resources == nil {
+		return false
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Kind == "JobSet" {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureJob creates a batch/v1 Job (and associated configs) for a MetricSet with
+// the Job backend. The JobSet is generated as for the JobSet backend, so the pods
+// and entrypoints are the same, and its one replicated job becomes the Job.
+func (r *MetricSetReconciler) ensureJob(
+	ctx context.Context,
+	spec *api.MetricSet,
+	set *mctrl.MetricSet,
+) (ctrl.Result, error) {
+	js, cs, err := mctrl.GetJobSet(spec, set)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	job, err := mctrl.GetJob(js)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The config maps need to exist before the Job
+	result, err := r.ensureConfigMaps(ctx, spec, spec, cs)
+	if err != nil {
+		return result, err
+	}
+
+	existing := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	if errors.IsNotFound(err) {
+		result, err = r.ensureScratch(ctx, spec)
+		if err != nil {
+			return result, err
+		}
+		result, err = r.ensureTLS(ctx, spec)
+		if err != nil {
+			return result, err
+		}
+		result, err = r.ensureDisruptionBudget(ctx, spec)
+		if err != nil {
+			return result, err
+		}
+		result, err = r.ensurePerfTuning(ctx, spec)
+		if err != nil {
+			return result, err
+		}
+		err = r.recordRendered(ctx, spec, set, js, cs)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.createJob(ctx, spec, job)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+
+		// Scratch, the disruption budget, and perf tuning are cleaned up when the run
+		// is finished, and metrics that timed out (or failed) are marked
+		finished := isJobFinished(existing)
+		err = r.cleanupScratch(ctx, spec, finished)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.cleanupDisruptionBudget(ctx, spec, finished)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.cleanupPerfTuning(ctx, spec, finished)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.updateMetricStatus(ctx, spec, cs)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.updateFailureStatus(ctx, spec)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Record the nodes (and placement) of the pods, if requested
+	nodesResult, err := r.updateNodeStatus(ctx, spec)
+	if err != nil {
+		return nodesResult, err
+	}
+	err = r.updatePlacementStatus(ctx, spec)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The headless service selects the pods of the Job as it does for a JobSet
+	selector := map[string]string{mctrl.MetricSetLabel: spec.Name}
+	result, err = r.exposeServices(ctx, spec, spec.Subdomain(), selector)
+	if err != nil {
+		return result, err
+	}
+	return nodesResult, nil
+}
+
+// createJob creates the Job for a MetricSet with the Job backend
+func (r *MetricSetReconciler) createJob(
+	ctx context.Context,
+	spec *api.MetricSet,
+	job *batchv1.Job,
+) error {
+	logger := log.FromContext(ctx)
+	logger.Info(
+		"🎉 Creating Metrics Job 🎉",
+		"Namespace:", job.Namespace,
+		"Name:", job.Name,
+	)
+	ctrl.SetControllerReference(spec, job, r.Scheme)
+	err := r.Client.Create(ctx, job)
+	if err != nil {
+		jobsetCreateErrors.Inc()
+		logger.Error(
+			err,
+			"Failed to create new Metrics Job",
+			"Namespace:", job.Namespace,
+			"Name:", job.Name,
+		)
+	}
+	return err
+}
+
+// getMetricSetJob returns the Job of a MetricSet with the Job backend, or nil if
+// it does not exist. Jobs of a JobSet do not have the label of the MetricSet, and
+// are not controlled by it.
+func getMetricSetJob(ctx context.Context, c client.Client, set *api.MetricSet) (*batchv1.Job, error) {
+	jobs := &batchv1.JobList{}
+	err := c.List(
+		ctx,
+		jobs,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{mctrl.MetricSetLabel: set.Name},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs.Items {
+		if metav1.IsControlledBy(&jobs.Items[i], set) {
+			return &jobs.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// getJobState returns completed, failed, queued (suspended), or active, as
+// getJobSetState does for a JobSet
+func getJobState(job *batchv1.Job) string {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		if condition.Type == batchv1.JobComplete {
+			return "completed"
+		}
+		if condition.Type == batchv1.JobFailed {
+			return "failed"
+		}
+	}
+	if job.Spec.Suspend != nil && *job.Spec.Suspend {
+		return "queued"
+	}
+	return "active"
+}
+
+// isJobFinished determines if a Job completed or failed
+func isJobFinished(job *batchv1.Job) bool {
+	state := getJobState(job)
+	return state == "completed" || state == "failed"
+}
+
+// isRunFinished determines if the JobSet (or Job, for the Job backend) of a
+// MetricSet exists and has finished
+func (r *MetricSetReconciler) isRunFinished(ctx context.Context, set *api.MetricSet) (bool, error) {
+	if set.UsesJobs() || (set.Spec.Backend == "" && r.jobSetMissing) {
+		job, err := getMetricSetJob(ctx, r.Client, set)
+		if err != nil || job == nil {
+			return false, err
+		}
+		return isJobFinished(job), nil
+	}
+
+	// The JobSet has the name of its MetricSet
+	js := &jobset.JobSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.Name, Namespace: set.Namespace}, js)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return isFinished(js), nil
+}
+
+// cancelJob stops a run with the Job backend as reconcileCancel does for a
+// JobSet: the Job is suspended so the pods flush partial results, and it is
+// deleted when they have stopped
+func (r *MetricSetReconciler) cancelJob(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	job, err := getMetricSetJob(ctx, r.Client, set)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if job == nil {
+		err = r.deletePerfTuning(ctx, set)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.updateCancellation(ctx, set, api.CancelCancelled)
+	}
+	if !isJobFinished(job) && (job.Spec.Suspend == nil || !*job.Spec.Suspend) {
+		logger.Info("🛑️ Cancelling MetricSet, suspending Job", "Name", job.Name)
+		suspend := true
+		job.Spec.Suspend = &suspend
+		err = r.Update(ctx, job)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: cancelRequeue}, r.updateCancellation(ctx, set, api.CancelStopping)
+	}
+
+	// Wait for the pods to flush results and terminate
+	pods := &corev1.PodList{}
+	err = r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{mctrl.MetricSetLabel: set.Name},
+	)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !isJobFinished(job) {
+		for _, pod := range pods.Items {
+			if pod.Status.Phase == corev1.PodPending || pod.Status.Phase == corev1.PodRunning {
+				return ctrl.Result{RequeueAfter: cancelRequeue}, nil
+			}
+		}
+	}
+
+	logger.Info("🛑️ MetricSet pods stopped, deleting Job", "Name", job.Name)
+	err = r.Delete(ctx, job, client.PropagationPolicy("Background"))
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	err = r.deletePerfTuning(ctx, set)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.updateCancellation(ctx, set, api.CancelCancelled)
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGetJobState(t *testing.T) {
+	suspend := true
+	for _, tc := range []struct {
+		job      batchv1.Job
+		expected string
+	}{
+		{job: batchv1.Job{}, expected: "active"},
+		{job: batchv1.Job{Spec: batchv1.JobSpec{Suspend: &suspend}}, expected: "queued"},
+		{
+			job: batchv1.Job{Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+			}}},
+			expected: "completed",
+		},
+		{
+			job: batchv1.Job{Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionFalse},
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue},
+			}}},
+			expected: "failed",
+		},
+	} {
+		state := getJobState(&tc.job)
+		if state != tc.expected {
+			t.Errorf("expected %s, found %s", tc.expected, state)
+		}
+		if isJobFinished(&tc.job) != (tc.expected == "completed" || tc.expected == "failed") {
+			t.Errorf("expected a %s Job to be finished only if it completed or failed", state)
+		}
+	}
+}
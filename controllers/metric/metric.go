@@ -15,6 +15,7 @@ import (
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 )
 
@@ -25,6 +26,16 @@ func (r *MetricSetReconciler) ensureMetricSet(
 	set *mctrl.MetricSet,
 ) (ctrl.Result, error) {
 
+	// The Job backend runs the pods with a Job instead of a JobSet
+	if spec.UsesJobs() {
+		return r.ensureJob(ctx, spec, set)
+	}
+
+	// A sharded MetricSet has a JobSet (and service) for each shard
+	if spec.IsSharded() {
+		return r.ensureShards(ctx, spec, set)
+	}
+
 	// Ensure we create the JobSet for the MetricSet
 	// We get back container specs to use for generating configmaps
 	// This doesn't actually create the jobset
@@ -35,28 +46,154 @@ func (r *MetricSetReconciler) ensureMetricSet(
 
 	// Now create config maps...
 	// The config maps need to exist before the jobsets, etc.
-	_, result, err = r.ensureConfigMaps(ctx, spec, set, cs)
+	result, err = r.ensureConfigMaps(ctx, spec, spec, cs)
 	if err != nil {
 		return result, err
 	}
 
 	// And finally, the jobset
 	if !exists {
+
+		// Shared scratch also needs to exist before the jobset
+		result, err = r.ensureScratch(ctx, spec)
+		if err != nil {
+			return result, err
+		}
+
+		// As does the certificate secret (or Certificate) for the tls addon
+		result, err = r.ensureTLS(ctx, spec)
+		if err != nil {
+			return result, err
+		}
+
+		// The disruption budget covers the pods as soon as they are created
+		result, err = r.ensureDisruptionBudget(ctx, spec)
+		if err != nil {
+			return result, err
+		}
+
+		// And perf_event_paranoid is set on the nodes before perf addons start
+		result, err = r.ensurePerfTuning(ctx, spec)
+		if err != nil {
+			return result, err
+		}
+
+		// As does the PodGroup, so the scheduler sees the whole gang at once
+		result, err = r.ensurePodGroup(ctx, spec, js)
+		if err != nil {
+			return result, err
+		}
+		// Record what we are about to create, so results can be traced to it
+		err = r.recordRendered(ctx, spec, set, js, cs)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 		err = r.createJobSet(ctx, spec, js)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
+	} else {
+
+		// An existing JobSet (e.g., after an operator restart or upgrade) is verified
+		// to be ours, and adopted if it was orphaned
+		if r.AdoptJobSets {
+			result, err = r.adoptJobSet(ctx, spec, js)
+			if err != nil || result.RequeueAfter > 0 {
+				return result, err
+			}
+		}
+
+		// Scratch is cleaned up when the run is finished
+		err = r.cleanupScratch(ctx, spec, isFinished(js))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// And so is the disruption budget, so nodes can drain again
+		err = r.cleanupDisruptionBudget(ctx, spec, isFinished(js))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// The node setting for perf events is restored
+		err = r.cleanupPerfTuning(ctx, spec, isFinished(js))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Record the nodes (and instance types) the pods run on, if requested
+	nodesResult, err := r.updateNodeStatus(ctx, spec)
+	if err != nil {
+		return nodesResult, err
+	}
+
+	// And the placement achieved for metrics that request one
+	err = r.updatePlacementStatus(ctx, spec)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// In debug mode, report the pods waiting to be released (more often)
+	debugResult, err := r.updateDebugStatus(ctx, spec, js)
+	if err != nil {
+		return debugResult, err
+	}
+	if debugResult.RequeueAfter > 0 {
+		nodesResult = debugResult
+	}
+
+	// With InOrder startup, the launcher starts when the other pods are ready
+	startupResult, err := r.releaseStartup(ctx, spec, js)
+	if err != nil {
+		return startupResult, err
+	}
+	if startupResult.RequeueAfter > 0 {
+		nodesResult = startupResult
+	}
+
+	// When the run is finished, we can estimate the cost. Metrics that
+	// reached their timeout are marked while the others finish.
+	if exists {
+		err = r.updateCostStatus(ctx, spec, js)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// Container specs are only returned for a new JobSet, and they are
+		// deterministic, so we generate them again to map containers to metrics
+		_, cs, err = mctrl.GetJobSet(spec, set)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.updateMetricStatus(ctx, spec, cs)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.updateFailureStatus(ctx, spec)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.updateAcceptanceStatus(ctx, spec, js, cs)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		err = r.updateProfileStatus(ctx, spec, js, cs)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
 	// Create headless service for the metrics set (which is a JobSet)
 	// If we create > 1 JobSet, this should be updated
 	selector := map[string]string{"metricset-name": spec.Name}
-	result, err = r.exposeServices(ctx, spec, selector)
+	result, err = r.exposeServices(ctx, spec, spec.Subdomain(), selector)
 	if err != nil {
 		return result, err
 	}
 
-	return ctrl.Result{}, nil
+	// We check again for pods that are not on a node yet (or waiting in debug mode)
+	return nodesResult, nil
 }
 
 // getExistingJob gets an existing job that matches our CRD
@@ -83,16 +220,23 @@ func (r *MetricSetReconciler) getJobSet(
 	spec *api.MetricSet,
 	set *mctrl.MetricSet,
 ) (*jobset.JobSet, []*specs.ContainerSpec, ctrl.Result, bool, error) {
+	logger := log.FromContext(ctx)
 
-	// Look for an existing job
+	// Look for an existing job, or one labeled for the set (e.g., from another version)
 	js, err := r.getExistingJob(ctx, spec)
+	if err != nil && r.AdoptJobSets {
+		found, findErr := r.findJobSet(ctx, spec)
+		if findErr == nil {
+			js, err = found, nil
+		}
+	}
 	cs := []*specs.ContainerSpec{}
 
 	// Create a new job if it does not exist
 	if err != nil {
 
 		// TODO test checking for is not found error
-		r.Log.Info(
+		logger.Info(
 			"✨ Creating a new Metrics JobSet ✨",
 			"Namespace:", spec.Namespace,
 			"Name:", spec.Name,
@@ -105,7 +249,7 @@ func (r *MetricSetReconciler) getJobSet(
 		return js, cs, ctrl.Result{}, false, err
 
 	}
-	r.Log.Info(
+	logger.V(1).Info(
 		"🎉 Found existing Metrics JobSet 🎉",
 		"Namespace:", js.Namespace,
 		"Name:", js.Name,
@@ -119,7 +263,8 @@ func (r *MetricSetReconciler) createJobSet(
 	spec *api.MetricSet,
 	js *jobset.JobSet,
 ) error {
-	r.Log.Info(
+	logger := log.FromContext(ctx)
+	logger.Info(
 		"🎉 Creating Metrics JobSet 🎉",
 		"Namespace:", js.Namespace,
 		"Name:", js.Name,
@@ -129,7 +274,8 @@ func (r *MetricSetReconciler) createJobSet(
 	ctrl.SetControllerReference(spec, js, r.Scheme)
 	err := r.Client.Create(ctx, js)
 	if err != nil {
-		r.Log.Error(
+		jobsetCreateErrors.Inc()
+		logger.Error(
 			err,
 			"Failed to create new Metrics JobSet",
 			"Namespace:", js.Namespace,
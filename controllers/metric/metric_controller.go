@@ -9,20 +9,27 @@ package controllers
 
 import (
 	"context"
-	"fmt"
+	goerrors "errors"
+	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/cri-api/pkg/errors"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/config"
+	"github.com/converged-computing/metrics-operator/pkg/logging"
 	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/go-logr/logr"
 )
@@ -34,6 +41,19 @@ type MetricSetReconciler struct {
 	Log        logr.Logger
 	RESTClient rest.Interface
 	RESTConfig *rest.Config
+
+	// Adopt existing JobSets for a MetricSet that are orphaned (no controller)
+	AdoptJobSets bool
+
+	// Discovery for the preflight of cluster capabilities (nil skips it)
+	Discovery    discovery.DiscoveryInterface
+	capabilities capabilityCache
+
+	// Events (e.g., a degraded node of a canary) are not recorded if nil
+	Recorder record.EventRecorder
+
+	// The JobSet API is not installed, so MetricSets without a backend use a Job
+	jobSetMissing bool
 }
 
 //+kubebuilder:rbac:groups=flux-framework.org,resources=metricsets,verbs=get;list;watch;create;update;patch;delete
@@ -50,6 +70,7 @@ type MetricSetReconciler struct {
 //+kubebuilder:rbac:groups=core,resources=pods/log,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=pods/exec,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;patch
 //+kubebuilder:rbac:groups=core,resources=persistentvolumes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=jobs,verbs=get;list;watch;create;update;patch;delete
@@ -59,10 +80,16 @@ type MetricSetReconciler struct {
 //+kubebuilder:rbac:groups=core,resources=networks,verbs=create;patch
 //+kubebuilder:rbac:groups=core,resources="services",verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources="ingresses",verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=scheduling.x-k8s.io,resources=podgroups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=scheduling.volcano.sh,resources=podgroups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
 
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;watch;update
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete;exec
 //+kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get;list;watch;create;update;patch;delete;exec
+//+kubebuilder:rbac:urls=/metrics,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -74,14 +101,38 @@ type MetricSetReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.1/pkg/reconcile
 func (r *MetricSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	start := time.Now()
+
+	// Package loggers (e.g., for generating the JobSet) share the MetricSet and reconcile ID
+	logging.SetReconcile(req.Namespace, req.Name, string(controller.ReconcileIDFromContext(ctx)))
+	defer logging.ClearReconcile()
+	result, err := r.reconcile(ctx, req)
+
+	// Record the duration for monitoring the operator
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	reconcileDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	r.recordState(ctx, req.NamespacedName)
+	return result, err
+}
+
+// reconcile does the work of Reconcile
+func (r *MetricSetReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
 
 	// Create a new MetricSet
 	var spec api.MetricSet
 
 	// Keep developer informed what is going on.
-	r.Log.Info("🧀️ Event received by Metric controller!")
-	r.Log.Info("Request: ", "req", req)
+	logger.V(1).Info("🧀️ Event received by Metric controller!")
+
+	// The operator configuration can limit the namespaces that are reconciled
+	if !config.WatchesNamespace(req.Namespace) {
+		logger.V(1).Info("🟧️ Namespace is not watched by the operator configuration, ignoring.")
+		return ctrl.Result{}, nil
+	}
 
 	// Does the metric exist yet (based on name and namespace)
 	err := r.Get(ctx, req.NamespacedName, &spec)
@@ -89,32 +140,85 @@ func (r *MetricSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 
 		// Create it, doesn't exist yet
 		if errors.IsNotFound(err) {
-			r.Log.Info("🟥️ MetricSet not found. Ignoring since object must be deleted.")
+			logger.Info("🟥️ MetricSet not found. Ignoring since object must be deleted.")
 
 			// This should not be necessary, but the config map isn't owned by the operator
 			return ctrl.Result{}, nil
 		}
-		r.Log.Info("🟥️ Failed to get MetricSet. Re-running reconcile.")
+		logger.Info("🟥️ Failed to get MetricSet. Re-running reconcile.")
 		return ctrl.Result{Requeue: true}, err
 	}
 
+	// A MetricSet of a campaign waits for the campaign to start it
+	if spec.CampaignHeld() {
+		logger.Info("🗂️ MetricSet is waiting for its campaign to start it", "Campaign", spec.Labels[api.CampaignLabel])
+		return ctrl.Result{}, nil
+	}
+
+	// Without JobSet, a MetricSet that does not choose a backend uses a Job.
+	// This is for the reconcile, and is not written to the spec.
+	if spec.Spec.Backend == "" && r.jobSetMissing {
+		spec.Spec.Backend = api.JobBackend
+	}
+
 	// Show parameters provided and validate one flux runner
 	if !spec.Validate() {
-		r.Log.Info("🟥️ Your MetricSet config did not validate.")
+		logger.Info("🟥️ Your MetricSet config did not validate.")
+		validationRejections.WithLabelValues("spec").Inc()
 		return ctrl.Result{}, nil
 	}
 
+	// A cancelled run is stopped (keeping results), and nothing new is created
+	if spec.Spec.Cancel {
+		return r.reconcileCancel(ctx, &spec)
+	}
+
+	// The cluster needs to support what the MetricSet asks for
+	passed, result, err := r.preflight(ctx, &spec)
+	if !passed {
+		return result, err
+	}
+
+	// A canary creates a MetricSet for each run, on the next nodes in turn
+	if spec.Spec.Canary.Enabled() {
+		return r.reconcileCanary(ctx, &spec)
+	}
+
+	// An acceptance run is sized to the nodes of its pool
+	if spec.Spec.Acceptance.Enabled() {
+		result, err := r.ensureAcceptancePool(ctx, &spec)
+		if err != nil || result.RequeueAfter > 0 {
+			return result, err
+		}
+	}
+
+	// A scaling study creates a MetricSet for each pod count, in turn
+	if spec.Spec.Scaling.Enabled() {
+		return r.reconcileScaling(ctx, &spec)
+	}
+
 	// A MetricSet creates one or more JobSets (right now we just do 1)
 	set := mctrl.MetricSet{}
-	for _, metric := range spec.Spec.Metrics {
+	for _, metric := range spec.ExpandedMetrics() {
 
 		// Get the individual metric
-		r.Log.Info(fmt.Sprintf("🟦️ Looking for metric %s\n", metric.Name))
+		logger.V(1).Info("🟦️ Looking for metric", "Metric", metric.Name)
 		m, err := mctrl.GetMetric(&metric, &spec)
 		if err != nil {
-			r.Log.Error(err, fmt.Sprintf("🟥️ We had an issue loading that metric %s!", metric.Name))
+			logger.Error(err, "🟥️ We had an issue loading that metric!", "Metric", metric.Name)
+			validationRejections.WithLabelValues("metric").Inc()
 			return ctrl.Result{}, nil
 		}
+
+		// An acceptance run compares nodes, so each metric needs one pod per node
+		if spec.Spec.Acceptance.Enabled() {
+			jobs, err := m.ReplicatedJobs(&spec)
+			if err != nil || len(jobs) != 1 {
+				logger.Info("🟥️ Acceptance needs metrics with one replicated job (a pod on each node)", "Metric", metric.Name)
+				validationRejections.WithLabelValues("metric").Inc()
+				return ctrl.Result{}, nil
+			}
+		}
 		// Add the metric to the set
 		set.Add(&m)
 	}
@@ -122,35 +226,69 @@ func (r *MetricSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	// Ensure we have one or more metrics
 	count := len(set.Metrics())
 	if count == 0 {
-		r.Log.Info(fmt.Sprintf("🟥️ Metric set %s in namespace %s does not have any validated metrics.", spec.Name, spec.Namespace))
+		logger.Info("🟥️ Metric set does not have any validated metrics.")
 		return ctrl.Result{}, nil
 	}
-	r.Log.Info(fmt.Sprintf("🟦️ Metric set %s in namespace %s has %d metrics.", spec.Name, spec.Namespace, count))
+	logger.V(1).Info("🟦️ Metric set metrics", "Count", count)
 
 	// Ensure the metricset is mapped to a JobSet. For design:
 	// 1. If an application is provided, we pair the application at some scale with each metric as a contaienr
 	// 2. If storage or other addons are provided, we create the volumes for the metric containers
-	result, err := r.ensureMetricSet(ctx, &spec, &set)
+	result, err = r.ensureMetricSet(ctx, &spec, &set)
+	if goerrors.Is(err, mctrl.ErrEntrypointCollision) || goerrors.Is(err, mctrl.ErrEntrypointTooLarge) ||
+		goerrors.Is(err, mctrl.ErrEntrypointSyntax) {
+		logger.Error(err, "🟥️ Entrypoints for the MetricSet are not valid, it will not be created")
+		validationRejections.WithLabelValues("entrypoint").Inc()
+		if r.Recorder != nil {
+			r.Recorder.Event(&spec, corev1.EventTypeWarning, "InvalidEntrypoint", err.Error())
+		}
+		return ctrl.Result{}, nil
+	}
+	if goerrors.Is(err, mctrl.ErrBackend) {
+		logger.Error(err, "🟥️ Metrics cannot run with the backend of the MetricSet, it will not be created")
+		validationRejections.WithLabelValues("backend").Inc()
+		if r.Recorder != nil {
+			r.Recorder.Event(&spec, corev1.EventTypeWarning, "UnsupportedBackend", err.Error())
+		}
+		return ctrl.Result{}, nil
+	}
+	if goerrors.Is(err, mctrl.ErrSecurityProfile) {
+		logger.Error(err, "🟥️ MetricSet cannot run under its security profile, it will not be created")
+		validationRejections.WithLabelValues("securityProfile").Inc()
+		return ctrl.Result{}, nil
+	}
 	if err != nil {
-		r.Log.Error(err, "🟥️ Issue ensuring metric set")
+		logger.Error(err, "🟥️ Issue ensuring metric set")
 		return result, err
 	}
 
 	// By the time we get here we have a Job + pods + config maps!
 	// What else do we want to do?
-	r.Log.Info("🧀️ MetricSet is Ready!")
-	return ctrl.Result{Requeue: false}, nil
+	logger.V(1).Info("🧀️ MetricSet is Ready!")
+	return result, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *MetricSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+
+	// JobSets can only be watched if the API is installed
+	r.jobSetMissing = !hasJobSet(r.Discovery)
+	if r.jobSetMissing {
+		r.Log.Info("🟧️ The JobSet API is not installed, MetricSets without a backend will use a Job")
+	}
+	err := registerMonitoring(ctrlmetrics.Registry)
+	if err != nil {
+		return err
+	}
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&api.MetricSet{}).
 		Owns(&corev1.Secret{}).
 		Owns(&corev1.Service{}).
 		Owns(&corev1.Pod{}).
 		Owns(&corev1.ConfigMap{}).
-		Owns(&batchv1.Job{}).
-		Owns(&jobset.JobSet{}).
-		Complete(r)
+		Owns(&batchv1.Job{})
+	if !r.jobSetMissing {
+		builder = builder.Owns(&jobset.JobSet{})
+	}
+	return builder.Complete(r)
 }
@@ -0,0 +1,258 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// Prometheus metrics about the operator itself, served alongside the
+// controller-runtime metrics on the metrics bind address
+
+var (
+	reconcileDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "metrics_operator_reconcile_duration_seconds",
+			Help:    "Duration of MetricSet reconciles in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"result"},
+	)
+	jobsetCreateErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "metrics_operator_jobset_create_errors_total",
+			Help: "Number of errors creating JobSets for MetricSets",
+		},
+	)
+	validationRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "metrics_operator_validation_rejections_total",
+			Help: "Number of MetricSets rejected because the spec or a metric did not validate, or entrypoints collided",
+		},
+		[]string{"reason"},
+	)
+	canaryValues = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "metrics_operator_canary_value",
+			Help: "Last value a node reported in a canary run",
+		},
+		[]string{"namespace", "metricset", "node", "value"},
+	)
+	canaryDegraded = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "metrics_operator_canary_degraded",
+			Help: "Whether a node was degraded (1) or not (0) in its last canary run",
+		},
+		[]string{"namespace", "metricset", "node"},
+	)
+	metricSetsDesc = prometheus.NewDesc(
+		"metrics_operator_metricsets",
+		"Number of MetricSets by metric family and state (active, queued, completed, failed)",
+		[]string{"family", "state"},
+		nil,
+	)
+)
+
+// metricSetStates is the state and metric families of each MetricSet, as of its
+// last reconcile. The collector counts them, so a scrape does not list anything.
+var metricSetStates = &stateTracker{sets: map[types.NamespacedName]trackedState{}}
+
+// trackedState is the state of a MetricSet, and the families of its metrics
+type trackedState struct {
+	state    string
+	families []string
+}
+
+// stateTracker holds the tracked state of MetricSets across reconciles
+type stateTracker struct {
+	mutex sync.Mutex
+	sets  map[types.NamespacedName]trackedState
+}
+
+// set the state of a MetricSet, or forget it if the state is empty
+func (s *stateTracker) set(name types.NamespacedName, state string, families []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if state == "" {
+		delete(s.sets, name)
+		return
+	}
+	s.sets[name] = trackedState{state: state, families: families}
+}
+
+// counts of MetricSets by family and state
+func (s *stateTracker) counts() map[string]map[string]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	counts := map[string]map[string]int{}
+	for _, tracked := range s.sets {
+		for _, family := range tracked.families {
+			if _, ok := counts[family]; !ok {
+				counts[family] = map[string]int{}
+			}
+			counts[family][tracked.state]++
+		}
+	}
+	return counts
+}
+
+// metricSetCollector counts MetricSets by family and state when scraped
+type metricSetCollector struct{}
+
+func (c *metricSetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricSetsDesc
+}
+
+// Collect reports the states recorded by reconciles
+func (c *metricSetCollector) Collect(ch chan<- prometheus.Metric) {
+	for family, states := range metricSetStates.counts() {
+		for state, count := range states {
+			ch <- prometheus.MustNewConstMetric(metricSetsDesc, prometheus.GaugeValue, float64(count), family, state)
+		}
+	}
+}
+
+// recordState updates the tracked state of a MetricSet after a reconcile, from
+// the cache of the client. A deleted MetricSet, or one without a JobSet (or Job)
+// yet, is not counted. If the state cannot be read, the last one is kept.
+func (r *MetricSetReconciler) recordState(ctx context.Context, name types.NamespacedName) {
+	set := &api.MetricSet{}
+	err := r.Get(ctx, name, set)
+	if errors.IsNotFound(err) {
+		metricSetStates.set(name, "", nil)
+		return
+	}
+	if err != nil {
+		return
+	}
+	state, err := getState(ctx, r.Client, set, r.jobSetMissing)
+	if err != nil {
+		return
+	}
+
+	// Count each family once per MetricSet
+	families := []string{}
+	seen := map[string]bool{}
+	for _, metric := range set.Spec.Metrics {
+		family := "unknown"
+		if m, ok := mctrl.Registry[metric.Name]; ok {
+			family = m.Family()
+		}
+		if !seen[family] {
+			seen[family] = true
+			families = append(families, family)
+		}
+	}
+	metricSetStates.set(name, state, families)
+}
+
+// getState of a MetricSet based on its JobSet (or Job), which is empty if it
+// does not exist
+func getState(ctx context.Context, c client.Client, set *api.MetricSet, jobSetMissing bool) (string, error) {
+	if set.CampaignHeld() {
+		return "queued", nil
+	}
+	if set.IsSharded() {
+		return getShardedState(set), nil
+	}
+	if set.UsesJobs() || (set.Spec.Backend == "" && jobSetMissing) {
+		job, err := getMetricSetJob(ctx, c, set)
+		if err != nil || job == nil {
+			return "", err
+		}
+		return getJobState(job), nil
+	}
+	js := &jobset.JobSet{}
+	err := c.Get(ctx, types.NamespacedName{Name: set.Name, Namespace: set.Namespace}, js)
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return getJobSetState(js), nil
+}
+
+// getJobSetState returns completed, failed, queued (suspended, e.g., waiting
+// for admission by Kueue), or active
+func getJobSetState(js *jobset.JobSet) string {
+	for _, condition := range js.Status.Conditions {
+		if condition.Status != metav1.ConditionTrue {
+			continue
+		}
+		if condition.Type == string(jobset.JobSetCompleted) {
+			return "completed"
+		}
+		if condition.Type == string(jobset.JobSetFailed) {
+			return "failed"
+		}
+	}
+	if js.Spec.Suspend != nil && *js.Spec.Suspend {
+		return "queued"
+	}
+	return "active"
+}
+
+// getShardedState of a sharded MetricSet from the states of its shards: failed
+// if one failed, completed when all completed, and otherwise the earliest state
+func getShardedState(set *api.MetricSet) string {
+	if len(set.Status.Shards) < int(set.Spec.Shards) {
+		return "active"
+	}
+	counts := map[string]int{}
+	for _, shard := range set.Status.Shards {
+		counts[shard.State]++
+	}
+	switch {
+	case counts["failed"] > 0:
+		return "failed"
+	case counts["completed"] == len(set.Status.Shards):
+		return "completed"
+	case counts["queued"] == len(set.Status.Shards):
+		return "queued"
+	}
+	return "active"
+}
+
+// isFinished determines if the JobSet is completed or failed
+func isFinished(js *jobset.JobSet) bool {
+	state := getJobSetState(js)
+	return state == "completed" || state == "failed"
+}
+
+// registerMonitoring adds the operator metrics to a registry (the controller-runtime
+// registry for the manager). Setting up again (e.g., a second manager in tests) is
+// not an error.
+func registerMonitoring(registry prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		reconcileDuration,
+		jobsetCreateErrors,
+		validationRejections,
+		canaryValues,
+		canaryDegraded,
+		&metricSetCollector{},
+	}
+	for _, collector := range collectors {
+		err := registry.Register(collector)
+		if _, ok := err.(prometheus.AlreadyRegisteredError); err != nil && !ok {
+			return err
+		}
+	}
+	return nil
+}
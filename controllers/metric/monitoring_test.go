@@ -0,0 +1,92 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestRegisterMonitoring(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	err := registerMonitoring(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Setting up again (e.g., with a second manager) does not panic or fail
+	err = registerMonitoring(registry)
+	if err != nil {
+		t.Fatalf("expected registering again to not fail: %s", err)
+	}
+	if !registry.Unregister(&metricSetCollector{}) {
+		t.Errorf("expected the MetricSet collector to be registered")
+	}
+	if !registry.Unregister(canaryDegraded) {
+		t.Errorf("expected the canary gauges to be registered")
+	}
+
+	// A different metric with the same name is still an error
+	conflict := prometheus.NewRegistry()
+	conflict.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "metrics_operator_jobset_create_errors_total",
+		Help: "Something else",
+	}))
+	err = registerMonitoring(conflict)
+	if err == nil {
+		t.Errorf("expected a conflicting metric to fail registration")
+	}
+}
+
+func TestRecordState(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{api.AddToScheme, jobset.AddToScheme} {
+		err := add(scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta := metav1.ObjectMeta{Name: "io", Namespace: "default"}
+	set := &api.MetricSet{ObjectMeta: meta}
+	set.Spec.Metrics = []api.Metric{{Name: "io-fio"}, {Name: "io-fio"}}
+	name := types.NamespacedName{Name: "io", Namespace: "default"}
+	ctx := context.Background()
+	defer metricSetStates.set(name, "", nil)
+
+	// Without a JobSet (e.g., it was rejected), the MetricSet is not counted
+	r := &MetricSetReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(set).Build()}
+	r.recordState(ctx, name)
+	if counts := metricSetStates.counts(); len(counts) != 0 {
+		t.Errorf("expected a MetricSet without a JobSet to not be counted, found %v", counts)
+	}
+
+	// With one, it is counted once for each family
+	js := &jobset.JobSet{ObjectMeta: meta}
+	js.Status.Conditions = []metav1.Condition{{Type: string(jobset.JobSetCompleted), Status: metav1.ConditionTrue}}
+	r.Client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(set, js).Build()
+	r.recordState(ctx, name)
+	counts := metricSetStates.counts()
+	if len(counts) != 1 || len(counts["unknown"]) != 1 || counts["unknown"]["completed"] != 1 {
+		t.Errorf("expected one completed MetricSet, found %v", counts)
+	}
+
+	// A deleted MetricSet is forgotten
+	r.Client = fake.NewClientBuilder().WithScheme(scheme).Build()
+	r.recordState(ctx, name)
+	if counts := metricSetStates.counts(); len(counts) != 0 {
+		t.Errorf("expected a deleted MetricSet to not be counted, found %v", counts)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// How often to check again for pods that are not scheduled yet
+var nodeStatusRequeue = 30 * time.Second
+
+// updateNodeStatus records the nodes the pods were placed on (and their instance
+// types) in the MetricSet status, so results can be compared across hardware
+func (r *MetricSetReconciler) updateNodeStatus(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !set.RecordsNodes() {
+		return ctrl.Result{}, nil
+	}
+	pods := &corev1.PodList{}
+	err := r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{"metricset-name": set.Name},
+	)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Nodes already recorded are kept, since pods can be cleaned up after the run
+	nodes := map[string]*api.NodeStatus{}
+	for i := range set.Status.Nodes {
+		node := set.Status.Nodes[i].DeepCopy()
+		nodes[node.Name] = node
+	}
+	pending := false
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" {
+			pending = true
+			continue
+		}
+		status, ok := nodes[pod.Spec.NodeName]
+		if !ok {
+			status, err = r.getNodeStatus(ctx, pod.Spec.NodeName)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			nodes[status.Name] = status
+		}
+		if !containsString(status.Pods, pod.Name) {
+			status.Pods = append(status.Pods, pod.Name)
+			sort.Strings(status.Pods)
+		}
+	}
+
+	// Sort by name so the status only changes when the nodes do
+	updated := []api.NodeStatus{}
+	for _, node := range nodes {
+		updated = append(updated, *node)
+	}
+	sort.Slice(updated, func(i, j int) bool { return updated[i].Name < updated[j].Name })
+
+	if len(updated) > 0 && !reflect.DeepEqual(updated, set.Status.Nodes) {
+		set.Status.Nodes = updated
+		logger.Info("🖥️ Updating MetricSet nodes", "Name", set.Name, "Nodes", len(updated))
+		err = r.Status().Update(ctx, set)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if pending {
+		return ctrl.Result{RequeueAfter: nodeStatusRequeue}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// getNodeStatus looks up the instance type (and Karpenter labels) and topology of a node
+func (r *MetricSetReconciler) getNodeStatus(ctx context.Context, name string) (*api.NodeStatus, error) {
+	status := &api.NodeStatus{Name: name, Pods: []string{}}
+	node := &corev1.Node{}
+	err := r.Get(ctx, types.NamespacedName{Name: name}, node)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return status, nil
+		}
+		return status, err
+	}
+	status.InstanceType = node.Labels[mctrl.InstanceTypeLabel]
+	status.NodePool = node.Labels[mctrl.NodePoolLabel]
+	status.CapacityType = node.Labels[mctrl.CapacityTypeLabel]
+	status.Zone = node.Labels[mctrl.ZoneLabel]
+	status.Region = node.Labels[mctrl.RegionLabel]
+	return status, nil
+}
+
+// containsString determines if a list of strings includes one
+func containsString(items []string, item string) bool {
+	for _, existing := range items {
+		if existing == item {
+			return true
+		}
+	}
+	return false
+}
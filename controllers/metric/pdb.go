@@ -0,0 +1,97 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+// ensureDisruptionBudget creates a pod disruption budget for the MetricSet pods, if requested
+func (r *MetricSetReconciler) ensureDisruptionBudget(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !set.Spec.DisruptionBudget {
+		return ctrl.Result{}, nil
+	}
+	existing := &policyv1.PodDisruptionBudget{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.DisruptionBudgetName(), Namespace: set.Namespace}, existing)
+	if err == nil {
+		return ctrl.Result{}, nil
+	}
+	if !errors.IsNotFound(err) {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	// No pod can be voluntarily evicted while the run is active
+	maxUnavailable := intstr.FromInt(0)
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      set.DisruptionBudgetName(),
+			Namespace: set.Namespace,
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"metricset-name": set.Name},
+			},
+		},
+	}
+	logger.Info(
+		"✨ Creating MetricSet pod disruption budget ✨",
+		"Namespace", pdb.Namespace,
+		"Name", pdb.Name,
+	)
+
+	// The owner reference ensures the budget is deleted with the MetricSet
+	ctrl.SetControllerReference(set, pdb, r.Scheme)
+	err = r.Create(ctx, pdb)
+	if err != nil {
+		logger.Error(err, "🟥️ Failed to create MetricSet pod disruption budget", "Name", pdb.Name)
+	}
+	return ctrl.Result{}, err
+}
+
+// cleanupDisruptionBudget deletes the pod disruption budget when the run has finished
+func (r *MetricSetReconciler) cleanupDisruptionBudget(
+	ctx context.Context,
+	set *api.MetricSet,
+	finished bool,
+) error {
+	logger := log.FromContext(ctx)
+
+	if !set.Spec.DisruptionBudget || !finished {
+		return nil
+	}
+	existing := &policyv1.PodDisruptionBudget{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.DisruptionBudgetName(), Namespace: set.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	logger.Info("🧹️ Run finished, deleting pod disruption budget", "Name", existing.Name)
+	err = r.Delete(ctx, existing)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
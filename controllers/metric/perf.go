@@ -0,0 +1,150 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+// Label for the perf tuning DaemonSet, with the name of the MetricSet
+var perfTuningLabel = "metricset-perf-tuning"
+
+// perfTuningScript sets perf_event_paranoid, and restores the original value when
+// the pod is deleted (SIGTERM), so the node is only changed for the run
+var perfTuningScript = `
+paranoid=/proc/sys/kernel/perf_event_paranoid
+original=$(cat ${paranoid})
+restore() {
+    echo "Restoring perf_event_paranoid to ${original}"
+    echo "${original}" > ${paranoid}
+    exit 0
+}
+trap restore TERM INT
+echo "Setting perf_event_paranoid from ${original} to %d"
+echo "%d" > ${paranoid} || exit 1
+while true; do sleep 3600 & wait $!; done
+`
+
+// getPerfTuningDaemonSet returns a privileged DaemonSet to set perf_event_paranoid
+// on the nodes the MetricSet pods can be scheduled to
+func getPerfTuningDaemonSet(set *api.MetricSet) *appsv1.DaemonSet {
+	privileged := true
+	grace := int64(30)
+	labels := map[string]string{perfTuningLabel: set.Name}
+	script := fmt.Sprintf(perfTuningScript, set.Spec.PerfEvents.Paranoid, set.Spec.PerfEvents.Paranoid)
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      set.PerfTuningName(),
+			Namespace: set.PerfTuningNamespace(),
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					NodeSelector:                  set.Spec.Pod.NodeSelector,
+					TerminationGracePeriodSeconds: &grace,
+					Tolerations:                   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					Containers: []corev1.Container{{
+						Name:            "perf-tuning",
+						Image:           set.Spec.PerfEvents.Image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Command:         []string{"/bin/sh", "-c", script},
+						SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// ensurePerfTuning creates the perf tuning DaemonSet, if requested
+func (r *MetricSetReconciler) ensurePerfTuning(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !set.Spec.PerfEvents.Enabled() {
+		return ctrl.Result{}, nil
+	}
+	existing := &appsv1.DaemonSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.PerfTuningName(), Namespace: set.PerfTuningNamespace()}, existing)
+	if err == nil {
+		return ctrl.Result{}, nil
+	}
+	if !errors.IsNotFound(err) {
+		return ctrl.Result{Requeue: true}, err
+	}
+	ds := getPerfTuningDaemonSet(set)
+	logger.Info(
+		"✨ Creating MetricSet perf tuning DaemonSet ✨",
+		"Namespace", ds.Namespace,
+		"Name", ds.Name,
+		"Paranoid", set.Spec.PerfEvents.Paranoid,
+	)
+
+	// An owner reference can only be in the same namespace, otherwise the
+	// DaemonSet is deleted when the run is finished
+	if ds.Namespace == set.Namespace {
+		ctrl.SetControllerReference(set, ds, r.Scheme)
+	}
+	err = r.Create(ctx, ds)
+	if err != nil {
+		logger.Error(err, "🟥️ Failed to create MetricSet perf tuning DaemonSet", "Name", ds.Name)
+	}
+	return ctrl.Result{}, err
+}
+
+// cleanupPerfTuning deletes the perf tuning DaemonSet when the run has finished,
+// which restores perf_event_paranoid on the nodes
+func (r *MetricSetReconciler) cleanupPerfTuning(
+	ctx context.Context,
+	set *api.MetricSet,
+	finished bool,
+) error {
+	if !finished {
+		return nil
+	}
+	return r.deletePerfTuning(ctx, set)
+}
+
+// deletePerfTuning deletes the perf tuning DaemonSet, if there is one
+func (r *MetricSetReconciler) deletePerfTuning(ctx context.Context, set *api.MetricSet) error {
+	logger := log.FromContext(ctx)
+
+	if !set.Spec.PerfEvents.Enabled() {
+		return nil
+	}
+	existing := &appsv1.DaemonSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.PerfTuningName(), Namespace: set.PerfTuningNamespace()}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	logger.Info("🧹️ Deleting perf tuning DaemonSet", "Name", existing.Name)
+	err = r.Delete(ctx, existing)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
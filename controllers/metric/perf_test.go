@@ -0,0 +1,45 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetPerfTuningDaemonSet(t *testing.T) {
+	set := &api.MetricSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "perf", Namespace: "default"},
+		Spec: api.MetricSetSpec{
+			Pod:        api.Pod{NodeSelector: map[string]string{"node.kubernetes.io/instance-type": "c7a.large"}},
+			PerfEvents: api.PerfEvents{Tune: true, Paranoid: 1, Namespace: "perf-tuning", Image: "busybox:stable"},
+		},
+	}
+	ds := getPerfTuningDaemonSet(set)
+	if ds.Name != "perf-perf-tuning" || ds.Namespace != "perf-tuning" {
+		t.Errorf("unexpected DaemonSet %s/%s", ds.Namespace, ds.Name)
+	}
+	pod := ds.Spec.Template.Spec
+	if pod.NodeSelector["node.kubernetes.io/instance-type"] != "c7a.large" {
+		t.Errorf("expected the node selector of the MetricSet, found %v", pod.NodeSelector)
+	}
+	container := pod.Containers[0]
+	if !*container.SecurityContext.Privileged {
+		t.Error("expected the tuning container to be privileged")
+	}
+	script := container.Command[2]
+	if !strings.Contains(script, `echo "1" > ${paranoid}`) || !strings.Contains(script, "trap restore TERM") {
+		t.Errorf("expected the script to set and restore perf_event_paranoid, found %s", script)
+	}
+	if ds.Labels[perfTuningLabel] != "perf" {
+		t.Errorf("expected the DaemonSet to be labeled with the MetricSet, found %v", ds.Labels)
+	}
+}
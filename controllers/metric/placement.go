@@ -0,0 +1,101 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// updatePlacementStatus records the placement the scheduler achieved for the
+// clients of each metric that requested one, from the nodes in the status
+func (r *MetricSetReconciler) updatePlacementStatus(
+	ctx context.Context,
+	set *api.MetricSet,
+) error {
+	logger := log.FromContext(ctx)
+
+	if !set.HasPlacement() {
+		return nil
+	}
+	pods := &corev1.PodList{}
+	err := r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{"metricset-name": set.Name},
+	)
+	if err != nil {
+		return err
+	}
+	updated := getPlacementStatus(set, pods.Items)
+	if reflect.DeepEqual(updated, set.Status.Placement) {
+		return nil
+	}
+	set.Status.Placement = updated
+	logger.Info("🗺️ Updating MetricSet placement", "Name", set.Name, "Placement", updated)
+	return r.Status().Update(ctx, set)
+}
+
+// getPlacementStatus compares the node of the server pod of each metric with
+// a placement to the nodes of its client pods. A placement already achieved
+// is kept, since pods can be cleaned up after the run.
+func getPlacementStatus(set *api.MetricSet, pods []corev1.Pod) []api.PlacementStatus {
+	nodes := map[string]api.NodeStatus{}
+	for _, node := range set.Status.Nodes {
+		nodes[node.Name] = node
+	}
+	achieved := map[string]string{}
+	for _, placement := range set.Status.Placement {
+		achieved[placement.Metric] = placement.Achieved
+	}
+
+	// Nodes of the server and clients, by metric
+	servers := map[string][]api.NodeStatus{}
+	clients := map[string][]api.NodeStatus{}
+	pending := map[string]bool{}
+	for _, pod := range pods {
+		metric := pod.Labels[mctrl.PlacementLabel]
+		if metric == "" {
+			continue
+		}
+		node, ok := nodes[pod.Spec.NodeName]
+		if !ok {
+			pending[metric] = true
+			continue
+		}
+		if pod.Labels[mctrl.PlacementRoleLabel] == mctrl.PlacementServer {
+			servers[metric] = append(servers[metric], node)
+		} else {
+			clients[metric] = append(clients[metric], node)
+		}
+	}
+
+	updated := []api.PlacementStatus{}
+	for _, metric := range set.ExpandedMetrics() {
+		if metric.Placement == "" {
+			continue
+		}
+		name := metric.Key()
+		status := api.PlacementStatus{Metric: name, Requested: metric.Placement, Achieved: achieved[name]}
+		if status.Achieved == "" && !pending[name] && len(servers[name]) == 1 && len(clients[name]) > 0 {
+			status.Achieved = mctrl.AchievedPlacement(servers[name][0], clients[name])
+		}
+		updated = append(updated, status)
+	}
+	sort.Slice(updated, func(i, j int) bool { return updated[i].Metric < updated[j].Metric })
+	return updated
+}
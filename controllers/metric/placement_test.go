@@ -0,0 +1,75 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+func TestGetPlacementStatus(t *testing.T) {
+	nodes := []api.NodeStatus{
+		{Name: "a", Zone: "us-east-1a", Region: "us-east-1"},
+		{Name: "b", Zone: "us-east-1a", Region: "us-east-1"},
+		{Name: "c", Zone: "us-east-1b", Region: "us-east-1"},
+		{Name: "d", Zone: "us-west-2a", Region: "us-west-2"},
+		{Name: "e"},
+	}
+	withPod := func(role, node string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+				mctrl.PlacementLabel:     "network-osu-benchmark",
+				mctrl.PlacementRoleLabel: role,
+			}},
+			Spec: corev1.PodSpec{NodeName: node},
+		}
+	}
+	tests := []struct {
+		name     string
+		pods     []corev1.Pod
+		achieved string
+	}{
+		{name: "no pods"},
+		{name: "client pending", pods: []corev1.Pod{withPod(mctrl.PlacementServer, "a"), withPod(mctrl.PlacementClient, "")}},
+		{name: "same node", pods: []corev1.Pod{withPod(mctrl.PlacementServer, "a"), withPod(mctrl.PlacementClient, "a")}, achieved: api.PlacementSameNode},
+		{name: "same zone", pods: []corev1.Pod{withPod(mctrl.PlacementServer, "a"), withPod(mctrl.PlacementClient, "a"), withPod(mctrl.PlacementClient, "b")}, achieved: api.PlacementSameZone},
+		{name: "cross zone", pods: []corev1.Pod{withPod(mctrl.PlacementServer, "a"), withPod(mctrl.PlacementClient, "c")}, achieved: api.PlacementCrossZone},
+		{name: "cross region", pods: []corev1.Pod{withPod(mctrl.PlacementServer, "a"), withPod(mctrl.PlacementClient, "c"), withPod(mctrl.PlacementClient, "d")}, achieved: api.PlacementCrossRegion},
+		{name: "unknown zone", pods: []corev1.Pod{withPod(mctrl.PlacementServer, "a"), withPod(mctrl.PlacementClient, "e")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set := &api.MetricSet{
+				Spec: api.MetricSetSpec{Metrics: []api.Metric{
+					{Name: "network-osu-benchmark", Placement: api.PlacementCrossZone},
+					{Name: "io-fio"},
+				}},
+				Status: api.MetricSetStatus{Nodes: nodes},
+			}
+			placement := getPlacementStatus(set, test.pods)
+			if len(placement) != 1 || placement[0].Requested != api.PlacementCrossZone {
+				t.Fatalf("expected the requested placement of one metric, found %v", placement)
+			}
+			if placement[0].Achieved != test.achieved {
+				t.Errorf("expected placement %q, found %q", test.achieved, placement[0].Achieved)
+			}
+
+			// An achieved placement is kept when the pods are cleaned up
+			set.Status.Placement = placement
+			kept := getPlacementStatus(set, []corev1.Pod{})
+			if kept[0].Achieved != test.achieved {
+				t.Errorf("expected placement %q to be kept, found %q", test.achieved, kept[0].Achieved)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// ensurePodGroup creates a PodGroup for gang scheduling the JobSet pods, if requested
+func (r *MetricSetReconciler) ensurePodGroup(
+	ctx context.Context,
+	set *api.MetricSet,
+	js *jobset.JobSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pg := mctrl.GetPodGroup(set, js)
+	if pg == nil {
+		return ctrl.Result{}, nil
+	}
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(pg.GroupVersionKind())
+	err := r.Get(ctx, types.NamespacedName{Name: pg.GetName(), Namespace: pg.GetNamespace()}, existing)
+	if err == nil {
+		return ctrl.Result{}, nil
+	}
+	if !errors.IsNotFound(err) {
+		logger.Error(err, "🟥️ Cannot get PodGroup, is the gang scheduler installed?", "Scheduler", set.Spec.GangScheduling.Scheduler)
+		return ctrl.Result{Requeue: true}, err
+	}
+	logger.Info(
+		"✨ Creating MetricSet PodGroup ✨",
+		"Namespace", pg.GetNamespace(),
+		"Name", pg.GetName(),
+		"Kind", pg.GroupVersionKind().String(),
+	)
+
+	// The owner reference ensures the PodGroup is deleted with the MetricSet
+	ctrl.SetControllerReference(set, pg, r.Scheme)
+	err = r.Create(ctx, pg)
+	if err != nil {
+		logger.Error(err, "🟥️ Failed to create MetricSet PodGroup", "Name", pg.GetName())
+	}
+	return ctrl.Result{}, err
+}
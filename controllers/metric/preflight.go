@@ -0,0 +1,250 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/addons"
+)
+
+// How long cluster capabilities are cached, so newly installed APIs are found
+var capabilitiesTTL = 5 * time.Minute
+
+// How often to check again for a MetricSet that failed the preflight
+var preflightRequeue = time.Minute
+
+// requirement is something a MetricSet needs of the cluster: a minimum
+// Kubernetes (minor) version, an API (group/version and kind), or a feature gate
+type requirement struct {
+	feature  string
+	minor    int
+	resource string
+	gate     string
+	hint     string
+}
+
+// clusterCapabilities are the version, APIs, and feature gates of the cluster.
+// Gates are read from the API server metrics, and are nil if we cannot read them.
+type clusterCapabilities struct {
+	minor     int
+	resources map[string]bool
+	gates     map[string]bool
+	checked   time.Time
+}
+
+// capabilityCache caches the capabilities across reconciles
+type capabilityCache struct {
+	sync.Mutex
+	capabilities *clusterCapabilities
+}
+
+// getRequirements returns what the features of a MetricSet need of the cluster
+func getRequirements(set *api.MetricSet) []requirement {
+	requirements := []requirement{}
+	if !set.UsesJobs() {
+		requirements = append(requirements, requirement{
+			feature:  "JobSet",
+			resource: "jobset.x-k8s.io/v1alpha2/JobSet",
+			hint:     "install JobSet (see the install instructions in the user guide), or use the Job backend",
+		})
+	}
+	if set.IsWindows() {
+		requirements = append(requirements, requirement{
+			feature: "pod.os",
+			minor:   25,
+			hint:    "Windows pods need Kubernetes 1.25 or later",
+		})
+	}
+	if set.Spec.Pod.UserNamespaces {
+		requirements = append(requirements, requirement{
+			feature: "pod.userNamespaces",
+			minor:   30,
+			gate:    "UserNamespacesSupport",
+			hint:    "enable the UserNamespacesSupport feature gate (Kubernetes 1.30 or later), or remove userNamespaces",
+		})
+	}
+	if set.StartsInOrder() {
+		requirements = append(requirements, requirement{
+			feature: "startupPolicy",
+			minor:   27,
+			gate:    "PodSchedulingReadiness",
+			hint:    "InOrder startup uses scheduling gates (Kubernetes 1.27 or later), or use AnyOrder",
+		})
+	}
+	switch set.Spec.GangScheduling.Scheduler {
+	case api.CoschedulingScheduler:
+		requirements = append(requirements, requirement{
+			feature:  "gangScheduling",
+			resource: "scheduling.x-k8s.io/v1alpha1/PodGroup",
+			hint:     "install the scheduler-plugins coscheduling plugin (and its PodGroup CRD)",
+		})
+	case api.VolcanoScheduler:
+		requirements = append(requirements, requirement{
+			feature:  "gangScheduling",
+			resource: "scheduling.volcano.sh/v1beta1/PodGroup",
+			hint:     "install Volcano (and its PodGroup CRD)",
+		})
+	}
+	for _, metric := range set.Spec.Metrics {
+		for _, a := range metric.Addons {
+			issuer, ok := a.Options["issuer"]
+			if a.Name == addons.TLSIdentifier && ok && issuer.StrVal != "" {
+				requirements = append(requirements, requirement{
+					feature:  "tls issuer",
+					resource: fmt.Sprintf("%s/%s/%s", addons.CertificateKind.Group, addons.CertificateKind.Version, addons.CertificateKind.Kind),
+					hint:     "install cert-manager, or remove the issuer to use a self-signed certificate",
+				})
+			}
+		}
+	}
+	return requirements
+}
+
+// checkRequirements returns a message for each requirement the cluster does not meet.
+// A feature gate is only checked if we could read the gates.
+func checkRequirements(requirements []requirement, capabilities *clusterCapabilities) []string {
+	messages := []string{}
+	for _, req := range requirements {
+		switch {
+		case req.minor > 0 && capabilities.minor > 0 && capabilities.minor < req.minor:
+			messages = append(messages, fmt.Sprintf("%s needs Kubernetes 1.%d, found 1.%d: %s", req.feature, req.minor, capabilities.minor, req.hint))
+		case req.resource != "" && !capabilities.resources[req.resource]:
+			messages = append(messages, fmt.Sprintf("%s needs the %s API: %s", req.feature, req.resource, req.hint))
+		case req.gate != "" && capabilities.gates != nil && !capabilities.gates[req.gate]:
+			messages = append(messages, fmt.Sprintf("%s needs the %s feature gate: %s", req.feature, req.gate, req.hint))
+		}
+	}
+	return messages
+}
+
+// The minor version can have a suffix, e.g., 27+
+var minorRegex = regexp.MustCompile(`^[0-9]+`)
+
+// Feature gates are reported by the API server, e.g., kubernetes_feature_enabled{name="X",stage="BETA"} 1
+var featureRegex = regexp.MustCompile(`^kubernetes_feature_enabled\{.*name="([^"]+)".*\} ([0-9])`)
+
+// parseFeatureGates parses the enabled feature gates from API server metrics
+func parseFeatureGates(metrics []byte) map[string]bool {
+	gates := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(metrics))
+	for scanner.Scan() {
+		match := featureRegex.FindStringSubmatch(scanner.Text())
+		if match != nil {
+			gates[match[1]] = match[2] == "1"
+		}
+	}
+	if len(gates) == 0 {
+		return nil
+	}
+	return gates
+}
+
+// getCapabilities discovers the version, APIs (for the requirements), and feature
+// gates of the cluster. APIs found are cached, and looked up again after the TTL.
+func (r *MetricSetReconciler) getCapabilities(
+	ctx context.Context,
+	requirements []requirement,
+) (*clusterCapabilities, error) {
+	r.capabilities.Lock()
+	defer r.capabilities.Unlock()
+
+	capabilities := r.capabilities.capabilities
+	if capabilities == nil || time.Since(capabilities.checked) > capabilitiesTTL {
+		version, err := r.Discovery.ServerVersion()
+		if err != nil {
+			return nil, err
+		}
+		minor, _ := strconv.Atoi(minorRegex.FindString(version.Minor))
+		capabilities = &clusterCapabilities{minor: minor, resources: map[string]bool{}, checked: time.Now()}
+
+		// Reading feature gates needs get on /metrics, so they are best effort
+		metrics, err := r.Discovery.RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+		if err == nil {
+			capabilities.gates = parseFeatureGates(metrics)
+		}
+		r.capabilities.capabilities = capabilities
+	}
+	for _, req := range requirements {
+		if req.resource == "" || capabilities.resources[req.resource] {
+			continue
+		}
+		groupVersion := req.resource[:strings.LastIndex(req.resource, "/")]
+		resources, err := r.Discovery.ServerResourcesForGroupVersion(groupVersion)
+		if err != nil || resources == nil {
+			continue
+		}
+		for _, resource := range resources.APIResources {
+			capabilities.resources[fmt.Sprintf("%s/%s", groupVersion, resource.Kind)] = true
+		}
+	}
+	return capabilities, nil
+}
+
+// preflight checks that the cluster has what the MetricSet needs, and records
+// the result in the Preflight condition. It returns false if the check failed.
+func (r *MetricSetReconciler) preflight(
+	ctx context.Context,
+	set *api.MetricSet,
+) (bool, ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// Without discovery (e.g., in tests) there is no preflight
+	if r.Discovery == nil {
+		return true, ctrl.Result{}, nil
+	}
+	requirements := getRequirements(set)
+	capabilities, err := r.getCapabilities(ctx, requirements)
+	if err != nil {
+		logger.Error(err, "🟥️ Cannot discover cluster capabilities for the preflight")
+		return false, ctrl.Result{}, err
+	}
+	condition := metav1.Condition{
+		Type:               api.PreflightCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             api.PreflightPassed,
+		Message:            "The cluster has the features the MetricSet needs",
+		ObservedGeneration: set.Generation,
+	}
+	messages := checkRequirements(requirements, capabilities)
+	if len(messages) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = api.PreflightUnsupported
+		condition.Message = strings.Join(messages, "; ")
+	}
+	existing := meta.FindStatusCondition(set.Status.Conditions, api.PreflightCondition)
+	if existing == nil || existing.Status != condition.Status || existing.Message != condition.Message {
+		if len(messages) > 0 {
+			validationRejections.WithLabelValues("preflight").Inc()
+		}
+		meta.SetStatusCondition(&set.Status.Conditions, condition)
+		err = r.Status().Update(ctx, set)
+		if err != nil {
+			return false, ctrl.Result{}, err
+		}
+	}
+	if len(messages) > 0 {
+		logger.Info("🟥️ MetricSet failed the preflight, it will not be created until the cluster supports it", "Name", set.Name, "Unsupported", messages)
+		return false, ctrl.Result{RequeueAfter: preflightRequeue}, nil
+	}
+	return true, ctrl.Result{}, nil
+}
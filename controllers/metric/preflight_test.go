@@ -0,0 +1,122 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+func TestGetRequirements(t *testing.T) {
+	set := &api.MetricSet{}
+	requirements := getRequirements(set)
+	if len(requirements) != 1 || requirements[0].feature != "JobSet" {
+		t.Fatalf("expected only the JobSet requirement, got %v", requirements)
+	}
+
+	set.Spec.Pod.UserNamespaces = true
+	set.Spec.StartupPolicy = api.InOrderStartup
+	set.Spec.GangScheduling.Scheduler = api.VolcanoScheduler
+	features := []string{}
+	for _, req := range getRequirements(set) {
+		features = append(features, req.feature)
+	}
+	expected := "JobSet,pod.userNamespaces,startupPolicy,gangScheduling"
+	if strings.Join(features, ",") != expected {
+		t.Errorf("expected %s, got %v", expected, features)
+	}
+
+	// The Job backend does not need JobSet
+	job := &api.MetricSet{}
+	job.Spec.Backend = api.JobBackend
+	requirements = getRequirements(job)
+	if len(requirements) != 0 {
+		t.Errorf("expected no requirements for the Job backend, got %v", requirements)
+	}
+}
+
+func TestCheckRequirements(t *testing.T) {
+	requirements := []requirement{
+		{feature: "JobSet", resource: "jobset.x-k8s.io/v1alpha2/JobSet"},
+		{feature: "startupPolicy", minor: 27, gate: "PodSchedulingReadiness"},
+	}
+	tests := []struct {
+		name         string
+		capabilities clusterCapabilities
+		expected     []string
+	}{
+		{
+			name: "supported",
+			capabilities: clusterCapabilities{
+				minor:     28,
+				resources: map[string]bool{"jobset.x-k8s.io/v1alpha2/JobSet": true},
+				gates:     map[string]bool{"PodSchedulingReadiness": true},
+			},
+		},
+		{
+			name: "version too old",
+			capabilities: clusterCapabilities{
+				minor:     26,
+				resources: map[string]bool{"jobset.x-k8s.io/v1alpha2/JobSet": true},
+			},
+			expected: []string{"startupPolicy needs Kubernetes 1.27"},
+		},
+		{
+			name:         "missing api",
+			capabilities: clusterCapabilities{minor: 28, resources: map[string]bool{}},
+			expected:     []string{"JobSet needs the jobset.x-k8s.io/v1alpha2/JobSet API"},
+		},
+		{
+			name: "gate disabled",
+			capabilities: clusterCapabilities{
+				minor:     28,
+				resources: map[string]bool{"jobset.x-k8s.io/v1alpha2/JobSet": true},
+				gates:     map[string]bool{"PodSchedulingReadiness": false},
+			},
+			expected: []string{"startupPolicy needs the PodSchedulingReadiness feature gate"},
+		},
+		{
+			name: "gates unknown",
+			capabilities: clusterCapabilities{
+				minor:     28,
+				resources: map[string]bool{"jobset.x-k8s.io/v1alpha2/JobSet": true},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messages := checkRequirements(requirements, &test.capabilities)
+			if len(messages) != len(test.expected) {
+				t.Fatalf("expected %d messages, got %v", len(test.expected), messages)
+			}
+			for i, message := range messages {
+				if !strings.HasPrefix(message, test.expected[i]) {
+					t.Errorf("expected message to start with %q, got %q", test.expected[i], message)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFeatureGates(t *testing.T) {
+	metrics := []byte(`# HELP kubernetes_feature_enabled [BETA] This metric records the data about the stage and enablement of a k8s feature.
+# TYPE kubernetes_feature_enabled gauge
+kubernetes_feature_enabled{name="PodSchedulingReadiness",stage="BETA"} 1
+kubernetes_feature_enabled{name="UserNamespacesSupport",stage="ALPHA"} 0
+apiserver_request_total{code="200"} 12
+`)
+	gates := parseFeatureGates(metrics)
+	if !gates["PodSchedulingReadiness"] || gates["UserNamespacesSupport"] || len(gates) != 2 {
+		t.Errorf("unexpected gates %v", gates)
+	}
+	if parseFeatureGates([]byte("apiserver_request_total 1\n")) != nil {
+		t.Errorf("expected nil gates when none are reported")
+	}
+}
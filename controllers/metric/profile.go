@@ -0,0 +1,174 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// metricRun is the span of the containers of a metric, from the first
+// starting to the last finishing
+type metricRun struct {
+	started  time.Time
+	finished time.Time
+	state    string
+}
+
+// updateProfileStatus records the runtime of each configuration in profile
+// mode when the run is finished, and recommends a configuration for each metric
+func (r *MetricSetReconciler) updateProfileStatus(
+	ctx context.Context,
+	set *api.MetricSet,
+	js *jobset.JobSet,
+	cs []*specs.ContainerSpec,
+) error {
+	logger := log.FromContext(ctx)
+
+	if !set.Spec.Profile.Enabled() || set.Status.Profile != nil || !isFinished(js) {
+		return nil
+	}
+
+	runs, err := r.getMetricRuns(ctx, set, cs)
+	if err != nil {
+		return err
+	}
+	set.Status.Profile = getProfileStatus(set, runs)
+	logger.Info("📏️ Profile finished", "Name", set.Name, "Recommendations", set.Status.Profile.Recommendations)
+	return r.Status().Update(ctx, set)
+}
+
+// getMetricRuns returns the span of the containers of each metric (by alias or name)
+func (r *MetricSetReconciler) getMetricRuns(
+	ctx context.Context,
+	set *api.MetricSet,
+	cs []*specs.ContainerSpec,
+) (map[string]*metricRun, error) {
+
+	// Metric containers (by replicated job and name) and their metric
+	metrics := map[string]string{}
+	for _, c := range cs {
+		if c.Metric != "" {
+			metrics[fmt.Sprintf("%s/%s", c.JobName, c.Name)] = c.Metric
+		}
+	}
+	pods := &corev1.PodList{}
+	err := r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{"metricset-name": set.Name},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := map[string]*metricRun{}
+	for _, pod := range pods.Items {
+		job := pod.Labels[jobset.ReplicatedJobNameKey]
+		for _, status := range pod.Status.ContainerStatuses {
+			metric, ok := metrics[fmt.Sprintf("%s/%s", job, status.Name)]
+			if !ok {
+				continue
+			}
+			run, ok := runs[metric]
+			if !ok {
+				run = &metricRun{}
+				runs[metric] = run
+			}
+			addContainerRun(run, status)
+		}
+	}
+	return runs, nil
+}
+
+// addContainerRun extends the span of a run with a terminated container
+func addContainerRun(run *metricRun, status corev1.ContainerStatus) {
+	terminated := status.State.Terminated
+	if terminated == nil {
+		run.state = "Unfinished"
+		return
+	}
+	if state := getTerminationState(status); state != "" {
+		run.state = state
+	} else if terminated.ExitCode != 0 && run.state == "" {
+		run.state = "Failed"
+	}
+	if run.started.IsZero() || terminated.StartedAt.Time.Before(run.started) {
+		run.started = terminated.StartedAt.Time
+	}
+	if terminated.FinishedAt.Time.After(run.finished) {
+		run.finished = terminated.FinishedAt.Time
+	}
+}
+
+// getRunSeconds returns the seconds of a run that finished normally, or its state
+func getRunSeconds(run *metricRun, ok bool) (float64, string) {
+	switch {
+	case !ok:
+		return 0, "NotFound"
+	case run.state != "":
+		return 0, run.state
+	case !run.finished.After(run.started):
+		return 0, "NotMeasured"
+	}
+	return run.finished.Sub(run.started).Seconds(), ""
+}
+
+// getProfileStatus compares the runs of each metric. Configurations are listed
+// from smallest to largest, so we recommend the first within the tolerance of the fastest.
+func getProfileStatus(set *api.MetricSet, runs map[string]*metricRun) *api.ProfileStatus {
+	profile := set.Spec.Profile
+	status := &api.ProfileStatus{Results: []api.ProfileResult{}}
+	for i, metric := range set.Spec.Metrics {
+		seconds := map[int]float64{}
+		fastest := 0.0
+		for j := range profile.Configurations {
+			alias := api.ProfileAlias(i, j)
+			result := api.ProfileResult{Metric: alias, Configuration: int32(j)}
+			run, ok := runs[alias]
+			elapsed, state := getRunSeconds(run, ok)
+			if state != "" {
+				result.State = state
+			} else {
+				seconds[j] = elapsed
+				result.Seconds = fmt.Sprintf("%.2f", elapsed)
+				result.RunsPerHour = fmt.Sprintf("%.4f", 3600/elapsed)
+				if fastest == 0 || elapsed < fastest {
+					fastest = elapsed
+				}
+			}
+			status.Results = append(status.Results, result)
+		}
+		if len(seconds) == 0 {
+			continue
+		}
+		limit := fastest * (1 + float64(profile.Tolerance)/100)
+		for j, resources := range profile.Configurations {
+			elapsed, ok := seconds[j]
+			if ok && elapsed <= limit {
+				status.Recommendations = append(status.Recommendations, api.ProfileRecommendation{
+					Metric:        metric.Key(),
+					Configuration: int32(j),
+					Resources:     *resources.DeepCopy(),
+				})
+				break
+			}
+		}
+	}
+	return status
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestGetProfileStatus(t *testing.T) {
+	configuration := func(cpu int) api.ContainerResources {
+		return api.ContainerResources{Requests: api.ContainerResource{"cpu": intstr.FromInt(cpu)}}
+	}
+	set := &api.MetricSet{Spec: api.MetricSetSpec{
+		Metrics: []api.Metric{{Name: "app-lammps"}},
+		Profile: api.Profile{
+			Configurations: []api.ContainerResources{configuration(1), configuration(2), configuration(4)},
+			Tolerance:      10,
+		},
+	}}
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	run := func(seconds int, state string) *metricRun {
+		return &metricRun{started: start, finished: start.Add(time.Duration(seconds) * time.Second), state: state}
+	}
+
+	tests := []struct {
+		name           string
+		runs           map[string]*metricRun
+		recommendation int32
+		recommended    bool
+	}{
+		{
+			name:           "largest is fastest",
+			runs:           map[string]*metricRun{"m0-p0": run(400, ""), "m0-p1": run(200, ""), "m0-p2": run(100, "")},
+			recommendation: 2,
+			recommended:    true,
+		},
+		{
+			name:           "smaller within tolerance",
+			runs:           map[string]*metricRun{"m0-p0": run(400, ""), "m0-p1": run(105, ""), "m0-p2": run(100, "")},
+			recommendation: 1,
+			recommended:    true,
+		},
+		{
+			name:           "failed runs are not compared",
+			runs:           map[string]*metricRun{"m0-p0": run(100, "Failed"), "m0-p1": run(300, ""), "m0-p2": run(200, "TimedOut")},
+			recommendation: 1,
+			recommended:    true,
+		},
+		{
+			name: "nothing finished",
+			runs: map[string]*metricRun{"m0-p0": run(100, "Failed")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := getProfileStatus(set, test.runs)
+			if len(status.Results) != 3 {
+				t.Fatalf("expected a result for each configuration, found %v", status.Results)
+			}
+			if !test.recommended {
+				if len(status.Recommendations) != 0 {
+					t.Errorf("expected no recommendation, found %v", status.Recommendations)
+				}
+				return
+			}
+			if len(status.Recommendations) != 1 {
+				t.Fatalf("expected one recommendation, found %v", status.Recommendations)
+			}
+			recommendation := status.Recommendations[0]
+			if recommendation.Metric != "app-lammps" || recommendation.Configuration != test.recommendation {
+				t.Errorf("expected configuration %d, found %v", test.recommendation, recommendation)
+			}
+		})
+	}
+}
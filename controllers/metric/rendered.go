@@ -0,0 +1,91 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// recordRendered records a hash of the JobSet and entrypoints that are about
+// to be created in the status, and (if requested) keeps them in a config map.
+// The options of the metrics and addons (after defaults) are recorded too.
+func (r *MetricSetReconciler) recordRendered(
+	ctx context.Context,
+	set *api.MetricSet,
+	metrics *mctrl.MetricSet,
+	js *jobset.JobSet,
+	cs []*specs.ContainerSpec,
+) error {
+	logger := log.FromContext(ctx)
+
+	rendering, err := mctrl.NewRendering(set, js, cs)
+	if err != nil {
+		return err
+	}
+	hash, err := rendering.Hash()
+	if err != nil {
+		return err
+	}
+	rendered := &api.RenderedStatus{Hash: hash}
+
+	// The JobSet keeps the hash too, so the status can be rebuilt from it
+	if js.Annotations == nil {
+		js.Annotations = map[string]string{}
+	}
+	js.Annotations[renderedHashAnnotation] = hash
+
+	if set.Spec.RecordRendered {
+		rendered.ConfigMap = set.RenderedName()
+		err = r.ensureRenderedConfigMap(ctx, set, rendering)
+		if err != nil {
+			return err
+		}
+	}
+	resolved := mctrl.ResolvedConfig(metrics)
+	if set.Status.Rendered != nil && *set.Status.Rendered == *rendered &&
+		equality.Semantic.DeepEqual(set.Status.ResolvedConfig, resolved) {
+		return nil
+	}
+	set.Status.Rendered = rendered
+	set.Status.ResolvedConfig = resolved
+	logger.Info("🧾️ Recording rendered MetricSet", "Name", set.Name, "Hash", hash)
+	return r.Status().Update(ctx, set)
+}
+
+// ensureRenderedConfigMap creates the config map with the rendered JobSet and entrypoints
+func (r *MetricSetReconciler) ensureRenderedConfigMap(
+	ctx context.Context,
+	set *api.MetricSet,
+	rendering *mctrl.Rendering,
+) error {
+	existing := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.RenderedName(), Namespace: set.Namespace}, existing)
+	if err == nil {
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return err
+	}
+	data, err := rendering.Record()
+	if err != nil {
+		return err
+	}
+	_, _, err = r.getConfigMap(ctx, set, set.RenderedName(), data)
+	return err
+}
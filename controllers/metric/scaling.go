@@ -0,0 +1,125 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// How often to check again if the MetricSet for a pod count has finished
+var scalingRequeue = 30 * time.Second
+
+// reconcileScaling runs a scaling study, one MetricSet (pod count) at a time.
+// When each finishes, the runtime of its metrics is added to the status.
+func (r *MetricSetReconciler) reconcileScaling(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	recorded := map[int32]bool{}
+	for _, result := range set.Status.Scaling {
+		recorded[result.Pods] = true
+	}
+	for _, pods := range set.Spec.Scaling.Pods {
+		if recorded[pods] {
+			continue
+		}
+		child := set.ScalingSet(pods)
+		existing := &api.MetricSet{}
+		err := r.Get(ctx, types.NamespacedName{Name: child.Name, Namespace: child.Namespace}, existing)
+		if errors.IsNotFound(err) {
+			logger.Info("📈️ Creating MetricSet for scaling study", "Name", child.Name, "Pods", pods)
+			ctrl.SetControllerReference(set, child, r.Scheme)
+			err = r.Create(ctx, child)
+			if err != nil {
+				logger.Error(err, "🟥️ Failed to create MetricSet for scaling study", "Name", child.Name)
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: scalingRequeue}, nil
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// The JobSet (or Job) of the MetricSet needs to have finished
+		finished, err := r.isRunFinished(ctx, existing)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !finished {
+			return ctrl.Result{RequeueAfter: scalingRequeue}, nil
+		}
+
+		// Container specs map containers to metrics, as for the status of a single run
+		metrics, err := mctrl.NewMetricSet(existing)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		_, cs, err := mctrl.GetJobSet(existing, metrics)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		runs, err := r.getMetricRuns(ctx, existing, cs)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		for _, metric := range existing.Spec.Metrics {
+			run, ok := runs[metric.Key()]
+			seconds, state := getRunSeconds(run, ok)
+			result := api.ScalingResult{Metric: metric.Key(), Pods: pods, State: state}
+			if state == "" {
+				result.Seconds = fmt.Sprintf("%.2f", seconds)
+			}
+			set.Status.Scaling = append(set.Status.Scaling, result)
+		}
+		set.Status.Scaling = getScalingResults(set, set.Status.Scaling)
+		logger.Info("📈️ Scaling study pod count finished", "Name", set.Name, "Pods", pods)
+		return ctrl.Result{Requeue: true}, r.Status().Update(ctx, set)
+	}
+	return ctrl.Result{}, nil
+}
+
+// getScalingResults calculates the speedup and efficiency of each result,
+// relative to the first pod count (the baseline) for the metric
+func getScalingResults(set *api.MetricSet, results []api.ScalingResult) []api.ScalingResult {
+	scaling := set.Spec.Scaling
+	baseline := map[string]float64{}
+	for _, result := range results {
+		seconds, err := strconv.ParseFloat(result.Seconds, 64)
+		if err == nil && seconds > 0 && result.Pods == scaling.Pods[0] {
+			baseline[result.Metric] = seconds
+		}
+	}
+	for i, result := range results {
+		seconds, err := strconv.ParseFloat(result.Seconds, 64)
+		base, ok := baseline[result.Metric]
+		if err != nil || seconds <= 0 || !ok {
+			continue
+		}
+		speedup := base / seconds
+		efficiency := speedup
+		if scaling.Mode != api.WeakScaling {
+			efficiency = speedup * float64(scaling.Pods[0]) / float64(result.Pods)
+		}
+		results[i].Speedup = fmt.Sprintf("%.4f", speedup)
+		results[i].Efficiency = fmt.Sprintf("%.4f", efficiency)
+	}
+	return results
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetScalingSet(t *testing.T) {
+	set := &api.MetricSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "study", Namespace: "default"},
+		Spec: api.MetricSetSpec{
+			ServiceName: "ms",
+			Pods:        1,
+			Metrics:     []api.Metric{{Name: "app-lammps"}},
+			Scaling:     api.Scaling{Pods: []int32{1, 2, 4}, Mode: api.WeakScaling, ProblemSize: 8},
+		},
+	}
+	child := set.ScalingSet(4)
+	if child.Name != "study-4" || child.Spec.Pods != 4 || child.Spec.ServiceName != "ms-4" {
+		t.Errorf("unexpected MetricSet %s with %d pods and service %s", child.Name, child.Spec.Pods, child.Spec.ServiceName)
+	}
+	if child.Spec.Scaling.Enabled() || child.Labels[api.ScalingLabel] != "study" {
+		t.Errorf("expected a single run labeled with the study, found %v %v", child.Spec.Scaling, child.Labels)
+	}
+	if size := child.Spec.Scaling.GetProblemSize(child.Spec.Pods); size != 32 {
+		t.Errorf("expected a weak scaling problem size of 32, found %d", size)
+	}
+	if len(set.Spec.Scaling.Pods) != 3 {
+		t.Error("expected the study to not be changed")
+	}
+}
+
+func TestGetScalingResults(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		seconds    []string
+		speedup    []string
+		efficiency []string
+	}{
+		{
+			name:       "strong",
+			mode:       api.StrongScaling,
+			seconds:    []string{"100.00", "50.00", "40.00"},
+			speedup:    []string{"1.0000", "2.0000", "2.5000"},
+			efficiency: []string{"1.0000", "1.0000", "0.6250"},
+		},
+		{
+			name:       "weak",
+			mode:       api.WeakScaling,
+			seconds:    []string{"100.00", "100.00", "125.00"},
+			speedup:    []string{"1.0000", "1.0000", "0.8000"},
+			efficiency: []string{"1.0000", "1.0000", "0.8000"},
+		},
+		{
+			name:       "baseline failed",
+			mode:       api.StrongScaling,
+			seconds:    []string{"", "50.00", "40.00"},
+			speedup:    []string{"", "", ""},
+			efficiency: []string{"", "", ""},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set := &api.MetricSet{Spec: api.MetricSetSpec{
+				Scaling: api.Scaling{Pods: []int32{1, 2, 4}, Mode: test.mode},
+			}}
+			results := []api.ScalingResult{}
+			for i, pods := range set.Spec.Scaling.Pods {
+				results = append(results, api.ScalingResult{Metric: "app-lammps", Pods: pods, Seconds: test.seconds[i]})
+			}
+			results = getScalingResults(set, results)
+			for i, result := range results {
+				if result.Speedup != test.speedup[i] || result.Efficiency != test.efficiency[i] {
+					t.Errorf("%d pods: expected speedup %q and efficiency %q, found %q and %q",
+						result.Pods, test.speedup[i], test.efficiency[i], result.Speedup, result.Efficiency)
+				}
+			}
+		})
+	}
+}
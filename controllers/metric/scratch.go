@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+// ensureScratch creates the shared scratch persistent volume claim, if requested
+func (r *MetricSetReconciler) ensureScratch(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !set.Spec.Scratch.Enabled() {
+		return ctrl.Result{}, nil
+	}
+	existing := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.ScratchClaimName(), Namespace: set.Namespace}, existing)
+	if err == nil {
+		return ctrl.Result{}, nil
+	}
+	if !errors.IsNotFound(err) {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	size, err := resource.ParseQuantity(set.Spec.Scratch.Size)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      set.ScratchClaimName(),
+			Namespace: set.Namespace,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			StorageClassName: &set.Spec.Scratch.StorageClassName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+		},
+	}
+	logger.Info(
+		"✨ Creating MetricSet scratch volume claim ✨",
+		"Namespace", pvc.Namespace,
+		"Name", pvc.Name,
+	)
+
+	// The owner reference ensures the claim is deleted with the MetricSet
+	ctrl.SetControllerReference(set, pvc, r.Scheme)
+	err = r.Create(ctx, pvc)
+	if err != nil {
+		logger.Error(err, "🟥️ Failed to create MetricSet scratch volume claim", "Name", pvc.Name)
+	}
+	return ctrl.Result{}, err
+}
+
+// cleanupScratch deletes the scratch claim when the run (JobSet or Job) has finished
+func (r *MetricSetReconciler) cleanupScratch(
+	ctx context.Context,
+	set *api.MetricSet,
+	finished bool,
+) error {
+	logger := log.FromContext(ctx)
+
+	if !set.Spec.Scratch.Enabled() || set.Spec.Scratch.Keep || !finished {
+		return nil
+	}
+	existing := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{Name: set.ScratchClaimName(), Namespace: set.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	logger.Info("🧹️ Run finished, deleting scratch volume claim", "Name", existing.Name)
+	err = r.Delete(ctx, existing)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
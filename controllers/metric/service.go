@@ -13,6 +13,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
@@ -20,19 +21,26 @@ import (
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 )
 
-// exposeService will expose services for job networking (headless)
+// exposeService will expose services for job networking (headless), named
+// for the subdomain of the pods
 func (r *MetricSetReconciler) exposeServices(
 	ctx context.Context,
 	set *api.MetricSet,
+	name string,
 	selector map[string]string,
 ) (ctrl.Result, error) {
 
+	// JobSet creates the service when it sets the hostnames (a Job does not)
+	if set.Spec.Network.EnableDNSHostnames && !set.UsesJobs() {
+		return ctrl.Result{}, nil
+	}
+
 	// This service is for the restful API
 	existing := &corev1.Service{}
-	err := r.Get(ctx, types.NamespacedName{Name: set.Spec.ServiceName, Namespace: set.Namespace}, existing)
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: set.Namespace}, existing)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			_, err = r.createHeadlessService(ctx, set, selector)
+			_, err = r.createHeadlessService(ctx, set, name, selector)
 		}
 	}
 	return ctrl.Result{}, err
@@ -42,21 +50,24 @@ func (r *MetricSetReconciler) exposeServices(
 func (r *MetricSetReconciler) createHeadlessService(
 	ctx context.Context,
 	set *api.MetricSet,
+	name string,
 	selector map[string]string,
 ) (*corev1.Service, error) {
+	logger := log.FromContext(ctx)
 
-	r.Log.Info("🤯️ Creating headless service with: ", set.Spec.ServiceName, set.Namespace)
+	logger.Info("🤯️ Creating headless service", "Name", name, "Namespace", set.Namespace)
 	service := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{Name: set.Spec.ServiceName, Namespace: set.Namespace},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: set.Namespace},
 		Spec: corev1.ServiceSpec{
-			ClusterIP: "None",
-			Selector:  selector,
+			ClusterIP:                "None",
+			Selector:                 selector,
+			PublishNotReadyAddresses: set.Spec.Network.PublishNotReadyAddresses,
 		},
 	}
 	ctrl.SetControllerReference(set, service, r.Scheme)
 	err := r.Client.Create(ctx, service)
 	if err != nil {
-		r.Log.Error(err, "🔴 Create service", "Service", service.Name)
+		logger.Error(err, "🔴 Create service", "Service", service.Name)
 	}
 	return service, err
 }
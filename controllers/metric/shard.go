@@ -0,0 +1,199 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// How often to check again on the shards of a run that are not finished
+var shardRequeue = 10 * time.Second
+
+// ensureShards creates a JobSet (with config maps and a headless service) for
+// each shard of the MetricSet. The shards are created suspended, and started
+// together when they all exist. Resources for the whole run (e.g., scratch) are
+// created once, and cleaned up when every shard is finished.
+func (r *MetricSetReconciler) ensureShards(
+	ctx context.Context,
+	spec *api.MetricSet,
+	set *mctrl.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	shards := []*jobset.JobSet{}
+	for i := 0; i < int(spec.Spec.Shards); i++ {
+		shard := mctrl.GetShard(spec, i)
+		js := &jobset.JobSet{}
+		err := r.Get(ctx, types.NamespacedName{Name: shard.Name, Namespace: spec.Namespace}, js)
+		if err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		if errors.IsNotFound(err) {
+			var result ctrl.Result
+			js, result, err = r.createShard(ctx, spec, set, i)
+			if err != nil {
+				return result, err
+			}
+		}
+		shards = append(shards, js)
+
+		// Each shard has a headless service for its own pods
+		selector := map[string]string{
+			mctrl.MetricSetLabel: spec.Name,
+			mctrl.ShardLabel:     fmt.Sprintf("%d", i),
+		}
+		result, err := r.exposeServices(ctx, spec, shard.Subdomain(), selector)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// Every shard exists, so the suspended ones can start
+	for _, js := range shards {
+		if isFinished(js) || js.Spec.Suspend == nil || !*js.Spec.Suspend {
+			continue
+		}
+		logger.Info("🚦️ All shards exist, starting shard", "Name", js.Name)
+		suspend := false
+		js.Spec.Suspend = &suspend
+		err := r.Update(ctx, js)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	err := r.updateShardStatus(ctx, spec, shards)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Record the nodes (and instance types) the pods of all shards run on
+	result, err := r.updateNodeStatus(ctx, spec)
+	if err != nil {
+		return result, err
+	}
+	last := getLastShard(shards)
+	if last == nil {
+		if result.RequeueAfter == 0 {
+			result.RequeueAfter = shardRequeue
+		}
+		return result, nil
+	}
+
+	// When every shard is finished, the run is finished
+	err = r.cleanupScratch(ctx, spec, isFinished(last))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	err = r.cleanupDisruptionBudget(ctx, spec, isFinished(last))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	err = r.cleanupPerfTuning(ctx, spec, isFinished(last))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	err = r.updateCostStatus(ctx, spec, last)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The shards have the same replicated jobs and containers as the first
+	_, cs, err := mctrl.GetShardJobSet(spec, 0)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, r.updateMetricStatus(ctx, spec, cs)
+}
+
+// createShard creates the config maps and JobSet of a shard. Resources for the
+// whole run are ensured with the first shard.
+func (r *MetricSetReconciler) createShard(
+	ctx context.Context,
+	spec *api.MetricSet,
+	set *mctrl.MetricSet,
+	index int,
+) (*jobset.JobSet, ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	js, cs, err := mctrl.GetShardJobSet(spec, index)
+	if err != nil {
+		return js, ctrl.Result{}, err
+	}
+	logger.Info(
+		"✨ Creating a new Metrics JobSet shard ✨",
+		"Namespace:", spec.Namespace,
+		"Name:", js.Name,
+	)
+	result, err := r.ensureConfigMaps(ctx, spec, mctrl.GetShard(spec, index), cs)
+	if err != nil {
+		return js, result, err
+	}
+	if index == 0 {
+		result, err = r.ensureScratch(ctx, spec)
+		if err != nil {
+			return js, result, err
+		}
+		result, err = r.ensureDisruptionBudget(ctx, spec)
+		if err != nil {
+			return js, result, err
+		}
+		result, err = r.ensurePerfTuning(ctx, spec)
+		if err != nil {
+			return js, result, err
+		}
+		err = r.recordRendered(ctx, spec, set, js, cs)
+		if err != nil {
+			return js, ctrl.Result{}, err
+		}
+	}
+	return js, ctrl.Result{}, r.createJobSet(ctx, spec, js)
+}
+
+// getLastShard returns the shard that finished last, or nil if a shard is not
+// finished. Its finish time is the end of the run.
+func getLastShard(shards []*jobset.JobSet) *jobset.JobSet {
+	var last *jobset.JobSet
+	for _, js := range shards {
+		if !isFinished(js) {
+			return nil
+		}
+		if last == nil || getFinishedTime(last).Time.Before(getFinishedTime(js).Time) {
+			last = js
+		}
+	}
+	return last
+}
+
+// updateShardStatus records the state of each shard
+func (r *MetricSetReconciler) updateShardStatus(
+	ctx context.Context,
+	spec *api.MetricSet,
+	shards []*jobset.JobSet,
+) error {
+	status := []api.ShardStatus{}
+	for _, js := range shards {
+		status = append(status, api.ShardStatus{Name: js.Name, State: getJobSetState(js)})
+	}
+	if reflect.DeepEqual(status, spec.Status.Shards) {
+		return nil
+	}
+	spec.Status.Shards = status
+	return r.Status().Update(ctx, spec)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestGetLastShard(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	withState := func(name string, finished time.Duration) *jobset.JobSet {
+		js := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if finished > 0 {
+			js.Status.Conditions = []metav1.Condition{{
+				Type:               string(jobset.JobSetCompleted),
+				Status:             metav1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(start.Add(finished)),
+			}}
+		}
+		return js
+	}
+
+	// A shard that is still running means the run is not finished
+	shards := []*jobset.JobSet{withState("s0", time.Minute), withState("s1", 0)}
+	if last := getLastShard(shards); last != nil {
+		t.Errorf("expected no last shard while one is running, found %s", last.Name)
+	}
+	shards = []*jobset.JobSet{withState("s0", time.Minute), withState("s1", time.Hour), withState("s2", time.Second)}
+	last := getLastShard(shards)
+	if last == nil || last.Name != "s1" {
+		t.Errorf("expected the shard that finished last, found %v", last)
+	}
+}
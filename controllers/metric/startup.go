@@ -0,0 +1,103 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// How often to check again for the pods that gated pods wait on (InOrder startup)
+var startupRequeue = 5 * time.Second
+
+// getStartupPods returns the number of pods the gated replicated jobs wait
+// on, and the (ready) pods of the other replicated jobs, and the gated pods
+func getStartupPods(js *jobset.JobSet, pods []corev1.Pod) (int32, int32, []*corev1.Pod) {
+	gated := map[string]bool{}
+	expected := int32(0)
+	for _, rj := range js.Spec.ReplicatedJobs {
+		if mctrl.IsStartupGated(&rj) {
+			gated[rj.Name] = true
+			continue
+		}
+		parallelism := int32(1)
+		if rj.Template.Spec.Parallelism != nil {
+			parallelism = *rj.Template.Spec.Parallelism
+		}
+		expected += rj.Replicas * parallelism
+	}
+	ready := int32(0)
+	waiting := []*corev1.Pod{}
+	for i := range pods {
+		pod := &pods[i]
+		if gated[pod.Labels[jobset.ReplicatedJobNameKey]] {
+			if mctrl.HasStartupGate(&pod.Spec) {
+				waiting = append(waiting, pod)
+			}
+			continue
+		}
+		if pod.Status.Phase == corev1.PodRunning && isPodReady(pod) {
+			ready++
+		}
+	}
+	return expected, ready, waiting
+}
+
+// releaseStartup removes the startup gate from the launcher pods when the pods
+// of the other replicated jobs are ready. Pods are gated when they are created,
+// so we keep checking (e.g., for a launcher pod that is replaced) until the run is done.
+func (r *MetricSetReconciler) releaseStartup(
+	ctx context.Context,
+	set *api.MetricSet,
+	js *jobset.JobSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !set.StartsInOrder() || isFinished(js) {
+		return ctrl.Result{}, nil
+	}
+	pods := &corev1.PodList{}
+	err := r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{"metricset-name": set.Name},
+	)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	expected, ready, waiting := getStartupPods(js, pods.Items)
+	if ready < expected {
+		logger.V(1).Info("🚦️ Waiting for pods before starting the launcher", "Name", set.Name, "Ready", ready, "Expected", expected)
+		return ctrl.Result{RequeueAfter: startupRequeue}, nil
+	}
+	for _, pod := range waiting {
+		gates := []corev1.PodSchedulingGate{}
+		for _, gate := range pod.Spec.SchedulingGates {
+			if gate.Name != mctrl.StartupGate {
+				gates = append(gates, gate)
+			}
+		}
+		pod.Spec.SchedulingGates = gates
+		logger.Info("🚦️ Pods are ready, starting the launcher", "Name", set.Name, "Pod", pod.Name)
+		err = r.Update(ctx, pod)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: startupRequeue}, nil
+}
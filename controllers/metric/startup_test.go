@@ -0,0 +1,78 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+func TestGetStartupPods(t *testing.T) {
+	workers := int32(2)
+	js := &jobset.JobSet{Spec: jobset.JobSetSpec{ReplicatedJobs: []jobset.ReplicatedJob{
+		{Name: "l", Replicas: 1},
+		{Name: "w", Replicas: 1},
+	}}}
+	js.Spec.ReplicatedJobs[0].Template.Spec.Template.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: mctrl.StartupGate}}
+	js.Spec.ReplicatedJobs[1].Template.Spec.Parallelism = &workers
+
+	withPod := func(job string, phase corev1.PodPhase, ready bool, gated bool) corev1.Pod {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{jobset.ReplicatedJobNameKey: job}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+		if ready {
+			pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		}
+		if gated {
+			pod.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: mctrl.StartupGate}}
+		}
+		return pod
+	}
+	tests := []struct {
+		name    string
+		pods    []corev1.Pod
+		ready   int32
+		waiting int
+	}{
+		{name: "no pods"},
+		{
+			name:    "workers starting",
+			pods:    []corev1.Pod{withPod("l", corev1.PodPending, false, true), withPod("w", corev1.PodRunning, true, false), withPod("w", corev1.PodPending, false, false)},
+			ready:   1,
+			waiting: 1,
+		},
+		{
+			name:    "workers ready",
+			pods:    []corev1.Pod{withPod("l", corev1.PodPending, false, true), withPod("w", corev1.PodRunning, true, false), withPod("w", corev1.PodRunning, true, false)},
+			ready:   2,
+			waiting: 1,
+		},
+		{
+			name:  "launcher released",
+			pods:  []corev1.Pod{withPod("l", corev1.PodRunning, true, false), withPod("w", corev1.PodRunning, true, false), withPod("w", corev1.PodRunning, true, false)},
+			ready: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected, ready, waiting := getStartupPods(js, test.pods)
+			if expected != workers {
+				t.Errorf("expected to wait on %d pods, found %d", workers, expected)
+			}
+			if ready != test.ready || len(waiting) != test.waiting {
+				t.Errorf("expected %d ready and %d waiting, found %d and %d", test.ready, test.waiting, ready, len(waiting))
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// updateMetricStatus marks metrics that reached their timeout (or were found to
+// hang). The entrypoint flushes partial results and succeeds, so the other metrics
+// in the set can finish, and the container termination message tells us why.
+func (r *MetricSetReconciler) updateMetricStatus(
+	ctx context.Context,
+	set *api.MetricSet,
+	cs []*specs.ContainerSpec,
+) error {
+	logger := log.FromContext(ctx)
+
+	// Containers (by metric, replicated job, and name) that can time out (or hang), and their metric
+	metrics := map[string]string{}
+	for _, c := range cs {
+		if c.Metric != "" && (c.Timeout > 0 || set.Spec.CommandTimeout > 0 || c.ReportsState) {
+			metrics[containerKey(c.Metric, c.JobName, c.Name)] = c.Metric
+		}
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	pods := &corev1.PodList{}
+	err := r.List(
+		ctx,
+		pods,
+		client.InNamespace(set.Namespace),
+		client.MatchingLabels{"metricset-name": set.Name},
+	)
+	if err != nil {
+		return err
+	}
+
+	updated := getMetricStates(set, metrics, pods.Items)
+	if len(updated) == 0 || reflect.DeepEqual(updated, set.Status.Metrics) {
+		return nil
+	}
+	set.Status.Metrics = updated
+	logger.Info("⏰️ Metrics did not finish normally", "Name", set.Name, "Metrics", updated)
+	return r.Status().Update(ctx, set)
+}
+
+// containerKey identifies a container of a metric in a replicated job
+func containerKey(metric, job, name string) string {
+	return fmt.Sprintf("%s/%s/%s", metric, job, name)
+}
+
+// getMetricStates returns the states of metrics with a container (keyed by
+// containerKey) that timed out or hung, sorted by name. Metrics already marked
+// stay marked, since pods can be cleaned up after the run. Pods are matched to
+// metrics by their metric label, so a container name in the jobs of more than one
+// metric is not confused, and merged metrics share the label of the first.
+func getMetricStates(set *api.MetricSet, metrics map[string]string, pods []corev1.Pod) []api.MetricState {
+	states := map[string]string{}
+	for _, metric := range set.Status.Metrics {
+		states[metric.Name] = metric.State
+	}
+	for _, pod := range pods {
+		job := pod.Labels[jobset.ReplicatedJobNameKey]
+		for _, status := range pod.Status.ContainerStatuses {
+			metric, ok := metrics[containerKey(pod.Labels[mctrl.MetricLabel], job, status.Name)]
+			if !ok {
+				continue
+			}
+			state := getTerminationState(status)
+			if state != "" {
+				states[metric] = state
+			}
+		}
+	}
+
+	updated := []api.MetricState{}
+	for name, state := range states {
+		updated = append(updated, api.MetricState{Name: name, State: state})
+	}
+	sort.Slice(updated, func(i, j int) bool { return updated[i].Name < updated[j].Name })
+	return updated
+}
+
+// getTerminationState returns the state (e.g., TimedOut) a container (or its
+// last run) ended with, if any
+func getTerminationState(status corev1.ContainerStatus) string {
+	for _, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+		if state.Terminated == nil {
+			continue
+		}
+		// Values reported (e.g., for acceptance) can follow the state
+		message := strings.SplitN(state.Terminated.Message, "\n", 2)[0]
+		if message == specs.TimedOut || message == specs.Hung {
+			return message
+		}
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	mctrl "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// terminatedPod returns a pod of a metric with a container that ended with a message
+func terminatedPod(metric, job, container, message string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+			mctrl.MetricLabel:           metric,
+			jobset.ReplicatedJobNameKey: job,
+		}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name: container,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Message: message,
+			}},
+		}}},
+	}
+}
+
+func TestGetMetricStates(t *testing.T) {
+	metrics := map[string]string{
+		containerKey("io-fio", "m", "fio"):              "io-fio",
+		containerKey("perf-sysstat", "m", "sysstat"):    "perf-sysstat",
+		containerKey("io-fio-large", "large", "fio"):    "io-fio-large",
+		containerKey("network-osu-benchmark", "l", "l"): "network-osu-benchmark",
+	}
+	set := &api.MetricSet{}
+	set.Status.Metrics = []api.MetricState{{Name: "network-osu-benchmark", State: specs.Hung}}
+
+	pods := []corev1.Pod{
+		terminatedPod("io-fio", "m", "fio", specs.TimedOut+"\nbandwidth=10"),
+		terminatedPod("perf-sysstat", "m", "sysstat", ""),
+
+		// Another metric with a container of the same name is not marked
+		terminatedPod("io-fio-large", "large", "fio", "Completed"),
+		terminatedPod("io-fio-large", "m", "fio", specs.TimedOut),
+
+		// A container that is not of a metric (e.g., the pod of another set)
+		terminatedPod("", "m", "fio", specs.TimedOut),
+	}
+	states := getMetricStates(set, metrics, pods)
+	expected := []api.MetricState{
+		{Name: "io-fio", State: specs.TimedOut},
+		{Name: "network-osu-benchmark", State: specs.Hung},
+	}
+	if len(states) != len(expected) {
+		t.Fatalf("expected %v, found %v", expected, states)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Errorf("expected %v, found %v", expected, states)
+		}
+	}
+}
+
+func TestGetTerminationState(t *testing.T) {
+	tests := map[string]struct {
+		status   corev1.ContainerStatus
+		expected string
+	}{
+		"running": {
+			status: corev1.ContainerStatus{State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		},
+		"completed": {
+			status: corev1.ContainerStatus{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+		},
+		"timed out": {
+			status:   corev1.ContainerStatus{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: specs.TimedOut}}},
+			expected: specs.TimedOut,
+		},
+		"restarted after a hang": {
+			status: corev1.ContainerStatus{
+				State:                corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: specs.Hung + "\n"}},
+			},
+			expected: specs.Hung,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			state := getTerminationState(test.status)
+			if state != test.expected {
+				t.Errorf("expected %q, found %q", test.expected, state)
+			}
+		})
+	}
+}
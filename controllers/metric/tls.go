@@ -0,0 +1,97 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+ SPDX-License-Identifier: MIT
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/addons"
+)
+
+// getTLSAddon returns the first tls addon of the set, if any. All tls addons
+// of a set share the one certificate secret.
+func getTLSAddon(set *api.MetricSet) (*addons.TLSAddon, error) {
+	for _, metric := range set.Spec.Metrics {
+		for _, a := range metric.Addons {
+			if a.Name != addons.TLSIdentifier {
+				continue
+			}
+			addon, err := addons.GetAddon(&a, set)
+			if err != nil {
+				return nil, err
+			}
+			return addon.(*addons.TLSAddon), nil
+		}
+	}
+	return nil, nil
+}
+
+// ensureTLS creates the certificate secret (self-signed) or the cert-manager
+// Certificate that writes it, if the tls addon is requested
+func (r *MetricSetReconciler) ensureTLS(
+	ctx context.Context,
+	set *api.MetricSet,
+) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	tls, err := getTLSAddon(set)
+	if err != nil || tls == nil {
+		return ctrl.Result{}, err
+	}
+
+	var existing client.Object = &corev1.Secret{}
+	if tls.UsesIssuer() {
+		cert := &unstructured.Unstructured{}
+		cert.SetGroupVersionKind(addons.CertificateKind)
+		existing = cert
+	}
+	err = r.Get(ctx, types.NamespacedName{Name: tls.SecretName(), Namespace: set.Namespace}, existing)
+	if err == nil {
+		return ctrl.Result{}, nil
+	}
+	if !errors.IsNotFound(err) {
+		if tls.UsesIssuer() {
+			logger.Error(err, "🟥️ Cannot get Certificate, is cert-manager installed?")
+		}
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	var obj client.Object
+	if tls.UsesIssuer() {
+		obj = tls.Certificate(set)
+	} else {
+		obj, err = tls.SelfSignedSecret(set)
+		if err != nil {
+			logger.Error(err, "🟥️ Failed to generate MetricSet certificate")
+			return ctrl.Result{}, err
+		}
+	}
+	logger.Info(
+		"✨ Creating MetricSet certificate ✨",
+		"Namespace", set.Namespace,
+		"Name", tls.SecretName(),
+		"Issuer", tls.UsesIssuer(),
+	)
+
+	// The owner reference ensures the certificate is deleted with the MetricSet
+	ctrl.SetControllerReference(set, obj, r.Scheme)
+	err = r.Create(ctx, obj)
+	if err != nil {
+		logger.Error(err, "🟥️ Failed to create MetricSet certificate", "Name", tls.SecretName())
+	}
+	return ctrl.Result{}, err
+}
@@ -9,6 +9,7 @@ import (
 	// Metrics are registered here! Importing registers once
 	"github.com/converged-computing/metrics-operator/pkg/metrics"
 	_ "github.com/converged-computing/metrics-operator/pkg/metrics/app"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/db"
 	_ "github.com/converged-computing/metrics-operator/pkg/metrics/io"
 	_ "github.com/converged-computing/metrics-operator/pkg/metrics/network"
 	_ "github.com/converged-computing/metrics-operator/pkg/metrics/perf"
@@ -27,6 +28,7 @@ type MetricOutput struct {
 	Family      string `json:"family"`
 	Image       string `json:"image"`
 	Url         string `json:"url"`
+	Version     string `json:"version"`
 }
 
 func main() {
@@ -42,6 +44,7 @@ func main() {
 			Family:      metric.Family(),
 			Image:       metric.Image(),
 			Url:         metric.Url(),
+			Version:     metrics.Version(metric),
 		}
 		records = append(records, newRecord)
 	}
@@ -10,9 +10,11 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
+	"k8s.io/client-go/discovery"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 
@@ -29,9 +31,12 @@ import (
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	controllers "github.com/converged-computing/metrics-operator/controllers/metric"
+	"github.com/converged-computing/metrics-operator/pkg/config"
+	"github.com/converged-computing/metrics-operator/pkg/logging"
 
 	// Metrics are registered here! Importing registers once
 	_ "github.com/converged-computing/metrics-operator/pkg/metrics/app"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/db"
 	_ "github.com/converged-computing/metrics-operator/pkg/metrics/io"
 	_ "github.com/converged-computing/metrics-operator/pkg/metrics/network"
 	_ "github.com/converged-computing/metrics-operator/pkg/metrics/perf"
@@ -63,15 +68,59 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
-	opts := zap.Options{
-		Development: true,
-	}
+	var verbosity int
+	flag.IntVar(&verbosity, "verbosity", 0, "Log verbosity, where 0 is info and 1 or more adds debug detail.")
+	var dumpEntrypoints bool
+	flag.BoolVar(&dumpEntrypoints, "dump-entrypoints", true,
+		"Include entrypoint scripts (with secrets redacted) in debug logs. Set to false to never log them.")
+	var adoptJobSets bool
+	flag.BoolVar(&adoptJobSets, "adopt-jobsets", true,
+		"Verify the owner of existing JobSets, and adopt orphaned JobSets for a MetricSet (e.g., after an upgrade).")
+	var configPath string
+	flag.StringVar(&configPath, "config", config.DefaultPath,
+		"Operator configuration file (e.g., from a mounted ConfigMap) with image overrides. It is optional.")
+	var configInterval time.Duration
+	flag.DurationVar(&configInterval, "config-interval", 30*time.Second,
+		"How often to check the operator configuration file for changes to reload.")
+	var apiQPS float64
+	flag.Float64Var(&apiQPS, "kube-api-qps", 20,
+		"Client-side rate limit (queries per second) for requests to the Kubernetes API, to reduce pressure during large sweeps.")
+	var apiBurst int
+	flag.IntVar(&apiBurst, "kube-api-burst", 30, "Burst of requests to the Kubernetes API allowed above the rate limit.")
+	opts := zap.Options{}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	// Verbosity applies to the controller and the packages that generate JobSets.
+	// The level is shared, so the operator configuration can change it at runtime.
+	if opts.Level == nil {
+		opts.Level = logging.Level()
+	}
+	logging.SetVerbosity(verbosity)
+	logging.SetDumpEntrypoints(dumpEntrypoints)
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	if err := config.Load(configPath); err != nil {
+		setupLog.Error(err, "unable to load operator configuration")
+		os.Exit(1)
+	}
+
+	// Verbosity from the operator configuration takes precedence over the flag
+	setVerbosity := func(cfg config.Config) {
+		if cfg.Verbosity != nil {
+			logging.SetVerbosity(*cfg.Verbosity)
+		} else {
+			logging.SetVerbosity(verbosity)
+		}
+	}
+	setVerbosity(config.Get())
+
+	// Writes (e.g., config maps and JobSets for many MetricSets) are rate limited
+	restConfig := ctrl.GetConfigOrDie()
+	restConfig.QPS = float32(apiQPS)
+	restConfig.Burst = apiBurst
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
@@ -95,6 +144,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Reload the operator configuration when it changes, without a restart
+	err = mgr.Add(&config.Watcher{
+		Path:     configPath,
+		Interval: configInterval,
+		Reloaded: func(cfg config.Config, err error) {
+			if err != nil {
+				setupLog.Error(err, "operator configuration did not reload, keeping the previous one")
+				return
+			}
+			setVerbosity(cfg)
+			setupLog.Info("reloaded operator configuration", "path", configPath)
+		},
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to watch operator configuration")
+		os.Exit(1)
+	}
+
 	// Create a RESTful client for the MiniCluster controller. We need this to actually
 	// interact with pods in the cluster!
 	gvk := schema.GroupVersionKind{
@@ -111,17 +178,37 @@ func main() {
 		setupLog.Error(err, "unable to create REST client", "controller", restClient)
 	}
 
+	// Discovery lets the preflight check the cluster version, APIs, and feature gates
+	dc, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create discovery client")
+		os.Exit(1)
+	}
+
 	// Create the new reconciler
 	if err = (&controllers.MetricSetReconciler{
-		Log:        ctrl.Log.WithName("metric-reconciler"),
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		RESTConfig: mgr.GetConfig(),
-		RESTClient: restClient,
+		Log:          ctrl.Log.WithName("metric-reconciler"),
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		RESTConfig:   mgr.GetConfig(),
+		RESTClient:   restClient,
+		AdoptJobSets: adoptJobSets,
+		Discovery:    dc,
+		Recorder:     mgr.GetEventRecorderFor("metrics-operator"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Hyperqueue")
 		os.Exit(1)
 	}
+	if err = (&controllers.MetricCampaignReconciler{
+		Log:       ctrl.Log.WithName("campaign-reconciler"),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Discovery: dc,
+		Recorder:  mgr.GetEventRecorderFor("metrics-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MetricCampaign")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -11,11 +11,14 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"strings"
 
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/config"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/utils"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -27,6 +30,8 @@ var (
 	AddonFamilyVolume      = "volume"
 	AddonFamilyApplication = "application"
 	AddonFamilyWorkload    = "workload"
+	AddonFamilyDebug       = "debug"
+	AddonFamilySystem      = "system"
 )
 
 // A general metric is a container added to a JobSet
@@ -37,7 +42,8 @@ type Addon interface {
 	Family() string
 	Description() string
 
-	// Options and exportable attributes
+	// Options and exportable attributes. ListOptions declares every list
+	// option the addon accepts, with an empty list if it is unset.
 	SetOptions(*api.MetricAddon, *api.MetricSet)
 	Options() map[string]intstr.IntOrString
 	ListOptions() map[string][]intstr.IntOrString
@@ -106,15 +112,36 @@ func GetAddon(a *api.MetricAddon, set *api.MetricSet) (Addon, error) {
 	if !ok {
 		return nil, fmt.Errorf("%s is not a known addon", a.Name)
 	}
+	if !config.AllowsAddon(a.Name) {
+		return nil, fmt.Errorf("%s is not allowed by the operator configuration", a.Name)
+	}
 	templateType := reflect.ValueOf(template)
 	if templateType.Kind() == reflect.Ptr {
 		templateType = reflect.Indirect(templateType)
 	}
 	addon := reflect.New(templateType.Type()).Interface().(Addon)
 
+	// The operator configuration can replace the default image, unless
+	// the MetricSet sets one
+	if image, ok := config.Image(a.Name); ok {
+		if _, found := a.Options["image"]; !found {
+			a = a.DeepCopy()
+			if a.Options == nil {
+				a.Options = map[string]intstr.IntOrString{}
+			}
+			a.Options["image"] = intstr.FromString(image)
+		}
+	}
+
 	// Set options before validation
 	addon.SetOptions(a, set)
 
+	// The list options the addon exports are the ones it accepts
+	unknown := utils.UnknownListOptions(a.ListOptions, addon.ListOptions())
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("addon %s does not have list options %s", a.Name, strings.Join(unknown, ", "))
+	}
+
 	// Validate the addon
 	if !addon.Validate() {
 		return nil, fmt.Errorf("Addon %s did not validate", a.Name)
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestListOptions(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "bench", Namespace: "default"}}
+
+	// Events are kept in order, and round-trip through ListOptions
+	addon := &api.MetricAddon{
+		Name: hpctoolkitIdentifier,
+		ListOptions: map[string][]intstr.IntOrString{
+			"events": {intstr.FromString("IO"), intstr.FromString("REALTIME")},
+		},
+	}
+	a, err := GetAddon(addon, set)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(a.ListOptions()["events"], addon.ListOptions["events"]) {
+		t.Errorf("expected events to round-trip, got %v", a.ListOptions())
+	}
+	if events := a.(*HPCToolkit).hpcrunEvents(); events != "-e IO -e REALTIME" {
+		t.Errorf("unexpected hpcrun events %q", events)
+	}
+
+	// A list option the addon does not declare is an error
+	addon.ListOptions["event"] = addon.ListOptions["events"]
+	_, err = GetAddon(addon, set)
+	if err == nil || !strings.Contains(err.Error(), "does not have list options event") {
+		t.Errorf("expected an unknown list option error, got %v", err)
+	}
+
+	// An addon without list options declares none
+	_, err = GetAddon(&api.MetricAddon{
+		Name:        coredumpIdentifier,
+		ListOptions: map[string][]intstr.IntOrString{"paths": {intstr.FromInt(1)}},
+	}, set)
+	if err == nil || !strings.Contains(err.Error(), "does not have list options paths") {
+		t.Errorf("expected list options to be rejected for %s, got %v", coredumpIdentifier, err)
+	}
+}
+
+func TestAllowedAddons(t *testing.T) {
+	defer config.Set(config.Config{})
+	config.Set(config.Config{Addons: []string{hwlocIdentifier}})
+
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "bench", Namespace: "default"}}
+	if _, err := GetAddon(&api.MetricAddon{Name: hwlocIdentifier}, set); err != nil {
+		t.Errorf("expected an allowed addon, found %s", err)
+	}
+	_, err := GetAddon(&api.MetricAddon{Name: cacheControlIdentifier}, set)
+	if err == nil || !strings.Contains(err.Error(), "not allowed by the operator configuration") {
+		t.Errorf("expected an addon that is not listed to be rejected, found %v", err)
+	}
+}
+
+func TestEmptyVolumeMedium(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "bench", Namespace: "default"}}
+	for medium, valid := range map[string]bool{"": true, "Memory": true, "HugePages": true, "HugePages-2Mi": true, "Disk": false} {
+		addon := &api.MetricAddon{
+			Name: emptyName,
+			Options: map[string]intstr.IntOrString{
+				"name":   intstr.FromString("hugepages"),
+				"path":   intstr.FromString("/dev/hugepages"),
+				"medium": intstr.FromString(medium),
+			},
+		}
+		a, err := GetAddon(addon, set)
+		if (err == nil) != valid {
+			t.Errorf("expected medium %q valid to be %t, got %v", medium, valid, err)
+			continue
+		}
+		if !valid {
+			continue
+		}
+		volumes := a.AssembleVolumes()
+		if len(volumes) != 1 || string(volumes[0].Volume.EmptyDir.Medium) != medium || volumes[0].Path != "/dev/hugepages" {
+			t.Errorf("expected an empty volume at /dev/hugepages with medium %q, got %v", medium, volumes)
+		}
+	}
+}
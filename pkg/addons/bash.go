@@ -0,0 +1,223 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The bash addon copies a static bash from an image into a shared volume, and
+// runs the entrypoints of the metric with it, so metrics written for bash can
+// run in images that only have sh (e.g., alpine or busybox based images).
+const (
+	bashIdentifier = "sys-bash"
+	bashVolumeName = "static-bash"
+)
+
+type BashAddon struct {
+	AddonBase
+
+	// Image with a statically linked bash, and its path in the image
+	image string
+	path  string
+
+	// Where the bash is mounted in the containers
+	mount string
+
+	// Entrypoint for the init container
+	entrypoint string
+
+	// Entrypoints on Windows are run with PowerShell
+	windows bool
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (a BashAddon) Family() string {
+	return AddonFamilySystem
+}
+
+// Validate the paths are absolute, and the pods are not on Windows
+func (a *BashAddon) Validate() bool {
+	if !strings.HasPrefix(a.path, "/") || !strings.HasPrefix(a.mount, "/") {
+		logger.Errorf("🟥️ The sys-bash addon 'path' and 'mount' must be absolute paths, found %q and %q.", a.path, a.mount)
+		return false
+	}
+	if a.windows {
+		logger.Error("🟥️ The sys-bash addon is not supported on Windows nodes.")
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *BashAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = bashIdentifier
+	a.image = "ghcr.io/converged-computing/metric-bash-static:latest"
+	a.path = "/usr/local/bin/bash"
+	a.mount = "/opt/metrics-operator-bash"
+	a.entrypoint = "/metrics_operator/bash-entrypoint.sh"
+	a.windows = m.IsWindows()
+
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	path, ok := metric.Options["path"]
+	if ok {
+		a.path = path.StrVal
+	}
+	mount, ok := metric.Options["mount"]
+	if ok {
+		a.mount = mount.StrVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *BashAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"image":           intstr.FromString(a.image),
+		"path":            intstr.FromString(a.path),
+		"mount":           intstr.FromString(a.mount),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+// AssembleVolumes provides the empty volume for the bash, and the init container entrypoint
+func (a *BashAddon) AssembleVolumes() []specs.VolumeSpec {
+	volume := corev1.Volume{
+		Name: bashVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  bashVolumeName,
+					Path: filepath.Base(a.entrypoint),
+				}},
+			},
+		},
+	}
+	return []specs.VolumeSpec{
+		{
+			Volume: volume,
+			Mount:  true,
+			Path:   a.mount,
+			Target: a.target,
+		},
+		{
+			Volume:   configVolume,
+			ReadOnly: true,
+			Mount:    false,
+			Path:     filepath.Dir(a.entrypoint),
+		},
+	}
+}
+
+// bashContext is for the template of the init container
+type bashContext struct {
+	Path  string
+	Mount string
+}
+
+// bashTemplate copies the bash to the volume, and checks it can run without
+// the libraries of the image it came from
+var bashTemplate = specs.NewTemplate(bashIdentifier, `#!/bin/bash
+if command -v ldd > /dev/null && ldd {{ .Path }} > /dev/null 2>&1; then
+    echo "{{ .Path }} is dynamically linked, and would not run in other images"
+    exit 1
+fi
+mkdir -p {{ .Mount }}
+cp {{ .Path }} {{ .Mount }}/bash
+chmod 755 {{ .Mount }}/bash
+echo "Entrypoints will run with bash $({{ .Mount }}/bash -c 'echo ${BASH_VERSION}')"
+`, bashContext{})
+
+// AssembleContainers adds an init container that copies the bash
+func (a *BashAddon) AssembleContainers() []specs.ContainerSpec {
+	script := bashTemplate.Render(bashContext{Path: a.path, Mount: a.mount})
+	entrypoint := specs.EntrypointScript{
+		Name:   bashVolumeName,
+		Path:   a.entrypoint,
+		Script: filepath.Base(a.entrypoint),
+		Pre:    script,
+	}
+	return []specs.ContainerSpec{{
+		JobName:          a.target,
+		Image:            a.image,
+		Name:             "static-bash",
+		EntrypointScript: entrypoint,
+		InitContainer:    true,
+		Resources:        &api.ContainerResources{},
+		Attributes:       &api.ContainerSpec{},
+		NeedsWrite:       true,
+	}}
+}
+
+// CustomizeEntrypoint scripts
+func (a *BashAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// customizeEntrypoint runs the metric containers with the copied bash
+func (a *BashAddon) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name || containerSpec.InitContainer {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		containerSpec.Interpreter = filepath.Join(a.mount, "bash")
+		containerSpec.EntrypointScript.Pre += fmt.Sprintf("\necho \"%s\"\n", Metadata(a))
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: bashIdentifier,
+		Summary:    "run the metric entrypoints with a static bash copied from an image, for images without bash",
+	}
+	bash := BashAddon{AddonBase: base}
+	Register(&bash)
+}
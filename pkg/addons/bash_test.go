@@ -0,0 +1,88 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestStaticBash(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	_, err = GetAddon(&api.MetricAddon{Name: bashIdentifier, Options: map[string]intstr.IntOrString{
+		"mount": intstr.FromString("bin"),
+	}}, &api.MetricSet{})
+	if err == nil {
+		t.Errorf("expected a relative mount to not validate")
+	}
+
+	// The init container copies the bash to the volume
+	dir := t.TempDir()
+	a, err := GetAddon(&api.MetricAddon{Name: bashIdentifier, Options: map[string]intstr.IntOrString{
+		"path":  intstr.FromString(bash),
+		"mount": intstr.FromString(dir),
+	}}, &api.MetricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := a.AssembleContainers()
+	if len(containers) != 1 || !containers[0].InitContainer {
+		t.Fatalf("expected one init container, found %v", containers)
+	}
+
+	// A fake ldd reports the bash as static, or dynamic
+	bin := t.TempDir()
+	for linking, code := range map[string]string{"static": "1", "dynamic": "0"} {
+		err = os.WriteFile(filepath.Join(bin, "ldd"), []byte("#!/bin/sh\nexit "+code+"\n"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command(bash, "-c", containers[0].EntrypointScript.Pre)
+		cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+		out, err := cmd.CombinedOutput()
+		if linking == "dynamic" {
+			if err == nil {
+				t.Errorf("expected a dynamically linked bash to not be copied:\n%s", out)
+			}
+			continue
+		}
+		if err != nil || !strings.Contains(string(out), "Entrypoints will run with bash") {
+			t.Fatalf("copying the bash failed: %v\n%s", err, out)
+		}
+		_, err = os.Stat(filepath.Join(dir, "bash"))
+		if err != nil {
+			t.Errorf("expected the bash in the volume: %s", err)
+		}
+	}
+
+	// The metric containers (and not other init containers) run with it
+	cs := []*specs.ContainerSpec{
+		{JobName: "l", Shell: "sh", EntrypointScript: specs.EntrypointScript{Path: "/metrics_operator/entrypoint.sh"}},
+		{JobName: "l", InitContainer: true},
+		{JobName: "w"},
+	}
+	a.CustomizeEntrypoints(cs, []*jobset.ReplicatedJob{{Name: "l"}, {Name: "w"}})
+	command := cs[0].EntrypointCommand()
+	if command[0] != filepath.Join(dir, "bash") || command[1] != "/metrics_operator/entrypoint.sh" {
+		t.Errorf("expected the entrypoint to run with the copied bash, found %v", command)
+	}
+	if cs[1].ShellPath() != "/bin/bash" || cs[2].ShellPath() != filepath.Join(dir, "bash") {
+		t.Errorf("expected only metric containers to run with the copied bash, found %s and %s", cs[1].ShellPath(), cs[2].ShellPath())
+	}
+}
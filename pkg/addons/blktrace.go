@@ -0,0 +1,306 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The blktrace addon adds a sidecar that records the block devices backing a mount
+// (e.g., the one a storage benchmark writes to) during the run, with high frequency
+// iostat samples or block layer traces, so device behavior can be lined up with
+// the results of the benchmark
+const (
+	blktraceIdentifier = "perf-blktrace"
+	blktraceVolumeName = "blktrace"
+)
+
+var (
+	blktraceModes = map[string]bool{"iostat": true, "blktrace": true}
+
+	// Block device names (e.g., nvme0n1, sdb1, dm-0)
+	blockDeviceRegex = regexp.MustCompile(`^[-_a-zA-Z0-9]+$`)
+)
+
+type BlktraceAddon struct {
+	AddonBase
+
+	// Container image with iostat (sysstat), blktrace, and blkparse
+	image string
+
+	// iostat or blktrace
+	mode string
+
+	// The devices backing this mount are recorded, and/or the devices listed
+	mount   string
+	devices []string
+
+	// Seconds between iostat samples
+	rate int32
+
+	// Record until the process matching the command exits, or for some seconds
+	command  string
+	duration int32
+
+	// Entrypoint for the sidecar container
+	entrypoint string
+
+	// job name target
+	target string
+}
+
+func (a BlktraceAddon) Family() string {
+	return AddonFamilyPerformance
+}
+
+// Validate we know the devices to record, and when to stop
+func (a *BlktraceAddon) Validate() bool {
+	if _, ok := blktraceModes[a.mode]; !ok {
+		logger.Errorf("🟥️ The perf-blktrace addon mode must be 'iostat' or 'blktrace', found %s.", a.mode)
+		return false
+	}
+	if a.mount == "" && len(a.devices) == 0 {
+		logger.Error("🟥️ The perf-blktrace addon requires a 'mount' (to find the devices backing it) or 'devices' to record.")
+		return false
+	}
+	if a.mount != "" && !filepath.IsAbs(a.mount) {
+		logger.Errorf("🟥️ The perf-blktrace addon mount must be an absolute path, found %s.", a.mount)
+		return false
+	}
+	for _, device := range a.devices {
+		if !blockDeviceRegex.MatchString(device) {
+			logger.Errorf("🟥️ The perf-blktrace addon device %s is not a block device name (e.g., nvme0n1).", device)
+			return false
+		}
+	}
+	if a.command == "" && a.duration <= 0 {
+		logger.Error("🟥️ The perf-blktrace addon requires a 'command' to record until it exits, or a 'duration' in seconds.")
+		return false
+	}
+	if a.rate <= 0 || a.duration < 0 {
+		logger.Error("🟥️ The perf-blktrace addon rate must be greater than 0, and the duration cannot be negative.")
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *BlktraceAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = blktraceIdentifier
+	a.image = "ghcr.io/converged-computing/metric-blktrace:latest"
+	a.entrypoint = "/metrics_operator/blktrace-entrypoint.sh"
+	a.mode = "iostat"
+	a.rate = 1
+
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	mode, ok := metric.Options["mode"]
+	if ok {
+		a.mode = mode.StrVal
+	}
+	mount, ok := metric.Options["mount"]
+	if ok {
+		a.mount = mount.StrVal
+	}
+	devices, ok := metric.Options["devices"]
+	if ok {
+		a.devices = strings.Fields(strings.ReplaceAll(devices.StrVal, ",", " "))
+	}
+	rate, ok := metric.Options["rate"]
+	if ok {
+		a.rate = rate.IntVal
+	}
+	command, ok := metric.Options["command"]
+	if ok {
+		a.command = command.StrVal
+	}
+	duration, ok := metric.Options["duration"]
+	if ok {
+		a.duration = duration.IntVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *BlktraceAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"image":    intstr.FromString(a.image),
+		"mode":     intstr.FromString(a.mode),
+		"mount":    intstr.FromString(a.mount),
+		"devices":  intstr.FromString(strings.Join(a.devices, " ")),
+		"rate":     intstr.FromInt(int(a.rate)),
+		"command":  intstr.FromString(a.command),
+		"duration": intstr.FromInt(int(a.duration)),
+		"target":   intstr.FromString(a.target),
+	}
+}
+
+// AssembleVolumes provides the sidecar entrypoint
+func (a *BlktraceAddon) AssembleVolumes() []specs.VolumeSpec {
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  blktraceVolumeName,
+					Path: filepath.Base(a.entrypoint),
+				}},
+			},
+		},
+	}
+	return []specs.VolumeSpec{{
+		Volume:   configVolume,
+		ReadOnly: true,
+		Mount:    false,
+		Path:     filepath.Dir(a.entrypoint),
+	}}
+}
+
+// blktraceContext is for the template of the recording sidecar
+type blktraceContext struct {
+	Metadata string
+	Mode     string
+	Mount    string
+	Devices  string
+	Rate     int32
+	Command  string
+	Duration int32
+}
+
+// blktraceTemplate finds the devices backing the mount (from the mount table of the
+// application, if we have a command), records them until the application exits (or
+// the duration), and then prints the samples (or a summary of the traces). Times are
+// epoch seconds (and ISO for iostat) to line up with the results of the benchmark.
+var blktraceTemplate = specs.NewTemplate(blktraceIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+dir=${METRICS_OPERATOR_RESULTS:-/tmp}/blktrace
+mkdir -p ${dir}
+{{ if .Command }}echo "Waiting for application PID..."
+pid=$(mo_wait_for_pid {{ quote .Command }})
+mountinfo=/proc/${pid}/mountinfo
+{{ else }}mountinfo=/proc/self/mountinfo
+{{ end }}devices={{ quote .Devices }}
+{{ if .Mount }}
+# The device of the longest (and last) mount point that contains the path, and any devices under it (e.g., for LVM or RAID)
+majmin=$(awk -v path={{ quote .Mount }} '$5 == "/" || $5 == path || index(path, $5 "/") == 1 { if (length($5) >= best) { best = length($5); dev = $3 } } END { print dev }' ${mountinfo})
+if [ -z "${majmin}" ] || [ ! -e /sys/dev/block/${majmin} ]; then
+    echo "{{ .Mount }} is not backed by a block device (${majmin:-no mount found}), it cannot be recorded"
+else
+    device=$(basename $(readlink -f /sys/dev/block/${majmin}))
+    devices="${devices} ${device} $(ls /sys/dev/block/${majmin}/slaves 2>/dev/null | tr '\n' ' ')"
+fi
+{{ end }}devices=$(echo ${devices})
+if [ -z "${devices}" ]; then
+    echo "There are no block devices to record"
+    exit 0
+fi
+echo "Recording devices ${devices}{{ if .Mount }} backing {{ .Mount }}{{ end }} with {{ .Mode }}"
+echo "{{ collectionStart }}"
+echo "START $(date +%s.%N)"
+{{ if eq .Mode "blktrace" }}mountpoint -q /sys/kernel/debug || mount -t debugfs debugfs /sys/kernel/debug
+blktrace $(printf -- '-d /dev/%s ' ${devices}) -D ${dir} > ${dir}/blktrace.log 2>&1 &
+{{ else }}S_TIME_FORMAT=ISO iostat -dxty ${devices} {{ .Rate }} > ${dir}/iostat.txt &
+{{ end }}recorder=$!
+start=$(date +%s)
+while kill -0 ${recorder} 2>/dev/null; do
+    sleep 1
+    {{ if .Command }}kill -0 ${pid} 2>/dev/null || break
+    {{ end }}{{ if gt .Duration 0 }}[ $(( $(date +%s) - start )) -ge {{ .Duration }} ] && break
+    {{ end }}
+done
+kill -TERM ${recorder} 2>/dev/null
+wait ${recorder}
+echo "END $(date +%s.%N)"
+{{ if eq .Mode "blktrace" }}cat ${dir}/blktrace.log
+for device in ${devices}; do
+    echo "{{ separator }}"
+    echo "BLKTRACE ${device}"
+    blkparse -i ${device} -D ${dir} -o ${dir}/${device}.txt > /dev/null 2>&1
+    sed -n '/^Total/,$p' ${dir}/${device}.txt
+done
+{{ else }}cat ${dir}/iostat.txt
+{{ end }}echo "{{ collectionEnd }}"
+`, blktraceContext{})
+
+// AssembleContainers adds the recording sidecar
+func (a *BlktraceAddon) AssembleContainers() []specs.ContainerSpec {
+	script := blktraceTemplate.Render(blktraceContext{
+		Metadata: Metadata(a),
+		Mode:     a.mode,
+		Mount:    a.mount,
+		Devices:  strings.Join(a.devices, " "),
+		Rate:     a.rate,
+		Command:  a.command,
+		Duration: a.duration,
+	})
+	entrypoint := specs.EntrypointScript{
+		Name:   blktraceVolumeName,
+		Path:   a.entrypoint,
+		Script: filepath.Base(a.entrypoint),
+		Pre:    script,
+	}
+
+	// Block layer tracing needs debugfs and CAP_SYS_ADMIN, iostat reads /proc/diskstats
+	attributes := &api.ContainerSpec{}
+	if a.mode == "blktrace" {
+		attributes.SecurityContext.Privileged = true
+	}
+	return []specs.ContainerSpec{{
+		JobName:          a.target,
+		Image:            a.image,
+		Name:             "blktrace",
+		EntrypointScript: entrypoint,
+		Resources:        &api.ContainerResources{},
+		Attributes:       attributes,
+		NeedsWrite:       true,
+	}}
+}
+
+// CustomizeEntrypoints shares the process namespace of targeted replicated jobs,
+// so the sidecar can find the application (and its mounts)
+func (a *BlktraceAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	if a.command != "" {
+		shareProcessNamespace(rjs, a.target)
+	}
+}
+
+// shareProcessNamespace shares the process namespace of the pods of replicated
+// jobs (all if the target is empty), so a sidecar can find application processes
+func shareProcessNamespace(rjs []*jobset.ReplicatedJob, target string) {
+	share := true
+	for _, rj := range rjs {
+		if target != "" && target != rj.Name {
+			continue
+		}
+		rj.Template.Spec.Template.Spec.ShareProcessNamespace = &share
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: blktraceIdentifier,
+		Summary:    "record iostat samples or block layer traces of the devices backing a mount",
+	}
+	blktrace := BlktraceAddon{AddonBase: base}
+	Register(&blktrace)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestBlktrace(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+
+	// Unknown modes, nothing to record, or no end do not validate
+	for _, options := range []map[string]intstr.IntOrString{
+		{"mode": intstr.FromString("perf"), "devices": intstr.FromString("sda"), "duration": intstr.FromInt(10)},
+		{"duration": intstr.FromInt(10)},
+		{"mount": intstr.FromString("data"), "duration": intstr.FromInt(10)},
+		{"devices": intstr.FromString("sda;reboot"), "duration": intstr.FromInt(10)},
+		{"devices": intstr.FromString("sda")},
+		{"devices": intstr.FromString("sda"), "duration": intstr.FromInt(10), "rate": intstr.FromInt(0)},
+	} {
+		_, err := GetAddon(&api.MetricAddon{Name: blktraceIdentifier, Options: options}, &api.MetricSet{})
+		if err == nil {
+			t.Errorf("expected options %v to not validate", options)
+		}
+	}
+
+	// Blktrace is privileged, and a command shares the process namespace
+	a, err := GetAddon(&api.MetricAddon{Name: blktraceIdentifier, Options: map[string]intstr.IntOrString{
+		"mode":    intstr.FromString("blktrace"),
+		"mount":   intstr.FromString("/data"),
+		"command": intstr.FromString("fio"),
+		"target":  intstr.FromString("m"),
+	}}, &api.MetricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := a.AssembleContainers()
+	if len(containers) != 1 || !containers[0].Attributes.SecurityContext.Privileged {
+		t.Errorf("expected a privileged sidecar, found %+v", containers)
+	}
+	rjs := []*jobset.ReplicatedJob{{Name: "m"}, {Name: "n"}}
+	a.CustomizeEntrypoints([]*specs.ContainerSpec{}, rjs)
+	share := rjs[0].Template.Spec.Template.Spec.ShareProcessNamespace
+	if share == nil || !*share || rjs[1].Template.Spec.Template.Spec.ShareProcessNamespace != nil {
+		t.Errorf("expected only the target to share the process namespace")
+	}
+
+	// A fake iostat samples the devices until the duration
+	bin := t.TempDir()
+	err = os.WriteFile(filepath.Join(bin, "iostat"), []byte("#!/bin/bash\nwhile true; do echo \"sample $*\"; sleep 0.5; done\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = GetAddon(&api.MetricAddon{Name: blktraceIdentifier, Options: map[string]intstr.IntOrString{
+		"devices":  intstr.FromString("nvme0n1,sdb"),
+		"duration": intstr.FromInt(2),
+	}}, &api.MetricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers = a.AssembleContainers()
+	if containers[0].Attributes.SecurityContext.Privileged {
+		t.Errorf("expected iostat to not be privileged")
+	}
+	script := strings.TrimPrefix(containers[0].EntrypointScript.Pre, "#!/bin/bash\n")
+	cmd := exec.Command(bash, "-c", specs.Prelude+script)
+	cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"), "METRICS_OPERATOR_RESULTS="+t.TempDir())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("blktrace failed: %s\n%s", err, out)
+	}
+	output := string(out)
+	if !strings.Contains(output, "sample -dxty nvme0n1 sdb 1\n") || !strings.Contains(output, "START ") || !strings.Contains(output, "END ") {
+		t.Errorf("expected timed iostat samples of the devices:\n%s", output)
+	}
+	if !strings.HasSuffix(output, metadata.CollectionEnd+"\n") {
+		t.Errorf("expected collection to end:\n%s", output)
+	}
+}
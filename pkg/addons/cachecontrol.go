@@ -0,0 +1,229 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/utils"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The cache-control addon drops the page cache (and optionally runs fstrim) before
+// the metric command, or before each repetition of it, so storage benchmarks do
+// not measure warm caches. Writing to /proc/sys/vm/drop_caches needs a privileged
+// container, and (like fstrim) affects the whole node, not only the pod.
+const (
+	cacheControlIdentifier = "perf-cache-control"
+)
+
+var (
+	// What to drop, as written to /proc/sys/vm/drop_caches
+	cacheDropValues = map[string]int{"none": 0, "pagecache": 1, "slab": 2, "all": 3}
+
+	// When to drop: once before the first repetition, or before each of them
+	cacheDropWhen = map[string]bool{"before": true, "each": true}
+
+	// Where the kernel takes the caches to drop
+	dropCachesPath = "/proc/sys/vm/drop_caches"
+)
+
+type CacheControlAddon struct {
+	AddonBase
+
+	// What to drop (none, pagecache, slab, or all)
+	drop string
+
+	// When to drop (before or each)
+	when string
+
+	// Number of times to run the metric command
+	repetitions int32
+
+	// Mount points to fstrim before the command (or each repetition)
+	fstrim []string
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (a CacheControlAddon) Family() string {
+	return AddonFamilyPerformance
+}
+
+// Validate what and when to drop
+func (a *CacheControlAddon) Validate() bool {
+	if _, ok := cacheDropValues[a.drop]; !ok {
+		logger.Errorf("🟥️ The perf-cache-control addon drop must be none, pagecache, slab, or all, found %s.", a.drop)
+		return false
+	}
+	if !cacheDropWhen[a.when] {
+		logger.Errorf("🟥️ The perf-cache-control addon when must be before or each, found %s.", a.when)
+		return false
+	}
+	if a.repetitions < 1 {
+		logger.Error("🟥️ The perf-cache-control addon repetitions must be at least 1.")
+		return false
+	}
+	if a.drop == "none" && len(a.fstrim) == 0 {
+		logger.Error("🟥️ The perf-cache-control addon has nothing to do, set drop or fstrim.")
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *CacheControlAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = cacheControlIdentifier
+	a.drop = "all"
+	a.when = "each"
+	a.repetitions = 1
+
+	drop, ok := metric.Options["drop"]
+	if ok {
+		a.drop = drop.StrVal
+	}
+	when, ok := metric.Options["when"]
+	if ok {
+		a.when = when.StrVal
+	}
+	repetitions, ok := metric.Options["repetitions"]
+	if ok {
+		a.repetitions = repetitions.IntVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+	a.fstrim = utils.ListStrings(metric.ListOptions["fstrim"])
+}
+
+// Exported options and list options
+func (a *CacheControlAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"drop":            intstr.FromString(a.drop),
+		"when":            intstr.FromString(a.when),
+		"repetitions":     intstr.FromInt(int(a.repetitions)),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+func (a *CacheControlAddon) ListOptions() map[string][]intstr.IntOrString {
+	return map[string][]intstr.IntOrString{
+		"fstrim": utils.StringList(a.fstrim),
+	}
+}
+
+// CustomizeEntrypoint scripts
+func (a *CacheControlAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// cacheControlContext is for the templates of the cache-control blocks
+type cacheControlContext struct {
+	Metadata    string
+	Drop        string
+	DropValue   int
+	DropPath    string
+	Fstrim      []string
+	Before      bool
+	Repetitions int32
+	Command     string
+}
+
+var (
+	// cacheControlPreTemplate defines mo_cache_drop, a shell function that syncs,
+	// drops caches, and trims. A failure is reported but does not end the run.
+	cacheControlPreTemplate = specs.NewTemplate(cacheControlIdentifier, `
+echo "{{ .Metadata }}"
+mo_cache_drop() {
+    sync
+{{- if gt .DropValue 0 }}
+    if echo {{ .DropValue }} > {{ .DropPath }} 2>/dev/null; then
+        echo "Dropped caches ({{ .Drop }})"
+    else
+        echo "Cannot drop caches ({{ .Drop }}), the container needs to be privileged"
+    fi
+{{- end }}
+{{- if .Fstrim }}
+    for mo_cache_path in {{ join .Fstrim " " }}; do
+        fstrim -v ${mo_cache_path} || echo "Cannot fstrim ${mo_cache_path}"
+    done
+{{- end }}
+}
+`, cacheControlContext{})
+
+	// cacheControlCommandTemplate runs the command for each repetition (separated
+	// by a timepoint), exiting with the last failure
+	cacheControlCommandTemplate = specs.NewTemplate(cacheControlIdentifier+"-command", `mo_cache_status=0
+for mo_cache_repetition in $(seq 1 {{ .Repetitions }}); do
+    [ ${mo_cache_repetition} -eq 1 ] || echo "{{ separator }}"
+    {{ if .Before }}[ ${mo_cache_repetition} -eq 1 ] && {{ end }}mo_cache_drop
+{{ .Command }}
+    mo_cache_last=$?
+    [ ${mo_cache_last} -ne 0 ] && mo_cache_status=${mo_cache_last}
+done
+(exit ${mo_cache_status})`, cacheControlContext{})
+)
+
+// customizeEntrypoint drops caches before the command, and runs it for each
+// repetition (separated by a timepoint), exiting with the last failure
+func (a *CacheControlAddon) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+	context := cacheControlContext{
+		Metadata:    Metadata(a),
+		Drop:        a.drop,
+		DropValue:   cacheDropValues[a.drop],
+		DropPath:    dropCachesPath,
+		Fstrim:      a.fstrim,
+		Before:      a.when == "before",
+		Repetitions: a.repetitions,
+	}
+	pre := cacheControlPreTemplate.Render(context)
+
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name || containerSpec.InitContainer {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		containerSpec.EntrypointScript.Pre += pre
+		context.Command = containerSpec.EntrypointScript.Command
+		containerSpec.EntrypointScript.Command = cacheControlCommandTemplate.Render(context)
+		containerSpec.Attributes.SecurityContext.Privileged = true
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: cacheControlIdentifier,
+		Summary:    "drop the page cache (and fstrim) before the metric command, or each repetition of it",
+	}
+	cache := CacheControlAddon{AddonBase: base}
+	Register(&cache)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestCacheControl(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+
+	// Do not drop the caches of the machine running the tests
+	dropCachesPath = filepath.Join(t.TempDir(), "drop_caches")
+
+	// Unknown values do not validate
+	for _, options := range []map[string]intstr.IntOrString{
+		{"drop": intstr.FromString("everything")},
+		{"when": intstr.FromString("after")},
+		{"repetitions": intstr.FromInt(0)},
+		{"drop": intstr.FromString("none")},
+	} {
+		_, err := GetAddon(&api.MetricAddon{Name: cacheControlIdentifier, Options: options}, &api.MetricSet{})
+		if err == nil {
+			t.Errorf("expected options %v to not validate", options)
+		}
+	}
+
+	tests := []struct {
+		when     string
+		expected int
+	}{
+		{when: "each", expected: 3},
+		{when: "before", expected: 1},
+	}
+	for _, test := range tests {
+		a, err := GetAddon(&api.MetricAddon{
+			Name: cacheControlIdentifier,
+			Options: map[string]intstr.IntOrString{
+				"repetitions": intstr.FromInt(3),
+				"when":        intstr.FromString(test.when),
+			},
+		}, &api.MetricSet{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := []*specs.ContainerSpec{{
+			JobName:          "m",
+			Attributes:       &api.ContainerSpec{},
+			EntrypointScript: specs.EntrypointScript{Command: "echo run; if [ -f fail ]; then false; fi"},
+		}}
+		a.CustomizeEntrypoints(cs, []*jobset.ReplicatedJob{{Name: "m"}})
+		if !cs[0].Attributes.SecurityContext.Privileged {
+			t.Errorf("expected the metric container to be privileged")
+		}
+
+		script := cs[0].EntrypointScript.Pre + "\n" + cs[0].EntrypointScript.Command + "\necho status=$?"
+		cmd := exec.Command(bash, "-c", script)
+		cmd.Dir = t.TempDir()
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("cache control failed: %s\n%s", err, out)
+		}
+		output := string(out)
+		if strings.Count(output, "run\n") != 3 {
+			t.Errorf("expected three repetitions, found %s", output)
+		}
+		if strings.Count(output, metadata.Separator) != 2 {
+			t.Errorf("expected repetitions to be separated by timepoints, found %s", output)
+		}
+		drops := strings.Count(output, "Dropped caches (all)")
+		if drops != test.expected {
+			t.Errorf("expected %d drops when %s, found %d", test.expected, test.when, drops)
+		}
+		if value, err := os.ReadFile(dropCachesPath); err != nil || string(value) != "3\n" {
+			t.Errorf("expected all caches to be dropped, found %q %v", value, err)
+		}
+		if !strings.Contains(output, "status=0") {
+			t.Errorf("expected the command status to be kept, found %s", output)
+		}
+
+		// A failed repetition is the exit status of the command
+		err = os.WriteFile(filepath.Join(cmd.Dir, "fail"), []byte{}, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := cmd.Dir
+		cmd = exec.Command(bash, "-c", script)
+		cmd.Dir = dir
+		out, _ = cmd.CombinedOutput()
+		if !strings.Contains(string(out), "status=1") {
+			t.Errorf("expected a failed repetition to be the exit status, found %s", out)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The clock addon measures the offset of the clock of each node (from chrony,
+// ptp4l, or an NTP probe) at the start and end of the metric, so latency
+// measurements across nodes can be checked for clock drift. The offsets are
+// printed and written to clock.txt in the results of the pod.
+const (
+	clockIdentifier = "sys-clock"
+)
+
+// How to measure the offset: auto tries chrony, ptp, and then an NTP probe
+var clockMethods = map[string]bool{"auto": true, "chrony": true, "ptp": true, "ntp": true}
+
+type ClockAddon struct {
+	AddonBase
+
+	// How to measure the offset (auto, chrony, ptp, or ntp)
+	method string
+
+	// NTP server to probe for the ntp method
+	server string
+
+	// Maximum absolute offset in milliseconds (0 to not check)
+	maxOffset int32
+
+	// Fail before the metric runs if the offset is more than maxOffset
+	fail bool
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (a ClockAddon) Family() string {
+	return AddonFamilySystem
+}
+
+// Validate the method and threshold
+func (a *ClockAddon) Validate() bool {
+	if !clockMethods[a.method] {
+		logger.Errorf("🟥️ The sys-clock addon method must be auto, chrony, ptp, or ntp, found %s.", a.method)
+		return false
+	}
+	if a.maxOffset < 0 {
+		logger.Errorf("🟥️ The sys-clock addon maxOffset must be 0 (not checked) or more milliseconds, found %d.", a.maxOffset)
+		return false
+	}
+	if a.fail && a.maxOffset == 0 {
+		logger.Error("🟥️ The sys-clock addon needs a maxOffset to fail on.")
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *ClockAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = clockIdentifier
+	a.method = "auto"
+	a.server = "pool.ntp.org"
+
+	method, ok := metric.Options["method"]
+	if ok {
+		a.method = method.StrVal
+	}
+	server, ok := metric.Options["server"]
+	if ok {
+		a.server = server.StrVal
+	}
+	maxOffset, ok := metric.Options["maxOffset"]
+	if ok {
+		a.maxOffset = maxOffset.IntVal
+	}
+	fail, ok := metric.Options["fail"]
+	if ok && (fail.StrVal == "true" || fail.StrVal == "yes") {
+		a.fail = true
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *ClockAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"method":          intstr.FromString(a.method),
+		"server":          intstr.FromString(a.server),
+		"maxOffset":       intstr.FromInt(int(a.maxOffset)),
+		"fail":            intstr.FromString(fmt.Sprintf("%t", a.fail)),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+// CustomizeEntrypoint scripts
+func (a *ClockAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// clockContext is for the template of the sys-clock block
+type clockContext struct {
+	Metadata  string
+	Marker    string
+	Method    string
+	Server    string
+	MaxOffset int32
+	Fail      bool
+}
+
+// clockTemplate defines mo_clock, a shell function that prints (and records) the
+// offset of the clock in seconds, and fails if it is more than the maximum offset
+var clockTemplate = specs.NewTemplate(clockIdentifier, `
+echo "{{ .Metadata }}"
+mo_clock() {
+    local offset="" method=""
+    if [ -z "${offset}" ] && [ "{{ .Method }}" = "auto" -o "{{ .Method }}" = "chrony" ] && command -v chronyc > /dev/null 2>&1; then
+        offset=$(chronyc -c tracking 2>/dev/null | cut -d, -f5)
+        method=chrony
+    fi
+    if [ -z "${offset}" ] && [ "{{ .Method }}" = "auto" -o "{{ .Method }}" = "ptp" ] && command -v pmc > /dev/null 2>&1; then
+        offset=$(pmc -u -b 0 'GET TIME_STATUS_NP' 2>/dev/null | awk '/master_offset/ { printf "%.9f", $2 / 1e9; exit }')
+        method=ptp
+    fi
+    if [ -z "${offset}" ] && [ "{{ .Method }}" = "auto" -o "{{ .Method }}" = "ntp" ]; then
+        method=ntp
+        if command -v ntpdate > /dev/null 2>&1; then
+            offset=$(ntpdate -q {{ .Server }} 2>/dev/null | sed -n 's/.*offset \([-+0-9.]*\).*/\1/p' | tail -1)
+        elif command -v sntp > /dev/null 2>&1; then
+            offset=$(sntp -t 5 {{ .Server }} 2>/dev/null | awk '$1 ~ /^[-+]?[0-9]/ { print $1; exit }')
+        elif command -v chronyd > /dev/null 2>&1; then
+            offset=$(chronyd -Q -t 10 "server {{ .Server }} iburst" 2>&1 | sed -n 's/.*offset \([-+0-9.]*\).*/\1/p' | tail -1)
+        fi
+    fi
+    if [ -z "${offset}" ]; then
+        offset=unknown
+        method=none
+    fi
+    local line="{{ .Marker }} $1 ${METRICS_OPERATOR_NODE:-$(hostname)} ${method} ${offset}"
+    echo "${line}"
+    if [ -d "${METRICS_OPERATOR_RESULTS}" ]; then echo "${line}" >> ${METRICS_OPERATOR_RESULTS}/clock.txt; fi
+    [ {{ .MaxOffset }} -gt 0 ] && [ "${offset}" != "unknown" ] || return 0
+    if awk -v offset=${offset} 'BEGIN { if (offset < 0) offset = -offset; exit !(offset * 1000 > {{ .MaxOffset }}) }'; then
+        echo "Clock offset ${offset}s is more than {{ .MaxOffset }}ms"
+        return 1
+    fi
+}
+mo_clock start{{ if .Fail }} || exit 1{{ end }}
+`, clockContext{})
+
+// customizeEntrypoint measures the offset before and after the command. A
+// failure at the start ends the run (if requested), and at the end is reported.
+func (a *ClockAddon) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+	pre := clockTemplate.Render(clockContext{
+		Metadata:  Metadata(a),
+		Marker:    metadata.Clock,
+		Method:    a.method,
+		Server:    a.server,
+		MaxOffset: a.maxOffset,
+		Fail:      a.fail,
+	})
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name || containerSpec.InitContainer {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		containerSpec.EntrypointScript.Pre += pre
+		containerSpec.EntrypointScript.Post = "mo_clock end\n" + containerSpec.EntrypointScript.Post
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: clockIdentifier,
+		Summary:    "report the clock offset of each node (chrony, ptp, or ntp) at the start and end of the metric",
+	}
+	clock := ClockAddon{AddonBase: base}
+	Register(&clock)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestClockOffset(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+
+	// Unknown methods, and failing without a threshold, do not validate
+	for _, options := range []map[string]intstr.IntOrString{
+		{"method": intstr.FromString("gps")},
+		{"maxOffset": intstr.FromInt(-1)},
+		{"fail": intstr.FromString("true")},
+	} {
+		_, err := GetAddon(&api.MetricAddon{Name: clockIdentifier, Options: options}, &api.MetricSet{})
+		if err == nil {
+			t.Errorf("expected options %v to not validate", options)
+		}
+	}
+
+	// Fake chrony (5 ms behind) and ntpdate (20 ms ahead) tools
+	bin := t.TempDir()
+	tools := map[string]string{
+		"chronyc": "echo 'A9FEA9FE,169.254.169.254,3,1700000000.0,-0.005000,0.0,0.0'",
+		"ntpdate": "echo 'server 10.0.0.1, stratum 2, offset 0.020000, delay 0.02'",
+	}
+	for name, script := range tools {
+		err = os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/bash\n"+script+"\n"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		options  map[string]intstr.IntOrString
+		expected string
+		failed   bool
+	}{
+		{name: "chrony first", options: map[string]intstr.IntOrString{}, expected: "chrony -0.005000"},
+		{name: "ntp probe", options: map[string]intstr.IntOrString{"method": intstr.FromString("ntp")}, expected: "ntp 0.020000"},
+		{name: "within threshold", options: map[string]intstr.IntOrString{"maxOffset": intstr.FromInt(10), "fail": intstr.FromString("true")}, expected: "chrony -0.005000"},
+		{
+			name:     "over threshold",
+			options:  map[string]intstr.IntOrString{"method": intstr.FromString("ntp"), "maxOffset": intstr.FromInt(10), "fail": intstr.FromString("true")},
+			expected: "ntp 0.020000",
+			failed:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := GetAddon(&api.MetricAddon{Name: clockIdentifier, Options: test.options}, &api.MetricSet{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cs := []*specs.ContainerSpec{{
+				JobName:          "m",
+				EntrypointScript: specs.EntrypointScript{Command: "echo run", Post: "echo post"},
+			}}
+			a.CustomizeEntrypoints(cs, []*jobset.ReplicatedJob{{Name: "m"}})
+
+			results := t.TempDir()
+			script := cs[0].EntrypointScript.Pre + "\n" + cs[0].EntrypointScript.Command + "\n" + cs[0].EntrypointScript.Post
+			cmd := exec.Command(bash, "-c", script)
+			cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"), "METRICS_OPERATOR_RESULTS="+results, "METRICS_OPERATOR_NODE=node-a")
+			out, err := cmd.CombinedOutput()
+			output := string(out)
+			if test.failed {
+				if err == nil || strings.Contains(output, "run\n") {
+					t.Fatalf("expected the run to end before the command, found %s", output)
+				}
+			} else if err != nil || !strings.Contains(output, "run\n") {
+				t.Fatalf("expected the command to run, found %v %s", err, output)
+			}
+
+			recorded, err := os.ReadFile(filepath.Join(results, "clock.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, when := range []string{"start", "end"} {
+				line := metadata.Clock + " " + when + " node-a " + test.expected
+				if test.failed && when == "end" {
+					line = metadata.Clock + " end"
+					if strings.Contains(string(recorded), line) {
+						t.Errorf("expected no end offset after a failure, found %s", recorded)
+					}
+					continue
+				}
+				if !strings.Contains(output, line) || !strings.Contains(string(recorded), line) {
+					t.Errorf("expected %q printed and recorded, found %s and %s", line, output, recorded)
+				}
+			}
+		})
+	}
+}
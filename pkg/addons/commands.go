@@ -147,6 +147,11 @@ func (a *CommandAddon) DefaultOptions() map[string]intstr.IntOrString {
 	}
 }
 
+// Exported options
+func (a *CommandAddon) Options() map[string]intstr.IntOrString {
+	return a.DefaultOptions()
+}
+
 // CustomizeEntrypoint scripts
 func (a *CommandAddon) CustomizeEntrypoints(
 	cs []*specs.ContainerSpec,
@@ -185,15 +190,8 @@ func (a *CommandAddon) customizeEntrypoint(
 	rj *jobset.ReplicatedJob,
 ) {
 
-	// Generate addon metadata
-	meta := Metadata(a)
-
 	// This should be run after the pre block of the script, and includes our preblock
-	preBlock := `
-echo "%s"
-%s
-`
-	preBlock = fmt.Sprintf(preBlock, meta, a.preBlock)
+	preBlock := blockTemplate.Render(blockContext{Metadata: Metadata(a), Blocks: []string{a.preBlock}})
 
 	// postBlock to possibly run the hpcstruct command should come right after
 	postBlock := fmt.Sprintf("\n%s", a.postBlock)
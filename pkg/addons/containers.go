@@ -44,8 +44,14 @@ type ApplicationAddon struct {
 	// Container Spec has attributes for the container
 	// Do we run this in privileged mode?
 	privileged bool
+
+	// Readiness, liveness, and startup probes (map options)
+	probes map[string]map[string]intstr.IntOrString
 }
 
+// Map option names for probes
+var probeOptions = []string{"readinessProbe", "livenessProbe", "startupProbe"}
+
 // Validate we have an executable provided, and args and optional
 func (a *ApplicationAddon) Validate() bool {
 	if a.image == "" {
@@ -76,10 +82,31 @@ func (a ApplicationAddon) AssembleContainers() []specs.ContainerSpec {
 				Privileged: a.privileged,
 				// TODO add the caps here ptrace admin
 			},
+			Probes: api.Probes{
+				Readiness: a.getProbe("readinessProbe"),
+				Liveness:  a.getProbe("livenessProbe"),
+				Startup:   a.getProbe("startupProbe"),
+			},
 		},
 	}}
 }
 
+// getProbe converts probe map options into a probe for the container spec
+func (a ApplicationAddon) getProbe(name string) api.Probe {
+	probe := api.Probe{}
+	options, ok := a.probes[name]
+	if !ok {
+		return probe
+	}
+	probe.Command = options["command"].StrVal
+	probe.Path = options["path"].StrVal
+	probe.Port = options["port"].IntVal
+	probe.InitialDelaySeconds = options["initialDelaySeconds"].IntVal
+	probe.PeriodSeconds = options["periodSeconds"].IntVal
+	probe.FailureThreshold = options["failureThreshold"].IntVal
+	return probe
+}
+
 func (m ApplicationAddon) Family() string {
 	return AddonFamilyApplication
 }
@@ -87,6 +114,7 @@ func (m ApplicationAddon) Family() string {
 // Set custom options / attributes for the metric
 func (a *ApplicationAddon) SetDefaultOptions(metric *api.MetricAddon) {
 	a.resources = map[string]map[string]intstr.IntOrString{}
+	a.probes = map[string]map[string]intstr.IntOrString{}
 
 	image, ok := metric.Options["image"]
 	if ok {
@@ -128,6 +156,12 @@ func (a *ApplicationAddon) SetDefaultOptions(metric *api.MetricAddon) {
 			a.resources["requests"][key] = value
 		}
 	}
+	for _, name := range probeOptions {
+		probe, ok := metric.MapOptions[name]
+		if ok {
+			a.probes[name] = probe
+		}
+	}
 	if a.entrypoint == "" {
 		a.setDefaultEntrypoint()
 	}
@@ -174,10 +208,14 @@ func (a *ApplicationAddon) MapOptions() map[string]map[string]intstr.IntOrString
 	for k, value := range a.resources["requests"] {
 		requests[k] = value
 	}
-	return map[string]map[string]intstr.IntOrString{
+	options := map[string]map[string]intstr.IntOrString{
 		"resourceLimits":   limits,
 		"resourceRequests": requests,
 	}
+	for name, probe := range a.probes {
+		options[name] = probe
+	}
+	return options
 }
 
 func init() {
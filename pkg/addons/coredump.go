@@ -0,0 +1,431 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+	"path/filepath"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The coredump addon collects core dumps (and a dmesg excerpt) to a volume that
+// outlives the pods (a host path or persistent volume claim) when the command
+// exits abnormally, so crashes in large runs can be debugged later. Writing cores
+// to the volume sets the core pattern of the node, so it must be requested.
+const (
+	coredumpIdentifier  = "debug-coredump"
+	coredumpVolumeName  = "coredump"
+	coredumpRestoreName = "coredump-restore"
+)
+
+type CoredumpAddon struct {
+	AddonBase
+
+	// Image for the init container that prepares the directory (and sets the
+	// core pattern), and the sidecar that restores the core pattern
+	image string
+
+	// Set the (node wide) core pattern to write cores to the volume
+	setCorePattern bool
+
+	// Path to mount the volume for cores in the containers
+	path string
+
+	// Host path for cores, or an existing persistent volume claim
+	hostPath  string
+	claimName string
+
+	// Core size limit (ulimit -c) for the command
+	coreSize string
+
+	// Lines of dmesg to keep when the command exits abnormally
+	dmesgLines int32
+
+	// Directory for cores of this MetricSet (under the path)
+	setName string
+
+	// Entrypoint for the init container
+	entrypoint string
+
+	// The pod runs in a user namespace, where the core pattern cannot be set
+	userNamespaces bool
+
+	// Owner (user and group) of the directory for cores, if the pod runs as a user
+	owner string
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (a CoredumpAddon) Family() string {
+	return AddonFamilyDebug
+}
+
+// Validate we have somewhere to write cores
+func (a *CoredumpAddon) Validate() bool {
+	if a.userNamespaces && a.setCorePattern {
+		logger.Error("🟥️ The debug-coredump addon sets the node core pattern, which cannot be done from a user namespace.")
+		return false
+	}
+	if a.hostPath == "" && a.claimName == "" {
+		logger.Error("🟥️ The debug-coredump addon requires a 'hostPath' or 'claimName' for cores.")
+		return false
+	}
+	if !filepath.IsAbs(a.path) {
+		logger.Errorf("🟥️ The debug-coredump addon path must be absolute, found %s.", a.path)
+		return false
+	}
+	if a.dmesgLines < 0 {
+		logger.Error("🟥️ The debug-coredump addon dmesgLines must be 0 (none) or greater.")
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *CoredumpAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = coredumpIdentifier
+	a.image = "busybox:stable"
+	a.path = "/cores"
+	a.hostPath = "/var/lib/metrics-operator/cores"
+	a.coreSize = "unlimited"
+	a.dmesgLines = 200
+	a.setName = m.Name
+	a.userNamespaces = m.Spec.Pod.UserNamespaces
+	a.owner = getRunAsOwner(m)
+	a.entrypoint = "/metrics_operator/coredump-entrypoint.sh"
+
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	setCorePattern, ok := metric.Options["setCorePattern"]
+	if ok {
+		a.setCorePattern = setCorePattern.StrVal == "true" || setCorePattern.StrVal == "yes"
+	}
+	path, ok := metric.Options["path"]
+	if ok {
+		a.path = path.StrVal
+	}
+	hostPath, ok := metric.Options["hostPath"]
+	if ok {
+		a.hostPath = hostPath.StrVal
+	}
+	claimName, ok := metric.Options["claimName"]
+	if ok {
+		a.claimName = claimName.StrVal
+	}
+	coreSize, ok := metric.Options["coreSize"]
+	if ok {
+		a.coreSize = coreSize.String()
+	}
+	dmesgLines, ok := metric.Options["dmesgLines"]
+	if ok {
+		a.dmesgLines = dmesgLines.IntVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *CoredumpAddon) Options() map[string]intstr.IntOrString {
+	setCorePattern := "false"
+	if a.setCorePattern {
+		setCorePattern = "true"
+	}
+	return map[string]intstr.IntOrString{
+		"image":           intstr.FromString(a.image),
+		"setCorePattern":  intstr.FromString(setCorePattern),
+		"path":            intstr.FromString(a.path),
+		"hostPath":        intstr.FromString(a.hostPath),
+		"claimName":       intstr.FromString(a.claimName),
+		"coreSize":        intstr.FromString(a.coreSize),
+		"dmesgLines":      intstr.FromInt(int(a.dmesgLines)),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+// coreDirectory is where cores for the MetricSet are written
+func (a *CoredumpAddon) coreDirectory() string {
+	return filepath.Join(a.path, a.setName)
+}
+
+// getRunAsOwner returns the owner (for chown) of the runAs user and group of the
+// pods, if any
+func getRunAsOwner(m *api.MetricSet) string {
+	runAs := m.Spec.Pod.RunAs
+	owner := ""
+	if runAs.User > 0 {
+		owner = fmt.Sprintf("%d", runAs.User)
+	}
+	if runAs.Group > 0 {
+		owner += fmt.Sprintf(":%d", runAs.Group)
+	}
+	return owner
+}
+
+// AssembleVolumes provides the volume for cores, and the init container entrypoint
+func (a *CoredumpAddon) AssembleVolumes() []specs.VolumeSpec {
+
+	// A persistent volume claim takes precedence over the host path
+	source := corev1.VolumeSource{
+		HostPath: &corev1.HostPathVolumeSource{
+			Path: a.hostPath,
+			Type: &directoryOrCreate,
+		},
+	}
+	if a.claimName != "" {
+		source = corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: a.claimName,
+			},
+		}
+	}
+	volume := corev1.Volume{
+		Name:         coredumpVolumeName,
+		VolumeSource: source,
+	}
+
+	// The init container entrypoint is generated in the metrics operator config map
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  coredumpVolumeName,
+					Path: filepath.Base(a.entrypoint),
+				}},
+			},
+		},
+	}
+	if a.setCorePattern {
+		configVolume.ConfigMap.Items = append(configVolume.ConfigMap.Items, corev1.KeyToPath{
+			Key:  coredumpRestoreName,
+			Path: filepath.Base(a.restoreEntrypoint()),
+		})
+	}
+	return []specs.VolumeSpec{
+		{
+			Volume: volume,
+			Mount:  true,
+			Path:   a.path,
+		},
+		{
+			Volume:   configVolume,
+			ReadOnly: true,
+			Mount:    false,
+			Path:     filepath.Dir(a.entrypoint),
+		},
+	}
+}
+
+// coredumpContext is for the templates of the debug-coredump blocks
+type coredumpContext struct {
+	Directory      string
+	Owner          string
+	SetCorePattern bool
+	CoreSize       string
+	DmesgLines     int32
+	Command        string
+}
+
+var (
+	// coredumpInitTemplate creates the directory for cores (owned by the user of
+	// the pod), and sets the core pattern to write cores there. The pattern of the
+	// node is saved (unless it is already ours, from another pod on the node) and
+	// each pod on the node is registered, so the last to finish restores it.
+	coredumpInitTemplate = specs.NewTemplate(coredumpIdentifier+"-init", `#!/bin/sh
+mkdir -p {{ .Directory }}
+{{ if .Owner }}chown {{ .Owner }} {{ .Directory }}
+{{ end }}{{ if .SetCorePattern }}pattern="{{ .Directory }}/core.%h.%e.%p.%t"
+saved={{ .Directory }}/.core_pattern.${METRICS_OPERATOR_NODE}
+mkdir -p {{ .Directory }}/.pods.${METRICS_OPERATOR_NODE}
+touch {{ .Directory }}/.pods.${METRICS_OPERATOR_NODE}/$(hostname)
+current=$(cat /proc/sys/kernel/core_pattern)
+if [ "${current}" != "${pattern}" ]; then
+    echo "${current}" > ${saved}
+    echo "Saved kernel.core_pattern ${current} to restore after the run"
+fi
+echo "Setting kernel.core_pattern to ${pattern}"
+echo "${pattern}" > /proc/sys/kernel/core_pattern
+cat /proc/sys/kernel/core_pattern
+{{ end }}`, coredumpContext{})
+
+	// coredumpRestoreTemplate restores the core pattern of the node when the command
+	// is done (or the pod is terminated), if this is the last pod on the node and no
+	// one else changed it since
+	coredumpRestoreTemplate = specs.NewTemplate(coredumpRestoreName, `#!/bin/sh
+pattern="{{ .Directory }}/core.%h.%e.%p.%t"
+saved={{ .Directory }}/.core_pattern.${METRICS_OPERATOR_NODE}
+pods={{ .Directory }}/.pods.${METRICS_OPERATOR_NODE}
+restore() {
+    rm -f ${pods}/$(hostname) {{ .Directory }}/.done.$(hostname)
+    if [ -n "$(ls -A ${pods} 2>/dev/null)" ]; then
+        echo "Other pods on the node are still running, leaving kernel.core_pattern"
+    elif [ "$(cat /proc/sys/kernel/core_pattern)" = "${pattern}" ] && [ -s ${saved} ]; then
+        cat ${saved} > /proc/sys/kernel/core_pattern
+        rm -f ${saved}
+        echo "Restored kernel.core_pattern to $(cat /proc/sys/kernel/core_pattern)"
+    fi
+    exit 0
+}
+trap restore TERM
+while [ ! -e {{ .Directory }}/.done.$(hostname) ]; do
+    sleep 5 &
+    wait $!
+done
+restore
+`, coredumpContext{})
+
+	// coredumpCommandTemplate runs the command, and collects the cores (named by
+	// the pod hostname, or in the working directory without our pattern) and dmesg
+	// for the pod when it fails. The exit code of the command is kept.
+	coredumpCommandTemplate = specs.NewTemplate(coredumpIdentifier, `ulimit -c {{ .CoreSize }} 2>/dev/null || echo "Cannot set the core size limit to {{ .CoreSize }}"
+{{ .Command }}
+mo_core_status=$?
+if [ ${mo_core_status} -ne 0 ]; then
+    mo_core_dir={{ .Directory }}/$(hostname)
+    echo "Command exited with ${mo_core_status}, collecting crash artifacts in ${mo_core_dir}"
+    mkdir -p ${mo_core_dir}
+    {{ if .SetCorePattern }}mv {{ .Directory }}/core.$(hostname).* ${mo_core_dir}/ 2>/dev/null
+    {{ else }}mv core core.* ${mo_core_dir}/ 2>/dev/null
+    {{ end }}if [ {{ .DmesgLines }} -gt 0 ]; then
+        dmesg 2>/dev/null | tail -n {{ .DmesgLines }} > ${mo_core_dir}/dmesg.txt
+        [ -s ${mo_core_dir}/dmesg.txt ] || echo "dmesg is not available (it may require privileges)"
+    fi
+    ls -l ${mo_core_dir}
+fi
+(exit ${mo_core_status})`, coredumpContext{})
+)
+
+// restoreEntrypoint is the entrypoint of the sidecar that restores the core pattern
+func (a *CoredumpAddon) restoreEntrypoint() string {
+	return filepath.Join(filepath.Dir(a.entrypoint), "coredump-restore-entrypoint.sh")
+}
+
+// AssembleContainers adds an init container to prepare the directory for cores.
+// If requested, it is privileged to set the core pattern, and a privileged sidecar
+// restores the pattern. kernel.core_pattern is not namespaced, so it applies to
+// the node (and any other pods on it) while the pods run.
+func (a *CoredumpAddon) AssembleContainers() []specs.ContainerSpec {
+	context := coredumpContext{
+		Directory:      a.coreDirectory(),
+		Owner:          a.owner,
+		SetCorePattern: a.setCorePattern,
+	}
+	node := []corev1.EnvVar{getFieldEnv("METRICS_OPERATOR_NODE", "spec.nodeName")}
+	containers := []specs.ContainerSpec{{
+		JobName: a.target,
+		Image:   a.image,
+		Name:    "coredump",
+		EntrypointScript: specs.EntrypointScript{
+			Name:   coredumpVolumeName,
+			Path:   a.entrypoint,
+			Script: filepath.Base(a.entrypoint),
+			Pre:    coredumpInitTemplate.Render(context),
+		},
+		InitContainer: true,
+		Shell:         "sh",
+		Env:           node,
+		Resources:     &api.ContainerResources{},
+		Attributes: &api.ContainerSpec{
+			SecurityContext: api.SecurityContext{Privileged: a.setCorePattern},
+		},
+		NeedsWrite: true,
+	}}
+	if !a.setCorePattern {
+		return containers
+	}
+	restore := a.restoreEntrypoint()
+	return append(containers, specs.ContainerSpec{
+		JobName: a.target,
+		Image:   a.image,
+		Name:    coredumpRestoreName,
+		EntrypointScript: specs.EntrypointScript{
+			Name:   coredumpRestoreName,
+			Path:   restore,
+			Script: filepath.Base(restore),
+			Pre:    coredumpRestoreTemplate.Render(context),
+		},
+		Shell:      "sh",
+		Env:        node,
+		Resources:  &api.ContainerResources{},
+		Attributes: &api.ContainerSpec{SecurityContext: api.SecurityContext{Privileged: true}},
+		NeedsWrite: true,
+	})
+}
+
+// CustomizeEntrypoint scripts
+func (a *CoredumpAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// CustomizeEntrypoint for a single replicated job
+func (a *CoredumpAddon) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+
+	// Cores (named by the pod hostname) and dmesg are collected per pod
+	context := coredumpContext{
+		Directory:      a.coreDirectory(),
+		SetCorePattern: a.setCorePattern,
+		CoreSize:       a.coreSize,
+		DmesgLines:     a.dmesgLines,
+	}
+	meta := Metadata(a)
+
+	// When the entrypoint exits, the sidecar can restore the core pattern
+	done := ""
+	if a.setCorePattern {
+		done = fmt.Sprintf("mo_core_done() { touch %s/.done.$(hostname) 2>/dev/null; }\nmo_exit_hooks=\"${mo_exit_hooks} mo_core_done\"\n", a.coreDirectory())
+	}
+
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		containerSpec.EntrypointScript.Pre += fmt.Sprintf("\necho \"%s\"\n%s", meta, done)
+		context.Command = containerSpec.EntrypointScript.Command
+		containerSpec.EntrypointScript.Command = coredumpCommandTemplate.Render(context)
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: coredumpIdentifier,
+		Summary:    "capture core dumps and dmesg on abnormal exit to a volume that outlives the pods",
+	}
+	coredump := CoredumpAddon{AddonBase: base}
+	Register(&coredump)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestCoredump(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "crash"}}
+
+	// The core pattern cannot be set from a user namespace, and the path must be absolute
+	userns := &api.MetricSet{}
+	userns.Spec.Pod.UserNamespaces = true
+	_, err = GetAddon(&api.MetricAddon{Name: coredumpIdentifier, Options: map[string]intstr.IntOrString{
+		"setCorePattern": intstr.FromString("true"),
+	}}, userns)
+	if err == nil {
+		t.Errorf("expected setting the core pattern in a user namespace to not validate")
+	}
+	_, err = GetAddon(&api.MetricAddon{Name: coredumpIdentifier}, userns)
+	if err != nil {
+		t.Errorf("expected collecting cores in a user namespace to validate: %s", err)
+	}
+	_, err = GetAddon(&api.MetricAddon{Name: coredumpIdentifier, Options: map[string]intstr.IntOrString{
+		"path": intstr.FromString("cores"),
+	}}, set)
+	if err == nil {
+		t.Errorf("expected a relative path to not validate")
+	}
+
+	// Without the opt-in, nothing is privileged and the node is not changed
+	dir := t.TempDir()
+	options := map[string]intstr.IntOrString{"path": intstr.FromString(dir)}
+	a, err := GetAddon(&api.MetricAddon{Name: coredumpIdentifier, Options: options}, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := a.AssembleContainers()
+	if len(containers) != 1 || containers[0].Attributes.SecurityContext.Privileged || strings.Contains(containers[0].EntrypointScript.Pre, "core_pattern") {
+		t.Fatalf("expected an init container that does not set the core pattern, found %+v", containers)
+	}
+
+	// With the opt-in, a privileged sidecar restores the pattern
+	options["setCorePattern"] = intstr.FromString("true")
+	a, err = GetAddon(&api.MetricAddon{Name: coredumpIdentifier, Options: options}, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers = a.AssembleContainers()
+	if len(containers) != 2 || !containers[0].Attributes.SecurityContext.Privileged || containers[1].Name != coredumpRestoreName {
+		t.Fatalf("expected a privileged init container and a sidecar to restore the pattern, found %+v", containers)
+	}
+	if strings.Contains(containers[0].EntrypointScript.Pre, "chmod") {
+		t.Errorf("expected the directory for cores to not be opened to everyone")
+	}
+
+	// A failed command keeps its exit code, and its cores are collected
+	rj := &jobset.ReplicatedJob{Name: "l"}
+	cs := &specs.ContainerSpec{JobName: "l", EntrypointScript: specs.EntrypointScript{Command: "(exit 3)"}}
+	a.CustomizeEntrypoints([]*specs.ContainerSpec{cs}, []*jobset.ReplicatedJob{rj})
+
+	hostname, _ := os.Hostname()
+	directory := filepath.Join(dir, "crash")
+	err = os.MkdirAll(directory, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(directory, "core."+hostname+".lmp.42.1700000000"), []byte("core"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := specs.Prelude + cs.EntrypointScript.Pre + "\n" + cs.EntrypointScript.Command + "\necho \"status $?\"\n"
+	out, err := exec.Command(bash, "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("coredump failed: %s\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "status 3") {
+		t.Errorf("expected the exit code of the command to be kept:\n%s", out)
+	}
+	_, err = os.Stat(filepath.Join(directory, hostname, "core."+hostname+".lmp.42.1700000000"))
+	if err != nil {
+		t.Errorf("expected the core to be collected for the pod: %s\n%s", err, out)
+	}
+
+	// When the entrypoint exits, the sidecar is told it can restore the pattern
+	_, err = os.Stat(filepath.Join(directory, ".done."+hostname))
+	if err != nil {
+		t.Errorf("expected the entrypoint to be marked done on exit: %s", err)
+	}
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/utils"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The drivers addon asserts that kernel modules (e.g., nvidia, mlx5_core, or
+// lustre) are loaded on the node, at a minimum version, before the metric runs.
+// A node without them fails fast with a report, instead of an MPI or UCX error
+// partway through the run. Modules are shared with the host in /sys/module.
+const (
+	driversIdentifier = "sys-drivers"
+)
+
+// Roots of sysfs and procfs (changed in tests)
+var (
+	driversSysfs  = "/sys"
+	driversProcfs = "/proc"
+)
+
+var (
+	moduleNameRegex    = regexp.MustCompile(`^[-_a-zA-Z0-9]+$`)
+	moduleVersionRegex = regexp.MustCompile(`^[0-9][-.0-9]*$`)
+)
+
+type DriversAddon struct {
+	AddonBase
+
+	// Modules that need to be loaded, and minimum versions of some
+	modules  []string
+	versions map[string]intstr.IntOrString
+
+	// Exit before the command runs if a module is missing or too old
+	fail bool
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (a DriversAddon) Family() string {
+	return AddonFamilySystem
+}
+
+// Validate there are modules, and the names and versions
+func (a *DriversAddon) Validate() bool {
+	if len(a.modules) == 0 && len(a.versions) == 0 {
+		logger.Error("🟥️ The sys-drivers addon needs one or more modules or versions.")
+		return false
+	}
+	for _, module := range a.modules {
+		if !moduleNameRegex.MatchString(module) {
+			logger.Errorf("🟥️ The sys-drivers addon module %q is not a kernel module name.", module)
+			return false
+		}
+	}
+	for module, version := range a.versions {
+		if !moduleNameRegex.MatchString(module) || !moduleVersionRegex.MatchString(version.String()) {
+			logger.Errorf("🟥️ The sys-drivers addon version %s: %q is not a kernel module and version.", module, version.String())
+			return false
+		}
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *DriversAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = driversIdentifier
+	a.fail = true
+	a.modules = utils.ListStrings(metric.ListOptions["modules"])
+	a.versions = map[string]intstr.IntOrString{}
+
+	versions, ok := metric.MapOptions["versions"]
+	if ok {
+		a.versions = versions
+	}
+	fail, ok := metric.Options["fail"]
+	if ok && (fail.StrVal == "false" || fail.StrVal == "no") {
+		a.fail = false
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *DriversAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"fail":            intstr.FromString(fmt.Sprintf("%t", a.fail)),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+func (a *DriversAddon) ListOptions() map[string][]intstr.IntOrString {
+	return map[string][]intstr.IntOrString{
+		"modules": utils.StringList(a.modules),
+	}
+}
+
+func (a *DriversAddon) MapOptions() map[string]map[string]intstr.IntOrString {
+	return map[string]map[string]intstr.IntOrString{
+		"versions": a.versions,
+	}
+}
+
+// getRequirements returns each module (with =<version> for a minimum) in order,
+// the listed modules first
+func (a *DriversAddon) getRequirements() []string {
+	requirements := []string{}
+	seen := map[string]bool{}
+	for _, module := range a.modules {
+		requirement := module
+		if version, ok := a.versions[module]; ok {
+			requirement = module + "=" + version.String()
+		}
+		requirements = append(requirements, requirement)
+		seen[module] = true
+	}
+	rest := []string{}
+	for module := range a.versions {
+		if !seen[module] {
+			rest = append(rest, module)
+		}
+	}
+	sort.Strings(rest)
+	for _, module := range rest {
+		version := a.versions[module]
+		requirements = append(requirements, module+"="+version.String())
+	}
+	return requirements
+}
+
+// driversContext is for the template of the drivers check
+type driversContext struct {
+	Metadata     string
+	Requirements []string
+	Sysfs        string
+	Procfs       string
+	Marker       string
+	Fail         bool
+}
+
+// driversTemplate has a shell function that prints (and records) each module,
+// its version, and whether it is ok, missing, old, or of an unknown version.
+// It fails if any is not ok (and that ends the run, if fail is true). The version
+// is from sysfs, or for drivers that do not have one there, the driver (nvidia),
+// filesystem (lustre), or modinfo.
+var driversTemplate = specs.NewTemplate(driversIdentifier, `
+echo "{{ .Metadata }}"
+mo_version_at_least() {
+    awk -v found="$1" -v minimum="$2" 'BEGIN {
+        n = split(found, f, /[.-]/); m = split(minimum, w, /[.-]/)
+        for (i = 1; i <= m; i++) { if (f[i] + 0 > w[i] + 0) exit 0; if (f[i] + 0 < w[i] + 0) exit 1 }
+        exit 0
+    }'
+}
+mo_drivers() {
+    local failed="" node=${METRICS_OPERATOR_NODE:-$(hostname)}
+    for requirement in {{ join .Requirements " " }}; do
+        local name=${requirement%%=*} minimum="" found="" status=ok
+        case "${requirement}" in *=*) minimum=${requirement#*=};; esac
+        local module=$(echo ${name} | tr '-' '_')
+        if [ ! -d {{ .Sysfs }}/module/${module} ]; then
+            status=missing
+        else
+            found=$(cat {{ .Sysfs }}/module/${module}/version 2>/dev/null)
+            if [ -z "${found}" ] && [ "${module}" = "nvidia" ]; then
+                found=$(sed -n 's/.*Kernel Module[^0-9]*\([0-9][0-9.]*\).*/\1/p' {{ .Procfs }}/driver/nvidia/version 2>/dev/null | head -1)
+            fi
+            if [ -z "${found}" ] && [ "${module}" = "lustre" ]; then
+                found=$(awk '{ print $NF; exit }' {{ .Sysfs }}/fs/lustre/version 2>/dev/null)
+            fi
+            if [ -z "${found}" ] && command -v modinfo > /dev/null 2>&1; then
+                found=$(modinfo -F version ${module} 2>/dev/null)
+            fi
+            if [ -n "${minimum}" ] && [ -z "${found}" ]; then
+                status=unknown
+            elif [ -n "${minimum}" ] && ! mo_version_at_least "${found}" "${minimum}"; then
+                status=old
+            fi
+        fi
+        local line="{{ .Marker }} ${node} ${name} ${status} ${found:-unknown} ${minimum:-any}"
+        echo "${line}"
+        if [ -d "${METRICS_OPERATOR_RESULTS}" ]; then echo "${line}" >> ${METRICS_OPERATOR_RESULTS}/drivers.txt; fi
+        [ "${status}" = "ok" ] || failed="${failed} ${name}:${status}"
+    done
+    [ -z "${failed}" ] && return 0
+    echo "Kernel modules are not ready on ${node}:${failed}"
+    { echo "DriversNotReady${failed}" > /dev/termination-log; } 2>/dev/null
+    return 1
+}
+mo_drivers{{ if .Fail }} || exit 1{{ end }}
+`, driversContext{})
+
+// CustomizeEntrypoint scripts
+func (a *DriversAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// customizeEntrypoint checks the modules before the command. A failure ends
+// the run (unless fail is false, and then it is only reported).
+func (a *DriversAddon) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+	pre := driversTemplate.Render(driversContext{
+		Metadata:     Metadata(a),
+		Requirements: a.getRequirements(),
+		Sysfs:        driversSysfs,
+		Procfs:       driversProcfs,
+		Marker:       metadata.Drivers,
+		Fail:         a.fail,
+	})
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name || containerSpec.InitContainer {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		containerSpec.EntrypointScript.Pre += pre
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: driversIdentifier,
+		Summary:    "assert kernel modules (and minimum versions) are loaded on each node before the metric runs",
+	}
+	drivers := DriversAddon{AddonBase: base}
+	Register(&drivers)
+}
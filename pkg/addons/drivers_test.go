@@ -0,0 +1,163 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestDrivers(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+
+	// No modules, and names or versions that are not, do not validate
+	for _, addon := range []api.MetricAddon{
+		{Name: driversIdentifier},
+		{Name: driversIdentifier, ListOptions: map[string][]intstr.IntOrString{"modules": {intstr.FromString("nvidia; reboot")}}},
+		{Name: driversIdentifier, MapOptions: map[string]map[string]intstr.IntOrString{"versions": {"nvidia": intstr.FromString("latest")}}},
+	} {
+		_, err := GetAddon(&addon, &api.MetricSet{})
+		if err == nil {
+			t.Errorf("expected options %v %v to not validate", addon.ListOptions, addon.MapOptions)
+		}
+	}
+
+	// A fake node with nvidia (version from the driver), mlx5_core, and lustre
+	root := t.TempDir()
+	sysfs := filepath.Join(root, "sys")
+	procfs := filepath.Join(root, "proc")
+	files := map[string]string{
+		"sys/module/nvidia/refcnt":        "1",
+		"sys/module/mlx5_core/version":    "5.8-2.0.3",
+		"sys/module/lustre/refcnt":        "1",
+		"sys/fs/lustre/version":           "2.15.3",
+		"proc/driver/nvidia/version":      "NVRM version: NVIDIA UNIX x86_64 Kernel Module  535.104.05  Sat Aug 19 01:15:15 UTC 2023",
+		"sys/module/ib_core/parameters/x": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(content+"\n"), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	driversSysfs, driversProcfs = sysfs, procfs
+	defer func() { driversSysfs, driversProcfs = "/sys", "/proc" }()
+
+	tests := []struct {
+		name     string
+		modules  []string
+		versions map[string]string
+		fail     string
+		expected []string
+		failed   bool
+	}{
+		{
+			name:     "loaded",
+			modules:  []string{"nvidia", "mlx5-core", "ib_core"},
+			expected: []string{"nvidia ok 535.104.05 any", "mlx5-core ok 5.8-2.0.3 any", "ib_core ok unknown any"},
+		},
+		{
+			name:     "minimum versions",
+			modules:  []string{"nvidia"},
+			versions: map[string]string{"nvidia": "535.54", "lustre": "2.15", "mlx5_core": "5.8-1"},
+			expected: []string{"nvidia ok 535.104.05 535.54", "lustre ok 2.15.3 2.15", "mlx5_core ok 5.8-2.0.3 5.8-1"},
+		},
+		{
+			name:     "too old",
+			versions: map[string]string{"nvidia": "550"},
+			expected: []string{"nvidia old 535.104.05 550"},
+			failed:   true,
+		},
+		{
+			name:     "missing",
+			modules:  []string{"nvidia", "gdrdrv"},
+			expected: []string{"nvidia ok", "gdrdrv missing unknown any"},
+			failed:   true,
+		},
+		{
+			name:     "unknown version",
+			versions: map[string]string{"ib_core": "1.0"},
+			expected: []string{"ib_core unknown unknown 1.0"},
+			failed:   true,
+		},
+		{
+			name:     "reported only",
+			modules:  []string{"gdrdrv"},
+			fail:     "false",
+			expected: []string{"gdrdrv missing unknown any"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addon := &api.MetricAddon{
+				Name:        driversIdentifier,
+				Options:     map[string]intstr.IntOrString{},
+				ListOptions: map[string][]intstr.IntOrString{},
+				MapOptions:  map[string]map[string]intstr.IntOrString{"versions": {}},
+			}
+			for _, module := range test.modules {
+				addon.ListOptions["modules"] = append(addon.ListOptions["modules"], intstr.FromString(module))
+			}
+			for module, version := range test.versions {
+				addon.MapOptions["versions"][module] = intstr.FromString(version)
+			}
+			if test.fail != "" {
+				addon.Options["fail"] = intstr.FromString(test.fail)
+			}
+			a, err := GetAddon(addon, &api.MetricSet{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cs := []*specs.ContainerSpec{{
+				JobName:          "m",
+				EntrypointScript: specs.EntrypointScript{Command: "echo run"},
+			}}
+			a.CustomizeEntrypoints(cs, []*jobset.ReplicatedJob{{Name: "m"}})
+
+			results := t.TempDir()
+			script := cs[0].EntrypointScript.Pre + "\n" + cs[0].EntrypointScript.Command
+			cmd := exec.Command(bash, "-c", script)
+			cmd.Env = append(os.Environ(), "METRICS_OPERATOR_RESULTS="+results, "METRICS_OPERATOR_NODE=node-a")
+			out, err := cmd.CombinedOutput()
+			output := string(out)
+			if test.failed {
+				if err == nil || strings.Contains(output, "run\n") {
+					t.Fatalf("expected the run to end before the command, found %s", output)
+				}
+			} else if err != nil || !strings.Contains(output, "run\n") {
+				t.Fatalf("expected the command to run, found %v %s", err, output)
+			}
+			recorded, err := os.ReadFile(filepath.Join(results, "drivers.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, expected := range test.expected {
+				line := metadata.Drivers + " node-a " + expected
+				if !strings.Contains(output, line) || !strings.Contains(string(recorded), line) {
+					t.Errorf("expected %q printed and recorded, found %s and %s", line, output, recorded)
+				}
+			}
+		})
+	}
+}
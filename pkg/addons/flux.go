@@ -12,7 +12,6 @@ import (
 	"strings"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
@@ -100,7 +99,7 @@ func (a *FluxFramework) SetOptions(metric *api.MetricAddon, set *api.MetricSet)
 	a.pods = set.Spec.Pods
 	a.jobname = set.Name
 	a.namespace = set.Namespace
-	a.serviceName = set.Spec.ServiceName
+	a.serviceName = set.Subdomain()
 	a.queuePolicy = "fcfs"
 	a.SpackViewContainer = "flux-framework"
 	a.launcherIndex = "0"
@@ -203,34 +202,50 @@ func generateRange(size int32, start int32) string {
 	return rangeString
 }
 
-// setSetup assumes flux installed in the view (/opt/view/bin)) and runs additional setup
-// This includes generating the broker config, the curve certificate, and other config assets
-func (a *FluxFramework) setSetup() {
-
-	// fluxRoot for the view is in /opt/view/lib
-	fluxRoot := "/opt/view"
-
-	// Generate hostlists, this is the lead broker
-	leadBroker := fmt.Sprintf("%s-%s-%s-0", a.jobname, a.launcherLetter, a.launcherIndex)
-	workers := fmt.Sprintf("%s-%s-%s-[%s]", a.jobname, a.workerLetter, a.workerIndex, generateRange(a.pods-1, 0))
-	hosts := fmt.Sprintf("%s,%s", leadBroker, workers)
-	fqdn := fmt.Sprintf("%s.%s.svc.cluster.local", a.serviceName, a.namespace)
-
-	// These shouldn't be formatted in block
-	defaultBind := "tcp://eth0:%p"
-	defaultConnect := "tcp://%h" + fmt.Sprintf(".%s:", fqdn) + "%p"
+// fluxContext is for the templates of the flux setup and entrypoint blocks
+type fluxContext struct {
+	Metadata    string
+	PreCommand  string
+	WaitForView string
+	FluxUser    string
+	FluxUid     string
+	FluxRoot    string
+	Mount       string
+	LeadBroker  string
+	Hosts       string
+
+	// Broker configuration and options
+	DefaultBind     string
+	DefaultConnect  string
+	QueuePolicy     string
+	InteractiveFlag string
+	ConnectTimeout  string
+	Quorum          string
+	ZeroMQ          string
+	LogLevel        string
+
+	// Submit (or run) flags and command
+	Flags  string
+	Watch  string
+	Submit string
+
+	// Workers wait for the curve certificate from the lead broker
+	WaitForCurve string
+}
 
-	setup := `#!/bin/sh
-fluxuser=%s
-fluxuid=%s
-fluxroot=%s
+var (
+	// fluxSetupTemplate generates the broker config, the curve certificate, and other config assets
+	fluxSetupTemplate = specs.NewTemplate(fluxIdentifier+"-setup", `#!/bin/sh
+fluxuser={{ .FluxUser }}
+fluxuid={{ .FluxUid }}
+fluxroot={{ .FluxRoot }}
 
 # The mount for the view will be at the user defined mount / view
-mount="%s/view"
+mount="{{ .Mount }}/view"
 
 echo "Hello I am hostname $(hostname) running setup."
 # We only want one host to generate a certificate
-mainHost="%s"
+mainHost="{{ .LeadBroker }}"
 
 # Always use verbose, no reason to not here
 echo "Flux username: ${fluxuser}"
@@ -246,7 +261,7 @@ mkdir -p $fluxroot/var/lib/flux
 
 # These actions need to happen on all hosts
 mkdir -p $fluxroot/etc/flux/system
-hosts="%s"
+hosts="{{ .Hosts }}"
 echo "flux R encode --hosts=${hosts} --local"
 flux R encode --hosts=${hosts} --local > ${fluxroot}/etc/flux/system/R
 
@@ -283,8 +298,8 @@ path = "${mount}/etc/flux/system/R"
 [bootstrap]
 curve_cert = "${mount}/etc/curve/curve.cert"
 default_port = 8050
-default_bind = "%s"
-default_connect = "%s"
+default_bind = "{{ .DefaultBind }}"
+default_connect = "{{ .DefaultConnect }}"
 hosts = [
 	{ host="${hosts}"},
 ]
@@ -294,7 +309,7 @@ period = "1m"
 busytimeout = "50s"
 
 [sched-fluxion-qmanager]
-queue-policy = "%s"
+queue-policy = "{{ .QueuePolicy }}"
 EOT
 
 echo
@@ -330,108 +345,13 @@ if [[ "$(hostname)" == "$mainHost" ]]; then
 	echo "✨ Curve certificate"
 	cat ${fluxroot}/etc/curve/curve.cert	
 fi
-`
-
-	setup = fmt.Sprintf(
-		setup,
-		a.fluxUser,
-		a.fluxUid,
-		fluxRoot,
-		a.Mount,
-		leadBroker,
-		hosts,
-		defaultBind,
-		defaultConnect,
-		a.queuePolicy,
-	)
-	a.Setup = setup
-}
+`, fluxContext{})
 
-// Exported options and list options
-func (a *FluxFramework) Options() map[string]intstr.IntOrString {
-	options := a.DefaultOptions()
-	options["mount"] = intstr.FromString(a.mount)
-	options["quorum"] = intstr.FromString(a.quorum)
-	options["fluxUser"] = intstr.FromString(a.fluxUser)
-	options["fluxUid"] = intstr.FromString(a.fluxUid)
-	options["fluxUid"] = intstr.FromString(a.fluxUid)
-	options["pods"] = intstr.FromInt(int(a.pods))
-	options["connectTimeout"] = intstr.FromString(a.connectTimeout)
-	options["logLevel"] = intstr.FromString(a.logLevel)
-	options["jobname"] = intstr.FromString(a.jobname)
-	options["namespace"] = intstr.FromString(a.namespace)
-	options["serviceName"] = intstr.FromString(a.serviceName)
-	options["queuePolicy"] = intstr.FromString(a.queuePolicy)
-	options["launcherIndex"] = intstr.FromString(a.launcherIndex)
-	options["launcherLetter"] = intstr.FromString(a.launcherLetter)
-	options["workerIndex"] = intstr.FromString(a.workerIndex)
-	options["workerLetter"] = intstr.FromString(a.workerLetter)
-	options["submitCommand"] = intstr.FromString(a.submitCommand)
-	return options
-}
+	// fluxPreTemplate starts the lead broker with the command (or interactive), and the workers
+	fluxPreTemplate = specs.NewTemplate(fluxIdentifier, `
+echo "{{ .Metadata }}"
 
-// CustomizeEntrypoint scripts
-func (a *FluxFramework) CustomizeEntrypoints(
-	cs []*specs.ContainerSpec,
-	rjs []*jobset.ReplicatedJob,
-) {
-	for _, rj := range rjs {
-
-		// Only customize if the replicated job name matches the target
-		if a.target != "" && a.target != rj.Name {
-			continue
-		}
-		a.customizeEntrypoint(cs, rj)
-	}
-
-}
-
-// CustomizeEntrypoint for a single replicated job
-// This is the portion that customizes our application to be run / submit by flux instead of by itself :)
-func (a *FluxFramework) customizeEntrypoint(
-	cs []*specs.ContainerSpec,
-	rj *jobset.ReplicatedJob,
-) {
-
-	// Generate addon metadata
-	meta := Metadata(a)
-
-	interactive := ""
-	if a.interactive {
-		interactive = "-Sbroker.rc2_none"
-	}
-	zeromq := ""
-	if a.debugZeroMQ {
-		zeromq = "-Stbon.zmqdebug=1"
-	}
-
-	// This assumes a certain launcher letter for now
-	// TODO allow to customize letter
-	leadBroker := fmt.Sprintf("%s-%s-%s-0", a.jobname, a.launcherLetter, a.launcherIndex)
-
-	// Watch only works with submit
-	watch := ""
-	if strings.Contains(a.submitCommand, "submit") {
-		watch = "--watch"
-	}
-
-	// Prepare flags for flux. First, add big N if it's > pods, OR not set
-	flags := ""
-	if (a.tasks != 0 && a.tasks > a.pods) || a.tasks == 0 {
-		flags = fmt.Sprintf(" -N %d", a.pods)
-	}
-	// Little n only gets added if it is set
-	if a.tasks != 0 {
-		flags += fmt.Sprintf(" -n %d %s -vvv", a.tasks, a.optionFlags)
-	} else {
-		flags += fmt.Sprintf(" %s -vvv", a.optionFlags)
-	}
-
-	// This should be run after the pre block of the script
-	preBlock := `
-echo "%s"
-
-%s
+{{ .PreCommand }}
 
 # Try to support debian / rocky flavor
 # This is the weakest point - it takes a long time to install with dnf
@@ -439,39 +359,12 @@ echo "%s"
 systemctl enable munge || service munge start || echo "Issue starting munge, might already be started."
 
 # Ensure the flux volume addition is complete.
-wget -q https://github.com/converged-computing/goshare/releases/download/2023-09-06/wait-fs
-chmod +x ./wait-fs
-mv ./wait-fs /usr/bin/goshare-wait-fs
-	
-# Ensure spack view is on the path, wherever it is mounted
-viewbase="%s"
-viewroot=${viewbase}/view
-software="${viewbase}/software"
-viewbin="${viewroot}/bin"
+{{ .WaitForView }}
 fluxpath=${viewbin}/flux
 
-# Important to add AFTER in case software in container duplicated
-export PATH=$PATH:${viewbin}
-	
-# Wait for software directory, and give it time
-goshare-wait-fs -p ${software}
-	
-# Wait for copy to finish
-sleep 10
-	
-# Copy mount software to /opt/software
-cp -R ${viewbase}/software /opt/software
-	
-# Wait for marker (from spack.go) to indicate copy is done
-goshare-wait-fs -p ${fluxpath}
-goshare-wait-fs -p ${viewbase}/metrics-operator-done.txt
-
-# A small extra wait time to be conservative
-sleep 5
-
 # Prefix to run as root (which we will do first)
-fluxuser="%s"
-fluxuid="%s"
+fluxuser="{{ .FluxUser }}"
+fluxuid="{{ .FluxUid }}"
 
 # Add a flux user (required) that should exist before pre-command
 # This might vary between OS
@@ -490,7 +383,7 @@ export STATE_DIR=${viewroot}/var/lib/flux
 mkdir -p ${STATE_DIR}
 
 # Main host <name>-0 and the fully qualified domain name
-mainHost="%s"
+mainHost="{{ .LeadBroker }}"
 
 echo "👋 Hello, I'm $(hostname)"
 echo "The main host is ${mainHost}"
@@ -501,12 +394,12 @@ ls -R ${workdir}
 
 brokerOptions="-Scron.directory=/etc/flux/system/cron.d \
   -Stbon.fanout=256 \
-  -Srundir=/run/flux %s \
+  -Srundir=/run/flux {{ .InteractiveFlag }} \
   -Sstatedir=${STATE_DIR} \
   -Slocal-uri=local:///run/flux/local \
-  -Stbon.connect_timeout=%s \
-  -Sbroker.quorum=%s %s \
-  -Slog-stderr-level=%s \
+  -Stbon.connect_timeout={{ .ConnectTimeout }} \
+  -Sbroker.quorum={{ .Quorum }} {{ .ZeroMQ }} \
+  -Slog-stderr-level={{ .LogLevel }} \
   -Slog-stderr-mode=local"
 
 # Run an interactive cluster, giving no command to flux start
@@ -515,9 +408,9 @@ function run_interactive_cluster() {
     ${asFlux} flux broker --config-path /etc/flux/config ${brokerOptions}
 }
 
-flags="%s"
-watch="%s"
-submit="%s"
+flags="{{ .Flags }}"
+watch="{{ .Watch }}"
+submit="{{ .Submit }}"
 
 # We will copy the curve certificate if the lead, otherwise wait for it
 curvepath=${viewroot}/etc/curve/curve.cert
@@ -534,7 +427,7 @@ if [ $(hostname) == "${mainHost}" ]; then
           continue
 	  fi
       echo "Copying curve.cert to $host"
-	  scp ${curvepath} $host:${curvepath}
+	  mo_retry scp ${curvepath} $host:${curvepath}
   done
   echo "Command provided is: ${command}"
   if [ "${command}" == "" ]; then
@@ -553,8 +446,7 @@ else
 
 # We basically sleep/wait until the lead broker is ready
 echo "🌀 flux start -o --config ${viewroot}/etc/flux/config ${brokerOptions}"
-goshare-wait-fs -p ${curvepath}
-
+{{ .WaitForCurve }}
 # We can keep trying forever, don't care if worker is successful or not
 while true
   do
@@ -566,28 +458,139 @@ while true
 done
 fi
 
-echo "%s"
-echo "%s"
-`
-	preBlock = fmt.Sprintf(
-		preBlock,
-		meta,
-		a.preCommand,
-		a.Mount,
-		a.fluxUser,
-		a.fluxUid,
-		leadBroker,
-		interactive,
-		a.connectTimeout,
-		a.quorum,
-		zeromq,
-		a.logLevel,
-		flags,
-		watch,
-		a.submitCommand,
-		metadata.CollectionStart,
-		metadata.Separator,
-	)
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+`, fluxContext{})
+)
+
+// setSetup assumes flux installed in the view (/opt/view/bin)) and runs additional setup
+// This includes generating the broker config, the curve certificate, and other config assets
+func (a *FluxFramework) setSetup() {
+
+	// fluxRoot for the view is in /opt/view/lib
+	fluxRoot := "/opt/view"
+
+	// Generate hostlists, this is the lead broker
+	leadBroker := fmt.Sprintf("%s-%s-%s-0", a.jobname, a.launcherLetter, a.launcherIndex)
+	workers := fmt.Sprintf("%s-%s-%s-[%s]", a.jobname, a.workerLetter, a.workerIndex, generateRange(a.pods-1, 0))
+	hosts := fmt.Sprintf("%s,%s", leadBroker, workers)
+	fqdn := fmt.Sprintf("%s.%s.svc.cluster.local", a.serviceName, a.namespace)
+
+	// These shouldn't be formatted in block
+	defaultBind := "tcp://eth0:%p"
+	defaultConnect := "tcp://%h" + fmt.Sprintf(".%s:", fqdn) + "%p"
+
+	a.Setup = fluxSetupTemplate.Render(fluxContext{
+		FluxUser:       a.fluxUser,
+		FluxUid:        a.fluxUid,
+		FluxRoot:       fluxRoot,
+		Mount:          a.Mount,
+		LeadBroker:     leadBroker,
+		Hosts:          hosts,
+		DefaultBind:    defaultBind,
+		DefaultConnect: defaultConnect,
+		QueuePolicy:    a.queuePolicy,
+	})
+}
+
+// Exported options and list options
+func (a *FluxFramework) Options() map[string]intstr.IntOrString {
+	options := a.DefaultOptions()
+	options["mount"] = intstr.FromString(a.mount)
+	options["quorum"] = intstr.FromString(a.quorum)
+	options["fluxUser"] = intstr.FromString(a.fluxUser)
+	options["fluxUid"] = intstr.FromString(a.fluxUid)
+	options["fluxUid"] = intstr.FromString(a.fluxUid)
+	options["pods"] = intstr.FromInt(int(a.pods))
+	options["connectTimeout"] = intstr.FromString(a.connectTimeout)
+	options["logLevel"] = intstr.FromString(a.logLevel)
+	options["jobname"] = intstr.FromString(a.jobname)
+	options["namespace"] = intstr.FromString(a.namespace)
+	options["serviceName"] = intstr.FromString(a.serviceName)
+	options["queuePolicy"] = intstr.FromString(a.queuePolicy)
+	options["launcherIndex"] = intstr.FromString(a.launcherIndex)
+	options["launcherLetter"] = intstr.FromString(a.launcherLetter)
+	options["workerIndex"] = intstr.FromString(a.workerIndex)
+	options["workerLetter"] = intstr.FromString(a.workerLetter)
+	options["submitCommand"] = intstr.FromString(a.submitCommand)
+	return options
+}
+
+// CustomizeEntrypoint scripts
+func (a *FluxFramework) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+
+}
+
+// CustomizeEntrypoint for a single replicated job
+// This is the portion that customizes our application to be run / submit by flux instead of by itself :)
+func (a *FluxFramework) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+
+	// Generate addon metadata
+	meta := Metadata(a)
+
+	interactive := ""
+	if a.interactive {
+		interactive = "-Sbroker.rc2_none"
+	}
+	zeromq := ""
+	if a.debugZeroMQ {
+		zeromq = "-Stbon.zmqdebug=1"
+	}
+
+	// This assumes a certain launcher letter for now
+	// TODO allow to customize letter
+	leadBroker := fmt.Sprintf("%s-%s-%s-0", a.jobname, a.launcherLetter, a.launcherIndex)
+
+	// Watch only works with submit
+	watch := ""
+	if strings.Contains(a.submitCommand, "submit") {
+		watch = "--watch"
+	}
+
+	// Prepare flags for flux. First, add big N if it's > pods, OR not set
+	flags := ""
+	if (a.tasks != 0 && a.tasks > a.pods) || a.tasks == 0 {
+		flags = fmt.Sprintf(" -N %d", a.pods)
+	}
+	// Little n only gets added if it is set
+	if a.tasks != 0 {
+		flags += fmt.Sprintf(" -n %d %s -vvv", a.tasks, a.optionFlags)
+	} else {
+		flags += fmt.Sprintf(" %s -vvv", a.optionFlags)
+	}
+
+	// This should be run after the pre block of the script
+	preBlock := fluxPreTemplate.Render(fluxContext{
+		Metadata:        meta,
+		PreCommand:      a.preCommand,
+		WaitForView:     a.WaitForView("${viewbin}/flux"),
+		FluxUser:        a.fluxUser,
+		FluxUid:         a.fluxUid,
+		LeadBroker:      leadBroker,
+		InteractiveFlag: interactive,
+		ConnectTimeout:  a.connectTimeout,
+		Quorum:          a.quorum,
+		ZeroMQ:          zeromq,
+		LogLevel:        a.logLevel,
+		Flags:           flags,
+		Watch:           watch,
+		Submit:          a.submitCommand,
+		WaitForCurve:    WaitForPathBlock(0, "${curvepath}"),
+	})
 
 	// Flux needs this set to false
 	setFQDN := false
@@ -0,0 +1,363 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// FUSE volumes mount an object storage bucket (e.g., s3 or gcs) into the
+// application container by way of a privileged sidecar that runs the FUSE driver
+const (
+	s3fsName        = "volume-s3fs"
+	gcsfuseName     = "volume-gcsfuse"
+	fuseDevice      = "/dev/fuse"
+	fuseCredentials = "/etc/metrics-operator/fuse"
+	fuseSyncRoot    = "/mnt/metrics-operator-fuse"
+)
+
+var (
+	hostToContainer = corev1.MountPropagationHostToContainer
+	charDevice      = corev1.HostPathCharDev
+)
+
+type FuseVolume struct {
+	VolumeBase
+
+	// Container image with the fuse driver
+	image string
+
+	// Bucket to mount
+	bucket string
+
+	// Secret with credentials for the bucket
+	secretName string
+
+	// Custom endpoint (s3 compatible storage)
+	endpoint string
+
+	// Extra arguments for the fuse driver
+	args string
+
+	// Name for the sidecar container
+	containerName string
+
+	// Entrypoint for the sidecar container
+	entrypoint string
+
+	// The pod runs in a user namespace, where the mount cannot be shared
+	userNamespaces bool
+}
+
+// Validate we have a bucket, along with the volume name and path
+func (v *FuseVolume) Validate() bool {
+	if v.bucket == "" {
+		logger.Errorf("🟥️ The %s addon requires a 'bucket' to mount.", v.Identifier)
+		return false
+	}
+
+	// Sharing the mount with the other containers (bidirectional propagation) requires
+	// a privileged sidecar, and /dev/fuse from the host, so it is not adapted for user namespaces
+	if v.userNamespaces {
+		logger.Errorf("🟥️ The %s addon shares its mount with a privileged sidecar, which is not supported with user namespaces.", v.Identifier)
+		return false
+	}
+	return v.DefaultValidate()
+}
+
+// Set custom options / attributes
+func (v *FuseVolume) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	v.Identifier = metric.Name
+	v.userNamespaces = m.Spec.Pod.UserNamespaces
+	v.image = "ghcr.io/converged-computing/metric-s3fs:latest"
+	if v.Identifier == gcsfuseName {
+		v.image = "ghcr.io/converged-computing/metric-gcsfuse:latest"
+	}
+	v.containerName = v.Identifier
+	v.entrypoint = fmt.Sprintf("/metrics_operator/%s-entrypoint.sh", v.Identifier)
+
+	image, ok := metric.Options["image"]
+	if ok {
+		v.image = image.StrVal
+	}
+	bucket, ok := metric.Options["bucket"]
+	if ok {
+		v.bucket = bucket.StrVal
+	}
+	secretName, ok := metric.Options["secretName"]
+	if ok {
+		v.secretName = secretName.StrVal
+	}
+	endpoint, ok := metric.Options["endpoint"]
+	if ok {
+		v.endpoint = endpoint.StrVal
+	}
+	args, ok := metric.Options["args"]
+	if ok {
+		v.args = args.StrVal
+	}
+	v.DefaultSetOptions(metric)
+}
+
+// Exported options and list options
+func (v *FuseVolume) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"name":            intstr.FromString(v.name),
+		"path":            intstr.FromString(v.path),
+		"image":           intstr.FromString(v.image),
+		"bucket":          intstr.FromString(v.bucket),
+		"secretName":      intstr.FromString(v.secretName),
+		"endpoint":        intstr.FromString(v.endpoint),
+		"args":            intstr.FromString(v.args),
+		"target":          intstr.FromString(v.target),
+		"containerTarget": intstr.FromString(v.containerTarget),
+	}
+}
+
+// syncPath is a shared directory used to signal the mount is ready, and the run is done
+func (v *FuseVolume) syncPath() string {
+	return filepath.Join(fuseSyncRoot, v.name)
+}
+
+// AssembleVolumes provides the bucket mount, the fuse device, and a sync directory
+func (v *FuseVolume) AssembleVolumes() []specs.VolumeSpec {
+
+	// The bucket is mounted by the sidecar, and propagated to the application
+	bucket := corev1.Volume{
+		Name: v.name,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	sync := corev1.Volume{
+		Name: fmt.Sprintf("%s-sync", v.name),
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	device := corev1.Volume{
+		Name: fmt.Sprintf("%s-fuse", v.name),
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: fuseDevice,
+				Type: &charDevice,
+			},
+		},
+	}
+
+	// The sidecar entrypoint is generated in the metrics operator config map
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  v.containerName,
+					Path: filepath.Base(v.entrypoint),
+				}},
+			},
+		},
+	}
+	volumes := []specs.VolumeSpec{
+		{
+			Volume:           bucket,
+			Path:             v.path,
+			Mount:            true,
+			ReadOnly:         v.readOnly,
+			Target:           v.target,
+			ContainerTarget:  v.containerTarget,
+			MountPropagation: &hostToContainer,
+			MountProvider:    v.containerName,
+		},
+		{
+			Volume:          sync,
+			Path:            v.syncPath(),
+			Mount:           true,
+			Target:          v.target,
+			ContainerTarget: v.containerTarget,
+			MountProvider:   v.containerName,
+		},
+		{
+			Volume:          device,
+			Path:            fuseDevice,
+			Mount:           true,
+			Target:          v.target,
+			ContainerTarget: v.containerName,
+		},
+		{
+			Volume:   configVolume,
+			ReadOnly: true,
+			Mount:    false,
+			Path:     filepath.Dir(v.entrypoint),
+		},
+	}
+	if v.secretName != "" {
+		secret := corev1.Volume{
+			Name: fmt.Sprintf("%s-credentials", v.name),
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: v.secretName,
+				},
+			},
+		}
+		volumes = append(volumes, specs.VolumeSpec{
+			Volume:          secret,
+			Path:            fuseCredentials,
+			Mount:           true,
+			ReadOnly:        true,
+			Target:          v.target,
+			ContainerTarget: v.containerName,
+		})
+	}
+	return volumes
+}
+
+// mountCommand returns the fuse driver command to run (in the foreground)
+func (v *FuseVolume) mountCommand() string {
+	if v.Identifier == gcsfuseName {
+		command := "gcsfuse --foreground --implicit-dirs -o allow_other"
+		if v.secretName != "" {
+			command += fmt.Sprintf(" --key-file %s/key.json", fuseCredentials)
+		}
+		if v.readOnly {
+			command += " -o ro"
+		}
+		return fmt.Sprintf("%s %s %s %s", command, v.args, v.bucket, v.path)
+	}
+
+	// s3fs requires the password file to not be readable by others
+	command := fmt.Sprintf("s3fs %s %s -f -o allow_other", v.bucket, v.path)
+	if v.secretName != "" {
+		command = fmt.Sprintf("cp %s/passwd /tmp/passwd-s3fs && chmod 600 /tmp/passwd-s3fs\n%s -o passwd_file=/tmp/passwd-s3fs", fuseCredentials, command)
+	} else {
+		command += " -o iam_role=auto"
+	}
+	if v.endpoint != "" {
+		command += fmt.Sprintf(" -o url=%s -o use_path_request_style", v.endpoint)
+	}
+	if v.readOnly {
+		command += " -o ro"
+	}
+	return fmt.Sprintf("%s %s", command, v.args)
+}
+
+// fuseContext is for the template of the fuse sidecar entrypoint
+type fuseContext struct {
+	Metadata     string
+	Path         string
+	Sync         string
+	MountCommand string
+	Bucket       string
+}
+
+// fuseTemplate mounts the bucket, signals the application, and unmounts when it is done
+// (or when the sidecar is stopped, e.g., on SIGTERM)
+var fuseTemplate = specs.NewTemplate("volume-fuse", `#!/bin/bash
+echo "{{ .Metadata }}"
+mkdir -p {{ .Path }} {{ .Sync }}
+mo_fuse_unmount() { mountpoint -q {{ .Path }} && { fusermount -u {{ .Path }} || umount {{ .Path }}; }; }
+mo_exit_hooks="${mo_exit_hooks} mo_fuse_unmount"
+{{ .MountCommand }} &
+fuse=$!
+
+# Wait for the mount, and signal it is ready to the application
+until mountpoint -q {{ .Path }}; do
+    if ! kill -0 ${fuse} 2>/dev/null; then
+        echo "The fuse driver exited before the bucket was mounted"
+        exit 1
+    fi
+    sleep 1
+done
+echo "Bucket {{ .Bucket }} is mounted at {{ .Path }}"
+touch {{ .Sync }}/mounted
+
+# When the application is done, unmount and exit
+mo_wait_for_file {{ .Sync }}/done
+mo_fuse_unmount
+wait ${fuse}
+`, fuseContext{})
+
+// AssembleContainers adds the privileged fuse sidecar
+func (v *FuseVolume) AssembleContainers() []specs.ContainerSpec {
+	script := fuseTemplate.Render(fuseContext{
+		Metadata:     Metadata(v),
+		Path:         v.path,
+		Sync:         v.syncPath(),
+		MountCommand: v.mountCommand(),
+		Bucket:       v.bucket,
+	})
+	entrypoint := specs.EntrypointScript{
+		Name:   v.containerName,
+		Path:   v.entrypoint,
+		Script: filepath.Base(v.entrypoint),
+		Pre:    script,
+	}
+	return []specs.ContainerSpec{{
+		JobName:          v.target,
+		Image:            v.image,
+		Name:             v.containerName,
+		EntrypointScript: entrypoint,
+		Resources:        &api.ContainerResources{},
+		Attributes: &api.ContainerSpec{
+			SecurityContext: api.SecurityContext{
+				Privileged: true,
+				AllowAdmin: true,
+			},
+		},
+		NeedsWrite: true,
+	}}
+}
+
+// CustomizeEntrypoints waits for the mount before the command, and signals when the
+// entrypoint exits (in an exit hook, so a failure or SIGTERM still signals it)
+func (v *FuseVolume) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	sync := v.syncPath()
+	hook := "mo_fuse_done_" + strings.ReplaceAll(v.name, "-", "_")
+	for _, rj := range rjs {
+		if v.target != "" && v.target != rj.Name {
+			continue
+		}
+		for _, containerSpec := range cs {
+			if containerSpec.JobName != rj.Name {
+				continue
+			}
+			if v.containerTarget != "" && containerSpec.Name != "" && v.containerTarget != containerSpec.Name {
+				continue
+			}
+			containerSpec.EntrypointScript.Pre += fmt.Sprintf(
+				"\n%s() { touch %s/done; }\nmo_exit_hooks=\"${mo_exit_hooks} %s\"\necho \"Waiting for bucket %s to be mounted at %s...\"\nmo_wait_for_file %s/mounted\n",
+				hook, sync, hook, v.bucket, v.path, sync,
+			)
+		}
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: s3fsName,
+		Summary:    "mount an s3 (or compatible) bucket with s3fs",
+	}
+	s3fs := FuseVolume{VolumeBase: VolumeBase{AddonBase: base}}
+	Register(&s3fs)
+
+	base = AddonBase{
+		Identifier: gcsfuseName,
+		Summary:    "mount a google cloud storage bucket with gcsfuse",
+	}
+	gcsfuse := FuseVolume{VolumeBase: VolumeBase{AddonBase: base}}
+	Register(&gcsfuse)
+}
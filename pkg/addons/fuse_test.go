@@ -0,0 +1,90 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestFuse(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	a, err := GetAddon(&api.MetricAddon{Name: s3fsName, Options: map[string]intstr.IntOrString{
+		"name":   intstr.FromString("my-results"),
+		"path":   intstr.FromString("/results"),
+		"bucket": intstr.FromString("results"),
+	}}, &api.MetricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	sync := filepath.Join(dir, "sync")
+	bin := filepath.Join(dir, "bin")
+	for path, content := range map[string]string{
+		filepath.Join(bin, "s3fs"):       "#!/bin/sh\nuntil [ -f " + filepath.Join(dir, "unmounted") + " ]; do sleep 1; done\n",
+		filepath.Join(bin, "mountpoint"): "#!/bin/sh\n[ ! -f " + filepath.Join(dir, "unmounted") + " ]\n",
+		filepath.Join(bin, "fusermount"): "#!/bin/sh\necho \"unmount $2\"\ntouch " + filepath.Join(dir, "unmounted") + "\n",
+	} {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// run runs a script after the prelude, with the sync directory in the temporary directory
+	run := func(script string) (string, error) {
+		script = strings.ReplaceAll(specs.Prelude+script, filepath.Join(fuseSyncRoot, "my-results"), sync)
+		script = strings.ReplaceAll(script, "/results", filepath.Join(dir, "results"))
+		cmd := exec.Command(bash, "-c", script)
+		cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	// The application signals it is done when it exits, even if the command fails
+	cs := &specs.ContainerSpec{JobName: "l", EntrypointScript: specs.EntrypointScript{Command: "exit 3"}}
+	a.CustomizeEntrypoints([]*specs.ContainerSpec{cs}, []*jobset.ReplicatedJob{{Name: "l"}})
+	err = os.MkdirAll(sync, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(sync, "mounted"), []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := run(cs.EntrypointScript.Pre + "\n" + cs.EntrypointScript.Command + "\n" + cs.EntrypointScript.Post)
+	if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 3 {
+		t.Errorf("expected the exit code of the command, found %v\n%s", err, out)
+	}
+	_, err = os.Stat(filepath.Join(sync, "done"))
+	if err != nil {
+		t.Fatalf("expected the application to signal it is done: %s\n%s", err, out)
+	}
+
+	// The sidecar then unmounts the bucket, and ends
+	containers := a.AssembleContainers()
+	out, err = run(containers[0].EntrypointScript.Pre)
+	if err != nil || !strings.Contains(out, "unmount "+filepath.Join(dir, "results")) {
+		t.Errorf("expected the sidecar to unmount the bucket: %v\n%s", err, out)
+	}
+}
@@ -12,8 +12,8 @@ import (
 	"strings"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/utils"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 )
@@ -44,9 +44,16 @@ type HPCToolkit struct {
 	containerTarget string
 	events          string
 
+	// Events can also be given as a list, each becomes an -e flag
+	eventList []string
+
 	// For mpirun and similar, mpirun needs to wrap hpcrun and the command, e.g.,
 	// mpirun <MPI args> hpcrun <hpcrun args> <app> <app args>
 	prefix string
+
+	// Add CAP_PERFMON, which the baseline and restricted security profiles do not allow,
+	// and which does not apply to perf events from a user namespace
+	perfmon bool
 }
 
 func (m HPCToolkit) Family() string {
@@ -61,7 +68,7 @@ func (m HPCToolkit) AssembleVolumes() []specs.VolumeSpec {
 
 // Validate we have an executable provided, and args and optional
 func (a *HPCToolkit) Validate() bool {
-	if a.events == "" {
+	if a.hpcrunEvents() == "" {
 		logger.Error("The HPCtoolkit application addon requires one or more 'events' for hpcrun (e.g., -e IO).")
 		return false
 	}
@@ -76,8 +83,12 @@ func (a *HPCToolkit) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
 	a.SetDefaultOptions(metric)
 	a.Mount = "/opt/share"
 	a.VolumeName = "hpctoolkit"
-	a.output = "hpctoolkit-result"
+	a.output = "${METRICS_OPERATOR_RESULTS}/hpctoolkit-result"
 	a.postAnalysis = true
+	a.perfmon = m.IsPrivilegedProfile() && !m.Spec.Pod.UserNamespaces
+	if m.Spec.Pod.UserNamespaces && !m.Spec.PerfEvents.Enabled() {
+		logger.Warnf("🟧️ perf_event_paranoid cannot be set from a user namespace, tune it with perfEvents")
+	}
 	a.Identifier = hpctoolkitIdentifier
 	a.SpackViewContainer = "hpctoolkit"
 	a.InitContainer = true
@@ -111,6 +122,7 @@ func (a *HPCToolkit) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
 	if ok {
 		a.events = events.StrVal
 	}
+	a.eventList = utils.ListStrings(metric.ListOptions["events"])
 	image, ok := metric.Options["image"]
 	if ok {
 		a.image = image.StrVal
@@ -132,74 +144,59 @@ func (a *HPCToolkit) Options() map[string]intstr.IntOrString {
 	options["prefix"] = intstr.FromString(a.prefix)
 	return options
 }
-
-// CustomizeEntrypoint scripts
-func (a *HPCToolkit) CustomizeEntrypoints(
-	cs []*specs.ContainerSpec,
-	rjs []*jobset.ReplicatedJob,
-) {
-	for _, rj := range rjs {
-
-		// Only customize if the replicated job name matches the target
-		if a.target != "" && a.target != rj.Name {
-			continue
-		}
-		a.customizeEntrypoint(cs, rj)
+func (a *HPCToolkit) ListOptions() map[string][]intstr.IntOrString {
+	return map[string][]intstr.IntOrString{
+		"events": utils.StringList(a.eventList),
 	}
-
 }
 
-// CustomizeEntrypoint for a single replicated job
-func (a *HPCToolkit) customizeEntrypoint(
-	cs []*specs.ContainerSpec,
-	rj *jobset.ReplicatedJob,
-) {
+// hpcrunEvents combines the events string with an -e flag for each listed event
+func (a *HPCToolkit) hpcrunEvents() string {
+	events := []string{}
+	if a.events != "" {
+		events = append(events, a.events)
+	}
+	for _, event := range a.eventList {
+		events = append(events, "-e "+event)
+	}
+	return strings.Join(events, " ")
+}
 
-	// Generate addon metadata
-	meta := Metadata(a)
+// hpctoolkitContext is for the templates of the hpctoolkit blocks
+type hpctoolkitContext struct {
+	Metadata    string
+	WaitForView string
+	Output      string
+	Events      string
+	Workdir     string
+}
 
-	// This should be run after the pre block of the script
-	preBlock := `
-echo "%s"
-# Ensure hpcrun and software exists. This is rough, but should be OK with enough wait time
-wget -q https://github.com/converged-computing/goshare/releases/download/2023-09-06/wait-fs
-chmod +x ./wait-fs
-mv ./wait-fs /usr/bin/goshare-wait-fs
-	
-# Ensure spack view is on the path, wherever it is mounted
-viewbase="%s"
-software="${viewbase}/software"
-viewbin="${viewbase}/view/bin"
+var (
+	// hpctoolkitPreTemplate waits for the view, and writes a script for the post analysis
+	hpctoolkitPreTemplate = specs.NewTemplate(hpctoolkitIdentifier, `
+echo "{{ .Metadata }}"
+{{ .WaitForView }}
 hpcrunpath=${viewbin}/hpcrun
 
-# Important to add AFTER in case software in container duplicated
-export PATH=$PATH:${viewbin}
-	
-# Wait for software directory, and give it time
-goshare-wait-fs -p ${software}
-	
-# Wait for copy to finish
-sleep 10
-	
-# Copy mount software to /opt/software
-cp -R %s/software /opt/software
-	
-# Wait for hpcrun and marker to indicate copy is done
-goshare-wait-fs -p ${viewbin}/hpcrun
-goshare-wait-fs -p ${viewbase}/metrics-operator-done.txt
-
-# A small extra wait time to be conservative
-sleep 5
-
-# This will work with capability SYS_ADMIN added.
-# It will only work with privileged set to true AT YOUR OWN RISK!
-echo "-1" | tee /proc/sys/kernel/perf_event_paranoid
+# Perf events need kernel.perf_event_paranoid to allow them. When the MetricSet
+# tunes perf events, a DaemonSet sets it on the node, and we wait for it.
+# Otherwise we set it here, which only works with privileged set to true AT YOUR OWN RISK!
+paranoid=/proc/sys/kernel/perf_event_paranoid
+if [ -n "${METRICS_OPERATOR_PERF_PARANOID}" ]; then
+    for i in $(seq 1 60); do
+        [ "$(cat ${paranoid})" -le "${METRICS_OPERATOR_PERF_PARANOID}" ] && break
+        sleep 1
+    done
+elif [ -w ${paranoid} ]; then
+    echo "-1" > ${paranoid}
+fi
+echo "perf_event_paranoid is $(cat ${paranoid})"
 
 # The output path for the analysis
-output="%s"
+output="{{ .Output }}"
 
 # Run hpcrun. See options with hpcrun -L
-events="%s"
+events="{{ .Events }}"
 
 # Write a script to run for the post block analysis
 here=$(pwd)
@@ -212,24 +209,16 @@ ${viewbin}/hpcprof -o ${output}-database ${output}
 EOF
 chmod +x ./post-run.sh
 
-echo "%s"
-echo "%s"
-`
-	preBlock = fmt.Sprintf(
-		preBlock,
-		meta,
-		a.Mount,
-		a.Mount,
-		a.output,
-		a.events,
-		metadata.CollectionStart,
-		metadata.Separator,
-	)
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+{{ if .Workdir }}
+workdir="{{ .Workdir }}"
+echo "Changing directory to ${workdir}"
+cd ${workdir}
+{{ end }}`, hpctoolkitContext{})
 
-	// postBlock to possibly run the hpcstruct command should come right after
-	postBlock := ""
-	if a.postAnalysis {
-		postBlock = `
+	// hpctoolkitPostTemplate runs the post analysis on each host
+	hpctoolkitPostTemplate = specs.NewTemplate(hpctoolkitIdentifier+"-post", `
 for host in $(cat ./hostlist.txt); do
     echo "Running post analysis for host ${host}"
     if [[ "$host" == "$(hostname)" ]]; then
@@ -239,16 +228,44 @@ for host in $(cat ./hostlist.txt); do
     fi
 done
 echo "METRICS-OPERATOR HPCTOOLKIT Post analysis done."
-`
+`, hpctoolkitContext{})
+)
+
+// CustomizeEntrypoint scripts
+func (a *HPCToolkit) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
 	}
 
-	// Add the working directory, if defined
-	if a.workdir != "" {
-		preBlock += fmt.Sprintf(`
-workdir="%s"
-echo "Changing directory to ${workdir}"
-cd ${workdir}			
-`, a.workdir)
+}
+
+// CustomizeEntrypoint for a single replicated job
+func (a *HPCToolkit) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+
+	// This should be run after the pre block of the script
+	preBlock := hpctoolkitPreTemplate.Render(hpctoolkitContext{
+		Metadata:    Metadata(a),
+		WaitForView: a.WaitForView("${viewbin}/hpcrun"),
+		Output:      a.output,
+		Events:      a.hpcrunEvents(),
+		Workdir:     a.workdir,
+	})
+
+	// postBlock to possibly run the hpcstruct command should come right after
+	postBlock := ""
+	if a.postAnalysis {
+		postBlock = hpctoolkitPostTemplate.Render(hpctoolkitContext{})
 	}
 
 	// We use container names to target specific entrypoint scripts here
@@ -267,6 +284,9 @@ cd ${workdir}
 			continue
 		}
 
+		// CAP_PERFMON allows perf events without SYS_ADMIN (or privileged)
+		containerSpec.Attributes.SecurityContext.AllowPerfmon = a.perfmon
+
 		// If the post command ends with sleep infinity, tweak it
 		isInteractive, updatedPost := deriveUpdatedPost(containerSpec.EntrypointScript.Post)
 		containerSpec.EntrypointScript.Post = updatedPost
@@ -0,0 +1,220 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+	"path/filepath"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The hwloc addon reports the machine topology (NUMA nodes, caches, cores, and
+// devices) of each node before the benchmark runs, so post-hoc analysis can
+// account for hardware differences between runs.
+const (
+	hwlocIdentifier = "sys-hwloc"
+	hwlocVolumeName = "hwloc-topology"
+)
+
+type HwlocAddon struct {
+	AddonBase
+
+	// Image for the init container, with hwloc (and numactl, if available)
+	image string
+
+	// Entrypoint for the init container
+	entrypoint string
+
+	// Print the topology in the log of the metric (it is always written to results)
+	logs bool
+
+	// Report the whole system, and not only the cpus and memory the pod is allowed
+	wholeSystem bool
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (a HwlocAddon) Family() string {
+	return AddonFamilySystem
+}
+
+// Set custom options / attributes for the addon
+func (a *HwlocAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = hwlocIdentifier
+	a.image = "ghcr.io/converged-computing/metric-hwloc:latest"
+	a.entrypoint = "/metrics_operator/hwloc-entrypoint.sh"
+	a.logs = true
+	a.wholeSystem = true
+
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	logs, ok := metric.Options["logs"]
+	if ok && (logs.StrVal == "false" || logs.StrVal == "no") {
+		a.logs = false
+	}
+	wholeSystem, ok := metric.Options["wholeSystem"]
+	if ok && (wholeSystem.StrVal == "false" || wholeSystem.StrVal == "no") {
+		a.wholeSystem = false
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *HwlocAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"image":           intstr.FromString(a.image),
+		"logs":            intstr.FromString(fmt.Sprintf("%t", a.logs)),
+		"wholeSystem":     intstr.FromString(fmt.Sprintf("%t", a.wholeSystem)),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+// AssembleVolumes provides the init container entrypoint. The topology is
+// written to the results volume, which all containers of the pod share.
+func (a *HwlocAddon) AssembleVolumes() []specs.VolumeSpec {
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  hwlocVolumeName,
+					Path: filepath.Base(a.entrypoint),
+				}},
+			},
+		},
+	}
+	return []specs.VolumeSpec{{
+		Volume:   configVolume,
+		ReadOnly: true,
+		Mount:    false,
+		Path:     filepath.Dir(a.entrypoint),
+	}}
+}
+
+// hwlocContext is for the templates of the topology init container and report
+type hwlocContext struct {
+	Metadata      string
+	WholeSystem   bool
+	Logs          bool
+	TopologyStart string
+	TopologyEnd   string
+}
+
+var (
+	// hwlocTemplate writes the topology to the results directory
+	hwlocTemplate = specs.NewTemplate(hwlocIdentifier+"-init", `#!/bin/bash
+topology=${METRICS_OPERATOR_RESULTS:-/tmp}/topology
+mkdir -p ${topology}
+echo "Writing the machine topology of ${METRICS_OPERATOR_NODE:-$(hostname)} to ${topology}"
+lstopo {{ if .WholeSystem }}--whole-system {{ end }}--of xml ${topology}/topology.xml || echo "lstopo is not available, the topology XML will be missing"
+hwloc-ls {{ if .WholeSystem }}--whole-system {{ end }}> ${topology}/hwloc-ls.txt 2>&1
+if command -v numactl > /dev/null; then
+    numactl --hardware > ${topology}/numactl.txt 2>&1
+else
+    for node in /sys/devices/system/node/node*; do
+        [ -d ${node} ] && echo "$(basename ${node}) cpus: $(cat ${node}/cpulist)"
+    done > ${topology}/numactl.txt
+fi
+`, hwlocContext{})
+
+	// hwlocReportTemplate adds the topology to the start of the metric log
+	hwlocReportTemplate = specs.NewTemplate(hwlocIdentifier, `
+echo "{{ .Metadata }}"
+{{ if .Logs }}mo_topology=${METRICS_OPERATOR_RESULTS:-/tmp}/topology
+if [ -d ${mo_topology} ]; then
+    echo "{{ .TopologyStart }} $(hostname)"
+    cat ${mo_topology}/numactl.txt
+    cat ${mo_topology}/topology.xml 2>/dev/null
+    echo "{{ .TopologyEnd }}"
+fi
+{{ end }}`, hwlocContext{})
+)
+
+// AssembleContainers adds an init container that discovers the topology
+func (a *HwlocAddon) AssembleContainers() []specs.ContainerSpec {
+	script := hwlocTemplate.Render(hwlocContext{WholeSystem: a.wholeSystem})
+	entrypoint := specs.EntrypointScript{
+		Name:   hwlocVolumeName,
+		Path:   a.entrypoint,
+		Script: filepath.Base(a.entrypoint),
+		Pre:    script,
+	}
+	return []specs.ContainerSpec{{
+		JobName:          a.target,
+		Image:            a.image,
+		Name:             "hwloc",
+		EntrypointScript: entrypoint,
+		InitContainer:    true,
+		Resources:        &api.ContainerResources{},
+		Attributes:       &api.ContainerSpec{},
+		NeedsWrite:       true,
+	}}
+}
+
+// CustomizeEntrypoint scripts
+func (a *HwlocAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// customizeEntrypoint adds the topology to the start of the metric log
+func (a *HwlocAddon) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+	report := hwlocReportTemplate.Render(hwlocContext{
+		Metadata:      Metadata(a),
+		Logs:          a.logs,
+		TopologyStart: metadata.TopologyStart,
+		TopologyEnd:   metadata.TopologyEnd,
+	})
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name || containerSpec.InitContainer {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		containerSpec.EntrypointScript.Pre += report
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: hwlocIdentifier,
+		Summary:    "report the machine topology (hwloc and numactl) of each node before the metric runs",
+	}
+	hwloc := HwlocAddon{AddonBase: base}
+	Register(&hwloc)
+}
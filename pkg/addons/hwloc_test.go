@@ -0,0 +1,91 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestHwlocTopology(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	a, err := GetAddon(&api.MetricAddon{Name: hwlocIdentifier}, &api.MetricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := a.AssembleContainers()
+	if len(containers) != 1 || !containers[0].InitContainer {
+		t.Fatalf("expected one init container, found %v", containers)
+	}
+
+	// Fake hwloc tools write what they were asked for
+	bin := t.TempDir()
+	tools := map[string]string{
+		"lstopo":   "echo \"<topology $1/>\" > $4",
+		"hwloc-ls": "echo Machine",
+		"numactl":  "echo available: 2 nodes",
+	}
+	for name, script := range tools {
+		err = os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/bash\n"+script+"\n"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	results := t.TempDir()
+	env := append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"), "METRICS_OPERATOR_RESULTS="+results)
+	cmd := exec.Command(bash, "-c", containers[0].EntrypointScript.Pre)
+	cmd.Env = env
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("topology discovery failed: %s\n%s", err, out)
+	}
+	xml, err := os.ReadFile(filepath.Join(results, "topology", "topology.xml"))
+	if err != nil || strings.TrimSpace(string(xml)) != "<topology --whole-system/>" {
+		t.Fatalf("expected the whole system topology, found %q %v", xml, err)
+	}
+
+	// The metric prints it between markers
+	cs := []*specs.ContainerSpec{{JobName: "m"}}
+	a.CustomizeEntrypoints(cs, []*jobset.ReplicatedJob{{Name: "m"}})
+	cmd = exec.Command(bash, "-c", cs[0].EntrypointScript.Pre)
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("topology report failed: %s\n%s", err, out)
+	}
+	for _, expected := range []string{metadata.TopologyStart, "available: 2 nodes", "<topology --whole-system/>", metadata.TopologyEnd} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("expected %q in the report, found %s", expected, out)
+		}
+	}
+
+	// Unless logs are disabled
+	a, err = GetAddon(&api.MetricAddon{
+		Name:    hwlocIdentifier,
+		Options: map[string]intstr.IntOrString{"logs": intstr.FromString("false")},
+	}, &api.MetricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs = []*specs.ContainerSpec{{JobName: "m"}}
+	a.CustomizeEntrypoints(cs, []*jobset.ReplicatedJob{{Name: "m"}})
+	if strings.Contains(cs[0].EntrypointScript.Pre, metadata.TopologyStart) {
+		t.Errorf("expected no topology in the log, found %s", cs[0].EntrypointScript.Pre)
+	}
+}
@@ -0,0 +1,333 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+	"path/filepath"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The IPMI addon samples node power, fans, and temperature from the BMC,
+// either in-band with ipmitool or out of band via a Redfish endpoint.
+const (
+	ipmiIdentifier = "perf-ipmi"
+	ipmiVolumeName = "ipmi"
+	ipmiSecretPath = "/etc/metrics-operator/ipmi"
+)
+
+type IPMIAddon struct {
+	AddonBase
+
+	// Container image with ipmitool and curl
+	image string
+
+	// ipmi or redfish
+	mode string
+
+	// BMC host (for ipmi, empty means in-band via /dev/ipmi0)
+	host string
+
+	// Secret with username and password keys for the BMC
+	secretName string
+
+	// Redfish chassis identifier
+	chassis string
+
+	// Seconds between samples, and number of samples (0 is indefinite)
+	rate        int32
+	completions int32
+
+	// If set, sample for the lifetime of the process matching this command
+	command string
+
+	// Run the pod on the host network (to reach the BMC)
+	hostNetwork bool
+
+	// Skip verifying the Redfish certificate
+	insecure bool
+
+	// Entrypoint for the sidecar container
+	entrypoint string
+
+	// job name target
+	target string
+}
+
+func (a IPMIAddon) Family() string {
+	return AddonFamilyPerformance
+}
+
+// Validate the mode, and that redfish has what it needs
+func (a *IPMIAddon) Validate() bool {
+	if a.mode != "ipmi" && a.mode != "redfish" {
+		logger.Errorf("🟥️ The perf-ipmi addon mode must be 'ipmi' or 'redfish', found %s.", a.mode)
+		return false
+	}
+	if a.mode == "redfish" && (a.host == "" || a.secretName == "") {
+		logger.Error("🟥️ The perf-ipmi addon in redfish mode requires a 'host' and 'secretName'.")
+		return false
+	}
+	if a.host != "" && a.secretName == "" {
+		logger.Error("🟥️ The perf-ipmi addon requires a 'secretName' with credentials for the BMC host.")
+		return false
+	}
+	if a.rate <= 0 {
+		logger.Error("🟥️ The perf-ipmi addon requires a 'rate' greater than 0.")
+		return false
+	}
+	if a.command == "" && a.completions <= 0 {
+		logger.Error("🟥️ The perf-ipmi addon requires a 'command' to sample until it exits, or a number of 'completions'.")
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *IPMIAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = ipmiIdentifier
+	a.image = "ghcr.io/converged-computing/metric-ipmi:latest"
+	a.entrypoint = "/metrics_operator/ipmi-entrypoint.sh"
+	a.mode = "ipmi"
+	a.chassis = "1"
+	a.rate = 10
+
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	mode, ok := metric.Options["mode"]
+	if ok {
+		a.mode = mode.StrVal
+	}
+	host, ok := metric.Options["host"]
+	if ok {
+		a.host = host.StrVal
+	}
+	secretName, ok := metric.Options["secretName"]
+	if ok {
+		a.secretName = secretName.StrVal
+	}
+	chassis, ok := metric.Options["chassis"]
+	if ok {
+		a.chassis = chassis.String()
+	}
+	rate, ok := metric.Options["rate"]
+	if ok {
+		a.rate = rate.IntVal
+	}
+	completions, ok := metric.Options["completions"]
+	if ok {
+		a.completions = completions.IntVal
+	}
+	command, ok := metric.Options["command"]
+	if ok {
+		a.command = command.StrVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+
+	// In-band ipmi uses the device, so only a BMC host needs the host network
+	a.hostNetwork = a.host != ""
+	hostNetwork, ok := metric.Options["hostNetwork"]
+	if ok {
+		a.hostNetwork = hostNetwork.StrVal == "true" || hostNetwork.StrVal == "yes"
+	}
+	insecure, ok := metric.Options["insecure"]
+	if ok {
+		a.insecure = insecure.StrVal == "true" || insecure.StrVal == "yes"
+	}
+}
+
+// Exported options and list options
+func (a *IPMIAddon) Options() map[string]intstr.IntOrString {
+	hostNetwork := "false"
+	if a.hostNetwork {
+		hostNetwork = "true"
+	}
+	insecure := "false"
+	if a.insecure {
+		insecure = "true"
+	}
+	return map[string]intstr.IntOrString{
+		"image":       intstr.FromString(a.image),
+		"mode":        intstr.FromString(a.mode),
+		"host":        intstr.FromString(a.host),
+		"secretName":  intstr.FromString(a.secretName),
+		"chassis":     intstr.FromString(a.chassis),
+		"rate":        intstr.FromInt(int(a.rate)),
+		"completions": intstr.FromInt(int(a.completions)),
+		"command":     intstr.FromString(a.command),
+		"target":      intstr.FromString(a.target),
+		"hostNetwork": intstr.FromString(hostNetwork),
+		"insecure":    intstr.FromString(insecure),
+	}
+}
+
+// AssembleVolumes provides the sidecar entrypoint and (optionally) the credentials
+func (a *IPMIAddon) AssembleVolumes() []specs.VolumeSpec {
+
+	// The sidecar entrypoint is generated in the metrics operator config map
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  ipmiVolumeName,
+					Path: filepath.Base(a.entrypoint),
+				}},
+			},
+		},
+	}
+	volumes := []specs.VolumeSpec{{
+		Volume:   configVolume,
+		ReadOnly: true,
+		Mount:    false,
+		Path:     filepath.Dir(a.entrypoint),
+	}}
+	if a.secretName != "" {
+		secret := corev1.Volume{
+			Name: ipmiVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: a.secretName,
+				},
+			},
+		}
+		volumes = append(volumes, specs.VolumeSpec{
+			Volume:   secret,
+			ReadOnly: true,
+			Mount:    true,
+			Path:     ipmiSecretPath,
+		})
+	}
+	return volumes
+}
+
+// sampleBlock returns the commands for one sample, depending on the mode
+func (a *IPMIAddon) sampleBlock() string {
+	if a.mode == "redfish" {
+		return fmt.Sprintf(`	echo "POWER"
+	redfish https://%s/redfish/v1/Chassis/%s/Power
+	echo
+	echo "THERMAL"
+	redfish https://%s/redfish/v1/Chassis/%s/Thermal
+	echo`, a.host, a.chassis, a.host, a.chassis)
+	}
+	return `	echo "POWER"
+	ipmi dcmi power reading
+	echo "FANS"
+	ipmi sdr type Fan
+	echo "TEMPERATURE"
+	ipmi sdr type Temperature`
+}
+
+// ipmiContext is for the template of the sampling sidecar
+type ipmiContext struct {
+	Metadata    string
+	Credentials string
+	Lan         string
+	TLS         string
+	Sampler     string
+}
+
+// ipmiTemplate samples power and sensors until the completions (or application) are done.
+// Credentials are not put on command lines (where other processes can see them): ipmitool
+// reads the password file, and curl reads the user from a config on stdin.
+var ipmiTemplate = specs.NewTemplate(ipmiIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+{{ .Credentials }}
+ipmi() { ipmitool {{ .Lan }} "$@"; }
+redfish() { echo "user = \"${user}\"" | curl -s {{ .TLS }} -K - "$@"; }
+{{ .Sampler }}`, ipmiContext{})
+
+// AssembleContainers adds the privileged sampling sidecar
+func (a *IPMIAddon) AssembleContainers() []specs.ContainerSpec {
+
+	// Credentials (if provided) are read from the mounted secret
+	credentials := ""
+	if a.secretName != "" {
+		credentials = fmt.Sprintf(`username=$(cat %s/username)
+user=$(printf '%%s:%%s' "${username}" "$(cat %s/password)" | sed 's/[\\"]/\\&/g')`, ipmiSecretPath, ipmiSecretPath)
+	}
+
+	// The Redfish certificate is verified, with a ca.crt from the secret if it has one
+	tls := "-k"
+	if !a.insecure {
+		tls = fmt.Sprintf("$([ -f %s/ca.crt ] && echo --cacert %s/ca.crt)", ipmiSecretPath, ipmiSecretPath)
+	}
+
+	// ipmitool is in-band unless we are given a host
+	lan := ""
+	if a.mode == "ipmi" && a.host != "" {
+		lan = fmt.Sprintf(`-I lanplus -H %s -U "${username}" -f %s/password`, a.host, ipmiSecretPath)
+	}
+
+	script := ipmiTemplate.Render(ipmiContext{
+		Metadata:    Metadata(a),
+		Credentials: credentials,
+		Lan:         lan,
+		TLS:         tls,
+		Sampler:     samplingBlock(a.sampleBlock(), a.rate, a.completions, a.command),
+	})
+	entrypoint := specs.EntrypointScript{
+		Name:   ipmiVolumeName,
+		Path:   a.entrypoint,
+		Script: filepath.Base(a.entrypoint),
+		Pre:    script,
+	}
+	return []specs.ContainerSpec{{
+		JobName:          a.target,
+		Image:            a.image,
+		Name:             "ipmi",
+		EntrypointScript: entrypoint,
+		Resources:        &api.ContainerResources{},
+		Attributes: &api.ContainerSpec{
+			SecurityContext: api.SecurityContext{
+				Privileged: true,
+			},
+		},
+		NeedsWrite: true,
+	}}
+}
+
+// CustomizeEntrypoints puts targeted replicated jobs on the host network, and
+// shares the process namespace to watch the application
+func (a *IPMIAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	if a.command != "" {
+		shareProcessNamespace(rjs, a.target)
+	}
+	if !a.hostNetwork {
+		return
+	}
+	for _, rj := range rjs {
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		rj.Template.Spec.Template.Spec.HostNetwork = true
+		rj.Template.Spec.Template.Spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: ipmiIdentifier,
+		Summary:    "sample node power, fans, and temperature with ipmitool or redfish",
+	}
+	ipmi := IPMIAddon{AddonBase: base}
+	Register(&ipmi)
+}
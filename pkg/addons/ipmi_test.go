@@ -0,0 +1,115 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestIPMI(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	set := &api.MetricSet{}
+
+	// Without a command or completions, the sidecar would never end
+	_, err = GetAddon(&api.MetricAddon{Name: ipmiIdentifier}, set)
+	if err == nil {
+		t.Errorf("expected sampling without an end to not validate")
+	}
+
+	// Watching a command shares the process namespace, and in-band ipmi stays off the host network
+	a, err := GetAddon(&api.MetricAddon{Name: ipmiIdentifier, Options: map[string]intstr.IntOrString{
+		"command": intstr.FromString("lmp"),
+	}}, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rj := &jobset.ReplicatedJob{Name: "l"}
+	a.CustomizeEntrypoints([]*specs.ContainerSpec{}, []*jobset.ReplicatedJob{rj})
+	pod := rj.Template.Spec.Template.Spec
+	if pod.ShareProcessNamespace == nil || !*pod.ShareProcessNamespace || pod.HostNetwork {
+		t.Errorf("expected a shared process namespace without the host network, found %+v", pod)
+	}
+
+	// The ipmitool password is read from the secret, not the command line
+	a, err = GetAddon(&api.MetricAddon{Name: ipmiIdentifier, Options: map[string]intstr.IntOrString{
+		"host":        intstr.FromString("bmc.example.com"),
+		"secretName":  intstr.FromString("bmc-credentials"),
+		"completions": intstr.FromInt(1),
+	}}, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := a.AssembleContainers()[0].EntrypointScript.Pre
+	if strings.Contains(script, "-P ") || !strings.Contains(script, "-f "+ipmiSecretPath+"/password") {
+		t.Errorf("expected ipmitool to read the password file:\n%s", script)
+	}
+
+	// Redfish verifies the certificate, and curl gets the credentials on stdin
+	a, err = GetAddon(&api.MetricAddon{Name: ipmiIdentifier, Options: map[string]intstr.IntOrString{
+		"mode":        intstr.FromString("redfish"),
+		"host":        intstr.FromString("bmc.example.com"),
+		"secretName":  intstr.FromString("bmc-credentials"),
+		"completions": intstr.FromInt(1),
+		"rate":        intstr.FromInt(1),
+	}}, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	bin := filepath.Join(dir, "bin")
+	for path, content := range map[string]string{
+		filepath.Join(secret, "username"): "admin",
+		filepath.Join(secret, "password"): `pa"ss\word`,
+		filepath.Join(secret, "ca.crt"):   "certificate",
+		filepath.Join(bin, "curl"):        "#!/bin/sh\necho \"args $*\"\ncat\n",
+	} {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	script = strings.ReplaceAll(a.AssembleContainers()[0].EntrypointScript.Pre, ipmiSecretPath, secret)
+	cmd := exec.Command(bash, "-c", specs.Prelude+script)
+	cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("ipmi failed: %s\n%s", err, out)
+	}
+	for _, expected := range []string{
+		"args -s --cacert " + secret + "/ca.crt -K - https://bmc.example.com/redfish/v1/Chassis/1/Power",
+		`user = "admin:pa\"ss\\word"`,
+	} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("expected %q in the output:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(string(out), "args -sk") || strings.Contains(string(out), "-u ") {
+		t.Errorf("expected the certificate to be verified and no credentials in arguments:\n%s", out)
+	}
+	if strings.Count(string(out), metadata.Separator) != 1 {
+		t.Errorf("expected one sample for one completion:\n%s", out)
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+	"path/filepath"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The kubelet addon samples the pod's cgroup stats (cpu, memory, network, filesystem)
+// from the kubelet summary API (cAdvisor) or the metrics server, without privileged tooling
+const (
+	kubeletIdentifier = "perf-kubelet"
+	kubeletVolumeName = "kubelet-stats"
+)
+
+var (
+	kubeletSources = map[string]string{
+
+		// The kubelet summary API via the API server node proxy
+		"kubelet": `curl -s --cacert ${cacert} -H "Authorization: Bearer ${token}" https://kubernetes.default.svc/api/v1/nodes/${NODE_NAME}/proxy/stats/summary | jq -c --arg pod ${POD_NAME} --arg ns ${POD_NAMESPACE} '.pods[] | select(.podRef.name == $pod and .podRef.namespace == $ns)'`,
+
+		// The metrics server (cpu and memory only)
+		"metrics-server": `curl -s --cacert ${cacert} -H "Authorization: Bearer ${token}" https://kubernetes.default.svc/apis/metrics.k8s.io/v1beta1/namespaces/${POD_NAMESPACE}/pods/${POD_NAME} | jq -c .`,
+	}
+)
+
+type KubeletStats struct {
+	AddonBase
+
+	// Container image with curl and jq
+	image string
+
+	// kubelet or metrics-server
+	source string
+
+	// Seconds between samples, and number of samples (0 is indefinite)
+	rate        int32
+	completions int32
+
+	// If set, sample for the lifetime of the process matching this command
+	command string
+
+	// Entrypoint for the sidecar container
+	entrypoint string
+
+	// job name target
+	target string
+}
+
+func (a KubeletStats) Family() string {
+	return AddonFamilyPerformance
+}
+
+// Validate the source and rate
+func (a *KubeletStats) Validate() bool {
+	if _, ok := kubeletSources[a.source]; !ok {
+		logger.Errorf("🟥️ The perf-kubelet addon source must be 'kubelet' or 'metrics-server', found %s.", a.source)
+		return false
+	}
+	if a.rate <= 0 {
+		logger.Error("🟥️ The perf-kubelet addon requires a 'rate' greater than 0.")
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *KubeletStats) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = kubeletIdentifier
+	a.image = "ghcr.io/converged-computing/metric-kubelet-stats:latest"
+	a.entrypoint = "/metrics_operator/kubelet-stats-entrypoint.sh"
+	a.source = "kubelet"
+	a.rate = 10
+
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	source, ok := metric.Options["source"]
+	if ok {
+		a.source = source.StrVal
+	}
+	rate, ok := metric.Options["rate"]
+	if ok {
+		a.rate = rate.IntVal
+	}
+	completions, ok := metric.Options["completions"]
+	if ok {
+		a.completions = completions.IntVal
+	}
+	command, ok := metric.Options["command"]
+	if ok {
+		a.command = command.StrVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *KubeletStats) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"image":       intstr.FromString(a.image),
+		"source":      intstr.FromString(a.source),
+		"rate":        intstr.FromInt(int(a.rate)),
+		"completions": intstr.FromInt(int(a.completions)),
+		"command":     intstr.FromString(a.command),
+		"target":      intstr.FromString(a.target),
+	}
+}
+
+// AssembleVolumes provides the sidecar entrypoint
+func (a *KubeletStats) AssembleVolumes() []specs.VolumeSpec {
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  kubeletVolumeName,
+					Path: filepath.Base(a.entrypoint),
+				}},
+			},
+		},
+	}
+	return []specs.VolumeSpec{{
+		Volume:   configVolume,
+		ReadOnly: true,
+		Mount:    false,
+		Path:     filepath.Dir(a.entrypoint),
+	}}
+}
+
+// getFieldEnv returns an environment variable from a pod field (downward API)
+func getFieldEnv(name, path string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: path},
+		},
+	}
+}
+
+// kubeletContext is for the templates of the stats sidecar and report
+type kubeletContext struct {
+	Metadata string
+	Sampler  string
+	Start    string
+	End      string
+}
+
+var (
+	// kubeletTemplate samples the kubelet stats until the completions (or application)
+	// are done, and adds each sample (with its timestamp) to the results of the pod
+	kubeletTemplate = specs.NewTemplate(kubeletIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+serviceaccount=/var/run/secrets/kubernetes.io/serviceaccount
+token=$(cat ${serviceaccount}/token)
+cacert=${serviceaccount}/ca.crt
+stats=${METRICS_OPERATOR_RESULTS:-/tmp}/kubelet-stats.jsonl
+{{ .Sampler }}`, kubeletContext{})
+
+	// kubeletReportTemplate adds the stats sampled during the metric to its log
+	kubeletReportTemplate = specs.NewTemplate(kubeletIdentifier+"-report", `mo_kubelet_stats=${METRICS_OPERATOR_RESULTS:-/tmp}/kubelet-stats.jsonl
+if [ -f ${mo_kubelet_stats} ]; then
+    echo "{{ .Start }} $(hostname)"
+    cat ${mo_kubelet_stats}
+    echo "{{ .End }}"
+fi
+`, kubeletContext{})
+)
+
+// AssembleContainers adds the stats sidecar
+func (a *KubeletStats) AssembleContainers() []specs.ContainerSpec {
+	sample := fmt.Sprintf(`	sample=$(%s)
+	echo "${sample}"
+	if [ -n "${sample}" ]; then
+		echo "${sample}" | jq -c --argjson timestamp ${timestamp} '{timestamp: $timestamp, stats: .}' >> ${stats}
+	fi`, kubeletSources[a.source])
+
+	script := kubeletTemplate.Render(kubeletContext{
+		Metadata: Metadata(a),
+		Sampler:  samplingBlock(sample, a.rate, a.completions, a.command),
+	})
+	entrypoint := specs.EntrypointScript{
+		Name:   kubeletVolumeName,
+		Path:   a.entrypoint,
+		Script: filepath.Base(a.entrypoint),
+		Pre:    script,
+	}
+	return []specs.ContainerSpec{{
+		JobName:          a.target,
+		Image:            a.image,
+		Name:             "kubelet-stats",
+		EntrypointScript: entrypoint,
+		Resources:        &api.ContainerResources{},
+		Attributes:       &api.ContainerSpec{},
+		NeedsWrite:       true,
+		Env: []corev1.EnvVar{
+			getFieldEnv("NODE_NAME", "spec.nodeName"),
+			getFieldEnv("POD_NAME", "metadata.name"),
+			getFieldEnv("POD_NAMESPACE", "metadata.namespace"),
+		},
+	}}
+}
+
+// CustomizeEntrypoints adds the stats to the log of the metric when it is done,
+// so they are parsed with its results
+func (a *KubeletStats) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	if a.command != "" {
+		shareProcessNamespace(rjs, a.target)
+	}
+	report := kubeletReportTemplate.Render(kubeletContext{
+		Start: metadata.KubeletStart,
+		End:   metadata.KubeletEnd,
+	})
+	for _, rj := range rjs {
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		for _, containerSpec := range cs {
+			if containerSpec.JobName != rj.Name || containerSpec.InitContainer {
+				continue
+			}
+			containerSpec.EntrypointScript.Post = report + containerSpec.EntrypointScript.Post
+		}
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: kubeletIdentifier,
+		Summary:    "sample pod cpu, memory, network, and filesystem stats from the kubelet",
+	}
+	stats := KubeletStats{AddonBase: base}
+	Register(&stats)
+}
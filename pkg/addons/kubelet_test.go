@@ -0,0 +1,88 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestKubeletStats(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	_, err = exec.LookPath("jq")
+	if err != nil {
+		t.Skip("jq is required to record samples")
+	}
+	a, err := GetAddon(&api.MetricAddon{Name: kubeletIdentifier, Options: map[string]intstr.IntOrString{
+		"source":      intstr.FromString("metrics-server"),
+		"rate":        intstr.FromInt(1),
+		"completions": intstr.FromInt(2),
+	}}, &api.MetricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fake curl returns the usage of the pod
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	err = os.MkdirAll(bin, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(bin, "curl"), []byte("#!/bin/sh\necho '{\"usage\": {\"cpu\": \"5m\"}}'\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"), "METRICS_OPERATOR_RESULTS="+dir)
+
+	// The number of samples is the number of completions
+	script := a.AssembleContainers()[0].EntrypointScript.Pre
+	cmd := exec.Command(bash, "-c", specs.Prelude+script)
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("kubelet stats failed: %s\n%s", err, out)
+	}
+	if strings.Count(string(out), metadata.Separator) != 2 {
+		t.Errorf("expected two samples for two completions:\n%s", out)
+	}
+	stats, err := os.ReadFile(filepath.Join(dir, "kubelet-stats.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(stats)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"timestamp":`) || !strings.HasSuffix(lines[0], `"stats":{"usage":{"cpu":"5m"}}}`) {
+		t.Errorf("expected two timestamped samples in the results, found %s", stats)
+	}
+
+	// The metric adds them to its log when it is done
+	cs := []*specs.ContainerSpec{{JobName: "l", EntrypointScript: specs.EntrypointScript{Post: "echo done"}}}
+	a.CustomizeEntrypoints(cs, []*jobset.ReplicatedJob{{Name: "l"}})
+	cmd = exec.Command(bash, "-c", cs[0].EntrypointScript.Post)
+	cmd.Env = env
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("kubelet report failed: %s\n%s", err, out)
+	}
+	report := string(out)
+	if !strings.Contains(report, metadata.KubeletStart) || !strings.Contains(report, lines[1]+"\n"+metadata.KubeletEnd) || !strings.HasSuffix(report, "done\n") {
+		t.Errorf("expected the samples between markers before the end of the metric:\n%s", report)
+	}
+}
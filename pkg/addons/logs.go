@@ -10,9 +10,10 @@ package addons
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 
+	"github.com/converged-computing/metrics-operator/pkg/logging"
 	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
 	"github.com/converged-computing/metrics-operator/pkg/utils"
 	"go.uber.org/zap"
 )
@@ -41,11 +42,18 @@ func Metadata(a Addon) string {
 	return fmt.Sprintf("ADDON METADATA START %s\nADDON METADATA END", metadataEscaped)
 }
 
+// blockContext is for the template of addon blocks that start with the metadata
+type blockContext struct {
+	Metadata string
+	Blocks   []string
+}
+
+// blockTemplate echoes the metadata of an addon, and then its blocks of shell
+var blockTemplate = specs.NewTemplate("addon", `
+echo "{{ .Metadata }}"
+{{ join .Blocks "\n" }}
+`, blockContext{})
+
 func init() {
-	handle, err := zap.NewProduction()
-	if err != nil {
-		log.Fatalf("can't initialize zap logger: %v", err)
-	}
-	logger = handle.Sugar()
-	defer handle.Sync()
+	logger = logging.NewLogger("addons")
 }
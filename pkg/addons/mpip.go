@@ -0,0 +1,249 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// https://github.com/LLNL/mpiP
+const (
+	mpipIdentifier = "perf-mpip"
+	MPIPSummary    = "METRICS OPERATOR MPIP SUMMARY"
+)
+
+type MPIP struct {
+	SpackView
+
+	// Target is the name of the replicated job to customize entrypoint logic for
+	target string
+
+	// ContainerTarget is the name of the container to add the entrypoint logic to
+	containerTarget string
+
+	// Directory for the mpiP reports (on a shared volume to collect them)
+	output string
+
+	// Number of MPI callsites (by aggregate time) to summarize
+	top int32
+
+	// Extra options for mpiP (the MPIP environment variable)
+	mpipOptions string
+}
+
+func (m MPIP) Family() string {
+	return AddonFamilyPerformance
+}
+
+// AssembleVolumes to provide an empty volume for the application to share
+// We also need to provide a config map volume for our container spec
+func (m MPIP) AssembleVolumes() []specs.VolumeSpec {
+	return m.GetSpackViewVolumes()
+}
+
+// Validate the number of callsites to summarize
+func (a *MPIP) Validate() bool {
+	if a.top < 1 {
+		logger.Errorf("🟥️ The mpiP addon 'top' must be 1 or greater, found %d", a.top)
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the metric
+func (a *MPIP) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+
+	a.EntrypointPath = "/metrics_operator/mpip-entrypoint.sh"
+	a.image = "ghcr.io/converged-computing/metric-mpip:rocky"
+	a.SetDefaultOptions(metric)
+	a.Mount = "/opt/share"
+	a.VolumeName = "mpip"
+	a.Identifier = mpipIdentifier
+	a.SpackViewContainer = "mpip"
+	a.InitContainer = true
+	a.output = "${METRICS_OPERATOR_RESULTS}/mpip"
+	a.top = 10
+
+	mount, ok := metric.Options["mount"]
+	if ok {
+		a.Mount = mount.StrVal
+	}
+	workdir, ok := metric.Options["workdir"]
+	if ok {
+		a.workdir = workdir.StrVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	output, ok := metric.Options["output"]
+	if ok {
+		a.output = output.StrVal
+	}
+	top, ok := metric.Options["top"]
+	if ok {
+		a.top = top.IntVal
+	}
+	mpipOptions, ok := metric.Options["mpipOptions"]
+	if ok {
+		a.mpipOptions = mpipOptions.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *MPIP) Options() map[string]intstr.IntOrString {
+	options := a.DefaultOptions()
+	options["mount"] = intstr.FromString(a.Mount)
+	options["output"] = intstr.FromString(a.output)
+	options["top"] = intstr.FromInt(int(a.top))
+	options["mpipOptions"] = intstr.FromString(a.mpipOptions)
+	return options
+}
+
+// CustomizeEntrypoint scripts
+func (a *MPIP) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// mpipContext is for the templates of the mpiP blocks
+type mpipContext struct {
+	Metadata    string
+	WaitForView string
+	Output      string
+	Workdir     string
+
+	// The summary marker, and number of callsites
+	Marker string
+	Top    int32
+}
+
+var (
+	// mpipPreTemplate waits for the view, and creates the output directory
+	mpipPreTemplate = specs.NewTemplate(mpipIdentifier, `
+echo "{{ .Metadata }}"
+{{ .WaitForView }}
+libmpipso=${viewroot}/lib/libmpiP.so
+mpipoutput="{{ .Output }}"
+mkdir -p "${mpipoutput}"
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+{{ if .Workdir }}
+workdir="{{ .Workdir }}"
+echo "Changing directory to ${workdir}"
+cd ${workdir}
+{{ end }}`, mpipContext{})
+
+	// mpipSummaryTemplate prints the summary of the newest report
+	mpipSummaryTemplate = specs.NewTemplate(mpipIdentifier+"-summary", `
+mpipreport=$(ls -t "{{ .Output }}"/*.mpiP 2>/dev/null | head -n 1)
+if [ -n "${mpipreport}" ]; then
+    echo "{{ .Marker }}"
+    awk -v report="${mpipreport}" -v top={{ .Top }} '
+        /^@--- Aggregate Time/ { section = 1; next }
+        section && /^Call/ { table = 1; next }
+        table && (NF == 0 || /^-/) { exit }
+        table && count < top {
+            row = sprintf("{\"call\": \"%s\", \"site\": %s, \"timeMs\": %s, \"appPercent\": %s, \"mpiPercent\": %s}", $1, $2, $3, $4, $5)
+            rows = (count > 0) ? rows ", " row : row
+            count++
+        }
+        END { printf("{\"report\": \"%s\", \"callsites\": [%s]}\n", report, rows) }
+    ' "${mpipreport}"
+else
+    echo "No mpiP report was found in {{ .Output }}"
+fi
+`, mpipContext{})
+)
+
+// mpipSummaryBlock prints the top MPI callsites by aggregate time from the newest
+// mpiP report as json, e.g., {"report": ..., "callsites": [{"call": "Allreduce", ...}]}
+func mpipSummaryBlock(output string, top int32) string {
+	return mpipSummaryTemplate.Render(mpipContext{Output: output, Marker: MPIPSummary, Top: top})
+}
+
+// CustomizeEntrypoint for a single replicated job
+func (a *MPIP) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+
+	// This should be run after the pre block of the script. Reports are written
+	// by rank 0, so the output directory is created by every pod in case.
+	preBlock := mpipPreTemplate.Render(mpipContext{
+		Metadata:    Metadata(a),
+		WaitForView: a.WaitForView("${viewroot}/lib/libmpiP.so"),
+		Output:      a.output,
+		Workdir:     a.workdir,
+	})
+
+	for _, containerSpec := range cs {
+
+		// First check - is this the right replicated job?
+		if containerSpec.JobName != rj.Name {
+			continue
+		}
+
+		// Always copy over the pre block - we need the logic to copy software
+		containerSpec.EntrypointScript.Pre += "\n" + preBlock
+
+		// Next check if we have a target set (for the container)
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+
+		// If the post command ends with sleep infinity, tweak it
+		isInteractive, updatedPost := deriveUpdatedPost(containerSpec.EntrypointScript.Post)
+		containerSpec.EntrypointScript.Post = updatedPost + "\n" + mpipSummaryBlock("${mpipoutput}", a.top)
+
+		// mpiP reads options (e.g., the output directory) from MPIP
+		containerSpec.EntrypointScript.Command = fmt.Sprintf(
+			"export MPIP=\"-f ${mpipoutput} %s\"\nexport LD_PRELOAD=${libmpipso}\n%s\nunset LD_PRELOAD",
+			a.mpipOptions,
+			containerSpec.EntrypointScript.Command,
+		)
+
+		// If is interactive, add back sleep infinity
+		if isInteractive {
+			containerSpec.EntrypointScript.Post += "\nsleep infinity\n"
+		}
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: mpipIdentifier,
+		Summary:    "lightweight profiling library for MPI applications",
+	}
+	app := ApplicationAddon{AddonBase: base}
+	spack := SpackView{ApplicationAddon: app}
+	mpip := MPIP{SpackView: spack}
+	Register(&mpip)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// An abbreviated mpiP report
+var mpipReport = `@ mpiP
+@ Command : lmp -in in.reaxc.hns
+---------------------------------------------------------------------------
+@--- Aggregate Time (top twenty, descending, milliseconds) ----------------
+---------------------------------------------------------------------------
+Call                 Site       Time    App%    MPI%      Count    COV
+Allreduce               3   1.23e+03   12.34   45.67        100   0.00
+Wait                    1        812    8.10   30.11        400   0.12
+Sendrecv                2       21.5    0.21    0.80         50   0.00
+
+---------------------------------------------------------------------------
+@--- Aggregate Sent Message Size (top twenty, descending, bytes) ----------
+---------------------------------------------------------------------------
+Call                 Site      Count      Total       Avrg  Sent%
+Sendrecv                2         50   4.19e+06   8.39e+04 100.00
+`
+
+func TestMPIPSummaryBlock(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "lmp.4.1234.1.mpiP"), []byte(mpipReport), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(bash, "-c", mpipSummaryBlock(dir, 2)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("summary failed: %s\n%s", err, out)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 || lines[0] != MPIPSummary {
+		t.Fatalf("expected the summary marker and json, found %q", out)
+	}
+	summary := struct {
+		Report    string `json:"report"`
+		Callsites []struct {
+			Call       string  `json:"call"`
+			Site       int     `json:"site"`
+			TimeMs     float64 `json:"timeMs"`
+			MPIPercent float64 `json:"mpiPercent"`
+		} `json:"callsites"`
+	}{}
+	if err := json.Unmarshal([]byte(lines[1]), &summary); err != nil {
+		t.Fatalf("summary is not json: %s\n%s", err, lines[1])
+	}
+	if len(summary.Callsites) != 2 {
+		t.Fatalf("expected the top 2 callsites, found %v", summary.Callsites)
+	}
+	first := summary.Callsites[0]
+	if first.Call != "Allreduce" || first.Site != 3 || first.TimeMs != 1230 || first.MPIPercent != 45.67 {
+		t.Errorf("unexpected first callsite %v", first)
+	}
+
+	// No report is not an error for the entrypoint
+	out, err = exec.Command(bash, "-c", mpipSummaryBlock(t.TempDir(), 2)).CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "No mpiP report") {
+		t.Errorf("expected a missing report to be reported, found %q %v", out, err)
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"fmt"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
@@ -93,10 +92,10 @@ func (a *MPITrace) CustomizeEntrypoints(
 	cs []*specs.ContainerSpec,
 	rjs []*jobset.ReplicatedJob,
 ) {
-	logger.Infof("🟧️ Customizing entrypoints for %s\n", rjs)
+	logger.Debugf("🟧️ Customizing entrypoints for %d replicated jobs", len(rjs))
 
 	for _, rj := range rjs {
-		logger.Infof("🟧️ Comparing job target %s vs job name %s\n", a.target, rj.Name)
+		logger.Debugf("🟧️ Comparing job target %s vs job name %s", a.target, rj.Name)
 
 		// Only customize if the replicated job name matches the target
 		if a.target != "" && a.target != rj.Name {
@@ -106,66 +105,38 @@ func (a *MPITrace) CustomizeEntrypoints(
 	}
 }
 
+// mpitraceContext is for the template of the mpitrace block
+type mpitraceContext struct {
+	Metadata    string
+	WaitForView string
+	Workdir     string
+}
+
+// mpitraceTemplate waits for the view, and changes to the working directory
+var mpitraceTemplate = specs.NewTemplate(mpitraceIdentifier, `
+echo "{{ .Metadata }}"
+{{ .WaitForView }}
+libmpitraceso=${viewroot}/lib/libmpitrace.so
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+{{ if .Workdir }}
+workdir="{{ .Workdir }}"
+echo "Changing directory to ${workdir}"
+cd ${workdir}
+{{ end }}`, mpitraceContext{})
+
 // CustomizeEntrypoint for a single replicated job
 func (a *MPITrace) customizeEntrypoint(
 	cs []*specs.ContainerSpec,
 	rj *jobset.ReplicatedJob,
 ) {
 
-	// Generate addon metadata
-	meta := Metadata(a)
-
 	// This should be run after the pre block of the script
-	preBlock := `
-echo "%s"
-# Ensure hpcrun and software exists. This is rough, but should be OK with enough wait time
-wget -q https://github.com/converged-computing/goshare/releases/download/2023-09-06/wait-fs
-chmod +x ./wait-fs
-mv ./wait-fs /usr/bin/goshare-wait-fs
-
-# Ensure spack view is on the path, wherever it is mounted
-viewbase="%s"
-software="${viewbase}/software"
-viewbin="${viewbase}/view/bin"
-libmpitraceso=${viewbase}/view/lib/libmpitrace.so
-
-# Important to add AFTER in case software in container duplicated
-export PATH=$PATH:${viewbin}
-	
-# Wait for software directory, and give it time
-goshare-wait-fs -p ${software}
-	
-# Wait for copy to finish
-sleep 10
-	
-# Copy mount software to /opt/software
-cp -R %s/software /opt/software
-	
-# Wait for file indicator that copy is done
-goshare-wait-fs -p ${viewbase}/metrics-operator-done.txt
-
-# A small extra wait time to be conservative
-sleep 5
-echo "%s"
-echo "%s"
-`
-	preBlock = fmt.Sprintf(
-		preBlock,
-		meta,
-		a.Mount,
-		a.Mount,
-		metadata.CollectionStart,
-		metadata.Separator,
-	)
-
-	// Add the working directory, if defined
-	if a.workdir != "" {
-		preBlock += fmt.Sprintf(`
-workdir="%s"
-echo "Changing directory to ${workdir}"
-cd ${workdir}			
-`, a.workdir)
-	}
+	preBlock := mpitraceTemplate.Render(mpitraceContext{
+		Metadata:    Metadata(a),
+		WaitForView: a.WaitForView("${viewroot}/lib/libmpitrace.so"),
+		Workdir:     a.workdir,
+	})
 
 	// We use container names to target specific entrypoint scripts here
 	for _, containerSpec := range cs {
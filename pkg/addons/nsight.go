@@ -0,0 +1,311 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// Nsight Systems provides nsys to profile GPU (and CPU) applications
+// https://docs.nvidia.com/nsight-systems/UserGuide/index.html
+const (
+	nsightIdentifier = "perf-nsight"
+	nsightVolumeName = "nsight"
+)
+
+type Nsight struct {
+	ApplicationAddon
+
+	// Directory in the image with the nsight systems install to copy
+	source string
+
+	// Shared mount for nsys and results
+	mount string
+
+	// Directory to write .nsys-rep files to
+	output string
+
+	// nsys profile settings
+	trace    string
+	duration int32
+	delay    int32
+
+	// Run nsys stats after the run to add a text summary to the output
+	stats bool
+
+	// For mpirun and similar, a prefix to put before nsys
+	prefix string
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (m Nsight) Family() string {
+	return AddonFamilyPerformance
+}
+
+// Validate we have a trace set
+func (a *Nsight) Validate() bool {
+	if a.trace == "" {
+		logger.Error("🟥️ The perf-nsight addon requires a 'trace' set (e.g., cuda,nvtx,mpi,osrt).")
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *Nsight) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = nsightIdentifier
+	a.image = "ghcr.io/converged-computing/metric-nsight-systems:latest"
+	a.entrypoint = "/metrics_operator/nsight-entrypoint.sh"
+	a.source = "/opt/nvidia/nsight-systems"
+	a.mount = "/opt/nsight"
+	a.trace = "cuda,nvtx,mpi,osrt"
+	a.stats = true
+	a.SetDefaultOptions(metric)
+
+	source, ok := metric.Options["source"]
+	if ok {
+		a.source = source.StrVal
+	}
+	mount, ok := metric.Options["mount"]
+	if ok {
+		a.mount = mount.StrVal
+	}
+	a.output = "${METRICS_OPERATOR_RESULTS}/nsight"
+	output, ok := metric.Options["output"]
+	if ok {
+		a.output = output.StrVal
+	}
+	trace, ok := metric.Options["trace"]
+	if ok {
+		a.trace = trace.StrVal
+	}
+	duration, ok := metric.Options["duration"]
+	if ok {
+		a.duration = duration.IntVal
+	}
+	delay, ok := metric.Options["delay"]
+	if ok {
+		a.delay = delay.IntVal
+	}
+	prefix, ok := metric.Options["prefix"]
+	if ok {
+		a.prefix = prefix.StrVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+	stats, ok := metric.Options["stats"]
+	if ok {
+		if stats.StrVal == "no" || stats.StrVal == "false" {
+			a.stats = false
+		}
+	}
+}
+
+// Exported options and list options
+func (a *Nsight) Options() map[string]intstr.IntOrString {
+	options := a.DefaultOptions()
+	options["source"] = intstr.FromString(a.source)
+	options["mount"] = intstr.FromString(a.mount)
+	options["output"] = intstr.FromString(a.output)
+	options["trace"] = intstr.FromString(a.trace)
+	options["duration"] = intstr.FromInt(int(a.duration))
+	options["delay"] = intstr.FromInt(int(a.delay))
+	options["prefix"] = intstr.FromString(a.prefix)
+	options["stats"] = intstr.FromString("false")
+	if a.stats {
+		options["stats"] = intstr.FromString("true")
+	}
+	return options
+}
+
+// AssembleVolumes provides a shared volume for nsys and the results
+func (a *Nsight) AssembleVolumes() []specs.VolumeSpec {
+	volume := corev1.Volume{
+		Name: nsightVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+
+	// The init container entrypoint is generated in the metrics operator config map
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  nsightVolumeName,
+					Path: filepath.Base(a.entrypoint),
+				}},
+			},
+		},
+	}
+	return []specs.VolumeSpec{
+		{
+			Volume: volume,
+			Mount:  true,
+			Path:   a.mount,
+		},
+		{
+			Volume:   configVolume,
+			ReadOnly: true,
+			Mount:    false,
+			Path:     filepath.Dir(a.entrypoint),
+		},
+	}
+}
+
+// nsightContext is for the templates of the nsight blocks
+type nsightContext struct {
+	Metadata string
+	Source   string
+	Mount    string
+	Output   string
+}
+
+var (
+	// nsightInitTemplate copies nsight systems to the shared mount
+	nsightInitTemplate = specs.NewTemplate(nsightIdentifier+"-init", `#!/bin/bash
+echo "Copying nsight systems from {{ .Source }} to shared volume at {{ .Mount }}"
+mkdir -p {{ .Mount }}/nsight-systems
+mo_retry cp -R {{ .Source }}/* {{ .Mount }}/nsight-systems/
+nsys=$(find {{ .Mount }}/nsight-systems -type f -name nsys | head -n 1)
+echo "Found nsys at ${nsys}"
+`, nsightContext{})
+
+	// nsightTemplate finds nsys in the shared mount. The output directory is created
+	// by the command, after any change of directory (the output can be relative).
+	nsightTemplate = specs.NewTemplate(nsightIdentifier, `
+echo "{{ .Metadata }}"
+# Find nsys in the shared mount
+nsys=$(find {{ .Mount }}/nsight-systems -type f -name nsys | head -n 1)
+output="{{ .Output }}"
+echo "Using nsys ${nsys} with output ${output}"
+`, nsightContext{})
+)
+
+// AssembleContainers adds an init container to copy nsight systems to the shared mount
+func (a *Nsight) AssembleContainers() []specs.ContainerSpec {
+	script := nsightInitTemplate.Render(nsightContext{
+		Source: a.source,
+		Mount:  a.mount,
+	})
+	entrypoint := specs.EntrypointScript{
+		Name:   nsightVolumeName,
+		Path:   a.entrypoint,
+		Script: filepath.Base(a.entrypoint),
+		Pre:    script,
+	}
+	return []specs.ContainerSpec{{
+		Image:            a.image,
+		Name:             "nsight",
+		EntrypointScript: entrypoint,
+		InitContainer:    true,
+		Resources:        &api.ContainerResources{},
+		Attributes:       &api.ContainerSpec{},
+		NeedsWrite:       true,
+	}}
+}
+
+// CustomizeEntrypoint scripts
+func (a *Nsight) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// CustomizeEntrypoint for a single replicated job
+func (a *Nsight) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+
+	preBlock := nsightTemplate.Render(nsightContext{
+		Metadata: Metadata(a),
+		Mount:    a.mount,
+		Output:   a.output,
+	})
+
+	// Assemble the profile arguments
+	profile := fmt.Sprintf("profile --trace=%s", a.trace)
+	if a.duration > 0 {
+		profile += fmt.Sprintf(" --duration=%d", a.duration)
+	}
+	if a.delay > 0 {
+		profile += fmt.Sprintf(" --delay=%d", a.delay)
+	}
+	profile += " --output=${output}/nsight-$(hostname)-%p"
+
+	// The stats are added before the post block, so they are part of collection
+	statsBlock := ""
+	if a.stats {
+		statsBlock = `
+for report in ${output}/*.nsys-rep; do
+    echo "METRICS-OPERATOR NSIGHT STATS START ${report}"
+    ${nsys} stats ${report}
+    echo "METRICS-OPERATOR NSIGHT STATS END ${report}"
+done
+`
+	}
+
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name || containerSpec.InitContainer {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		containerSpec.EntrypointScript.Pre += "\n" + preBlock
+
+		// An interactive container (e.g., a worker waiting for the launcher) is not profiled
+		if strings.TrimSpace(containerSpec.EntrypointScript.Command) == metadata.Interactive(true) {
+			continue
+		}
+		containerSpec.EntrypointScript.Command = fmt.Sprintf(
+			"mkdir -p ${output}\n%s ${nsys} %s %s",
+			a.prefix,
+			profile,
+			containerSpec.EntrypointScript.Command,
+		)
+		containerSpec.EntrypointScript.Post = statsBlock + containerSpec.EntrypointScript.Post
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: nsightIdentifier,
+		Summary:    "NVIDIA Nsight Systems profiling with nsys",
+	}
+	app := ApplicationAddon{AddonBase: base}
+	nsight := Nsight{ApplicationAddon: app}
+	Register(&nsight)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestNsight(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	dir := t.TempDir()
+	a, err := GetAddon(&api.MetricAddon{Name: nsightIdentifier, Options: map[string]intstr.IntOrString{
+		"mount":  intstr.FromString(dir),
+		"output": intstr.FromString("profiles"),
+	}}, &api.MetricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The launcher is profiled, and the workers waiting for it are not
+	launcher := &specs.ContainerSpec{JobName: "l", EntrypointScript: specs.EntrypointScript{
+		Pre:     "cd " + filepath.Join(dir, "work"),
+		Command: "lmp -in in.lj",
+	}}
+	worker := &specs.ContainerSpec{JobName: "w", EntrypointScript: specs.EntrypointScript{Command: "sleep infinity"}}
+	a.CustomizeEntrypoints([]*specs.ContainerSpec{launcher, worker}, []*jobset.ReplicatedJob{{Name: "l"}, {Name: "w"}})
+	if worker.EntrypointScript.Command != "sleep infinity" || strings.Contains(worker.EntrypointScript.Post, "nsys") {
+		t.Errorf("expected an interactive worker to not be profiled, found %q", worker.EntrypointScript.Command)
+	}
+
+	// A fake nsys writes a report to the (relative) output, which is created by the command
+	nsys := filepath.Join(dir, "nsight-systems", "bin", "nsys")
+	for _, path := range []string{filepath.Dir(nsys), filepath.Join(dir, "work")} {
+		err = os.MkdirAll(path, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.WriteFile(nsys, []byte("#!/bin/sh\nif [ \"$1\" = stats ]; then echo \"stats of $2\"; exit 0; fi\ntouch ${3#--output=}.nsys-rep\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := launcher.EntrypointScript.Pre + "\n" + launcher.EntrypointScript.Command + "\n" + launcher.EntrypointScript.Post
+	cmd := exec.Command(bash, "-c", script)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("nsight failed: %s\n%s", err, out)
+	}
+	reports, _ := filepath.Glob(filepath.Join(dir, "work", "profiles", "*.nsys-rep"))
+	if len(reports) != 1 || !strings.Contains(string(out), "stats of profiles/") {
+		t.Errorf("expected one report with stats, found %v\n%s", reports, out)
+	}
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"path/filepath"
+	"regexp"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The pcap addon adds a sidecar that captures packets (with tcpdump) on an
+// interface of the pod during the run, rotating the capture files by size or
+// time, and writes them to the results volume to debug latency spikes
+const (
+	pcapIdentifier = "debug-pcap"
+	pcapVolumeName = "pcap"
+)
+
+var (
+	// Interface names (e.g., eth0, net1, or any)
+	interfaceRegex = regexp.MustCompile(`^[-_.:@a-zA-Z0-9]+$`)
+)
+
+type PcapAddon struct {
+	AddonBase
+
+	// Container image with tcpdump
+	image string
+
+	// Interface to capture on, and a BPF filter expression
+	iface  string
+	filter string
+
+	// Bytes to capture of each packet (0 is the tcpdump default)
+	snaplen int32
+
+	// Start a new file after some megabytes and/or seconds, and keep the newest files
+	rotateSize    int32
+	rotateSeconds int32
+	files         int32
+
+	// Capture until the process matching the command exits, or for some seconds
+	command  string
+	duration int32
+
+	// Entrypoint for the sidecar container
+	entrypoint string
+
+	// job name target
+	target string
+}
+
+func (a PcapAddon) Family() string {
+	return AddonFamilyDebug
+}
+
+// Validate the interface, rotation, and when to stop
+func (a *PcapAddon) Validate() bool {
+	if !interfaceRegex.MatchString(a.iface) {
+		logger.Errorf("🟥️ The debug-pcap addon interface %q is not an interface name (e.g., eth0 or any).", a.iface)
+		return false
+	}
+	if a.snaplen < 0 || a.rotateSize < 0 || a.rotateSeconds < 0 || a.files < 0 {
+		logger.Error("🟥️ The debug-pcap addon snaplen, rotateSize, rotateSeconds, and files cannot be negative.")
+		return false
+	}
+	if a.command == "" && a.duration <= 0 {
+		logger.Error("🟥️ The debug-pcap addon requires a 'command' to capture until it exits, or a 'duration' in seconds.")
+		return false
+	}
+	if a.duration < 0 {
+		logger.Error("🟥️ The debug-pcap addon duration cannot be negative.")
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *PcapAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = pcapIdentifier
+	a.image = "ghcr.io/converged-computing/metric-pcap:latest"
+	a.entrypoint = "/metrics_operator/pcap-entrypoint.sh"
+	a.iface = "eth0"
+	a.rotateSize = 100
+	a.files = 10
+
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	iface, ok := metric.Options["interface"]
+	if ok {
+		a.iface = iface.StrVal
+	}
+	filter, ok := metric.Options["filter"]
+	if ok {
+		a.filter = filter.StrVal
+	}
+	snaplen, ok := metric.Options["snaplen"]
+	if ok {
+		a.snaplen = snaplen.IntVal
+	}
+	rotateSize, ok := metric.Options["rotateSize"]
+	if ok {
+		a.rotateSize = rotateSize.IntVal
+	}
+	rotateSeconds, ok := metric.Options["rotateSeconds"]
+	if ok {
+		a.rotateSeconds = rotateSeconds.IntVal
+	}
+	files, ok := metric.Options["files"]
+	if ok {
+		a.files = files.IntVal
+	}
+	command, ok := metric.Options["command"]
+	if ok {
+		a.command = command.StrVal
+	}
+	duration, ok := metric.Options["duration"]
+	if ok {
+		a.duration = duration.IntVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *PcapAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"image":         intstr.FromString(a.image),
+		"interface":     intstr.FromString(a.iface),
+		"filter":        intstr.FromString(a.filter),
+		"snaplen":       intstr.FromInt(int(a.snaplen)),
+		"rotateSize":    intstr.FromInt(int(a.rotateSize)),
+		"rotateSeconds": intstr.FromInt(int(a.rotateSeconds)),
+		"files":         intstr.FromInt(int(a.files)),
+		"command":       intstr.FromString(a.command),
+		"duration":      intstr.FromInt(int(a.duration)),
+		"target":        intstr.FromString(a.target),
+	}
+}
+
+// AssembleVolumes provides the sidecar entrypoint
+func (a *PcapAddon) AssembleVolumes() []specs.VolumeSpec {
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  pcapVolumeName,
+					Path: filepath.Base(a.entrypoint),
+				}},
+			},
+		},
+	}
+	return []specs.VolumeSpec{{
+		Volume:   configVolume,
+		ReadOnly: true,
+		Mount:    false,
+		Path:     filepath.Dir(a.entrypoint),
+	}}
+}
+
+// pcapContext is for the template of the capture sidecar
+type pcapContext struct {
+	Metadata      string
+	Interface     string
+	Filter        string
+	Snaplen       int32
+	RotateSize    int32
+	RotateSeconds int32
+	Command       string
+	Duration      int32
+
+	// The first of the oldest files to remove (files + 1), or 0 to keep all
+	Prune int32
+}
+
+// pcapTemplate captures until the application exits (or the duration), removing
+// the oldest files past the limit. With -C and -G together tcpdump does not limit
+// the files itself. tcpdump keeps root (-Z) to open rotated files on the results
+// volume, and writes each packet as it is captured (-U) so a stopped capture is
+// complete. Its statistics (e.g., packets dropped by the kernel) are printed at the end.
+var pcapTemplate = specs.NewTemplate(pcapIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+dir=${METRICS_OPERATOR_RESULTS:-/tmp}/pcap
+mkdir -p ${dir}
+{{ if .Command }}echo "Waiting for application PID..."
+pid=$(mo_wait_for_pid {{ quote .Command }})
+{{ end }}echo "Capturing packets on {{ .Interface }}{{ if .Filter }} matching {{ .Filter }}{{ end }} to ${dir}"
+echo "{{ collectionStart }}"
+echo "START $(date +%s.%N)"
+tcpdump -i {{ .Interface }} -n -U -Z root{{ if gt .Snaplen 0 }} -s {{ .Snaplen }}{{ end }}{{ if gt .RotateSize 0 }} -C {{ .RotateSize }}{{ end }}{{ if gt .RotateSeconds 0 }} -G {{ .RotateSeconds }}{{ end }} -w ${dir}/$(hostname){{ if gt .RotateSeconds 0 }}-%Y%m%d-%H%M%S{{ end }}.pcap{{ if .Filter }} {{ quote .Filter }}{{ end }} 2> ${dir}/tcpdump.log &
+capture=$!
+start=$(date +%s)
+while kill -0 ${capture} 2>/dev/null; do
+    sleep 1
+    {{ if gt .Prune 0 }}ls -1t ${dir}/*.pcap* 2>/dev/null | tail -n +{{ .Prune }} | xargs -r rm -f
+    {{ end }}{{ if .Command }}kill -0 ${pid} 2>/dev/null || break
+    {{ end }}{{ if gt .Duration 0 }}[ $(( $(date +%s) - start )) -ge {{ .Duration }} ] && break
+    {{ end }}
+done
+if kill -0 ${capture} 2>/dev/null; then
+    kill -TERM ${capture}
+    wait ${capture}
+else
+    wait ${capture} || echo "tcpdump exited with $?, see ${dir}/tcpdump.log"
+fi
+echo "END $(date +%s.%N)"
+cat ${dir}/tcpdump.log
+ls -l ${dir}/*.pcap* 2>/dev/null
+echo "{{ collectionEnd }}"
+`, pcapContext{})
+
+// AssembleContainers adds the capture sidecar
+func (a *PcapAddon) AssembleContainers() []specs.ContainerSpec {
+	context := pcapContext{
+		Metadata:      Metadata(a),
+		Interface:     a.iface,
+		Filter:        a.filter,
+		Snaplen:       a.snaplen,
+		RotateSize:    a.rotateSize,
+		RotateSeconds: a.rotateSeconds,
+		Command:       a.command,
+		Duration:      a.duration,
+	}
+	if a.files > 0 {
+		context.Prune = a.files + 1
+	}
+	script := pcapTemplate.Render(context)
+	entrypoint := specs.EntrypointScript{
+		Name:   pcapVolumeName,
+		Path:   a.entrypoint,
+		Script: filepath.Base(a.entrypoint),
+		Pre:    script,
+	}
+
+	// Capturing needs raw sockets, and the interface is put in promiscuous mode
+	return []specs.ContainerSpec{{
+		JobName:          a.target,
+		Image:            a.image,
+		Name:             "pcap",
+		EntrypointScript: entrypoint,
+		Resources:        &api.ContainerResources{},
+		Attributes:       &api.ContainerSpec{},
+		NeedsWrite:       true,
+		Capabilities:     []corev1.Capability{"NET_RAW", "NET_ADMIN"},
+	}}
+}
+
+// CustomizeEntrypoints shares the process namespace of targeted replicated jobs,
+// so the sidecar can find the application
+func (a *PcapAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	if a.command != "" {
+		shareProcessNamespace(rjs, a.target)
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: pcapIdentifier,
+		Summary:    "capture packets with tcpdump on an interface, rotating files by size or time",
+	}
+	pcap := PcapAddon{AddonBase: base}
+	Register(&pcap)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// fakeTcpdump writes rotated files, and its statistics when it is stopped
+var fakeTcpdump = `#!/bin/bash
+echo "$@" > ${ARGS}
+while [ $# -gt 0 ]; do [ "$1" = "-w" ] && output=$2; shift; done
+trap 'echo "3 packets captured" >&2; exit 0' TERM
+for i in 1 2 3 4 5; do echo ${i} > ${output}${i}; done
+while true; do sleep 0.1; done
+`
+
+func TestPcap(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+
+	// Bad interfaces, negative sizes, or no end do not validate
+	for _, options := range []map[string]intstr.IntOrString{
+		{"interface": intstr.FromString("eth0; reboot"), "duration": intstr.FromInt(10)},
+		{"rotateSize": intstr.FromInt(-1), "duration": intstr.FromInt(10)},
+		{"interface": intstr.FromString("net1")},
+	} {
+		_, err := GetAddon(&api.MetricAddon{Name: pcapIdentifier, Options: options}, &api.MetricSet{})
+		if err == nil {
+			t.Errorf("expected options %v to not validate", options)
+		}
+	}
+
+	bin := t.TempDir()
+	err = os.WriteFile(filepath.Join(bin, "tcpdump"), []byte(fakeTcpdump), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := GetAddon(&api.MetricAddon{Name: pcapIdentifier, Options: map[string]intstr.IntOrString{
+		"filter":        intstr.FromString("tcp port 5201"),
+		"rotateSeconds": intstr.FromInt(60),
+		"files":         intstr.FromInt(2),
+		"duration":      intstr.FromInt(2),
+	}}, &api.MetricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := a.AssembleContainers()
+	if len(containers) != 1 || len(containers[0].Capabilities) != 2 {
+		t.Fatalf("expected a sidecar with capabilities to capture, found %+v", containers)
+	}
+
+	results := t.TempDir()
+	args := filepath.Join(t.TempDir(), "args")
+	script := strings.TrimPrefix(containers[0].EntrypointScript.Pre, "#!/bin/bash\n")
+	cmd := exec.Command(bash, "-c", specs.Prelude+script)
+	cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"), "METRICS_OPERATOR_RESULTS="+results, "ARGS="+args)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("pcap failed: %s\n%s", err, out)
+	}
+	output := string(out)
+	if !strings.Contains(output, "3 packets captured") || !strings.HasSuffix(output, metadata.CollectionEnd+"\n") {
+		t.Errorf("expected the capture statistics and the end of collection:\n%s", output)
+	}
+	used, _ := os.ReadFile(args)
+	if !strings.Contains(string(used), "-i eth0 -n -U -Z root -C 100 -G 60 -w ") || !strings.HasSuffix(string(used), ".pcap tcp port 5201\n") {
+		t.Errorf("unexpected tcpdump arguments %s", used)
+	}
+	files, _ := filepath.Glob(filepath.Join(results, "pcap", "*.pcap*"))
+	if len(files) != 2 {
+		t.Errorf("expected the newest 2 files to be kept, found %v", files)
+	}
+}
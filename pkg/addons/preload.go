@@ -0,0 +1,332 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The preload addon injects a shared library via LD_PRELOAD, e.g., for I/O
+// interceptors or allocator swaps, without needing a custom addon per tool.
+const (
+	preloadIdentifier = "preload"
+	preloadVolumeName = "preload"
+)
+
+var (
+	preloadMode     = int32(0755)
+	preloadEnvRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+type PreloadAddon struct {
+	AddonBase
+
+	// An image that provides the library, copied by an init container
+	image string
+
+	// Directory in the image with the library (and dependencies) to copy
+	source string
+
+	// Alternatively, an existing config map with the library
+	configMapName string
+
+	// Path where the library is mounted in the application container
+	mount string
+
+	// The library (or libraries, colon separated) to preload
+	library string
+
+	// Entrypoint for the init container, if we use an image
+	entrypointPath string
+
+	// Extra environment to set for the command
+	env map[string]intstr.IntOrString
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (a PreloadAddon) Family() string {
+	return AddonFamilyPerformance
+}
+
+// Validate we have a library, and exactly one source for it
+func (a *PreloadAddon) Validate() bool {
+	if a.library == "" {
+		logger.Error("🟥️ The preload addon requires a 'library' to preload.")
+		return false
+	}
+	if a.image == "" && a.configMapName == "" {
+		logger.Error("🟥️ The preload addon requires an 'image' or 'configMapName' to provide the library.")
+		return false
+	}
+	if a.image != "" && a.configMapName != "" {
+		logger.Error("🟥️ The preload addon accepts only one of 'image' or 'configMapName'.")
+		return false
+	}
+	for key := range a.env {
+		if !preloadEnvRegex.MatchString(key) {
+			logger.Errorf("🟥️ The preload addon env %q is not a valid variable name.", key)
+			return false
+		}
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *PreloadAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = preloadIdentifier
+	a.mount = "/opt/preload"
+	a.source = "/opt/preload"
+	a.entrypointPath = "/metrics_operator/preload-entrypoint.sh"
+	a.env = map[string]intstr.IntOrString{}
+
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	source, ok := metric.Options["source"]
+	if ok {
+		a.source = source.StrVal
+	}
+	cm, ok := metric.Options["configMapName"]
+	if ok {
+		a.configMapName = cm.StrVal
+	}
+	mount, ok := metric.Options["mount"]
+	if ok {
+		a.mount = mount.StrVal
+	}
+	library, ok := metric.Options["library"]
+	if ok {
+		a.library = library.StrVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+	env, ok := metric.MapOptions["env"]
+	if ok {
+		a.env = env
+	}
+}
+
+// Exported options and list options
+func (a *PreloadAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"image":           intstr.FromString(a.image),
+		"source":          intstr.FromString(a.source),
+		"configMapName":   intstr.FromString(a.configMapName),
+		"mount":           intstr.FromString(a.mount),
+		"library":         intstr.FromString(a.library),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+// Return formatted map options
+func (a *PreloadAddon) MapOptions() map[string]map[string]intstr.IntOrString {
+	return map[string]map[string]intstr.IntOrString{
+		"env": a.env,
+	}
+}
+
+// preloadPath returns the LD_PRELOAD value, with relative libraries under the mount
+func (a *PreloadAddon) preloadPath() string {
+	libraries := []string{}
+	for _, library := range strings.Split(a.library, ":") {
+		if !filepath.IsAbs(library) {
+			library = filepath.Join(a.mount, library)
+		}
+		libraries = append(libraries, library)
+	}
+	return strings.Join(libraries, ":")
+}
+
+// AssembleVolumes provides the volume with the library
+func (a *PreloadAddon) AssembleVolumes() []specs.VolumeSpec {
+
+	// An existing config map is mounted directly
+	if a.configMapName != "" {
+		volume := corev1.Volume{
+			Name: preloadVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: a.configMapName,
+					},
+					DefaultMode: &preloadMode,
+				},
+			},
+		}
+		return []specs.VolumeSpec{{
+			Volume:   volume,
+			Path:     a.mount,
+			ReadOnly: true,
+			Mount:    true,
+		}}
+	}
+
+	// Otherwise we share an empty volume that the init container populates
+	volume := corev1.Volume{
+		Name: preloadVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+
+	// The init container entrypoint is generated in the metrics operator config map
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  preloadVolumeName,
+					Path: filepath.Base(a.entrypointPath),
+				}},
+			},
+		},
+	}
+	return []specs.VolumeSpec{
+		{
+			Volume: volume,
+			Mount:  true,
+			Path:   a.mount,
+		},
+		{
+			Volume:   configVolume,
+			ReadOnly: true,
+			Mount:    false,
+			Path:     filepath.Dir(a.entrypointPath),
+		},
+	}
+}
+
+// preloadContext is for the templates of the preload blocks
+type preloadContext struct {
+	Source  string
+	Mount   string
+	Exports string
+	Preload string
+	Command string
+}
+
+var (
+	// preloadInitTemplate copies the libraries to the shared volume
+	preloadInitTemplate = specs.NewTemplate(preloadIdentifier+"-init", `#!/bin/bash
+echo "Copying preload libraries from {{ .Source }} to shared volume at {{ .Mount }}"
+mkdir -p {{ .Mount }}
+mo_retry cp -R {{ .Source }}/* {{ .Mount }}/
+echo "Done copying preload libraries"
+`, preloadContext{})
+
+	// preloadTemplate preloads the library for the command
+	preloadTemplate = specs.NewTemplate(preloadIdentifier, `{{ .Exports }}export LD_PRELOAD={{ .Preload }}
+{{ .Command }}
+unset LD_PRELOAD`, preloadContext{})
+)
+
+// AssembleContainers adds an init container to copy the library, if needed
+func (a *PreloadAddon) AssembleContainers() []specs.ContainerSpec {
+	if a.image == "" {
+		return []specs.ContainerSpec{}
+	}
+
+	script := preloadInitTemplate.Render(preloadContext{Source: a.source, Mount: a.mount})
+	entrypoint := specs.EntrypointScript{
+		Name:   preloadVolumeName,
+		Path:   a.entrypointPath,
+		Script: filepath.Base(a.entrypointPath),
+		Pre:    script,
+	}
+	return []specs.ContainerSpec{{
+		Image:            a.image,
+		Name:             "preload",
+		EntrypointScript: entrypoint,
+		InitContainer:    true,
+		Resources:        &api.ContainerResources{},
+		Attributes:       &api.ContainerSpec{},
+		NeedsWrite:       true,
+	}}
+}
+
+// CustomizeEntrypoint scripts
+func (a *PreloadAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// CustomizeEntrypoint for a single replicated job
+func (a *PreloadAddon) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+
+	// Environment is exported before the command (and LD_PRELOAD unset after).
+	// Values are quoted, so they are set as given.
+	keys := []string{}
+	for key := range a.env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	exports := ""
+	for _, key := range keys {
+		value := a.env[key]
+		exports += fmt.Sprintf("export %s=%s\n", key, specs.ShellQuote(value.String()))
+	}
+	meta := Metadata(a)
+
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		containerSpec.EntrypointScript.Pre += fmt.Sprintf("\necho \"%s\"\n", meta)
+
+		// We don't want the preload to apply to the post block
+		containerSpec.EntrypointScript.Command = preloadTemplate.Render(preloadContext{
+			Exports: exports,
+			Preload: a.preloadPath(),
+			Command: containerSpec.EntrypointScript.Command,
+		})
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: preloadIdentifier,
+		Summary:    "inject a shared library into a metric command with LD_PRELOAD",
+	}
+	preload := PreloadAddon{AddonBase: base}
+	Register(&preload)
+}
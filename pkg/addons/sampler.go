@@ -0,0 +1,63 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// samplerContext is for the template of a sampling sidecar loop
+type samplerContext struct {
+	Command     string
+	Completions int32
+	Rate        int32
+	Sample      string
+}
+
+// samplerTemplate runs a sample (with a timepoint and timestamp) every rate seconds,
+// until there are completions samples (0 is indefinite) or the application exits.
+// The timestamp of the sample is available to it as ${timestamp}.
+var samplerTemplate = specs.NewTemplate("sampler", `{{ if .Command }}echo "Waiting for application PID..."
+pid=$(mo_wait_for_pid {{ .Command }})
+{{ end }}i=0
+echo "{{ collectionStart }}"
+while true
+  do
+	timestamp=$(date +%s)
+	echo "{{ separator }}"
+	echo "TIMESTAMP ${timestamp}"
+{{ .Sample }}
+	i=$((i + 1))
+{{- if .Command }}
+	if ! kill -0 ${pid} 2>/dev/null; then
+		break
+	fi
+{{- end }}
+{{- if .Completions }}
+	if [ ${i} -ge {{ .Completions }} ]; then
+		break
+	fi
+{{- end }}
+	sleep {{ .Rate }}
+done
+echo "{{ collectionEnd }}"
+`, samplerContext{})
+
+// samplingBlock returns the loop for a sidecar that samples at a rate, for a
+// number of completions, or for the lifetime of the process matching command
+func samplingBlock(sample string, rate, completions int32, command string) string {
+	if command != "" {
+		command = specs.ShellQuote(command)
+	}
+	return samplerTemplate.Render(samplerContext{
+		Command:     command,
+		Completions: completions,
+		Rate:        rate,
+		Sample:      sample,
+	})
+}
@@ -10,10 +10,13 @@ package addons
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // A spack view expects to copy a view from /opt/view into a mount
@@ -27,50 +30,91 @@ type SpackView struct {
 	EntrypointPath     string
 	Mount              string
 	InitContainer      bool
+
+	// Path of the view in the image (the default finds the view under /opt/views)
+	View string
 }
 
-// Generate a container spec that will map to a listing of containers for the replicated job
-func (a *SpackView) AssembleContainers() []specs.ContainerSpec {
+// spackViewContext is for the templates of the spack view container, and waiting for it
+type spackViewContext struct {
+	Setup      string
+	Mount      string
+	View       string
+	Identifier string
+	Container  string
+
+	// Blocks to copy the view and software to the mount, and mark it done
+	CopyView      string
+	CopySoftware  string
+	Done          string
+	InitContainer bool
+
+	// Blocks to wait for the view (and paths in it), and copy the software back
+	WaitDone  string
+	CopyMount string
+	Wait      string
+}
 
-	// The entrypoint script
-	// This is the addon container entrypoint, we don't care about metadata here
-	// The sole purpose is just to provide the volume, meaning copying content there
-	template := `#!/bin/bash
+var (
+	// spackViewTemplate is the addon container entrypoint, we don't care about metadata here.
+	// The sole purpose is just to provide the volume, meaning copying content there.
+	// If it's not an initContainer, it needs to sleep forever to stay running.
+	spackViewTemplate = specs.NewTemplate(spackViewIdentifier, `#!/bin/bash
 
 # Extra setup (optional) for a spack view
-%s
+{{ .Setup }}
 
-echo "Moving content from /opt/view to be in shared volume at %s"
-view=$(ls /opt/views/._view/)
-view="/opt/views/._view/${view}"
+echo "Moving content from /opt/view to be in shared volume at {{ .Mount }}"
+view="{{ .View }}"
+if [ -z "${view}" ]; then
+    view=$(ls /opt/views/._view/)
+    view="/opt/views/._view/${view}"
+fi
 
-# Give a little extra wait time
-sleep 10
+viewroot="{{ .Mount }}"
 
-viewroot="%s"
-mkdir -p $viewroot/view
 # We have to move both of these paths, *sigh*
-cp -R ${view}/* $viewroot/view
-cp -R /opt/software $viewroot/
-
-# This is a marker to indicate the copy is done
-touch $viewroot/metrics-operator-done.txt
-`
-	script := fmt.Sprintf(
-		template,
-		a.Setup,
-		a.Mount,
-		a.Mount,
-	)
-
-	// If it's not an initContainer, needs to sleep forever to stay running
-	if !a.InitContainer {
-		template += fmt.Sprintf(`
+{{ .CopyView }}
+{{ .CopySoftware }}
+{{ .Done }}{{ if not .InitContainer }}
 # Sleep forever, the application needs to run and end
-echo "Sleeping forever so %s can be shared and use for %s."
-sleep infinity`, a.Mount, a.Identifier)
+echo "Sleeping forever so {{ .Mount }} can be shared and use for {{ .Identifier }}."
+sleep infinity{{ end }}`, spackViewContext{})
+
+	// spackWaitTemplate ensures the spack view is on the path, wherever it is mounted
+	spackWaitTemplate = specs.NewTemplate(spackViewIdentifier+"-wait", `# Ensure spack view is on the path, wherever it is mounted
+viewbase="{{ .Mount }}"
+viewroot=${viewbase}/view
+software="${viewbase}/software"
+viewbin="${viewroot}/bin"
+
+# Important to add AFTER in case software in container duplicated
+export PATH=$PATH:${viewbin}
+
+# Wait for the marker from the {{ .Container }} container to indicate the copy is done
+{{ .WaitDone }}
+# Copy mount software to /opt/software
+{{ .CopyMount }}
+{{ .Wait }}`, spackViewContext{})
+)
+
+// Generate a container spec that will map to a listing of containers for the replicated job
+func (a *SpackView) AssembleContainers() []specs.ContainerSpec {
+
+	// The entrypoint script
+	// This is the addon container entrypoint, we don't care about metadata here
+	// The sole purpose is just to provide the volume, meaning copying content there
+	script := spackViewTemplate.Render(spackViewContext{
+		Setup:         a.Setup,
+		Mount:         a.Mount,
+		View:          a.View,
+		CopyView:      CopyTreeBlock("${view}", "${viewroot}/view"),
+		CopySoftware:  CopyTreeBlock("/opt/software", "${viewroot}/software"),
+		Done:          DoneMarkerBlock("${viewroot}"),
+		InitContainer: a.InitContainer,
+		Identifier:    a.Identifier,
+	})
 
-	}
 	// Leave the name empty to generate in the namespace of the metric set (e.g., set.Name)
 	entrypoint := specs.EntrypointScript{
 		Name:   a.VolumeName,
@@ -101,6 +145,39 @@ sleep infinity`, a.Mount, a.Identifier)
 	}
 }
 
+// WaitForView returns the entrypoint logic to wait for the view to be copied,
+// copy the software to /opt/software, and add the view to the path. It defines
+// viewbase, viewroot, software, and viewbin, which paths to wait for can use
+// (e.g., ${viewbin}/hpcrun) along with later logic.
+func (a *SpackView) WaitForView(paths ...string) string {
+	return spackWaitTemplate.Render(spackViewContext{
+		Mount:     a.Mount,
+		Container: a.SpackViewContainer,
+		WaitDone:  WaitForPathBlock(0, DoneMarkerPath("${viewbase}")),
+		CopyMount: CopyTreeBlock("${software}", "/opt/software"),
+		Wait:      WaitForPathBlock(0, paths...),
+	})
+}
+
+// ExportView returns the entrypoint logic to add the view libraries (and any
+// other environment) after waiting for the view
+func (a *SpackView) ExportView(libraries bool, env map[string]intstr.IntOrString) string {
+	exports := []string{}
+	if libraries {
+		exports = append(exports, "export LD_LIBRARY_PATH=${LD_LIBRARY_PATH:+${LD_LIBRARY_PATH}:}${viewroot}/lib:${viewroot}/lib64")
+	}
+	keys := []string{}
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := env[key]
+		exports = append(exports, fmt.Sprintf("export %s=\"%s\"", key, value.String()))
+	}
+	return strings.Join(exports, "\n")
+}
+
 // AssembleVolumes to provide an empty volume for the application to share
 // We also need to provide a config map volume for our container spec
 func (m *SpackView) GetSpackViewVolumes() []specs.VolumeSpec {
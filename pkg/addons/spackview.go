@@ -0,0 +1,187 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/utils"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The spack-view addon copies a spack view from an image into a shared volume,
+// and waits for it (and adds it to the path) in the metric entrypoints. It is
+// the generic form of what tool addons like perf-hpctoolkit do.
+const (
+	spackViewIdentifier = "spack-view"
+)
+
+type SpackViewAddon struct {
+	SpackView
+
+	// Paths to wait for (in addition to the view being copied)
+	waitFor []string
+
+	// Add the view lib and lib64 to LD_LIBRARY_PATH
+	libraries bool
+
+	// Extra environment to export after the view is ready
+	env map[string]intstr.IntOrString
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (a SpackViewAddon) Family() string {
+	return AddonFamilyApplication
+}
+
+// AssembleVolumes provides the empty volume for the view (and the entrypoint)
+func (a *SpackViewAddon) AssembleVolumes() []specs.VolumeSpec {
+	return a.GetSpackViewVolumes()
+}
+
+// Validate we have an image with a view
+func (a *SpackViewAddon) Validate() bool {
+	if a.image == "" {
+		logger.Error("🟥️ The spack-view addon requires an 'image' with a spack view.")
+		return false
+	}
+	if a.Mount == "" || !strings.HasPrefix(a.Mount, "/") {
+		logger.Errorf("🟥️ The spack-view addon 'mount' must be an absolute path, found %q.", a.Mount)
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *SpackViewAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = spackViewIdentifier
+	a.EntrypointPath = "/metrics_operator/spack-view-entrypoint.sh"
+	a.SetDefaultOptions(metric)
+	a.Mount = "/opt/share"
+	a.VolumeName = "spack-view"
+	a.SpackViewContainer = "spack-view"
+	a.InitContainer = true
+	a.libraries = true
+	a.env = map[string]intstr.IntOrString{}
+
+	mount, ok := metric.Options["mount"]
+	if ok {
+		a.Mount = mount.StrVal
+	}
+	view, ok := metric.Options["view"]
+	if ok {
+		a.View = view.StrVal
+	}
+	setup, ok := metric.Options["setup"]
+	if ok {
+		a.Setup = setup.StrVal
+	}
+	libraries, ok := metric.Options["libraries"]
+	if ok && (libraries.StrVal == "false" || libraries.StrVal == "no") {
+		a.libraries = false
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+	waitFor, ok := metric.ListOptions["waitFor"]
+	if ok {
+		a.waitFor = append(a.waitFor, utils.ListStrings(waitFor)...)
+	}
+	env, ok := metric.MapOptions["env"]
+	if ok {
+		a.env = env
+	}
+}
+
+// Exported options and list options
+func (a *SpackViewAddon) Options() map[string]intstr.IntOrString {
+	libraries := "true"
+	if !a.libraries {
+		libraries = "false"
+	}
+	return map[string]intstr.IntOrString{
+		"image":           intstr.FromString(a.image),
+		"mount":           intstr.FromString(a.Mount),
+		"view":            intstr.FromString(a.View),
+		"libraries":       intstr.FromString(libraries),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+// Return formatted list options
+func (a *SpackViewAddon) ListOptions() map[string][]intstr.IntOrString {
+	return map[string][]intstr.IntOrString{
+		"waitFor": utils.StringList(a.waitFor),
+	}
+}
+
+// Return formatted map options
+func (a *SpackViewAddon) MapOptions() map[string]map[string]intstr.IntOrString {
+	return map[string]map[string]intstr.IntOrString{
+		"env": a.env,
+	}
+}
+
+// CustomizeEntrypoint scripts
+func (a *SpackViewAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// CustomizeEntrypoint for a single replicated job
+func (a *SpackViewAddon) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+	preBlock := blockTemplate.Render(blockContext{
+		Metadata: Metadata(a),
+		Blocks:   []string{a.WaitForView(a.waitFor...), a.ExportView(a.libraries, a.env)},
+	})
+
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		containerSpec.EntrypointScript.Pre += preBlock
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: spackViewIdentifier,
+		Summary:    "copy a spack view from an image into the metric containers",
+	}
+	app := ApplicationAddon{AddonBase: base}
+	spack := SpackView{ApplicationAddon: app}
+	view := SpackViewAddon{SpackView: spack}
+	Register(&view)
+}
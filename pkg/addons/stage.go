@@ -0,0 +1,448 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// The stage volume downloads inputs (e.g., a dataset) from a URL, git repository,
+// or s3 prefix into a shared volume with an init container before the run.
+// Optionally, inputs are cached on a node-local path so they are fetched once per node.
+const (
+	stageName       = "volume-stage"
+	stageCacheMount = "/mnt/metrics-operator-cache"
+	stageMarker     = ".metrics-operator-staged"
+)
+
+var (
+	stageModes        = []string{"http", "git", "s3"}
+	directoryOrCreate = corev1.HostPathDirectoryOrCreate
+
+	// The node cache cannot be (or be under) a system directory
+	stageCacheForbidden = []string{
+		"/bin", "/boot", "/dev", "/etc", "/lib", "/lib64", "/proc", "/root", "/run", "/sbin", "/sys", "/usr",
+		"/var/lib/containerd", "/var/lib/docker", "/var/lib/kubelet", "/var/log", "/var/run",
+	}
+
+	// A git revision that is a commit does not change
+	gitCommitRegex = regexp.MustCompile("^[0-9a-f]{40}$")
+)
+
+type StageVolume struct {
+	VolumeBase
+
+	// Container image with curl, git, and the aws client
+	image string
+
+	// URL, git repository, or s3 prefix to stage
+	source string
+
+	// http, git, or s3 (derived from the source if not set)
+	mode string
+
+	// Expected sha256 of an http download
+	sha256 string
+
+	// Extract an http download (a tar archive) into the volume
+	extract bool
+
+	// Git branch, tag, or commit
+	revision string
+
+	// s3 compatible endpoint, and secret with AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+	endpoint   string
+	secretName string
+
+	// Node-local directory to cache inputs (empty is no cache)
+	cachePath string
+}
+
+// Validate we have a source we know how to stage
+func (v *StageVolume) Validate() bool {
+	if v.source == "" {
+		logger.Error("🟥️ The volume-stage addon requires a 'source' to stage.")
+		return false
+	}
+	valid := false
+	for _, mode := range stageModes {
+		valid = valid || mode == v.mode
+	}
+	if !valid {
+		logger.Errorf("🟥️ The volume-stage addon mode must be one of %s, found %s.", stageModes, v.mode)
+		return false
+	}
+	if v.sha256 != "" && v.mode != "http" {
+		logger.Error("🟥️ The volume-stage addon 'sha256' is only supported for http sources.")
+		return false
+	}
+	if v.cachePath != "" && !isValidCachePath(v.cachePath) {
+		logger.Errorf("🟥️ The volume-stage addon 'cachePath' must be an absolute path below a top level directory, and not a system directory, found %s.", v.cachePath)
+		return false
+	}
+	return v.DefaultValidate()
+}
+
+// isValidCachePath determines if a host path can be used for the node cache
+func isValidCachePath(cachePath string) bool {
+	cleaned := filepath.Clean(cachePath)
+	if !filepath.IsAbs(cleaned) || strings.Count(cleaned, "/") < 2 {
+		return false
+	}
+	for _, forbidden := range stageCacheForbidden {
+		if cleaned == forbidden || strings.HasPrefix(cleaned, forbidden+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// getStageMode derives the mode from the source
+func getStageMode(source string) string {
+	if strings.HasPrefix(source, "s3://") {
+		return "s3"
+	}
+	if strings.HasPrefix(source, "git+") || strings.HasSuffix(source, ".git") {
+		return "git"
+	}
+	return "http"
+}
+
+// Set custom options / attributes
+func (v *StageVolume) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	v.Identifier = stageName
+	v.image = "ghcr.io/converged-computing/metric-stage:latest"
+
+	image, ok := metric.Options["image"]
+	if ok {
+		v.image = image.StrVal
+	}
+	source, ok := metric.Options["source"]
+	if ok {
+		v.source = source.StrVal
+	}
+	v.mode = getStageMode(v.source)
+	mode, ok := metric.Options["mode"]
+	if ok {
+		v.mode = mode.StrVal
+	}
+	checksum, ok := metric.Options["sha256"]
+	if ok {
+		v.sha256 = checksum.StrVal
+	}
+	extract, ok := metric.Options["extract"]
+	if ok {
+		v.extract = extract.StrVal == "true" || extract.StrVal == "yes"
+	}
+	revision, ok := metric.Options["revision"]
+	if ok {
+		v.revision = revision.StrVal
+	}
+	endpoint, ok := metric.Options["endpoint"]
+	if ok {
+		v.endpoint = endpoint.StrVal
+	}
+	secretName, ok := metric.Options["secretName"]
+	if ok {
+		v.secretName = secretName.StrVal
+	}
+	cachePath, ok := metric.Options["cachePath"]
+	if ok {
+		v.cachePath = cachePath.StrVal
+	}
+
+	// The node cache is a host path, so it is not used for baseline or restricted
+	if v.cachePath != "" && !m.IsPrivilegedProfile() {
+		logger.Warnf("🟧️ The stage cachePath is a host path, and is not used with the %s security profile", m.Spec.SecurityProfile)
+		v.cachePath = ""
+	}
+	v.DefaultSetOptions(metric)
+}
+
+// Exported options and list options
+func (v *StageVolume) Options() map[string]intstr.IntOrString {
+	extract := "false"
+	if v.extract {
+		extract = "true"
+	}
+	return map[string]intstr.IntOrString{
+		"name":            intstr.FromString(v.name),
+		"path":            intstr.FromString(v.path),
+		"image":           intstr.FromString(v.image),
+		"source":          intstr.FromString(v.source),
+		"mode":            intstr.FromString(v.mode),
+		"sha256":          intstr.FromString(v.sha256),
+		"extract":         intstr.FromString(extract),
+		"revision":        intstr.FromString(v.revision),
+		"endpoint":        intstr.FromString(v.endpoint),
+		"secretName":      intstr.FromString(v.secretName),
+		"cachePath":       intstr.FromString(v.cachePath),
+		"target":          intstr.FromString(v.target),
+		"containerTarget": intstr.FromString(v.containerTarget),
+	}
+}
+
+// containerName is the name of the init container that stages the inputs
+func (v *StageVolume) containerName() string {
+	return fmt.Sprintf("stage-%s", v.name)
+}
+
+// entrypoint is the path of the init container entrypoint
+func (v *StageVolume) entrypoint() string {
+	return fmt.Sprintf("/metrics_operator/%s-stage-entrypoint.sh", v.name)
+}
+
+// cacheKey is unique to the source (and what we expect of it). When the source
+// can change, the version found when staging is added to the key.
+func (v *StageVolume) cacheKey() string {
+	key := strings.Join([]string{v.mode, v.source, v.revision, v.sha256}, "@")
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))[:16]
+}
+
+// AssembleVolumes provides the staged volume, and the node-local cache
+func (v *StageVolume) AssembleVolumes() []specs.VolumeSpec {
+	staged := corev1.Volume{
+		Name: v.name,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+
+	// The init container entrypoint is generated in the metrics operator config map
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  v.containerName(),
+					Path: filepath.Base(v.entrypoint()),
+				}},
+			},
+		},
+	}
+	volumes := []specs.VolumeSpec{
+		{
+			Volume:          staged,
+			Path:            v.path,
+			Mount:           true,
+			ReadOnly:        v.readOnly,
+			Target:          v.target,
+			ContainerTarget: v.containerTarget,
+			MountProvider:   v.containerName(),
+		},
+		{
+			Volume:   configVolume,
+			ReadOnly: true,
+			Mount:    false,
+			Path:     filepath.Dir(v.entrypoint()),
+		},
+	}
+	if v.cachePath != "" {
+		cache := corev1.Volume{
+			Name: fmt.Sprintf("%s-cache", v.name),
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: v.cachePath,
+					Type: &directoryOrCreate,
+				},
+			},
+		}
+		volumes = append(volumes, specs.VolumeSpec{
+			Volume:          cache,
+			Path:            stageCacheMount,
+			Mount:           true,
+			Target:          v.target,
+			ContainerTarget: v.containerName(),
+		})
+	}
+	return volumes
+}
+
+// versionCommand returns a command that prints the current version of a source
+// that can change (the ETag or modified time of a download, or the commit of a
+// git branch), or an empty string if the source is pinned or cannot be versioned
+func (v *StageVolume) versionCommand() string {
+	if v.mode == "http" && v.sha256 == "" {
+		return fmt.Sprintf(`curl -fsSIL %s | tr -d '\r' | awk -F': ' 'tolower($1) == "etag" { etag = $2 } tolower($1) == "last-modified" { modified = $2 } END { print (etag != "" ? etag : modified) }'`, v.source)
+	}
+	if v.mode == "git" && !gitCommitRegex.MatchString(v.revision) {
+		revision := v.revision
+		if revision == "" {
+			revision = "HEAD"
+		}
+		return fmt.Sprintf("git ls-remote %s %s | head -n 1 | cut -f1", strings.TrimPrefix(v.source, "git+"), revision)
+	}
+	return ""
+}
+
+// stageCommands returns the commands to stage the source into ${target}
+func (v *StageVolume) stageCommands() string {
+	if v.mode == "s3" {
+		command := fmt.Sprintf("mo_retry aws s3 sync --delete %s ${target}", v.source)
+		if v.endpoint != "" {
+			command += fmt.Sprintf(" --endpoint-url %s", v.endpoint)
+		}
+		return command
+	}
+	if v.mode == "git" {
+		source := strings.TrimPrefix(v.source, "git+")
+		if v.revision == "" {
+			return fmt.Sprintf("git clone --depth 1 %s ${target}", source)
+		}
+		return fmt.Sprintf("git clone %s ${target}\n    git -C ${target} checkout %s", source, v.revision)
+	}
+
+	// An http download, optionally verified and extracted
+	command := fmt.Sprintf("file=${target}/%s\n    mo_retry curl -fsSL -o ${file} %s", path.Base(v.source), v.source)
+	if v.sha256 != "" {
+		command += fmt.Sprintf("\n    mo_checksum_verify ${file} %s", v.sha256)
+	}
+	if v.extract {
+		command += "\n    tar -xf ${file} -C ${target}\n    rm ${file}"
+	}
+	return command
+}
+
+// stageContext is for the template of the stage init container
+type stageContext struct {
+	Metadata string
+	Path     string
+	Cache    string
+	Source   string
+	Stage    string
+	Version  string
+	Sync     bool
+	Marker   string
+}
+
+// stageTemplate stages the inputs to the volume, or once per node (and version
+// of the source) to the cache. An s3 prefix is synced to the cache each time.
+var stageTemplate = specs.NewTemplate(stageName, `#!/bin/bash
+echo "{{ .Metadata }}"
+set -eo pipefail
+dest={{ .Path }}
+cache={{ .Cache }}
+mkdir -p ${dest}
+
+stage() {
+    target=$1
+    echo "Staging {{ .Source }} to ${target}"
+    {{ .Stage }}
+}
+{{ if .Version }}
+# A source that can change is cached by its version, and is not cached without one
+if [[ "${cache}" != "" ]]; then
+    version=$({{ .Version }}) || version=""
+    if [[ "${version}" == "" ]]; then
+        echo "The version of {{ .Source }} is unknown, staging without the cache"
+        cache=""
+    else
+        echo "Found version ${version} of {{ .Source }}"
+        cache=${cache}-$(printf '%s' "${version}" | cksum | cut -d' ' -f1)
+    fi
+fi
+{{ end }}
+# Without a cache, stage directly to the volume
+if [[ "${cache}" == "" ]]; then
+    stage ${dest}
+
+# Otherwise stage once per node (pods on the same node wait on the lock)
+else
+    mkdir -p $(dirname ${cache})
+    (
+        flock 9
+        if [[ ! -e ${cache}/{{ .Marker }} ]]; then
+            rm -rf ${cache}
+            mkdir -p ${cache}
+            stage ${cache}
+            touch ${cache}/{{ .Marker }}
+        else
+{{- if .Sync }}
+            echo "Syncing cached inputs at ${cache}"
+            stage ${cache}
+            touch ${cache}/{{ .Marker }}
+{{- else }}
+            echo "Using cached inputs at ${cache}"
+{{- end }}
+        fi
+        cp -a ${cache}/. ${dest}/
+    ) 9>${cache}.lock
+    rm -f ${dest}/{{ .Marker }}
+fi
+echo "Inputs staged to ${dest}"
+`, stageContext{})
+
+// AssembleContainers adds the init container that stages the inputs
+func (v *StageVolume) AssembleContainers() []specs.ContainerSpec {
+	cache := ""
+	if v.cachePath != "" {
+		cache = filepath.Join(stageCacheMount, v.cacheKey())
+	}
+
+	script := stageTemplate.Render(stageContext{
+		Metadata: Metadata(v),
+		Path:     v.path,
+		Cache:    cache,
+		Source:   v.source,
+		Stage:    v.stageCommands(),
+		Version:  v.versionCommand(),
+		Sync:     v.mode == "s3",
+		Marker:   stageMarker,
+	})
+	entrypoint := specs.EntrypointScript{
+		Name:   v.containerName(),
+		Path:   v.entrypoint(),
+		Script: filepath.Base(v.entrypoint()),
+		Pre:    script,
+	}
+
+	// Credentials for s3 are optional (e.g., the node might have a role)
+	env := []corev1.EnvVar{}
+	if v.secretName != "" {
+		for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+			env = append(env, corev1.EnvVar{
+				Name: key,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: v.secretName},
+						Key:                  key,
+					},
+				},
+			})
+		}
+	}
+	return []specs.ContainerSpec{{
+		JobName:          v.target,
+		Image:            v.image,
+		Name:             v.containerName(),
+		EntrypointScript: entrypoint,
+		InitContainer:    true,
+		Resources:        &api.ContainerResources{},
+		Attributes:       &api.ContainerSpec{},
+		NeedsWrite:       true,
+		Env:              env,
+	}}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: stageName,
+		Summary:    "stage inputs from a url, git repository, or s3 prefix into a volume before the run",
+	}
+	stage := StageVolume{VolumeBase: VolumeBase{AddonBase: base}}
+	Register(&stage)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestStageCachePath(t *testing.T) {
+	tests := map[string]bool{
+		"/var/cache/metrics-operator": true,
+		"/mnt/datasets/":              true,
+		"/":                           false,
+		"/data":                       false,
+		"cache":                       false,
+		"/etc/metrics-operator":       false,
+		"/var/lib/kubelet/pods":       false,
+		"/usr/../etc/cache":           false,
+	}
+	for cachePath, valid := range tests {
+		if isValidCachePath(cachePath) != valid {
+			t.Errorf("expected cache path %s to be valid %v", cachePath, valid)
+		}
+	}
+}
+
+func TestStageCache(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	_, err = exec.LookPath("flock")
+	if err != nil {
+		t.Skip("flock is required to stage to the cache")
+	}
+	a, err := GetAddon(&api.MetricAddon{Name: stageName, Options: map[string]intstr.IntOrString{
+		"name":      intstr.FromString("data"),
+		"path":      intstr.FromString("/data"),
+		"source":    intstr.FromString("https://example.com/data.txt"),
+		"cachePath": intstr.FromString("/var/cache/metrics-operator"),
+	}}, &api.MetricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fake curl reports an ETag for headers, and otherwise downloads it
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	cache := filepath.Join(dir, "cache")
+	err = os.MkdirAll(bin, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	curl := "#!/bin/sh\nif [ \"$1\" = -fsSIL ]; then printf 'HTTP/1.1 200 OK\\r\\nETag: \"%s\"\\r\\n' ${ETAG}; exit 0; fi\necho ${ETAG} > $3\n"
+	err = os.WriteFile(filepath.Join(bin, "curl"), []byte(curl), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := a.AssembleContainers()[0].EntrypointScript.Pre
+	script = strings.ReplaceAll(script, stageCacheMount, cache)
+
+	// The same version is staged once, and a new version is staged again
+	for i, etag := range []string{"v1", "v1", "v2"} {
+		dest := filepath.Join(dir, "data", etag, string(rune('a'+i)))
+		cmd := exec.Command(bash, "-c", specs.Prelude+strings.ReplaceAll(script, "dest=/data", "dest="+dest))
+		cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"), "ETAG="+etag)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("staging failed: %s\n%s", err, out)
+		}
+		if (i == 1) != strings.Contains(string(out), "Using cached inputs") {
+			t.Errorf("expected only the second stage of %s to use the cache:\n%s", etag, out)
+		}
+		content, err := os.ReadFile(filepath.Join(dest, "data.txt"))
+		if err != nil || strings.TrimSpace(string(content)) != etag {
+			t.Errorf("expected %s to be staged, found %q %v", etag, content, err)
+		}
+	}
+	versions, _ := filepath.Glob(filepath.Join(cache, "*-*[0-9]"))
+	if len(versions) != 2 {
+		t.Errorf("expected a cache for each version, found %v", versions)
+	}
+}
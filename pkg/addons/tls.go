@@ -0,0 +1,329 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"path/filepath"
+	"time"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The tls addon provisions a certificate for the pods of a run, either from a
+// cert-manager issuer or self-signed (by the operator), in a secret that is
+// mounted into the metric containers. The certificate is valid for the pod
+// hostnames, so the pods can be both clients and servers.
+const (
+	TLSIdentifier = "tls"
+
+	// Keys in the secret (the same as cert-manager uses)
+	TLSCAKey   = "ca.crt"
+	TLSCertKey = "tls.crt"
+	TLSKeyKey  = "tls.key"
+)
+
+// CertificateKind is the cert-manager Certificate
+var CertificateKind = schema.GroupVersionKind{
+	Group:   "cert-manager.io",
+	Version: "v1",
+	Kind:    "Certificate",
+}
+
+type TLSAddon struct {
+	VolumeBase
+
+	// Secret with the certificate (named after the MetricSet)
+	secretName string
+
+	// A cert-manager issuer (empty generates a self-signed certificate)
+	issuer     string
+	issuerKind string
+
+	// How long the certificate is valid
+	duration string
+
+	// Hostnames the certificate is valid for
+	dnsNames []string
+}
+
+// Validate the issuer and duration
+func (a *TLSAddon) Validate() bool {
+	if a.issuerKind != "Issuer" && a.issuerKind != "ClusterIssuer" {
+		logger.Errorf("🟥️ The tls addon 'issuerKind' must be Issuer or ClusterIssuer, found %s.", a.issuerKind)
+		return false
+	}
+	duration, err := time.ParseDuration(a.duration)
+	if err != nil || duration < time.Hour {
+		logger.Errorf("🟥️ The tls addon 'duration' must be a duration of at least 1h (e.g., 720h), found %s.", a.duration)
+		return false
+	}
+	return a.DefaultValidate()
+}
+
+// Set custom options / attributes
+func (a *TLSAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = TLSIdentifier
+	a.name = "metrics-operator-tls"
+	a.path = "/etc/metrics-operator/tls"
+	a.readOnly = true
+	a.issuerKind = "Issuer"
+	a.duration = "720h"
+	a.DefaultSetOptions(metric)
+
+	issuer, ok := metric.Options["issuer"]
+	if ok {
+		a.issuer = issuer.StrVal
+	}
+	issuerKind, ok := metric.Options["issuerKind"]
+	if ok {
+		a.issuerKind = issuerKind.StrVal
+	}
+	duration, ok := metric.Options["duration"]
+	if ok {
+		a.duration = duration.StrVal
+	}
+
+	// The pod hostnames (and the service) and any others requested
+	a.secretName = m.TLSSecretName()
+	domain := fmt.Sprintf("%s.%s.svc", m.Subdomain(), m.Namespace)
+	a.dnsNames = []string{
+		fmt.Sprintf("*.%s.cluster.local", domain),
+		fmt.Sprintf("*.%s", domain),
+		fmt.Sprintf("*.%s", m.Subdomain()),
+		fmt.Sprintf("%s.cluster.local", domain),
+		"localhost",
+	}
+	dnsNames, ok := metric.ListOptions["dnsNames"]
+	if ok {
+		a.dnsNames = append(a.dnsNames, utils.ListStrings(dnsNames)...)
+	}
+}
+
+// Exported options and list options
+func (a *TLSAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"path":            intstr.FromString(a.path),
+		"issuer":          intstr.FromString(a.issuer),
+		"issuerKind":      intstr.FromString(a.issuerKind),
+		"duration":        intstr.FromString(a.duration),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+// Return formatted list options
+func (a *TLSAddon) ListOptions() map[string][]intstr.IntOrString {
+	return map[string][]intstr.IntOrString{
+		"dnsNames": utils.StringList(a.dnsNames),
+	}
+}
+
+// AssembleVolumes mounts the secret with the certificate
+func (a *TLSAddon) AssembleVolumes() []specs.VolumeSpec {
+	volume := corev1.Volume{
+		Name: a.name,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: a.secretName,
+			},
+		},
+	}
+	return []specs.VolumeSpec{{
+		Volume:          volume,
+		ReadOnly:        a.readOnly,
+		Path:            a.path,
+		Mount:           true,
+		Target:          a.target,
+		ContainerTarget: a.containerTarget,
+	}}
+}
+
+// tlsContext is for the template of the certificate paths
+type tlsContext struct {
+	Metadata string
+	CA       string
+	Cert     string
+	Key      string
+}
+
+// tlsTemplate exports the paths of the certificate files
+var tlsTemplate = specs.NewTemplate(TLSIdentifier, `
+echo "{{ .Metadata }}"
+export TLS_CA_FILE={{ .CA }}
+export TLS_CERT_FILE={{ .Cert }}
+export TLS_KEY_FILE={{ .Key }}
+`, tlsContext{})
+
+// CustomizeEntrypoints exports the paths of the certificate files
+func (a *TLSAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	preBlock := tlsTemplate.Render(tlsContext{
+		Metadata: Metadata(a),
+		CA:       filepath.Join(a.path, TLSCAKey),
+		Cert:     filepath.Join(a.path, TLSCertKey),
+		Key:      filepath.Join(a.path, TLSKeyKey),
+	})
+	for _, rj := range rjs {
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		for _, containerSpec := range cs {
+			if containerSpec.JobName != rj.Name {
+				continue
+			}
+			if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+				continue
+			}
+			containerSpec.EntrypointScript.Pre += preBlock
+		}
+	}
+}
+
+// SecretName is the name of the secret with the certificate
+func (a *TLSAddon) SecretName() string {
+	return a.secretName
+}
+
+// UsesIssuer determines if cert-manager issues the certificate
+func (a *TLSAddon) UsesIssuer() bool {
+	return a.issuer != ""
+}
+
+// Certificate returns the cert-manager Certificate that writes the secret
+func (a *TLSAddon) Certificate(set *api.MetricSet) *unstructured.Unstructured {
+	dnsNames := []interface{}{}
+	for _, name := range a.dnsNames {
+		dnsNames = append(dnsNames, name)
+	}
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(CertificateKind)
+	cert.SetName(a.secretName)
+	cert.SetNamespace(set.Namespace)
+	cert.Object["spec"] = map[string]interface{}{
+		"secretName": a.secretName,
+		"duration":   a.duration,
+		"dnsNames":   dnsNames,
+		"usages":     []interface{}{"server auth", "client auth"},
+		"issuerRef": map[string]interface{}{
+			"name":  a.issuer,
+			"kind":  a.issuerKind,
+			"group": CertificateKind.Group,
+		},
+	}
+	return cert
+}
+
+// SelfSignedSecret generates a certificate authority, and a certificate it
+// signs, in a secret for the pods
+func (a *TLSAddon) SelfSignedSecret(set *api.MetricSet) (*corev1.Secret, error) {
+	duration, err := time.ParseDuration(a.duration)
+	if err != nil {
+		return nil, err
+	}
+	notBefore := time.Now().Add(-5 * time.Minute)
+	notAfter := notBefore.Add(duration)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("%s-ca", set.Name), Organization: []string{"metrics-operator"}},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	caTemplate.SerialNumber, err = serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: a.dnsNames[0], Organization: []string{"metrics-operator"}},
+		DNSNames:    a.dnsNames,
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	template.SerialNumber, err = serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      a.secretName,
+			Namespace: set.Namespace,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			TLSCAKey:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+			TLSCertKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+			TLSKeyKey:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		},
+	}
+	return secret, nil
+}
+
+// serialNumber generates a random certificate serial number
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: TLSIdentifier,
+		Summary:    "provision a certificate (cert-manager or self-signed) for the pods of a run",
+	}
+	volume := VolumeBase{AddonBase: base}
+	tls := TLSAddon{VolumeBase: volume}
+	Register(&tls)
+}
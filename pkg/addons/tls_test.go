@@ -0,0 +1,110 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// getTLSAddon returns a tls addon for a synthetic MetricSet
+func getTLSAddon(t *testing.T, options map[string]intstr.IntOrString) (*TLSAddon, *api.MetricSet) {
+	t.Helper()
+	set := &api.MetricSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "bench", Namespace: "default"},
+		Spec:       api.MetricSetSpec{ServiceName: "ms"},
+	}
+	addon, err := GetAddon(&api.MetricAddon{Name: TLSIdentifier, Options: options}, set)
+	if err != nil {
+		t.Fatalf("tls addon: %s", err)
+	}
+	return addon.(*TLSAddon), set
+}
+
+func TestTLSSelfSignedSecret(t *testing.T) {
+	tls, set := getTLSAddon(t, nil)
+	if tls.UsesIssuer() {
+		t.Fatal("expected a self-signed certificate without an issuer")
+	}
+	secret, err := tls.SelfSignedSecret(set)
+	if err != nil {
+		t.Fatalf("self-signed secret: %s", err)
+	}
+	if secret.Name != "bench-tls" || secret.Namespace != "default" {
+		t.Errorf("unexpected secret %s/%s", secret.Namespace, secret.Name)
+	}
+
+	// The certificate is signed by the CA, for the pod hostnames
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(secret.Data[TLSCAKey]) {
+		t.Fatal("ca.crt is not a certificate")
+	}
+	block, _ := pem.Decode(secret.Data[TLSCertKey])
+	if block == nil {
+		t.Fatal("tls.crt is not a certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"bench-l-0-0.ms.default.svc.cluster.local", "bench-w-0-1.ms", "localhost"} {
+		_, err = cert.Verify(x509.VerifyOptions{
+			DNSName:   host,
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			t.Errorf("certificate does not verify for %s: %s", host, err)
+		}
+	}
+	block, _ = pem.Decode(secret.Data[TLSKeyKey])
+	if block == nil {
+		t.Fatal("tls.key is not a key")
+	}
+	if _, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+		t.Errorf("tls.key is not an EC key: %s", err)
+	}
+}
+
+func TestTLSCertificate(t *testing.T) {
+	tls, set := getTLSAddon(t, map[string]intstr.IntOrString{
+		"issuer":     intstr.FromString("site-ca"),
+		"issuerKind": intstr.FromString("ClusterIssuer"),
+	})
+	if !tls.UsesIssuer() {
+		t.Fatal("expected cert-manager to issue the certificate")
+	}
+	cert := tls.Certificate(set)
+	if cert.GroupVersionKind() != CertificateKind || cert.GetName() != "bench-tls" {
+		t.Errorf("unexpected certificate %s %s", cert.GroupVersionKind(), cert.GetName())
+	}
+	spec := cert.Object["spec"].(map[string]interface{})
+	issuer := spec["issuerRef"].(map[string]interface{})
+	if spec["secretName"] != "bench-tls" || issuer["name"] != "site-ca" || issuer["kind"] != "ClusterIssuer" {
+		t.Errorf("unexpected certificate spec %v", spec)
+	}
+}
+
+func TestTLSValidate(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "bench", Namespace: "default"}}
+	for _, options := range []map[string]intstr.IntOrString{
+		{"issuerKind": intstr.FromString("Vault")},
+		{"duration": intstr.FromString("10m")},
+		{"duration": intstr.FromString("a month")},
+	} {
+		_, err := GetAddon(&api.MetricAddon{Name: TLSIdentifier, Options: options}, set)
+		if err == nil {
+			t.Errorf("expected options %v to not validate", options)
+		}
+	}
+}
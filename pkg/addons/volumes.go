@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"math/rand"
 	"path/filepath"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 
@@ -32,6 +33,10 @@ type VolumeBase struct {
 	readOnly bool
 	name     string
 	path     string
+
+	// job name and container name targets (empty mounts into all)
+	target          string
+	containerTarget string
 }
 
 func (m VolumeBase) Family() string {
@@ -76,6 +81,19 @@ func (v *VolumeBase) DefaultSetOptions(metric *api.MetricAddon) {
 			v.readOnly = true
 		}
 	}
+	v.setTargets(metric)
+}
+
+// setTargets limits the volume to a replicated job and/or container
+func (v *VolumeBase) setTargets(metric *api.MetricAddon) {
+	target, ok := metric.Options["target"]
+	if ok {
+		v.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		v.containerTarget = ctarget.StrVal
+	}
 }
 
 // A general metric is a container added to a JobSet
@@ -129,9 +147,11 @@ func (v *ConfigMapVolume) SetOptions(metric *api.MetricAddon, m *api.MetricSet)
 // Exported options and list options
 func (v *ConfigMapVolume) Options() map[string]intstr.IntOrString {
 	return map[string]intstr.IntOrString{
-		"path":          intstr.FromString(v.path),
-		"name":          intstr.FromString(v.name),
-		"configMapName": intstr.FromString(v.configMapName),
+		"path":            intstr.FromString(v.path),
+		"name":            intstr.FromString(v.name),
+		"configMapName":   intstr.FromString(v.configMapName),
+		"target":          intstr.FromString(v.target),
+		"containerTarget": intstr.FromString(v.containerTarget),
 	}
 }
 
@@ -174,10 +194,12 @@ func (v *ConfigMapVolume) AssembleVolumes() []specs.VolumeSpec {
 
 	// ConfigMaps have to be read only!
 	return []specs.VolumeSpec{{
-		Volume:   newVolume,
-		Path:     filepath.Dir(v.path),
-		ReadOnly: true,
-		Mount:    true,
+		Volume:          newVolume,
+		Path:            filepath.Dir(v.path),
+		ReadOnly:        true,
+		Mount:           true,
+		Target:          v.target,
+		ContainerTarget: v.containerTarget,
 	}}
 }
 
@@ -221,10 +243,12 @@ func (v *PersistentVolumeClaim) AssembleVolumes() []specs.VolumeSpec {
 		},
 	}
 	return []specs.VolumeSpec{{
-		Volume:   volume,
-		Path:     filepath.Dir(v.path),
-		ReadOnly: v.readOnly,
-		Mount:    true,
+		Volume:          volume,
+		Path:            filepath.Dir(v.path),
+		ReadOnly:        v.readOnly,
+		Mount:           true,
+		Target:          v.target,
+		ContainerTarget: v.containerTarget,
 	}}
 }
 
@@ -267,10 +291,12 @@ func (v *SecretVolume) AssembleVolumes() []specs.VolumeSpec {
 		},
 	}
 	return []specs.VolumeSpec{{
-		Volume:   volume,
-		ReadOnly: v.readOnly,
-		Path:     v.path,
-		Mount:    true,
+		Volume:          volume,
+		ReadOnly:        v.readOnly,
+		Path:            v.path,
+		Mount:           true,
+		Target:          v.target,
+		ContainerTarget: v.containerTarget,
 	}}
 }
 
@@ -315,30 +341,42 @@ func (v *HostPathVolume) AssembleVolumes() []specs.VolumeSpec {
 		},
 	}
 	return []specs.VolumeSpec{{
-		Volume:   volume,
-		Mount:    true,
-		Path:     v.path,
-		ReadOnly: v.readOnly,
+		Volume:          volume,
+		Mount:           true,
+		Path:            v.path,
+		ReadOnly:        v.readOnly,
+		Target:          v.target,
+		ContainerTarget: v.containerTarget,
 	}}
 }
 
 // An empty volume requires nothing! Nice!
+// A medium of Memory is a tmpfs, and HugePages (or HugePages-<size>) is backed
+// by hugepages, which the container must request (e.g., hugepages-2Mi).
 type EmptyVolume struct {
 	VolumeBase
+	medium string
 }
 
-// Validate we have an executable provided, and args and optional
+// Validate the medium is one Kubernetes knows
 func (v *EmptyVolume) Validate() bool {
+	medium := corev1.StorageMedium(v.medium)
+	if medium != corev1.StorageMediumDefault && medium != corev1.StorageMediumMemory &&
+		medium != corev1.StorageMediumHugePages && !strings.HasPrefix(v.medium, string(corev1.StorageMediumHugePagesPrefix)) {
+		logger.Errorf("🟥️ The medium of an empty volume must be Memory, HugePages, or HugePages-<size>, found %s", v.medium)
+		return false
+	}
 	return v.DefaultValidate()
 }
 
 // Set custom options / attributes
 func (v *EmptyVolume) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
 	v.Identifier = emptyName
-	name, ok := metric.Options["name"]
+	medium, ok := metric.Options["medium"]
 	if ok {
-		v.name = name.StrVal
+		v.medium = medium.StrVal
 	}
+	v.DefaultSetOptions(metric)
 }
 
 // AssembleVolumes for an empty volume
@@ -346,14 +384,16 @@ func (v *EmptyVolume) AssembleVolumes() []specs.VolumeSpec {
 	volume := corev1.Volume{
 		Name: v.name,
 		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
+			EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMedium(v.medium)},
 		},
 	}
 	return []specs.VolumeSpec{{
-		Volume:   volume,
-		Mount:    true,
-		Path:     v.path,
-		ReadOnly: v.readOnly,
+		Volume:          volume,
+		Mount:           true,
+		Path:            v.path,
+		ReadOnly:        v.readOnly,
+		Target:          v.target,
+		ContainerTarget: v.containerTarget,
 	}}
 }
 
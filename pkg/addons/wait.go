@@ -0,0 +1,106 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"strings"
+
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// Shell blocks for addons that share content between containers. A container
+// that provides content copies it (CopyTreeBlock) and then writes a marker
+// (DoneMarkerBlock) last. A container that uses the content polls for the
+// marker (WaitForPathBlock with DoneMarkerPath), so it never needs to guess
+// how long a copy takes. Paths can reference shell variables, e.g.,
+// ${viewbin}/hpcrun, and are expanded when the block runs.
+
+// DoneMarker is the file written when content is done being copied
+const DoneMarker = "metrics-operator-done.txt"
+
+// WaitPollSeconds is how often a wait block checks for its paths
+const WaitPollSeconds = 1
+
+// DoneMarkerPath returns the path of the done marker in a directory
+func DoneMarkerPath(dir string) string {
+	return strings.TrimSuffix(dir, "/") + "/" + DoneMarker
+}
+
+// waitContext is for the templates of the shared content blocks
+type waitContext struct {
+	Paths   []string
+	Timeout int
+	Poll    int
+	Marker  string
+
+	// A copy is from the source to the destination (without trailing slashes)
+	Source string
+	Dest   string
+	From   string
+	To     string
+}
+
+var (
+	// waitForPathTemplate polls until each (quoted) path exists
+	waitForPathTemplate = specs.NewTemplate("wait-for-path", `# Wait for paths to exist
+mo_waited=0
+for mo_path in {{ join .Paths " " }}; do
+    until [ -e "${mo_path}" ]; do
+{{ if gt .Timeout 0 }}        if [ ${mo_waited} -ge {{ .Timeout }} ]; then
+            echo "Timed out after {{ .Timeout }}s waiting for ${mo_path}"
+            exit 1
+        fi
+{{ end }}        sleep {{ .Poll }}
+        mo_waited=$((mo_waited+{{ .Poll }}))
+    done
+done
+`, waitContext{})
+
+	// doneMarkerTemplate writes the done marker
+	doneMarkerTemplate = specs.NewTemplate("done-marker", `# This is a marker to indicate the copy is done
+sync
+touch "{{ .Marker }}"
+`, waitContext{})
+
+	// copyTreeTemplate copies the contents of a directory into another
+	copyTreeTemplate = specs.NewTemplate("copy-tree", `# Copy the contents of {{ .Source }} to {{ .Dest }}
+mkdir -p "{{ .Dest }}"
+mo_retry cp -R "{{ .From }}"/. "{{ .To }}"/
+`, waitContext{})
+)
+
+// WaitForPathBlock returns shell logic that polls until each path exists.
+// With a timeout (in seconds) greater than zero, the script exits with an
+// error if the paths do not all exist by then. Otherwise it waits forever.
+func WaitForPathBlock(timeout int, paths ...string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	quoted := []string{}
+	for _, path := range paths {
+		quoted = append(quoted, "\""+path+"\"")
+	}
+	return waitForPathTemplate.Render(waitContext{Paths: quoted, Timeout: timeout, Poll: WaitPollSeconds})
+}
+
+// DoneMarkerBlock returns shell logic to write the done marker in a directory.
+// It should come after all content is written there.
+func DoneMarkerBlock(dir string) string {
+	return doneMarkerTemplate.Render(waitContext{Marker: DoneMarkerPath(dir)})
+}
+
+// CopyTreeBlock returns shell logic to copy the contents of a directory
+// (including hidden files) into another, which is created if needed.
+func CopyTreeBlock(src, dest string) string {
+	return copyTreeTemplate.Render(waitContext{
+		Source: src,
+		Dest:   dest,
+		From:   strings.TrimSuffix(src, "/"),
+		To:     strings.TrimSuffix(dest, "/"),
+	})
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// runBlock runs a shell block with bash in a directory, after the prelude
+// (as in an entrypoint)
+func runBlock(t *testing.T, dir, block string) error {
+	t.Helper()
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	cmd := exec.Command(bash, "-c", specs.Prelude+"set -e\n"+block)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Logf("%s", out)
+	}
+	return err
+}
+
+func TestWaitForPathBlock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ready")
+	go func() {
+		time.Sleep(1500 * time.Millisecond)
+		os.WriteFile(path, []byte{}, 0644)
+	}()
+	start := time.Now()
+	if err := runBlock(t, dir, WaitForPathBlock(10, path)); err != nil {
+		t.Fatalf("wait for %s failed: %s", path, err)
+	}
+	if time.Since(start) < time.Second {
+		t.Errorf("wait for %s returned before the path existed", path)
+	}
+}
+
+func TestWaitForPathBlockTimeout(t *testing.T) {
+	dir := t.TempDir()
+	block := WaitForPathBlock(1, filepath.Join(dir, "never"))
+	if err := runBlock(t, dir, block); err == nil {
+		t.Errorf("wait for a missing path should time out")
+	}
+
+	// Without a timeout there is no exit
+	if strings.Contains(WaitForPathBlock(0, "never"), "exit") {
+		t.Errorf("wait without a timeout should not exit")
+	}
+	if WaitForPathBlock(10) != "" {
+		t.Errorf("wait without paths should be empty")
+	}
+}
+
+func TestCopyTreeAndDoneMarkerBlock(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, path := range []string{"bin/tool", ".hidden", "lib/libtool.so"} {
+		path = filepath.Join(src, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The destination is a variable, as addons use them
+	block := "dest=" + filepath.Join(dir, "dest") + "\n" +
+		CopyTreeBlock(src, "${dest}/view/") +
+		DoneMarkerBlock("${dest}")
+	if err := runBlock(t, dir, block); err != nil {
+		t.Fatalf("copy failed: %s", err)
+	}
+	for _, path := range []string{"view/bin/tool", "view/.hidden", "view/lib/libtool.so", DoneMarker} {
+		if _, err := os.Stat(filepath.Join(dir, "dest", path)); err != nil {
+			t.Errorf("expected %s to be copied: %s", path, err)
+		}
+	}
+}
+
+func TestDoneMarkerPath(t *testing.T) {
+	for _, dir := range []string{"/opt/share", "/opt/share/"} {
+		got := DoneMarkerPath(dir)
+		if got != "/opt/share/"+DoneMarker {
+			t.Errorf("DoneMarkerPath(%q) = %q", dir, got)
+		}
+	}
+}
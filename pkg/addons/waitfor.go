@@ -0,0 +1,331 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// The wait-for addon adds an init container that blocks the benchmark from
+// starting until external dependencies are ready: a TCP endpoint accepts
+// connections, an HTTP endpoint returns 200, or a Kubernetes object has a
+// condition. Checks are retried with exponential backoff up to a timeout.
+const (
+	waitForIdentifier = "wait-for"
+	waitForVolumeName = "wait-for"
+
+	// The condition for Kubernetes objects when one is not given
+	waitForDefaultCondition = "Ready"
+)
+
+// waitForObject is a Kubernetes object and the condition to wait for
+type waitForObject struct {
+	namespace string
+	kind      string
+	name      string
+	condition string
+}
+
+type WaitForAddon struct {
+	AddonBase
+
+	// Image for the init container (with bash, curl, and kubectl)
+	image string
+
+	// TCP endpoints (host:port), HTTP urls, and Kubernetes objects to wait for
+	tcp        []string
+	http       []string
+	kubernetes []string
+
+	// Seconds to wait for all dependencies (0 waits forever)
+	timeout int32
+
+	// Seconds between checks, multiplied by the backoff up to the max interval
+	interval    int32
+	maxInterval int32
+	backoff     int32
+
+	// Namespace for Kubernetes objects that do not include one
+	namespace string
+
+	// Entrypoint for the init container
+	entrypoint string
+
+	// Replicated job to wait in
+	target string
+}
+
+func (a WaitForAddon) Family() string {
+	return AddonFamilyWorkload
+}
+
+// parseWaitForObject parses [namespace/]kind/name[=condition]
+func parseWaitForObject(entry, namespace string) (*waitForObject, error) {
+	object := &waitForObject{namespace: namespace, condition: waitForDefaultCondition}
+	ref, condition, found := strings.Cut(entry, "=")
+	if found {
+		object.condition = condition
+	}
+	parts := strings.Split(ref, "/")
+	switch len(parts) {
+	case 2:
+		object.kind, object.name = parts[0], parts[1]
+	case 3:
+		object.namespace, object.kind, object.name = parts[0], parts[1], parts[2]
+	default:
+		return nil, fmt.Errorf("%s is not [namespace/]kind/name[=condition]", entry)
+	}
+	for _, value := range []string{object.namespace, object.kind, object.name, object.condition} {
+		if value == "" {
+			return nil, fmt.Errorf("%s is not [namespace/]kind/name[=condition]", entry)
+		}
+	}
+	return object, nil
+}
+
+// checkWaitForValue ensures a value can be single quoted in the entrypoint
+func checkWaitForValue(value string) error {
+	if strings.ContainsAny(value, "'\"\\ \t\n") {
+		return fmt.Errorf("%s cannot contain quotes or whitespace", value)
+	}
+	return nil
+}
+
+// Validate the dependencies and timing
+func (a *WaitForAddon) Validate() bool {
+	if len(a.tcp)+len(a.http)+len(a.kubernetes) == 0 {
+		logger.Error("🟥️ The wait-for addon requires at least one of 'tcp', 'http', or 'kubernetes' to wait for.")
+		return false
+	}
+	if a.timeout < 0 || a.interval < 1 || a.maxInterval < a.interval || a.backoff < 1 {
+		logger.Error("🟥️ The wait-for addon requires timeout >= 0, interval >= 1, maxInterval >= interval, and backoff >= 1.")
+		return false
+	}
+	for _, entries := range [][]string{a.tcp, a.http, a.kubernetes} {
+		for _, entry := range entries {
+			if err := checkWaitForValue(entry); err != nil {
+				logger.Errorf("🟥️ The wait-for addon dependency %s", err)
+				return false
+			}
+		}
+	}
+	for _, endpoint := range a.tcp {
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			logger.Errorf("🟥️ The wait-for addon tcp endpoint must be host:port, found %s.", endpoint)
+			return false
+		}
+	}
+	for _, address := range a.http {
+		u, err := url.Parse(address)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			logger.Errorf("🟥️ The wait-for addon http endpoint must be an http or https url, found %s.", address)
+			return false
+		}
+	}
+	for _, entry := range a.kubernetes {
+		if _, err := parseWaitForObject(entry, a.namespace); err != nil {
+			logger.Errorf("🟥️ The wait-for addon kubernetes object %s", err)
+			return false
+		}
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *WaitForAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = waitForIdentifier
+	a.image = "alpine/k8s:1.30.2"
+	a.timeout = 600
+	a.interval = 1
+	a.maxInterval = 30
+	a.backoff = 2
+	a.namespace = m.Namespace
+	a.entrypoint = "/metrics_operator/wait-for-entrypoint.sh"
+
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	timeout, ok := metric.Options["timeout"]
+	if ok {
+		a.timeout = timeout.IntVal
+	}
+	interval, ok := metric.Options["interval"]
+	if ok {
+		a.interval = interval.IntVal
+	}
+	maxInterval, ok := metric.Options["maxInterval"]
+	if ok {
+		a.maxInterval = maxInterval.IntVal
+	}
+	backoff, ok := metric.Options["backoff"]
+	if ok {
+		a.backoff = backoff.IntVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	a.tcp = utils.ListStrings(metric.ListOptions["tcp"])
+	a.http = utils.ListStrings(metric.ListOptions["http"])
+	a.kubernetes = utils.ListStrings(metric.ListOptions["kubernetes"])
+}
+
+// Exported options and list options
+func (a *WaitForAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"image":       intstr.FromString(a.image),
+		"timeout":     intstr.FromInt(int(a.timeout)),
+		"interval":    intstr.FromInt(int(a.interval)),
+		"maxInterval": intstr.FromInt(int(a.maxInterval)),
+		"backoff":     intstr.FromInt(int(a.backoff)),
+		"target":      intstr.FromString(a.target),
+	}
+}
+
+// Return formatted list options
+func (a *WaitForAddon) ListOptions() map[string][]intstr.IntOrString {
+	return map[string][]intstr.IntOrString{
+		"tcp":        utils.StringList(a.tcp),
+		"http":       utils.StringList(a.http),
+		"kubernetes": utils.StringList(a.kubernetes),
+	}
+}
+
+// AssembleVolumes provides the init container entrypoint
+func (a *WaitForAddon) AssembleVolumes() []specs.VolumeSpec {
+
+	// The init container entrypoint is generated in the metrics operator config map
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  waitForVolumeName,
+					Path: filepath.Base(a.entrypoint),
+				}},
+			},
+		},
+	}
+	return []specs.VolumeSpec{{
+		Volume:   configVolume,
+		ReadOnly: true,
+		Mount:    false,
+		Path:     filepath.Dir(a.entrypoint),
+	}}
+}
+
+// waitForContext is for the template of the wait-for functions
+type waitForContext struct {
+	Timeout     int32
+	Interval    int32
+	Backoff     int32
+	MaxInterval int32
+}
+
+// waitForTemplate defines the checks for each kind of dependency, and a function
+// to wait (with backoff) for one to be ready
+var waitForTemplate = specs.NewTemplate(waitForIdentifier, `# Wait for external dependencies
+mo_deadline=$(( $(date +%s) + {{ .Timeout }} ))
+mo_tcp_ready() {
+    timeout 5 bash -c "</dev/tcp/$1/$2" 2>/dev/null
+}
+mo_http_ready() {
+    [ "$(curl -s -o /dev/null -w '%{http_code}' --max-time 5 "$1")" = "200" ]
+}
+mo_kubernetes_ready() {
+    [ "$(kubectl get -n "$1" "$2" -o jsonpath="{.status.conditions[?(@.type==\"$3\")].status}" 2>/dev/null)" = "True" ]
+}
+mo_wait_for() {
+    mo_description=$1
+    shift
+    mo_interval={{ .Interval }}
+    until "$@"; do
+        if [ {{ .Timeout }} -gt 0 ] && [ $(date +%s) -ge ${mo_deadline} ]; then
+            echo "Timed out after {{ .Timeout }}s waiting for ${mo_description}"
+            exit 1
+        fi
+        echo "Waiting ${mo_interval}s for ${mo_description}"
+        sleep ${mo_interval}
+        mo_interval=$(( mo_interval * {{ .Backoff }} ))
+        if [ ${mo_interval} -gt {{ .MaxInterval }} ]; then
+            mo_interval={{ .MaxInterval }}
+        fi
+    done
+    echo "${mo_description} is ready"
+}
+`, waitForContext{})
+
+// waitForBlock returns shell logic that checks each dependency until it is
+// ready, sleeping between checks (with backoff). It exits with an error if
+// the dependencies are not all ready by the timeout.
+func (a *WaitForAddon) waitForBlock() string {
+	block := waitForTemplate.Render(waitForContext{
+		Timeout:     a.timeout,
+		Interval:    a.interval,
+		Backoff:     a.backoff,
+		MaxInterval: a.maxInterval,
+	})
+	for _, endpoint := range a.tcp {
+		host, port, _ := net.SplitHostPort(endpoint)
+		block += fmt.Sprintf("mo_wait_for 'tcp %s' mo_tcp_ready '%s' '%s'\n", endpoint, host, port)
+	}
+	for _, address := range a.http {
+		block += fmt.Sprintf("mo_wait_for 'http %s' mo_http_ready '%s'\n", address, address)
+	}
+	for _, entry := range a.kubernetes {
+		object, err := parseWaitForObject(entry, a.namespace)
+		if err != nil {
+			continue
+		}
+		block += fmt.Sprintf(
+			"mo_wait_for '%s/%s/%s condition %s' mo_kubernetes_ready '%s' '%s/%s' '%s'\n",
+			object.namespace, object.kind, object.name, object.condition,
+			object.namespace, object.kind, object.name, object.condition,
+		)
+	}
+	return block
+}
+
+// AssembleContainers adds the init container that waits for the dependencies
+func (a *WaitForAddon) AssembleContainers() []specs.ContainerSpec {
+	script := fmt.Sprintf("#!/bin/bash\necho \"%s\"\n%s", Metadata(a), a.waitForBlock())
+	entrypoint := specs.EntrypointScript{
+		Name:   waitForVolumeName,
+		Path:   a.entrypoint,
+		Script: filepath.Base(a.entrypoint),
+		Pre:    script,
+	}
+	return []specs.ContainerSpec{{
+		JobName:          a.target,
+		Image:            a.image,
+		Name:             "wait-for",
+		EntrypointScript: entrypoint,
+		InitContainer:    true,
+		Resources:        &api.ContainerResources{},
+		Attributes:       &api.ContainerSpec{},
+	}}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: waitForIdentifier,
+		Summary:    "wait for external dependencies (tcp, http, or kubernetes objects) to be ready before the run",
+	}
+	waitFor := WaitForAddon{AddonBase: base}
+	Register(&waitFor)
+}
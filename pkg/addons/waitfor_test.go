@@ -0,0 +1,150 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// getWaitForAddon returns a wait-for addon for a synthetic MetricSet
+func getWaitForAddon(lists map[string][]string, options map[string]intstr.IntOrString) (*WaitForAddon, error) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "bench", Namespace: "default"}}
+	addon := &api.MetricAddon{
+		Name:        waitForIdentifier,
+		Options:     options,
+		ListOptions: map[string][]intstr.IntOrString{},
+	}
+	for name, values := range lists {
+		for _, value := range values {
+			addon.ListOptions[name] = append(addon.ListOptions[name], intstr.FromString(value))
+		}
+	}
+	a, err := GetAddon(addon, set)
+	if err != nil {
+		return nil, err
+	}
+	return a.(*WaitForAddon), nil
+}
+
+func TestWaitForValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		lists   map[string][]string
+		options map[string]intstr.IntOrString
+		valid   bool
+	}{
+		{name: "nothing to wait for"},
+		{name: "tcp", lists: map[string][]string{"tcp": {"db:5432"}}, valid: true},
+		{name: "tcp without port", lists: map[string][]string{"tcp": {"db"}}},
+		{name: "http", lists: map[string][]string{"http": {"http://vllm:8000/health"}}, valid: true},
+		{name: "http without scheme", lists: map[string][]string{"http": {"vllm:8000/health"}}},
+		{name: "kubernetes", lists: map[string][]string{"kubernetes": {"deployment/vllm=Available", "db/pod/postgres-0"}}, valid: true},
+		{name: "kubernetes without name", lists: map[string][]string{"kubernetes": {"deployment"}}},
+		{name: "quoted value", lists: map[string][]string{"http": {"http://vllm:8000/'$(id)'"}}},
+		{
+			name:    "backoff",
+			lists:   map[string][]string{"tcp": {"db:5432"}},
+			options: map[string]intstr.IntOrString{"backoff": intstr.FromInt(0)},
+		},
+		{
+			name:    "max interval",
+			lists:   map[string][]string{"tcp": {"db:5432"}},
+			options: map[string]intstr.IntOrString{"interval": intstr.FromInt(10), "maxInterval": intstr.FromInt(5)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := getWaitForAddon(test.lists, test.options)
+			if test.valid && err != nil {
+				t.Errorf("expected the addon to validate: %s", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected the addon to not validate")
+			}
+		})
+	}
+}
+
+func TestParseWaitForObject(t *testing.T) {
+	object, err := parseWaitForObject("deployment/vllm", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.namespace != "default" || object.kind != "deployment" || object.name != "vllm" || object.condition != "Ready" {
+		t.Errorf("unexpected object %+v", object)
+	}
+	object, err = parseWaitForObject("db/statefulset/postgres=Available", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.namespace != "db" || object.condition != "Available" {
+		t.Errorf("unexpected object %+v", object)
+	}
+}
+
+func TestWaitForBlock(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl is required to check http endpoints")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The server is not ready for the first check
+	var checks int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&checks, 1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	options := map[string]intstr.IntOrString{"timeout": intstr.FromInt(10), "maxInterval": intstr.FromInt(1)}
+	lists := map[string][]string{"tcp": {listener.Addr().String()}, "http": {server.URL}}
+	a, err := getWaitForAddon(lists, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runBlock(t, t.TempDir(), a.waitForBlock()); err != nil {
+		t.Fatalf("wait for dependencies failed: %s", err)
+	}
+	if atomic.LoadInt32(&checks) < 2 {
+		t.Errorf("expected the http endpoint to be checked until ready, found %d checks", checks)
+	}
+
+	// A closed endpoint times out
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := closed.Addr().String()
+	closed.Close()
+	options["timeout"] = intstr.FromInt(2)
+	a, err = getWaitForAddon(map[string][]string{"tcp": {address}}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runBlock(t, t.TempDir(), a.waitForBlock()); err == nil {
+		t.Errorf("wait for a closed endpoint should time out")
+	}
+	if !strings.Contains(a.waitForBlock(), "mo_tcp_ready '127.0.0.1'") {
+		t.Errorf("expected the tcp host to be checked")
+	}
+}
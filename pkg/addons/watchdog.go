@@ -0,0 +1,413 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"path/filepath"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The watchdog addon watches the application processes, and if they stop making
+// progress (writing output, or using cpu) for a period, dumps their stacks with
+// gdb (or py-spy for Python applications) to the results directory and ends the
+// run as Hung
+const (
+	watchdogIdentifier = "debug-watchdog"
+	watchdogVolumeName = "watchdog"
+)
+
+var (
+	watchdogTools    = map[string]bool{"gdb": true, "py-spy": true}
+	watchdogProgress = map[string]bool{"output": true, "cpu": true}
+)
+
+type WatchdogAddon struct {
+	AddonBase
+
+	// Pattern to match in the command line of application processes
+	command string
+
+	// Seconds without progress before dumping stacks, and between checks
+	timeout  int32
+	interval int32
+
+	// Tool to dump stacks (gdb or py-spy)
+	tool string
+
+	// Progress is measured as bytes written (output) or cpu time (cpu)
+	progress string
+
+	// Kill the application processes after dumping stacks
+	kill bool
+
+	// An image that provides the tool, copied by an init container
+	image  string
+	source string
+	mount  string
+
+	// Entrypoint for the init container, if we use an image
+	entrypointPath string
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (a WatchdogAddon) Family() string {
+	return AddonFamilyDebug
+}
+
+// Validate we have a command to watch, and a known tool
+func (a *WatchdogAddon) Validate() bool {
+	if a.command == "" {
+		logger.Error("🟥️ The debug-watchdog addon requires a 'command' pattern to find application processes.")
+		return false
+	}
+	if _, ok := watchdogTools[a.tool]; !ok {
+		logger.Errorf("🟥️ The debug-watchdog addon tool must be gdb or py-spy, found %s.", a.tool)
+		return false
+	}
+	if _, ok := watchdogProgress[a.progress]; !ok {
+		logger.Errorf("🟥️ The debug-watchdog addon progress must be output or cpu, found %s.", a.progress)
+		return false
+	}
+	if a.interval <= 0 || a.timeout < a.interval {
+		logger.Error("🟥️ The debug-watchdog addon interval must be greater than 0, and the timeout at least the interval.")
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *WatchdogAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = watchdogIdentifier
+	a.timeout = 600
+	a.interval = 30
+	a.tool = "gdb"
+	a.progress = "output"
+	a.kill = true
+	a.source = "/opt/watchdog"
+	a.mount = "/opt/watchdog"
+	a.entrypointPath = "/metrics_operator/watchdog-entrypoint.sh"
+
+	command, ok := metric.Options["command"]
+	if ok {
+		a.command = command.StrVal
+	}
+	timeout, ok := metric.Options["timeout"]
+	if ok {
+		a.timeout = timeout.IntVal
+	}
+	interval, ok := metric.Options["interval"]
+	if ok {
+		a.interval = interval.IntVal
+	}
+	tool, ok := metric.Options["tool"]
+	if ok {
+		a.tool = tool.StrVal
+	}
+	progress, ok := metric.Options["progress"]
+	if ok {
+		a.progress = progress.StrVal
+	}
+	kill, ok := metric.Options["kill"]
+	if ok {
+		if kill.StrVal == "no" || kill.StrVal == "false" {
+			a.kill = false
+		}
+	}
+	image, ok := metric.Options["image"]
+	if ok {
+		a.image = image.StrVal
+	}
+	source, ok := metric.Options["source"]
+	if ok {
+		a.source = source.StrVal
+	}
+	mount, ok := metric.Options["mount"]
+	if ok {
+		a.mount = mount.StrVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *WatchdogAddon) Options() map[string]intstr.IntOrString {
+	kill := "true"
+	if !a.kill {
+		kill = "false"
+	}
+	return map[string]intstr.IntOrString{
+		"command":         intstr.FromString(a.command),
+		"timeout":         intstr.FromInt(int(a.timeout)),
+		"interval":        intstr.FromInt(int(a.interval)),
+		"tool":            intstr.FromString(a.tool),
+		"progress":        intstr.FromString(a.progress),
+		"kill":            intstr.FromString(kill),
+		"image":           intstr.FromString(a.image),
+		"source":          intstr.FromString(a.source),
+		"mount":           intstr.FromString(a.mount),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+// AssembleVolumes provides a shared volume for the tool, if it comes from an image
+func (a *WatchdogAddon) AssembleVolumes() []specs.VolumeSpec {
+	if a.image == "" {
+		return []specs.VolumeSpec{}
+	}
+	volume := corev1.Volume{
+		Name: watchdogVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+
+	// The init container entrypoint is generated in the metrics operator config map
+	configVolume := corev1.Volume{
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				Items: []corev1.KeyToPath{{
+					Key:  watchdogVolumeName,
+					Path: filepath.Base(a.entrypointPath),
+				}},
+			},
+		},
+	}
+	return []specs.VolumeSpec{
+		{
+			Volume: volume,
+			Mount:  true,
+			Path:   a.mount,
+		},
+		{
+			Volume:   configVolume,
+			ReadOnly: true,
+			Mount:    false,
+			Path:     filepath.Dir(a.entrypointPath),
+		},
+	}
+}
+
+// watchdogContext is for the templates of the watchdog blocks
+type watchdogContext struct {
+	Metadata string
+
+	// The tools are copied from the source to the mount (added to the path)
+	Source string
+	Mount  string
+
+	// Pattern for application processes, and the seconds between checks and before a dump
+	Command  string
+	Interval int32
+	Timeout  int32
+
+	// Measure progress with cpu time instead of bytes written
+	CPU bool
+
+	// Commands to dump stacks and kill a process, and the termination message
+	Dump string
+	Kill string
+	Hung string
+
+	// The application command run with the watchdog
+	AppCommand string
+}
+
+var (
+	// watchdogInitTemplate copies the tools to the shared volume
+	watchdogInitTemplate = specs.NewTemplate(watchdogIdentifier+"-init", `#!/bin/sh
+echo "Copying watchdog tools from {{ .Source }} to shared volume at {{ .Mount }}"
+mkdir -p {{ .Mount }}
+mo_retry cp -R {{ .Source }}/* {{ .Mount }}/
+echo "Done copying watchdog tools"
+`, watchdogContext{})
+
+	// watchdogTemplate dumps stacks of processes matching the command when they
+	// stop making progress. Progress is the bytes written by the matching processes
+	// (from /proc/<pid>/io), or their cpu time (utime and stime from /proc/<pid>/stat,
+	// after the command name, which can have spaces). We don't exit non-zero after
+	// killing a hung command, or the job would be restarted, so the state is in the
+	// termination message.
+	watchdogTemplate = specs.NewTemplate(watchdogIdentifier, `
+echo "{{ .Metadata }}"
+{{ if .Mount }}export PATH=$PATH:{{ .Mount }}
+{{ end }}
+# Watchdog: dump stacks of processes matching the command when they stop making progress
+mo_watchdog_dir=${METRICS_OPERATOR_RESULTS:-/tmp}/watchdog/$(hostname)
+mo_watchdog_pids() {
+    for pid in $(ls /proc | grep -E '^[0-9]+$'); do
+        [ "${pid}" = "$$" ] && continue
+        case "$(cat /proc/${pid}/cmdline 2>/dev/null | tr '\0' ' ')" in
+            *"{{ .Command }}"*) echo ${pid};;
+        esac
+    done
+}
+mo_watchdog() {
+    mo_wd_last=""
+    mo_wd_idle=0
+    while true; do
+        sleep {{ .Interval }}
+        mo_wd_pids=$(mo_watchdog_pids)
+        [ -z "${mo_wd_pids}" ] && continue
+        mo_wd_progress=0
+        for pid in ${mo_wd_pids}; do
+            {{ if .CPU }}mo_wd_used=$(sed 's/.*) //' /proc/${pid}/stat 2>/dev/null | awk '{ print $12 + $13 }')
+            {{ else }}mo_wd_used=$(sed -n 's/^wchar: //p' /proc/${pid}/io 2>/dev/null)
+            {{ end }}mo_wd_progress=$(( mo_wd_progress + ${mo_wd_used:-0} ))
+        done
+        if [ "${mo_wd_progress}" != "${mo_wd_last}" ]; then
+            mo_wd_last=${mo_wd_progress}
+            mo_wd_idle=0
+            continue
+        fi
+        mo_wd_idle=$(( mo_wd_idle + {{ .Interval }} ))
+        [ ${mo_wd_idle} -lt {{ .Timeout }} ] && continue
+        echo "WATCHDOG no progress for ${mo_wd_idle} seconds, dumping stacks to ${mo_watchdog_dir}"
+        mkdir -p ${mo_watchdog_dir}
+        for pid in ${mo_wd_pids}; do
+            {{ .Dump }} > ${mo_watchdog_dir}/${pid}.txt 2>&1
+        done
+        { echo "{{ .Hung }}" > /dev/termination-log; } 2>/dev/null
+        echo "WATCHDOG marked the run {{ .Hung }}"
+        touch ${mo_watchdog_dir}/hung
+        {{ .Kill }}
+        return 0
+    done
+}
+`, watchdogContext{})
+
+	// watchdogCommandTemplate runs the command with the watchdog in the background
+	watchdogCommandTemplate = specs.NewTemplate(watchdogIdentifier+"-command", `mo_watchdog &
+mo_watchdog_pid=$!
+{{ .AppCommand }}
+mo_watchdog_status=$?
+kill ${mo_watchdog_pid} 2>/dev/null
+[ -f ${mo_watchdog_dir}/hung ] && mo_watchdog_status=0
+(exit ${mo_watchdog_status})`, watchdogContext{})
+)
+
+// AssembleContainers adds an init container to copy the tool, if needed
+func (a *WatchdogAddon) AssembleContainers() []specs.ContainerSpec {
+	if a.image == "" {
+		return []specs.ContainerSpec{}
+	}
+
+	script := watchdogInitTemplate.Render(watchdogContext{Source: a.source, Mount: a.mount})
+	entrypoint := specs.EntrypointScript{
+		Name:   watchdogVolumeName,
+		Path:   a.entrypointPath,
+		Script: filepath.Base(a.entrypointPath),
+		Pre:    script,
+	}
+	return []specs.ContainerSpec{{
+		JobName:          a.target,
+		Image:            a.image,
+		Name:             "watchdog",
+		EntrypointScript: entrypoint,
+		InitContainer:    true,
+		Shell:            "sh",
+		Resources:        &api.ContainerResources{},
+		Attributes:       &api.ContainerSpec{},
+		NeedsWrite:       true,
+	}}
+}
+
+// CustomizeEntrypoint scripts
+func (a *WatchdogAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// dumpCommand returns the command to dump stacks of ${pid}
+func (a *WatchdogAddon) dumpCommand() string {
+	if a.tool == "py-spy" {
+		return "py-spy dump --pid ${pid}"
+	}
+	return "gdb -p ${pid} -batch -ex \"thread apply all bt\""
+}
+
+// killCommand ends the application processes after stacks are dumped, giving
+// them up to 10 seconds after SIGTERM
+func (a *WatchdogAddon) killCommand() string {
+	if !a.kill {
+		return "echo \"WATCHDOG leaving processes running (kill is false)\""
+	}
+	return `kill -TERM ${mo_wd_pids} 2>/dev/null
+        for i in $(seq 10); do kill -0 ${mo_wd_pids} 2>/dev/null || break; sleep 1; done
+        kill -KILL ${mo_wd_pids} 2>/dev/null`
+}
+
+// CustomizeEntrypoint for a single replicated job
+func (a *WatchdogAddon) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+
+	context := watchdogContext{
+		Metadata: Metadata(a),
+		Command:  a.command,
+		Interval: a.interval,
+		Timeout:  a.timeout,
+		CPU:      a.progress == "cpu",
+		Dump:     a.dumpCommand(),
+		Hung:     specs.Hung,
+		Kill:     a.killCommand(),
+	}
+	if a.image != "" {
+		context.Mount = a.mount
+	}
+	watchdog := watchdogTemplate.Render(context)
+
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		containerSpec.EntrypointScript.Pre += watchdog
+		context.AppCommand = containerSpec.EntrypointScript.Command
+		containerSpec.EntrypointScript.Command = watchdogCommandTemplate.Render(context)
+		containerSpec.ReportsState = true
+
+		// The watchdog is not an ancestor of the application, so attaching needs ptrace
+		containerSpec.Capabilities = append(containerSpec.Capabilities, "SYS_PTRACE")
+	}
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: watchdogIdentifier,
+		Summary:    "dump stacks with gdb or py-spy when the application stops making progress",
+	}
+	watchdog := WatchdogAddon{AddonBase: base}
+	Register(&watchdog)
+}
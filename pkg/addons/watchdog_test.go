@@ -0,0 +1,105 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestWatchdog(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	set := &api.MetricSet{}
+	_, err = GetAddon(&api.MetricAddon{Name: watchdogIdentifier, Options: map[string]intstr.IntOrString{
+		"command":  intstr.FromString("lmp"),
+		"progress": intstr.FromString("flops"),
+	}}, set)
+	if err == nil {
+		t.Errorf("expected an unknown progress to not validate")
+	}
+
+	// Each progress measure renders its own source
+	for progress, source := range map[string]string{"output": "/proc/${pid}/io", "cpu": "/proc/${pid}/stat"} {
+		a, err := GetAddon(&api.MetricAddon{Name: watchdogIdentifier, Options: map[string]intstr.IntOrString{
+			"command":  intstr.FromString("lmp"),
+			"progress": intstr.FromString(progress),
+		}}, set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := &specs.ContainerSpec{JobName: "l", EntrypointScript: specs.EntrypointScript{Command: "lmp -in in.lj"}}
+		a.CustomizeEntrypoints([]*specs.ContainerSpec{cs}, []*jobset.ReplicatedJob{{Name: "l"}})
+		if !strings.Contains(cs.EntrypointScript.Pre, source) {
+			t.Errorf("expected %s progress to be read from %s:\n%s", progress, source, cs.EntrypointScript.Pre)
+		}
+		if len(cs.Capabilities) != 1 || cs.Capabilities[0] != "SYS_PTRACE" || !cs.ReportsState {
+			t.Errorf("expected the container to attach with ptrace and report state, found %v", cs.Capabilities)
+		}
+	}
+
+	// A process that makes no progress has stacks dumped, and is ended as hung
+	a, err := GetAddon(&api.MetricAddon{Name: watchdogIdentifier, Options: map[string]intstr.IntOrString{
+		"command":  intstr.FromString("mo-watchdog-idle"),
+		"interval": intstr.FromInt(1),
+		"timeout":  intstr.FromInt(2),
+	}}, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := &specs.ContainerSpec{JobName: "l", EntrypointScript: specs.EntrypointScript{
+		Command: "bash -c 'exec -a mo-watchdog-idle sleep 60'",
+	}}
+	a.CustomizeEntrypoints([]*specs.ContainerSpec{cs}, []*jobset.ReplicatedJob{{Name: "l"}})
+
+	// The entrypoint is a file, so the shell command line does not match the pattern
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	err = os.MkdirAll(bin, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(bin, "gdb"), []byte("#!/bin/sh\necho \"#0 stack of $2\"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entrypoint := filepath.Join(dir, "entrypoint.sh")
+	script := specs.Prelude + cs.EntrypointScript.Pre + "\n" + cs.EntrypointScript.Command + "\necho \"status $?\"\n"
+	err = os.WriteFile(entrypoint, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(bash, entrypoint)
+	cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"), "METRICS_OPERATOR_RESULTS="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("watchdog failed: %s\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "status 0") || !strings.Contains(string(out), "marked the run "+specs.Hung) {
+		t.Errorf("expected a hung command to be ended without failing the job:\n%s", out)
+	}
+	hostname, _ := os.Hostname()
+	stacks, _ := filepath.Glob(filepath.Join(dir, "watchdog", hostname, "*.txt"))
+	if len(stacks) != 1 {
+		t.Fatalf("expected the stack of one process, found %v\n%s", stacks, out)
+	}
+	stack, _ := os.ReadFile(stacks[0])
+	if !strings.Contains(string(stack), "#0 stack of") {
+		t.Errorf("expected a stack dump, found %s", stack)
+	}
+}
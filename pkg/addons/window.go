@@ -0,0 +1,219 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The window addon limits collection of a metric to a window of the application
+// run, opening start seconds after the application starts and closing at stop
+// seconds (stopping the samplers), so initialization and shutdown are excluded
+const (
+	windowIdentifier = "window"
+)
+
+type WindowAddon struct {
+	AddonBase
+
+	// Seconds after the application starts to open and close the window
+	start int32
+	stop  int32
+
+	// Pattern to match in the command line of the application process, whose
+	// start opens the window (otherwise the container start)
+	command string
+
+	// job name and container name targets
+	target          string
+	containerTarget string
+}
+
+func (a WindowAddon) Family() string {
+	return AddonFamilyPerformance
+}
+
+// Validate the window closes after it opens
+func (a *WindowAddon) Validate() bool {
+	if a.start < 0 || a.stop <= a.start {
+		logger.Errorf("🟥️ The window addon stop (%d) must be greater than the start (%d), which cannot be negative.", a.stop, a.start)
+		return false
+	}
+	return true
+}
+
+// Set custom options / attributes for the addon
+func (a *WindowAddon) SetOptions(metric *api.MetricAddon, m *api.MetricSet) {
+	a.Identifier = windowIdentifier
+
+	start, ok := metric.Options["start"]
+	if ok {
+		a.start = start.IntVal
+	}
+	stop, ok := metric.Options["stop"]
+	if ok {
+		a.stop = stop.IntVal
+	}
+	command, ok := metric.Options["command"]
+	if ok {
+		a.command = command.StrVal
+	}
+	target, ok := metric.Options["target"]
+	if ok {
+		a.target = target.StrVal
+	}
+	ctarget, ok := metric.Options["containerTarget"]
+	if ok {
+		a.containerTarget = ctarget.StrVal
+	}
+}
+
+// Exported options and list options
+func (a *WindowAddon) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"start":           intstr.FromInt(int(a.start)),
+		"stop":            intstr.FromInt(int(a.stop)),
+		"command":         intstr.FromString(a.command),
+		"target":          intstr.FromString(a.target),
+		"containerTarget": intstr.FromString(a.containerTarget),
+	}
+}
+
+// windowContext is for the template of the window block
+type windowContext struct {
+	Metadata string
+	Command  string
+	Start    int32
+	Stop     int32
+}
+
+var (
+	// windowTemplate runs before the rest of the metric entrypoint (so a sampler
+	// starts when the window opens). A timer closes the window: it interrupts the
+	// shell with SIGUSR2 and ends its children, since a trap is not run until a
+	// command in the foreground (e.g., a sample) is done. The trap then stops any
+	// background work and ends collection as a successful run.
+	windowTemplate = specs.NewTemplate(windowIdentifier, `
+echo "{{ .Metadata }}"
+# Measurement window: collect from {{ .Start }} to {{ .Stop }} seconds after the application starts
+{{ if .Command }}echo "Waiting for the application ({{ .Command }}) to start the measurement window"
+mo_wait_for_pid {{ quote .Command }} > /dev/null
+mo_window_start=$(date +%s)
+{{ else }}mo_window_start=${mo_start}
+{{ end }}mo_window_close() {
+    trap - USR2
+    for child in $(jobs -p); do kill -TERM ${child} 2>/dev/null; done
+    wait
+    mo_phase window-close
+    mo_finish_results
+    sync
+    echo "{{ collectionEnd }}"
+    exit 0
+}
+trap mo_window_close USR2
+mo_window_timer() {
+    local self rest ppid left sleeper
+    read -r self rest < /proc/self/stat
+    left=$(( mo_window_start + {{ .Stop }} - $(date +%s) ))
+    if [ ${left} -gt 0 ]; then
+        sleep ${left} &
+        sleeper=$!
+        trap 'kill ${sleeper} 2>/dev/null; exit 0' TERM
+        wait ${sleeper}
+    fi
+    echo "Measurement window closed {{ .Stop }} seconds after the application started, stopping collection"
+    kill -USR2 $$
+    for pid in $(ls /proc | grep -E '^[0-9]+$'); do
+        [ "${pid}" = "${self}" ] && continue
+        ppid=$(sed 's/.*) [A-Za-z] \([0-9]*\) .*/\1/' /proc/${pid}/stat 2>/dev/null)
+        [ "${ppid}" = "$$" ] && kill -TERM ${pid} 2>/dev/null
+    done
+}
+mo_window_timer &
+mo_window_timer=$!
+mo_window_wait=$(( mo_window_start + {{ .Start }} - $(date +%s) ))
+if [ ${mo_window_wait} -gt 0 ]; then
+    echo "Waiting ${mo_window_wait} seconds for the measurement window to open"
+    sleep ${mo_window_wait}
+fi
+mo_phase window-open
+echo "Measurement window open until {{ .Stop }} seconds after the application started"
+`, windowContext{})
+)
+
+// CustomizeEntrypoint scripts
+func (a *WindowAddon) CustomizeEntrypoints(
+	cs []*specs.ContainerSpec,
+	rjs []*jobset.ReplicatedJob,
+) {
+	for _, rj := range rjs {
+
+		// Only customize if the replicated job name matches the target
+		if a.target != "" && a.target != rj.Name {
+			continue
+		}
+		a.customizeEntrypoint(cs, rj)
+	}
+}
+
+// CustomizeEntrypoint for a single replicated job
+func (a *WindowAddon) customizeEntrypoint(
+	cs []*specs.ContainerSpec,
+	rj *jobset.ReplicatedJob,
+) {
+	window := windowTemplate.Render(windowContext{
+		Metadata: Metadata(a),
+		Command:  a.command,
+		Start:    a.start,
+		Stop:     a.stop,
+	})
+
+	for _, containerSpec := range cs {
+		if containerSpec.JobName != rj.Name || containerSpec.InitContainer {
+			continue
+		}
+		if a.containerTarget != "" && containerSpec.Name != "" && a.containerTarget != containerSpec.Name {
+			continue
+		}
+		entrypoint := &containerSpec.EntrypointScript
+		if entrypoint.Verbatim || entrypoint.PowerShell {
+			continue
+		}
+
+		// The window goes after the shebang (and so the prelude), and the timer is
+		// stopped if the metric finishes before the window closes
+		entrypoint.Pre = afterShebang(entrypoint.Pre, window)
+		entrypoint.Post = "kill ${mo_window_timer} 2>/dev/null\n" + entrypoint.Post
+	}
+}
+
+// afterShebang inserts a block after the shebang of a script, if it has one
+func afterShebang(script, block string) string {
+	if !strings.HasPrefix(script, "#!") {
+		return block + script
+	}
+	parts := strings.SplitN(script, "\n", 2)
+	if len(parts) == 1 {
+		return parts[0] + "\n" + block
+	}
+	return parts[0] + "\n" + block + parts[1]
+}
+
+func init() {
+	base := AddonBase{
+		Identifier: windowIdentifier,
+		Summary:    "collect only from some seconds after the application starts until some seconds later",
+	}
+	window := WindowAddon{AddonBase: base}
+	Register(&window)
+}
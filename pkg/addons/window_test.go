@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package addons
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestWindow(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+
+	// The window must close after it opens
+	for _, options := range []map[string]intstr.IntOrString{
+		{"start": intstr.FromInt(5)},
+		{"start": intstr.FromInt(5), "stop": intstr.FromInt(5)},
+		{"start": intstr.FromInt(-1), "stop": intstr.FromInt(5)},
+	} {
+		_, err := GetAddon(&api.MetricAddon{Name: windowIdentifier, Options: options}, &api.MetricSet{})
+		if err == nil {
+			t.Errorf("expected options %v to not validate", options)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		closed  bool
+	}{
+		// A sampler that would run forever is stopped when the window closes
+		{name: "sampler", command: "while true; do echo sample; sleep 1; done", closed: true},
+		// A metric that finishes first runs its post, and the timer is stopped
+		{name: "finished", command: "echo sample"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := GetAddon(&api.MetricAddon{
+				Name: windowIdentifier,
+				Options: map[string]intstr.IntOrString{
+					"start":           intstr.FromInt(1),
+					"stop":            intstr.FromInt(3),
+					"containerTarget": intstr.FromString("sampler"),
+				},
+			}, &api.MetricSet{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cs := []*specs.ContainerSpec{
+				{
+					JobName:          "m",
+					Name:             "sampler",
+					EntrypointScript: specs.EntrypointScript{Pre: "#!/bin/bash\necho pre\n", Command: test.command, Post: "echo post"},
+				},
+				{JobName: "m", Name: "app", EntrypointScript: specs.EntrypointScript{Command: "app"}},
+			}
+			a.CustomizeEntrypoints(cs, []*jobset.ReplicatedJob{{Name: "m"}})
+			if strings.Contains(cs[1].EntrypointScript.Pre, "mo_window") {
+				t.Errorf("expected only the target container to be customized")
+			}
+			entrypoint := cs[0].EntrypointScript
+			if !strings.HasPrefix(entrypoint.Pre, "#!/bin/bash\n") {
+				t.Fatalf("expected the window after the shebang:\n%s", entrypoint.Pre)
+			}
+
+			phases := filepath.Join(t.TempDir(), "phases")
+			script := specs.Prelude + strings.TrimPrefix(entrypoint.Pre, "#!/bin/bash\n") + entrypoint.Command + "\n" + entrypoint.Post
+			cmd := exec.Command(bash, "-c", script)
+			cmd.Env = append(os.Environ(), "METRICS_OPERATOR_PHASES="+phases)
+			start := time.Now()
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("window failed: %s\n%s", err, out)
+			}
+			output := string(out)
+			if !strings.Contains(output, "pre\n") || !strings.Contains(output, "sample\n") {
+				t.Errorf("expected the metric to run in the window:\n%s", output)
+			}
+			recorded, _ := os.ReadFile(phases)
+			if !strings.Contains(string(recorded), "window-open") {
+				t.Errorf("expected the window to be recorded as a phase, found %q", recorded)
+			}
+			if !test.closed {
+				if !strings.HasSuffix(output, "post\n") || strings.Contains(output, "window closed") {
+					t.Errorf("expected the metric to finish on its own:\n%s", output)
+				}
+				return
+			}
+			if !strings.Contains(string(recorded), "window-close") || !strings.HasSuffix(output, metadata.CollectionEnd+"\n") || strings.Contains(output, "post\n") {
+				t.Errorf("expected the window to end collection:\n%s", output)
+			}
+			if elapsed := time.Since(start); elapsed < 3*time.Second || elapsed > 8*time.Second {
+				t.Errorf("expected the window to close after 3 seconds, took %s", elapsed)
+			}
+		})
+	}
+}
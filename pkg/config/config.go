@@ -0,0 +1,235 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// The operator configuration is a file (typically from a ConfigMap mounted
+// into the manager). It is read when the manager starts, and again when it
+// changes, so site operators can change defaults fleet-wide without users
+// knowing metric or addon internals, or restarting the manager.
+//
+// images:
+//   perf-hpctoolkit: registry.example.com/metric-hpctoolkit-view:ubuntu
+//   app-lammps: registry.example.com/metric-lammps:latest
+// mirrors:
+//   ghcr.io/converged-computing: registry.example.com/converged-computing
+// addons:
+//   - perf-sysstat
+//   - sys-hwloc
+// namespaces:
+//   - benchmarks
+// verbosity: 1
+
+// DefaultPath is where the manager looks for the configuration
+const DefaultPath = "/etc/metrics-operator/config.yaml"
+
+// Config for the operator
+type Config struct {
+
+	// Images maps a metric or addon identifier to an image that replaces
+	// its default. An image set on the MetricSet still takes precedence.
+	Images map[string]string `json:"images,omitempty"`
+
+	// Mirrors maps an image prefix (e.g., a registry) to the prefix of a
+	// mirror to pull it from instead. The longest matching prefix is used.
+	Mirrors map[string]string `json:"mirrors,omitempty"`
+
+	// Addons that MetricSets are allowed to use (all if empty)
+	Addons []string `json:"addons,omitempty"`
+
+	// Namespaces with MetricSets to reconcile (all if empty)
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Verbosity of the logs, where 0 is info and 1 or more adds debug
+	// detail. If unset, the --verbosity of the manager is kept.
+	Verbosity *int `json:"verbosity,omitempty"`
+}
+
+var (
+	current = Config{}
+	mutex   sync.RWMutex
+
+	// The content last loaded, for a watcher to compare the file to
+	loaded []byte
+)
+
+// Load reads the configuration from a path. A missing file is not an error,
+// and the configuration is left empty.
+func Load(path string) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		Set(Config{})
+		setLoaded(nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cfg, err := parse(content)
+	if err != nil {
+		return fmt.Errorf("operator configuration %s is not valid: %s", path, err)
+	}
+	Set(cfg)
+	setLoaded(content)
+	return nil
+}
+
+// parse and validate the content of a configuration file
+func parse(content []byte) (Config, error) {
+	cfg := Config{}
+	err := yaml.UnmarshalStrict(content, &cfg)
+	if err != nil {
+		return cfg, err
+	}
+	for identifier, image := range cfg.Images {
+		if image == "" {
+			return cfg, fmt.Errorf("empty image for %s", identifier)
+		}
+	}
+	for prefix, mirror := range cfg.Mirrors {
+		if prefix == "" || mirror == "" {
+			return cfg, fmt.Errorf("mirror %q of %q needs a prefix and a mirror", mirror, prefix)
+		}
+	}
+	if cfg.Verbosity != nil && *cfg.Verbosity < 0 {
+		return cfg, fmt.Errorf("verbosity must be 0 or more, found %d", *cfg.Verbosity)
+	}
+	return cfg, nil
+}
+
+// Watcher reloads the configuration when the file at Path changes, checking
+// every Interval. A ConfigMap that is updated is seen when the kubelet syncs
+// the mount. After each reload (or an invalid configuration, which keeps the
+// previous one) Reloaded is called. It is a manager runnable that runs on
+// every replica, not only the leader, so a new leader is current.
+type Watcher struct {
+	Path     string
+	Interval time.Duration
+	Reloaded func(Config, error)
+}
+
+// NeedLeaderElection is false, so the watcher runs on every replica
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start watching until the context is done
+func (w *Watcher) Start(ctx context.Context) error {
+	return Watch(ctx, w.Path, w.Interval, w.Reloaded)
+}
+
+// Watch reloads the configuration when the file at path changes (from what
+// was last loaded), checking every interval until the context is done
+func Watch(ctx context.Context, path string, interval time.Duration, reloaded func(Config, error)) error {
+	mutex.RLock()
+	last := loaded
+	mutex.RUnlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		content, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if bytes.Equal(content, last) {
+			continue
+		}
+		last = content
+		err = Load(path)
+		reloaded(Get(), err)
+	}
+}
+
+// Set the current configuration
+func Set(cfg Config) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	current = cfg
+}
+
+func setLoaded(content []byte) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	loaded = content
+}
+
+// Get the current configuration
+func Get() Config {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return current
+}
+
+// Image returns the image override for a metric or addon identifier, if any
+func Image(identifier string) (string, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	image, ok := current.Images[identifier]
+	return image, ok
+}
+
+// Mirror returns the image to pull, from the mirror of its longest matching
+// prefix, or the image itself if there is none
+func Mirror(image string) string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	prefixes := []string{}
+	for prefix := range current.Mirrors {
+		if image == prefix || strings.HasPrefix(image, strings.TrimSuffix(prefix, "/")+"/") {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return image
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	prefix := strings.TrimSuffix(prefixes[0], "/")
+	return strings.TrimSuffix(current.Mirrors[prefixes[0]], "/") + strings.TrimPrefix(image, prefix)
+}
+
+// AllowsAddon determines if MetricSets can use an addon
+func AllowsAddon(identifier string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return len(current.Addons) == 0 || contains(current.Addons, identifier)
+}
+
+// WatchesNamespace determines if MetricSets in a namespace are reconciled
+func WatchesNamespace(namespace string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return len(current.Namespaces) == 0 || contains(current.Namespaces, namespace)
+}
+
+func contains(items []string, item string) bool {
+	for _, value := range items {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
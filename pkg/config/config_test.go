@@ -0,0 +1,175 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	defer Set(Config{})
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		image   string
+		wantErr bool
+	}{
+		{
+			name:    "images",
+			content: "images:\n  perf-hpctoolkit: registry.example.com/hpctoolkit:ubuntu\n",
+			image:   "registry.example.com/hpctoolkit:ubuntu",
+		},
+		{
+			name:    "empty",
+			content: "",
+		},
+		{
+			name:    "unknown field",
+			content: "imagez:\n  perf-hpctoolkit: registry.example.com/hpctoolkit:ubuntu\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty image",
+			content: "images:\n  perf-hpctoolkit: \"\"\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Set(Config{})
+			path := filepath.Join(dir, test.name+".yaml")
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := Load(path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Load error %v, want error %v", err, test.wantErr)
+			}
+			image, ok := Image("perf-hpctoolkit")
+			if image != test.image || ok != (test.image != "") {
+				t.Errorf("Image(perf-hpctoolkit) = %q, %v, want %q", image, ok, test.image)
+			}
+		})
+	}
+
+	// A missing file is an empty configuration
+	Set(Config{Images: map[string]string{"app-lammps": "lammps"}})
+	if err := Load(filepath.Join(dir, "missing.yaml")); err != nil {
+		t.Fatalf("missing configuration should not be an error: %s", err)
+	}
+	if _, ok := Image("app-lammps"); ok {
+		t.Error("missing configuration should reset image overrides")
+	}
+}
+
+func TestRuntimeSettings(t *testing.T) {
+	defer Set(Config{})
+	content := `mirrors:
+  ghcr.io/converged-computing: registry.example.com/cc
+  ghcr.io: mirror.example.com/ghcr
+addons:
+  - perf-sysstat
+namespaces:
+  - benchmarks
+verbosity: 1
+`
+	cfg, err := parse([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Set(cfg)
+
+	mirrors := map[string]string{
+		"ghcr.io/converged-computing/metric-lammps:latest": "registry.example.com/cc/metric-lammps:latest",
+		"ghcr.io/rse-ops/vanilla-lammps:tag-latest":        "mirror.example.com/ghcr/rse-ops/vanilla-lammps:tag-latest",
+		"ghcr.iox/other:latest":                            "ghcr.iox/other:latest",
+		"ubuntu:22.04":                                     "ubuntu:22.04",
+	}
+	for image, expected := range mirrors {
+		if mirrored := Mirror(image); mirrored != expected {
+			t.Errorf("Mirror(%s) = %s, want %s", image, mirrored, expected)
+		}
+	}
+	if !AllowsAddon("perf-sysstat") || AllowsAddon("debug-coredump") {
+		t.Error("expected only the listed addons to be allowed")
+	}
+	if !WatchesNamespace("benchmarks") || WatchesNamespace("default") {
+		t.Error("expected only the listed namespaces to be watched")
+	}
+	if Get().Verbosity == nil || *Get().Verbosity != 1 {
+		t.Errorf("expected verbosity 1, found %v", Get().Verbosity)
+	}
+
+	// An empty configuration allows everything
+	Set(Config{})
+	if !AllowsAddon("debug-coredump") || !WatchesNamespace("default") {
+		t.Error("expected all addons and namespaces without a configuration")
+	}
+
+	for _, invalid := range []string{"verbosity: -1\n", "mirrors:\n  ghcr.io: \"\"\n"} {
+		if _, err := parse([]byte(invalid)); err == nil {
+			t.Errorf("expected %q to not be valid", invalid)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	defer Set(Config{})
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("addons:\n  - perf-sysstat\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloads := make(chan error, 10)
+	watcher := &Watcher{
+		Path:     path,
+		Interval: 10 * time.Millisecond,
+		Reloaded: func(cfg Config, err error) { reloads <- err },
+	}
+	if watcher.NeedLeaderElection() {
+		t.Error("expected the watcher to run on every replica")
+	}
+	go func() { _ = watcher.Start(ctx) }()
+
+	wait := func() error {
+		select {
+		case err := <-reloads:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("the configuration was not reloaded")
+		}
+		return nil
+	}
+
+	// A change is reloaded
+	if err := os.WriteFile(path, []byte("addons:\n  - sys-hwloc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(); err != nil || !AllowsAddon("sys-hwloc") || AllowsAddon("perf-sysstat") {
+		t.Fatalf("expected the changed addons to be allowed, found %v %v", err, Get())
+	}
+
+	// An invalid change keeps the previous configuration
+	if err := os.WriteFile(path, []byte("addonz: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(); err == nil || !AllowsAddon("sys-hwloc") || AllowsAddon("perf-sysstat") {
+		t.Fatalf("expected the previous configuration to be kept, found %v %v", err, Get())
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package logging
+
+import (
+	"log"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The level is shared by all package loggers so one flag controls verbosity
+var (
+	level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+
+	// Fields (namespace, name, and reconcileID) of the current reconcile
+	reconcile atomic.Value
+)
+
+// SetReconcile adds the MetricSet and reconcile ID to the messages of package
+// loggers, until the reconcile is done. The MetricSet controller reconciles one
+// MetricSet at a time, so package loggers (without a context) share the fields.
+func SetReconcile(namespace, name, reconcileID string) {
+	reconcile.Store([]zapcore.Field{
+		zap.String("namespace", namespace),
+		zap.String("name", name),
+		zap.String("reconcileID", reconcileID),
+	})
+}
+
+// ClearReconcile removes the fields of a reconcile that is done
+func ClearReconcile() {
+	reconcile.Store([]zapcore.Field{})
+}
+
+// reconcileFields returns the fields of the current reconcile, if any
+func reconcileFields() []zapcore.Field {
+	fields, _ := reconcile.Load().([]zapcore.Field)
+	return fields
+}
+
+// reconcileCore adds the fields of the current reconcile to each message
+type reconcileCore struct {
+	zapcore.Core
+}
+
+func (c reconcileCore) With(fields []zapcore.Field) zapcore.Core {
+	return reconcileCore{c.Core.With(fields)}
+}
+
+func (c reconcileCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c reconcileCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, append(append([]zapcore.Field{}, reconcileFields()...), fields...))
+}
+
+// SetVerbosity sets the level for package loggers, where 0 is info
+// and larger values (e.g., 1 for debug) show more detail
+func SetVerbosity(verbosity int) {
+	level.SetLevel(zapcore.Level(-verbosity))
+}
+
+// Level is the level shared by package loggers, for the manager to share too
+func Level() zap.AtomicLevel {
+	return level
+}
+
+// NewLogger returns a structured (json) logger for a package
+func NewLogger(name string) *zap.SugaredLogger {
+	config := zap.NewProductionConfig()
+	config.Level = level
+	handle, err := config.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return reconcileCore{core}
+	}))
+	if err != nil {
+		log.Fatalf("can't initialize zap logger: %v", err)
+	}
+	return handle.Named(name).Sugar()
+}
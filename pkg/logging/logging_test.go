@@ -0,0 +1,39 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package logging
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestReconcileFields(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(reconcileCore{core}).Sugar().Named("metrics")
+
+	SetReconcile("default", "metricset-sample", "1234")
+	logger.With("metric", "io-fio").Info("Adding containers")
+	ClearReconcile()
+	logger.Info("Outside of a reconcile")
+	logger.Debug("Not enabled")
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 messages, found %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["namespace"] != "default" || fields["name"] != "metricset-sample" || fields["reconcileID"] != "1234" || fields["metric"] != "io-fio" {
+		t.Errorf("expected the reconcile fields, found %v", fields)
+	}
+	if len(entries[1].Context) != 0 {
+		t.Errorf("expected no fields after the reconcile, found %v", entries[1].ContextMap())
+	}
+}
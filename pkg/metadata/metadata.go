@@ -14,11 +14,23 @@ import (
 
 // Consistent logging identifiers that should be echoed to have newline after
 var (
-	Separator       = "METRICS OPERATOR TIMEPOINT"
-	CollectionStart = "METRICS OPERATOR COLLECTION START"
-	CollectionEnd   = "METRICS OPERATOR COLLECTION END"
-	handle          *zap.Logger
-	logger          *zap.SugaredLogger
+	Separator         = "METRICS OPERATOR TIMEPOINT"
+	CollectionStart   = "METRICS OPERATOR COLLECTION START"
+	CollectionEnd     = "METRICS OPERATOR COLLECTION END"
+	ProvisioningStart = "METRICS OPERATOR PROVISIONING START"
+	ProvisioningEnd   = "METRICS OPERATOR PROVISIONING END"
+	FrameStart        = "METRICS OPERATOR FRAME START"
+	FrameEnd          = "METRICS OPERATOR FRAME END"
+	TopologyStart     = "METRICS OPERATOR TOPOLOGY START"
+	TopologyEnd       = "METRICS OPERATOR TOPOLOGY END"
+	Phase             = "METRICS OPERATOR PHASE"
+	Clock             = "METRICS OPERATOR CLOCK"
+	MatrixPair        = "METRICS OPERATOR MATRIX PAIR"
+	Drivers           = "METRICS OPERATOR DRIVERS"
+	KubeletStart      = "METRICS OPERATOR KUBELET STATS START"
+	KubeletEnd        = "METRICS OPERATOR KUBELET STATS END"
+	handle            *zap.Logger
+	logger            *zap.SugaredLogger
 )
 
 // Metric Export is a flattened structure with minimal required metadata for now
@@ -28,6 +40,10 @@ type MetricExport struct {
 	// Global
 	Pods int32 `json:"pods"`
 
+	// Provenance of the run
+	ExperimentID string            `json:"experimentId,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+
 	// Application
 	ApplicationImage   string `json:"applicationImage,omitempty"`
 	ApplicationCommand string `json:"applicationCommand,omitempty"`
@@ -41,7 +57,9 @@ type MetricExport struct {
 
 	// Metric
 	MetricName        string                          `json:"metricName,omitempty"`
+	MetricAlias       string                          `json:"metricAlias,omitempty"`
 	MetricDescription string                          `json:"metricDescription,omitempty"`
+	MetricVersion     string                          `json:"metricVersion,omitempty"`
 	MetricType        string                          `json:"metricType,omitempty"`
 	MetricOptions     map[string]intstr.IntOrString   `json:"metricOptions,omitempty"`
 	MetricListOptions map[string][]intstr.IntOrString `json:"metricListOptions,omitempty"`
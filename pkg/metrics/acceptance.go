@@ -0,0 +1,71 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// An acceptance run has a pod of each replicated job on every node of the pool.
+// The controller sizes the set to the pool, and the pods of a replicated job
+// cannot share a node, so each lands on its own. Pods of different metrics can.
+// When the pool is known, the pods are also limited to its nodes.
+func applyAcceptance(set *api.MetricSet, rjs []jobset.ReplicatedJob) {
+	if !set.Spec.Acceptance.Enabled() {
+		return
+	}
+	for i := range rjs {
+		spec := &rjs[i].Template.Spec.Template.Spec
+		if spec.Affinity == nil {
+			spec.Affinity = &corev1.Affinity{}
+		}
+		if set.Status.Acceptance != nil {
+			spec.Affinity.NodeAffinity = getPoolAffinity(spec.Affinity.NodeAffinity, set.Status.Acceptance.Pool)
+		}
+		spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+				{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							jobset.JobSetNameKey:        set.Name,
+							jobset.ReplicatedJobNameKey: rjs[i].Name,
+						},
+					},
+					TopologyKey: "kubernetes.io/hostname",
+				},
+			},
+		}
+	}
+}
+
+// getPoolAffinity adds the nodes of the pool (by name, which is not always the
+// hostname label) to each term of a node affinity. Terms are or-ed, and the
+// requirements of a term are and-ed.
+func getPoolAffinity(affinity *corev1.NodeAffinity, pool []string) *corev1.NodeAffinity {
+	requirement := corev1.NodeSelectorRequirement{
+		Key:      "metadata.name",
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   pool,
+	}
+	if affinity == nil {
+		affinity = &corev1.NodeAffinity{}
+	}
+	if affinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		affinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{}},
+		}
+	}
+	terms := affinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		terms[i].MatchFields = append(terms[i].MatchFields, requirement)
+	}
+	return affinity
+}
@@ -51,7 +51,7 @@ func (m *AMG) SetOptions(metric *api.Metric) {
 
 // Validate that we can run AMG
 func (n AMG) Validate(spec *api.MetricSet) bool {
-	return spec.Spec.Pods >= 2
+	return n.TotalPods(spec) >= 2
 }
 
 // Exported options and list options
@@ -13,7 +13,6 @@ import (
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
@@ -65,18 +64,15 @@ func (m BDAS) Options() map[string]intstr.IntOrString {
 	}
 }
 
-func (m BDAS) PrepareContainers(
-	spec *api.MetricSet,
-	metric *metrics.Metric,
-) []*specs.ContainerSpec {
-
-	// Metadata to add to beginning of run
-	meta := metrics.Metadata(spec, metric)
-	hosts := m.GetHostlist(spec)
-	prefix := m.GetCommonPrefix(meta, m.Command, hosts)
+// bdasContext is for the templates of the launcher
+type bdasContext struct {
+	Interactive bool
+}
 
-	preBlock := `
-echo "%s"
+var (
+	// bdasPreTemplate writes the hostlist with ip addresses (needed for openmpi)
+	bdasPreTemplate = specs.NewTemplate(bdasIdentifier, `
+echo "{{ separator }}"
 
 # We need ip addresses for openmpi
 mv ./hostlist.txt ./hostnames.txt
@@ -91,16 +87,29 @@ for h in $(cat ./hostnames.txt); do
 done
 echo "Hostlist"
 cat ./hostlist.txt
-`
+`, bdasContext{})
+
+	// bdasPostTemplate ends the collection (and sleeps, if interactive)
+	bdasPostTemplate = specs.NewTemplate(bdasIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, bdasContext{})
+)
+
+func (m BDAS) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+	hosts := m.GetHostlist(spec)
+	prefix := m.GetCommonPrefix(spec, meta, m.Command, hosts)
 
-	postBlock := `
-echo "%s"
-%s
-`
 	command := fmt.Sprintf("%s ./problem.sh", m.Prefix)
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	preBlock = prefix + fmt.Sprintf(preBlock, metadata.Separator)
-	postBlock = fmt.Sprintf(postBlock, metadata.CollectionEnd, interactive)
+	context := bdasContext{Interactive: spec.Spec.Logging.Interactive}
+	preBlock := prefix + bdasPreTemplate.Render(context)
+	postBlock := bdasPostTemplate.Render(context)
 
 	// Entrypoint for the launcher
 	launcherEntrypoint := specs.EntrypointScript{
@@ -8,12 +8,9 @@ SPDX-License-Identifier: MIT
 package application
 
 import (
-	"fmt"
-
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
@@ -50,7 +47,7 @@ func (m *CustomApp) SetOptions(metric *api.Metric) {
 	// We require both a command and workdir
 	m.SetDefaultOptions(metric)
 	if m.Command == "" || m.Container == "" {
-		fmt.Printf("Either \"command\" or \"container\" is not defined - this will not work as expected")
+		logger.Warnf("Either \"command\" or \"container\" is not defined - this will not work as expected")
 	}
 }
 
@@ -72,6 +69,23 @@ func (m CustomApp) Options() map[string]intstr.IntOrString {
 	return values
 }
 
+// customContext is for the templates of the launcher
+type customContext struct {
+	Interactive bool
+}
+
+var (
+	customPreTemplate = specs.NewTemplate(customIdentifier, `
+echo "{{ separator }}"
+`, customContext{})
+
+	// customPostTemplate ends the collection (and sleeps, if interactive)
+	customPostTemplate = specs.NewTemplate(customIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, customContext{})
+)
+
 // Prepare containers with jobs and entrypoint scripts
 func (m CustomApp) PrepareContainers(
 	spec *api.MetricSet,
@@ -81,20 +95,12 @@ func (m CustomApp) PrepareContainers(
 	// Metadata to add to beginning of run
 	meta := metrics.Metadata(spec, metric)
 	hosts := m.GetHostlist(spec)
-	prefix := m.GetCommonPrefix(meta, m.Command, hosts)
+	prefix := m.GetCommonPrefix(spec, meta, m.Command, hosts)
 
 	// Template blocks for launcher script
-	preBlock := `
-echo "%s"
-`
-
-	postBlock := `
-echo "%s"
-%s
-`
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	preBlock = prefix + fmt.Sprintf(preBlock, metadata.Separator)
-	postBlock = fmt.Sprintf(postBlock, metadata.CollectionEnd, interactive)
+	context := customContext{Interactive: spec.Spec.Logging.Interactive}
+	preBlock := prefix + customPreTemplate.Render(context)
+	postBlock := customPostTemplate.Render(context)
 
 	// Entrypoint for the launcher
 	launcherEntrypoint := specs.EntrypointScript{
@@ -13,7 +13,6 @@ import (
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
@@ -271,33 +270,53 @@ func (m HPL) Options() map[string]intstr.IntOrString {
 	}
 }
 
-func (m HPL) PrepareContainers(
-	spec *api.MetricSet,
-	metric *metrics.Metric,
-) []*specs.ContainerSpec {
-
-	// Metadata to add to beginning of run
-	meta := metrics.Metadata(spec, metric)
-	hosts := m.GetHostlist(spec)
-	prefix := m.GetCommonPrefix(meta, "", hosts)
+// hplContext is for the templates of the launcher
+type hplContext struct {
+	Memory        int32
+	MemoryCommand string
+	Tasks         int32
+	Pods          int32
+
+	// Variables for the input file
+	Blocksize         int32
+	Ratio             string
+	RowOrColMajor     int32
+	Pfact             int32
+	Nbmin             int32
+	Ndiv              int32
+	Rfact             int32
+	Bcast             int32
+	Depth             int32
+	Swap              int32
+	SwappingThreshold int32
+	L1Transposed      int32
+	UTransposed       int32
+	MemAlignment      int32
+	Input             string
+
+	ConvertHostnames string
+	Interactive      bool
+}
 
-	// Memory command since could mess up templating
-	memoryCmd := `awk '/MemFree/ { printf "%.3f \n", $2/1024/1024 }' /proc/meminfo`
+// Memory command (free memory in GiB), if not defined
+const hplMemoryCommand = `awk '/MemFree/ { printf "%.3f \n", $2/1024/1024 }' /proc/meminfo`
 
-	preBlock := `
+var (
+	// hplPreTemplate calculates the problem size, and writes the input file
+	hplPreTemplate = specs.NewTemplate(hplIdentifier, `
 # Source spack environment
 . /opt/spack-environment/activate.sh
 		
 # Calculate memory, if not defined
-memory=%d
+memory={{ .Memory }}
 if [[ $memory -eq 0 ]]; then
-	memory=$(%s)
+	memory=$({{ .MemoryCommand }})
 fi
 		
 echo "Memory is ${memory}"
 		
-np=%d
-pods=%d
+np={{ .Tasks }}
+pods={{ .Pods }}
 # Tasks per node, not total
 tasks=$(nproc)
 if [[ $np -eq 0 ]]; then
@@ -307,8 +326,8 @@ fi
 echo "Number of tasks (nproc on one node) is $tasks"
 echo "Number of tasks total (across $pods nodes) is $np"
 		
-blocksize=%d
-ratio=%s
+blocksize={{ .Blocksize }}
+ratio={{ .Ratio }}
 		
 # This calculates the compute value - retrieved from tutorials in /opt/view/bin
 compute_script="compute_N -m ${memory} -NB ${blocksize} -r ${ratio} -N ${pods}"
@@ -318,63 +337,75 @@ size=$(${compute_script})
 echo "Compute size is ${size}"
 		
 # Define rest of envars we need for template
-row_or_colmajor_pmapping=%d
-pfact=%d
-nbmin=%d
-ndiv=%d
-rfact=%d
-bcast=%d
-depth=%d
-swap=%d
-swapping_threshold=%d
-L1_transposed=%d
-U_transposed=%d
-mem_alignment=%d
+row_or_colmajor_pmapping={{ .RowOrColMajor }}
+pfact={{ .Pfact }}
+nbmin={{ .Nbmin }}
+ndiv={{ .Ndiv }}
+rfact={{ .Rfact }}
+bcast={{ .Bcast }}
+depth={{ .Depth }}
+swap={{ .Swap }}
+swapping_threshold={{ .SwappingThreshold }}
+L1_transposed={{ .L1Transposed }}
+U_transposed={{ .UTransposed }}
+mem_alignment={{ .MemAlignment }}
 		
 # Write the input file (this parses environment variables too)
 cat <<EOF > ./hpl.dat
-%s
+{{ .Input }}
 EOF
 		
 cp ./hostlist.txt ./hostnames.txt
 rm ./hostlist.txt
-%s
+{{ .ConvertHostnames }}
 		
-echo "%s"
+echo "{{ separator }}"
 # This is in /root/hpl/bin/linux/xhpl
-`
+`, hplContext{})
+
+	// hplPostTemplate ends the collection (and sleeps, if interactive)
+	hplPostTemplate = specs.NewTemplate(hplIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, hplContext{})
+)
+
+func (m HPL) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+	hosts := m.GetHostlist(spec)
+	prefix := m.GetCommonPrefix(spec, meta, "", hosts)
 
-	postBlock := `
-echo "%s"
-%s
-`
 	command := fmt.Sprintf("mpirun --allow-run-as-root --hostfile ./hostlist.txt -np $np %s xhpl", m.mpiargs)
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	preBlock = prefix + fmt.Sprintf(
-		preBlock,
-		m.memory,
-		memoryCmd,
-		m.tasks,
-		spec.Spec.Pods,
-		m.blocksize,
-		m.ratio,
-		m.row_or_colmajor_pmapping,
-		m.pfact,
-		m.nbmin,
-		m.ndiv,
-		m.rfact,
-		m.bcast,
-		m.depth,
-		m.swap,
-		m.swappingThreshold,
-		m.l1tranposed,
-		m.utransposed,
-		m.memAlignment,
-		inputData,
-		metrics.TemplateConvertHostnames,
-		metadata.Separator,
-	)
-	postBlock = fmt.Sprintf(postBlock, metadata.CollectionEnd, interactive)
+	context := hplContext{
+		Memory:            m.memory,
+		MemoryCommand:     hplMemoryCommand,
+		Tasks:             m.tasks,
+		Pods:              m.TotalPods(spec),
+		Blocksize:         m.blocksize,
+		Ratio:             m.ratio,
+		RowOrColMajor:     m.row_or_colmajor_pmapping,
+		Pfact:             m.pfact,
+		Nbmin:             m.nbmin,
+		Ndiv:              m.ndiv,
+		Rfact:             m.rfact,
+		Bcast:             m.bcast,
+		Depth:             m.depth,
+		Swap:              m.swap,
+		SwappingThreshold: m.swappingThreshold,
+		L1Transposed:      m.l1tranposed,
+		UTransposed:       m.utransposed,
+		MemAlignment:      m.memAlignment,
+		Input:             inputData,
+		ConvertHostnames:  metrics.TemplateConvertHostnames,
+		Interactive:       spec.Spec.Logging.Interactive,
+	}
+	preBlock := prefix + hplPreTemplate.Render(context)
+	postBlock := hplPostTemplate.Render(context)
 
 	// Entrypoint for the launcher
 	launcherEntrypoint := specs.EntrypointScript{
@@ -49,7 +49,7 @@ func (m *Kripke) SetOptions(metric *api.Metric) {
 
 // Validate that we can run Kripke
 func (n Kripke) Validate(spec *api.MetricSet) bool {
-	return spec.Spec.Pods >= 2
+	return n.TotalPods(spec) >= 2
 }
 
 // Exported options and list options
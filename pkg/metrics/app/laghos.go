@@ -8,10 +8,13 @@ SPDX-License-Identifier: MIT
 package application
 
 import (
+	"fmt"
+
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
 
 const (
@@ -20,8 +23,25 @@ const (
 	laghosContainer  = "ghcr.io/converged-computing/metric-laghos:latest"
 )
 
+// Laghos flags for options, in the order they are added to the command.
+// When an option is not set, the Laghos default is used.
+var laghosFlags = []struct{ option, flag string }{
+	{"problem", "-p"},
+	{"dim", "-dim"},
+	{"refineSerial", "-rs"},
+	{"refineParallel", "-rp"},
+	{"maxSteps", "-ms"},
+}
+
 type Laghos struct {
 	metrics.LauncherWorker
+
+	// Number of MPI tasks
+	tasks int32
+
+	// Values for laghosFlags, and partial assembly
+	flags           map[string]string
+	partialAssembly bool
 }
 
 // I think this is a simulation?
@@ -42,18 +62,84 @@ func (m *Laghos) SetOptions(metric *api.Metric) {
 
 	// Set user defined values or fall back to defaults
 	m.Prefix = "/bin/bash"
-	m.Command = "mpirun -np 4 --hostfile ./hostlist.txt ./laghos"
 	m.Workdir = "/workflow/laghos"
+	m.tasks = 4
+	m.flags = map[string]string{}
+
+	tasks, ok := metric.Options["tasks"]
+	if ok {
+		m.tasks = tasks.IntVal
+	}
+	for _, flag := range laghosFlags {
+		value, ok := metric.Options[flag.option]
+		if ok {
+			m.flags[flag.option] = value.String()
+		}
+	}
+	pa, ok := metric.Options["partialAssembly"]
+	if ok {
+		m.partialAssembly = pa.StrVal == "true" || pa.StrVal == "yes"
+	}
+
+	// The command is derived from the options, unless the user provides it
+	m.Command = fmt.Sprintf("mpirun -np %d --hostfile ./hostlist.txt ./laghos", m.tasks)
+	for _, flag := range laghosFlags {
+		value, ok := m.flags[flag.option]
+		if ok {
+			m.Command += fmt.Sprintf(" %s %s", flag.flag, value)
+		}
+	}
+	if m.partialAssembly {
+		m.Command += " -pa"
+	}
 	m.SetDefaultOptions(metric)
 }
 
 // Exported options and list options
 func (m Laghos) Options() map[string]intstr.IntOrString {
-	return map[string]intstr.IntOrString{
-		"command": intstr.FromString(m.Command),
-		"prefix":  intstr.FromString(m.Prefix),
-		"workdir": intstr.FromString(m.Workdir),
+	values := map[string]intstr.IntOrString{
+		"command":         intstr.FromString(m.Command),
+		"prefix":          intstr.FromString(m.Prefix),
+		"workdir":         intstr.FromString(m.Workdir),
+		"tasks":           intstr.FromInt(int(m.tasks)),
+		"partialAssembly": intstr.FromString(fmt.Sprintf("%t", m.partialAssembly)),
+	}
+	for option, value := range m.flags {
+		values[option] = intstr.FromString(value)
+	}
+	return values
+}
+
+// laghosContext is for the template of the launcher post block
+type laghosContext struct {
+	Interactive bool
+}
+
+// laghosPostTemplate prints the timing (and rates) for the major kernels, which Laghos ends with
+var laghosPostTemplate = specs.NewTemplate(laghosIdentifier+"-post", `
+echo "{{ separator }}"
+grep -E "^(CG \(H1\)|CG \(L2\)|Forces|UpdateQuadData|Major kernels)" laghos.out
+cp laghos.out ${METRICS_OPERATOR_RESULTS}/ 2>/dev/null || true
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, laghosContext{})
+
+// Prepare containers, saving the output to report the major kernel timings
+func (m Laghos) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+	containers := m.LauncherWorker.PrepareContainers(spec, metric)
+	for _, launcher := range containers {
+		if launcher.JobName != m.LauncherLetter {
+			continue
+		}
+
+		// With pipefail, a failed run is not hidden by tee succeeding
+		launcher.EntrypointScript.Command = fmt.Sprintf("(set -o pipefail; %s 2>&1 | tee laghos.out)", launcher.EntrypointScript.Command)
+		launcher.EntrypointScript.Post = laghosPostTemplate.Render(laghosContext{Interactive: spec.Spec.Logging.Interactive})
 	}
+	return containers
 }
 
 func init() {
@@ -9,11 +9,11 @@ package application
 
 import (
 	"fmt"
+	"strings"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
@@ -24,8 +24,40 @@ const (
 	lammpsContainer  = "ghcr.io/converged-computing/metric-lammps:latest"
 )
 
+// Working directories for input problems we know about in the container.
+// Any other input must be in a workdir the user provides, or an inline input.
+var lammpsProblems = map[string]string{
+	"in.reaxc.hns": "/opt/lammps/examples/reaxff/HNS",
+	"in.lj":        "/opt/lammps/bench",
+	"in.chain":     "/opt/lammps/bench",
+	"in.eam":       "/opt/lammps/bench",
+	"in.chute":     "/opt/lammps/bench",
+	"in.rhodo":     "/opt/lammps/bench",
+}
+
 type Lammps struct {
 	metrics.LauncherWorker
+
+	// Input problem, and x/y/z replication of it
+	input string
+	x     int32
+	y     int32
+	z     int32
+
+	// Multiply the replication by the number of pods (weak scaling)
+	scale bool
+
+	// Number of MPI tasks
+	tasks int32
+
+	// Accelerator package (kokkos or gpu) and gpus per task
+	gpu  string
+	gpus int32
+
+	// The input is an inline input of the metric (by name, or a template
+	// like {{.Inputs.in_lj}}), or found in a workdir the user provided
+	inline  bool
+	workdir bool
 }
 
 func (m Lammps) Url() string {
@@ -51,25 +83,130 @@ func (m *Lammps) SetOptions(metric *api.Metric) {
 		m.SoleTenancy = true
 	}
 
-	// Set user defined values or fall back to defaults
-	// This is a more manual approach that puts the user in charge of determining the entire command
-	// This more closely matches what we might do on HPC :)
-	m.Command = "mpirun --hostfile ./hostlist.txt -np 2 --map-by socket lmp -v x 2 -v y 2 -v z 2 -in in.reaxc.hns -nocite"
-	m.Workdir = "/opt/lammps/examples/reaxff/HNS"
+	// The command is derived from the input problem and options, unless the user
+	// provides the entire command (closer to what we might do on HPC :)
+	m.input = "in.reaxc.hns"
+	m.x, m.y, m.z = 2, 2, 2
+	m.tasks = 2
+	m.gpus = 1
+	m.Command = ""
+
+	input, ok := metric.Options["input"]
+	if ok {
+		m.input = input.StrVal
+	}
+	_, named := metric.Inputs[m.input]
+	m.inline = named || (strings.Contains(m.input, "{{") && len(metric.Inputs) > 0)
+	_, m.workdir = metric.Options["workdir"]
+	m.Workdir = lammpsProblems[m.input]
+	if m.Workdir == "" {
+		m.Workdir = lammpsProblems["in.reaxc.hns"]
+	}
+	for key, value := range map[string]*int32{"x": &m.x, "y": &m.y, "z": &m.z, "tasks": &m.tasks, "gpus": &m.gpus} {
+		option, ok := metric.Options[key]
+		if ok {
+			*value = option.IntVal
+		}
+	}
+	scale, ok := metric.Options["scale"]
+	if ok {
+		m.scale = scale.StrVal == "true" || scale.StrVal == "yes"
+	}
+	gpu, ok := metric.Options["gpu"]
+	if ok {
+		m.gpu = gpu.StrVal
+	}
 	m.SetDefaultOptions(metric)
 }
 
-// LAMMPS can be run on one node
-func (m Lammps) Validate(spec *api.MetricSet) bool {
+// LAMMPS can be run on one node. After validating, we derive the command
+// (unless the user provided one), so it is known before options are exported.
+func (m *Lammps) Validate(spec *api.MetricSet) bool {
+	if m.gpu != "" && m.gpu != "kokkos" && m.gpu != "gpu" {
+		logger.Errorf("🟥️ LAMMPS gpu must be kokkos or gpu, found %s", m.gpu)
+		return false
+	}
+	if m.x < 1 || m.y < 1 || m.z < 1 || m.tasks < 1 || m.gpus < 1 {
+		logger.Errorf("🟥️ LAMMPS x, y, z, tasks, and gpus must be 1 or greater")
+		return false
+	}
+	if strings.TrimSpace(m.Command) != "" {
+		return true
+	}
+	_, known := lammpsProblems[m.input]
+	if !known && !m.inline && !m.workdir {
+		logger.Errorf("🟥️ LAMMPS input %s is not in the container, provide it as an inline input or set the workdir that has it", m.input)
+		return false
+	}
+	m.Command = m.getCommand(spec)
 	return true
 }
 
+// getReplication returns the x/y/z replication, optionally scaled by the
+// number of pods. Prime factors of the pods are spread across the dimensions
+// so the problem stays close to the original shape, e.g., 8 pods is 2x2x2.
+func (m Lammps) getReplication(pods int32) (int32, int32, int32) {
+	dims := []int32{m.x, m.y, m.z}
+	if !m.scale {
+		return dims[0], dims[1], dims[2]
+	}
+	factors := []int32{}
+	for factor := int32(2); pods > 1; {
+		if pods%factor == 0 {
+			factors = append([]int32{factor}, factors...)
+			pods /= factor
+			continue
+		}
+		factor++
+	}
+	growth := []int32{1, 1, 1}
+	for _, factor := range factors {
+		smallest := 0
+		for i := range growth {
+			if growth[i] < growth[smallest] {
+				smallest = i
+			}
+		}
+		growth[smallest] *= factor
+	}
+	return dims[0] * growth[0], dims[1] * growth[1], dims[2] * growth[2]
+}
+
+// getCommand derives the lmp command from the input problem and options
+func (m Lammps) getCommand(spec *api.MetricSet) string {
+	x, y, z := m.getReplication(m.TotalPods(spec))
+
+	// An inline input named directly is found by its path
+	input := m.input
+	if m.inline && !strings.Contains(input, "{{") {
+		input = fmt.Sprintf("{{ index .Inputs %q }}", input)
+	}
+	command := fmt.Sprintf(
+		"mpirun --hostfile ./hostlist.txt -np %d --map-by socket lmp -v x %d -v y %d -v z %d -in %s -nocite",
+		m.tasks, x, y, z, input,
+	)
+	if m.gpu == "kokkos" {
+		command += fmt.Sprintf(" -k on g %d -sf kk -pk kokkos newton on neigh half", m.gpus)
+	} else if m.gpu == "gpu" {
+		command += fmt.Sprintf(" -sf gpu -pk gpu %d", m.gpus)
+	}
+	return command
+}
+
 // Exported options and list options
 func (m Lammps) Options() map[string]intstr.IntOrString {
 	values := map[string]intstr.IntOrString{
-		"command":    intstr.FromString(m.Command),
-		"workdir":    intstr.FromString(m.Workdir),
+		"command":     intstr.FromString(m.Command),
+		"workdir":     intstr.FromString(m.Workdir),
 		"soleTenancy": intstr.FromString("false"),
+		"input":       intstr.FromString(m.input),
+		"x":           intstr.FromInt(int(m.x)),
+		"y":           intstr.FromInt(int(m.y)),
+		"z":           intstr.FromInt(int(m.z)),
+		"scale":       intstr.FromString(fmt.Sprintf("%t", m.scale)),
+		"tasks":       intstr.FromInt(int(m.tasks)),
+		"gpu":         intstr.FromString(m.gpu),
+		"gpus":        intstr.FromInt(int(m.gpus)),
 	}
 	if m.SoleTenancy {
 		values["soleTenancy"] = intstr.FromString("true")
@@ -77,6 +214,29 @@ func (m Lammps) Options() map[string]intstr.IntOrString {
 	return values
 }
 
+// lammpsContext is for the templates of the launcher
+type lammpsContext struct {
+	Interactive bool
+}
+
+var (
+	lammpsPreTemplate = specs.NewTemplate(lammpsIdentifier, `
+echo "{{ separator }}"
+`, lammpsContext{})
+
+	// LAMMPS writes log.lammps to the working directory, and we report the wall time
+	// in seconds and keep the log with the pod results
+	lammpsPostTemplate = specs.NewTemplate(lammpsIdentifier+"-post", `
+wall=$(grep -m 1 "Total wall time" log.lammps 2>/dev/null | awk '{print $4}')
+if [[ -n "${wall}" ]]; then
+    echo "LAMMPS wall time seconds: $(echo ${wall} | awk -F: '{print ($1 * 3600) + ($2 * 60) + $3}')"
+fi
+cp log.lammps ${METRICS_OPERATOR_RESULTS}/ 2>/dev/null || true
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, lammpsContext{})
+)
+
 // Prepare containers with jobs and entrypoint scripts
 func (m Lammps) PrepareContainers(
 	spec *api.MetricSet,
@@ -86,20 +246,12 @@ func (m Lammps) PrepareContainers(
 	// Metadata to add to beginning of run
 	meta := metrics.Metadata(spec, metric)
 	hosts := m.GetHostlist(spec)
-	prefix := m.GetCommonPrefix(meta, m.Command, hosts)
+	prefix := m.GetCommonPrefix(spec, meta, m.Command, hosts)
 
 	// Template blocks for launcher script
-	preBlock := `
-echo "%s"
-`
-
-	postBlock := `
-echo "%s"
-%s
-`
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	preBlock = prefix + fmt.Sprintf(preBlock, metadata.Separator)
-	postBlock = fmt.Sprintf(postBlock, metadata.CollectionEnd, interactive)
+	context := lammpsContext{Interactive: spec.Spec.Logging.Interactive}
+	preBlock := prefix + lammpsPreTemplate.Render(context)
+	postBlock := lammpsPostTemplate.Render(context)
 
 	// Entrypoint for the launcher
 	launcherEntrypoint := specs.EntrypointScript{
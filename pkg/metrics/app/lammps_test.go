@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package application
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestLammpsReplication(t *testing.T) {
+	tests := map[string]struct {
+		scale    bool
+		pods     int32
+		expected [3]int32
+	}{
+		"not scaled":  {pods: 8, expected: [3]int32{2, 2, 2}},
+		"one pod":     {scale: true, pods: 1, expected: [3]int32{2, 2, 2}},
+		"cube":        {scale: true, pods: 8, expected: [3]int32{4, 4, 4}},
+		"two factors": {scale: true, pods: 6, expected: [3]int32{6, 4, 2}},
+		"prime":       {scale: true, pods: 7, expected: [3]int32{14, 2, 2}},
+		"twelve":      {scale: true, pods: 12, expected: [3]int32{6, 4, 4}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := Lammps{x: 2, y: 2, z: 2, scale: test.scale}
+			x, y, z := m.getReplication(test.pods)
+			if [3]int32{x, y, z} != test.expected {
+				t.Errorf("expected %v, found %v", test.expected, [3]int32{x, y, z})
+			}
+			if test.scale && x*y*z != 8*test.pods {
+				t.Errorf("expected the problem to grow with the %d pods, found %dx%dx%d", test.pods, x, y, z)
+			}
+		})
+	}
+}
+
+func TestLammpsInput(t *testing.T) {
+	spec := &api.MetricSet{Spec: api.MetricSetSpec{Pods: 2}}
+	tests := map[string]struct {
+		options map[string]intstr.IntOrString
+		inputs  map[string]string
+		valid   bool
+		command string
+	}{
+		"default": {
+			valid:   true,
+			command: "-in in.reaxc.hns -nocite",
+		},
+		"unknown": {
+			options: map[string]intstr.IntOrString{"input": intstr.FromString("in.mine")},
+		},
+		"in the workdir": {
+			options: map[string]intstr.IntOrString{"input": intstr.FromString("in.mine"), "workdir": intstr.FromString("/data")},
+			valid:   true,
+			command: "-in in.mine -nocite",
+		},
+		"inline by name": {
+			options: map[string]intstr.IntOrString{"input": intstr.FromString("in.mine")},
+			inputs:  map[string]string{"in.mine": "run 100"},
+			valid:   true,
+			command: `-in {{ index .Inputs "in.mine" }} -nocite`,
+		},
+		"inline template": {
+			options: map[string]intstr.IntOrString{"input": intstr.FromString("{{.Inputs.in_mine}}")},
+			inputs:  map[string]string{"in.mine": "run 100"},
+			valid:   true,
+			command: "-in {{.Inputs.in_mine}} -nocite",
+		},
+		"user command": {
+			options: map[string]intstr.IntOrString{"input": intstr.FromString("in.mine"), "command": intstr.FromString("lmp -in in.mine")},
+			valid:   true,
+			command: "lmp -in in.mine",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := &Lammps{}
+			m.SetOptions(&api.Metric{Name: lammpsIdentifier, Options: test.options, Inputs: test.inputs})
+			valid := m.Validate(spec)
+			if valid != test.valid {
+				t.Fatalf("expected valid to be %t", test.valid)
+			}
+			if !valid {
+				return
+			}
+
+			// The command is exported with the options
+			command := m.Options()["command"].StrVal
+			if !strings.HasSuffix(command, test.command) {
+				t.Errorf("expected a command ending with %q, found %q", test.command, command)
+			}
+		})
+	}
+}
@@ -8,12 +8,9 @@ SPDX-License-Identifier: MIT
 package application
 
 import (
-	"fmt"
-
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
@@ -89,60 +86,69 @@ func (n LDMS) ListOptions() map[string][]intstr.IntOrString {
 	return map[string][]intstr.IntOrString{}
 }
 
-func (m LDMS) PrepareContainers(
-	spec *api.MetricSet,
-	metric *metrics.Metric,
-) []*specs.ContainerSpec {
-
-	// Metadata to add to beginning of run
-	meta := metrics.Metadata(spec, metric)
+// ldmsContext is for the templates of the application container
+type ldmsContext struct {
+	Metadata    string
+	Completions int32
+	Command     string
+	Rate        int32
+	Interactive bool
+}
 
-	preBlock := `
+var (
+	// ldmsPreTemplate starts ldmsd, and runs the command until the completions are done
+	ldmsPreTemplate = specs.NewTemplate(ldmsIdentifier, `
 # Setup munge
 mkdir -p /run/munge
 chown -R 0 /var/log/munge /var/lib/munge /etc/munge /run/munge
 # Skip munge for now, not on a cluster
 # ldmsd -x sock:10444 -c /opt/sampler.conf -l /tmp/demo_ldmsd_log -v DEBUG -a munge  -r $(pwd)/ldmsd.pid
 ldmsd -x sock:10444 -c /opt/sampler.conf -l /tmp/demo_ldmsd_log -v DEBUG -r $(pwd)/ldmsd.pid
-echo "%s"
+echo "{{ .Metadata }}"
 	
 i=0
-completions=%d
-echo "%s"
+completions={{ .Completions }}
+echo "{{ collectionStart }}"
 while true
   do
-	echo "%s"
-	%s
+	echo "{{ separator }}"
+	mo_phase_report
+	{{ .Command }}
 	if [[ $retval -ne 0 ]]; then
-		echo "%s"
+		echo "{{ collectionEnd }}"
 		exit 0
 	fi
 	if [[ $completions -ne 0 ]] && [[ $i -eq $completions ]]; then
-		echo "%s"
+		echo "{{ collectionEnd }}"
 		exit 0
 	fi
-	sleep %d
+	sleep {{ .Rate }}
 	let i=i+1
 done
-`
-
-	postBlock := `
-echo "%s"
-%s
-`
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	preBlock = fmt.Sprintf(
-		preBlock,
-		meta,
-		m.completions,
-		metadata.CollectionStart,
-		metadata.Separator,
-		m.command,
-		metadata.CollectionEnd,
-		metadata.CollectionEnd,
-		m.rate,
-	)
-	postBlock = fmt.Sprintf(postBlock, metadata.CollectionEnd, interactive)
+`, ldmsContext{})
+
+	// ldmsPostTemplate ends the collection (and sleeps, if interactive)
+	ldmsPostTemplate = specs.NewTemplate(ldmsIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, ldmsContext{})
+)
+
+func (m LDMS) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	preBlock := ldmsPreTemplate.Render(ldmsContext{
+		Metadata:    meta,
+		Completions: m.completions,
+		Command:     m.command,
+		Rate:        m.rate,
+	})
+	postBlock := ldmsPostTemplate.Render(ldmsContext{Interactive: spec.Spec.Logging.Interactive})
 	return m.ApplicationContainerSpec(preBlock, "", postBlock)
 }
 
@@ -0,0 +1,130 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// Annotations that ask the cluster autoscaler (and Karpenter) not to evict a pod to scale down
+var protectAnnotations = map[string]string{
+	"cluster-autoscaler.kubernetes.io/safe-to-evict": "false",
+	"karpenter.sh/do-not-disrupt":                    "true",
+}
+
+// getPodAnnotations returns the pod annotations from the spec, and the
+// scale-down protection (and Volcano pod group) annotations if requested
+func getPodAnnotations(set *api.MetricSet) map[string]string {
+	provenance := getProvenanceAnnotations(set)
+	if !set.Spec.Autoscaler.Protect && !set.Spec.GangScheduling.Enabled() && len(provenance) == 0 {
+		return set.Spec.Pod.Annotations
+	}
+	annotations := map[string]string{}
+	for key, value := range set.Spec.Pod.Annotations {
+		annotations[key] = value
+	}
+	for key, value := range provenance {
+		annotations[key] = value
+	}
+	if set.Spec.Autoscaler.Protect {
+		for key, value := range protectAnnotations {
+			annotations[key] = value
+		}
+	}
+	addPodGroupAnnotations(set, annotations)
+	return annotations
+}
+
+// Node labels used by Karpenter to select a NodePool and instance types
+const (
+	NodePoolLabel     = "karpenter.sh/nodepool"
+	CapacityTypeLabel = "karpenter.sh/capacity-type"
+	InstanceTypeLabel = "node.kubernetes.io/instance-type"
+)
+
+// getNodeSelector returns the node selector from the spec, and the NodePool if requested
+func getNodeSelector(set *api.MetricSet) map[string]string {
+	if set.Spec.Autoscaler.NodePool == "" {
+		return set.Spec.Pod.NodeSelector
+	}
+	selector := map[string]string{}
+	for key, value := range set.Spec.Pod.NodeSelector {
+		selector[key] = value
+	}
+	selector[NodePoolLabel] = set.Spec.Autoscaler.NodePool
+	return selector
+}
+
+// getNodeAffinity requires one of the requested instance types, so Karpenter
+// provisions exactly that hardware (and the pods are not placed elsewhere)
+func getNodeAffinity(set *api.MetricSet) *corev1.NodeAffinity {
+	if len(set.Spec.Autoscaler.InstanceTypes) == 0 {
+		return nil
+	}
+	return &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{
+				{
+					MatchExpressions: []corev1.NodeSelectorRequirement{
+						{
+							Key:      InstanceTypeLabel,
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   set.Spec.Autoscaler.InstanceTypes,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// getAutoscalerEnvironment provides the creation time of the set and the node
+// so the prelude can record provisioning time
+func getAutoscalerEnvironment(set *api.MetricSet) []corev1.EnvVar {
+	if !set.Spec.Autoscaler.Enabled() {
+		return []corev1.EnvVar{}
+	}
+	return []corev1.EnvVar{
+		{Name: "METRICS_OPERATOR_CREATED", Value: fmt.Sprintf("%d", set.CreationTimestamp.Unix())},
+		{
+			Name: "METRICS_OPERATOR_NODE",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+			},
+		},
+	}
+}
+
+// addAutoscalerWait has each entrypoint wait for all pods of the set (found
+// with the headless service) before the command runs, if a wait is requested
+func addAutoscalerWait(
+	set *api.MetricSet,
+	rjs []jobset.ReplicatedJob,
+	containerSpecs []*specs.ContainerSpec,
+) {
+	if set.Spec.Autoscaler.WaitSeconds <= 0 {
+		return
+	}
+	pods := int32(0)
+	for _, rj := range rjs {
+		parallelism := int32(1)
+		if rj.Template.Spec.Parallelism != nil {
+			parallelism = *rj.Template.Spec.Parallelism
+		}
+		pods += int32(rj.Replicas) * parallelism
+	}
+	host := fmt.Sprintf("%s.%s.svc.cluster.local", set.Subdomain(), set.Namespace)
+	for _, cs := range containerSpecs {
+		cs.EntrypointScript.WithWait(host, pods, set.Spec.Autoscaler.WaitSeconds)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestAddAutoscalerWait(t *testing.T) {
+	tests := map[string]struct {
+		autoscaler api.Autoscaler
+		waits      bool
+	}{
+		"disabled": {},
+		"protect":  {autoscaler: api.Autoscaler{Protect: true}},
+		"nodepool": {autoscaler: api.Autoscaler{NodePool: "gpu"}},
+		"wait":     {autoscaler: api.Autoscaler{Protect: true, WaitSeconds: 60}, waits: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "bench", Namespace: "default"}}
+			set.Spec.ServiceName = "bench"
+			set.Spec.Autoscaler = test.autoscaler
+			rjs := []jobset.ReplicatedJob{{Name: "m", Replicas: 2}}
+			cs := []*specs.ContainerSpec{{EntrypointScript: specs.EntrypointScript{Command: "fio"}}}
+			addAutoscalerWait(set, rjs, cs)
+
+			waits := strings.Contains(cs[0].EntrypointScript.Command, "mo_wait_for_pods")
+			if waits != test.waits {
+				t.Errorf("expected wait %v, found command %q", test.waits, cs[0].EntrypointScript.Command)
+			}
+			if waits && !strings.HasPrefix(cs[0].EntrypointScript.Command, "mo_wait_for_pods bench.default.svc.cluster.local 2 60\n") {
+				t.Errorf("expected to wait for 2 pods for 60 seconds, found %q", cs[0].EntrypointScript.Command)
+			}
+		})
+	}
+}
@@ -22,6 +22,10 @@ type BaseMetric struct {
 	Container  string
 	Workdir    string
 
+	// Revision of the metric scripts (entrypoints and parsing), bumped when
+	// a change would make results differ from earlier runs
+	ScriptRevision string
+
 	// A custom container can be used to replace the application
 	// (typically advanced users only)
 	CustomContainer string
@@ -33,20 +37,23 @@ type BaseMetric struct {
 
 	// A metric can have one or more addons
 	Addons map[string]*addons.Addon
+
+	// Alias to run more than one of the same metric in a set
+	alias string
 }
 
 // RegisterAddon adds an addon to the set, assuming it's already validated
 func (m *BaseMetric) RegisterAddon(addon *addons.Addon) {
 	a := (*addon)
 	m.InitAddons()
-	logger.Infof("🟧️ Registering addon %s", a.Name())
+	logger.Debugf("🟧️ Registering addon %s", a.Name())
 	m.Addons[a.Name()] = addon
 }
 
 // InitAddons ensures we don't have an empty map
 func (m *BaseMetric) InitAddons() {
 	if m.Addons == nil {
-		logger.Infof("🟧️ Resetting addons - they are unset.")
+		logger.Debugf("🟧️ Resetting addons - they are unset.")
 		m.Addons = map[string]*addons.Addon{}
 	}
 }
@@ -56,11 +63,29 @@ func (m BaseMetric) Name() string {
 	return m.Identifier
 }
 
+// Alias returns the metric alias, if set
+func (m BaseMetric) Alias() string {
+	return m.alias
+}
+
+// Set an alias for the metric
+func (m *BaseMetric) SetAlias(alias string) {
+	m.alias = alias
+}
+
 // Set a custom container
 func (m *BaseMetric) SetContainer(container string) {
 	m.Container = container
 }
 
+// Revision returns the revision of the metric scripts
+func (m BaseMetric) Revision() string {
+	if m.ScriptRevision == "" {
+		return DefaultRevision
+	}
+	return m.ScriptRevision
+}
+
 // Description returns the metric description
 func (m BaseMetric) Description() string {
 	return m.Summary
@@ -91,6 +116,9 @@ func (m BaseMetric) Validate(set *api.MetricSet) bool {
 func (m BaseMetric) ListOptions() map[string][]intstr.IntOrString {
 	return map[string][]intstr.IntOrString{}
 }
+func (m BaseMetric) MapOptions() map[string]map[string]intstr.IntOrString {
+	return map[string]map[string]intstr.IntOrString{}
+}
 
 // Jobs required for success condition (n is the netmark run)
 func (m BaseMetric) SuccessJobs() []string {
@@ -101,6 +129,26 @@ func (m BaseMetric) HasSoleTenancy() bool {
 	return m.SoleTenancy
 }
 
+// By default, metrics do not document temporary data they write
+func (m BaseMetric) ScratchNeeds() *specs.ScratchNeeds {
+	return nil
+}
+
+// By default, metrics have a bash entrypoint and only run on Linux
+func (m BaseMetric) SupportsWindows() bool {
+	return false
+}
+
+// Pods returns the pods for the default replicated job, which the spec can size
+// by its role (the job name, or the alias of the metric)
+func (m *BaseMetric) Pods(spec *api.MetricSet) int32 {
+	pods := spec.RolePods(ReplicatedJobName, spec.Spec.Pods)
+	if m.alias != "" {
+		return spec.RolePods(m.alias, pods)
+	}
+	return pods
+}
+
 // Default replicated jobs will generate for N pods, with no shared process namespace (e.g., storage)
 func (m *BaseMetric) ReplicatedJobs(spec *api.MetricSet) ([]*jobset.ReplicatedJob, error) {
 
@@ -156,7 +204,7 @@ func (m BaseMetric) AddAddons(
 	for _, addon := range m.Addons {
 		a := (*addon)
 
-		logger.Infof("🟧️ Including Addon", a.Name())
+		logger.Debugf("🟧️ Including Addon %s", a.Name())
 		volumes = append(volumes, a.AssembleVolumes()...)
 
 		// Assemble containers that addons provide, also as specs
@@ -177,30 +225,50 @@ func (m BaseMetric) AddAddons(
 		a.CustomizeEntrypoints(containerSpecs, rjs)
 	}
 
+	// A shared scratch volume is added to all containers
+	volumes = append(volumes, getScratchVolumes(spec)...)
+
+	// As is the results volume, with a directory per run, job, and pod
+	volumes = append(volumes, getResultsVolumes(spec)...)
+
+	// And the checkpoint volume of the metric, if it is restartable
+	volumes = append(volumes, getCheckpointVolumes(spec, containerSpecs)...)
+
+	// And the phases volume, if applications write phase markers
+	volumes = append(volumes, getPhaseVolumes(spec)...)
+
 	// There is a bug here showing lots of nil but I don't know why
-	logger.Infof("🟧️ Volumes that are going to be added %s\n", volumes)
+	logger.Debugf("🟧️ Adding %d volumes", len(volumes))
 
 	// Add containers to the replicated job (filtered based on matching names)
-	containers := addonContainers
+	// The chown init container (if requested) runs before those of addons
+	containers := getChownContainers(spec, volumes)
+	containers = append(containers, addonContainers...)
 	for _, cs := range containerSpecs {
 		containers = append(containers, (*cs))
 	}
 
 	// Generate actual containers and volumes for each replicated job
+	// The offset is the number of pods in jobs before it, used to derive a rank
+	offset := int32(0)
+	pods := getTotalPods(spec, rjs)
 	for _, rj := range rjs {
 
 		// We also include the addon volumes, which generally need mount points
-		rjContainers, initContainers, err := getReplicatedJobContainers(spec, rj, containers, volumes)
+		rjContainers, initContainers, err := getReplicatedJobContainers(spec, rj, offset, pods, containers, volumes)
 		if err != nil {
 			return cms, err
 		}
+		if rj.Template.Spec.Parallelism != nil {
+			offset += *rj.Template.Spec.Parallelism
+		}
 		rj.Template.Spec.Template.Spec.Containers = rjContainers
 		rj.Template.Spec.Template.Spec.InitContainers = initContainers
 
 		// And volumes!
 		// containerSpecs are used to generate our metric entrypoint volumes
 		// volumes indicate existing volumes
-		rj.Template.Spec.Template.Spec.Volumes = getReplicatedJobVolumes(spec, containerSpecs, volumes)
+		rj.Template.Spec.Template.Spec.Volumes = getReplicatedJobVolumes(spec, rj.Name, containerSpecs, volumes)
 	}
 	return cms, nil
 }
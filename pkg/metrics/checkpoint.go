@@ -0,0 +1,101 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"path/filepath"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Checkpoints of a metric are on an existing persistent volume claim, under a
+// directory per MetricSet, run, replicated job, and completion index. A pod that
+// is rescheduled keeps its index, and finds the checkpoints of the last pod.
+const checkpointVolumeName = "metrics-operator-checkpoints"
+
+// getCheckpointVolumes returns the checkpoint volume for the containers of a
+// metric, if it asks for one
+func getCheckpointVolumes(set *api.MetricSet, cs []*specs.ContainerSpec) []specs.VolumeSpec {
+	for _, c := range cs {
+		if c.Metric == "" {
+			continue
+		}
+		checkpoint := getMetricSpec(set, c.Metric).Checkpoint
+		if !checkpoint.Enabled() {
+			return []specs.VolumeSpec{}
+		}
+		volume := corev1.Volume{
+			Name: checkpointVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: checkpoint.ClaimName,
+				},
+			},
+		}
+		return []specs.VolumeSpec{{
+			Volume: volume,
+			Path:   checkpoint.GetPath(),
+			Mount:  true,
+		}}
+	}
+	return []specs.VolumeSpec{}
+}
+
+// getCheckpointRun is the checkpoint directory for this run of the MetricSet
+// (named by creation time, as the results are), so a new run starts over
+func getCheckpointRun(set *api.MetricSet, checkpoint api.Checkpoint) string {
+	run := set.CreationTimestamp.UTC().Format("20060102-150405")
+	return filepath.Join(checkpoint.GetPath(), set.Name, run)
+}
+
+// applyCheckpoint adds a block to the entrypoint of a metric container that finds
+// the latest checkpoint of the pod, and when there is one, sets the restart flags.
+// Flags are appended to a command on one line, and other commands can use
+// ${METRICS_OPERATOR_RESTART_FLAGS}. The flags are rendered as a template, e.g.,
+// {{.Checkpoint}} is the path of the latest checkpoint.
+func applyCheckpoint(set *api.MetricSet, metric api.Metric, c *specs.ContainerSpec) {
+	checkpoint := metric.Checkpoint
+	if !checkpoint.Enabled() {
+		return
+	}
+	c.EntrypointScript.Pre += checkpointTemplate.Render(checkpointContext{
+		Run:          getCheckpointRun(set, checkpoint),
+		Job:          c.JobName,
+		Pattern:      checkpoint.GetPattern(),
+		RestartFlags: checkpoint.RestartFlags,
+	})
+
+	command := strings.TrimSpace(c.EntrypointScript.Command)
+	if checkpoint.RestartFlags != "" && command != "" && !strings.Contains(command, "\n") {
+		c.EntrypointScript.Command = command + " ${METRICS_OPERATOR_RESTART_FLAGS}"
+	}
+}
+
+// checkpointContext is for the template of the checkpoint block
+type checkpointContext struct {
+	Run          string
+	Job          string
+	Pattern      string
+	RestartFlags string
+}
+
+// The restart flags are double quoted, so variables (e.g., ${METRICS_OPERATOR_CHECKPOINT}) are expanded
+var checkpointTemplate = specs.NewTemplate("checkpoint", `
+# Checkpoints, to resume from the latest when the pod is rescheduled
+export METRICS_OPERATOR_CHECKPOINT_DIR={{ .Run }}/{{ .Job }}/${METRICS_OPERATOR_INDEX}
+mkdir -p ${METRICS_OPERATOR_CHECKPOINT_DIR}
+export METRICS_OPERATOR_CHECKPOINT=$(ls -1td ${METRICS_OPERATOR_CHECKPOINT_DIR}/{{ .Pattern }} 2>/dev/null | head -1)
+export METRICS_OPERATOR_RESTART_FLAGS=""
+if [ -n "${METRICS_OPERATOR_CHECKPOINT}" ]; then
+    echo "Resuming from checkpoint ${METRICS_OPERATOR_CHECKPOINT}"
+    METRICS_OPERATOR_RESTART_FLAGS={{ doubleQuote .RestartFlags }}
+fi
+`, checkpointContext{})
@@ -0,0 +1,110 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyCheckpoint(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is required to run the entrypoint")
+	}
+	root := t.TempDir()
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{
+		Name:              "lammps",
+		CreationTimestamp: metav1.NewTime(time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)),
+	}}
+	metric := api.Metric{
+		Name: "app-lammps",
+		Checkpoint: api.Checkpoint{
+			ClaimName:    "checkpoints",
+			Path:         root,
+			Pattern:      "restart.*",
+			RestartFlags: "-var restart {{.Checkpoint}}",
+		},
+	}
+	c := &specs.ContainerSpec{
+		JobName:          "l",
+		EntrypointScript: specs.EntrypointScript{Command: "echo lmp -in in.lj"},
+	}
+	applyCheckpoint(set, metric, c)
+	variables := TemplateVariables{Checkpoint: "${METRICS_OPERATOR_CHECKPOINT}"}
+	pre, err := renderVariables(c.EntrypointScript.Pre, variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(index int) string {
+		script := fmt.Sprintf("METRICS_OPERATOR_INDEX=%d\n%s\n%s", index, pre, c.EntrypointScript.Command)
+		out, err := exec.Command(sh, "-c", script).CombinedOutput()
+		if err != nil {
+			t.Fatalf("index %d: %s\n%s", index, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	// The first pod starts from scratch, and gets a directory for its index
+	if output := run(1); output != "lmp -in in.lj" {
+		t.Errorf("expected no restart flags without a checkpoint, found %q", output)
+	}
+	dir := filepath.Join(root, "lammps", "20261016-093000", "l", "1")
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("expected the checkpoint directory %s: %s", dir, err)
+	}
+
+	// A rescheduled pod resumes from the latest checkpoint that matches
+	for i, name := range []string{"restart.100", "restart.200", "other.300"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("state"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		stamp := time.Now().Add(time.Duration(i-3) * time.Minute)
+		if err := os.Chtimes(path, stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := fmt.Sprintf("Resuming from checkpoint %s/restart.200\nlmp -in in.lj -var restart %s/restart.200", dir, dir)
+	if output := run(1); output != expected {
+		t.Errorf("expected %q, found %q", expected, output)
+	}
+
+	// Another index does not see the checkpoints
+	if output := run(0); output != "lmp -in in.lj" {
+		t.Errorf("expected index 0 to start from scratch, found %q", output)
+	}
+}
+
+func TestCheckpointValidate(t *testing.T) {
+	for _, checkpoint := range []api.Checkpoint{
+		{RestartFlags: "-restart {{.Checkpoint}}"},
+		{ClaimName: "c", Path: "relative"},
+		{ClaimName: "c", Path: "/metrics_operator/checkpoints"},
+		{ClaimName: "c", Path: "/data/$(reboot)"},
+		{ClaimName: "c", Pattern: "a/*"},
+		{ClaimName: "c", Pattern: "a b"},
+	} {
+		spec := &api.MetricSet{Spec: api.MetricSetSpec{
+			Pods:    1,
+			Metrics: []api.Metric{{Name: "app-lammps", Checkpoint: checkpoint}},
+		}}
+		if spec.Validate() {
+			t.Errorf("expected checkpoint %+v to not validate", checkpoint)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// Kubernetes limits a ConfigMap to 1MiB, and we leave room for metadata
+const maxConfigMapData = 900 * 1024
+
+// Entrypoints at least this size are compressed, when requested. Smaller ones
+// are kept readable (e.g., with kubectl), since they save little.
+const compressEntrypointSize = 16 * 1024
+
+// ErrEntrypointTooLarge is returned when a single entrypoint does not fit in a config map
+var ErrEntrypointTooLarge = errors.New("entrypoint too large")
+
+// ConfigMapShard is one of the config maps that hold the MetricSet entrypoints
+type ConfigMapShard struct {
+	Name string
+	Data map[string]string
+}
+
+// GetConfigMapShards splits entrypoint data across config maps under the size limit.
+// The first shard is named for the MetricSet, so most sets have exactly one config map.
+// Entries are packed largest first (by size, then key) into the first shard with room,
+// so there are as few config maps (and API writes) as we can, the same across reconciles.
+func GetConfigMapShards(set *api.MetricSet, containerSpecs []*specs.ContainerSpec) ([]ConfigMapShard, error) {
+	data := map[string]string{}
+	for _, cs := range containerSpecs {
+		script, err := getEntrypointData(set, cs)
+		if err != nil {
+			return nil, err
+		}
+		data[cs.EntrypointScript.Name] = script
+	}
+	keys := []string{}
+	for key := range data {
+		keys = append(keys, key)
+	}
+	size := func(key string) int {
+		return len(key) + len(data[key])
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if size(keys[i]) != size(keys[j]) {
+			return size(keys[i]) > size(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	shards := []ConfigMapShard{{Name: set.Name, Data: map[string]string{}}}
+	sizes := []int{0}
+	for _, key := range keys {
+		entry := size(key)
+		if entry > maxConfigMapData {
+			return shards, fmt.Errorf("%w: %s is %d bytes", ErrEntrypointTooLarge, key, entry)
+		}
+		index := -1
+		for i := range shards {
+			if sizes[i]+entry <= maxConfigMapData {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			shards = append(shards, ConfigMapShard{
+				Name: fmt.Sprintf("%s-%d", set.Name, len(shards)),
+				Data: map[string]string{},
+			})
+			sizes = append(sizes, 0)
+			index = len(shards) - 1
+		}
+		shards[index].Data[key] = data[key]
+		sizes[index] += entry
+	}
+	return shards, nil
+}
+
+// getEntrypointData is the config map data for an entrypoint, compressed if
+// requested and it is large. Verbatim content (e.g., inputs) is read by the
+// metric as is, and PowerShell entrypoints are not decoded, so they are kept.
+func getEntrypointData(set *api.MetricSet, cs *specs.ContainerSpec) (string, error) {
+	script := cs.EntrypointScript.WriteScript()
+	entrypoint := cs.EntrypointScript
+	if !set.Spec.CompressEntrypoints || entrypoint.Verbatim || entrypoint.PowerShell || len(script) < compressEntrypointSize {
+		return script, nil
+	}
+	return specs.CompressScript(script, cs.ShellPath())
+}
+
+// shardOperatorVolumes replaces the metrics operator config map volume with a
+// projected volume across shards, so the entrypoints are still in one directory
+func shardOperatorVolumes(set *api.MetricSet, rjs []jobset.ReplicatedJob, shards []ConfigMapShard) {
+	if len(shards) < 2 {
+		return
+	}
+	logger.Infof("🟪️ Entrypoints for %s are split across %d config maps", set.Name, len(shards))
+
+	lookup := map[string]string{}
+	for _, shard := range shards {
+		for key := range shard.Data {
+			lookup[key] = shard.Name
+		}
+	}
+	for i := range rjs {
+		volumes := rjs[i].Template.Spec.Template.Spec.Volumes
+		for j, volume := range volumes {
+			if volume.Name != set.Name || volume.ConfigMap == nil {
+				continue
+			}
+
+			// Keys we don't know about are left in the first config map
+			items := map[string][]corev1.KeyToPath{}
+			for _, item := range volume.ConfigMap.Items {
+				name, ok := lookup[item.Key]
+				if !ok {
+					name = set.Name
+				}
+				items[name] = append(items[name], item)
+			}
+			sources := []corev1.VolumeProjection{}
+			for _, shard := range shards {
+				if len(items[shard.Name]) == 0 {
+					continue
+				}
+				sources = append(sources, corev1.VolumeProjection{
+					ConfigMap: &corev1.ConfigMapProjection{
+						LocalObjectReference: corev1.LocalObjectReference{Name: shard.Name},
+						Items:                items[shard.Name],
+					},
+				})
+			}
+			volumes[j].VolumeSource = corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{Sources: sources},
+			}
+		}
+	}
+}
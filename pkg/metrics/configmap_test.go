@@ -0,0 +1,148 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// entrypoint is a verbatim container spec of a size (less the key)
+func entrypoint(name string, size int) *specs.ContainerSpec {
+	return &specs.ContainerSpec{
+		EntrypointScript: specs.EntrypointScript{
+			Name:     name,
+			Pre:      strings.Repeat("x", size-len(name)),
+			Verbatim: true,
+		},
+	}
+}
+
+func TestGetConfigMapShards(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "pack"}}
+
+	// Taken in order, each would need its own config map, but largest first two fit
+	cs := []*specs.ContainerSpec{
+		entrypoint("a", 400*1024),
+		entrypoint("b", 600*1024),
+		entrypoint("c", 500*1024),
+	}
+	shards, err := GetConfigMapShards(set, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shards) != 2 || shards[0].Name != "pack" || shards[1].Name != "pack-1" {
+		t.Fatalf("expected two config maps, found %d", len(shards))
+	}
+	if _, ok := shards[1].Data["a"]; !ok {
+		t.Errorf("expected the smallest entrypoint to fill the second config map")
+	}
+
+	// One entrypoint larger than a config map is an error
+	_, err = GetConfigMapShards(set, []*specs.ContainerSpec{entrypoint("huge", maxConfigMapData+1)})
+	if err == nil {
+		t.Error("expected an entrypoint larger than a config map to fail")
+	}
+}
+
+func TestShardOperatorVolumes(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "pack"}}
+	cs := []*specs.ContainerSpec{
+		entrypoint("a", 400*1024),
+		entrypoint("b", 600*1024),
+		entrypoint("c", 500*1024),
+	}
+	volume := func() corev1.Volume {
+		items := []corev1.KeyToPath{}
+		for _, key := range []string{"a", "b", "c", "unknown"} {
+			items = append(items, corev1.KeyToPath{Key: key, Path: key + ".sh", Mode: &makeExecutable})
+		}
+		return corev1.Volume{Name: "pack", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "pack"},
+				Items:                items,
+			},
+		}}
+	}
+	rjs := []jobset.ReplicatedJob{{Name: "l"}, {Name: "w"}}
+	for i := range rjs {
+		rjs[i].Template.Spec.Template.Spec.Volumes = []corev1.Volume{volume(), {Name: "scratch"}}
+	}
+
+	// Below the limit, the config map volume is left as is
+	shards, err := GetConfigMapShards(set, cs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	shardOperatorVolumes(set, rjs, shards)
+	if rjs[0].Template.Spec.Template.Spec.Volumes[0].ConfigMap == nil {
+		t.Fatal("expected one config map to not be projected")
+	}
+
+	// Above it, each job projects the items from the config map that has them
+	shards, err = GetConfigMapShards(set, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shardOperatorVolumes(set, rjs, shards)
+	for _, rj := range rjs {
+		volumes := rj.Template.Spec.Template.Spec.Volumes
+		if len(volumes) != 2 || volumes[0].Name != "pack" || volumes[0].ConfigMap != nil || volumes[0].Projected == nil {
+			t.Fatalf("expected a projected volume in place of the config map for %s, found %v", rj.Name, volumes)
+		}
+		layout := map[string][]string{}
+		for _, source := range volumes[0].Projected.Sources {
+			for _, item := range source.ConfigMap.Items {
+				if item.Mode == nil || *item.Mode != makeExecutable || item.Path != item.Key+".sh" {
+					t.Errorf("expected item %s to keep its path and mode", item.Key)
+				}
+				layout[source.ConfigMap.Name] = append(layout[source.ConfigMap.Name], item.Key)
+			}
+		}
+		// Keys we don't know about stay in the first config map
+		if len(layout) != 2 || strings.Join(layout["pack"], ",") != "b,unknown" || strings.Join(layout["pack-1"], ",") != "a,c" {
+			t.Errorf("expected b (and unknown) in pack and a, c in pack-1, found %v", layout)
+		}
+	}
+}
+
+func TestCompressEntrypoints(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "compress"}}
+	large := strings.Repeat("echo a large entrypoint\n", 2000)
+	cs := []*specs.ContainerSpec{
+		{EntrypointScript: specs.EntrypointScript{Name: "large", Command: large}},
+		{EntrypointScript: specs.EntrypointScript{Name: "small", Command: "echo small"}},
+		{EntrypointScript: specs.EntrypointScript{Name: "input", Pre: large, Verbatim: true}},
+	}
+	shards, err := GetConfigMapShards(set, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(shards[0].Data["large"], "METRICS_OPERATOR_GZIP") {
+		t.Error("expected entrypoints to not be compressed unless requested")
+	}
+
+	set.Spec.CompressEntrypoints = true
+	shards, err = GetConfigMapShards(set, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := shards[0].Data
+	if !strings.Contains(data["large"], "METRICS_OPERATOR_GZIP") || len(data["large"]) >= len(large) {
+		t.Errorf("expected the large entrypoint to be compressed, found %d bytes", len(data["large"]))
+	}
+	if strings.Contains(data["small"], "METRICS_OPERATOR_GZIP") || data["input"] != large {
+		t.Error("expected small entrypoints and inputs to be kept as is")
+	}
+}
@@ -8,17 +8,23 @@ SPDX-License-Identifier: MIT
 package metrics
 
 import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/config"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
 
 // Security context defaults
 var (
-	capAdmin  = corev1.Capability("SYS_ADMIN")
-	capPtrace = corev1.Capability("SYS_PTRACE")
+	capAdmin   = corev1.Capability("SYS_ADMIN")
+	capPtrace  = corev1.Capability("SYS_PTRACE")
+	capPerfmon = corev1.Capability("PERFMON")
 )
 
 // getReplicatedJobContainers gets containers (sidecar and init)
@@ -26,6 +32,8 @@ var (
 func getReplicatedJobContainers(
 	set *api.MetricSet,
 	rj *jobset.ReplicatedJob,
+	offset int32,
+	pods int32,
 	containerSpecs []specs.ContainerSpec,
 	volumes []specs.VolumeSpec,
 ) ([]corev1.Container, []corev1.Container, error) {
@@ -37,16 +45,13 @@ func getReplicatedJobContainers(
 	// Assume we can pull once for now, this could be changed to allow pull always
 	pullPolicy := corev1.PullIfNotPresent
 
-	// Currently we share the same mounts across containers, makes life easier!
-	mounts := getVolumeMounts(set, volumes)
-
 	// Keep track of any specs that have privileged, then the app needs it
 	hasPrivileged := false
 
 	// Each needs to have the sys trace capability to see the application pids
 	for _, cs := range containerSpecs {
 
-		logger.Infof("Checking container spec %s", cs)
+		logger.Debugf("Checking container spec %s for job %s", cs.Name, rj.Name)
 
 		// Skip containers not intended for the replicated job
 		if cs.JobName != "" && cs.JobName != rj.Name {
@@ -59,35 +64,31 @@ func getReplicatedJobContainers(
 		}
 
 		// If a command is provided, use it first
-		command := []string{"/bin/bash", cs.EntrypointScript.Path}
+		command := cs.EntrypointCommand()
 		if len(cs.Command) > 0 {
 			command = cs.Command
 		}
+		// Volumes can be targeted to a specific job or container
+		mounts := getVolumeMounts(set, volumes, rj.Name, cs.Name)
+		if warning := checkScratchNeeds(&cs, volumes, mounts, resources); warning != "" {
+			logger.Warnf("🟧️ %s", warning)
+		}
+
 		// Create the actual container from the spec
 		newContainer := corev1.Container{
 			Name:            cs.Name,
-			Image:           cs.Image,
+			Image:           config.Mirror(cs.Image),
 			ImagePullPolicy: pullPolicy,
 			VolumeMounts:    mounts,
 			Stdin:           true,
 			TTY:             true,
 			Command:         command,
-			SecurityContext: &corev1.SecurityContext{
-				Privileged: &cs.Attributes.SecurityContext.Privileged,
-			},
-		}
-
-		// Add capabilities to the security context
-		caps := []corev1.Capability{}
+			SecurityContext: getSecurityContext(set, &cs),
 
-		// Should we allow sharing the process namespace?
-		if cs.Attributes.SecurityContext.AllowPtrace {
-			caps = append(caps, capPtrace)
+			// A container killed before the entrypoint writes a message (e.g., out of
+			// memory) gets the end of its log, for the failure summary in the status
+			TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
 		}
-		if cs.Attributes.SecurityContext.AllowAdmin {
-			caps = append(caps, capAdmin)
-		}
-		newContainer.SecurityContext.Capabilities = &corev1.Capabilities{Add: caps}
 
 		// Only add the working directory if it's defined
 		if cs.WorkingDir != "" {
@@ -96,11 +97,22 @@ func getReplicatedJobContainers(
 
 		// Ports and environment (add when needed)
 		ports := []corev1.ContainerPort{}
-		envars := []corev1.EnvVar{}
+		envars := getRankEnvironment(set, rj, offset, pods)
+		envars = append(envars, cs.Env...)
 		newContainer.Ports = ports
 		newContainer.Env = envars
 		newContainer.Resources = resources
 
+		// Probes are only added when defined
+		newContainer.ReadinessProbe = getProbe(&cs.Attributes.Probes.Readiness, cs.ShellPath())
+		newContainer.LivenessProbe = getProbe(&cs.Attributes.Probes.Liveness, cs.ShellPath())
+		newContainer.StartupProbe = getProbe(&cs.Attributes.Probes.Startup, cs.ShellPath())
+
+		// In debug mode, the container is ready while it waits to be released
+		if cs.Debug && newContainer.ReadinessProbe == nil {
+			newContainer.ReadinessProbe = getDebugProbe()
+		}
+
 		// Add as an init container, or a sidecar container
 		if cs.InitContainer {
 			initContainers = append(initContainers, newContainer)
@@ -109,7 +121,96 @@ func getReplicatedJobContainers(
 			containers = append(containers, newContainer)
 		}
 	}
-	logger.Infof("🟪️ Adding %d init containers\n", len(initContainers))
-	logger.Infof("🟪️ Adding %d containers\n", len(containers))
+	logger.Debugf("🟪️ Adding %d init containers", len(initContainers))
+	logger.Debugf("🟪️ Adding %d containers", len(containers))
 	return containers, initContainers, nil
 }
+
+// getRankEnvironment exposes the pod index, total pods, and the offset of the
+// replicated job so entrypoints can compute a global rank
+func getRankEnvironment(
+	set *api.MetricSet,
+	rj *jobset.ReplicatedJob,
+	offset int32,
+	pods int32,
+) []corev1.EnvVar {
+	jobPods := int32(1)
+	if rj.Template.Spec.Parallelism != nil {
+		jobPods = *rj.Template.Spec.Parallelism
+	}
+	env := []corev1.EnvVar{
+		{
+			Name: "JOB_COMPLETION_INDEX",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{
+					FieldPath: fmt.Sprintf("metadata.annotations['%s']", batchv1.JobCompletionIndexAnnotation),
+				},
+			},
+		},
+		{Name: "METRICS_OPERATOR_PODS", Value: fmt.Sprintf("%d", pods)},
+		{Name: "METRICS_OPERATOR_JOB_NAME", Value: rj.Name},
+		{Name: "METRICS_OPERATOR_JOB_PODS", Value: fmt.Sprintf("%d", jobPods)},
+		{Name: "METRICS_OPERATOR_JOB_OFFSET", Value: fmt.Sprintf("%d", offset)},
+	}
+	env = append(env, getResultsEnvironment(set)...)
+	env = append(env, getPhaseEnvironment(set)...)
+	env = append(env, getPerfEnvironment(set)...)
+	return append(env, getAutoscalerEnvironment(set)...)
+}
+
+// getSecretEnvironment exposes keys of secrets to the metric containers, so
+// commands can reference them instead of including the values
+func getSecretEnvironment(metric api.Metric) []corev1.EnvVar {
+	env := []corev1.EnvVar{}
+	for _, secret := range metric.Secrets {
+		env = append(env, corev1.EnvVar{
+			Name: secret.Name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secret.SecretName},
+					Key:                  secret.Key,
+				},
+			},
+		})
+	}
+	return env
+}
+
+// getDebugProbe is ready when the command is waiting to be released
+func getDebugProbe() *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"cat", specs.DebugWaitingFile}},
+		},
+		PeriodSeconds: 5,
+	}
+}
+
+// getProbe converts a probe from the spec into a container probe
+// A command takes precedence, then an http path (with port), then a tcp port
+func getProbe(probe *api.Probe, shell string) *corev1.Probe {
+	if probe.IsEmpty() {
+		return nil
+	}
+	handler := corev1.ProbeHandler{}
+	if probe.Command != "" {
+		handler.Exec = &corev1.ExecAction{
+			Command: []string{shell, "-c", probe.Command},
+		}
+	} else if probe.Path != "" {
+		handler.HTTPGet = &corev1.HTTPGetAction{
+			Path: probe.Path,
+			Port: intstr.FromInt(int(probe.Port)),
+		}
+	} else {
+		handler.TCPSocket = &corev1.TCPSocketAction{
+			Port: intstr.FromInt(int(probe.Port)),
+		}
+	}
+	return &corev1.Probe{
+		ProbeHandler:        handler,
+		InitialDelaySeconds: probe.InitialDelaySeconds,
+		PeriodSeconds:       probe.PeriodSeconds,
+		FailureThreshold:    probe.FailureThreshold,
+	}
+}
@@ -0,0 +1,22 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package db
+
+import (
+	"github.com/converged-computing/metrics-operator/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Consistent logging identifiers that should be echoed to have newline after
+var (
+	logger *zap.SugaredLogger
+)
+
+func init() {
+	logger = logging.NewLogger("db")
+}
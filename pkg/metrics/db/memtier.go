@@ -0,0 +1,253 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// memtier_benchmark is a load generator for redis and memcached
+// https://github.com/RedisLabs/memtier_benchmark
+
+const (
+	memtierIdentifier = "db-memtier"
+	memtierSummary    = "redis or memcached throughput and latency with memtier_benchmark"
+	memtierContainer  = "redislabs/memtier_benchmark:latest"
+)
+
+// Server image, port, and command for each protocol
+var memtierServers = map[string]struct {
+	image, command string
+	port           int32
+}{
+	"redis":           {"redis:7", "redis-server --protected-mode no --save '' --port %d", 6379},
+	"memcache_text":   {"memcached:1.6", "memcached -u root -m 1024 -p %d", 11211},
+	"memcache_binary": {"memcached:1.6", "memcached -u root -m 1024 -p %d", 11211},
+}
+
+// Memtier runs a server (one pod) and memtier_benchmark clients (the rest of the pods)
+type Memtier struct {
+	metrics.LauncherWorker
+
+	// Server
+	protocol    string
+	serverImage string
+	port        int32
+
+	// Client options
+	ratio    string
+	dataSize int32
+	pipeline int32
+	clients  int32
+	threads  int32
+	requests int32
+}
+
+func (m Memtier) Url() string {
+	return "https://github.com/RedisLabs/memtier_benchmark"
+}
+
+func (m Memtier) Family() string {
+	return metrics.DatabaseFamily
+}
+
+// The benchmark is done when the clients finish (the server runs until then)
+func (m *Memtier) SuccessJobs() []string {
+	return []string{m.WorkerLetter}
+}
+
+// Set custom options / attributes for the metric
+func (m *Memtier) SetOptions(metric *api.Metric) {
+
+	m.Identifier = memtierIdentifier
+	m.Summary = memtierSummary
+	m.Container = memtierContainer
+
+	// The launcher is the server, and workers are clients
+	m.LauncherLetter = "s"
+	m.LauncherContainer = "server"
+	m.LauncherScript = "/metrics_operator/server.sh"
+	m.WorkerLetter = "c"
+	m.WorkerContainer = "client"
+	m.WorkerScript = "/metrics_operator/client.sh"
+
+	// memtier_benchmark defaults
+	m.protocol = "redis"
+	m.ratio = "1:10"
+	m.dataSize = 32
+	m.pipeline = 1
+	m.clients = 50
+	m.threads = 4
+	m.requests = 10000
+
+	for key, value := range map[string]*string{
+		"protocol":    &m.protocol,
+		"serverImage": &m.serverImage,
+		"ratio":       &m.ratio,
+	} {
+		v, ok := metric.Options[key]
+		if ok {
+			*value = v.StrVal
+		}
+	}
+	for key, value := range map[string]*int32{
+		"port":     &m.port,
+		"dataSize": &m.dataSize,
+		"pipeline": &m.pipeline,
+		"clients":  &m.clients,
+		"threads":  &m.threads,
+		"requests": &m.requests,
+	} {
+		v, ok := metric.Options[key]
+		if ok {
+			*value = v.IntVal
+		}
+	}
+
+	// The server image and port depend on the protocol
+	server, ok := memtierServers[m.protocol]
+	if ok {
+		if m.serverImage == "" {
+			m.serverImage = server.image
+		}
+		if m.port == 0 {
+			m.port = server.port
+		}
+	}
+	m.SetDefaultOptions(metric)
+}
+
+// Validate the protocol, and that we have a server and at least one client
+func (m Memtier) Validate(spec *api.MetricSet) bool {
+	_, ok := memtierServers[m.protocol]
+	if !ok {
+		logger.Errorf("🟥️ The db-memtier protocol must be redis, memcache_text, or memcache_binary, found %s", m.protocol)
+		return false
+	}
+	if m.TotalPods(spec) < 2 {
+		logger.Errorf("🟥️ The db-memtier metric requires 2+ pods (one server, and one or more clients)")
+		return false
+	}
+	if m.clients < 1 || m.threads < 1 || m.pipeline < 1 || m.requests < 1 || m.dataSize < 1 {
+		logger.Errorf("🟥️ The db-memtier clients, threads, pipeline, requests, and dataSize must be 1 or greater")
+		return false
+	}
+	return true
+}
+
+// Exported options and list options
+func (m Memtier) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"protocol":    intstr.FromString(m.protocol),
+		"serverImage": intstr.FromString(m.serverImage),
+		"port":        intstr.FromInt(int(m.port)),
+		"ratio":       intstr.FromString(m.ratio),
+		"dataSize":    intstr.FromInt(int(m.dataSize)),
+		"pipeline":    intstr.FromInt(int(m.pipeline)),
+		"clients":     intstr.FromInt(int(m.clients)),
+		"threads":     intstr.FromInt(int(m.threads)),
+		"requests":    intstr.FromInt(int(m.requests)),
+	}
+}
+
+// memtierContext is for the templates of the client
+type memtierContext struct {
+	Metadata    string
+	Server      string
+	Port        int32
+	Interactive bool
+}
+
+var (
+	// memtierPreTemplate waits for the server
+	memtierPreTemplate = specs.NewTemplate(memtierIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+echo "Waiting for the server at {{ .Server }}:{{ .Port }}..."
+mo_wait_for_port {{ .Port }} {{ .Server }}
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+`, memtierContext{})
+
+	// memtierPostTemplate prints the results, and ends the collection
+	memtierPostTemplate = specs.NewTemplate(memtierIdentifier+"-post", `
+echo "{{ separator }}"
+cat ${METRICS_OPERATOR_RESULTS}/memtier.json
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, memtierContext{})
+)
+
+// Prepare containers for the server and clients
+func (m Memtier) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+	server := fmt.Sprintf("%s-%s-0-0.%s.%s.svc.cluster.local",
+		spec.Name, m.LauncherLetter, spec.Subdomain(), spec.Namespace,
+	)
+
+	// The server runs until the clients are done
+	serverEntrypoint := specs.EntrypointScript{
+		Name:    specs.DeriveScriptKey(m.LauncherScript),
+		Path:    m.LauncherScript,
+		Pre:     fmt.Sprintf("#!/bin/bash\necho \"%s\"\n", meta),
+		Command: fmt.Sprintf(memtierServers[m.protocol].command, m.port),
+	}
+
+	command := []string{
+		"memtier_benchmark",
+		fmt.Sprintf("--server %s --port %d --protocol %s", server, m.port, m.protocol),
+		fmt.Sprintf("--ratio %s --data-size %d --pipeline %d", m.ratio, m.dataSize, m.pipeline),
+		fmt.Sprintf("--clients %d --threads %d --requests %d", m.clients, m.threads, m.requests),
+		"--print-percentiles 50,90,99,99.9 --hide-histogram",
+		"--json-out-file ${METRICS_OPERATOR_RESULTS}/memtier.json",
+	}
+
+	context := memtierContext{
+		Metadata:    meta,
+		Server:      server,
+		Port:        m.port,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	preBlock := memtierPreTemplate.Render(context)
+	postBlock := memtierPostTemplate.Render(context)
+
+	clientEntrypoint := specs.EntrypointScript{
+		Name:    specs.DeriveScriptKey(m.WorkerScript),
+		Path:    m.WorkerScript,
+		Pre:     preBlock,
+		Command: strings.Join(command, " "),
+		Post:    postBlock,
+	}
+
+	serverContainer := m.GetLauncherContainerSpec(serverEntrypoint)
+	serverContainer.Image = m.serverImage
+	clientContainer := m.GetWorkerContainerSpec(clientEntrypoint)
+	return []*specs.ContainerSpec{&serverContainer, &clientContainer}
+}
+
+func init() {
+	base := metrics.BaseMetric{
+		Identifier: memtierIdentifier,
+		Summary:    memtierSummary,
+		Container:  memtierContainer,
+	}
+	launcher := metrics.LauncherWorker{BaseMetric: base}
+	memtier := Memtier{LauncherWorker: launcher}
+	metrics.Register(&memtier)
+}
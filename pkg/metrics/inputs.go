@@ -0,0 +1,81 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// Input files are mounted alongside the entrypoints, in a directory per metric
+const inputsRoot = "/metrics_operator/inputs"
+
+// Template keys replace characters that are not valid in an identifier, e.g., in.lj is in_lj
+var inputKeyRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// getInputs returns specs for the metric input files (to write to the config map)
+// along with a lookup of input name (and template key) to path, for template variables
+func getInputs(set *api.MetricSet, metricName string) ([]*specs.ContainerSpec, map[string]string) {
+	inputs := []*specs.ContainerSpec{}
+	paths := map[string]string{}
+	for _, metric := range set.ExpandedMetrics() {
+		if metric.Key() != metricName {
+			continue
+		}
+		names := []string{}
+		for name := range metric.Inputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			path := filepath.Join(inputsRoot, metricName, name)
+			paths[name] = path
+			paths[inputKeyRegex.ReplaceAllString(name, "_")] = path
+			inputs = append(inputs, &specs.ContainerSpec{
+				EntrypointScript: specs.EntrypointScript{
+					Name:     fmt.Sprintf("%s-input-%s", metricName, name),
+					Path:     path,
+					Pre:      metric.Inputs[name],
+					Verbatim: true,
+				},
+			})
+		}
+	}
+	return inputs, paths
+}
+
+// addOperatorFiles adds files (e.g., inputs) to the metrics operator config map volume
+func addOperatorFiles(
+	set *api.MetricSet,
+	rjs []*jobset.ReplicatedJob,
+	files []*specs.ContainerSpec,
+) {
+	for _, rj := range rjs {
+		volumes := rj.Template.Spec.Template.Spec.Volumes
+		for i, volume := range volumes {
+			if volume.Name != set.Name || volume.ConfigMap == nil {
+				continue
+			}
+			for _, file := range files {
+				path, _ := filepath.Rel("/metrics_operator", file.EntrypointScript.Path)
+				item := corev1.KeyToPath{
+					Key:  file.EntrypointScript.Name,
+					Path: path,
+				}
+				volumes[i].ConfigMap.Items = append(volumes[i].ConfigMap.Items, item)
+			}
+		}
+	}
+}
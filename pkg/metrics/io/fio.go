@@ -9,11 +9,13 @@ package io
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
@@ -104,11 +106,54 @@ func (m *Fio) SetOptions(metric *api.Metric) {
 	}
 }
 
+// fioContext is for the templates of the storage container (on Linux or Windows)
+type fioContext struct {
+	Metadata    string
+	Directory   string
+	Pre         string
+	Command     string
+	Post        string
+	Prefix      string
+	Interactive bool
+}
+
+var (
+	// fioPreTemplate derives the filename, and runs the pre command
+	fioPreTemplate = specs.NewTemplate(fioIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+# Directory (and filename) for test assuming other storage mounts
+filename={{ .Directory }}/test-$(cat /dev/urandom | tr -cd 'a-f0-9' | head -c 32)
+# Run the pre-command here so it has access to the filename.
+{{ .Pre }}
+command="{{ .Command }}"
+echo "FIO COMMAND START"
+echo $command
+echo "FIO COMMAND END"
+# FIO just has one command, we don't need to think about completions / etc!
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+`, fioContext{})
+
+	// fioPostTemplate runs the post command, and removes the file
+	fioPostTemplate = specs.NewTemplate(fioIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+# Run command here so it's after collection finish, but before removing the filename
+{{ .Post }} 
+{{ .Prefix }} rm -rf $filename
+{{ interactive .Interactive }}	
+`, fioContext{})
+)
+
 func (m Fio) PrepareContainers(
 	spec *api.MetricSet,
 	metric *metrics.Metric,
 ) []*specs.ContainerSpec {
 
+	// Windows nodes get a PowerShell entrypoint
+	if spec.IsWindows() {
+		return m.prepareWindowsContainers(spec, metric)
+	}
+
 	// Metadata to add to beginning of run
 	meta := metrics.Metadata(spec, metric)
 
@@ -127,47 +172,123 @@ func (m Fio) PrepareContainers(
 		command = m.command
 	}
 
-	preBlock := `#!/bin/bash
-echo "%s"
+	context := fioContext{
+		Metadata:    meta,
+		Directory:   m.directory,
+		Pre:         m.pre,
+		Command:     command,
+		Post:        m.post,
+		Prefix:      m.prefix,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	preBlock := fioPreTemplate.Render(context)
+	postBlock := fioPostTemplate.Render(context)
+	return m.StorageContainerSpec(preBlock, "$command", postBlock)
+}
+
+var (
+	// fioWindowsPreTemplate derives the filename, and runs the pre command (in PowerShell)
+	fioWindowsPreTemplate = specs.NewTemplate(fioIdentifier+"-windows", `{{ .Metadata }}
 # Directory (and filename) for test assuming other storage mounts
-filename=%s/test-$(cat /dev/urandom | tr -cd 'a-f0-9' | head -c 32)
+New-Item -ItemType Directory -Force -Path "{{ .Directory }}" | Out-Null
+$filename = Join-Path "{{ .Directory }}" "test-$([guid]::NewGuid().ToString('N'))"
 # Run the pre-command here so it has access to the filename.
-%s
-command="%s"
-echo "FIO COMMAND START"
-echo $command
-echo "FIO COMMAND END"
-# FIO just has one command, we don't need to think about completions / etc!
-echo "%s"
-echo "%s"
-`
-	preBlock = fmt.Sprintf(
-		preBlock,
-		meta,
-		m.directory,
-		m.pre,
-		command,
-		metadata.CollectionStart,
-		metadata.Separator,
-	)
+{{ .Pre }}
+$command = "{{ .Command }}"
+Write-Output "FIO COMMAND START"
+Write-Output $command
+Write-Output "FIO COMMAND END"
+Write-Output "{{ collectionStart }}"
+Write-Output "{{ separator }}"
+`, fioContext{})
 
-	postBlock := `
-echo "%s"
+	// fioWindowsPostTemplate runs the post command, and removes the file
+	fioWindowsPostTemplate = specs.NewTemplate(fioIdentifier+"-windows-post", `
+echo "{{ collectionEnd }}"
 # Run command here so it's after collection finish, but before removing the filename
-%s 
-%s rm -rf $filename
-%s	
-`
-
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	postBlock = fmt.Sprintf(
-		postBlock,
-		metadata.CollectionEnd,
-		m.post,
+{{ .Post }}
+Remove-Item -Force -ErrorAction SilentlyContinue $filename
+{{ if .Interactive }}while ($true) { Start-Sleep -Seconds 3600 }{{ end }}
+`, fioContext{})
+)
+
+// prepareWindowsContainers is the same test with PowerShell. Fio on Windows
+// uses the windowsaio engine, and requires threads (there is no fork)
+func (m Fio) prepareWindowsContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	meta := metrics.PowerShellMetadata(spec, metric)
+	command := "%s fio --randrepeat=1 --ioengine=windowsaio --thread --direct=1 --gtod_reduce=1 --name=%s --bs=%s --iodepth=%d --readwrite=randrw --rwmixread=75 --size=%s --filename=$filename --output-format=json"
+	command = fmt.Sprintf(
+		command,
 		m.prefix,
-		interactive,
+		m.testname,
+		m.blocksize,
+		m.iodepth,
+		m.size,
 	)
-	return m.StorageContainerSpec(preBlock, "$command", postBlock)
+	if m.command != "" {
+		command = m.command
+	}
+
+	context := fioContext{
+		Metadata:    meta,
+		Directory:   m.directory,
+		Pre:         m.pre,
+		Command:     command,
+		Post:        m.post,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	preBlock := fioWindowsPreTemplate.Render(context)
+	postBlock := fioWindowsPostTemplate.Render(context)
+	return m.StorageContainerSpec(preBlock, "Invoke-Expression $command", postBlock)
+}
+
+// Fio has a PowerShell entrypoint for Windows nodes
+func (m Fio) SupportsWindows() bool {
+	return true
+}
+
+// ScratchNeeds is the test file fio writes in the directory (unless the
+// command is custom, and we don't know)
+func (m Fio) ScratchNeeds() *specs.ScratchNeeds {
+	if m.command != "" {
+		return nil
+	}
+	size, ok := fioQuantity(m.size)
+	if !ok {
+		return nil
+	}
+	return &specs.ScratchNeeds{Path: m.directory, Size: size}
+}
+
+// fio sizes are in base 1024 by default (e.g., 4G is 4Gi), and can be a
+// percentage of the device (which we can't know)
+var fioSizeRegex = regexp.MustCompile(`^([0-9]+)\s*([kKmMgGtTpP]?)(?:i?[bB])?$`)
+
+// fioQuantity converts a fio size to a quantity
+func fioQuantity(size string) (resource.Quantity, bool) {
+	match := fioSizeRegex.FindStringSubmatch(strings.TrimSpace(size))
+	if match == nil {
+		return resource.Quantity{}, false
+	}
+	suffix := strings.ToUpper(match[2])
+	if suffix != "" {
+		suffix += "i"
+	}
+	quantity, err := resource.ParseQuantity(match[1] + suffix)
+	return quantity, err == nil
+}
+
+// Validate that Windows runs use a Windows build of fio
+func (m Fio) Validate(spec *api.MetricSet) bool {
+	if spec.IsWindows() && m.Container == fioContainer {
+		logger.Errorf("🟥️ The io-fio metric on Windows requires an image with a Windows build of fio")
+		return false
+	}
+	return m.StorageGeneric.Validate(spec)
 }
 
 // Exported options and list options
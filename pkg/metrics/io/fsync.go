@@ -0,0 +1,230 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package io
+
+import (
+	"fmt"
+	"strconv"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// Fsync latency is the write-ahead log pattern of etcd (and raft, and many
+// databases): small sequential writes each followed by fdatasync. etcd needs
+// the 99th percentile under 10ms for a disk to be good enough.
+// https://etcd.io/docs/v3.5/op-guide/hardware/#disks
+
+const (
+	fsyncIdentifier = "io-fsync"
+	fsyncSummary    = "disk fsync latency for control-plane and database hosts"
+	fsyncContainer  = fioContainer
+)
+
+type Fsync struct {
+	metrics.StorageGeneric
+
+	// Options
+	blocksize string
+	size      string
+	directory string
+
+	// 99th percentile fsync latency (milliseconds) for a node to qualify
+	threshold int32
+
+	// Or just define the entire command
+	command string
+
+	// extra commands for pre, post, etc.
+	pre    string
+	post   string
+	prefix string
+}
+
+func (m Fsync) Url() string {
+	return "https://etcd.io/docs/v3.5/op-guide/hardware/#disks"
+}
+
+// Each pod is on its own node by default, so the latency is of the node
+func (m Fsync) HasSoleTenancy() bool {
+	return m.SoleTenancy
+}
+
+// Set custom options / attributes for the metric
+func (m *Fsync) SetOptions(metric *api.Metric) {
+	m.ResourceSpec = &metric.Resources
+	m.AttributeSpec = &metric.Attributes
+
+	m.Identifier = fsyncIdentifier
+	m.Summary = fsyncSummary
+	m.Container = fsyncContainer
+	m.SoleTenancy = true
+
+	// The defaults are those etcd recommends for the write-ahead log
+	m.blocksize = "2300"
+	m.size = "22m"
+	m.directory = "/tmp"
+	m.threshold = 10
+
+	st, ok := metric.Options["soleTenancy"]
+	if ok && (st.StrVal == "false" || st.StrVal == "no") {
+		m.SoleTenancy = false
+	}
+	for key, value := range map[string]*string{
+		"blocksize": &m.blocksize,
+		"size":      &m.size,
+		"directory": &m.directory,
+		"command":   &m.command,
+		"pre":       &m.pre,
+		"post":      &m.post,
+		"prefix":    &m.prefix,
+	} {
+		v, ok := metric.Options[key]
+		if ok {
+			*value = v.String()
+		}
+	}
+	v, ok := metric.Options["threshold"]
+	if ok {
+		m.threshold = v.IntVal
+	}
+}
+
+// Validate the threshold, and that the size is one fio understands
+func (m Fsync) Validate(spec *api.MetricSet) bool {
+	if m.threshold < 1 {
+		logger.Errorf("🟥️ The io-fsync threshold must be 1 or more milliseconds")
+		return false
+	}
+	if _, ok := fioQuantity(m.size); !ok && m.command == "" {
+		logger.Errorf("🟥️ The io-fsync size %s is not a size fio understands", m.size)
+		return false
+	}
+	return m.StorageGeneric.Validate(spec)
+}
+
+// ScratchNeeds is the file fio writes in the directory
+func (m Fsync) ScratchNeeds() *specs.ScratchNeeds {
+	if m.command != "" {
+		return nil
+	}
+	size, ok := fioQuantity(m.size)
+	if !ok {
+		return nil
+	}
+	return &specs.ScratchNeeds{Path: m.directory, Size: size}
+}
+
+// fsyncContext is for the templates of the storage container
+type fsyncContext struct {
+	Metadata    string
+	Directory   string
+	Pre         string
+	Threshold   int32
+	Post        string
+	Prefix      string
+	Interactive bool
+}
+
+var (
+	// fsyncPreTemplate creates a directory for the test, and runs the pre command
+	fsyncPreTemplate = specs.NewTemplate(fsyncIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+# Directory for the test, unique to the pod, assuming other storage mounts
+directory={{ .Directory }}/fsync-$(cat /dev/urandom | tr -cd 'a-f0-9' | head -c 32)
+mkdir -p ${directory}
+# Run the pre-command here so it has access to the directory.
+{{ .Pre }}
+echo "FSYNC NODE ${METRICS_OPERATOR_NODE} THRESHOLD {{ .Threshold }}"
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+`, fsyncContext{})
+
+	// fsyncPostTemplate reports the percentile, runs the post command, and removes the directory
+	fsyncPostTemplate = specs.NewTemplate(fsyncIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+# Report the 99th percentile fsync latency (ms), e.g., for acceptance checks
+[ -f ${directory}/fsync.json ] && mo_report fsyncP99Ms $(awk '/"sync" *:/ {s=1} s && /"99.000000"/ {gsub(/[",]/, "", $3); print $3 / 1000000; exit}' ${directory}/fsync.json)
+# Run command here so it's after collection finish, but before removing the directory
+{{ .Post }}
+{{ .Prefix }} rm -rf ${directory}
+{{ interactive .Interactive }}
+`, fsyncContext{})
+)
+
+func (m Fsync) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	// Sequential writes with the sync engine, each followed by fdatasync. The
+	// result is kept in a file to report the percentile after collection.
+	command := fmt.Sprintf(
+		"%s fio --rw=write --ioengine=sync --fdatasync=1 --name=fsync --bs=%s --size=%s --directory=${directory} --output-format=json --output=${directory}/fsync.json && cat ${directory}/fsync.json",
+		m.prefix,
+		m.blocksize,
+		m.size,
+	)
+	if m.command != "" {
+		command = m.command
+	}
+
+	context := fsyncContext{
+		Metadata:    meta,
+		Directory:   m.directory,
+		Pre:         m.pre,
+		Threshold:   m.threshold,
+		Post:        m.post,
+		Prefix:      m.prefix,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	preBlock := fsyncPreTemplate.Render(context)
+	postBlock := fsyncPostTemplate.Render(context)
+	containers := m.StorageContainerSpec(preBlock, command, postBlock)
+
+	// The latency is reported for the node (the autoscaler already provides it)
+	if !spec.Spec.Autoscaler.Enabled() {
+		containers[0].Env = append(containers[0].Env, corev1.EnvVar{
+			Name: "METRICS_OPERATOR_NODE",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+			},
+		})
+	}
+	return containers
+}
+
+// Exported options and list options
+func (m Fsync) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"blocksize":   intstr.FromString(m.blocksize),
+		"size":        intstr.FromString(m.size),
+		"directory":   intstr.FromString(m.directory),
+		"threshold":   intstr.FromInt(int(m.threshold)),
+		"soleTenancy": intstr.FromString(strconv.FormatBool(m.SoleTenancy)),
+		"command":     intstr.FromString(m.command),
+	}
+}
+
+func init() {
+	base := metrics.BaseMetric{
+		Identifier: fsyncIdentifier,
+		Summary:    fsyncSummary,
+		Container:  fsyncContainer,
+	}
+	storage := metrics.StorageGeneric{BaseMetric: base}
+	fsync := Fsync{StorageGeneric: storage}
+	metrics.Register(&fsync)
+}
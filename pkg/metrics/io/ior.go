@@ -8,12 +8,9 @@ SPDX-License-Identifier: MIT
 package io
 
 import (
-	"fmt"
-
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
@@ -76,6 +73,32 @@ func (m *Ior) SetOptions(metric *api.Metric) {
 	}
 }
 
+// iorContext is for the templates of the storage container
+type iorContext struct {
+	Metadata    string
+	Workdir     string
+	Post        string
+	Interactive bool
+}
+
+var (
+	// iorPreTemplate changes to the working directory (assuming other storage mounts)
+	iorPreTemplate = specs.NewTemplate(iorIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+# Directory (and filename) for test assuming other storage mounts
+cd {{ .Workdir }}
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+`, iorContext{})
+
+	// iorPostTemplate ends the collection, and runs the post command
+	iorPostTemplate = specs.NewTemplate(iorIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+{{ .Post }}
+{{ interactive .Interactive }}
+`, iorContext{})
+)
+
 func (m Ior) PrepareContainers(
 	spec *api.MetricSet,
 	metric *metrics.Metric,
@@ -84,34 +107,14 @@ func (m Ior) PrepareContainers(
 	// Metadata to add to beginning of run
 	meta := metrics.Metadata(spec, metric)
 
-	preBlock := `#!/bin/bash
-echo "%s"
-# Directory (and filename) for test assuming other storage mounts
-cd %s
-echo "%s"
-echo "%s"
-`
-
-	postBlock := `
-echo "%s"
-%s
-%s
-`
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	preBlock = fmt.Sprintf(
-		preBlock,
-		meta,
-		m.workdir,
-		metadata.CollectionStart,
-		metadata.Separator,
-	)
-
-	postBlock = fmt.Sprintf(
-		postBlock,
-		metadata.CollectionEnd,
-		m.post,
-		interactive,
-	)
+	context := iorContext{
+		Metadata:    meta,
+		Workdir:     m.workdir,
+		Post:        m.post,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	preBlock := iorPreTemplate.Render(context)
+	postBlock := iorPostTemplate.Render(context)
 	return m.StorageContainerSpec(preBlock, m.command, postBlock)
 }
 
@@ -0,0 +1,265 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package io
+
+import (
+	"fmt"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// Metadata stress measures the rates of file create, stat, and delete (and
+// directory tree) operations at some number of files and directory width,
+// which matter for parallel filesystems as much as streaming bandwidth.
+// mdtest is in the IOR image. smallfile needs an image that provides it.
+
+const (
+	mdtestIdentifier = "io-mdtest"
+	mdtestSummary    = "Filesystem metadata stress (mdtest or smallfile)"
+	mdtestContainer  = iorContainer
+)
+
+// Tools to measure metadata rates with
+var mdtestTools = map[string]bool{"mdtest": true, "smallfile": true}
+
+type Mdtest struct {
+	metrics.StorageGeneric
+
+	// Options
+	tool       string
+	files      int32
+	depth      int32
+	width      int32
+	iterations int32
+	directory  string
+
+	// Operations for smallfile, in order
+	operations []string
+
+	// Or just define the entire command
+	command string
+
+	// extra commands for pre, post, etc.
+	pre    string
+	post   string
+	prefix string
+}
+
+func (m Mdtest) Url() string {
+	return "https://github.com/hpc/ior/blob/main/doc/mdtest.1"
+}
+
+// Set custom options / attributes for the metric
+func (m *Mdtest) SetOptions(metric *api.Metric) {
+	m.ResourceSpec = &metric.Resources
+	m.AttributeSpec = &metric.Attributes
+
+	m.Identifier = mdtestIdentifier
+	m.Summary = mdtestSummary
+	m.Container = mdtestContainer
+
+	// Set defaults for options
+	m.tool = "mdtest"
+	m.files = 1000
+	m.width = 1
+	m.iterations = 1
+	m.directory = "/tmp"
+	m.operations = []string{"create", "stat", "delete"}
+
+	v, ok := metric.Options["tool"]
+	if ok {
+		m.tool = v.StrVal
+	}
+	v, ok = metric.Options["files"]
+	if ok {
+		m.files = v.IntVal
+	}
+	v, ok = metric.Options["depth"]
+	if ok {
+		m.depth = v.IntVal
+	}
+	v, ok = metric.Options["width"]
+	if ok {
+		m.width = v.IntVal
+	}
+	v, ok = metric.Options["iterations"]
+	if ok {
+		m.iterations = v.IntVal
+	}
+	v, ok = metric.Options["directory"]
+	if ok {
+		m.directory = v.StrVal
+	}
+	v, ok = metric.Options["command"]
+	if ok {
+		m.command = v.StrVal
+	}
+	v, ok = metric.Options["prefix"]
+	if ok {
+		m.prefix = v.StrVal
+	}
+	v, ok = metric.Options["pre"]
+	if ok {
+		m.pre = v.StrVal
+	}
+	v, ok = metric.Options["post"]
+	if ok {
+		m.post = v.StrVal
+	}
+	operations, ok := metric.ListOptions["operations"]
+	if ok {
+		m.operations = []string{}
+		for _, operation := range operations {
+			m.operations = append(m.operations, operation.StrVal)
+		}
+	}
+}
+
+// Validate the tool and counts, and that smallfile has an image
+func (m Mdtest) Validate(spec *api.MetricSet) bool {
+	if !mdtestTools[m.tool] {
+		logger.Errorf("🟥️ The io-mdtest tool must be mdtest or smallfile, found %s", m.tool)
+		return false
+	}
+	if m.files < 1 || m.width < 1 || m.depth < 0 || m.iterations < 1 {
+		logger.Errorf("🟥️ The io-mdtest files, width, and iterations must be 1 or more, and depth 0 or more")
+		return false
+	}
+	if m.tool == "smallfile" && m.Container == mdtestContainer && m.command == "" {
+		logger.Errorf("🟥️ The io-mdtest smallfile tool requires an image with smallfile_cli.py")
+		return false
+	}
+	if m.tool == "smallfile" && len(m.operations) == 0 {
+		logger.Errorf("🟥️ The io-mdtest smallfile tool needs one or more operations")
+		return false
+	}
+	return m.StorageGeneric.Validate(spec)
+}
+
+// getCommand runs the tool in a unique directory for the pod. mdtest runs the
+// create, stat, read, and removal phases itself, and reports a summary of rates.
+func (m Mdtest) getCommand() string {
+	if m.command != "" {
+		return m.command
+	}
+	if m.tool == "mdtest" {
+		return fmt.Sprintf(
+			"%s mdtest -F -u -n %d -z %d -b %d -i %d -d ${directory}",
+			m.prefix, m.files, m.depth, m.width, m.iterations,
+		)
+	}
+
+	// smallfile runs one operation at a time, each on the files of the last
+	command := ""
+	for i, operation := range m.operations {
+		if i > 0 {
+			command += fmt.Sprintf("echo \"%s\"\n", metadata.Separator)
+		}
+		command += fmt.Sprintf(
+			"echo \"SMALLFILE OPERATION %s\"\n%s smallfile_cli.py --top ${directory} --operation %s --files %d --dirs-per-dir %d --files-per-dir %d --threads 1 --file-size 0\n",
+			operation, m.prefix, operation, m.files, m.width, m.files,
+		)
+	}
+	return command
+}
+
+// mdtestContext is for the templates of the storage container
+type mdtestContext struct {
+	Metadata    string
+	Directory   string
+	Pre         string
+	Tool        string
+	Post        string
+	Prefix      string
+	Interactive bool
+}
+
+var (
+	// mdtestPreTemplate creates a directory for the test, and runs the pre command
+	mdtestPreTemplate = specs.NewTemplate(mdtestIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+# Directory for the test, unique to the pod, assuming other storage mounts
+directory={{ .Directory }}/mdtest-$(cat /dev/urandom | tr -cd 'a-f0-9' | head -c 32)
+mkdir -p ${directory}
+# Run the pre-command here so it has access to the directory.
+{{ .Pre }}
+echo "MDTEST TOOL {{ .Tool }}"
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+`, mdtestContext{})
+
+	// mdtestPostTemplate runs the post command, and removes the directory
+	mdtestPostTemplate = specs.NewTemplate(mdtestIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+# Run command here so it's after collection finish, but before removing the directory
+{{ .Post }}
+{{ .Prefix }} rm -rf ${directory}
+{{ interactive .Interactive }}
+`, mdtestContext{})
+)
+
+func (m Mdtest) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	context := mdtestContext{
+		Metadata:    meta,
+		Directory:   m.directory,
+		Pre:         m.pre,
+		Tool:        m.tool,
+		Post:        m.post,
+		Prefix:      m.prefix,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	preBlock := mdtestPreTemplate.Render(context)
+	postBlock := mdtestPostTemplate.Render(context)
+	return m.StorageContainerSpec(preBlock, m.getCommand(), postBlock)
+}
+
+// Exported options and list options
+func (m Mdtest) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"tool":       intstr.FromString(m.tool),
+		"files":      intstr.FromInt(int(m.files)),
+		"depth":      intstr.FromInt(int(m.depth)),
+		"width":      intstr.FromInt(int(m.width)),
+		"iterations": intstr.FromInt(int(m.iterations)),
+		"directory":  intstr.FromString(m.directory),
+		"command":    intstr.FromString(m.command),
+	}
+}
+
+func (m Mdtest) ListOptions() map[string][]intstr.IntOrString {
+	operations := []intstr.IntOrString{}
+	for _, operation := range m.operations {
+		operations = append(operations, intstr.FromString(operation))
+	}
+	return map[string][]intstr.IntOrString{
+		"operations": operations,
+	}
+}
+
+func init() {
+	base := metrics.BaseMetric{
+		Identifier: mdtestIdentifier,
+		Summary:    mdtestSummary,
+		Container:  mdtestContainer,
+	}
+	storage := metrics.StorageGeneric{BaseMetric: base}
+	mdtest := Mdtest{StorageGeneric: storage}
+	metrics.Register(&mdtest)
+}
@@ -8,13 +8,11 @@ SPDX-License-Identifier: MIT
 package io
 
 import (
-	"fmt"
 	"strconv"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
@@ -82,6 +80,48 @@ func (m *IOStat) SetOptions(metric *api.Metric) {
 
 }
 
+// iostatContext is for the templates of the storage container
+type iostatContext struct {
+	Metadata    string
+	Pre         string
+	Completions int32
+	Command     string
+	Rate        int32
+	Post        string
+	Interactive bool
+}
+
+var (
+	// iostatPreTemplate runs iostat until the completions are done
+	iostatPreTemplate = specs.NewTemplate(iostatIdentifier, `#!/bin/bash
+# Custom pre comamand logic
+{{ .Pre }}
+i=0
+echo "{{ .Metadata }}"
+completions={{ .Completions }}
+echo "{{ collectionStart }}"
+while true
+  do
+    echo "{{ separator }}"
+	{{ .Command }}
+	# Note we can do iostat -o JSON
+	if [[ $completions -ne 0 ]] && [[ $i -eq $completions ]]; then
+    	echo "{{ collectionEnd }}"
+        {{ collectionEnd }}
+		exit 0
+    fi
+	sleep {{ .Rate }}
+	let i=i+1
+done
+`, iostatContext{})
+
+	// iostatPostTemplate runs the post command
+	iostatPostTemplate = specs.NewTemplate(iostatIdentifier+"-post", `
+{{ .Post }}
+{{ interactive .Interactive }}
+`, iostatContext{})
+)
+
 func (m IOStat) PrepareContainers(
 	spec *api.MetricSet,
 	metric *metrics.Metric,
@@ -94,47 +134,17 @@ func (m IOStat) PrepareContainers(
 		command = "iostat -dxm"
 	}
 
-	preBlock := `#!/bin/bash
-# Custom pre comamand logic
-%s
-i=0
-echo "%s"
-completions=%d
-echo "%s"
-while true
-  do
-    echo "%s"
-	%s
-	# Note we can do iostat -o JSON
-	if [[ $completions -ne 0 ]] && [[ $i -eq $completions ]]; then
-    	echo "%s"
-        %s
-		exit 0
-    fi
-	sleep %d
-	let i=i+1
-done
-`
-
-	postBlock := `
-%s
-%s
-`
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	preBlock = fmt.Sprintf(
-		preBlock,
-		m.pre,
-		meta,
-		m.completions,
-		metadata.CollectionStart,
-		metadata.Separator,
-		command,
-		metadata.CollectionEnd,
-		metadata.CollectionEnd,
-		m.rate,
-	)
-
-	postBlock = fmt.Sprintf(postBlock, m.post, interactive)
+	context := iostatContext{
+		Metadata:    meta,
+		Pre:         m.pre,
+		Completions: m.completions,
+		Command:     command,
+		Rate:        m.rate,
+		Post:        m.post,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	preBlock := iostatPreTemplate.Render(context)
+	postBlock := iostatPostTemplate.Render(context)
 	return m.StorageContainerSpec(preBlock, "", postBlock)
 }
 
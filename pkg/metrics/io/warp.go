@@ -0,0 +1,248 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package io
+
+import (
+	"fmt"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// Warp benchmarks S3 compatible object storage (e.g., MinIO, Ceph RGW, or a cloud store)
+// https://github.com/minio/warp
+
+const (
+	warpIdentifier = "io-warp"
+	warpSummary    = "S3 compatible object storage benchmark (warp)"
+	warpContainer  = "ghcr.io/converged-computing/metric-warp:latest"
+)
+
+var warpOperations = []string{"mixed", "get", "put", "delete", "stat", "list"}
+
+type Warp struct {
+	metrics.StorageGeneric
+
+	// Options
+	endpoint    string
+	secretName  string
+	bucket      string
+	region      string
+	tls         bool
+	operation   string
+	objectSize  string
+	concurrency int32
+	duration    string
+
+	// Distribution of operations (in percent) for a mixed benchmark
+	get    int32
+	put    int32
+	delete int32
+	stat   int32
+}
+
+func (m Warp) Url() string {
+	return "https://github.com/minio/warp"
+}
+
+// Set custom options / attributes for the metric
+func (m *Warp) SetOptions(metric *api.Metric) {
+	m.ResourceSpec = &metric.Resources
+	m.AttributeSpec = &metric.Attributes
+
+	m.Identifier = warpIdentifier
+	m.Summary = warpSummary
+	m.Container = warpContainer
+
+	// Set defaults for options (the distribution is the warp default)
+	m.bucket = "metrics-operator-warp"
+	m.operation = "mixed"
+	m.objectSize = "1MiB"
+	m.concurrency = 16
+	m.duration = "1m"
+	m.get, m.put, m.delete, m.stat = 45, 15, 10, 30
+
+	for key, value := range map[string]*string{
+		"endpoint":   &m.endpoint,
+		"secretName": &m.secretName,
+		"bucket":     &m.bucket,
+		"region":     &m.region,
+		"operation":  &m.operation,
+		"objectSize": &m.objectSize,
+		"duration":   &m.duration,
+	} {
+		v, ok := metric.Options[key]
+		if ok {
+			*value = v.StrVal
+		}
+	}
+	for key, value := range map[string]*int32{
+		"concurrency": &m.concurrency,
+		"get":         &m.get,
+		"put":         &m.put,
+		"delete":      &m.delete,
+		"stat":        &m.stat,
+	} {
+		v, ok := metric.Options[key]
+		if ok {
+			*value = v.IntVal
+		}
+	}
+	v, ok := metric.Options["tls"]
+	if ok {
+		m.tls = v.StrVal == "true" || v.StrVal == "yes"
+	}
+}
+
+// Validate we have an endpoint, and a distribution that adds up
+func (m Warp) Validate(spec *api.MetricSet) bool {
+	if m.endpoint == "" {
+		logger.Errorf("🟥️ The io-warp metric requires an 'endpoint' (host:port) for the object store")
+		return false
+	}
+	valid := false
+	for _, operation := range warpOperations {
+		valid = valid || operation == m.operation
+	}
+	if !valid {
+		logger.Errorf("🟥️ The io-warp operation must be one of %s, found %s", warpOperations, m.operation)
+		return false
+	}
+	if m.concurrency < 1 {
+		logger.Errorf("🟥️ The io-warp concurrency must be 1 or greater")
+		return false
+	}
+	if m.operation == "mixed" && m.get+m.put+m.delete+m.stat != 100 {
+		logger.Errorf("🟥️ The io-warp get, put, delete, and stat distribution must add up to 100")
+		return false
+	}
+	return true
+}
+
+// getCommand assembles the warp command for the operation
+func (m Warp) getCommand() string {
+	command := fmt.Sprintf(
+		"warp %s --host %s --bucket %s --obj.size %s --concurrent %d --duration %s",
+		m.operation,
+		m.endpoint,
+		m.bucket,
+		m.objectSize,
+		m.concurrency,
+		m.duration,
+	)
+	if m.operation == "mixed" {
+		command += fmt.Sprintf(
+			" --get-distrib %d --put-distrib %d --delete-distrib %d --stat-distrib %d",
+			m.get, m.put, m.delete, m.stat,
+		)
+	}
+	if m.region != "" {
+		command += fmt.Sprintf(" --region %s", m.region)
+	}
+	if m.tls {
+		command += " --tls"
+	}
+
+	// Pods share the bucket, so each uses its own prefix and does not clear it
+	return command + " --noclear --prefix $(hostname) --benchdata ${METRICS_OPERATOR_RESULTS}/warp"
+}
+
+// warpContext is for the templates of the storage container
+type warpContext struct {
+	Metadata    string
+	Interactive bool
+}
+
+var (
+	warpPreTemplate = specs.NewTemplate(warpIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+`, warpContext{})
+
+	// warpPostTemplate analyzes the benchmark data (as json)
+	warpPostTemplate = specs.NewTemplate(warpIdentifier+"-post", `
+echo "{{ separator }}"
+# Analysis of the benchmark data as json
+warp analyze --json ${METRICS_OPERATOR_RESULTS}/warp.csv.zst
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, warpContext{})
+)
+
+func (m Warp) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	context := warpContext{Metadata: meta, Interactive: spec.Spec.Logging.Interactive}
+	preBlock := warpPreTemplate.Render(context)
+	postBlock := warpPostTemplate.Render(context)
+	containers := m.StorageContainerSpec(preBlock, m.getCommand(), postBlock)
+
+	// Credentials are optional (e.g., the node might have a role)
+	if m.secretName != "" {
+		keys := map[string]string{
+			"WARP_ACCESS_KEY": "AWS_ACCESS_KEY_ID",
+			"WARP_SECRET_KEY": "AWS_SECRET_ACCESS_KEY",
+		}
+		for _, name := range []string{"WARP_ACCESS_KEY", "WARP_SECRET_KEY"} {
+			containers[0].Env = append(containers[0].Env, corev1.EnvVar{
+				Name: name,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: m.secretName},
+						Key:                  keys[name],
+					},
+				},
+			})
+		}
+	}
+	return containers
+}
+
+// Exported options and list options
+func (m Warp) Options() map[string]intstr.IntOrString {
+	tls := "false"
+	if m.tls {
+		tls = "true"
+	}
+	return map[string]intstr.IntOrString{
+		"endpoint":    intstr.FromString(m.endpoint),
+		"secretName":  intstr.FromString(m.secretName),
+		"bucket":      intstr.FromString(m.bucket),
+		"region":      intstr.FromString(m.region),
+		"tls":         intstr.FromString(tls),
+		"operation":   intstr.FromString(m.operation),
+		"objectSize":  intstr.FromString(m.objectSize),
+		"concurrency": intstr.FromInt(int(m.concurrency)),
+		"duration":    intstr.FromString(m.duration),
+		"get":         intstr.FromInt(int(m.get)),
+		"put":         intstr.FromInt(int(m.put)),
+		"delete":      intstr.FromInt(int(m.delete)),
+		"stat":        intstr.FromInt(int(m.stat)),
+	}
+}
+
+func init() {
+	base := metrics.BaseMetric{
+		Identifier: warpIdentifier,
+		Summary:    warpSummary,
+		Container:  warpContainer,
+	}
+	storage := metrics.StorageGeneric{BaseMetric: base}
+	warp := Warp{StorageGeneric: storage}
+	metrics.Register(&warp)
+}
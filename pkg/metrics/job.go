@@ -0,0 +1,68 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// ErrBackend is returned when the metrics of a MetricSet cannot run with its backend
+var ErrBackend = errors.New("backend")
+
+// JobName is the name of the Job for a MetricSet with the Job backend. It is the
+// name JobSet gives the first Job of a replicated job, so the pods have the same
+// hostnames (<job>-<index>) as they would in a JobSet, and entrypoints (e.g.,
+// hostlists) do not change with the backend.
+func JobName(js *jobset.JobSet) string {
+	if len(js.Spec.ReplicatedJobs) == 0 {
+		return js.Name
+	}
+	return fmt.Sprintf("%s-%s-0", js.Name, js.Spec.ReplicatedJobs[0].Name)
+}
+
+// GetJob returns a batch/v1 (indexed) Job for a MetricSet with the Job backend,
+// from the one replicated job of its JobSet. The Job has the labels of the JobSet
+// and of the replicated job (e.g., the metric), and the pods keep the replicated
+// job label, so they are found (e.g., for the status of metrics) as the pods of a
+// JobSet are.
+func GetJob(js *jobset.JobSet) (*batchv1.Job, error) {
+	if len(js.Spec.ReplicatedJobs) != 1 || js.Spec.ReplicatedJobs[0].Replicas != 1 {
+		return nil, fmt.Errorf("%w: a Job can only run metrics with one replicated job, found %d", ErrBackend, len(js.Spec.ReplicatedJobs))
+	}
+	rj := js.Spec.ReplicatedJobs[0]
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        JobName(js),
+			Namespace:   js.Namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Spec: *rj.Template.Spec.DeepCopy(),
+	}
+	for key, value := range js.Labels {
+		job.Labels[key] = value
+	}
+	for key, value := range rj.Template.Labels {
+		job.Labels[key] = value
+	}
+	for key, value := range js.Annotations {
+		job.Annotations[key] = value
+	}
+	job.Spec.Suspend = js.Spec.Suspend
+
+	if job.Spec.Template.Labels == nil {
+		job.Spec.Template.Labels = map[string]string{}
+	}
+	job.Spec.Template.Labels[jobset.ReplicatedJobNameKey] = rj.Name
+	return job, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics_test
+
+import (
+	"errors"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+func TestGetJob(t *testing.T) {
+	spec := getMetricSet("io-fio")
+	spec.Spec.Backend = api.JobBackend
+	if !spec.Validate() {
+		t.Fatal("expected a MetricSet with the Job backend to validate")
+	}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := metrics.GetJob(rendering.JobSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pods have the hostnames (and subdomain) they would have in the JobSet
+	rj := rendering.JobSet.Spec.ReplicatedJobs[0]
+	if job.Name != "golden-"+rj.Name+"-0" || job.Name != metrics.JobName(rendering.JobSet) {
+		t.Errorf("expected the Job to be named for the first job of the replicated job, found %s", job.Name)
+	}
+	if job.Labels[metrics.MetricSetLabel] != "golden" {
+		t.Errorf("expected the Job labeled for the MetricSet, found %v", job.Labels)
+	}
+	pod := job.Spec.Template
+	if pod.Labels[jobset.ReplicatedJobNameKey] != rj.Name || pod.Labels[metrics.MetricSetLabel] != "golden" {
+		t.Errorf("expected the pods labeled for the MetricSet and replicated job, found %v", pod.Labels)
+	}
+	if pod.Labels[metrics.MetricLabel] != "io-fio" || job.Labels[metrics.MetricLabel] != "io-fio" {
+		t.Errorf("expected the Job and pods labeled for the metric, found %v", pod.Labels)
+	}
+	if pod.Spec.Subdomain != spec.Subdomain() {
+		t.Errorf("expected the pods in subdomain %s, found %s", spec.Subdomain(), pod.Spec.Subdomain)
+	}
+	if job.Spec.CompletionMode == nil || *job.Spec.CompletionMode != batchv1.IndexedCompletion {
+		t.Errorf("expected an indexed Job")
+	}
+
+	// The JobSet is not changed by the conversion
+	if _, ok := rj.Template.Spec.Template.Labels[jobset.ReplicatedJobNameKey]; ok {
+		t.Errorf("expected the JobSet to be unchanged")
+	}
+
+	// A launcher and workers need a JobSet
+	spec = getMetricSet("network-osu-benchmark")
+	rendering, err = metrics.Render(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = metrics.GetJob(rendering.JobSet)
+	if !errors.Is(err, metrics.ErrBackend) {
+		t.Errorf("expected a backend error for more than one replicated job, found %v", err)
+	}
+
+	// As do features such as shards
+	spec.Spec.Shards = 2
+	spec.Spec.Backend = api.JobBackend
+	if spec.Validate() {
+		t.Errorf("expected shards with the Job backend to not validate")
+	}
+}
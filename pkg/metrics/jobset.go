@@ -10,6 +10,10 @@ package metrics
 // Each type of metric returns a replicated job that can be put into a common JobSet
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -30,6 +34,25 @@ var (
 
 const podLabelAppName = "app.kubernetes.io/name"
 
+// MetricSetLabel is on the JobSet (and pods) with the name of the MetricSet
+const MetricSetLabel = "metricset-name"
+
+// MetricLabel is on the jobs (and pods) of a metric with its name (or alias). Merged
+// metrics share the jobs of the first metric in the container.
+const MetricLabel = "metric-name"
+
+// Kueue labels and annotations on the MetricSet are passed to the JobSet
+const (
+	kueuePrefix     = "kueue.x-k8s.io/"
+	kueueQueueLabel = "kueue.x-k8s.io/queue-name"
+)
+
+// ErrEntrypointCollision is returned when two entrypoints would write the same config map key
+var ErrEntrypointCollision = errors.New("entrypoint collision")
+
+// ErrEntrypointSyntax is returned when a rendered entrypoint would not parse in the shell
+var ErrEntrypointSyntax = errors.New("entrypoint syntax")
+
 // GetJobSet is called by the controller to return a JobSet for the MetricSet
 func GetJobSet(
 	spec *api.MetricSet,
@@ -47,6 +70,10 @@ func GetJobSet(
 	// Get one or more replicated jobs, some number from each metric
 	rjs := []jobset.ReplicatedJob{}
 
+	// Compatible metrics can be merged into one container, keyed by job and image
+	groups := map[string]*mergeGroup{}
+	order := []string{}
+
 	// Get one replicated job per metric, and for each, extend with addons
 	for _, metric := range set.Metrics() {
 
@@ -63,6 +90,63 @@ func GetJobSet(
 		// We do this so we can match addons easily. The only reason we do this outside
 		// of the loop below is to allow shared logic.
 		cs := m.PrepareContainers(spec, &m)
+		name := metricKey(m)
+
+		// A metric with an alias (e.g., the same metric more than once) gets its
+		// own replicated job, named by the alias, in place of the default
+		if m.Alias() != "" {
+			renameDefaultJob(spec, jobs, cs, m.Alias())
+		}
+
+		// Clients of a metric can be placed relative to its server
+		entry := getMetricSpec(spec, name)
+		err = applyPlacement(spec, name, entry.Placement, jobs)
+		if err != nil {
+			return js, containerSpecs, err
+		}
+
+		// The jobs and pods of the metric can be found by its name
+		labelMetricJobs(jobs, name)
+
+		// Config map keys are derived from the metric, job, and container so they
+		// are stable across reconciles and unique across metrics. Results for the pod
+		// are finished (e.g., compressed or pruned) when the metric is done.
+		for _, c := range cs {
+			c.EntrypointScript.Name = specs.EntrypointKey(name, c.JobName, c.Name)
+			c.EntrypointScript.WithResults()
+			c.Metric = name
+			c.Timeout = entry.TimeoutSeconds
+			c.Debug = spec.Spec.Debug
+			c.Env = append(c.Env, getSecretEnvironment(entry)...)
+			c.Scratch = m.ScratchNeeds()
+			if spec.Spec.Snapshot {
+				c.EntrypointScript.WithSnapshot()
+			}
+			c.Shell = entry.Shell
+			if spec.IsWindows() {
+				c.Shell = specs.PowerShell
+				c.EntrypointScript.WithPowerShell()
+			}
+
+			// Pods can have their own environment and flags by completion index,
+			// and restartable applications resume from their latest checkpoint
+			if !c.InitContainer {
+				err = applyOverrides(entry, c)
+				if err != nil {
+					return js, containerSpecs, err
+				}
+				applyCheckpoint(spec, entry, c)
+			}
+		}
+
+		// Input files for the metric are written to the config map, and their paths
+		// are available to the metric containers as template variables
+		inputs, paths := getInputs(spec, name)
+		if len(inputs) > 0 {
+			for _, c := range cs {
+				c.Inputs = paths
+			}
+		}
 
 		// Prepare container and volume specs (that are changeable) e.g.,
 		// 1. Create VolumeSpec across metrics and addons that can predefine volumes
@@ -72,23 +156,171 @@ func GetJobSet(
 		if err != nil {
 			return js, containerSpecs, err
 		}
+		pods := getTotalPods(spec, jobs)
+		for _, c := range cs {
+			c.Pods = pods
+		}
+		for _, c := range cms {
+			c.Metric = name
+			c.Pods = pods
+		}
+
+		// If the metric can be merged into an existing container, we don't need its job
+		if canMerge(spec, m, jobs, cs) {
+			key := mergeKey(cs[0])
+			group, ok := groups[key]
+			if ok {
+				group.add(name, cs[0].EntrypointScript)
+				continue
+			}
+			group = &mergeGroup{job: jobs[0], container: cs[0]}
+			group.add(name, cs[0].EntrypointScript)
+			groups[key] = group
+			order = append(order, key)
+		}
 
 		// Add the finalized container specs for the entire set of replicated jobs
 		// We need this at the end to hand back to generate config maps
 		containerSpecs = append(containerSpecs, cs...)
 		containerSpecs = append(containerSpecs, cms...)
 
+		// Inputs are mounted for the metric jobs after the addon volumes
+		addOperatorFiles(spec, jobs, inputs)
+		containerSpecs = append(containerSpecs, inputs...)
+
 		// Add the final set of jobs (bad decision for the pointer here, oops)
 		for _, job := range jobs {
 			rjs = append(rjs, (*job))
 		}
 	}
 
+	// Write combined entrypoints for any merged metrics
+	for _, key := range order {
+		containerSpecs = append(containerSpecs, groups[key].finalize(spec)...)
+	}
+
+	// Expand template variables (e.g., {{.Pods}}) now that we know the jobs
+	err := renderEntrypoints(spec, rjs, containerSpecs)
+	if err != nil {
+		return js, containerSpecs, err
+	}
+	for _, cs := range containerSpecs {
+		if spec.Spec.Markers.Framing != "" {
+			cs.EntrypointScript.WithFraming()
+		}
+		cs.EntrypointScript.WithMarkers(spec.Spec.Markers)
+		timeout := spec.Spec.CommandTimeout
+		if cs.Timeout > 0 {
+			timeout = cs.Timeout
+		}
+		cs.EntrypointScript.WithTimeout(timeout)
+		if cs.Debug {
+			cs.EntrypointScript.WithDebug()
+		}
+	}
+
+	// Waiting for pods (e.g., from an autoscaler) is not part of the command timeout
+	addAutoscalerWait(spec, rjs, containerSpecs)
+	err = checkEntrypoints(containerSpecs)
+	if err != nil {
+		return js, containerSpecs, err
+	}
+
+	// Large sets of entrypoints are split across more than one config map
+	shards, err := GetConfigMapShards(spec, containerSpecs)
+	if err != nil {
+		return js, containerSpecs, err
+	}
+	shardOperatorVolumes(spec, rjs, shards)
+
+	// With InOrder startup, the launcher pods wait for the others to be ready
+	applyStartupPolicy(spec, rjs, successJobs)
+
+	// An acceptance run has one pod of each replicated job on each node
+	applyAcceptance(spec, rjs)
+
+	// Pods are adjusted for (and checked against) the security profile
+	err = applySecurityProfile(spec, rjs)
+	if err != nil {
+		return js, containerSpecs, err
+	}
+
 	// Get those replicated Jobs.
 	js.Spec.ReplicatedJobs = rjs
 	return js, containerSpecs, nil
 }
 
+// checkEntrypoints ensures no two entrypoints share a config map key with
+// different content, which would otherwise silently overwrite one of them, and
+// that each (bash) entrypoint parses, so a broken script is rejected with the
+// MetricSet instead of crash looping in every pod
+func checkEntrypoints(containerSpecs []*specs.ContainerSpec) error {
+	scripts := map[string]string{}
+	for _, cs := range containerSpecs {
+		key := cs.EntrypointScript.Name
+		script := cs.EntrypointScript.WriteScript()
+		existing, ok := scripts[key]
+		if ok && existing != script {
+			return fmt.Errorf("%w: %s is used by more than one entrypoint", ErrEntrypointCollision, key)
+		}
+		scripts[key] = script
+		if cs.EntrypointScript.Verbatim || cs.EntrypointScript.PowerShell {
+			continue
+		}
+		err := specs.CheckSyntax(script)
+		if err != nil {
+			return fmt.Errorf("%w: %s %s", ErrEntrypointSyntax, key, err)
+		}
+	}
+	return nil
+}
+
+// renameDefaultJob names the default replicated job (and its containers) for a metric alias,
+// which is also the role to size it by in the spec
+func renameDefaultJob(set *api.MetricSet, jobs []*jobset.ReplicatedJob, cs []*specs.ContainerSpec, alias string) {
+	for _, job := range jobs {
+		if job.Name == ReplicatedJobName {
+			job.Name = alias
+			rolePods, ok := set.Spec.Roles[alias]
+			if ok {
+				job.Template.Spec.Parallelism = &rolePods
+				job.Template.Spec.Completions = &rolePods
+			}
+		}
+	}
+	for _, c := range cs {
+		if c.JobName == ReplicatedJobName {
+			c.JobName = alias
+		}
+	}
+}
+
+// getMetricSpec returns the spec for a metric (by alias or name), or an empty spec
+func getMetricSpec(set *api.MetricSet, metricKey string) api.Metric {
+	for _, metric := range set.ExpandedMetrics() {
+		if metric.Key() == metricKey {
+			return metric
+		}
+	}
+	return api.Metric{}
+}
+
+// labelMetricJobs adds the metric label to the job and pod templates of the
+// replicated jobs of a metric. The labels can be shared by the replicated jobs, so
+// each gets a copy.
+func labelMetricJobs(jobs []*jobset.ReplicatedJob, name string) {
+	for _, job := range jobs {
+		for _, meta := range []*metav1.ObjectMeta{&job.Template.ObjectMeta, &job.Template.Spec.Template.ObjectMeta} {
+			labels := map[string]string{}
+			for key, value := range meta.Labels {
+				labels[key] = value
+			}
+			labels[MetricLabel] = name
+			meta.Labels = labels
+		}
+	}
+}
+
 // Get list of strings that define successful for a jobset.
 // Since these are from replicatedJobs in metrics, we collect from there
 func getSuccessJobs(metrics []*Metric) []string {
@@ -111,13 +343,24 @@ func getSuccessJobs(metrics []*Metric) []string {
 func getBaseJobSet(set *api.MetricSet, successSet []string) *jobset.JobSet {
 
 	// When suspend is true we have a hard time debugging jobs, so keep false
-	suspend := false
-	enableDNSHostnames := false
+	// unless the JobSet is queued, in which case Kueue unsuspends it on admission
+	labels := getQueueMetadata(set.Labels)
+	_, queued := labels[kueueQueueLabel]
+	suspend := queued
+
+	// The MetricSet label finds the JobSet again, e.g., after an operator upgrade
+	labels[MetricSetLabel] = set.Name
+	for key, value := range getProvenanceLabels(set) {
+		labels[key] = value
+	}
+	enableDNSHostnames := set.Spec.Network.EnableDNSHostnames
 
 	js := jobset.JobSet{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      set.Name,
-			Namespace: set.Namespace,
+			Name:        set.Name,
+			Namespace:   set.Namespace,
+			Labels:      labels,
+			Annotations: getQueueMetadata(set.Annotations),
 		},
 		Spec: jobset.JobSetSpec{
 			FailurePolicy: &jobset.FailurePolicy{
@@ -130,7 +373,7 @@ func getBaseJobSet(set *api.MetricSet, successSet []string) *jobset.JobSet {
 
 			Network: &jobset.Network{
 				EnableDNSHostnames: &enableDNSHostnames,
-				Subdomain:          set.Spec.ServiceName,
+				Subdomain:          set.Subdomain(),
 			},
 
 			// This might be the control for child jobs (worker)
@@ -143,6 +386,18 @@ func getBaseJobSet(set *api.MetricSet, successSet []string) *jobset.JobSet {
 	return &js
 }
 
+// getQueueMetadata returns the Kueue labels or annotations (e.g., the queue name
+// or priority class) of the MetricSet, to pass through to the JobSet
+func getQueueMetadata(metadata map[string]string) map[string]string {
+	queue := map[string]string{}
+	for key, value := range metadata {
+		if strings.HasPrefix(key, kueuePrefix) {
+			queue[key] = value
+		}
+	}
+	return queue
+}
+
 // getAffinity returns to pod affinity to ensure 1 address / node
 func getAffinity(set *api.MetricSet) *corev1.Affinity {
 	return &corev1.Affinity{
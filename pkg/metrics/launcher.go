@@ -11,7 +11,6 @@ import (
 	"fmt"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 )
@@ -101,6 +100,48 @@ func (m *LauncherWorker) ensureDefaultNames() {
 	}
 }
 
+// launcherContext is for the templates of the launcher and worker scripts
+type launcherContext struct {
+	Metadata    string
+	Hosts       string
+	Command     string
+	NetworkWait string
+	Interactive bool
+}
+
+// The launcher and worker share a prefix that starts the ssh daemon, writes the
+// hosts (and a problem.sh with the command, if there is one), and waits for the network
+var (
+	launcherPrefixTemplate = specs.NewTemplate("launcher-prefix", `#!/bin/bash
+# Start ssh daemon
+/usr/sbin/sshd -D &
+echo "{{ .Metadata }}"
+# Write the hosts file
+cat <<EOF > ./hostlist.txt
+{{ .Hosts }}
+EOF
+
+{{ if .Command }}# Write the command file
+cat <<EOF > ./problem.sh
+#!/bin/bash
+{{ .Command }}
+EOF
+chmod +x ./problem.sh{{ end }}
+
+{{ .NetworkWait }}
+echo "{{ collectionStart }}"
+`, launcherContext{})
+
+	launcherPreTemplate = specs.NewTemplate("launcher-pre", `
+echo "{{ separator }}"
+`, launcherContext{})
+
+	launcherPostTemplate = specs.NewTemplate("launcher-post", `
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, launcherContext{})
+)
+
 func (m *LauncherWorker) PrepareContainers(
 	spec *api.MetricSet,
 	metric *Metric,
@@ -109,20 +150,11 @@ func (m *LauncherWorker) PrepareContainers(
 	// Metadata to add to beginning of run
 	meta := Metadata(spec, metric)
 	hosts := m.GetHostlist(spec)
-	prefix := m.GetCommonPrefix(meta, m.Command, hosts)
+	prefix := m.GetCommonPrefix(spec, meta, m.Command, hosts)
 
-	preBlock := `
-echo "%s"
-`
-
-	postBlock := `
-echo "%s"
-%s
-`
 	command := fmt.Sprintf("%s ./problem.sh", m.Prefix)
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	preBlock = prefix + fmt.Sprintf(preBlock, metadata.Separator)
-	postBlock = fmt.Sprintf(postBlock, metadata.CollectionEnd, interactive)
+	preBlock := prefix + launcherPreTemplate.Render(launcherContext{})
+	postBlock := launcherPostTemplate.Render(launcherContext{Interactive: spec.Spec.Logging.Interactive})
 
 	// Entrypoint for the launcher
 	launcherEntrypoint := specs.EntrypointScript{
@@ -151,50 +183,24 @@ echo "%s"
 
 // GetCommonPrefix returns a common prefix for the worker/ launcher script, setting up hosts, etc.
 func (m *LauncherWorker) GetCommonPrefix(
+	spec *api.MetricSet,
 	meta string,
 	command string,
 	hosts string,
 ) string {
 
-	// Generate problem.sh with command only if we have one!
-	if command != "" {
-		command = fmt.Sprintf(`# Write the command file
-cat <<EOF > ./problem.sh
-#!/bin/bash
-%s
-EOF
-chmod +x ./problem.sh`, command)
-	}
-
-	prefixTemplate := `#!/bin/bash
-# Start ssh daemon
-/usr/sbin/sshd -D &
-echo "%s"
-# Write the hosts file
-cat <<EOF > ./hostlist.txt
-%s
-EOF
-
-%s
-
-# Allow network to ready (this could be a variable)
-echo "Sleeping for 10 seconds waiting for network..."
-sleep 10
-echo "%s"
-`
-	return fmt.Sprintf(
-		prefixTemplate,
-		meta,
-		hosts,
-		command,
-		metadata.CollectionStart,
-	)
+	return launcherPrefixTemplate.Render(launcherContext{
+		Metadata:    meta,
+		Hosts:       hosts,
+		Command:     command,
+		NetworkWait: NetworkWaitBlock(spec, 10),
+	})
 }
 
 // AddWorkers generates worker jobs, only if we have them
 func (m *LauncherWorker) AddWorkers(spec *api.MetricSet) (*jobset.ReplicatedJob, error) {
 
-	numWorkers := spec.Spec.Pods - 1
+	numWorkers := m.Workers(spec)
 	workers, err := AssembleReplicatedJob(spec, false, numWorkers, numWorkers, m.WorkerLetter, m.SoleTenancy)
 	if err != nil {
 		return workers, err
@@ -249,7 +255,7 @@ func (m *LauncherWorker) ReplicatedJobs(spec *api.MetricSet) ([]*jobset.Replicat
 		return js, err
 	}
 
-	numWorkers := spec.Spec.Pods - 1
+	numWorkers := m.Workers(spec)
 	var workers *jobset.ReplicatedJob
 
 	// Generate the replicated job with just a launcher, or launcher and workers
@@ -265,12 +271,28 @@ func (m *LauncherWorker) ReplicatedJobs(spec *api.MetricSet) ([]*jobset.Replicat
 	return js, nil
 }
 
+// Workers returns the number of worker pods, the pods less the launcher unless
+// the worker role is sized in the spec
+func (m *LauncherWorker) Workers(spec *api.MetricSet) int32 {
+	m.ensureDefaultNames()
+	return spec.RolePods(m.WorkerLetter, spec.Spec.Pods-1)
+}
+
+// TotalPods returns the number of pods for the launcher and workers
+func (m *LauncherWorker) TotalPods(spec *api.MetricSet) int32 {
+	return 1 + m.Workers(spec)
+}
+
 // Validate that we can run a network. At least one launcher and worker is required
 func (m LauncherWorker) Validate(spec *api.MetricSet) bool {
-	isValid := spec.Spec.Pods >= 2
+	isValid := m.TotalPods(spec) >= 2
 	if !isValid {
 		logger.Errorf("Pods for a Launcher Worker app must be >=2. This app is invalid.")
 	}
+	if spec.RolePods(m.LauncherLetter, 1) != 1 {
+		logger.Errorf("There is only one launcher, the %s role cannot be sized.", m.LauncherLetter)
+		return false
+	}
 	return isValid
 }
 
@@ -280,12 +302,12 @@ func (m *LauncherWorker) GetHostlist(spec *api.MetricSet) string {
 
 	// The launcher has a different hostname, n for netmark
 	hosts := fmt.Sprintf("%s-%s-0-0.%s.%s.svc.cluster.local\n",
-		spec.Name, m.LauncherLetter, spec.Spec.ServiceName, spec.Namespace,
+		spec.Name, m.LauncherLetter, spec.Subdomain(), spec.Namespace,
 	)
 	// Add number of workers
-	for i := 0; i < int(spec.Spec.Pods-1); i++ {
+	for i := 0; i < int(m.Workers(spec)); i++ {
 		hosts += fmt.Sprintf("%s-%s-0-%d.%s.%s.svc.cluster.local\n",
-			spec.Name, m.WorkerLetter, i, spec.Spec.ServiceName, spec.Namespace)
+			spec.Name, m.WorkerLetter, i, spec.Subdomain(), spec.Namespace)
 	}
 	return hosts
 }
@@ -10,9 +10,9 @@ package metrics
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/logging"
 	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	"github.com/converged-computing/metrics-operator/pkg/utils"
 	"go.uber.org/zap"
@@ -27,15 +27,34 @@ var (
 // I'd like to improve upon this manual approach, it's a bit messy.
 func Metadata(set *api.MetricSet, metric *Metric) string {
 
+	// We need to escape the quotes for printing in bash
+	metadataEscaped := utils.EscapeCharacters(exportMetadata(set, metric))
+	return fmt.Sprintf("METADATA START %s\nMETADATA END", metadataEscaped)
+}
+
+// PowerShellMetadata is the same metadata, written in a literal here-string
+// for PowerShell (which does not escape quotes with a backslash)
+func PowerShellMetadata(set *api.MetricSet, metric *Metric) string {
+	return fmt.Sprintf("Write-Output @'\nMETADATA START %s\nMETADATA END\n'@", exportMetadata(set, metric))
+}
+
+// exportMetadata serializes the metadata for a metric to JSON
+func exportMetadata(set *api.MetricSet, metric *Metric) string {
 	m := (*metric)
 	export := metadata.MetricExport{
 
 		// Global
 		Pods: set.Spec.Pods,
 
+		// Provenance
+		ExperimentID: set.Spec.ExperimentID,
+		Metadata:     set.Spec.Metadata,
+
 		// Metric
 		MetricName:        m.Name(),
+		MetricAlias:       m.Alias(),
 		MetricDescription: m.Description(),
+		MetricVersion:     Version(m),
 		MetricOptions:     m.Options(),
 		MetricListOptions: m.ListOptions(),
 	}
@@ -43,16 +62,9 @@ func Metadata(set *api.MetricSet, metric *Metric) string {
 	if err != nil {
 		logger.Errorf("Warning, error serializing spec metadata: %s", err.Error())
 	}
-	// We need to escape the quotes for printing in bash
-	metadataEscaped := utils.EscapeCharacters(string(metadata))
-	return fmt.Sprintf("METADATA START %s\nMETADATA END", metadataEscaped)
+	return string(metadata)
 }
 
 func init() {
-	handle, err := zap.NewProduction()
-	if err != nil {
-		log.Fatalf("can't initialize zap logger: %v", err)
-	}
-	logger = handle.Sugar()
-	defer handle.Sync()
+	logger = logging.NewLogger("metrics")
 }
@@ -0,0 +1,136 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// A mergeGroup holds the first (owning) container for a set of compatible
+// metrics, along with the entrypoint scripts that are merged into it
+type mergeGroup struct {
+	job       *jobset.ReplicatedJob
+	container *specs.ContainerSpec
+	names     []string
+	scripts   []specs.EntrypointScript
+}
+
+// canMerge determines if a metric is a lightweight sampler that can share a container.
+// We require a single replicated job and container, and no addons, inputs, or extra
+// environment, since these add volumes, containers, or env specific to the metric.
+func canMerge(
+	set *api.MetricSet,
+	m Metric,
+	jobs []*jobset.ReplicatedJob,
+	cs []*specs.ContainerSpec,
+) bool {
+	if !set.Spec.Merge.Enabled {
+		return false
+	}
+	if len(jobs) != 1 || len(cs) != 1 || len(m.GetAddons()) != 0 {
+		return false
+	}
+	checkpoint := getMetricSpec(set, metricKey(m)).Checkpoint
+	if checkpoint.Enabled() {
+		return false
+	}
+	if len(cs[0].Command) > 0 || cs[0].InitContainer || len(cs[0].Inputs) > 0 || len(cs[0].Env) > 0 || cs[0].Timeout > 0 || cs[0].ShellPath() != "/bin/bash" {
+		return false
+	}
+
+	// If no families are provided, all are allowed
+	if len(set.Spec.Merge.Families) == 0 {
+		return true
+	}
+	for _, family := range set.Spec.Merge.Families {
+		if family == m.Family() {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeKey groups containers that can be combined (same job and image)
+func mergeKey(cs *specs.ContainerSpec) string {
+	return fmt.Sprintf("%s/%s", cs.JobName, cs.Image)
+}
+
+// add a metric entrypoint to the group
+func (g *mergeGroup) add(name string, entrypoint specs.EntrypointScript) {
+	g.names = append(g.names, name)
+	g.scripts = append(g.scripts, entrypoint)
+}
+
+// finalize writes the combined entrypoint into the owning container, and returns
+// specs for the individual scripts that need to be written to the config map
+func (g *mergeGroup) finalize(set *api.MetricSet) []*specs.ContainerSpec {
+
+	// Nothing was merged, leave the container as is
+	if len(g.scripts) < 2 {
+		return []*specs.ContainerSpec{}
+	}
+	logger.Infof("🟪️ Merging metrics %s into container %s", g.names, g.container.Name)
+
+	written := []*specs.ContainerSpec{}
+	command := ""
+	for i, script := range g.scripts {
+		path := fmt.Sprintf("/metrics_operator/merged-%s.sh", g.names[i])
+		script.Path = path
+		script.Name = specs.DeriveScriptKey(path)
+		written = append(written, &specs.ContainerSpec{
+			JobName:          g.container.JobName,
+			Name:             g.container.Name,
+			Image:            g.container.Image,
+			EntrypointScript: script,
+		})
+		command += fmt.Sprintf("/bin/bash %s &\nmo_merged_pids=\"${mo_merged_pids} $!\"\n", path)
+
+		// The scripts also need to be mounted alongside the combined entrypoint
+		addOperatorItem(set, g.job, script)
+	}
+
+	// The owning container keeps its path, but runs each metric in the background.
+	// We wait on each one, so the container fails if any of the metrics do.
+	g.container.EntrypointScript.Pre = fmt.Sprintf("#!/bin/bash\n# Merged entrypoint for metrics: %s", strings.Join(g.names, ", "))
+	g.container.EntrypointScript.Command = command + mergedWait
+	g.container.EntrypointScript.Post = "exit ${mo_merged_status}"
+	return written
+}
+
+// mergedWait waits for each merged metric, keeping the last failed exit code
+var mergedWait = `mo_merged_status=0
+for mo_merged_pid in ${mo_merged_pids}; do
+    wait ${mo_merged_pid} || mo_merged_status=$?
+done`
+
+// addOperatorItem adds an entrypoint script to the metrics operator config map volume
+func addOperatorItem(
+	set *api.MetricSet,
+	rj *jobset.ReplicatedJob,
+	script specs.EntrypointScript,
+) {
+	volumes := rj.Template.Spec.Template.Spec.Volumes
+	for i, volume := range volumes {
+		if volume.Name != set.Name || volume.ConfigMap == nil {
+			continue
+		}
+		item := corev1.KeyToPath{
+			Key:  script.Name,
+			Path: filepath.Base(script.Path),
+			Mode: &makeExecutable,
+		}
+		volumes[i].ConfigMap.Items = append(volumes[i].ConfigMap.Items, item)
+	}
+}
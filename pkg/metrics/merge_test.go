@@ -0,0 +1,136 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/addons"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// mergeMetric is a minimal sampler of a family for testing merging
+type mergeMetric struct {
+	BaseMetric
+	family string
+}
+
+func (m mergeMetric) Family() string                                                    { return m.family }
+func (m mergeMetric) Url() string                                                       { return "" }
+func (m *mergeMetric) SetOptions(metric *api.Metric)                                    {}
+func (m mergeMetric) Options() map[string]intstr.IntOrString                            { return nil }
+func (m *mergeMetric) PrepareContainers(*api.MetricSet, *Metric) []*specs.ContainerSpec { return nil }
+
+func TestCanMerge(t *testing.T) {
+	jobs := []*jobset.ReplicatedJob{{Name: "m"}}
+	tests := map[string]struct {
+		merge      api.Merge
+		metric     api.Metric
+		jobs       []*jobset.ReplicatedJob
+		container  specs.ContainerSpec
+		containers int
+		addon      bool
+		expected   bool
+	}{
+		"sampler":        {merge: api.Merge{Enabled: true}, expected: true},
+		"not enabled":    {},
+		"family":         {merge: api.Merge{Enabled: true, Families: []string{"io", "performance"}}, expected: true},
+		"other family":   {merge: api.Merge{Enabled: true, Families: []string{"network"}}},
+		"two jobs":       {merge: api.Merge{Enabled: true}, jobs: []*jobset.ReplicatedJob{{Name: "l"}, {Name: "w"}}},
+		"two containers": {merge: api.Merge{Enabled: true}, containers: 2},
+		"addon":          {merge: api.Merge{Enabled: true}, addon: true},
+		"checkpoint":     {merge: api.Merge{Enabled: true}, metric: api.Metric{Checkpoint: api.Checkpoint{ClaimName: "checkpoints"}}},
+		"command":        {merge: api.Merge{Enabled: true}, container: specs.ContainerSpec{Command: []string{"sleep"}}},
+		"init container": {merge: api.Merge{Enabled: true}, container: specs.ContainerSpec{InitContainer: true}},
+		"inputs":         {merge: api.Merge{Enabled: true}, container: specs.ContainerSpec{Inputs: map[string]string{"in.lj": "units lj"}}},
+		"environment":    {merge: api.Merge{Enabled: true}, container: specs.ContainerSpec{Env: []corev1.EnvVar{{Name: "OMP_NUM_THREADS"}}}},
+		"timeout":        {merge: api.Merge{Enabled: true}, container: specs.ContainerSpec{Timeout: 60}},
+		"sh":             {merge: api.Merge{Enabled: true}, container: specs.ContainerSpec{Shell: "sh"}},
+		"interpreter":    {merge: api.Merge{Enabled: true}, container: specs.ContainerSpec{Interpreter: "/opt/bash/bash"}},
+		"powershell":     {merge: api.Merge{Enabled: true}, container: specs.ContainerSpec{Shell: specs.PowerShell}},
+		"explicit bash":  {merge: api.Merge{Enabled: true}, container: specs.ContainerSpec{Shell: "bash"}, expected: true},
+		"no claim":       {merge: api.Merge{Enabled: true}, metric: api.Metric{Checkpoint: api.Checkpoint{Path: "/checkpoints"}}, expected: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			set := &api.MetricSet{}
+			set.Spec.Merge = test.merge
+			test.metric.Name = "io-sysstat"
+			set.Spec.Metrics = []api.Metric{test.metric}
+			m := &mergeMetric{BaseMetric: BaseMetric{Identifier: "io-sysstat"}, family: "io"}
+			if test.addon {
+				var a addons.Addon = &addons.BashAddon{}
+				m.RegisterAddon(&a)
+			}
+			if test.jobs == nil {
+				test.jobs = jobs
+			}
+			cs := []*specs.ContainerSpec{&test.container}
+			for i := 1; i < test.containers; i++ {
+				cs = append(cs, &specs.ContainerSpec{})
+			}
+			if canMerge(set, m, test.jobs, cs) != test.expected {
+				t.Errorf("expected merging to be %v", test.expected)
+			}
+		})
+	}
+}
+
+func TestMergedEntrypoint(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run the entrypoint")
+	}
+	dir := t.TempDir()
+	group := &mergeGroup{job: &jobset.ReplicatedJob{Name: "m"}, container: &specs.ContainerSpec{JobName: "m", Name: "io-sysstat"}}
+	group.add("io-sysstat", specs.EntrypointScript{Command: "sleep 1; exit 3"})
+	group.add("perf-sysstat", specs.EntrypointScript{Command: "echo done"})
+	written := group.finalize(&api.MetricSet{})
+	if len(written) != 2 {
+		t.Fatalf("expected a script for each merged metric, found %d", len(written))
+	}
+
+	// The merged scripts are run from a temporary directory in place of the config map
+	run := func() error {
+		for _, cs := range written {
+			path := filepath.Join(dir, filepath.Base(cs.EntrypointScript.Path))
+			err := os.WriteFile(path, []byte(cs.EntrypointScript.Command+"\n"), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		e := group.container.EntrypointScript
+		script := strings.ReplaceAll(e.Command+"\n"+e.Post, "/metrics_operator/", dir+"/")
+		out, err := exec.Command(bash, "-c", script).CombinedOutput()
+		if !strings.Contains(string(out), "done") {
+			t.Errorf("expected the output of each metric, found %s", out)
+		}
+		return err
+	}
+
+	// A metric that fails after the others are done fails the container
+	var exitErr *exec.ExitError
+	err = run()
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("expected the exit code of the failed metric, found %v", err)
+	}
+	written[0].EntrypointScript.Command = "sleep 1"
+	err = run()
+	if err != nil {
+		t.Errorf("expected the merged metrics to succeed, found %s", err)
+	}
+}
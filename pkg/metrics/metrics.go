@@ -11,10 +11,13 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"strings"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	addons "github.com/converged-computing/metrics-operator/pkg/addons"
+	"github.com/converged-computing/metrics-operator/pkg/config"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/utils"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
 )
@@ -28,18 +31,23 @@ type Metric interface {
 
 	// Metadata
 	Name() string
+	Alias() string
+	SetAlias(string)
 	Description() string
 	Family() string
 	Url() string
+	Revision() string
 
 	// Container attributes
 	Image() string
 	SetContainer(string)
 
-	// Options and exportable attributes
+	// Options and exportable attributes. ListOptions declares every list
+	// option the metric accepts, with an empty list if it is unset.
 	SetOptions(*api.Metric)
 	Options() map[string]intstr.IntOrString
 	ListOptions() map[string][]intstr.IntOrString
+	MapOptions() map[string]map[string]intstr.IntOrString
 
 	// Validation and append addons
 	Validate(*api.MetricSet) bool
@@ -49,6 +57,8 @@ type Metric interface {
 
 	// Attributes for JobSet, etc.
 	HasSoleTenancy() bool
+	SupportsWindows() bool
+	ScratchNeeds() *specs.ScratchNeeds
 	ReplicatedJobs(*api.MetricSet) ([]*jobset.ReplicatedJob, error)
 	SuccessJobs() []string
 	Resources() *api.ContainerResources
@@ -59,6 +69,14 @@ type Metric interface {
 	PrepareContainers(*api.MetricSet, *Metric) []*specs.ContainerSpec
 }
 
+// metricKey is the alias of a metric if set, otherwise the name
+func metricKey(m Metric) string {
+	if m.Alias() != "" {
+		return m.Alias()
+	}
+	return m.Name()
+}
+
 // GetMetric returns a metric, if it is known to the metrics operator
 // We also confirm that the addon exists, validate, and instantiate it.
 func GetMetric(metric *api.Metric, set *api.MetricSet) (Metric, error) {
@@ -77,27 +95,48 @@ func GetMetric(metric *api.Metric, set *api.MetricSet) (Metric, error) {
 		// Set global and custom options on the registry metric from the CRD
 		m.SetOptions(metric)
 
-		// If the metric has a custom container, set here
+		// The list options the metric exports are the ones it accepts
+		unknown := utils.UnknownListOptions(metric.ListOptions, m.ListOptions())
+		if len(unknown) > 0 {
+			return nil, fmt.Errorf("%s does not have list options %s", metric.Name, strings.Join(unknown, ", "))
+		}
+
+		// An alias distinguishes the metric from others of the same name
+		m.SetAlias(metric.Alias)
+
+		// If the metric has a custom container, set here, otherwise the
+		// operator configuration can replace the default image
 		if metric.Image != "" {
 			m.SetContainer(metric.Image)
+		} else if image, ok := config.Image(metric.Name); ok {
+			m.SetContainer(image)
 		}
 
 		// Register addons, meaning adding the spec but not instantiating yet (or should we?)
 		for _, a := range metric.Addons {
 
-			logger.Infof("Attempting to add addon %s", a.Name)
+			logger.Debugf("Attempting to add addon %s", a.Name)
 			addon, err := addons.GetAddon(&a, set)
 			if err != nil {
-				return nil, fmt.Errorf("addon %s for metric %s did not validate", a.Name, metric.Name)
+				return nil, fmt.Errorf("addon %s for metric %s did not validate: %s", a.Name, metric.Name, err)
 			}
-			logger.Infof("Registering addon %s", a.Name)
+			logger.Debugf("Registering addon %s", a.Name)
 			m.RegisterAddon(&addon)
 		}
 
+		// Only some metrics have a PowerShell entrypoint for Windows
+		if set.IsWindows() && !m.SupportsWindows() {
+			return nil, fmt.Errorf("%s is not supported on Windows", metric.Name)
+		}
+
 		// After options are set, final validation
 		if !m.Validate(set) {
 			return nil, fmt.Errorf("%s did not validate", metric.Name)
 		}
+		err := validateTemplates(set, metric)
+		if err != nil {
+			return nil, fmt.Errorf("%s did not validate: %s", metric.Name, err)
+		}
 		return m, nil
 	}
 	return nil, fmt.Errorf("%s is not a registered Metric type", metric.Name)
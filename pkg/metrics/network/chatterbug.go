@@ -14,7 +14,6 @@ import (
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
@@ -89,7 +88,7 @@ func (m *Chatterbug) SetOptions(metric *api.Metric) {
 	if ok {
 		_, ok := ChatterbugApps[command.StrVal]
 		if !ok {
-			fmt.Printf("🟥️ Chatterbug command %s is not known", command.StrVal)
+			logger.Errorf("🟥️ Chatterbug command %s is not known", command.StrVal)
 		} else {
 			m.command = command.StrVal
 		}
@@ -129,24 +128,27 @@ func (n Chatterbug) Family() string {
 	return metrics.NetworkFamily
 }
 
-func (m Chatterbug) PrepareContainers(
-	spec *api.MetricSet,
-	metric *metrics.Metric,
-) []*specs.ContainerSpec {
-
-	// Metadata to add to beginning of run
-	meta := metrics.Metadata(spec, metric)
+// chatterbugContext is for the templates of the launcher and workers
+type chatterbugContext struct {
+	Metadata    string
+	Tasks       int32
+	Pods        int32
+	NetworkWait string
+	Hosts       string
+	Line        string
+	Interactive bool
+}
 
-	// The launcher has a different hostname, n for netmark
-	hosts := m.GetHostlist(spec)
-	prefixTemplate := `#!/bin/bash
+var (
+	// chatterbugPrefixTemplate starts sshd, and writes the hostlist (with ip addresses)
+	chatterbugPrefixTemplate = specs.NewTemplate(cbIdentifier+"-prefix", `#!/bin/bash
 # Start ssh daemon
 /usr/sbin/sshd -D &
 
 # If we have zero tasks, default to workers * nproc for total tasks
 # This is only for non point to point benchmarks
-np=%d
-pods=%d
+np={{ .Tasks }}
+pods={{ .Pods }}
 # Tasks per node, not total
 tasks=$(nproc)
 if [[ $np -eq 0 ]]; then
@@ -157,13 +159,11 @@ fi
 echo "Number of tasks (nproc on one node) is $tasks"
 echo "Number of tasks total (across $pods nodes) is $np"
 
-# Allow network to ready
-echo "Sleeping for 10 seconds waiting for network..."
-sleep 10
+{{ .NetworkWait }}
 
 # Write the hosts file.
 cat <<EOF > ./hostnames.txt
-%s
+{{ .Hosts }}
 EOF
 
 # openmpi is evil and we need the ip addresses
@@ -177,31 +177,50 @@ done
 
 cat ./hostlist.txt
 # Show metadata for run
-echo "%s"
-`
-	prefix := fmt.Sprintf(
-		prefixTemplate,
-		m.tasks,
-		spec.Spec.Pods,
-		hosts,
-		meta,
-	)
-
-	// Prepare command for chatterbug
-	commands := fmt.Sprintf("\nsleep 5\necho %s\n", metadata.CollectionStart)
+echo "{{ .Metadata }}"
+`, chatterbugContext{})
+
+	chatterbugPreTemplate = specs.NewTemplate(cbIdentifier, `
+sleep 5
+echo {{ collectionStart }}
+echo {{ separator }}
+echo "{{ .Line }}"
+`, chatterbugContext{})
+
+	chatterbugPostTemplate = specs.NewTemplate(cbIdentifier+"-post", `echo {{ collectionEnd }}
+{{ interactive .Interactive }}
+`, chatterbugContext{})
+)
 
+func (m Chatterbug) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	// The launcher has a different hostname, n for netmark
+	hosts := m.GetHostlist(spec)
 	// Full path to, e.g., /root/chatterbug/stencil3d/stencil3d.x
 	command := path.Join("/root/chatterbug", m.command, ChatterbugApps[m.command])
 	line := fmt.Sprintf("mpirun --hostfile ./hostlist.txt --allow-run-as-root %s %s %s", m.mpirun, command, m.args)
-
-	commands += fmt.Sprintf("echo %s\necho \"%s\"\n", metadata.Separator, line)
+	context := chatterbugContext{
+		Metadata:    meta,
+		Tasks:       m.tasks,
+		Pods:        m.TotalPods(spec),
+		NetworkWait: metrics.NetworkWaitBlock(spec, 10),
+		Hosts:       hosts,
+		Line:        line,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	prefix := chatterbugPrefixTemplate.Render(context)
 
 	// The pre block has the prefix and commands, up to the echo of the command (line)
-	preBlock := fmt.Sprintf("%s\n%s", prefix, commands)
+	preBlock := prefix + "\n" + chatterbugPreTemplate.Render(context)
 
 	// The post block has the collection end and interactive option
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	postBlock := fmt.Sprintf("echo %s\n%s\n", metadata.CollectionEnd, interactive)
+	postBlock := chatterbugPostTemplate.Render(context)
 
 	// The worker just has a preBlock with the prefix and the command is to sleep
 	launcherEntrypoint := specs.EntrypointScript{
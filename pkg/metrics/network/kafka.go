@@ -0,0 +1,261 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package network
+
+import (
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// Kafka producer throughput against an existing cluster
+// https://kafka.apache.org/documentation/#basic_ops_producer_perf
+
+const (
+	kafkaIdentifier = "network-kafka"
+	kafkaSummary    = "message bus (kafka) producer throughput and latency"
+	kafkaContainer  = "apache/kafka:3.7.0"
+	kafkaBin        = "/opt/kafka/bin"
+)
+
+var kafkaAcks = []string{"0", "1", "all", "-1"}
+
+type Kafka struct {
+	metrics.SingleApplication
+
+	// Secret with the bootstrap servers (and the key)
+	secretName string
+	secretKey  string
+
+	// Topic, and partitions to create it with (0 does not create it)
+	topic             string
+	partitions        int32
+	replicationFactor int32
+
+	// Seconds to wait for the topic before failing
+	topicTimeout int32
+
+	// Producer options
+	producers     int32
+	numRecords    int32
+	messageSize   int32
+	acks          string
+	throughput    int32
+	producerProps string
+}
+
+// Family returns the network family
+func (m Kafka) Family() string {
+	return metrics.NetworkFamily
+}
+
+func (m Kafka) Url() string {
+	return "https://kafka.apache.org/documentation/#basic_ops_producer_perf"
+}
+
+// Set custom options / attributes for the metric
+func (m *Kafka) SetOptions(metric *api.Metric) {
+
+	m.Identifier = kafkaIdentifier
+	m.Summary = kafkaSummary
+	m.Container = kafkaContainer
+	m.ResourceSpec = &metric.Resources
+	m.AttributeSpec = &metric.Attributes
+
+	// Defaults
+	m.secretKey = "bootstrap.servers"
+	m.topic = "metrics-operator"
+	m.replicationFactor = 1
+	m.topicTimeout = 300
+	m.producers = 1
+	m.numRecords = 1000000
+	m.messageSize = 1024
+	m.acks = "1"
+	m.throughput = -1
+
+	for key, value := range map[string]*string{
+		"secretName":    &m.secretName,
+		"secretKey":     &m.secretKey,
+		"topic":         &m.topic,
+		"acks":          &m.acks,
+		"producerProps": &m.producerProps,
+	} {
+		v, ok := metric.Options[key]
+		if ok {
+			*value = v.String()
+		}
+	}
+	for key, value := range map[string]*int32{
+		"partitions":        &m.partitions,
+		"replicationFactor": &m.replicationFactor,
+		"topicTimeout":      &m.topicTimeout,
+		"producers":         &m.producers,
+		"numRecords":        &m.numRecords,
+		"messageSize":       &m.messageSize,
+		"throughput":        &m.throughput,
+	} {
+		v, ok := metric.Options[key]
+		if ok {
+			*value = v.IntVal
+		}
+	}
+}
+
+// Validate we know where the cluster is, and the producer options
+func (m Kafka) Validate(spec *api.MetricSet) bool {
+	if m.secretName == "" {
+		logger.Errorf("🟥️ The network-kafka metric requires a 'secretName' with the bootstrap servers")
+		return false
+	}
+	valid := false
+	for _, acks := range kafkaAcks {
+		valid = valid || acks == m.acks
+	}
+	if !valid {
+		logger.Errorf("🟥️ The network-kafka acks must be one of %s, found %s", kafkaAcks, m.acks)
+		return false
+	}
+	if m.producers < 1 || m.numRecords < 1 || m.messageSize < 1 || m.topicTimeout < 1 {
+		logger.Errorf("🟥️ The network-kafka producers, numRecords, messageSize, and topicTimeout must be 1 or greater")
+		return false
+	}
+	return true
+}
+
+// Exported options and list options
+func (m Kafka) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"secretName":        intstr.FromString(m.secretName),
+		"secretKey":         intstr.FromString(m.secretKey),
+		"topic":             intstr.FromString(m.topic),
+		"partitions":        intstr.FromInt(int(m.partitions)),
+		"replicationFactor": intstr.FromInt(int(m.replicationFactor)),
+		"topicTimeout":      intstr.FromInt(int(m.topicTimeout)),
+		"producers":         intstr.FromInt(int(m.producers)),
+		"numRecords":        intstr.FromInt(int(m.numRecords)),
+		"messageSize":       intstr.FromInt(int(m.messageSize)),
+		"acks":              intstr.FromString(m.acks),
+		"throughput":        intstr.FromInt(int(m.throughput)),
+		"producerProps":     intstr.FromString(m.producerProps),
+	}
+}
+
+// kafkaContext is for the templates of the application container
+type kafkaContext struct {
+	Metadata          string
+	Bin               string
+	Topic             string
+	Partitions        int32
+	ReplicationFactor int32
+	TopicTimeout      int32
+
+	// Producer options
+	Producers   int32
+	NumRecords  int32
+	MessageSize int32
+	Throughput  int32
+	Acks        string
+	Props       string
+
+	Interactive bool
+}
+
+var (
+	// kafkaPreTemplate has the leader create the topic (if requested) and all wait for it,
+	// failing if it is not there after the timeout (e.g., the brokers are not reachable)
+	kafkaPreTemplate = specs.NewTemplate(kafkaIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+{{ if gt .Partitions 0 }}if mo_is_leader; then
+    {{ .Bin }}/kafka-topics.sh --bootstrap-server ${KAFKA_BOOTSTRAP_SERVERS} --create --if-not-exists --topic {{ .Topic }} --partitions {{ .Partitions }} --replication-factor {{ .ReplicationFactor }}
+fi
+topic_start=$(date +%s)
+until {{ .Bin }}/kafka-topics.sh --bootstrap-server ${KAFKA_BOOTSTRAP_SERVERS} --describe --topic {{ .Topic }} > /dev/null 2>&1; do
+    if [ $(( $(date +%s) - topic_start )) -ge {{ .TopicTimeout }} ]; then
+        echo "Topic {{ .Topic }} was not ready after {{ .TopicTimeout }} seconds" >&2
+        exit 1
+    fi
+    sleep 2
+done{{ end }}
+echo "{{ collectionStart }}"
+`, kafkaContext{})
+
+	kafkaCommandTemplate = specs.NewTemplate(kafkaIdentifier+"-command", `for producer in $(seq 1 {{ .Producers }}); do
+    {{ .Bin }}/kafka-producer-perf-test.sh --topic {{ .Topic }} --num-records {{ .NumRecords }} --record-size {{ .MessageSize }} --throughput {{ .Throughput }} --producer-props bootstrap.servers=${KAFKA_BOOTSTRAP_SERVERS} acks={{ .Acks }}{{ .Props }} > ${METRICS_OPERATOR_RESULTS}/producer-${producer}.log 2>&1 &
+done
+wait`, kafkaContext{})
+
+	// Each producer ends with a summary of records/sec, MB/sec, and latency percentiles
+	kafkaPostTemplate = specs.NewTemplate(kafkaIdentifier+"-post", `
+for producer in $(seq 1 {{ .Producers }}); do
+    echo "{{ separator }}"
+    echo "Producer ${producer}"
+    cat ${METRICS_OPERATOR_RESULTS}/producer-${producer}.log
+done
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, kafkaContext{})
+)
+
+func (m Kafka) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	props := ""
+	if m.producerProps != "" {
+		props = " " + m.producerProps
+	}
+	context := kafkaContext{
+		Metadata:          meta,
+		Bin:               kafkaBin,
+		Topic:             m.topic,
+		Partitions:        m.partitions,
+		ReplicationFactor: m.replicationFactor,
+		TopicTimeout:      m.topicTimeout,
+		Producers:         m.producers,
+		NumRecords:        m.numRecords,
+		MessageSize:       m.messageSize,
+		Throughput:        m.throughput,
+		Acks:              m.acks,
+		Props:             props,
+		Interactive:       spec.Spec.Logging.Interactive,
+	}
+	preBlock := kafkaPreTemplate.Render(context)
+	command := kafkaCommandTemplate.Render(context)
+	postBlock := kafkaPostTemplate.Render(context)
+	containers := m.ApplicationContainerSpec(preBlock, command, postBlock)
+
+	// The bootstrap servers are provided by a secret
+	containers[0].Env = append(containers[0].Env, corev1.EnvVar{
+		Name: "KAFKA_BOOTSTRAP_SERVERS",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: m.secretName},
+				Key:                  m.secretKey,
+			},
+		},
+	})
+	return containers
+}
+
+func init() {
+	base := metrics.BaseMetric{
+		Identifier: kafkaIdentifier,
+		Summary:    kafkaSummary,
+		Container:  kafkaContainer,
+	}
+	app := metrics.SingleApplication{BaseMetric: base}
+	kafka := Kafka{SingleApplication: app}
+	metrics.Register(&kafka)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package network
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+func TestKafkaTopicTimeout(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+
+	// A fake kafka-topics.sh describes the topic once it is ready
+	dir := t.TempDir()
+	topics := "#!/bin/sh\n[ \"$3\" = --create ] && exit 0\n[ -e " + filepath.Join(dir, "ready") + " ]\n"
+	err = os.WriteFile(filepath.Join(dir, "kafka-topics.sh"), []byte(topics), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pre := kafkaPreTemplate.Render(kafkaContext{Bin: dir, Topic: "metrics", Partitions: 1, ReplicationFactor: 1, TopicTimeout: 1})
+	run := func() (string, error) {
+		out, err := exec.Command(bash, "-c", specs.Prelude+pre).CombinedOutput()
+		return string(out), err
+	}
+
+	// Without the topic, we fail after the timeout instead of waiting forever
+	out, err := run()
+	if err == nil || !strings.Contains(out, "Topic metrics was not ready after 1 seconds") || strings.Contains(out, metadata.CollectionStart) {
+		t.Errorf("expected waiting for the topic to time out, found %v:\n%s", err, out)
+	}
+	err = os.WriteFile(filepath.Join(dir, "ready"), []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = run()
+	if err != nil || !strings.Contains(out, metadata.CollectionStart) {
+		t.Errorf("expected collection to start with the topic, found %v:\n%s", err, out)
+	}
+}
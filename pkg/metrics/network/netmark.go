@@ -14,7 +14,6 @@ import (
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 )
@@ -129,6 +128,51 @@ func (n Netmark) Options() map[string]intstr.IntOrString {
 	}
 }
 
+// netmarkContext is for the templates of the launcher and workers
+type netmarkContext struct {
+	Metadata    string
+	Tasks       int32
+	Pods        int32
+	Hosts       string
+	NetworkWait string
+	Interactive bool
+}
+
+var (
+	// netmarkPrefixTemplate starts sshd, and writes the hostlist
+	netmarkPrefixTemplate = specs.NewTemplate(netmarkIdentifier, `#!/bin/bash
+# Start ssh daemon
+/usr/sbin/sshd -D &
+echo "{{ .Metadata }}"
+
+# If we have zero tasks, default to workers * nproc
+np={{ .Tasks }}
+pods={{ .Pods }}
+if [[ $np -eq 0 ]]; then
+	np=$(nproc)
+	np=$(( $pods*$np ))
+fi
+
+# Write the hosts file
+cat <<EOF > ./hostlist.txt
+{{ .Hosts }}
+EOF
+
+{{ .NetworkWait }}
+echo "{{ collectionStart }}"
+`, netmarkContext{})
+
+	// netmarkPostTemplate prints the round trip times
+	netmarkPostTemplate = specs.NewTemplate(netmarkIdentifier+"-post", `
+ls
+echo "NETMARK RTT.CSV START"
+cat RTT.csv
+echo "NETMARK RTT.CSV END"
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, netmarkContext{})
+)
+
 func (m Netmark) PrepareContainers(
 	spec *api.MetricSet,
 	metric *metrics.Metric,
@@ -146,37 +190,15 @@ func (m Netmark) PrepareContainers(
 		storeTrial = "-s"
 	}
 
-	prefixTemplate := `#!/bin/bash
-# Start ssh daemon
-/usr/sbin/sshd -D &
-echo "%s"
-
-# If we have zero tasks, default to workers * nproc
-np=%d
-pods=%d
-if [[ $np -eq 0 ]]; then
-	np=$(nproc)
-	np=$(( $pods*$np ))
-fi
-
-# Write the hosts file
-cat <<EOF > ./hostlist.txt
-%s
-EOF
-
-# Allow network to ready
-echo "Sleeping for 10 seconds waiting for network..."
-sleep 10
-echo "%s"
-`
-	prefix := fmt.Sprintf(
-		prefixTemplate,
-		meta,
-		m.tasks,
-		spec.Spec.Pods,
-		hosts,
-		metadata.CollectionStart,
-	)
+	context := netmarkContext{
+		Metadata:    meta,
+		Tasks:       m.tasks,
+		Pods:        m.TotalPods(spec),
+		Hosts:       hosts,
+		NetworkWait: metrics.NetworkWaitBlock(spec, 10),
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	prefix := netmarkPrefixTemplate.Render(context)
 
 	// Netmark main command
 	command := "mpirun -f ./hostlist.txt -np $np /usr/local/bin/netmark.x -w %d -t %d -c %d -b %d %s"
@@ -190,21 +212,7 @@ echo "%s"
 	)
 	// The preBlock is also the prefix
 	preBlock := prefix
-
-	postBlock := `
-ls
-echo "NETMARK RTT.CSV START"
-cat RTT.csv
-echo "NETMARK RTT.CSV END"
-echo "%s"
-%s
-`
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	postBlock = fmt.Sprintf(
-		postBlock,
-		metadata.CollectionEnd,
-		interactive,
-	)
+	postBlock := netmarkPostTemplate.Render(context)
 
 	// The worker just has a preBlock with the prefix and the command is to sleep
 	launcherEntrypoint := specs.EntrypointScript{
@@ -17,6 +17,7 @@ import (
 	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/utils"
 )
 
 // ghcr.io/converged-computing/metric-osu-benchmark:latest
@@ -39,6 +40,10 @@ var (
 	collectiveDir   = "/opt/osu-benchmark/build.openmpi/libexec/osu-micro-benchmarks/mpi/collective"
 	startupDir      = "/opt/osu-benchmark/build.openmpi/libexec/osu-micro-benchmarks/mpi/startup"
 
+	// Pair to pair benchmarks run with two hosts (and are the ones run for a matrix)
+	pairsHostFile  = "./hostlist-pairs.txt"
+	matrixHostFile = "./hostlist-matrix.txt"
+
 	// Defaults that we provide when none specified
 	osuBenchmarkDefaults = []string{
 		"osu_get_acc_latency",
@@ -121,6 +126,10 @@ type OSUBenchmark struct {
 	flags    string
 	timed    bool
 	sleep    int32
+
+	// Run the pair to pair benchmarks between every (or a sample of) pair of pods
+	matrix      bool
+	matrixPairs int32
 }
 
 func (m OSUBenchmark) Url() string {
@@ -156,14 +165,11 @@ func (m *OSUBenchmark) SetOptions(metric *api.Metric) {
 	m.SoleTenancy = true
 
 	// We are allowed to specify just one command
-	opts, ok := metric.ListOptions["commands"]
-	if ok {
-		// Parse list options that are valid
-		for _, opt := range opts {
-			_, ok := osuBenchmarkCommands[opt.StrVal]
-			if ok && !m.hasCommand(opt.StrVal) {
-				m.addCommand(opt.StrVal)
-			}
+	// Parse list options that are valid
+	for _, command := range utils.ListStrings(metric.ListOptions["commands"]) {
+		_, ok := osuBenchmarkCommands[command]
+		if ok && !m.hasCommand(command) {
+			m.addCommand(command)
 		}
 	}
 
@@ -192,6 +198,14 @@ func (m *OSUBenchmark) SetOptions(metric *api.Metric) {
 	if ok {
 		m.flags = flags.StrVal
 	}
+	matrix, ok := metric.Options["matrix"]
+	if ok && matrix.StrVal == "true" || matrix.StrVal == "yes" {
+		m.matrix = true
+	}
+	matrixPairs, ok := metric.Options["matrixPairs"]
+	if ok {
+		m.matrixPairs = matrixPairs.IntVal
+	}
 
 	// If not selected or found, fall back to default list
 	if len(m.commands) == 0 {
@@ -220,24 +234,38 @@ func (m OSUBenchmark) Options() map[string]intstr.IntOrString {
 		"flags":        intstr.FromString(m.flags),
 		"timed":        intstr.FromString(fmt.Sprintf("%v", m.timed)),
 		"all":          intstr.FromString(fmt.Sprintf("%v", m.runAll)),
+		"matrix":       intstr.FromString(fmt.Sprintf("%v", m.matrix)),
+		"matrixPairs":  intstr.FromInt(int(m.matrixPairs)),
 	}
 }
 func (m OSUBenchmark) ListOptions() map[string][]intstr.IntOrString {
-	commands := []intstr.IntOrString{}
-	for _, command := range m.commands {
-		commands = append(commands, intstr.FromString(command))
-	}
 	return map[string][]intstr.IntOrString{
-		"commands": commands,
+		"commands": utils.StringList(m.commands),
 	}
 }
 
 // OSU Benchmarks pair to pair must be run with only two nodes
 func (m OSUBenchmark) Validate(spec *api.MetricSet) bool {
 	if len(m.commands) == 0 {
-		fmt.Printf("🟥️ OSUBenchmark not valid, requires 1+ commands.")
+		logger.Errorf("🟥️ OSUBenchmark not valid, requires 1+ commands.")
+		return false
+	}
+	if m.matrixPairs < 0 {
+		logger.Errorf("🟥️ OSUBenchmark matrixPairs must be 0 (all pairs) or more, found %d.", m.matrixPairs)
 		return false
 	}
+	if m.matrix {
+		pairs := 0
+		for _, command := range m.commands {
+			if osuBenchmarkCommands[command].HostFile == pairsHostFile {
+				pairs += 1
+			}
+		}
+		if pairs == 0 {
+			logger.Errorf("🟥️ OSUBenchmark matrix requires 1+ pair to pair commands.")
+			return false
+		}
+	}
 	return true
 }
 
@@ -246,24 +274,33 @@ func (n OSUBenchmark) Family() string {
 	return metrics.NetworkFamily
 }
 
-func (m OSUBenchmark) PrepareContainers(
-	spec *api.MetricSet,
-	metric *metrics.Metric,
-) []*specs.ContainerSpec {
-
-	// Metadata to add to beginning of run
-	meta := metrics.Metadata(spec, metric)
+// osuContext is for the templates of the launcher and workers
+type osuContext struct {
+	Metadata         string
+	Tasks            int32
+	Pods             int32
+	NetworkWait      string
+	Hosts            string
+	ConvertHostnames string
+
+	// A command (line) to run, and the pairs to sample for a matrix
+	Line        string
+	MatrixPairs int32
+	MatrixPair  string
+
+	Interactive bool
+}
 
-	// The launcher has a different hostname, n for netmark
-	hosts := m.GetHostlist(spec)
-	prefixTemplate := `#!/bin/bash
+var (
+	// osuPrefixTemplate starts sshd, and writes the hostlists
+	osuPrefixTemplate = specs.NewTemplate(OSUIdentifier+"-prefix", `#!/bin/bash
 # Start ssh daemon
 /usr/sbin/sshd -D &
 
 # If we have zero tasks, default to workers * nproc for total tasks
 # This is only for non point to point benchmarks
-np=%d
-pods=%d
+np={{ .Tasks }}
+pods={{ .Pods }}
 # Tasks per node, not total
 tasks=$(nproc)
 if [[ $np -eq 0 ]]; then
@@ -273,17 +310,14 @@ fi
 echo "Number of tasks (nproc on one node) is $tasks"
 echo "Number of tasks total (across $pods nodes) is $np"
 
-# Allow network to ready (we need the hostnames / ip addresses to be there)
-sleeptime=%d
-echo "Sleeping for ${sleeptime} seconds waiting for network..."
-sleep ${sleeptime}
+{{ .NetworkWait }}
 
 # Write the hosts file.
 cat <<EOF > ./hostnames.txt
-%s
+{{ .Hosts }}
 EOF
 
-%s
+{{ .ConvertHostnames }}
 
 # prepare hostlist for pair to pair
 cat hostlist.txt | head -2 > ./hostlist-pairs.txt
@@ -295,17 +329,82 @@ echo "Hostlist for Pair to Pair"
 cat ./hostlist-pairs.txt
 
 # Show metadata for run
-echo "%s"
-`
-	prefix := fmt.Sprintf(
-		prefixTemplate,
-		m.tasks,
-		spec.Spec.Pods,
-		m.sleep,
-		hosts,
-		metrics.TemplateConvertHostnames,
-		meta,
-	)
+echo "{{ .Metadata }}"
+`, osuContext{})
+
+	osuCommandTemplate = specs.NewTemplate(OSUIdentifier, `echo {{ separator }}
+echo "{{ .Line }}"
+{{ .Line }}
+`, osuContext{})
+
+	// Each pair to pair benchmark of a matrix is a section (timepoint) per pair, where the
+	// pair line (indices and hostnames of the first and second rank) comes after the command
+	osuMatrixTemplate = specs.NewTemplate(OSUIdentifier+"-matrix", `for pair in $(cat ./matrix-pairs.txt); do
+    src=${pair%%:*}
+    dst=${pair##*:}
+    sed -n "${src}p" ./hostlist.txt > ./hostlist-matrix.txt
+    sed -n "${dst}p" ./hostlist.txt >> ./hostlist-matrix.txt
+    echo {{ separator }}
+    echo "{{ .Line }}"
+    echo "{{ .MatrixPair }} ${src} ${dst} $(sed -n "${src}p" ./hostnames.txt) $(sed -n "${dst}p" ./hostnames.txt)"
+    {{ .Line }}
+done
+`, osuContext{})
+
+	// osuMatrixPrefixTemplate writes the ordered pairs of host indices (both directions,
+	// since links can be asymmetric) to run, optionally sampled
+	osuMatrixPrefixTemplate = specs.NewTemplate(OSUIdentifier+"-matrix-prefix", `
+# Prepare pairs of hosts (by line in the hostlist) for the matrix
+hosts=$(cat ./hostlist.txt | wc -l)
+rm -f ./matrix-pairs.txt
+for src in $(seq 1 ${hosts}); do
+    for dst in $(seq 1 ${hosts}); do
+        if [[ ${src} -ne ${dst} ]]; then
+            echo "${src}:${dst}" >> ./matrix-pairs.txt
+        fi
+    done
+done
+{{ if gt .MatrixPairs 0 }}shuf -n {{ .MatrixPairs }} ./matrix-pairs.txt > ./matrix-sample.txt
+mv ./matrix-sample.txt ./matrix-pairs.txt
+{{ end }}echo "Running $(cat ./matrix-pairs.txt | wc -l) pairs of ${hosts} hosts for the matrix"
+`, osuContext{})
+
+	// osuPostTemplate is just closing the collection, and optionally interactive mode
+	osuPostTemplate = specs.NewTemplate(OSUIdentifier+"-post", `echo {{ collectionEnd }}
+{{ interactive .Interactive }}
+`, osuContext{})
+)
+
+// matrixPrefix writes the pairs of hosts to run for the matrix
+func (m OSUBenchmark) matrixPrefix() string {
+	return osuMatrixPrefixTemplate.Render(osuContext{MatrixPairs: m.matrixPairs})
+}
+
+// matrixBlock runs a pair to pair benchmark (line) for each pair of hosts
+func matrixBlock(line string) string {
+	return osuMatrixTemplate.Render(osuContext{Line: line, MatrixPair: metadata.MatrixPair})
+}
+
+func (m OSUBenchmark) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	// The launcher has a different hostname, n for netmark
+	hosts := m.GetHostlist(spec)
+	context := osuContext{
+		Metadata:         meta,
+		Tasks:            m.tasks,
+		Pods:             m.TotalPods(spec),
+		NetworkWait:      metrics.NetworkWaitBlock(spec, m.sleep),
+		Hosts:            hosts,
+		ConvertHostnames: metrics.TemplateConvertHostnames,
+		Interactive:      spec.Spec.Logging.Interactive,
+	}
+	prefix := osuPrefixTemplate.Render(context)
 
 	// Do we want timed?
 	mpirun := "mpirun"
@@ -318,6 +417,9 @@ echo "%s"
 	// mpirun --hostfile ./hostfile.txt --allow-run-as-root -N 2 -np 2 ./osu_fop_latency (openmpi)
 	// Sleep a little more to allow worker to write launcher hostname
 	commands := fmt.Sprintf("\nsleep 5\necho %s\n", metadata.CollectionStart)
+	if m.matrix {
+		commands = m.matrixPrefix() + commands
+	}
 	for _, executable := range m.commands {
 
 		workDir := osuBenchmarkCommands[executable].Workdir
@@ -330,6 +432,13 @@ echo "%s"
 		}
 		hostfile := osuBenchmarkCommands[executable].HostFile
 
+		// For a matrix, pair to pair benchmarks run for each pair of hosts
+		if m.matrix && hostfile == pairsHostFile {
+			line := fmt.Sprintf("%s --hostfile %s --allow-run-as-root %s %s", mpirun, matrixHostFile, flags, command)
+			commands += matrixBlock(line)
+			continue
+		}
+
 		// Some pair to pair is for 2 nodes
 		var line string
 		if workDir == pointToPointDir || workDir == singleSidedDir {
@@ -337,15 +446,15 @@ echo "%s"
 		} else {
 			line = fmt.Sprintf("%s --hostfile %s --allow-run-as-root %s %s", mpirun, hostfile, flags, command)
 		}
-		commands += fmt.Sprintf("echo %s\necho \"%s\"\n%s\n", metadata.Separator, line, line)
+		context.Line = line
+		commands += osuCommandTemplate.Render(context)
 	}
 
 	// The pre block has the prefix and commands
 	preBlock := fmt.Sprintf("%s\n%s", prefix, commands)
 
-	// The post block is just closing the colletion, and optionally interactive mode
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	postBlock := fmt.Sprintf("echo %s\n%s\n", metadata.CollectionEnd, interactive)
+	// The post block is just closing the collection, and optionally interactive mode
+	postBlock := osuPostTemplate.Render(context)
 
 	// The worker just has a preBlock with the prefix and the command is to sleep
 	launcherEntrypoint := specs.EntrypointScript{
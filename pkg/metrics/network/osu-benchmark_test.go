@@ -0,0 +1,74 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package network
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+)
+
+func TestOSUMatrix(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run shell blocks")
+	}
+	tests := []struct {
+		pairs    int32
+		expected int
+	}{
+		{pairs: 0, expected: 6},
+		{pairs: 2, expected: 2},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		err := os.WriteFile(filepath.Join(dir, "hostlist.txt"), []byte("10.0.0.1\n10.0.0.2\n10.0.0.3\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, "hostnames.txt"), []byte("l-0\nw-0\nw-1\n\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// mpirun prints the hosts it was given (the first is rank 0)
+		m := OSUBenchmark{matrixPairs: test.pairs}
+		line := fmt.Sprintf("mpirun --hostfile %s osu_bw", matrixHostFile)
+		script := "mpirun() { echo ranks $(cat $2 | tr '\\n' ' '); }\n" + m.matrixPrefix() + matrixBlock(line)
+		cmd := exec.Command(bash, "-c", script)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("matrix failed: %s\n%s", err, out)
+		}
+		output := string(out)
+		if strings.Count(output, metadata.Separator) != test.expected {
+			t.Errorf("expected %d pairs, found %s", test.expected, output)
+		}
+		if test.pairs > 0 {
+			continue
+		}
+		for _, expected := range []string{
+			metadata.MatrixPair + " 1 2 l-0 w-0\nranks 10.0.0.1 10.0.0.2",
+			metadata.MatrixPair + " 2 1 w-0 l-0\nranks 10.0.0.2 10.0.0.1",
+			metadata.MatrixPair + " 3 2 w-1 w-0\nranks 10.0.0.3 10.0.0.2",
+		} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("expected output to include %q, found %s", expected, output)
+			}
+		}
+		if strings.Contains(output, metadata.MatrixPair+" 1 1") {
+			t.Errorf("expected a host to not be paired with itself, found %s", output)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package network
+
+import (
+	"fmt"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// Packet rate (packets per second) with small messages, for evaluating a CNI or
+// NIC (e.g., an SR-IOV virtual function) beyond bulk throughput.
+// https://hewlettpackard.github.io/netperf/doc/netperf.html
+
+const (
+	ppsIdentifier = "network-pps"
+	ppsSummary    = "packet rate (packets per second) with small UDP messages"
+	ppsContainer  = "ghcr.io/converged-computing/metric-netperf:latest"
+)
+
+// Output selectors for each netperf test, printed as key=value lines (-k)
+var ppsSelectors = map[string]string{
+	"UDP_RR":     "THROUGHPUT,THROUGHPUT_UNITS,MEAN_LATENCY,P50_LATENCY,P99_LATENCY,ELAPSED_TIME",
+	"UDP_STREAM": "THROUGHPUT,THROUGHPUT_UNITS,LOCAL_SEND_CALLS,REMOTE_RECV_CALLS,ELAPSED_TIME",
+}
+
+type PacketRate struct {
+	metrics.LauncherWorker
+
+	// netperf tests and message sizes (bytes) to run each at
+	tests []string
+	sizes []int32
+
+	// Seconds for each test
+	duration int32
+
+	// Data interface (e.g., net1 of a secondary network) and worker addresses on it
+	iface     string
+	addresses []string
+}
+
+// Family returns the network family
+func (m PacketRate) Family() string {
+	return metrics.NetworkFamily
+}
+
+func (m PacketRate) Url() string {
+	return "https://hewlettpackard.github.io/netperf/doc/netperf.html"
+}
+
+// Set custom options / attributes for the metric
+func (m *PacketRate) SetOptions(metric *api.Metric) {
+	m.SetDefaultOptions(metric)
+
+	m.Identifier = ppsIdentifier
+	m.Summary = ppsSummary
+	m.Container = ppsContainer
+
+	// One pod per node, so packets go over the wire
+	m.SoleTenancy = true
+
+	// Defaults
+	m.tests = []string{"UDP_RR", "UDP_STREAM"}
+	m.sizes = []int32{64}
+	m.duration = 10
+
+	st, ok := metric.Options["soleTenancy"]
+	if ok && (st.StrVal == "false" || st.StrVal == "no") {
+		m.SoleTenancy = false
+	}
+	v, ok := metric.Options["duration"]
+	if ok {
+		m.duration = v.IntVal
+	}
+	v, ok = metric.Options["interface"]
+	if ok {
+		m.iface = v.StrVal
+	}
+	tests, ok := metric.ListOptions["tests"]
+	if ok {
+		m.tests = []string{}
+		for _, test := range tests {
+			m.tests = append(m.tests, strings.ToUpper(test.StrVal))
+		}
+	}
+	sizes, ok := metric.ListOptions["sizes"]
+	if ok {
+		m.sizes = []int32{}
+		for _, size := range sizes {
+			m.sizes = append(m.sizes, size.IntVal)
+		}
+	}
+	addresses, ok := metric.ListOptions["addresses"]
+	if ok {
+		for _, address := range addresses {
+			m.addresses = append(m.addresses, address.StrVal)
+		}
+	}
+}
+
+// Validate the tests and sizes, and that the data interface has worker addresses
+func (m PacketRate) Validate(spec *api.MetricSet) bool {
+	if !m.LauncherWorker.Validate(spec) {
+		return false
+	}
+	if len(m.tests) == 0 || len(m.sizes) == 0 {
+		logger.Errorf("🟥️ The network-pps metric needs one or more tests and sizes")
+		return false
+	}
+	for _, test := range m.tests {
+		if _, ok := ppsSelectors[test]; !ok {
+			logger.Errorf("🟥️ The network-pps test %s is not known, choices are UDP_RR or UDP_STREAM", test)
+			return false
+		}
+	}
+	for _, size := range m.sizes {
+		if size < 1 || size > 65507 {
+			logger.Errorf("🟥️ The network-pps sizes must be between 1 and 65507 bytes, found %d", size)
+			return false
+		}
+	}
+	if m.duration < 1 {
+		logger.Errorf("🟥️ The network-pps duration must be 1 or more seconds")
+		return false
+	}
+	workers := int(m.Workers(spec))
+	if m.iface != "" && len(m.addresses) != workers {
+		logger.Errorf("🟥️ The network-pps interface %s needs an address for each of %d workers, found %d", m.iface, workers, len(m.addresses))
+		return false
+	}
+	if m.iface == "" && len(m.addresses) > 0 {
+		logger.Errorf("🟥️ The network-pps addresses are for the data interface, which is not set")
+		return false
+	}
+	return true
+}
+
+// Exported options and list options
+func (m PacketRate) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"duration":  intstr.FromInt(int(m.duration)),
+		"interface": intstr.FromString(m.iface),
+		"command":   intstr.FromString(m.Command),
+		"prefix":    intstr.FromString(m.Prefix),
+	}
+}
+
+func (m PacketRate) ListOptions() map[string][]intstr.IntOrString {
+	tests := []intstr.IntOrString{}
+	for _, test := range m.tests {
+		tests = append(tests, intstr.FromString(test))
+	}
+	sizes := []intstr.IntOrString{}
+	for _, size := range m.sizes {
+		sizes = append(sizes, intstr.FromInt(int(size)))
+	}
+	addresses := []intstr.IntOrString{}
+	for _, address := range m.addresses {
+		addresses = append(addresses, intstr.FromString(address))
+	}
+	return map[string][]intstr.IntOrString{
+		"tests":     tests,
+		"sizes":     sizes,
+		"addresses": addresses,
+	}
+}
+
+// ppsContext is for the templates of the launcher
+type ppsContext struct {
+	Metadata    string
+	Workers     string
+	NetworkWait string
+	Interactive bool
+
+	// The data interface of the launcher (the workers are given)
+	Interface string
+	Addresses []string
+
+	// A netperf test at a size
+	Test      string
+	Size      int32
+	Prefix    string
+	Duration  int32
+	Flag      string
+	Selectors string
+}
+
+var (
+	// ppsPreTemplate waits for each netserver to answer
+	ppsPreTemplate = specs.NewTemplate(ppsIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+workers="{{ .Workers }}"
+{{ .NetworkWait }}
+{{ if .Interface }}addresses=({{ join .Addresses " " }})
+local=$(ip -4 -o addr show dev {{ .Interface }} | awk '{print $4}' | cut -d/ -f1)
+echo "PPS INTERFACE {{ .Interface }} ${local}"{{ end }}
+# Wait (up to two minutes) for each netserver to answer
+for host in ${workers}; do
+    tries=60
+    until netperf -H ${host} -t UDP_RR -l 1 > /dev/null 2>&1; do
+        tries=$((tries-1))
+        if [[ ${tries} -eq 0 ]]; then
+            echo "netserver on ${host} did not answer"
+            exit 1
+        fi
+        sleep 2
+    done
+done
+echo "{{ collectionStart }}"
+`, ppsContext{})
+
+	// ppsTestTemplate runs one test (at one size) against a worker
+	ppsTestTemplate = specs.NewTemplate(ppsIdentifier+"-test", `    echo "{{ separator }}"
+    echo "PPS TEST {{ .Test }} SIZE {{ .Size }} HOST ${host}"
+    {{ .Prefix }} netperf -H ${host} -t {{ .Test }} -l {{ .Duration }} ${data} {{ .Flag }} -k {{ .Selectors }}
+`, ppsContext{})
+
+	// ppsPostTemplate ends the collection (and sleeps, if interactive)
+	ppsPostTemplate = specs.NewTemplate(ppsIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, ppsContext{})
+)
+
+// getCommand runs each test at each size against each worker in turn, so only
+// one stream is on the wire at a time
+func (m PacketRate) getCommand() string {
+	if m.Command != "" {
+		return m.Command
+	}
+	command := "index=0\nfor host in ${workers}; do\n"
+	if m.iface != "" {
+		command += "    data=\"-- -L ${local} -H ${addresses[${index}]}\"\n"
+	} else {
+		command += "    data=\"--\"\n"
+	}
+	for _, test := range m.tests {
+		for _, size := range m.sizes {
+			flag := fmt.Sprintf("-m %d", size)
+			if test == "UDP_RR" {
+				flag = fmt.Sprintf("-r %d,%d", size, size)
+			}
+			command += ppsTestTemplate.Render(ppsContext{
+				Test:      test,
+				Size:      size,
+				Prefix:    m.Prefix,
+				Duration:  m.duration,
+				Flag:      flag,
+				Selectors: ppsSelectors[test],
+			})
+		}
+	}
+	return command + "    index=$((index+1))\ndone"
+}
+
+func (m PacketRate) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	// The first host is the launcher, and the rest run netserver
+	hosts := m.GetHostlist(spec)
+	workers := strings.TrimSpace(strings.Join(strings.Split(strings.TrimSpace(hosts), "\n")[1:], " "))
+
+	context := ppsContext{
+		Metadata:    meta,
+		Workers:     workers,
+		NetworkWait: metrics.NetworkWaitBlock(spec, 10),
+		Interface:   m.iface,
+		Addresses:   m.addresses,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	preBlock := ppsPreTemplate.Render(context)
+	postBlock := ppsPostTemplate.Render(context)
+
+	launcherEntrypoint := specs.EntrypointScript{
+		Name:    specs.DeriveScriptKey(m.LauncherScript),
+		Path:    m.LauncherScript,
+		Pre:     preBlock,
+		Command: m.getCommand(),
+		Post:    postBlock,
+	}
+
+	// Workers serve until the launcher is done
+	workerEntrypoint := specs.EntrypointScript{
+		Name:    specs.DeriveScriptKey(m.WorkerScript),
+		Path:    m.WorkerScript,
+		Pre:     fmt.Sprintf("#!/bin/bash\necho \"%s\"", meta),
+		Command: "netserver -D -4",
+	}
+
+	launcherContainer := m.GetLauncherContainerSpec(launcherEntrypoint)
+	workerContainer := m.GetWorkerContainerSpec(workerEntrypoint)
+	return []*specs.ContainerSpec{&launcherContainer, &workerContainer}
+}
+
+func init() {
+	base := metrics.BaseMetric{
+		Identifier: ppsIdentifier,
+		Summary:    ppsSummary,
+		Container:  ppsContainer,
+	}
+	launcher := metrics.LauncherWorker{BaseMetric: base}
+	pps := PacketRate{LauncherWorker: launcher}
+	metrics.Register(&pps)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// applyOverrides adds a block to the entrypoint of a metric container that
+// sets the environment and flags of the overrides matching the completion index
+// of the pod (METRICS_OPERATOR_INDEX, from the prelude). Flags are appended to a
+// command on one line, and other commands can use ${METRICS_OPERATOR_FLAGS}.
+func applyOverrides(metric api.Metric, c *specs.ContainerSpec) error {
+	block := ""
+	flags := false
+	for _, override := range metric.Overrides {
+		if override.Job != "" && override.Job != c.JobName {
+			continue
+		}
+		ranges, err := override.Ranges()
+		if err != nil {
+			return fmt.Errorf("metric %s override: %s", metric.Name, err)
+		}
+		conditions := []string{}
+		for _, r := range ranges {
+			condition := fmt.Sprintf("[ ${METRICS_OPERATOR_INDEX} -ge %d ]", r.Start)
+			if r.End >= 0 {
+				condition += fmt.Sprintf(" && [ ${METRICS_OPERATOR_INDEX} -le %d ]", r.End)
+			}
+			conditions = append(conditions, "{ "+condition+"; }")
+		}
+		names := []string{}
+		for name := range override.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		body := ""
+		for _, name := range names {
+			body += fmt.Sprintf("    export %s=%s\n", name, specs.ShellQuote(override.Env[name]))
+		}
+		if override.Flags != "" {
+			body += fmt.Sprintf("    METRICS_OPERATOR_FLAGS=%s\n", specs.ShellQuote(override.Flags))
+			flags = true
+		}
+		if body == "" {
+			continue
+		}
+		block += fmt.Sprintf("if %s; then\n%sfi\n", strings.Join(conditions, " || "), body)
+	}
+	if block == "" {
+		return nil
+	}
+	c.EntrypointScript.Pre += "\n# Overrides by completion index\nexport METRICS_OPERATOR_FLAGS=\"\"\n" + block
+	command := strings.TrimSpace(c.EntrypointScript.Command)
+	if flags && command != "" && !strings.Contains(command, "\n") {
+		c.EntrypointScript.Command = command + " ${METRICS_OPERATOR_FLAGS}"
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is required to run the entrypoint")
+	}
+	metric := api.Metric{
+		Name: "io-ior",
+		Overrides: []api.IndexOverride{
+			{Indices: "0-1", Env: map[string]string{"ROLE": "server", "NOTE": "it's quoted"}, Flags: "--serve"},
+			{Indices: "2-", Env: map[string]string{"ROLE": "client"}},
+			{Indices: "3,5", Env: map[string]string{"EXTRA": "yes"}},
+			{Indices: "0", Job: "w", Env: map[string]string{"ROLE": "worker"}},
+		},
+	}
+	c := &specs.ContainerSpec{
+		JobName:          "m",
+		EntrypointScript: specs.EntrypointScript{Command: "echo ${ROLE} ${EXTRA:-no} args"},
+	}
+	err = applyOverrides(metric, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(c.EntrypointScript.Pre, "worker") {
+		t.Errorf("expected an override for another job to be skipped")
+	}
+
+	expected := map[int]string{
+		0: "server no args --serve\nit's quoted",
+		1: "server no args --serve\nit's quoted",
+		2: "client no args\n",
+		3: "client yes args\n",
+		5: "client yes args\n",
+	}
+	for index, output := range expected {
+		script := fmt.Sprintf("METRICS_OPERATOR_INDEX=%d\n%s\n%s\necho \"${NOTE}\"", index, c.EntrypointScript.Pre, c.EntrypointScript.Command)
+		out, err := exec.Command(sh, "-c", script).CombinedOutput()
+		if err != nil {
+			t.Fatalf("index %d: %s\n%s", index, err, out)
+		}
+		if strings.TrimSpace(string(out)) != strings.TrimSpace(output) {
+			t.Errorf("expected index %d to output %q, found %q", index, output, out)
+		}
+	}
+
+	// Indices that are not numbers or ranges do not validate
+	for _, indices := range []string{"", "a", "3-1", "-2"} {
+		override := api.IndexOverride{Indices: indices}
+		if _, err := override.Ranges(); err == nil {
+			t.Errorf("expected indices %q to not be valid", indices)
+		}
+	}
+}
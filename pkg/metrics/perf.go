@@ -0,0 +1,26 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getPerfEnvironment provides the perf_event_paranoid value the tuning DaemonSet
+// sets, so perf addons can wait for it instead of setting it themselves
+func getPerfEnvironment(set *api.MetricSet) []corev1.EnvVar {
+	if !set.Spec.PerfEvents.Enabled() {
+		return []corev1.EnvVar{}
+	}
+	return []corev1.EnvVar{
+		{Name: "METRICS_OPERATOR_PERF_PARANOID", Value: fmt.Sprintf("%d", set.Spec.PerfEvents.Paranoid)},
+	}
+}
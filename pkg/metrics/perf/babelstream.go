@@ -0,0 +1,177 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package perf
+
+import (
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	babelstreamIdentifier = "perf-babelstream"
+	babelstreamSummary    = "GPU memory bandwidth (copy, mul, add, triad, and dot) for each device"
+	babelstreamContainer  = "ghcr.io/converged-computing/metric-babelstream:latest"
+)
+
+// BabelStream is built for each programming model, e.g., cuda-stream
+var babelstreamModels = []string{"cuda", "hip", "omp", "sycl"}
+
+type BabelStream struct {
+	metrics.SingleApplication
+
+	// Custom Options
+	model     string
+	arraysize int32
+	numtimes  int32
+	float     bool
+}
+
+func (m BabelStream) Url() string {
+	return "https://github.com/UoB-HPC/BabelStream"
+}
+
+// One pod per node, so each pod measures all the GPUs on it
+func (m BabelStream) HasSoleTenancy() bool {
+	return true
+}
+
+// Set custom options / attributes for the metric
+func (m *BabelStream) SetOptions(metric *api.Metric) {
+
+	m.Identifier = babelstreamIdentifier
+	m.Summary = babelstreamSummary
+	m.Container = babelstreamContainer
+	m.ResourceSpec = &metric.Resources
+	m.AttributeSpec = &metric.Attributes
+	m.SoleTenancy = true
+
+	// BabelStream defaults (2^25 elements, 100 times)
+	m.model = "cuda"
+	m.arraysize = 33554432
+	m.numtimes = 100
+
+	model, ok := metric.Options["model"]
+	if ok {
+		m.model = model.StrVal
+	}
+	arraysize, ok := metric.Options["arraysize"]
+	if ok {
+		m.arraysize = arraysize.IntVal
+	}
+	numtimes, ok := metric.Options["numtimes"]
+	if ok {
+		m.numtimes = numtimes.IntVal
+	}
+	float, ok := metric.Options["float"]
+	if ok {
+		m.float = float.StrVal == "true" || float.StrVal == "yes"
+	}
+}
+
+// Validate the model and sizes
+func (m BabelStream) Validate(spec *api.MetricSet) bool {
+	valid := false
+	for _, model := range babelstreamModels {
+		valid = valid || model == m.model
+	}
+	if !valid {
+		logger.Errorf("🟥️ BabelStream model must be one of %s, found %s", babelstreamModels, m.model)
+		return false
+	}
+	if m.arraysize < 1 || m.numtimes < 2 {
+		logger.Errorf("🟥️ BabelStream arraysize must be 1 or greater, and numtimes 2 or greater")
+		return false
+	}
+	return true
+}
+
+// Exported options and list options
+func (m BabelStream) Options() map[string]intstr.IntOrString {
+	float := "false"
+	if m.float {
+		float = "true"
+	}
+	return map[string]intstr.IntOrString{
+		"model":     intstr.FromString(m.model),
+		"arraysize": intstr.FromInt(int(m.arraysize)),
+		"numtimes":  intstr.FromInt(int(m.numtimes)),
+		"float":     intstr.FromString(float),
+	}
+}
+
+// babelstreamContext is for the templates of the application container
+type babelstreamContext struct {
+	Metadata    string
+	Model       string
+	Arraysize   int32
+	Numtimes    int32
+	Float       bool
+	Interactive bool
+}
+
+var (
+	// babelstreamPreTemplate lists the devices visible to the pod
+	babelstreamPreTemplate = specs.NewTemplate(babelstreamIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+stream={{ .Model }}-stream
+
+# Each device visible to the pod is measured separately
+devices=$(${stream} --list | grep -cE '^ *[0-9]+:')
+echo "Found ${devices} devices"
+${stream} --list
+echo "{{ collectionStart }}"
+`, babelstreamContext{})
+
+	// babelstreamCommandTemplate measures each device separately
+	babelstreamCommandTemplate = specs.NewTemplate(babelstreamIdentifier+"-command", `for device in $(seq 0 $(( devices - 1 ))); do
+    echo "{{ separator }}"
+    echo "Device ${device}"
+    ${stream} --device ${device} --arraysize {{ .Arraysize }} --numtimes {{ .Numtimes }}{{ if .Float }} --float{{ end }} --csv | tee ${METRICS_OPERATOR_RESULTS}/babelstream-device-${device}.csv
+done`, babelstreamContext{})
+
+	// babelstreamPostTemplate ends the collection (and sleeps, if interactive)
+	babelstreamPostTemplate = specs.NewTemplate(babelstreamIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, babelstreamContext{})
+)
+
+func (m BabelStream) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	context := babelstreamContext{
+		Metadata:    meta,
+		Model:       m.model,
+		Arraysize:   m.arraysize,
+		Numtimes:    m.numtimes,
+		Float:       m.float,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	preBlock := babelstreamPreTemplate.Render(context)
+	command := babelstreamCommandTemplate.Render(context)
+	postBlock := babelstreamPostTemplate.Render(context)
+	return m.ApplicationContainerSpec(preBlock, command, postBlock)
+}
+
+func init() {
+	base := metrics.BaseMetric{
+		Identifier: babelstreamIdentifier,
+		Summary:    babelstreamSummary,
+		Container:  babelstreamContainer,
+	}
+	app := metrics.SingleApplication{BaseMetric: base}
+	babelstream := BabelStream{SingleApplication: app}
+	metrics.Register(&babelstream)
+}
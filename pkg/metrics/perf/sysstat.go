@@ -12,7 +12,6 @@ import (
 	"strconv"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -38,6 +37,9 @@ type PidStat struct {
 	completions int32
 	command     string
 	commands    map[string]intstr.IntOrString
+
+	// Wait for the application to listen on this port before looking for the pid
+	readyPort int32
 }
 
 func (m PidStat) Url() string {
@@ -91,6 +93,10 @@ func (m *PidStat) SetOptions(metric *api.Metric) {
 	if ok {
 		m.command = command.StrVal
 	}
+	readyPort, ok := metric.Options["readyPort"]
+	if ok {
+		m.readyPort = readyPort.IntVal
+	}
 
 }
 
@@ -112,6 +118,13 @@ func (m PidStat) Options() map[string]intstr.IntOrString {
 		"completions": intstr.FromInt(int(m.completions)),
 		"threads":     intstr.FromString(useThreads),
 		"pids":        intstr.FromString(showPIDS),
+		"readyPort":   intstr.FromInt(int(m.readyPort)),
+		"command":     intstr.FromString(m.command),
+	}
+}
+func (m PidStat) MapOptions() map[string]map[string]intstr.IntOrString {
+	return map[string]map[string]intstr.IntOrString{
+		"commands": m.commands,
 	}
 }
 
@@ -132,7 +145,7 @@ func (m PidStat) prepareIndexedCommand(spec *api.MetricSet) string {
 
 			// We currently have support for all
 			if key == "all" {
-				for i := 0; i < int(spec.Spec.Pods); i++ {
+				for i := 0; i < int(m.Pods(spec)); i++ {
 					commands[strconv.Itoa(i)] = value.StrVal
 				}
 			}
@@ -153,62 +166,55 @@ func (m PidStat) prepareIndexedCommand(spec *api.MetricSet) string {
 	return command
 }
 
-func (m PidStat) PrepareContainers(
-	spec *api.MetricSet,
-	metric *metrics.Metric,
-) []*specs.ContainerSpec {
-
-	// Metadata to add to beginning of run
-	meta := metrics.Metadata(spec, metric)
-
-	useColor := ""
-	if !m.useColor {
-		useColor = "export NO_COLOR=true"
-	}
-
-	showPIDS := ""
-	if m.showPIDS {
-		showPIDS = "ps aux\npstree ${pid}"
-	}
-
-	useThreads := ""
-	if m.useThreads {
-		useThreads = " -t "
-	}
+// pidstatContext is for the templates of the application container
+type pidstatContext struct {
+	Metadata    string
+	ReadyPort   int32
+	Threads     bool
+	Command     string
+	Color       bool
+	Completions int32
+	ShowPIDs    bool
+	Rate        int32
+	Interactive bool
+}
 
-	command := m.prepareIndexedCommand(spec)
-	preBlock := `#!/bin/bash
+var (
+	// pidstatPreTemplate finds the pid of the command, and runs pidstat until it is done
+	// (or the completions are). See https://kellyjonbrazil.github.io/jc/docs/parsers/pidstat
+	// for how we get lovely json.
+	pidstatPreTemplate = specs.NewTemplate(pidstatIdentifier, `#!/bin/bash
 
-echo "%s"
-# Download the wait binary
-wget -q https://github.com/converged-computing/goshare/releases/download/2023-07-27/wait > /dev/null
-chmod +x ./wait
-mv ./wait /usr/bin/goshare-wait
+echo "{{ .Metadata }}"
+{{ if gt .ReadyPort 0 }}echo "Waiting for application to listen on port {{ .ReadyPort }}..."
+mo_wait_for_port {{ .ReadyPort }}{{ end }}
 	
 # Do we want to use threads?
-threads="%s"
+threads="{{ if .Threads }} -t {{ end }}"
 	
 # This is logic to determine the command, it will set $command
 # We do this because command to watch can vary between worker pods
-%s
+{{ .Command }}
 echo "PIDSTAT COMMAND START"
 echo "$command"
 echo "PIDSTAT COMMAND END"
 echo "Waiting for application PID..."
-pid=$(goshare-wait -c "$command" -q)
+pid=$(mo_wait_for_pid "$command")
 	
 # Set color or not
-%s
+{{ if not .Color }}export NO_COLOR=true{{ end }}
 	
 # See https://kellyjonbrazil.github.io/jc/docs/parsers/pidstat
 # for how we get lovely json
 i=0
-completions=%d
-echo "%s"
+completions={{ .Completions }}
+echo "{{ collectionStart }}"
 while true
   do
-	echo "%s"
-	%s
+	echo "{{ separator }}"
+	mo_phase_report
+	{{ if .ShowPIDs }}ps aux
+pstree ${pid}{{ end }}
 	echo "CPU STATISTICS TASK"
 	pidstat -p ${pid} -u -h $threads -T TASK | jc --pidstat
 	echo "CPU STATISTICS CHILD"
@@ -235,34 +241,45 @@ while true
 	ps -p ${pid} > /dev/null
 	retval=$?
 	if [[ $retval -ne 0 ]]; then
-		echo "%s"
+		echo "{{ collectionEnd }}"
 		exit 0
 	fi
 	if [[ $completions -ne 0 ]] && [[ $i -eq $completions ]]; then
-		echo "%s"
+		echo "{{ collectionEnd }}"
 		exit 0
 	fi
-	sleep %d
+	sleep {{ .Rate }}
 	let i=i+1
 done
-`
-
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	preBlock = fmt.Sprintf(
-		preBlock,
-		meta,
-		useThreads,
-		command,
-		useColor,
-		m.completions,
-		metadata.CollectionStart,
-		metadata.Separator,
-		showPIDS,
-		metadata.CollectionEnd,
-		metadata.CollectionEnd,
-		m.rate,
-	)
-	postBlock := fmt.Sprintf("\n%s\n", interactive)
+`, pidstatContext{})
+
+	pidstatPostTemplate = specs.NewTemplate(pidstatIdentifier+"-post", `
+{{ interactive .Interactive }}
+`, pidstatContext{})
+)
+
+func (m PidStat) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	command := m.prepareIndexedCommand(spec)
+	context := pidstatContext{
+		Metadata:    meta,
+		ReadyPort:   m.readyPort,
+		Threads:     m.useThreads,
+		Command:     command,
+		Color:       m.useColor,
+		Completions: m.completions,
+		ShowPIDs:    m.showPIDS,
+		Rate:        m.rate,
+		Interactive: spec.Spec.Logging.Interactive,
+	}
+	preBlock := pidstatPreTemplate.Render(context)
+	postBlock := pidstatPostTemplate.Render(context)
 	return m.ApplicationContainerSpec(preBlock, command, postBlock)
 }
 
@@ -0,0 +1,227 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package perf
+
+import (
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// A fixed CPU workload run in windows, with per-core frequencies and thermal
+// throttle counters sampled during each. Burst performance is the first
+// windows, and sustained performance is the rest. A node with a misconfigured
+// power profile (or cooling) drops off, and others do not.
+
+const (
+	throttleIdentifier = "perf-throttle"
+	throttleSummary    = "CPU frequency and thermal throttling under a sustained workload"
+	throttleContainer  = "ghcr.io/converged-computing/metric-stress-ng:latest"
+)
+
+type Throttle struct {
+	metrics.SingleApplication
+
+	// Total seconds of the workload, in windows of interval seconds
+	duration int32
+	interval int32
+
+	// Windows at the start that are burst performance
+	burst int32
+
+	// stress-ng cpu method and workers (0 is one per cpu)
+	method  string
+	workers int32
+}
+
+func (m Throttle) Url() string {
+	return "https://github.com/ColinIanKing/stress-ng"
+}
+
+// One pod per node, so the workload uses (and heats) the whole node
+func (m Throttle) HasSoleTenancy() bool {
+	return true
+}
+
+// Set custom options / attributes for the metric
+func (m *Throttle) SetOptions(metric *api.Metric) {
+
+	m.Identifier = throttleIdentifier
+	m.Summary = throttleSummary
+	m.Container = throttleContainer
+	m.ResourceSpec = &metric.Resources
+	m.AttributeSpec = &metric.Attributes
+	m.SoleTenancy = true
+
+	// Five minutes is long enough for most nodes to reach a steady state
+	m.duration = 300
+	m.interval = 10
+	m.burst = 1
+	m.method = "matrixprod"
+
+	for key, value := range map[string]*int32{
+		"duration": &m.duration,
+		"interval": &m.interval,
+		"burst":    &m.burst,
+		"workers":  &m.workers,
+	} {
+		v, ok := metric.Options[key]
+		if ok {
+			*value = v.IntVal
+		}
+	}
+	method, ok := metric.Options["method"]
+	if ok {
+		m.method = method.StrVal
+	}
+}
+
+// Validate there are burst windows, and sustained windows after them
+func (m Throttle) Validate(spec *api.MetricSet) bool {
+	if m.interval < 2 {
+		logger.Errorf("🟥️ The perf-throttle interval must be 2 or more seconds")
+		return false
+	}
+	if m.burst < 1 || m.duration < (m.burst+1)*m.interval {
+		logger.Errorf("🟥️ The perf-throttle duration (%d) must have the burst windows (%d) and at least one more of %d seconds", m.duration, m.burst, m.interval)
+		return false
+	}
+	if m.workers < 0 {
+		logger.Errorf("🟥️ The perf-throttle workers must be 0 (one per cpu) or more")
+		return false
+	}
+	return true
+}
+
+// Exported options and list options
+func (m Throttle) Options() map[string]intstr.IntOrString {
+	return map[string]intstr.IntOrString{
+		"duration": intstr.FromInt(int(m.duration)),
+		"interval": intstr.FromInt(int(m.interval)),
+		"burst":    intstr.FromInt(int(m.burst)),
+		"method":   intstr.FromString(m.method),
+		"workers":  intstr.FromInt(int(m.workers)),
+	}
+}
+
+// throttleContext is for the templates of the application container
+type throttleContext struct {
+	Metadata     string
+	Burst        int32
+	Interval     int32
+	HalfInterval int32
+	Windows      int32
+	Workers      int32
+	Method       string
+	Interactive  bool
+}
+
+var (
+	// Frequencies are in kHz, from cpufreq or else /proc/cpuinfo. Throttle
+	// counters (Intel) are cumulative, so the parser uses the differences.
+	throttlePreTemplate = specs.NewTemplate(throttleIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"
+mo_frequencies() {
+    local freqs=$(cat /sys/devices/system/cpu/cpu[0-9]*/cpufreq/scaling_cur_freq 2>/dev/null | tr '\n' ' ')
+    if [ -z "${freqs}" ]; then
+        freqs=$(awk '/^cpu MHz/ {printf "%d ", $4 * 1000}' /proc/cpuinfo)
+    fi
+    echo "FREQUENCIES ${freqs}"
+}
+mo_throttle() {
+    echo "THROTTLE core $(cat /sys/devices/system/cpu/cpu[0-9]*/thermal_throttle/core_throttle_count 2>/dev/null | tr '\n' ' ')"
+    echo "THROTTLE package $(cat /sys/devices/system/cpu/cpu[0-9]*/thermal_throttle/package_throttle_count 2>/dev/null | tr '\n' ' ')"
+}
+mo_throttle_total() {
+    cat /sys/devices/system/cpu/cpu[0-9]*/thermal_throttle/core_throttle_count 2>/dev/null | awk '{s += $1} END {print s + 0}'
+}
+echo "THROTTLE NODE ${METRICS_OPERATOR_NODE} BURST {{ .Burst }} INTERVAL {{ .Interval }}"
+governor=$(cat /sys/devices/system/cpu/cpu0/cpufreq/scaling_governor 2>/dev/null)
+echo "GOVERNOR ${governor:-unknown}"
+echo "{{ collectionStart }}"
+echo "{{ separator }}"
+echo "WINDOW 0"
+mo_frequencies
+mo_throttle
+`, throttleContext{})
+
+	// Frequencies are sampled in the middle of each window, under load. The burst
+	// and sustained rates (and new throttle events) are reported for acceptance.
+	throttleCommandTemplate = specs.NewTemplate(throttleIdentifier+"-command", `throttle_start=$(mo_throttle_total)
+rates=""
+for window in $(seq 1 {{ .Windows }}); do
+    echo "{{ separator }}"
+    echo "WINDOW ${window}"
+    ( sleep {{ .HalfInterval }}; mo_frequencies ) &
+    sampler=$!
+    ops=$(stress-ng --cpu {{ .Workers }} --cpu-method {{ .Method }} --timeout {{ .Interval }}s --metrics-brief 2>&1 | awk '{for (i = 1; i + 5 <= NF; i++) if ($i == "cpu") print "BOGO OPS " $(i+1) " " $(i+5)}')
+    echo "${ops}"
+    rates="${rates} $(echo "${ops}" | awk '{print $4}')"
+    wait ${sampler}
+    mo_throttle
+done
+echo ${rates} | awk -v burst={{ .Burst }} '{for (i = 1; i <= NF; i++) if (i <= burst) b += $i; else s += $i} END {if (NF > burst && b > 0) printf "%f %f %f\n", b / burst, s / (NF - burst), (s / (NF - burst)) / (b / burst)}' | {
+    read burst sustained ratio && mo_report burstOpsPerSecond ${burst} && mo_report sustainedOpsPerSecond ${sustained} && mo_report sustainedRatio ${ratio}
+}
+mo_report throttleEvents $(( $(mo_throttle_total) - throttle_start ))`, throttleContext{})
+
+	// throttlePostTemplate ends the collection (and sleeps, if interactive)
+	throttlePostTemplate = specs.NewTemplate(throttleIdentifier+"-post", `
+echo "{{ collectionEnd }}"
+{{ interactive .Interactive }}
+`, throttleContext{})
+)
+
+func (m Throttle) PrepareContainers(
+	spec *api.MetricSet,
+	metric *metrics.Metric,
+) []*specs.ContainerSpec {
+
+	// Metadata to add to beginning of run
+	meta := metrics.Metadata(spec, metric)
+
+	context := throttleContext{
+		Metadata:     meta,
+		Burst:        m.burst,
+		Interval:     m.interval,
+		HalfInterval: m.interval / 2,
+		Windows:      m.duration / m.interval,
+		Workers:      m.workers,
+		Method:       m.method,
+		Interactive:  spec.Spec.Logging.Interactive,
+	}
+	preBlock := throttlePreTemplate.Render(context)
+	command := throttleCommandTemplate.Render(context)
+	postBlock := throttlePostTemplate.Render(context)
+	containers := m.ApplicationContainerSpec(preBlock, command, postBlock)
+
+	// Results are reported for the node (the autoscaler already provides it)
+	if !spec.Spec.Autoscaler.Enabled() {
+		containers[0].Env = append(containers[0].Env, corev1.EnvVar{
+			Name: "METRICS_OPERATOR_NODE",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+			},
+		})
+	}
+	return containers
+}
+
+func init() {
+	base := metrics.BaseMetric{
+		Identifier: throttleIdentifier,
+		Summary:    throttleSummary,
+		Container:  throttleContainer,
+	}
+	app := metrics.SingleApplication{BaseMetric: base}
+	throttle := Throttle{SingleApplication: app}
+	metrics.Register(&throttle)
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"path/filepath"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Phase markers are appended to a file on an empty volume shared by the
+// containers of a pod, so a sampler can read the markers of the application
+const (
+	PhasesRoot       = "/metrics_operator_phases"
+	phasesVolumeName = "metrics-operator-phases"
+)
+
+// getPhaseVolumes returns the phases volume for all containers, if requested
+func getPhaseVolumes(set *api.MetricSet) []specs.VolumeSpec {
+	if !set.Spec.Markers.Phases {
+		return []specs.VolumeSpec{}
+	}
+	volume := corev1.Volume{
+		Name: phasesVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	return []specs.VolumeSpec{{
+		Volume: volume,
+		Path:   PhasesRoot,
+		Mount:  true,
+	}}
+}
+
+// getPhaseEnvironment tells applications (and the prelude) where to write markers
+func getPhaseEnvironment(set *api.MetricSet) []corev1.EnvVar {
+	if !set.Spec.Markers.Phases {
+		return []corev1.EnvVar{}
+	}
+	return []corev1.EnvVar{
+		{Name: "METRICS_OPERATOR_PHASES", Value: filepath.Join(PhasesRoot, "phases.txt")},
+	}
+}
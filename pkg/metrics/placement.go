@@ -0,0 +1,138 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// Pods of a metric with a placement are labeled with the metric, and their
+// role (server or client), so the controller can report the achieved placement
+const (
+	PlacementLabel     = "metrics-operator-placement"
+	PlacementRoleLabel = "metrics-operator-placement-role"
+	PlacementServer    = "server"
+	PlacementClient    = "client"
+
+	// Well known labels of the node topology
+	HostnameLabel = "kubernetes.io/hostname"
+	ZoneLabel     = "topology.kubernetes.io/zone"
+	RegionLabel   = "topology.kubernetes.io/region"
+)
+
+// applyPlacement requires the client pods (of all but the first replicated job)
+// to be placed relative to the server pod (of the first replicated job)
+func applyPlacement(set *api.MetricSet, name, placement string, jobs []*jobset.ReplicatedJob) error {
+	if placement == "" {
+		return nil
+	}
+	if len(jobs) < 2 {
+		return fmt.Errorf("metric %s has one replicated job, a placement needs a server and clients", name)
+	}
+	server := jobs[0]
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			MetricSetLabel:              set.Name,
+			jobset.ReplicatedJobNameKey: server.Name,
+		},
+	}
+	term := func(key string) corev1.PodAffinityTerm {
+		return corev1.PodAffinityTerm{LabelSelector: selector, TopologyKey: key}
+	}
+	affinity := []corev1.PodAffinityTerm{}
+	antiAffinity := []corev1.PodAffinityTerm{}
+	switch placement {
+	case api.PlacementSameNode:
+		affinity = append(affinity, term(HostnameLabel))
+	case api.PlacementSameZone:
+		affinity = append(affinity, term(ZoneLabel))
+	case api.PlacementCrossZone:
+		affinity = append(affinity, term(RegionLabel))
+		antiAffinity = append(antiAffinity, term(ZoneLabel))
+	case api.PlacementCrossRegion:
+		antiAffinity = append(antiAffinity, term(RegionLabel))
+	default:
+		return fmt.Errorf("metric %s placement must be same-node, same-zone, cross-zone, or cross-region, found %s", name, placement)
+	}
+
+	for i, job := range jobs {
+
+		// Pod labels are shared by the replicated jobs, so each gets a copy here
+		pod := &job.Template.Spec.Template
+		labels := map[string]string{}
+		for key, value := range pod.Labels {
+			labels[key] = value
+		}
+		pod.Labels = labels
+		pod.Labels[PlacementLabel] = name
+		if i == 0 {
+			pod.Labels[PlacementRoleLabel] = PlacementServer
+			continue
+		}
+		pod.Labels[PlacementRoleLabel] = PlacementClient
+		if pod.Spec.Affinity == nil {
+			pod.Spec.Affinity = &corev1.Affinity{}
+		}
+		if len(affinity) > 0 {
+			if pod.Spec.Affinity.PodAffinity == nil {
+				pod.Spec.Affinity.PodAffinity = &corev1.PodAffinity{}
+			}
+			pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+				pod.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+				affinity...,
+			)
+		}
+		if len(antiAffinity) > 0 {
+			if pod.Spec.Affinity.PodAntiAffinity == nil {
+				pod.Spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+			}
+			pod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+				pod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+				antiAffinity...,
+			)
+		}
+	}
+	return nil
+}
+
+// AchievedPlacement is the closest placement that holds between the server node
+// and every client node, or empty if the topology of a node is not known
+func AchievedPlacement(server api.NodeStatus, clients []api.NodeStatus) string {
+	achieved := api.PlacementSameNode
+	rank := map[string]int{
+		api.PlacementSameNode:    0,
+		api.PlacementSameZone:    1,
+		api.PlacementCrossZone:   2,
+		api.PlacementCrossRegion: 3,
+	}
+	for _, client := range clients {
+		placement := api.PlacementSameNode
+		switch {
+		case client.Name == server.Name:
+		case client.Zone == "" || server.Zone == "":
+			return ""
+		case client.Zone == server.Zone:
+			placement = api.PlacementSameZone
+		case client.Region == "" || server.Region == "":
+			return ""
+		case client.Region == server.Region:
+			placement = api.PlacementCrossZone
+		default:
+			placement = api.PlacementCrossRegion
+		}
+		if rank[placement] > rank[achieved] {
+			achieved = placement
+		}
+	}
+	return achieved
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The pod group is referenced by a label (coscheduling) or annotation (Volcano)
+const (
+	CoschedulingPodGroupLabel = "scheduling.x-k8s.io/pod-group"
+	VolcanoPodGroupAnnotation = "scheduling.k8s.io/group-name"
+)
+
+// PodGroup kinds for each gang scheduler. We use unstructured objects so the
+// operator does not depend on either scheduler (or need its CRDs to build)
+var (
+	CoschedulingPodGroupKind = schema.GroupVersionKind{
+		Group:   "scheduling.x-k8s.io",
+		Version: "v1alpha1",
+		Kind:    "PodGroup",
+	}
+	VolcanoPodGroupKind = schema.GroupVersionKind{
+		Group:   "scheduling.volcano.sh",
+		Version: "v1beta1",
+		Kind:    "PodGroup",
+	}
+)
+
+// getSchedulerName returns the scheduler for the pods (empty is the default scheduler)
+func getSchedulerName(set *api.MetricSet) string {
+	if !set.Spec.GangScheduling.Enabled() {
+		return ""
+	}
+	return set.Spec.GangScheduling.GetSchedulerName()
+}
+
+// addPodGroupLabels adds the coscheduling pod group label to pod labels
+func addPodGroupLabels(set *api.MetricSet, labels map[string]string) {
+	if set.Spec.GangScheduling.Scheduler == api.CoschedulingScheduler {
+		labels[CoschedulingPodGroupLabel] = set.PodGroupName()
+	}
+}
+
+// addPodGroupAnnotations adds the Volcano pod group annotation to pod annotations
+func addPodGroupAnnotations(set *api.MetricSet, annotations map[string]string) {
+	if set.Spec.GangScheduling.Scheduler == api.VolcanoScheduler {
+		annotations[VolcanoPodGroupAnnotation] = set.PodGroupName()
+	}
+}
+
+// getJobSetPods returns the pods across all replicated jobs of the JobSet
+func getJobSetPods(js *jobset.JobSet) int64 {
+	pods := int64(0)
+	for _, rj := range js.Spec.ReplicatedJobs {
+		parallelism := int32(1)
+		if rj.Template.Spec.Parallelism != nil {
+			parallelism = *rj.Template.Spec.Parallelism
+		}
+		pods += int64(rj.Replicas) * int64(parallelism)
+	}
+	return pods
+}
+
+// GetPodGroup returns the PodGroup for the JobSet, with a minimum of all of its
+// pods, or nil if gang scheduling is not requested
+func GetPodGroup(set *api.MetricSet, js *jobset.JobSet) *unstructured.Unstructured {
+	gang := set.Spec.GangScheduling
+	if !gang.Enabled() {
+		return nil
+	}
+	kind := CoschedulingPodGroupKind
+	spec := map[string]interface{}{
+		"minMember": getJobSetPods(js),
+	}
+	if gang.Scheduler == api.VolcanoScheduler {
+		kind = VolcanoPodGroupKind
+	} else if gang.TimeoutSeconds > 0 {
+		spec["scheduleTimeoutSeconds"] = int64(gang.TimeoutSeconds)
+	}
+	pg := &unstructured.Unstructured{}
+	pg.SetGroupVersionKind(kind)
+	pg.SetName(set.PodGroupName())
+	pg.SetNamespace(set.Namespace)
+	pg.Object["spec"] = spec
+	return pg
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Prefix for the experiment id and metadata in labels and annotations
+const provenancePrefix = "metrics-operator.io/"
+
+// ExperimentLabel is on the JobSet and pods with the experiment id of the run
+const ExperimentLabel = provenancePrefix + "experiment-id"
+
+// getProvenanceLabels returns the experiment id, and metadata that are valid label values
+func getProvenanceLabels(set *api.MetricSet) map[string]string {
+	labels := map[string]string{}
+	if set.Spec.ExperimentID != "" {
+		labels[ExperimentLabel] = set.Spec.ExperimentID
+	}
+	for key, value := range set.Spec.Metadata {
+		if len(validation.IsValidLabelValue(value)) == 0 {
+			labels[provenancePrefix+key] = value
+		}
+	}
+	return labels
+}
+
+// getProvenanceAnnotations returns all metadata, since values (e.g., a url) may not be valid labels
+func getProvenanceAnnotations(set *api.MetricSet) map[string]string {
+	annotations := map[string]string{}
+	for key, value := range set.Spec.Metadata {
+		annotations[provenancePrefix+key] = value
+	}
+	return annotations
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+func TestGetProvenance(t *testing.T) {
+	set := &api.MetricSet{Spec: api.MetricSetSpec{
+		ExperimentID: "exp-42",
+		Metadata: map[string]string{
+			"gitSha": "0a1b2c3d",
+			"run":    "https://example.com/runs/42",
+		},
+	}}
+	labels := getProvenanceLabels(set)
+	if labels[ExperimentLabel] != "exp-42" || labels["metrics-operator.io/gitSha"] != "0a1b2c3d" {
+		t.Errorf("expected the experiment id and git sha labels, found %v", labels)
+	}
+	if _, ok := labels["metrics-operator.io/run"]; ok {
+		t.Error("expected a url to not be a label")
+	}
+	annotations := getPodAnnotations(set)
+	if annotations["metrics-operator.io/run"] != "https://example.com/runs/42" || len(annotations) != 2 {
+		t.Errorf("expected all metadata as annotations, found %v", annotations)
+	}
+}
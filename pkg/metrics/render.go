@@ -0,0 +1,214 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/logging"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+// RenderedJobSetKey is the key for the JobSet in the rendered config map
+const RenderedJobSetKey = "jobset.yaml"
+
+// Rendering is what the operator generates for a MetricSet without a cluster:
+// the JobSet, container specs, and entrypoint scripts (config map data),
+// along with how the entrypoints are split across config maps.
+// It is a stable API intended for testing metrics, including external ones.
+type Rendering struct {
+	JobSet      *jobset.JobSet
+	Containers  []*specs.ContainerSpec
+	Entrypoints map[string]string
+	ConfigMaps  []ConfigMapShard
+}
+
+// NewMetricSet validates a MetricSet spec and loads its metrics, as the controller does
+func NewMetricSet(spec *api.MetricSet) (*MetricSet, error) {
+	if !spec.Validate() {
+		return nil, fmt.Errorf("MetricSet %s did not validate", spec.Name)
+	}
+	set := MetricSet{}
+	for _, metric := range spec.ExpandedMetrics() {
+		m, err := GetMetric(&metric, spec)
+		if err != nil {
+			return nil, err
+		}
+		set.Add(&m)
+	}
+	if len(set.Metrics()) == 0 {
+		return nil, fmt.Errorf("MetricSet %s does not have any validated metrics", spec.Name)
+	}
+	return &set, nil
+}
+
+// Render generates the JobSet and entrypoints for a MetricSet spec
+func Render(spec *api.MetricSet) (*Rendering, error) {
+	set, err := NewMetricSet(spec)
+	if err != nil {
+		return nil, err
+	}
+	js, cs, err := GetJobSet(spec, set)
+	if err != nil {
+		return nil, err
+	}
+	return NewRendering(spec, js, cs)
+}
+
+// NewRendering collects the entrypoints for a JobSet that was already generated
+func NewRendering(spec *api.MetricSet, js *jobset.JobSet, cs []*specs.ContainerSpec) (*Rendering, error) {
+
+	// This is the same data written to the MetricSet config maps
+	shards, err := GetConfigMapShards(spec, cs)
+	if err != nil {
+		return nil, err
+	}
+	entrypoints := map[string]string{}
+	for _, shard := range shards {
+		for key, script := range shard.Data {
+			entrypoints[key] = script
+		}
+	}
+	return &Rendering{JobSet: js, Containers: cs, Entrypoints: entrypoints, ConfigMaps: shards}, nil
+}
+
+// Hash is a sha256 digest of the JobSet spec and the entrypoints, so results
+// can be traced back to the exact configuration that ran
+func (r *Rendering) Hash() (string, error) {
+	hash := sha256.New()
+	spec, err := json.Marshal(r.JobSet.Spec)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(spec)
+	for _, name := range r.entrypointNames() {
+		fmt.Fprintf(hash, "\n%s\n%s", name, r.Entrypoints[name])
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Record is the data to keep for the run: the JobSet (as yaml) and the
+// entrypoints, with secrets redacted. Entrypoints are left out if they do not
+// fit in one config map.
+func (r *Rendering) Record() (map[string]string, error) {
+	js, err := yaml.Marshal(r.JobSet)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]string{RenderedJobSetKey: logging.Redact(string(js))}
+	size := len(js)
+	for _, script := range r.Entrypoints {
+		size += len(script)
+	}
+	if size > maxConfigMapData {
+		logger.Infof("🟪️ Entrypoints for %s are too large to record with the JobSet", r.JobSet.Name)
+		return data, nil
+	}
+	for name, script := range r.Entrypoints {
+		data[name] = logging.Redact(script)
+	}
+	return data, nil
+}
+
+// entrypointNames returns the entrypoint names, sorted
+func (r *Rendering) entrypointNames() []string {
+	names := []string{}
+	for name := range r.Entrypoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String is a deterministic, human readable summary of the replicated job
+// containers and entrypoints, and is the format used for golden files
+func (r *Rendering) String() string {
+	var buf bytes.Buffer
+	for _, rj := range r.JobSet.Spec.ReplicatedJobs {
+		job := rj.Template.Spec
+		fmt.Fprintf(&buf, "# replicated job %s\n", rj.Name)
+		fmt.Fprintf(&buf, "replicas: %d\n", rj.Replicas)
+		if job.Parallelism != nil {
+			fmt.Fprintf(&buf, "parallelism: %d\n", *job.Parallelism)
+		}
+		if job.Completions != nil {
+			fmt.Fprintf(&buf, "completions: %d\n", *job.Completions)
+		}
+		pod := job.Template.Spec
+		containers := append([]corev1.Container{}, pod.InitContainers...)
+		containers = append(containers, pod.Containers...)
+		for _, c := range containers {
+			fmt.Fprintf(&buf, "container %s\n", c.Name)
+			fmt.Fprintf(&buf, "  image: %s\n", c.Image)
+			fmt.Fprintf(&buf, "  command: %s\n", strings.Join(c.Command, " "))
+			if c.WorkingDir != "" {
+				fmt.Fprintf(&buf, "  workingDir: %s\n", c.WorkingDir)
+			}
+			for _, mount := range c.VolumeMounts {
+				fmt.Fprintf(&buf, "  mount: %s at %s (readOnly %t)\n", mount.Name, mount.MountPath, mount.ReadOnly)
+			}
+		}
+		buf.WriteString("\n")
+	}
+
+	for _, name := range r.entrypointNames() {
+		fmt.Fprintf(&buf, "# entrypoint %s\n%s\n", name, r.Entrypoints[name])
+	}
+	return buf.String()
+}
+
+// CompareGolden compares the rendering to a golden file, or writes the
+// golden file if update is true
+func (r *Rendering) CompareGolden(path string, update bool) error {
+	rendered := r.String()
+	if update {
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(rendered), 0644)
+	}
+	golden, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s does not exist, render it with update", path)
+	}
+	if err != nil {
+		return err
+	}
+	if string(golden) == rendered {
+		return nil
+	}
+
+	// Report the first line that differs to make the failure easy to find
+	want := strings.Split(string(golden), "\n")
+	got := strings.Split(rendered, "\n")
+	for i := 0; i < len(want) || i < len(got); i++ {
+		wantLine, gotLine := "", ""
+		if i < len(want) {
+			wantLine = want[i]
+		}
+		if i < len(got) {
+			gotLine = got[i]
+		}
+		if wantLine != gotLine {
+			return fmt.Errorf("%s differs at line %d:\n  want: %q\n  got:  %q", path, i+1, wantLine, gotLine)
+		}
+	}
+	return fmt.Errorf("%s differs from the rendering", path)
+}
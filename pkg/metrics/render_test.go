@@ -0,0 +1,663 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics_test
+
+import (
+	"errors"
+	"flag"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/config"
+	"github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+
+	// Register the built-in metrics
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/app"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/db"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/io"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/network"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/perf"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/sys"
+)
+
+// Update golden files with: go test ./pkg/metrics/ -update
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// Options for metrics that do not validate without them (e.g., an endpoint)
+var requiredOptions = map[string]map[string]intstr.IntOrString{
+	"io-warp": {
+		"endpoint":   intstr.FromString("minio.default.svc:9000"),
+		"secretName": intstr.FromString("minio-credentials"),
+	},
+	"network-kafka": {
+		"secretName": intstr.FromString("kafka-bootstrap"),
+	},
+}
+
+// getMetricSet returns a synthetic MetricSet with a single metric
+func getMetricSet(name string) *api.MetricSet {
+	return &api.MetricSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "golden",
+			Namespace: "default",
+		},
+		Spec: api.MetricSetSpec{
+			Pods: 2,
+			Metrics: []api.Metric{{
+				Name:    name,
+				Options: requiredOptions[name],
+			}},
+		},
+	}
+}
+
+// TestRenderGolden renders each built-in metric and compares to testdata
+func TestRenderGolden(t *testing.T) {
+	names := []string{}
+	for name := range metrics.Registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			rendering, err := metrics.Render(getMetricSet(name))
+			if err != nil {
+				t.Fatalf("render %s: %s", name, err)
+			}
+			path := filepath.Join("testdata", name+".golden")
+			err = rendering.CompareGolden(path, *update)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestRenderInputs renders a metric with an input file referenced by the command
+func TestRenderInputs(t *testing.T) {
+	spec := getMetricSet("app-lammps")
+	spec.Spec.Metrics[0].Options = map[string]intstr.IntOrString{
+		"command": intstr.FromString(`mpirun --hostfile ./hostlist.txt -np {{.Pods}} lmp -in {{.Inputs.in_lj}}`),
+	}
+	spec.Spec.Metrics[0].Inputs = map[string]string{
+		"in.lj": "units lj\natom_style atomic\nrun 100\n",
+	}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render inputs: %s", err)
+	}
+	err = rendering.CompareGolden(filepath.Join("testdata", "inputs", "app-lammps.golden"), *update)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestRenderAddons renders a metric with each addon that changes the entrypoints
+func TestRenderAddons(t *testing.T) {
+	addons := map[string]api.MetricAddon{
+		"preload": {
+			Options: map[string]intstr.IntOrString{
+				"image":   intstr.FromString("ghcr.io/my-org/my-interposer:latest"),
+				"library": intstr.FromString("libinterposer.so"),
+			},
+			MapOptions: map[string]map[string]intstr.IntOrString{
+				"env": {"INTERPOSER_OUTPUT": intstr.FromString(`/tmp/$(hostname) "it's"`)},
+			},
+		},
+		"perf-nsight":  {Options: map[string]intstr.IntOrString{"trace": intstr.FromString("cuda,nvtx,mpi")}},
+		"perf-ipmi":    {Options: map[string]intstr.IntOrString{"command": intstr.FromString("lmp")}},
+		"perf-kubelet": {},
+		"volume-s3fs": {Options: map[string]intstr.IntOrString{
+			"name":   intstr.FromString("results"),
+			"path":   intstr.FromString("/results"),
+			"bucket": intstr.FromString("results"),
+		}},
+		"volume-stage": {Options: map[string]intstr.IntOrString{
+			"name":   intstr.FromString("data"),
+			"path":   intstr.FromString("/data"),
+			"source": intstr.FromString("https://example.com/data.tar.gz"),
+		}},
+		"debug-coredump": {},
+		"sys-bash":       {},
+		"debug-watchdog": {Options: map[string]intstr.IntOrString{"command": intstr.FromString("lmp")}},
+	}
+	for name, addon := range addons {
+		t.Run(name, func(t *testing.T) {
+			spec := getMetricSet("app-lammps")
+			addon.Name = name
+			spec.Spec.Metrics[0].Addons = []api.MetricAddon{addon}
+			rendering, err := metrics.Render(spec)
+			if err != nil {
+				t.Fatalf("render %s: %s", name, err)
+			}
+			err = rendering.CompareGolden(filepath.Join("testdata", "addons", name+".golden"), *update)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestRenderAlias renders the same metric twice, distinguished by an alias
+func TestRenderAlias(t *testing.T) {
+	spec := getMetricSet("perf-sysstat")
+	spec.Spec.Metrics = []api.Metric{
+		{Name: "perf-sysstat", Alias: "fast", Options: map[string]intstr.IntOrString{"rate": intstr.FromInt(1)}},
+		{Name: "perf-sysstat", Alias: "slow", Options: map[string]intstr.IntOrString{"rate": intstr.FromInt(30)}},
+	}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render alias: %s", err)
+	}
+	err = rendering.CompareGolden(filepath.Join("testdata", "alias", "perf-sysstat.golden"), *update)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Without an alias, the same metric cannot be included twice
+	spec = getMetricSet("perf-sysstat")
+	spec.Spec.Metrics = append(spec.Spec.Metrics, spec.Spec.Metrics[0])
+	_, err = metrics.Render(spec)
+	if err == nil {
+		t.Error("expected a duplicate metric without an alias to not validate")
+	}
+}
+
+// TestRenderRoles renders a launcher/worker metric with more workers than the pods
+func TestRenderRoles(t *testing.T) {
+	spec := getMetricSet("network-netmark")
+	spec.Spec.Roles = map[string]int32{"w": 3}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render roles: %s", err)
+	}
+	err = rendering.CompareGolden(filepath.Join("testdata", "roles", "network-netmark.golden"), *update)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// There is only one launcher
+	spec.Spec.Roles = map[string]int32{"n": 2}
+	_, err = metrics.Render(spec)
+	if err == nil {
+		t.Error("expected a sized launcher role to not validate")
+	}
+}
+
+// TestRenderDebug renders a metric that waits to be released before the command
+func TestRenderDebug(t *testing.T) {
+	spec := getMetricSet("io-fio")
+	spec.Spec.Debug = true
+	spec.Spec.CommandTimeout = 60
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render debug: %s", err)
+	}
+	err = rendering.CompareGolden(filepath.Join("testdata", "debug", "io-fio.golden"), *update)
+	if err != nil {
+		t.Error(err)
+	}
+	for _, rj := range rendering.JobSet.Spec.ReplicatedJobs {
+		for _, container := range rj.Template.Spec.Template.Spec.Containers {
+			if container.ReadinessProbe == nil {
+				t.Errorf("expected a debug readiness probe for %s", container.Name)
+			}
+		}
+	}
+}
+
+// TestRenderSnapshot checks metric entrypoints (only) snapshot the environment
+func TestRenderSnapshot(t *testing.T) {
+	spec := getMetricSet("io-fio")
+	spec.Spec.Snapshot = true
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render snapshot: %s", err)
+	}
+	for _, c := range rendering.Containers {
+		script := c.EntrypointScript.WriteScript()
+		snapshots := strings.Contains(script, "\nmo_snapshot\n")
+		if c.Metric != "" && !snapshots {
+			t.Errorf("expected entrypoint %s to snapshot the environment", c.EntrypointScript.Name)
+		}
+		if c.Metric == "" && snapshots {
+			t.Errorf("expected entrypoint %s to not snapshot the environment", c.EntrypointScript.Name)
+		}
+	}
+}
+
+// TestRenderMarkers renders a metric with custom markers and framed output
+func TestRenderMarkers(t *testing.T) {
+	spec := getMetricSet("io-fio")
+	spec.Spec.Markers = api.Markers{Separator: "FIO TIMEPOINT", Framing: "base64"}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render markers: %s", err)
+	}
+	err = rendering.CompareGolden(filepath.Join("testdata", "markers", "io-fio.golden"), *update)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Markers are echoed in double quotes, so they cannot include them
+	spec.Spec.Markers.CollectionEnd = `END"`
+	_, err = metrics.Render(spec)
+	if err == nil {
+		t.Error("expected a marker with a quote to not validate")
+	}
+}
+
+// TestRenderPhases checks the phases volume and file are shared by all containers
+func TestRenderPhases(t *testing.T) {
+	spec := getMetricSet("perf-sysstat")
+	spec.Spec.Markers.Phases = true
+	spec.Spec.Metrics[0].Addons = []api.MetricAddon{{
+		Name: "application",
+		Options: map[string]intstr.IntOrString{
+			"image":   intstr.FromString("ghcr.io/rse-ops/vanilla-lammps:tag-latest"),
+			"command": intstr.FromString("lmp -in in.reaxc.hns"),
+		},
+	}}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render phases: %s", err)
+	}
+	for _, rj := range rendering.JobSet.Spec.ReplicatedJobs {
+		containers := rj.Template.Spec.Template.Spec.Containers
+		if len(containers) != 2 {
+			t.Fatalf("expected the application and sampler containers, found %d", len(containers))
+		}
+		for _, container := range containers {
+			mounted := false
+			for _, mount := range container.VolumeMounts {
+				mounted = mounted || mount.MountPath == metrics.PhasesRoot
+			}
+			found := ""
+			for _, env := range container.Env {
+				if env.Name == "METRICS_OPERATOR_PHASES" {
+					found = env.Value
+				}
+			}
+			if !mounted || found != filepath.Join(metrics.PhasesRoot, "phases.txt") {
+				t.Errorf("expected container %s to share the phases file, found mount %t and %q", container.Name, mounted, found)
+			}
+		}
+	}
+
+	// Phases are not supported on Windows
+	spec.Spec.Pod.OS = "windows"
+	spec.Spec.Metrics[0].Addons = nil
+	_, err = metrics.Render(spec)
+	if err == nil {
+		t.Error("expected phases to not validate on Windows")
+	}
+}
+
+// TestRenderPlacement checks clients are placed relative to the server
+func TestRenderPlacement(t *testing.T) {
+	spec := getMetricSet("network-osu-benchmark")
+	spec.Spec.Metrics[0].Placement = api.PlacementCrossZone
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render placement: %s", err)
+	}
+	roles := map[string]string{}
+	for _, rj := range rendering.JobSet.Spec.ReplicatedJobs {
+		pod := rj.Template.Spec.Template
+		roles[rj.Name] = pod.Labels[metrics.PlacementRoleLabel]
+		if pod.Labels[metrics.PlacementLabel] != "network-osu-benchmark" {
+			t.Errorf("expected job %s pods to be labeled with the metric, found %v", rj.Name, pod.Labels)
+		}
+		if pod.Labels[metrics.PlacementRoleLabel] != metrics.PlacementClient {
+			continue
+		}
+		affinity := pod.Spec.Affinity
+		if affinity == nil || affinity.PodAffinity == nil || affinity.PodAntiAffinity == nil {
+			t.Fatalf("expected client job %s to have pod affinity and anti-affinity", rj.Name)
+		}
+		same := affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		different := affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		if len(same) != 1 || same[0].TopologyKey != metrics.RegionLabel || len(different) != 1 || different[0].TopologyKey != metrics.ZoneLabel {
+			t.Errorf("expected the same region and a different zone, found %v and %v", same, different)
+		}
+	}
+	if roles["l"] != metrics.PlacementServer || roles["w"] != metrics.PlacementClient {
+		t.Errorf("expected the launcher to be the server and workers the clients, found %v", roles)
+	}
+
+	// A metric with one replicated job has no clients to place
+	spec = getMetricSet("io-fio")
+	spec.Spec.Metrics[0].Placement = api.PlacementSameNode
+	_, err = metrics.Render(spec)
+	if err == nil {
+		t.Error("expected a placement for a metric without clients to fail")
+	}
+}
+
+// TestRenderWindows renders a metric with a PowerShell entrypoint for Windows nodes
+func TestRenderWindows(t *testing.T) {
+	spec := getMetricSet("io-fio")
+	spec.Spec.Pod.OS = "windows"
+	spec.Spec.Metrics[0].Image = "ghcr.io/converged-computing/metric-fio:windows"
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render windows: %s", err)
+	}
+	err = rendering.CompareGolden(filepath.Join("testdata", "windows", "io-fio.golden"), *update)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Metrics without a PowerShell entrypoint are not supported
+	spec = getMetricSet("perf-sysstat")
+	spec.Spec.Pod.OS = "windows"
+	_, err = metrics.Render(spec)
+	if err == nil {
+		t.Error("expected a metric without Windows support to not validate")
+	}
+}
+
+// TestRenderHash ensures the rendered hash is stable, and changes with the configuration
+func TestRenderHash(t *testing.T) {
+	hashes := []string{}
+	for _, rate := range []int{10, 10, 30} {
+		spec := getMetricSet("perf-sysstat")
+		spec.Spec.Metrics[0].Options = map[string]intstr.IntOrString{"rate": intstr.FromInt(rate)}
+		rendering, err := metrics.Render(spec)
+		if err != nil {
+			t.Fatalf("render: %s", err)
+		}
+		hash, err := rendering.Hash()
+		if err != nil {
+			t.Fatalf("hash: %s", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("expected the same hash for the same spec, found %s and %s", hashes[0], hashes[1])
+	}
+	if hashes[0] == hashes[2] {
+		t.Errorf("expected a different hash for a different spec")
+	}
+}
+
+// TestRenderPodGroup checks the PodGroup covers all pods, and the pods reference it
+func TestRenderPodGroup(t *testing.T) {
+	spec := getMetricSet("network-netmark")
+	spec.Spec.Roles = map[string]int32{"w": 3}
+	spec.Spec.GangScheduling = api.GangScheduling{Scheduler: api.CoschedulingScheduler, TimeoutSeconds: 60}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render gang scheduling: %s", err)
+	}
+	pg := metrics.GetPodGroup(spec, rendering.JobSet)
+	minMember, _, _ := unstructured.NestedInt64(pg.Object, "spec", "minMember")
+	if minMember != 4 {
+		t.Errorf("expected a minMember of 4 pods, found %d", minMember)
+	}
+	for _, rj := range rendering.JobSet.Spec.ReplicatedJobs {
+		pod := rj.Template.Spec.Template
+		if pod.Labels[metrics.CoschedulingPodGroupLabel] != spec.PodGroupName() {
+			t.Errorf("expected pods of %s to be labeled with the PodGroup", rj.Name)
+		}
+		if pod.Spec.SchedulerName != "scheduler-plugins-scheduler" {
+			t.Errorf("expected the coscheduling scheduler for %s, found %s", rj.Name, pod.Spec.SchedulerName)
+		}
+	}
+
+	// Without gang scheduling, there is no PodGroup
+	spec = getMetricSet("network-netmark")
+	rendering, err = metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render: %s", err)
+	}
+	if metrics.GetPodGroup(spec, rendering.JobSet) != nil {
+		t.Error("expected no PodGroup without gang scheduling")
+	}
+}
+
+// TestRenderSecrets checks secrets are referenced from the environment, and
+// that inlined secrets are redacted in the record (but not the entrypoints)
+func TestRenderSecrets(t *testing.T) {
+	spec := getMetricSet("app-custom")
+	spec.Spec.Metrics[0].Options = map[string]intstr.IntOrString{
+		"command": intstr.FromString(`./client --token "${API_TOKEN}" --password hunter2`),
+	}
+	spec.Spec.Metrics[0].Secrets = []api.SecretEnv{{Name: "API_TOKEN", SecretName: "credentials", Key: "token"}}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render secrets: %s", err)
+	}
+	found := false
+	for _, rj := range rendering.JobSet.Spec.ReplicatedJobs {
+		for _, container := range rj.Template.Spec.Template.Spec.Containers {
+			for _, env := range container.Env {
+				if env.Name == "API_TOKEN" && env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+					found = env.ValueFrom.SecretKeyRef.Name == "credentials" && env.ValueFrom.SecretKeyRef.Key == "token"
+				}
+			}
+		}
+	}
+	if !found {
+		t.Error("expected API_TOKEN from the credentials secret in the metric container")
+	}
+
+	record, err := rendering.Record()
+	if err != nil {
+		t.Fatalf("record: %s", err)
+	}
+	for name, script := range rendering.Entrypoints {
+		if !strings.Contains(script, "--password hunter2") {
+			continue
+		}
+		if strings.Contains(record[name], "hunter2") {
+			t.Errorf("expected the password to be redacted in the recorded %s", name)
+		}
+		if !strings.Contains(record[name], `--token "${API_TOKEN}"`) {
+			t.Errorf("expected the secret reference to be kept in the recorded %s", name)
+		}
+	}
+
+	// Secrets need a variable name, secret, and key
+	spec.Spec.Metrics[0].Secrets = []api.SecretEnv{{Name: "API-TOKEN", SecretName: "credentials", Key: "token"}}
+	_, err = metrics.Render(spec)
+	if err == nil {
+		t.Error("expected a secret with an invalid variable name to not validate")
+	}
+}
+
+func TestRenderImageOverrides(t *testing.T) {
+	config.Set(config.Config{Images: map[string]string{
+		"io-fio":          "registry.example.com/metric-fio:site",
+		"perf-hpctoolkit": "registry.example.com/metric-hpctoolkit-view:site",
+	}})
+	defer config.Set(config.Config{})
+
+	// images returns the images of all containers (and init containers)
+	images := func(spec *api.MetricSet) []string {
+		rendering, err := metrics.Render(spec)
+		if err != nil {
+			t.Fatalf("render image overrides: %s", err)
+		}
+		found := []string{}
+		for _, rj := range rendering.JobSet.Spec.ReplicatedJobs {
+			pod := rj.Template.Spec.Template.Spec
+			for _, container := range append(pod.InitContainers, pod.Containers...) {
+				found = append(found, container.Image)
+			}
+		}
+		return found
+	}
+	contains := func(images []string, image string) bool {
+		for _, found := range images {
+			if found == image {
+				return true
+			}
+		}
+		return false
+	}
+
+	spec := getMetricSet("io-fio")
+	events := map[string]intstr.IntOrString{"events": intstr.FromString("-e IO")}
+	spec.Spec.Metrics[0].Addons = []api.MetricAddon{{Name: "perf-hpctoolkit", Options: events}}
+	found := images(spec)
+	for _, image := range []string{"registry.example.com/metric-fio:site", "registry.example.com/metric-hpctoolkit-view:site"} {
+		if !contains(found, image) {
+			t.Errorf("expected image override %s, found %s", image, found)
+		}
+	}
+
+	// Images on the MetricSet take precedence
+	spec.Spec.Metrics[0].Image = "example/fio:mine"
+	events["image"] = intstr.FromString("example/hpctoolkit:mine")
+	found = images(spec)
+	for _, image := range []string{"example/fio:mine", "example/hpctoolkit:mine"} {
+		if !contains(found, image) {
+			t.Errorf("expected MetricSet image %s, found %s", image, found)
+		}
+	}
+}
+
+func TestRenderNetwork(t *testing.T) {
+	spec := getMetricSet("network-netmark")
+	spec.Spec.ServiceName = "ms"
+	spec.Spec.Network = api.Network{EnableDNSHostnames: true, Subdomain: "bench"}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render network: %s", err)
+	}
+	network := rendering.JobSet.Spec.Network
+	if network == nil || network.EnableDNSHostnames == nil || !*network.EnableDNSHostnames || network.Subdomain != "bench" {
+		t.Errorf("expected JobSet DNS hostnames with subdomain bench, found %v", network)
+	}
+	for _, rj := range rendering.JobSet.Spec.ReplicatedJobs {
+		if rj.Template.Spec.Template.Spec.Subdomain != "bench" {
+			t.Errorf("expected pod subdomain bench for %s, found %s", rj.Name, rj.Template.Spec.Template.Spec.Subdomain)
+		}
+	}
+
+	// Hostnames in the entrypoints use the subdomain
+	found := false
+	for _, script := range rendering.Entrypoints {
+		if strings.Contains(script, ".bench.default.svc.cluster.local") {
+			found = true
+		}
+		if strings.Contains(script, ".ms.default.svc.cluster.local") {
+			t.Errorf("expected hostnames to use the subdomain, not the service name")
+		}
+	}
+	if !found {
+		t.Errorf("expected hostnames with the subdomain in the entrypoints")
+	}
+
+	// The subdomain is a DNS label
+	spec.Spec.Network.Subdomain = "Bench_1"
+	_, err = metrics.Render(spec)
+	if err == nil {
+		t.Error("expected an invalid subdomain to not validate")
+	}
+}
+
+func TestRenderProfile(t *testing.T) {
+	spec := getMetricSet("sys-hwloc")
+	spec.Spec.Profile = api.Profile{
+		Configurations: []api.ContainerResources{
+			{Requests: api.ContainerResource{"cpu": intstr.FromInt(1)}},
+			{Requests: api.ContainerResource{"cpu": intstr.FromInt(4)}},
+		},
+	}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		t.Fatalf("render profile: %s", err)
+	}
+
+	// Each configuration is a replicated job with its resources
+	cpus := map[string]string{}
+	for _, rj := range rendering.JobSet.Spec.ReplicatedJobs {
+		for _, c := range rj.Template.Spec.Template.Spec.Containers {
+			cpu := c.Resources.Requests[corev1.ResourceCPU]
+			cpus[rj.Name] = cpu.String()
+		}
+	}
+	if cpus["m0-p0"] != "1" || cpus["m0-p1"] != "4" {
+		t.Errorf("expected a replicated job for each configuration, found %v", cpus)
+	}
+
+	// One configuration is not a comparison
+	spec.Spec.Profile.Configurations = spec.Spec.Profile.Configurations[:1]
+	_, err = metrics.Render(spec)
+	if err == nil {
+		t.Error("expected a profile with one configuration to not validate")
+	}
+}
+
+// TestResolvedConfig checks that defaults are exported, and credentials redacted
+func TestResolvedConfig(t *testing.T) {
+	spec := getMetricSet("sys-hwloc")
+	spec.Spec.Metrics[0].Addons = []api.MetricAddon{
+		{Name: "perf-hpctoolkit", ListOptions: map[string][]intstr.IntOrString{"events": {intstr.FromString("IO")}}},
+		{Name: "commands", Options: map[string]intstr.IntOrString{"preBlock": intstr.FromString("export API_TOKEN=abc123")}},
+	}
+	set, err := metrics.NewMetricSet(spec)
+	if err != nil {
+		t.Fatalf("new metric set: %s", err)
+	}
+	resolved := metrics.ResolvedConfig(set)
+	if len(resolved) != 1 || resolved[0].Name != "sys-hwloc" || resolved[0].Image == "" {
+		t.Fatalf("unexpected resolved config %v", resolved)
+	}
+	if commands := resolved[0].ListOptions["commands"]; len(commands) != 2 || commands[0].StrVal != "lstopo architecture.png" {
+		t.Errorf("expected the default commands, found %v", commands)
+	}
+	addons := resolved[0].Addons
+	if len(addons) != 2 || addons[0].Name != "commands" || addons[1].Name != "perf-hpctoolkit" {
+		t.Fatalf("expected sorted addons, found %v", addons)
+	}
+	if preBlock := addons[0].Options["preBlock"].StrVal; preBlock != "export API_TOKEN=REDACTED" {
+		t.Errorf("expected the token to be redacted, found %q", preBlock)
+	}
+	if mount := addons[1].Options["mount"].StrVal; mount != "/opt/share" {
+		t.Errorf("expected the default mount, found %q", mount)
+	}
+}
+
+// TestRenderSyntax refuses a MetricSet with an entrypoint that would not parse
+func TestRenderSyntax(t *testing.T) {
+	spec := getMetricSet("app-custom")
+	spec.Spec.Metrics[0].Options = map[string]intstr.IntOrString{
+		"command": intstr.FromString("echo \"$(hostname)"),
+	}
+	_, err := metrics.Render(spec)
+	if !errors.Is(err, metrics.ErrEntrypointSyntax) {
+		t.Errorf("expected an entrypoint syntax error, found %v", err)
+	}
+	spec.Spec.Metrics[0].Options["command"] = intstr.FromString("echo \"$(hostname)\"")
+	_, err = metrics.Render(spec)
+	if err != nil {
+		t.Errorf("render syntax: %s", err)
+	}
+}
+
+// TestTemplates checks the fields used by the entrypoint templates of all
+// metrics and addons are in their contexts
+func TestTemplates(t *testing.T) {
+	err := specs.CheckTemplates()
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/logging"
+)
+
+// ResolvedConfig exports the options of each metric and addon in the set, after
+// defaults were applied. Values that are likely credentials are redacted.
+func ResolvedConfig(set *MetricSet) []api.ResolvedMetric {
+	resolved := []api.ResolvedMetric{}
+	for _, metric := range set.Metrics() {
+		m := (*metric)
+		rm := api.ResolvedMetric{
+			Name:        m.Name(),
+			Alias:       m.Alias(),
+			Image:       m.Image(),
+			Version:     Version(m),
+			Options:     resolveOptions(m.Options()),
+			ListOptions: resolveListOptions(m.ListOptions()),
+			MapOptions:  resolveMapOptions(m.MapOptions()),
+		}
+		for _, addon := range m.GetAddons() {
+			a := (*addon)
+			rm.Addons = append(rm.Addons, api.MetricAddon{
+				Name:        a.Name(),
+				Options:     resolveOptions(a.Options()),
+				ListOptions: resolveListOptions(a.ListOptions()),
+				MapOptions:  resolveMapOptions(a.MapOptions()),
+			})
+		}
+
+		// Addons are kept in a map, so they are sorted for a stable status
+		sort.Slice(rm.Addons, func(i, j int) bool { return rm.Addons[i].Name < rm.Addons[j].Name })
+		resolved = append(resolved, rm)
+	}
+	return resolved
+}
+
+// resolveOptions copies options, redacting credentials, and leaves out
+// empty (unset) string values
+func resolveOptions(options map[string]intstr.IntOrString) map[string]intstr.IntOrString {
+	resolved := map[string]intstr.IntOrString{}
+	for name, value := range options {
+		if value.Type == intstr.String {
+			if value.StrVal == "" {
+				continue
+			}
+			value = intstr.FromString(logging.RedactOption(name, value.StrVal))
+		}
+		resolved[name] = value
+	}
+	if len(resolved) == 0 {
+		return nil
+	}
+	return resolved
+}
+
+// resolveListOptions copies list options that are set, redacting credentials
+func resolveListOptions(options map[string][]intstr.IntOrString) map[string][]intstr.IntOrString {
+	resolved := map[string][]intstr.IntOrString{}
+	for name, values := range options {
+		for _, value := range values {
+			if value.Type == intstr.String {
+				value = intstr.FromString(logging.RedactOption(name, value.StrVal))
+			}
+			resolved[name] = append(resolved[name], value)
+		}
+	}
+	if len(resolved) == 0 {
+		return nil
+	}
+	return resolved
+}
+
+// resolveMapOptions copies map options that are set, redacting credentials
+func resolveMapOptions(options map[string]map[string]intstr.IntOrString) map[string]map[string]intstr.IntOrString {
+	resolved := map[string]map[string]intstr.IntOrString{}
+	for name, values := range options {
+		if values := resolveOptions(values); values != nil {
+			resolved[name] = values
+		}
+	}
+	if len(resolved) == 0 {
+		return nil
+	}
+	return resolved
+}
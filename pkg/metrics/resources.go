@@ -9,8 +9,11 @@ package metrics
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -20,13 +23,13 @@ import (
 // getResourceGroup can return a ResourceList for either requests or limits
 func getResourceGroup(items api.ContainerResource) (corev1.ResourceList, error) {
 
-	logger.Info("🍅️ Resource", "items", items)
+	logger.Debugw("🍅️ Resource", "items", items)
 	list := corev1.ResourceList{}
 	for key, unknownValue := range items {
 		if unknownValue.Type == intstr.Int {
 
 			value := unknownValue.IntVal
-			logger.Info("🍅️ ResourceKey", "Key", key, "Value", value)
+			logger.Debugw("🍅️ ResourceKey", "Key", key, "Value", value)
 			limit, err := resource.ParseQuantity(fmt.Sprintf("%d", value))
 			if err != nil {
 				return list, err
@@ -36,19 +39,27 @@ func getResourceGroup(items api.ContainerResource) (corev1.ResourceList, error)
 				list[corev1.ResourceMemory] = limit
 			} else if key == "cpu" {
 				list[corev1.ResourceCPU] = limit
+			} else if key == "ephemeralStorage" {
+				list[corev1.ResourceEphemeralStorage] = limit
 			} else {
 				list[corev1.ResourceName(key)] = limit
 			}
 		} else if unknownValue.Type == intstr.String {
 
 			value := unknownValue.StrVal
-			logger.Info("🍅️ ResourceKey", "Key", key, "Value", value)
+			logger.Debugw("🍅️ ResourceKey", "Key", key, "Value", value)
+			limit, err := resource.ParseQuantity(value)
+			if err != nil {
+				return list, fmt.Errorf("resource %s has an invalid quantity %s: %s", key, value, err)
+			}
 			if key == "memory" {
-				list[corev1.ResourceMemory] = resource.MustParse(value)
+				list[corev1.ResourceMemory] = limit
 			} else if key == "cpu" {
-				list[corev1.ResourceCPU] = resource.MustParse(value)
+				list[corev1.ResourceCPU] = limit
+			} else if key == "ephemeralStorage" {
+				list[corev1.ResourceEphemeralStorage] = limit
 			} else {
-				list[corev1.ResourceName(key)] = resource.MustParse(value)
+				list[corev1.ResourceName(key)] = limit
 			}
 		}
 	}
@@ -91,3 +102,56 @@ func getPodResources(set *api.MetricSet) (corev1.ResourceList, error) {
 	}
 	return resources, nil
 }
+
+// checkScratchNeeds returns a warning if a metric writes more temporary data to
+// the container filesystem (or an emptyDir) than the ephemeral storage it asks
+// for, since the pod can be evicted for using more than its limit
+func checkScratchNeeds(
+	cs *specs.ContainerSpec,
+	volumes []specs.VolumeSpec,
+	mounts []corev1.VolumeMount,
+	resources corev1.ResourceRequirements,
+) string {
+	needs := cs.Scratch
+	if needs == nil || needs.Size.IsZero() {
+		return ""
+	}
+
+	// Data on a volume (other than an emptyDir on disk) is not ephemeral storage
+	ephemeral := map[string]bool{}
+	for _, volume := range volumes {
+		emptyDir := volume.Volume.EmptyDir
+		ephemeral[volume.Volume.Name] = emptyDir != nil && emptyDir.Medium == corev1.StorageMediumDefault
+	}
+	for _, mount := range mounts {
+		if isUnderPath(needs.Path, mount.MountPath) && !ephemeral[mount.Name] {
+			return ""
+		}
+	}
+
+	// The limit is what the pod is evicted for, otherwise the request
+	requested, ok := resources.Limits[corev1.ResourceEphemeralStorage]
+	if !ok {
+		requested, ok = resources.Requests[corev1.ResourceEphemeralStorage]
+	}
+	if !ok {
+		return fmt.Sprintf(
+			"Metric %s writes %s to %s without ephemeral-storage resources, request at least that much (or use a volume) so it is not evicted",
+			cs.Metric, needs.Size.String(), needs.Path,
+		)
+	}
+	if requested.Cmp(needs.Size) < 0 {
+		return fmt.Sprintf(
+			"Metric %s writes %s to %s, more than the %s of ephemeral-storage requested, and can be evicted",
+			cs.Metric, needs.Size.String(), needs.Path, requested.String(),
+		)
+	}
+	return ""
+}
+
+// isUnderPath determines if a path is (or is in) a directory
+func isUnderPath(path, dir string) bool {
+	path = filepath.Clean(path)
+	dir = filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestGetResourceGroup(t *testing.T) {
+	list, err := getResourceGroup(api.ContainerResource{
+		"cpu":              intstr.FromInt(2),
+		"ephemeralStorage": intstr.FromString("10Gi"),
+	})
+	if err != nil {
+		t.Fatalf("resource group: %s", err)
+	}
+	storage := list[corev1.ResourceEphemeralStorage]
+	if storage.String() != "10Gi" {
+		t.Errorf("expected 10Gi of ephemeral-storage, found %s", storage.String())
+	}
+
+	// An invalid quantity is an error (and not a panic)
+	_, err = getResourceGroup(api.ContainerResource{"ephemeral-storage": intstr.FromString("lots")})
+	if err == nil {
+		t.Error("expected an invalid quantity to be an error")
+	}
+}
+
+func TestCheckScratchNeeds(t *testing.T) {
+	cs := &specs.ContainerSpec{
+		Metric:  "io-fio",
+		Scratch: &specs.ScratchNeeds{Path: "/tmp", Size: resource.MustParse("4Gi")},
+	}
+	withStorage := func(quantity string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse(quantity)},
+		}
+	}
+	volumes := []specs.VolumeSpec{
+		{Volume: corev1.Volume{Name: "scratch", VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "scratch"},
+		}}},
+		{Volume: corev1.Volume{Name: "empty", VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		}}},
+	}
+
+	tests := []struct {
+		name      string
+		mounts    []corev1.VolumeMount
+		resources corev1.ResourceRequirements
+		warning   string
+	}{
+		{name: "no request", warning: "without ephemeral-storage"},
+		{name: "too small", resources: withStorage("1Gi"), warning: "more than the 1Gi"},
+		{name: "enough", resources: withStorage("8Gi")},
+		{name: "on a volume", mounts: []corev1.VolumeMount{{Name: "scratch", MountPath: "/tmp"}}},
+		{name: "on an emptyDir", mounts: []corev1.VolumeMount{{Name: "empty", MountPath: "/"}}, warning: "without ephemeral-storage"},
+		{name: "other volume", mounts: []corev1.VolumeMount{{Name: "scratch", MountPath: "/tmpdata"}}, warning: "without ephemeral-storage"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warning := checkScratchNeeds(cs, volumes, test.mounts, test.resources)
+			if test.warning == "" && warning != "" {
+				t.Errorf("expected no warning, found %q", warning)
+			}
+			if test.warning != "" && !strings.Contains(warning, test.warning) {
+				t.Errorf("expected warning with %q, found %q", test.warning, warning)
+			}
+		})
+	}
+}
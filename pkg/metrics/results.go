@@ -0,0 +1,75 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"path/filepath"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Results are written to a volume mounted in all containers, under a directory
+// per MetricSet and run. The prelude adds the job and pod to the path. It is a
+// sibling of /metrics_operator, since a mount under the read-only config map
+// volume needs the directory to exist there (and a runtime may not allow it).
+const (
+	ResultsRoot       = "/metrics_operator_results"
+	resultsVolumeName = "metrics-operator-results"
+)
+
+// getResultsVolumes returns the results volume for all containers, an empty
+// volume unless an existing persistent volume claim is provided
+func getResultsVolumes(set *api.MetricSet) []specs.VolumeSpec {
+	source := corev1.VolumeSource{
+		EmptyDir: &corev1.EmptyDirVolumeSource{},
+	}
+	if set.Spec.Results.ClaimName != "" {
+		source = corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: set.Spec.Results.ClaimName,
+			},
+		}
+	}
+	volume := corev1.Volume{
+		Name:         resultsVolumeName,
+		VolumeSource: source,
+	}
+	return []specs.VolumeSpec{{
+		Volume: volume,
+		Path:   ResultsRoot,
+		Mount:  true,
+	}}
+}
+
+// getResultsRun is the results directory for this run of the MetricSet.
+// Runs are named by creation time so they sort oldest to newest for pruning,
+// and the start of the uid, so a MetricSet created again in the same second
+// (e.g., deleted and applied) does not write to the same run.
+func getResultsRun(set *api.MetricSet) string {
+	run := set.CreationTimestamp.UTC().Format("20060102-150405")
+	uid := string(set.UID)
+	if len(uid) > 8 {
+		uid = uid[:8]
+	}
+	if uid != "" {
+		run = fmt.Sprintf("%s-%s", run, uid)
+	}
+	return filepath.Join(ResultsRoot, set.Name, run)
+}
+
+// getResultsEnvironment tells the prelude where to write results, and how to finish them
+func getResultsEnvironment(set *api.MetricSet) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{Name: "METRICS_OPERATOR_RESULTS_RUN", Value: getResultsRun(set)},
+		{Name: "METRICS_OPERATOR_RESULTS_COMPRESS", Value: fmt.Sprintf("%t", set.Spec.Results.Compress)},
+		{Name: "METRICS_OPERATOR_RESULTS_KEEP", Value: fmt.Sprintf("%d", set.Spec.Results.Keep)},
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetResultsRun(t *testing.T) {
+	created := metav1.NewTime(time.Date(2023, 8, 1, 15, 30, 0, 0, time.UTC))
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "bench", CreationTimestamp: created}}
+	if run := getResultsRun(set); run != "/metrics_operator_results/bench/20230801-153000" {
+		t.Errorf("unexpected run %s", run)
+	}
+
+	// A MetricSet created again in the same second gets a new run
+	set.UID = "5f1c2a9e-0000-4000-8000-000000000001"
+	first := getResultsRun(set)
+	set.UID = "7d3e4b1f-0000-4000-8000-000000000002"
+	second := getResultsRun(set)
+	if first != "/metrics_operator_results/bench/20230801-153000-5f1c2a9e" || first == second {
+		t.Errorf("expected runs named by the uid, found %s and %s", first, second)
+	}
+}
+
+func TestResultsKeepValidate(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "bench"}}
+	set.Spec.Pods = 1
+	set.Spec.Metrics = []api.Metric{{Name: "io-fio"}}
+	set.Spec.Results.Keep = 5
+	if set.Validate() {
+		t.Errorf("expected keep without a claimName to not validate")
+	}
+	set.Spec.Results.ClaimName = "benchmark-results"
+	if !set.Validate() {
+		t.Errorf("expected keep with a claimName to validate")
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// chownContainerName is the init container that chowns volumes for the runAs user
+const chownContainerName = "chown-volumes"
+
+// getPodSecurityContext returns the supplemental groups of the pod, if any
+func getPodSecurityContext(set *api.MetricSet) *corev1.PodSecurityContext {
+	if len(set.Spec.Pod.RunAs.SupplementalGroups) == 0 || set.IsWindows() {
+		return nil
+	}
+	return &corev1.PodSecurityContext{SupplementalGroups: set.Spec.Pod.RunAs.SupplementalGroups}
+}
+
+// runsAs determines if a container runs as the runAs user and group. Init containers
+// (e.g., to copy tools or chown volumes) and containers that are privileged or add
+// capabilities keep the user of their image.
+func runsAs(set *api.MetricSet, cs *specs.ContainerSpec) bool {
+	if !set.Spec.Pod.RunAs.Enabled() || cs.InitContainer {
+		return false
+	}
+	sc := cs.Attributes.SecurityContext
+	return !sc.Privileged && !sc.AllowPtrace && !sc.AllowAdmin && !sc.AllowPerfmon && len(cs.Capabilities) == 0
+}
+
+// setRunAs sets the runAs user and group of a container security context
+func setRunAs(set *api.MetricSet, sc *corev1.SecurityContext) {
+	runAs := set.Spec.Pod.RunAs
+	if runAs.User > 0 {
+		sc.RunAsUser = &runAs.User
+	}
+	if runAs.Group > 0 {
+		sc.RunAsGroup = &runAs.Group
+	}
+}
+
+// getChownPaths returns the mount paths of the scratch, results, and checkpoint
+// volumes, and the directories of the MetricSet under the results and checkpoints
+// (where the runs are written), to chown for the runAs user
+func getChownPaths(set *api.MetricSet, volumes []specs.VolumeSpec) []string {
+	paths := []string{}
+	for _, volume := range volumes {
+		switch volume.Volume.Name {
+		case scratchVolumeName:
+			paths = append(paths, volume.Path)
+		case resultsVolumeName, checkpointVolumeName:
+			paths = append(paths, volume.Path, filepath.Join(volume.Path, set.Name))
+		}
+	}
+	return paths
+}
+
+// getChownContainers returns an init container that chowns the scratch, results,
+// and checkpoint volumes to the runAs user and group, if requested. It is not
+// recursive, and a filesystem that squashes root does not allow it, so a failure
+// is reported and the containers still start.
+func getChownContainers(set *api.MetricSet, volumes []specs.VolumeSpec) []specs.ContainerSpec {
+	runAs := set.Spec.Pod.RunAs
+	paths := getChownPaths(set, volumes)
+	if !runAs.Chown || len(paths) == 0 {
+		return []specs.ContainerSpec{}
+	}
+	owner := ""
+	if runAs.User > 0 {
+		owner = fmt.Sprintf("%d", runAs.User)
+	}
+	if runAs.Group > 0 {
+		owner += fmt.Sprintf(":%d", runAs.Group)
+	}
+	quoted := []string{}
+	for _, path := range paths {
+		quoted = append(quoted, specs.ShellQuote(path))
+	}
+	dirs := strings.Join(quoted, " ")
+	script := fmt.Sprintf(`mkdir -p %s && chown %s %s && echo "Changed the owner of %s to %s" || echo "Could not chown %s to %s (the filesystem may squash root), the user needs to be able to write to them"`,
+		dirs, owner, dirs, strings.Join(paths, " "), owner, strings.Join(paths, " "), owner)
+
+	return []specs.ContainerSpec{{
+		Name:          chownContainerName,
+		Image:         runAs.Image,
+		InitContainer: true,
+		Command:       []string{"sh", "-c", script},
+		Resources:     &api.ContainerResources{},
+		Attributes:    &api.ContainerSpec{},
+	}}
+}
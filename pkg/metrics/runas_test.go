@@ -0,0 +1,83 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRunAs(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "bench"}}
+	set.Spec.Pod.RunAs = api.RunAs{User: 1000, Group: 2000, SupplementalGroups: []int64{3000}}
+
+	tests := []struct {
+		name string
+		cs   specs.ContainerSpec
+		runs bool
+	}{
+		{name: "metric", cs: specs.ContainerSpec{}, runs: true},
+		{name: "init", cs: specs.ContainerSpec{InitContainer: true}},
+		{name: "privileged", cs: specs.ContainerSpec{Attributes: &api.ContainerSpec{SecurityContext: api.SecurityContext{Privileged: true}}}},
+		{name: "ptrace", cs: specs.ContainerSpec{Attributes: &api.ContainerSpec{SecurityContext: api.SecurityContext{AllowPtrace: true}}}},
+		{name: "capabilities", cs: specs.ContainerSpec{Capabilities: []corev1.Capability{"NET_RAW"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.cs.Attributes == nil {
+				test.cs.Attributes = &api.ContainerSpec{}
+			}
+			sc := getSecurityContext(set, &test.cs)
+			runs := sc.RunAsUser != nil && *sc.RunAsUser == 1000 && sc.RunAsGroup != nil && *sc.RunAsGroup == 2000
+			if runs != test.runs {
+				t.Errorf("expected the container to run as the user to be %t, found %v", test.runs, sc)
+			}
+		})
+	}
+	pod := getPodSecurityContext(set)
+	if pod == nil || len(pod.SupplementalGroups) != 1 || pod.SupplementalGroups[0] != 3000 {
+		t.Errorf("expected the supplemental groups for the pod, found %v", pod)
+	}
+}
+
+func TestGetChownContainers(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "bench"}}
+	set.Spec.Pod.RunAs = api.RunAs{User: 1000, Image: "busybox:stable"}
+	volumes := []specs.VolumeSpec{
+		{Volume: corev1.Volume{Name: scratchVolumeName}, Path: "/scratch"},
+		{Volume: corev1.Volume{Name: resultsVolumeName}, Path: ResultsRoot},
+		{Volume: corev1.Volume{Name: "data"}, Path: "/data"},
+	}
+
+	// Nothing to chown unless it is requested
+	if containers := getChownContainers(set, volumes); len(containers) != 0 {
+		t.Errorf("expected no chown without it requested, found %v", containers)
+	}
+	set.Spec.Pod.RunAs.Chown = true
+	containers := getChownContainers(set, volumes)
+	if len(containers) != 1 || !containers[0].InitContainer || containers[0].Name != chownContainerName {
+		t.Fatalf("expected a chown init container, found %v", containers)
+	}
+	script := containers[0].Command[2]
+	expected := "chown 1000 '/scratch' '" + ResultsRoot + "' '" + ResultsRoot + "/bench' &&"
+	if !strings.Contains(script, expected) || strings.Contains(script, "/data") {
+		t.Errorf("expected the scratch and results volumes to be chowned, found %s", script)
+	}
+
+	// A group only is chowned as such
+	set.Spec.Pod.RunAs = api.RunAs{Group: 2000, Chown: true}
+	script = getChownContainers(set, volumes)[0].Command[2]
+	if !strings.Contains(script, "chown :2000 ") {
+		t.Errorf("expected the group to be chowned, found %s", script)
+	}
+}
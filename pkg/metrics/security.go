@@ -0,0 +1,138 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// ErrSecurityProfile is returned when a metric or addon cannot run under the security profile
+var ErrSecurityProfile = errors.New("security profile")
+
+// Capabilities the baseline Pod Security Standard allows to be added
+var baselineCapabilities = map[corev1.Capability]bool{
+	"AUDIT_WRITE":      true,
+	"CHOWN":            true,
+	"DAC_OVERRIDE":     true,
+	"FOWNER":           true,
+	"FSETID":           true,
+	"KILL":             true,
+	"MKNOD":            true,
+	"NET_BIND_SERVICE": true,
+	"SETFCAP":          true,
+	"SETGID":           true,
+	"SETPCAP":          true,
+	"SETUID":           true,
+	"SYS_CHROOT":       true,
+}
+
+// Capabilities the restricted Pod Security Standard allows to be added
+var restrictedCapabilities = map[corev1.Capability]bool{
+	"NET_BIND_SERVICE": true,
+}
+
+// getHostUsers returns false (a user namespace for the pod), if requested
+func getHostUsers(set *api.MetricSet) *bool {
+	if !set.Spec.Pod.UserNamespaces {
+		return nil
+	}
+	hostUsers := false
+	return &hostUsers
+}
+
+// applySecurityProfile adjusts the pods of the replicated jobs for the security
+// profile, and returns an error for anything the profile (or user namespaces) does not allow
+func applySecurityProfile(set *api.MetricSet, rjs []jobset.ReplicatedJob) error {
+	for i := range rjs {
+		pod := &rjs[i].Template.Spec.Template.Spec
+
+		// A pod in a user namespace cannot share the namespaces of the host
+		if set.Spec.Pod.UserNamespaces && (pod.HostNetwork || pod.HostPID || pod.HostIPC) {
+			return fmt.Errorf("%w: replicated job %s uses host namespaces, which user namespaces do not allow", ErrSecurityProfile, rjs[i].Name)
+		}
+		if set.IsPrivilegedProfile() {
+			continue
+		}
+		if set.Spec.SecurityProfile == api.RestrictedProfile && !set.IsWindows() {
+			restrictPod(pod)
+		}
+		err := checkPodSecurity(set.Spec.SecurityProfile, rjs[i].Name, pod)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restrictPod drops all capabilities, disallows privilege escalation, and requires
+// a non-root user and the runtime default seccomp profile
+func restrictPod(pod *corev1.PodSpec) {
+	nonRoot := true
+	if pod.SecurityContext == nil {
+		pod.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	pod.SecurityContext.RunAsNonRoot = &nonRoot
+	pod.SecurityContext.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+
+	for _, containers := range [][]corev1.Container{pod.InitContainers, pod.Containers} {
+		for i := range containers {
+			escalation := false
+			if containers[i].SecurityContext == nil {
+				containers[i].SecurityContext = &corev1.SecurityContext{}
+			}
+			sc := containers[i].SecurityContext
+			sc.AllowPrivilegeEscalation = &escalation
+			if sc.Capabilities == nil {
+				sc.Capabilities = &corev1.Capabilities{}
+			}
+			sc.Capabilities.Drop = []corev1.Capability{"ALL"}
+		}
+	}
+}
+
+// checkPodSecurity returns an error for host namespaces, host paths, privileged
+// containers, or capabilities that the profile does not allow
+func checkPodSecurity(profile, job string, pod *corev1.PodSpec) error {
+	if pod.HostNetwork || pod.HostPID || pod.HostIPC {
+		return fmt.Errorf("%w: replicated job %s uses host namespaces, which %s does not allow", ErrSecurityProfile, job, profile)
+	}
+	for _, volume := range pod.Volumes {
+		if volume.HostPath != nil {
+			return fmt.Errorf("%w: replicated job %s uses host path %s (volume %s), which %s does not allow", ErrSecurityProfile, job, volume.HostPath.Path, volume.Name, profile)
+		}
+	}
+	allowed := baselineCapabilities
+	if profile == api.RestrictedProfile {
+		allowed = restrictedCapabilities
+	}
+	for _, containers := range [][]corev1.Container{pod.InitContainers, pod.Containers} {
+		for _, container := range containers {
+			sc := container.SecurityContext
+			if sc == nil {
+				continue
+			}
+			if sc.Privileged != nil && *sc.Privileged {
+				return fmt.Errorf("%w: container %s of replicated job %s is privileged, which %s does not allow", ErrSecurityProfile, container.Name, job, profile)
+			}
+			if sc.Capabilities == nil {
+				continue
+			}
+			for _, capability := range sc.Capabilities.Add {
+				if !allowed[capability] {
+					return fmt.Errorf("%w: container %s of replicated job %s adds capability %s, which %s does not allow", ErrSecurityProfile, container.Name, job, capability, profile)
+				}
+			}
+		}
+	}
+	return nil
+}
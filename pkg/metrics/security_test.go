@@ -0,0 +1,107 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestApplySecurityProfile(t *testing.T) {
+	privileged := true
+	withPod := func(pod corev1.PodSpec) []jobset.ReplicatedJob {
+		rj := jobset.ReplicatedJob{Name: "m"}
+		rj.Template.Spec.Template.Spec = pod
+		return []jobset.ReplicatedJob{rj}
+	}
+	withCapability := func(capability corev1.Capability) corev1.PodSpec {
+		return corev1.PodSpec{Containers: []corev1.Container{{
+			Name:            "app",
+			SecurityContext: &corev1.SecurityContext{Capabilities: &corev1.Capabilities{Add: []corev1.Capability{capability}}},
+		}}}
+	}
+	hostPath := corev1.PodSpec{Volumes: []corev1.Volume{{
+		Name:         "cache",
+		VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/cache"}},
+	}}}
+
+	tests := []struct {
+		name    string
+		profile string
+		userns  bool
+		pod     corev1.PodSpec
+		refused bool
+	}{
+		{name: "privileged allows all", profile: api.PrivilegedProfile, pod: corev1.PodSpec{HostNetwork: true}},
+		{name: "host network", profile: api.BaselineProfile, pod: corev1.PodSpec{HostNetwork: true}, refused: true},
+		{name: "host path", profile: api.BaselineProfile, pod: hostPath, refused: true},
+		{name: "privileged container", profile: api.BaselineProfile, refused: true, pod: corev1.PodSpec{InitContainers: []corev1.Container{{
+			Name:            "coredump",
+			SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+		}}}},
+		{name: "baseline capability", profile: api.BaselineProfile, pod: withCapability("NET_BIND_SERVICE")},
+		{name: "baseline ptrace", profile: api.BaselineProfile, pod: withCapability("SYS_PTRACE"), refused: true},
+		{name: "restricted capability", profile: api.RestrictedProfile, pod: withCapability("NET_BIND_SERVICE")},
+		{name: "restricted chown", profile: api.RestrictedProfile, pod: withCapability("CHOWN"), refused: true},
+		{name: "user namespace", profile: api.PrivilegedProfile, userns: true, pod: withCapability("SYS_ADMIN")},
+		{name: "user namespace host network", profile: api.PrivilegedProfile, userns: true, pod: corev1.PodSpec{HostNetwork: true}, refused: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set := &api.MetricSet{Spec: api.MetricSetSpec{SecurityProfile: test.profile, Pod: api.Pod{UserNamespaces: test.userns}}}
+			err := applySecurityProfile(set, withPod(test.pod))
+			if test.refused && !errors.Is(err, ErrSecurityProfile) {
+				t.Errorf("expected a security profile error, found %v", err)
+			}
+			if !test.refused && err != nil {
+				t.Errorf("expected no error, found %s", err)
+			}
+		})
+	}
+
+	// Restricted pods drop all capabilities and run as non-root
+	rjs := withPod(withCapability("NET_BIND_SERVICE"))
+	set := &api.MetricSet{Spec: api.MetricSetSpec{SecurityProfile: api.RestrictedProfile}}
+	err := applySecurityProfile(set, rjs)
+	if err != nil {
+		t.Fatalf("restricted: %s", err)
+	}
+	pod := rjs[0].Template.Spec.Template.Spec
+	sc := pod.Containers[0].SecurityContext
+	if !*pod.SecurityContext.RunAsNonRoot || *sc.AllowPrivilegeEscalation || sc.Capabilities.Drop[0] != "ALL" {
+		t.Errorf("expected a restricted pod, found %v and %v", pod.SecurityContext, sc)
+	}
+}
+
+func TestGetHostUsers(t *testing.T) {
+	set := &api.MetricSet{}
+	if getHostUsers(set) != nil {
+		t.Error("expected host users to be unset by default")
+	}
+	set.Spec.Pod.UserNamespaces = true
+	hostUsers := getHostUsers(set)
+	if hostUsers == nil || *hostUsers {
+		t.Errorf("expected host users to be false for user namespaces, found %v", hostUsers)
+	}
+}
+
+func TestGetSecurityContext(t *testing.T) {
+	cs := &specs.ContainerSpec{
+		Attributes:   &api.ContainerSpec{SecurityContext: api.SecurityContext{AllowPtrace: true}},
+		Capabilities: []corev1.Capability{"NET_RAW"},
+	}
+	sc := getSecurityContext(&api.MetricSet{}, cs)
+	if len(sc.Capabilities.Add) != 2 || sc.Capabilities.Add[0] != capPtrace || sc.Capabilities.Add[1] != "NET_RAW" {
+		t.Errorf("expected the attribute and container capabilities, found %v", sc.Capabilities.Add)
+	}
+}
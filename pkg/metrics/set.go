@@ -28,6 +28,7 @@ const (
 	NetworkFamily         = "network"
 	SimulationFamily      = "simulation"
 	SolverFamily          = "solver"
+	DatabaseFamily        = "database"
 
 	// Generic (more than one type, CPU/io, etc)
 	ProxyAppFamily    = "proxyapp"
@@ -44,7 +45,7 @@ func (m MetricSet) Metrics() []*Metric {
 	return m.metrics
 }
 func (m MetricSet) Exists(metric *Metric) bool {
-	_, ok := m.metricNames[(*metric).Name()]
+	_, ok := m.metricNames[metricKey(*metric)]
 	return ok
 }
 
@@ -66,7 +67,7 @@ func (ms *MetricSet) Add(metric *Metric) {
 	m := (*metric)
 	if !ms.Exists(metric) {
 		ms.metrics = append(ms.metrics, metric)
-		ms.metricNames[m.Name()] = true
+		ms.metricNames[metricKey(m)] = true
 	}
 }
 
@@ -85,8 +86,21 @@ func AssembleReplicatedJob(
 		jobname = ReplicatedJobName
 	}
 
+	// The spec can size the role (replicated job) differently than the metric
+	pods = set.RolePods(jobname, pods)
+	completions = set.RolePods(jobname, completions)
+
+	// Windows pods cannot share the process namespace
+	if set.IsWindows() {
+		shareProcessNamespace = false
+	}
+
 	// Pod labels from the MetricSet
 	podLabels := set.GetPodLabels()
+	addPodGroupLabels(set, podLabels)
+	for key, value := range getProvenanceLabels(set) {
+		podLabels[key] = value
+	}
 
 	// Always indexed completion mode to have predictable hostnames
 	completionMode := batchv1.IndexedCompletion
@@ -121,18 +135,22 @@ func AssembleReplicatedJob(
 				Name:        set.Name,
 				Namespace:   set.Namespace,
 				Labels:      podLabels,
-				Annotations: set.Spec.Pod.Annotations,
+				Annotations: getPodAnnotations(set),
 			},
 			Spec: corev1.PodSpec{
 				// matches the service
-				Subdomain:     set.Spec.ServiceName,
+				Subdomain:     set.Subdomain(),
 				RestartPolicy: corev1.RestartPolicyOnFailure,
 
 				// This is important to share the process namespace!
 				SetHostnameAsFQDN:     &setAsFDQN,
 				ShareProcessNamespace: &shareProcessNamespace,
 				ServiceAccountName:    set.Spec.Pod.ServiceAccountName,
-				NodeSelector:          set.Spec.Pod.NodeSelector,
+				NodeSelector:          getPodNodeSelector(set),
+				OS:                    getPodOS(set),
+				HostUsers:             getHostUsers(set),
+				SecurityContext:       getPodSecurityContext(set),
+				SchedulerName:         getSchedulerName(set),
 			},
 		},
 	}
@@ -142,6 +160,15 @@ func AssembleReplicatedJob(
 		jobspec.Template.Spec.Affinity = getAffinity(set)
 	}
 
+	// Are we asking for specific instance types?
+	nodeAffinity := getNodeAffinity(set)
+	if nodeAffinity != nil {
+		if jobspec.Template.Spec.Affinity == nil {
+			jobspec.Template.Spec.Affinity = &corev1.Affinity{}
+		}
+		jobspec.Template.Spec.Affinity.NodeAffinity = nodeAffinity
+	}
+
 	// Tie the jobspec to the job
 	job.Template.Spec = jobspec
 	return &job, nil
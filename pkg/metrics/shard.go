@@ -0,0 +1,108 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// ShardLabel is on the JobSet (and pods) of a shard with its index. The pods
+// keep the MetricSet label of the whole set, so status (e.g., nodes) and
+// results cover every shard.
+const ShardLabel = "metrics-operator-shard"
+
+// GetShard returns the MetricSet for one shard: a copy with the shard name,
+// its share of the pods, and its own subdomain (and headless service), so the
+// hostlist of a shard is only its own pods
+func GetShard(set *api.MetricSet, index int) *api.MetricSet {
+	shard := set.DeepCopy()
+	shard.Name = set.ShardName(index)
+	shard.Spec.Pods = set.Spec.Pods / set.Spec.Shards
+	shard.Spec.Shards = 0
+	shard.Spec.Network.Subdomain = fmt.Sprintf("%s-s%d", set.Subdomain(), index)
+	return shard
+}
+
+// GetShardJobSet returns the (suspended) JobSet for one shard, and the container
+// specs for its config maps. The JobSet and pods are labeled for the MetricSet
+// and shard, and results are written to the run directory of the MetricSet.
+// The metrics (and addons) are set up for the shard, so they see its pods and
+// subdomain.
+func GetShardJobSet(spec *api.MetricSet, index int) (*jobset.JobSet, []*specs.ContainerSpec, error) {
+	shard := GetShard(spec, index)
+	set, err := NewMetricSet(shard)
+	if err != nil {
+		return nil, nil, err
+	}
+	js, cs, err := GetJobSet(shard, set)
+	if err != nil {
+		return js, cs, err
+	}
+	value := fmt.Sprintf("%d", index)
+	js.Labels[MetricSetLabel] = spec.Name
+	js.Labels[ShardLabel] = value
+
+	// The shards start together, when they all exist
+	suspend := true
+	js.Spec.Suspend = &suspend
+
+	env := map[string]string{
+		"METRICS_OPERATOR_RESULTS_RUN": getResultsRun(spec),
+		"METRICS_OPERATOR_SHARD":       value,
+		"METRICS_OPERATOR_SHARDS":      fmt.Sprintf("%d", spec.Spec.Shards),
+	}
+	for i := range js.Spec.ReplicatedJobs {
+		pod := &js.Spec.ReplicatedJobs[i].Template.Spec.Template
+
+		// Pod labels are shared by the replicated jobs, so each gets a copy here
+		labels := map[string]string{}
+		for key, value := range pod.Labels {
+			labels[key] = value
+		}
+		labels["cluster-name"] = spec.Name
+		labels[MetricSetLabel] = spec.Name
+		labels[podLabelAppName] = spec.Name
+		labels[ShardLabel] = value
+		pod.Labels = labels
+
+		// Sole tenancy spreads the pods of all shards
+		if pod.Spec.Affinity != nil && pod.Spec.Affinity.PodAntiAffinity != nil {
+			affinity := getAffinity(spec)
+			affinity.NodeAffinity = pod.Spec.Affinity.NodeAffinity
+			pod.Spec.Affinity = affinity
+		}
+		setShardEnvironment(pod.Spec.InitContainers, env)
+		setShardEnvironment(pod.Spec.Containers, env)
+	}
+	return js, cs, nil
+}
+
+// setShardEnvironment sets (or adds) the shard environment of containers
+func setShardEnvironment(containers []corev1.Container, env map[string]string) {
+	for i := range containers {
+		container := &containers[i]
+		seen := map[string]bool{}
+		for j, variable := range container.Env {
+			value, ok := env[variable.Name]
+			if ok {
+				container.Env[j].Value = value
+				seen[variable.Name] = true
+			}
+		}
+		for _, name := range []string{"METRICS_OPERATOR_SHARD", "METRICS_OPERATOR_SHARDS"} {
+			if !seen[name] {
+				container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: env[name]})
+			}
+		}
+	}
+}
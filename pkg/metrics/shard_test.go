@@ -0,0 +1,97 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+func TestShardJobSet(t *testing.T) {
+	spec := getMetricSet("network-osu-benchmark")
+	spec.Spec.ServiceName = "ms"
+	spec.Spec.Pods = 4
+	spec.Spec.Shards = 2
+	if !spec.Validate() {
+		t.Fatal("expected a sharded MetricSet to validate")
+	}
+	run := ""
+	for i := 0; i < 2; i++ {
+		js, cs, err := metrics.GetShardJobSet(spec, i)
+		if err != nil {
+			t.Fatalf("shard %d: %s", i, err)
+		}
+		name := spec.ShardName(i)
+		if js.Name != name || js.Labels[metrics.MetricSetLabel] != "golden" || js.Labels[metrics.ShardLabel] == "" {
+			t.Errorf("expected shard %s labeled for the MetricSet, found %s %v", name, js.Name, js.Labels)
+		}
+		if js.Spec.Suspend == nil || !*js.Spec.Suspend {
+			t.Errorf("expected shard %s to be created suspended", name)
+		}
+		subdomain := "ms-s" + js.Labels[metrics.ShardLabel]
+		if js.Spec.Network.Subdomain != subdomain {
+			t.Errorf("expected shard %s subdomain %s, found %s", name, subdomain, js.Spec.Network.Subdomain)
+		}
+		pods := int32(0)
+		for _, rj := range js.Spec.ReplicatedJobs {
+			pod := rj.Template.Spec.Template
+			pods += *rj.Template.Spec.Parallelism
+			if pod.Labels[metrics.MetricSetLabel] != "golden" || pod.Labels[metrics.ShardLabel] != js.Labels[metrics.ShardLabel] {
+				t.Errorf("expected shard %s pods labeled for the MetricSet and shard, found %v", name, pod.Labels)
+			}
+			for _, env := range pod.Spec.Containers[0].Env {
+				if env.Name != "METRICS_OPERATOR_RESULTS_RUN" {
+					continue
+				}
+				if run != "" && env.Value != run {
+					t.Errorf("expected the shards to share a results run, found %s and %s", run, env.Value)
+				}
+				run = env.Value
+			}
+		}
+		if pods != 2 {
+			t.Errorf("expected shard %s to have half of the pods, found %d", name, pods)
+		}
+
+		// The hostlist of a shard is its own pods
+		found := false
+		for _, c := range cs {
+			script := c.EntrypointScript.WriteScript()
+			if strings.Contains(script, name+"-l-0-0."+subdomain) {
+				found = true
+			}
+			other := spec.ShardName(1-i) + "-"
+			if strings.Contains(script, other) {
+				t.Errorf("expected shard %s entrypoints to not list hosts of %s", name, other)
+			}
+		}
+		if !found {
+			t.Errorf("expected shard %s entrypoints to list its own hosts", name)
+		}
+	}
+	if !strings.HasPrefix(run, metrics.ResultsRoot+"/golden/") {
+		t.Errorf("expected results in the run of the MetricSet, found %s", run)
+	}
+
+	// Pods that do not divide into the shards, and features for one JobSet, do not validate
+	uneven := getMetricSet("network-osu-benchmark")
+	uneven.Spec.Pods = 3
+	uneven.Spec.Shards = 2
+	placed := getMetricSet("network-osu-benchmark")
+	placed.Spec.Pods = 4
+	placed.Spec.Shards = 2
+	placed.Spec.Metrics[0].Placement = api.PlacementSameZone
+	for _, set := range []*api.MetricSet{uneven, placed} {
+		if set.Validate() {
+			t.Errorf("expected shards of %d pods with placement %q to not validate", set.Spec.Pods, set.Spec.Metrics[0].Placement)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+// The JobSet API we build against does not have a startup policy, so InOrder
+// startup is done with a scheduling gate: pods of the launcher (the replicated
+// jobs that decide success) are created gated, and the controller removes the
+// gate when the pods of the other replicated jobs (e.g., workers) are ready.
+const StartupGate = "metrics-operator.io/startup-order"
+
+// applyStartupPolicy gates the pods of the success jobs for InOrder startup.
+// When every replicated job is a success job, there is nothing to wait for.
+func applyStartupPolicy(set *api.MetricSet, rjs []jobset.ReplicatedJob, successJobs []string) {
+	if !set.StartsInOrder() {
+		return
+	}
+	success := map[string]bool{}
+	for _, name := range successJobs {
+		success[name] = true
+	}
+	gated := []int{}
+	for i, rj := range rjs {
+		if success[rj.Name] {
+			gated = append(gated, i)
+		}
+	}
+	if len(gated) == 0 || len(gated) == len(rjs) {
+		return
+	}
+	for _, i := range gated {
+		spec := &rjs[i].Template.Spec.Template.Spec
+		spec.SchedulingGates = append(spec.SchedulingGates, corev1.PodSchedulingGate{Name: StartupGate})
+	}
+}
+
+// IsStartupGated determines if the pods of a replicated job wait for the others
+func IsStartupGated(rj *jobset.ReplicatedJob) bool {
+	return HasStartupGate(&rj.Template.Spec.Template.Spec)
+}
+
+// HasStartupGate determines if a pod (spec) has the startup gate
+func HasStartupGate(spec *corev1.PodSpec) bool {
+	for _, gate := range spec.SchedulingGates {
+		if gate.Name == StartupGate {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkWaitBlock returns shell logic for a launcher to give the workers time
+// to be up. With InOrder startup the workers are ready before the launcher
+// starts, so there is nothing to wait for.
+func NetworkWaitBlock(set *api.MetricSet, seconds int32) string {
+	if set.StartsInOrder() {
+		return "# Workers are ready before the launcher starts (InOrder startup)"
+	}
+	return networkWaitTemplate.Render(networkWaitContext{Seconds: seconds})
+}
+
+// networkWaitContext is for the template of the launcher network wait
+type networkWaitContext struct {
+	Seconds int32
+}
+
+var networkWaitTemplate = specs.NewTemplate("network-wait", `# Allow network to ready
+echo "Sleeping for {{ .Seconds }} seconds waiting for network..."
+sleep {{ .Seconds }}`, networkWaitContext{})
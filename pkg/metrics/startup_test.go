@@ -0,0 +1,63 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestApplyStartupPolicy(t *testing.T) {
+	withJobs := func(names ...string) []jobset.ReplicatedJob {
+		rjs := []jobset.ReplicatedJob{}
+		for _, name := range names {
+			rjs = append(rjs, jobset.ReplicatedJob{Name: name})
+		}
+		return rjs
+	}
+	tests := []struct {
+		name   string
+		policy string
+		jobs   []string
+		gated  []string
+	}{
+		{name: "any order", policy: api.AnyOrderStartup, jobs: []string{"l", "w"}},
+		{name: "in order", policy: api.InOrderStartup, jobs: []string{"l", "w"}, gated: []string{"l"}},
+		{name: "only the launcher", policy: api.InOrderStartup, jobs: []string{"l"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set := &api.MetricSet{Spec: api.MetricSetSpec{StartupPolicy: test.policy}}
+			rjs := withJobs(test.jobs...)
+			applyStartupPolicy(set, rjs, []string{"l"})
+			gated := []string{}
+			for i := range rjs {
+				if IsStartupGated(&rjs[i]) {
+					gated = append(gated, rjs[i].Name)
+				}
+			}
+			if strings.Join(gated, ",") != strings.Join(test.gated, ",") {
+				t.Errorf("expected gated jobs %v, found %v", test.gated, gated)
+			}
+		})
+	}
+}
+
+func TestNetworkWaitBlock(t *testing.T) {
+	set := &api.MetricSet{}
+	if !strings.Contains(NetworkWaitBlock(set, 60), "sleep 60") {
+		t.Errorf("expected the launcher to sleep without InOrder startup")
+	}
+	set.Spec.StartupPolicy = api.InOrderStartup
+	if strings.Contains(NetworkWaitBlock(set, 60), "sleep") {
+		t.Errorf("expected no sleep with InOrder startup")
+	}
+}
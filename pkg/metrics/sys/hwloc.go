@@ -8,12 +8,10 @@ SPDX-License-Identifier: MIT
 package sys
 
 import (
-	"fmt"
-
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
-	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	metrics "github.com/converged-computing/metrics-operator/pkg/metrics"
 	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/utils"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -50,23 +48,45 @@ func (m *Hwloc) SetOptions(metric *api.Metric) {
 	m.AttributeSpec = &metric.Attributes
 	m.commands = []string{"lstopo architecture.png", "hwloc-ls machine.xml"}
 
-	cmd, ok := metric.ListOptions["command"]
+	cmd, ok := metric.ListOptions["commands"]
 	if ok {
-		m.commands = []string{}
-		for _, val := range cmd {
-			m.commands = append(m.commands, val.StrVal)
-		}
+		m.commands = utils.ListStrings(cmd)
 	}
 }
 
 func (m Hwloc) ListOptions() map[string][]intstr.IntOrString {
-	opts := map[string][]intstr.IntOrString{}
-	for _, val := range m.commands {
-		opts["commands"] = append(opts["commands"], intstr.FromString(val))
+	return map[string][]intstr.IntOrString{
+		"commands": utils.StringList(m.commands),
 	}
-	return opts
 }
 
+// hwlocContext is for the templates of the application container
+type hwlocContext struct {
+	Metadata    string
+	Commands    []string
+	Interactive bool
+}
+
+var (
+	// Each command is echoed and run, and followed by a separator
+	hwlocPreTemplate = specs.NewTemplate(hwlocIdentifier, `#!/bin/bash
+echo "{{ .Metadata }}"	
+. /root/.profile
+export PATH=/opt/view/bin:$PATH
+echo "{{ collectionStart }}"
+{{ range .Commands }}
+echo {{ . }}
+{{ . }}
+ echo '{{ separator }}'{{ end }}
+echo "{{ collectionEnd }}"
+ls
+`, hwlocContext{})
+
+	hwlocPostTemplate = specs.NewTemplate(hwlocIdentifier+"-post", `
+{{ interactive .Interactive }}
+`, hwlocContext{})
+)
+
 func (m Hwloc) PrepareContainers(
 	spec *api.MetricSet,
 	metric *metrics.Metric,
@@ -75,30 +95,13 @@ func (m Hwloc) PrepareContainers(
 	// Metadata to add to beginning of run
 	meta := metrics.Metadata(spec, metric)
 
-	// Assemble commands into separate things
-	commands := ""
-	for _, cmd := range m.commands {
-		commands += fmt.Sprintf("\necho %s\n%s\n echo '%s'", cmd, cmd, metadata.Separator)
+	context := hwlocContext{
+		Metadata:    meta,
+		Commands:    m.commands,
+		Interactive: spec.Spec.Logging.Interactive,
 	}
-	preBlock := `#!/bin/bash
-echo "%s"	
-. /root/.profile
-export PATH=/opt/view/bin:$PATH
-echo "%s"
-%s
-echo "%s"
-ls
-`
-
-	interactive := metadata.Interactive(spec.Spec.Logging.Interactive)
-	preBlock = fmt.Sprintf(
-		preBlock,
-		meta,
-		metadata.CollectionStart,
-		commands,
-		metadata.CollectionEnd,
-	)
-	postBlock := fmt.Sprintf("\n%s\n", interactive)
+	preBlock := hwlocPreTemplate.Render(context)
+	postBlock := hwlocPostTemplate.Render(context)
 	return m.ApplicationContainerSpec(preBlock, "", postBlock)
 }
 
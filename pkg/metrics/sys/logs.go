@@ -8,22 +8,15 @@ SPDX-License-Identifier: MIT
 package sys
 
 import (
-	"log"
-
+	"github.com/converged-computing/metrics-operator/pkg/logging"
 	"go.uber.org/zap"
 )
 
 // Consistent logging identifiers that should be echoed to have newline after
 var (
-	handle *zap.Logger
 	logger *zap.SugaredLogger
 )
 
 func init() {
-	handle, err := zap.NewProduction()
-	if err != nil {
-		log.Fatalf("can't initialize zap logger: %v", err)
-	}
-	logger = handle.Sugar()
-	defer handle.Sync()
+	logger = logging.NewLogger("sys")
 }
@@ -0,0 +1,211 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+var (
+	gpuResource = "nvidia.com/gpu"
+)
+
+// TemplateVariables can be referenced in options and commands (e.g., {{.Pods}})
+// and are expanded when the entrypoints are rendered
+type TemplateVariables struct {
+
+	// Total pods for the metric (in the MetricSet, unless roles are sized)
+	Pods int32
+
+	// Completions for the replicated job of the container
+	Completions int32
+
+	// Comma separated hostnames for all pods in the JobSet
+	Hostlist string
+
+	// The pod index is only known at runtime, so this is a shell variable
+	PodIndex string
+
+	// GPUs requested per pod (from the container, or falling back to the set)
+	GPUsPerPod int64
+
+	// Paths of the metric input files, e.g., {{.Inputs.in_lj}} for in.lj
+	Inputs map[string]string
+
+	// Problem size from the scaling study (multiplied by the pods for weak scaling)
+	ProblemSize int64
+
+	// The latest checkpoint of the pod and its directory are only known at
+	// runtime, so these are shell variables
+	Checkpoint    string
+	CheckpointDir string
+}
+
+// getHostlist returns fully qualified hostnames across replicated jobs
+func getHostlist(set *api.MetricSet, rjs []jobset.ReplicatedJob) string {
+	hosts := []string{}
+	for _, rj := range rjs {
+		parallelism := int32(1)
+		if rj.Template.Spec.Parallelism != nil {
+			parallelism = *rj.Template.Spec.Parallelism
+		}
+		for i := int32(0); i < parallelism; i++ {
+			hosts = append(hosts, fmt.Sprintf("%s-%s-0-%d.%s.%s.svc.cluster.local",
+				set.Name, rj.Name, i, set.Subdomain(), set.Namespace,
+			))
+		}
+	}
+	return strings.Join(hosts, ",")
+}
+
+// getTotalPods returns the pods across the replicated jobs of a metric. Unless
+// roles are sized in the spec, this is the pods for the set.
+func getTotalPods(set *api.MetricSet, rjs []*jobset.ReplicatedJob) int32 {
+	if len(set.Spec.Roles) == 0 {
+		return set.Spec.Pods
+	}
+	pods := int32(0)
+	for _, rj := range rjs {
+		parallelism := int32(1)
+		if rj.Template.Spec.Parallelism != nil {
+			parallelism = *rj.Template.Spec.Parallelism
+		}
+		pods += parallelism
+	}
+	return pods
+}
+
+// getGPUsPerPod looks for a gpu limit for the container, falling back to the set
+func getGPUsPerPod(set *api.MetricSet, cs *specs.ContainerSpec) int64 {
+	resources := set.Spec.Resources
+	if cs.Resources != nil {
+		if _, ok := cs.Resources.Limits[gpuResource]; ok {
+			resources = cs.Resources.Limits
+		}
+	}
+	list, err := getResourceGroup(resources)
+	if err != nil {
+		return 0
+	}
+	gpus, ok := list[corev1.ResourceName(gpuResource)]
+	if !ok {
+		return 0
+	}
+	return gpus.Value()
+}
+
+// getTemplateVariables for a container spec, based on the replicated job it belongs to
+func getTemplateVariables(
+	set *api.MetricSet,
+	rjs []jobset.ReplicatedJob,
+	cs *specs.ContainerSpec,
+) TemplateVariables {
+	pods := set.Spec.Pods
+	if cs.Pods > 0 {
+		pods = cs.Pods
+	}
+	variables := TemplateVariables{
+		Pods:       pods,
+		Hostlist:   getHostlist(set, rjs),
+		PodIndex:   "${JOB_COMPLETION_INDEX}",
+		GPUsPerPod: getGPUsPerPod(set, cs),
+		Inputs:     cs.Inputs,
+
+		ProblemSize: set.Spec.Scaling.GetProblemSize(set.Spec.Pods),
+
+		Checkpoint:    "${METRICS_OPERATOR_CHECKPOINT}",
+		CheckpointDir: "${METRICS_OPERATOR_CHECKPOINT_DIR}",
+	}
+	for _, rj := range rjs {
+		if rj.Name == cs.JobName && rj.Template.Spec.Completions != nil {
+			variables.Completions = *rj.Template.Spec.Completions
+		}
+	}
+	return variables
+}
+
+// renderVariables expands template variables in a block of an entrypoint
+func renderVariables(block string, variables TemplateVariables) (string, error) {
+	if !strings.Contains(block, "{{") {
+		return block, nil
+	}
+	t, err := template.New("entrypoint").Option("missingkey=error").Parse(block)
+	if err != nil {
+		return block, err
+	}
+	var out bytes.Buffer
+	err = t.Execute(&out, variables)
+	if err != nil {
+		return block, err
+	}
+	return out.String(), nil
+}
+
+// validateTemplates renders the template variables in the options of a metric
+// (and its restart flags), so an unknown variable or a typo is a validation error
+func validateTemplates(set *api.MetricSet, metric *api.Metric) error {
+	_, paths := getInputs(set, metric.Key())
+	variables := TemplateVariables{Inputs: paths}
+	values := map[string]string{"checkpoint.restartFlags": metric.Checkpoint.RestartFlags}
+	for name, value := range metric.Options {
+		values[name] = value.StrVal
+	}
+	for name, list := range metric.ListOptions {
+		for i, value := range list {
+			values[fmt.Sprintf("%s[%d]", name, i)] = value.StrVal
+		}
+	}
+	for name, options := range metric.MapOptions {
+		for key, value := range options {
+			values[fmt.Sprintf("%s.%s", name, key)] = value.StrVal
+		}
+	}
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, err := renderVariables(values[name], variables)
+		if err != nil {
+			return fmt.Errorf("option %s is not a valid template: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// renderEntrypoints expands template variables for all container specs
+func renderEntrypoints(
+	set *api.MetricSet,
+	rjs []jobset.ReplicatedJob,
+	containerSpecs []*specs.ContainerSpec,
+) error {
+	for _, cs := range containerSpecs {
+		if cs.EntrypointScript.Verbatim {
+			continue
+		}
+		variables := getTemplateVariables(set, rjs, cs)
+		for _, block := range []*string{&cs.EntrypointScript.Pre, &cs.EntrypointScript.Command, &cs.EntrypointScript.Post} {
+			rendered, err := renderVariables(*block, variables)
+			if err != nil {
+				return fmt.Errorf("entrypoint %s does not render: %s", cs.EntrypointScript.Name, err)
+			}
+			*block = rendered
+		}
+	}
+	return nil
+}
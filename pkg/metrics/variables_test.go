@@ -0,0 +1,122 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+)
+
+func TestRenderVariables(t *testing.T) {
+	variables := TemplateVariables{
+		Pods:     4,
+		PodIndex: "${JOB_COMPLETION_INDEX}",
+		Inputs:   map[string]string{"in_lj": "/metrics_operator/inputs/app-lammps/in.lj"},
+	}
+	tests := map[string]struct {
+		block    string
+		expected string
+		err      bool
+	}{
+		"no variables":     {block: "lmp -in in.lj", expected: "lmp -in in.lj"},
+		"variables":        {block: "mpirun -np {{.Pods}} lmp -in {{.Inputs.in_lj}} # {{.PodIndex}}", expected: "mpirun -np 4 lmp -in /metrics_operator/inputs/app-lammps/in.lj # ${JOB_COMPLETION_INDEX}"},
+		"quoted braces":    {block: `docker inspect --format '{{"{{.Id}}"}}'`, expected: "docker inspect --format '{{.Id}}'"},
+		"unknown":          {block: "mpirun -np {{.Pod}}", err: true},
+		"unknown input":    {block: "lmp -in {{.Inputs.in_rhodo}}", err: true},
+		"does not parse":   {block: "mpirun -np {{.Pods", err: true},
+		"unknown function": {block: "{{ pods }}", err: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rendered, err := renderVariables(test.block, variables)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, rendered %q", rendered)
+				}
+				return
+			}
+			if err != nil || rendered != test.expected {
+				t.Errorf("expected %q, found %q (%v)", test.expected, rendered, err)
+			}
+		})
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	set := &api.MetricSet{}
+	metric := api.Metric{
+		Name:   "app-lammps",
+		Inputs: map[string]string{"in.lj": "units lj"},
+		Options: map[string]intstr.IntOrString{
+			"command": intstr.FromString("mpirun -np {{.Pods}} lmp -in {{.Inputs.in_lj}}"),
+			"tasks":   intstr.FromInt(2),
+		},
+	}
+	set.Spec.Metrics = []api.Metric{metric}
+	err := validateTemplates(set, &metric)
+	if err != nil {
+		t.Errorf("expected valid templates, found %s", err)
+	}
+
+	// An error names the option it is in
+	metric.ListOptions = map[string][]intstr.IntOrString{
+		"commands": {intstr.FromString("hostname"), intstr.FromString("echo {{.Hostslist}}")},
+	}
+	err = validateTemplates(set, &metric)
+	if err == nil || !strings.Contains(err.Error(), "commands[1]") {
+		t.Errorf("expected an error for the list option, found %v", err)
+	}
+	metric.ListOptions = nil
+	metric.Checkpoint.RestartFlags = "-var restart {{.Checkpoint"
+	err = validateTemplates(set, &metric)
+	if err == nil || !strings.Contains(err.Error(), "checkpoint.restartFlags") {
+		t.Errorf("expected an error for the restart flags, found %v", err)
+	}
+}
+
+func TestGetTemplateVariables(t *testing.T) {
+	set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "lammps", Namespace: "default"}}
+	set.Spec.Pods = 3
+	two := int32(2)
+	rjs := []jobset.ReplicatedJob{{Name: "l"}, {Name: "w"}}
+	rjs[1].Template.Spec.Parallelism = &two
+	rjs[1].Template.Spec.Completions = &two
+
+	// Hostnames are for each pod of each replicated job
+	variables := getTemplateVariables(set, rjs, &specs.ContainerSpec{JobName: "w"})
+	hosts := strings.Split(variables.Hostlist, ",")
+	if len(hosts) != 3 || hosts[2] != "lammps-w-0-1."+set.Subdomain()+".default.svc.cluster.local" {
+		t.Errorf("expected a host for each pod, found %v", hosts)
+	}
+	if variables.Pods != 3 || variables.Completions != 2 {
+		t.Errorf("expected 3 pods and 2 completions, found %d and %d", variables.Pods, variables.Completions)
+	}
+
+	// A metric sized by its roles has the pods of its replicated jobs
+	set.Spec.Roles = map[string]int32{"w": 2}
+	pointers := []*jobset.ReplicatedJob{&rjs[0], &rjs[1]}
+	if pods := getTotalPods(set, pointers); pods != 3 {
+		t.Errorf("expected the pods of the replicated jobs, found %d", pods)
+	}
+
+	// GPUs are from the container, falling back to the set
+	set.Spec.Resources = map[string]intstr.IntOrString{gpuResource: intstr.FromInt(4)}
+	cs := &specs.ContainerSpec{Resources: &api.ContainerResources{Limits: map[string]intstr.IntOrString{gpuResource: intstr.FromInt(8)}}}
+	if gpus := getGPUsPerPod(set, cs); gpus != 8 {
+		t.Errorf("expected the gpus of the container, found %d", gpus)
+	}
+	if gpus := getGPUsPerPod(set, &specs.ContainerSpec{}); gpus != 4 {
+		t.Errorf("expected the gpus of the set, found %d", gpus)
+	}
+}
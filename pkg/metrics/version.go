@@ -0,0 +1,36 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultRevision is the script revision of a metric that does not set one
+const DefaultRevision = "1"
+
+// ImageTag returns the tag (or digest) of an image, and latest if there is none
+func ImageTag(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+
+	// A colon before the last slash is a registry port, not a tag
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return "latest"
+}
+
+// Version identifies the definition of a metric that produced results: the
+// revision of its scripts and the tag of its image, e.g., 2+latest.
+// Results from different versions should not be compared directly.
+func Version(m Metric) string {
+	return fmt.Sprintf("%s+%s", m.Revision(), ImageTag(m.Image()))
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	"testing"
+)
+
+func TestImageTag(t *testing.T) {
+	tests := map[string]string{
+		"ghcr.io/converged-computing/metric-amg:latest":    "latest",
+		"ghcr.io/converged-computing/metric-amg":           "latest",
+		"registry.example.com:5000/metric-fio":             "latest",
+		"registry.example.com:5000/metric-fio:site":        "site",
+		"ghcr.io/converged-computing/metric-amg@sha256:ab": "sha256:ab",
+	}
+	for image, want := range tests {
+		if got := ImageTag(image); got != want {
+			t.Errorf("ImageTag(%q) want %q, got %q", image, want, got)
+		}
+	}
+
+	m := BaseMetric{Container: "example/metric:v2"}
+	if m.Revision() != DefaultRevision {
+		t.Errorf("expected the default revision, got %s", m.Revision())
+	}
+	m.ScriptRevision = "3"
+	if m.Revision() != "3" {
+		t.Errorf("expected revision 3, got %s", m.Revision())
+	}
+}
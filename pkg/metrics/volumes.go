@@ -17,12 +17,15 @@ import (
 
 var (
 	makeExecutable = int32(0777)
+	bidirectional  = corev1.MountPropagationBidirectional
 )
 
 // GetVolumeMounts returns read only volume for entrypoint scripts, etc.
 func getVolumeMounts(
 	set *api.MetricSet,
 	volumes []specs.VolumeSpec,
+	jobName string,
+	containerName string,
 ) []corev1.VolumeMount {
 
 	// This is for the core entrypoints (that are generated as config maps here)
@@ -37,12 +40,20 @@ func getVolumeMounts(
 	// This is for any extra or special entrypoints
 	for _, vs := range volumes {
 
-		// Is this volume indicated for mount?
-		if vs.Mount {
+		// Is this volume indicated for mount (and for this job and container)?
+		isProvider := vs.MountProvider != "" && vs.MountProvider == containerName
+		if vs.Mount && (vs.IsTargeted(jobName, containerName) || isProvider) {
 			mount := corev1.VolumeMount{
-				Name:      vs.Volume.Name,
-				MountPath: vs.Path,
-				ReadOnly:  vs.ReadOnly,
+				Name:             vs.Volume.Name,
+				MountPath:        vs.Path,
+				ReadOnly:         vs.ReadOnly,
+				MountPropagation: vs.MountPropagation,
+			}
+			if isProvider {
+				if vs.MountPropagation != nil {
+					mount.MountPropagation = &bidirectional
+				}
+				mount.ReadOnly = false
 			}
 			mounts = append(mounts, mount)
 		}
@@ -96,6 +107,7 @@ func getExtraConfigmaps(volumes []specs.VolumeSpec) []corev1.KeyToPath {
 // This function is intended for a set with a listing of metrics
 func getReplicatedJobVolumes(
 	set *api.MetricSet,
+	jobName string,
 	cs []*specs.ContainerSpec,
 	addedVolumes []specs.VolumeSpec,
 ) []corev1.Volume {
@@ -122,22 +134,50 @@ func getReplicatedJobVolumes(
 			},
 		},
 	}
-	existingVolumes := getAddonVolumes(addedVolumes)
+	existingVolumes := getAddonVolumes(addedVolumes, jobName)
 	volumes = append(volumes, existingVolumes...)
 	return volumes
 }
 
 // Get Addon Volumes for the cluster. This can include:
-func getAddonVolumes(vs []specs.VolumeSpec) []corev1.Volume {
+func getAddonVolumes(vs []specs.VolumeSpec, jobName string) []corev1.Volume {
 	volumes := []corev1.Volume{}
 	for _, volume := range vs {
 		// If the volume doesn't have a name, it was added to the metrics_operator namespace
 		if volume.Volume.Name == "" {
 			continue
 		}
-		logger.Infof("Adding volume %s\n", &volume.Volume)
+		// Skip volumes targeted to other replicated jobs
+		if !volume.IsTargeted(jobName, "") {
+			continue
+		}
+		logger.Debugf("Adding volume %s", volume.Volume.Name)
 		volumes = append(volumes, volume.Volume)
 	}
-	logger.Infof("Volumes %s\n", volumes)
+	logger.Debugf("Adding %d addon volumes", len(volumes))
 	return volumes
 }
+
+// scratchVolumeName is the shared scratch volume of the MetricSet
+const scratchVolumeName = "scratch"
+
+// getScratchVolumes returns the shared scratch volume (if requested) for all containers
+// The persistent volume claim is created by the controller
+func getScratchVolumes(set *api.MetricSet) []specs.VolumeSpec {
+	if !set.Spec.Scratch.Enabled() {
+		return []specs.VolumeSpec{}
+	}
+	volume := corev1.Volume{
+		Name: scratchVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: set.ScratchClaimName(),
+			},
+		},
+	}
+	return []specs.VolumeSpec{{
+		Volume: volume,
+		Path:   set.Spec.Scratch.Path,
+		Mount:  true,
+	}}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package metrics
+
+import (
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// OSLabel selects nodes by operating system
+const OSLabel = "kubernetes.io/os"
+
+// getPodOS returns the pod operating system, which is only set for Windows
+// so the API server can check the pod spec (e.g., for Linux-only fields)
+func getPodOS(set *api.MetricSet) *corev1.PodOS {
+	if !set.IsWindows() {
+		return nil
+	}
+	return &corev1.PodOS{Name: corev1.Windows}
+}
+
+// getPodNodeSelector adds the operating system to the node selector for Windows,
+// since most clusters with Windows node pools also have Linux nodes
+func getPodNodeSelector(set *api.MetricSet) map[string]string {
+	selector := getNodeSelector(set)
+	if !set.IsWindows() {
+		return selector
+	}
+	windows := map[string]string{}
+	for key, value := range selector {
+		windows[key] = value
+	}
+	windows[OSLabel] = string(corev1.Windows)
+	return windows
+}
+
+// getSecurityContext returns the container security context. Privileged and
+// capabilities are Linux only, so Windows containers do not get one.
+func getSecurityContext(set *api.MetricSet, cs *specs.ContainerSpec) *corev1.SecurityContext {
+	if set.IsWindows() {
+		return nil
+	}
+	caps := []corev1.Capability{}
+
+	// Should we allow sharing the process namespace?
+	if cs.Attributes.SecurityContext.AllowPtrace {
+		caps = append(caps, capPtrace)
+	}
+	if cs.Attributes.SecurityContext.AllowAdmin {
+		caps = append(caps, capAdmin)
+	}
+	if cs.Attributes.SecurityContext.AllowPerfmon {
+		caps = append(caps, capPerfmon)
+	}
+	caps = append(caps, cs.Capabilities...)
+	sc := &corev1.SecurityContext{
+		Privileged:   &cs.Attributes.SecurityContext.Privileged,
+		Capabilities: &corev1.Capabilities{Add: caps},
+	}
+	if runsAs(set, cs) {
+		setRunAs(set, sc)
+	}
+	return sc
+}
@@ -8,12 +8,18 @@ SPDX-License-Identifier: MIT
 package specs
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"fmt"
 	"path/filepath"
 	"strings"
 
 	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/logging"
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // Specs are used to generate configurations for containers and volumes of
@@ -35,16 +41,103 @@ type ContainerSpec struct {
 	// Does the Container spec need to be written to our set of config maps?
 	NeedsWrite bool
 
+	// Extra environment for the container (added after the rank environment)
+	Env []corev1.EnvVar
+
+	// Paths of input files (by name) for template variables
+	Inputs map[string]string
+
+	// Total pods for the metric the container belongs to (0 uses the set pods)
+	Pods int32
+
+	// Metric the container belongs to, and a timeout for its command (0 uses the set default)
+	Metric  string
+	Timeout int32
+
+	// The container can end with a state in its termination message (e.g., Hung)
+	ReportsState bool
+
+	// The command waits to be released in debug mode
+	Debug bool
+
+	// Shell for the entrypoint (bash if empty, or PowerShell on Windows)
+	Shell string
+
+	// Path to a bash provided by an addon (e.g., a static bash for images without one),
+	// which takes precedence over the shell
+	Interpreter string
+
+	// Temporary data the metric writes (checked against ephemeral storage)
+	Scratch *ScratchNeeds
+
+	// Linux capabilities the container needs (e.g., NET_RAW to capture packets),
+	// added to those from its attributes
+	Capabilities []corev1.Capability
+
 	Resources  *api.ContainerResources
 	Attributes *api.ContainerSpec
 }
 
+// ScratchNeeds is temporary data a metric writes, and where. In the container
+// filesystem (or an emptyDir) it counts against the ephemeral storage of the pod.
+type ScratchNeeds struct {
+	Path string
+	Size resource.Quantity
+}
+
 // VolumeSpec includes one or more volumes and mount, etc. location
 type VolumeSpec struct {
 	Volume   corev1.Volume
 	ReadOnly bool
 	Path     string
 	Mount    bool
+
+	// Optionally limit the volume to a replicated job and/or container name
+	Target          string
+	ContainerTarget string
+
+	// Mount propagation (e.g., for FUSE). The provider container (that creates
+	// the mount or populates the volume) always gets the volume writable, and with
+	// bidirectional propagation if propagation is set
+	MountPropagation *corev1.MountPropagationMode
+	MountProvider    string
+}
+
+// IsTargeted determines if the volume should be added to a replicated job and container
+// An empty container name checks only the replicated job (e.g., for pod volumes)
+func (v VolumeSpec) IsTargeted(jobName, containerName string) bool {
+	if v.Target != "" && v.Target != jobName {
+		return false
+	}
+	if containerName != "" && v.ContainerTarget != "" && v.ContainerTarget != containerName {
+		return false
+	}
+	return true
+}
+
+// PowerShell is the shell for entrypoints of containers on Windows nodes
+const PowerShell = "powershell"
+
+// ShellPath returns the interpreter for the entrypoint of the container
+func (c *ContainerSpec) ShellPath() string {
+	if c.Shell == PowerShell {
+		return "powershell.exe"
+	}
+	if c.Interpreter != "" {
+		return c.Interpreter
+	}
+	if c.Shell == "sh" {
+		return "/bin/sh"
+	}
+	return "/bin/bash"
+}
+
+// EntrypointCommand is the command to run the entrypoint script with the shell
+func (c *ContainerSpec) EntrypointCommand() []string {
+	if c.Shell == PowerShell {
+		return []string{c.ShellPath(), "-NoProfile", "-ExecutionPolicy", "Bypass", "-File", c.EntrypointScript.Path}
+	}
+	return []string{c.ShellPath(), c.EntrypointScript.Path}
 }
 
 // Named entrypoint script for a container
@@ -61,12 +154,512 @@ type EntrypointScript struct {
 
 	// Anything after the command!
 	Post string
+
+	// Verbatim content (e.g., an input file) is written as is from Pre
+	Verbatim bool
+
+	// PowerShell entrypoints (for Windows) get the PowerShell prelude
+	PowerShell bool
+
+	// Markers to echo in place of the defaults, if set
+	Markers api.Markers
+}
+
+// TimedOut is written to the termination message of a container when the
+// command reaches its timeout, so the controller can report it
+const TimedOut = "TimedOut"
+
+// In debug mode, the waiting file exists while the command waits to be
+// released, which happens when the release file is created
+const (
+	DebugWaitingFile = "/tmp/metrics-operator-waiting"
+	DebugReleaseFile = "/tmp/metrics-operator-release"
+)
+
+// Environment variables with names matching this (extended) regular expression
+// have their values redacted in a snapshot
+const SnapshotRedact = logging.SecretNames
+
+// Hung is written to the termination message when a watchdog finds that the
+// command stopped making progress
+const Hung = "Hung"
+
+// Prelude is added to the top of every entrypoint to provide a global rank
+// and helper functions, e.g., to select shards or ports deterministically.
+// It also installs a trap so SIGTERM (preemption or deadline) still ends collection,
+// and one that summarizes a failure in the termination message.
+// It is POSIX sh compatible so it can run in images without bash, so it does not
+// use local (variables of the helpers are prefixed with mo_ instead).
+var Prelude = `
+# On SIGTERM, stop background work, flush, and end collection for parseable output
+mo_on_term() {
+    echo "Received SIGTERM, flushing partial results"
+    for child in $(jobs -p); do kill -TERM ${child} 2>/dev/null; done
+    wait
+    mo_finish_results
+    sync
+    echo "` + metadata.CollectionEnd + `"
+    exit 143
+}
+trap mo_on_term TERM
+# Terminate a process and its descendants. Each is stopped first, so a parent does
+# not carry on (e.g., to the next command) when its children exit.
+mo_kill_tree() {
+    kill -STOP $1 2>/dev/null
+    for mo_child in $(grep -l ") [A-Za-z] $1 " /proc/[0-9]*/stat 2>/dev/null | cut -d/ -f3); do
+        mo_kill_tree ${mo_child}
+    done
+    kill -TERM $1 2>/dev/null
+    kill -CONT $1 2>/dev/null
+}
+# A timeout (SIGUSR1 from the timeout watchdog) stops the command. The entrypoint
+# continues with post processing (and exit hooks), and the container succeeds.
+mo_on_timeout() {
+    mo_timed_out=1
+    { echo "` + TimedOut + `" > /dev/termination-log; } 2>/dev/null
+    [ -z "${mo_command}" ] || mo_kill_tree ${mo_command}
+}
+trap mo_on_timeout USR1
+# On a failure, summarize it (and the last phase) for the operator in the termination
+# message, unless a state (e.g., DriversNotReady) is there. Reported values are kept.
+# Addons add functions to run on exit (e.g., to clean up) to mo_exit_hooks.
+mo_exit_hooks=""
+mo_on_exit() {
+    mo_exit_code=$?
+    for mo_exit_hook in ${mo_exit_hooks}; do ${mo_exit_hook}; done
+    [ ${mo_exit_code} -eq 0 ] && return 0
+    mo_exit_message=$(cat /dev/termination-log 2>/dev/null)
+    case "$(echo "${mo_exit_message}" | head -1)" in
+        ""|*=*) ;;
+        *) return ${mo_exit_code};;
+    esac
+    mo_exit_phase=$(sed -n '$s/^[0-9]* *//p' ${METRICS_OPERATOR_PHASES:-/dev/null} 2>/dev/null | tr -d '=')
+    {
+        printf 'Failed with exit code %s%s\n' ${mo_exit_code} "${mo_exit_phase:+ in phase ${mo_exit_phase}}"
+        [ -z "${mo_exit_message}" ] || echo "${mo_exit_message}"
+    } 2>/dev/null > /dev/termination-log
+    return ${mo_exit_code}
+}
+trap mo_on_exit EXIT
+mo_start=$(date +%s)
+# Metrics Operator rank helpers
+export METRICS_OPERATOR_INDEX=${JOB_COMPLETION_INDEX:-0}
+export METRICS_OPERATOR_RANK=$(( ${METRICS_OPERATOR_JOB_OFFSET:-0} + ${METRICS_OPERATOR_INDEX} ))
+
+# Succeed if this is the first (leader) rank
+mo_is_leader() { [ "${METRICS_OPERATOR_RANK}" -eq 0 ]; }
+
+# Select an item by rank from a list, e.g., shard=$(mo_shard a b c)
+mo_shard() { shift $(( METRICS_OPERATOR_RANK % $# )); echo "$1"; }
+
+# Derive a port from a base port, e.g., port=$(mo_port 5000)
+mo_port() { echo $(( $1 + METRICS_OPERATOR_RANK )); }
+
+# Wait for a process with a command line matching a pattern, and echo the pid
+mo_wait_for_pid() {
+    while true; do
+        for mo_pid in $(ls /proc | grep -E '^[0-9]+$' | sort -n); do
+            [ "${mo_pid}" = "$$" ] || [ "${mo_pid}" = "${BASHPID:-$$}" ] && continue
+            mo_cmdline=$(tr '\0' ' ' < /proc/${mo_pid}/cmdline 2>/dev/null)
+            case "${mo_cmdline}" in *"$1"*) echo ${mo_pid}; return 0;; esac
+        done
+        sleep 1
+    done
+}
+
+# Wait for a port to accept connections, e.g., when the application is ready
+mo_wait_for_port() {
+    if [ -n "${BASH_VERSION}" ]; then
+        until (exec 3<>/dev/tcp/${2:-localhost}/$1) 2>/dev/null; do sleep 1; done
+    else
+        until nc -z ${2:-localhost} $1 2>/dev/null; do sleep 1; done
+    fi
+}
+
+# Wait for a file or directory to exist
+mo_wait_for_file() { until [ -e "$1" ]; do sleep 1; done; }
+
+# Run a command up to some attempts, waiting some seconds after the first failure and
+# doubling the wait after each (up to MO_RETRY_MAX_DELAY), e.g., mo_with_backoff 5 2 wget -q <url>
+mo_with_backoff() {
+    mo_attempts=$1 mo_delay=$2 mo_attempt=1
+    shift 2
+    until "$@"; do
+        if [ ${mo_attempt} -ge ${mo_attempts} ]; then
+            echo "Failed after ${mo_attempts} attempts: $*" >&2
+            return 1
+        fi
+        echo "Attempt ${mo_attempt} of ${mo_attempts} failed, retrying in ${mo_delay}s: $*" >&2
+        sleep ${mo_delay}
+        mo_attempt=$(( mo_attempt + 1 ))
+        mo_delay=$(( mo_delay * 2 ))
+        [ ${mo_delay} -gt ${MO_RETRY_MAX_DELAY:-60} ] && mo_delay=${MO_RETRY_MAX_DELAY:-60}
+    done
+    return 0
+}
+
+# Retry a flaky setup step (e.g., a download or copy) with the default backoff
+mo_retry() { mo_with_backoff ${MO_RETRY_ATTEMPTS:-5} 1 "$@"; }
+
+# Verify the sha256 checksum of a file, e.g., mo_checksum_verify data.tar.gz <sha256>
+mo_checksum_verify() {
+    if command -v sha256sum >/dev/null 2>&1; then
+        mo_checksum=$(sha256sum "$1" | awk '{ print $1 }')
+    else
+        mo_checksum=$(shasum -a 256 "$1" | awk '{ print $1 }')
+    fi
+    if [ "${mo_checksum}" != "$2" ]; then
+        echo "Checksum of $1 is ${mo_checksum}, expected $2" >&2
+        return 1
+    fi
+    echo "Checksum of $1 verified"
+}
+
+# Frame the output of a command (each line in base64), so it cannot be confused with
+# the markers. Separators echoed by the entrypoint use the token, and are left as is.
+mo_frame_token="mo-frame-${mo_start}-$$"
+mo_frame() {
+    echo "` + metadata.FrameStart + `"
+    while IFS= read -r line || [ -n "${line}" ]; do
+        if [ "${line}" = "${mo_frame_token}" ]; then
+            echo "` + metadata.Separator + `"
+        else
+            printf '%s\n' "${line}" | base64 | tr -d '\n'; echo
+        fi
+    done
+    echo "` + metadata.FrameEnd + `"
+}
+
+# Wait (up to some seconds) for the pods of the set to be ready, e.g., for nodes from an
+# autoscaler, and record provisioning time since the MetricSet was created
+mo_wait_for_pods() {
+    mo_found=0
+    mo_wait_start=$(date +%s)
+    while true; do
+        mo_found=$(getent hosts $1 | wc -l)
+        [ ${mo_found} -ge $2 ] || [ $(( $(date +%s) - mo_wait_start )) -ge $3 ] && break
+        sleep 5
+    done
+    [ ${mo_found} -lt $2 ] && echo "Timeout waiting for pods, found ${mo_found} of $2"
+    mo_now=$(date +%s)
+    mo_provisioning="{\"pod\": \"$(hostname)\", \"node\": \"${METRICS_OPERATOR_NODE}\", \"pods\": ${mo_found}, \"startSeconds\": $(( mo_start - METRICS_OPERATOR_CREATED )), \"readySeconds\": $(( mo_now - METRICS_OPERATOR_CREATED )), \"waitSeconds\": $(( mo_now - mo_wait_start ))}"
+    echo "` + metadata.ProvisioningStart + ` ${mo_provisioning}"
+    echo "` + metadata.ProvisioningEnd + `"
+    if [ -d "${METRICS_OPERATOR_RESULTS}" ]; then echo "${mo_provisioning}" > ${METRICS_OPERATOR_RESULTS}/provisioning.json; fi
+}
+
+# Results for this pod go under <set>/<run>/<job>/<pod> on the results volume
+if [ -n "${METRICS_OPERATOR_RESULTS_RUN}" ]; then
+    export METRICS_OPERATOR_RESULTS=${METRICS_OPERATOR_RESULTS_RUN}/${METRICS_OPERATOR_JOB_NAME}/$(hostname)
+    mkdir -p ${METRICS_OPERATOR_RESULTS} 2>/dev/null || true
+fi
+
+# Record a phase marker, e.g., mo_phase "init done". Applications without the prelude
+# append a line ("<epoch seconds> <name>", or only the name) to METRICS_OPERATOR_PHASES.
+mo_phase() { [ -z "${METRICS_OPERATOR_PHASES}" ] || echo "$(date +%s) $*" >> ${METRICS_OPERATOR_PHASES}; }
+
+# Report a value of the run to the operator (e.g., for acceptance checks) in the
+# termination message, e.g., mo_report sustainedRatio 0.93. Empty values are skipped.
+mo_report() { [ -z "$2" ] || { echo "$1=$2" >> /dev/termination-log; } 2>/dev/null; }
+
+# Print the phase markers recorded since the last call, for a sampler to segment its
+# samples. Markers without a time are given the time they are first printed.
+mo_phase_seen=0
+mo_phase_report() {
+    [ -f "${METRICS_OPERATOR_PHASES}" ] || return 0
+    mo_phase_total=$(wc -l < ${METRICS_OPERATOR_PHASES})
+    [ ${mo_phase_total} -gt ${mo_phase_seen} ] || return 0
+    mo_now=$(date +%s)
+    sed -n "$(( mo_phase_seen + 1 )),${mo_phase_total}p" ${METRICS_OPERATOR_PHASES} | while IFS= read -r line; do
+        stamp=${line%% *}
+        case "${stamp}" in
+            ''|*[!0-9]*) echo "` + metadata.Phase + ` ${mo_now} ${line}";;
+            *) [ "${stamp}" = "${line}" ] && echo "` + metadata.Phase + ` ${mo_now} ${line}" || echo "` + metadata.Phase + ` ${line}";;
+        esac
+    done
+    mo_phase_seen=${mo_phase_total}
+}
+
+# Snapshot the environment (with secrets redacted), limits, and mounts at launch,
+# so differences between runs can be diagnosed
+mo_snapshot() {
+    mo_snapshot_file=${METRICS_OPERATOR_RESULTS:-/tmp}/snapshot.txt
+    {
+        echo "# kernel"
+        uname -a
+        grep -E '^(MemTotal|HugePages_Total)' /proc/meminfo 2>/dev/null
+        echo "cpus: $(grep -c ^processor /proc/cpuinfo 2>/dev/null)"
+        echo "# environment"
+        env | sort | awk -F= 'toupper($1) ~ /` + SnapshotRedact + `/ { print $1 "=REDACTED"; next } { print }'
+        echo "# ulimits"
+        ulimit -a
+        echo "# cgroup"
+        for limit in cpu.max memory.max memory.high pids.max cpuset.cpus.effective cpuset.mems.effective \
+            cpu/cpu.cfs_quota_us cpu/cpu.cfs_period_us memory/memory.limit_in_bytes cpuset/cpuset.cpus pids/pids.max; do
+            [ -r /sys/fs/cgroup/${limit} ] && echo "${limit}: $(cat /sys/fs/cgroup/${limit})"
+        done
+        echo "# mounts"
+        cat /proc/self/mounts
+    } > ${mo_snapshot_file} 2>&1
+    echo "Snapshot of the environment written to ${mo_snapshot_file}" >&2
+}
+
+# Compress the pod results (if requested) and prune old runs from the leader
+mo_finish_results() {
+    [ -d "${METRICS_OPERATOR_RESULTS}" ] || return 0
+    if [ "${METRICS_OPERATOR_RESULTS_COMPRESS}" = "true" ] && [ -n "$(ls -A ${METRICS_OPERATOR_RESULTS})" ]; then
+        tar -czf ${METRICS_OPERATOR_RESULTS}.tar.gz -C $(dirname ${METRICS_OPERATOR_RESULTS}) $(basename ${METRICS_OPERATOR_RESULTS}) && rm -rf ${METRICS_OPERATOR_RESULTS}
+    fi
+    if [ "${METRICS_OPERATOR_RESULTS_KEEP:-0}" -gt 0 ] && mo_is_leader; then
+        mo_runs=$(ls -1d $(dirname ${METRICS_OPERATOR_RESULTS_RUN})/*/ | sort)
+        mo_count=$(echo "${mo_runs}" | wc -l)
+        if [ ${mo_count} -gt ${METRICS_OPERATOR_RESULTS_KEEP} ]; then
+            echo "${mo_runs}" | head -n $(( mo_count - METRICS_OPERATOR_RESULTS_KEEP )) | xargs rm -rf
+        fi
+    fi
+}
+`
+
+// PowerShellPrelude provides the rank and results helpers of the Prelude for
+// entrypoints on Windows. Timeouts and waiting for pods are not supported.
+var PowerShellPrelude = `
+# Metrics Operator rank helpers
+$env:METRICS_OPERATOR_INDEX = [int]$env:JOB_COMPLETION_INDEX
+$env:METRICS_OPERATOR_RANK = [int]$env:METRICS_OPERATOR_JOB_OFFSET + [int]$env:METRICS_OPERATOR_INDEX
+
+# Succeed if this is the first (leader) rank
+function mo_is_leader { return [int]$env:METRICS_OPERATOR_RANK -eq 0 }
+
+# Select an item by rank from a list, e.g., $shard = mo_shard a b c
+function mo_shard { return $args[[int]$env:METRICS_OPERATOR_RANK % $args.Count] }
+
+# Derive a port from a base port, e.g., $port = mo_port 5000
+function mo_port([int]$base) { return $base + [int]$env:METRICS_OPERATOR_RANK }
+
+# Compress (as a zip) and prune results, as the Prelude does
+function mo_finish_results {
+    $results = $env:METRICS_OPERATOR_RESULTS
+    if (-not $results -or -not (Test-Path $results)) { return }
+    if ($env:METRICS_OPERATOR_RESULTS_COMPRESS -eq "true" -and (Get-ChildItem $results)) {
+        Compress-Archive -Path $results -DestinationPath "$results.zip" -Force
+        Remove-Item -Recurse -Force $results
+    }
+    $keep = [int]$env:METRICS_OPERATOR_RESULTS_KEEP
+    if ($keep -gt 0 -and (mo_is_leader)) {
+        $runs = @(Get-ChildItem -Directory (Split-Path $env:METRICS_OPERATOR_RESULTS_RUN) | Sort-Object Name)
+        if ($runs.Count -gt $keep) {
+            $runs | Select-Object -First ($runs.Count - $keep) | Remove-Item -Recurse -Force
+        }
+    }
+}
+`
+
+// WithPowerShell runs the entrypoint with PowerShell, which requires a .ps1 script
+func (e *EntrypointScript) WithPowerShell() {
+	e.PowerShell = true
+	e.Path = strings.TrimSuffix(e.Path, filepath.Ext(e.Path)) + ".ps1"
+}
+
+// WithResults finishes the pod results (e.g., compressing them) after the post
+// processing of the metric, but before the end of collection is reported
+func (e *EntrypointScript) WithResults() {
+	end := fmt.Sprintf("echo \"%s\"", metadata.CollectionEnd)
+	if strings.Contains(e.Post, end) {
+		e.Post = strings.Replace(e.Post, end, "mo_finish_results\n"+end, 1)
+		return
+	}
+	e.Post = "mo_finish_results\n" + e.Post
+}
+
+// WithWait waits for the pods of the set before the command (outside of any
+// timeout), and records provisioning time in the output and results
+func (e *EntrypointScript) WithWait(host string, pods, seconds int32) {
+	if e.Verbatim || e.PowerShell || strings.TrimSpace(e.Command) == "" {
+		return
+	}
+	e.Command = fmt.Sprintf("mo_wait_for_pods %s %d %d\n%s", host, pods, seconds, e.Command)
+}
+
+// wrapperContext is for the templates that wrap the command of an entrypoint
+type wrapperContext struct {
+	Command string
+
+	// Files to wait for (and touch) in debug mode
+	Release string
+	Waiting string
+
+	// Seconds of a timeout
+	Seconds int32
+}
+
+var (
+	// debugTemplate waits to be released before the command
+	debugTemplate = NewTemplate("debug", `# Debug mode: wait to be released before running the command
+echo "METRICS OPERATOR DEBUG waiting for {{ .Release }} to run the command" >&2
+touch {{ .Waiting }}
+mo_wait_for_file {{ .Release }}
+rm -f {{ .Waiting }}
+echo "METRICS OPERATOR DEBUG released" >&2
+{{ .Command }}`, wrapperContext{})
+
+	// timeoutTemplate runs the command in the background with a watchdog. The
+	// trap for the timeout interrupts the wait, so we wait for the command to stop.
+	timeoutTemplate = NewTemplate("timeout", `# Run the command with a timeout of {{ .Seconds }} seconds
+(
+{{ .Command }}
+) &
+mo_command=$!
+( sleep {{ .Seconds }}; echo "Command timeout of {{ .Seconds }} seconds reached"; kill -USR1 $$ ) &
+mo_timeout=$!
+wait ${mo_command}
+mo_command_status=$?
+if [ -n "${mo_timed_out}" ]; then
+    wait ${mo_command}
+    mo_command_status=0
+fi
+mo_kill_tree ${mo_timeout}
+mo_command=""
+(exit ${mo_command_status})`, wrapperContext{})
+)
+
+// WithDebug waits to be released before the command (outside of any timeout),
+// so the user can exec into the container and run commands manually first.
+// Messages go to stderr, so they are not parsed as output of the metric.
+func (e *EntrypointScript) WithDebug() {
+	if e.Verbatim || e.PowerShell || strings.TrimSpace(e.Command) == "" {
+		return
+	}
+	e.Command = debugTemplate.Render(wrapperContext{
+		Command: e.Command,
+		Release: DebugReleaseFile,
+		Waiting: DebugWaitingFile,
+	})
+}
+
+// WithSnapshot snapshots the environment (see mo_snapshot) before the command
+func (e *EntrypointScript) WithSnapshot() {
+	if e.Verbatim || e.PowerShell || strings.TrimSpace(e.Command) == "" {
+		return
+	}
+	e.Command = "mo_snapshot\n" + e.Command
+}
+
+// WithFraming frames the output of the command (see mo_frame). Separators that
+// the command echoes are replaced with the frame token, so they stay separators.
+func (e *EntrypointScript) WithFraming() {
+	if e.Verbatim || e.PowerShell || strings.TrimSpace(e.Command) == "" {
+		return
+	}
+	token := strings.NewReplacer(
+		"'"+metadata.Separator+"'", "\"${mo_frame_token}\"",
+		metadata.Separator, "${mo_frame_token}",
+	)
+	e.Command = fmt.Sprintf("{\n%s\n} | mo_frame", token.Replace(e.Command))
+}
+
+// WithMarkers echoes markers in place of the defaults when the script is written
+func (e *EntrypointScript) WithMarkers(markers api.Markers) {
+	e.Markers = markers
+}
+
+// WithTimeout runs the command in the background with a watchdog that signals
+// the entrypoint after some number of seconds, triggering the trap to stop the
+// command. Post processing still runs after a timeout.
+func (e *EntrypointScript) WithTimeout(seconds int32) {
+	if seconds <= 0 || e.PowerShell || strings.TrimSpace(e.Command) == "" {
+		return
+	}
+	e.Command = timeoutTemplate.Render(wrapperContext{Command: e.Command, Seconds: seconds})
 }
 
 // WriteScript writes the final script, combining the pre, command, and post
 func (e EntrypointScript) WriteScript() string {
-	return fmt.Sprintf("%s\n%s\n%s\n", e.Pre, e.Command, e.Post)
+	if e.Verbatim {
+		return e.Pre
+	}
+	script := fmt.Sprintf("%s\n%s\n%s\n", addPrelude(e.Pre), e.Command, e.Post)
+	if e.PowerShell {
+		script = fmt.Sprintf("%s%s\n%s\n%s\n", PowerShellPrelude, e.Pre, e.Command, e.Post)
+	}
+	return e.replaceMarkers(script)
+}
+
+// compressedTemplate decodes a compressed entrypoint to a temporary file, and
+// runs it with the shell of the container (and the same arguments)
+var compressedTemplate = `# Entrypoint compressed by the metrics operator (gzip and base64)
+mo_entrypoint=$(mktemp 2>/dev/null || echo /tmp/metrics-operator-entrypoint-$$)
+base64 -d > ${mo_entrypoint}.gz << 'METRICS_OPERATOR_GZIP'
+%s
+METRICS_OPERATOR_GZIP
+gzip -dc ${mo_entrypoint}.gz > ${mo_entrypoint} && rm -f ${mo_entrypoint}.gz || exit 1
+exec %s ${mo_entrypoint} "$@"
+`
+
+// CompressScript returns an entrypoint that decodes and runs the script, with
+// the script gzip and base64 encoded (wrapped to 76 characters). The encoding
+// is deterministic, so the config map is the same across reconciles.
+func CompressScript(script, shell string) (string, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write([]byte(script))
+	if err != nil {
+		return "", err
+	}
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(buffer.Bytes())
+	lines := []string{}
+	for len(encoded) > 76 {
+		lines = append(lines, encoded[:76])
+		encoded = encoded[76:]
+	}
+	lines = append(lines, encoded)
+	return fmt.Sprintf(compressedTemplate, strings.Join(lines, "\n"), shell), nil
+}
+
+// replaceMarkers replaces the default markers with any that are set
+func (e EntrypointScript) replaceMarkers(script string) string {
+	replacements := []string{}
+	for marker, replacement := range map[string]string{
+		metadata.Separator:       e.Markers.Separator,
+		metadata.CollectionStart: e.Markers.CollectionStart,
+		metadata.CollectionEnd:   e.Markers.CollectionEnd,
+	} {
+		if replacement != "" && replacement != marker {
+			replacements = append(replacements, marker, replacement)
+		}
+	}
+	if len(replacements) == 0 {
+		return script
+	}
+	return strings.NewReplacer(replacements...).Replace(script)
+
+}
+
+// addPrelude inserts the prelude after the shebang, if there is one
+func addPrelude(pre string) string {
+	if !strings.HasPrefix(pre, "#!") {
+		return Prelude + pre
+	}
+	parts := strings.SplitN(pre, "\n", 2)
+	if len(parts) == 1 {
+		return parts[0] + "\n" + Prelude
+	}
+	return parts[0] + "\n" + Prelude + parts[1]
+}
 
+// EntrypointKey is the deterministic config map key for a metric entrypoint,
+// derived from the metric name, replicated job, and container name
+func EntrypointKey(metric, jobName, containerName string) string {
+	parts := []string{}
+	for _, part := range []string{metric, jobName, containerName} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "-")
 }
 
 // Given a full path, derive the key from the script name minus the extension
@@ -0,0 +1,303 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package specs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runPrelude runs a shell block after the prelude with sh, in a directory
+func runPrelude(t *testing.T, dir, block string) error {
+	t.Helper()
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is required to run the prelude")
+	}
+	cmd := exec.Command(sh, "-c", Prelude+"set -e\n"+block)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "MO_RETRY_MAX_DELAY=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Logf("%s", out)
+	}
+	return err
+}
+
+func TestPreludeRetry(t *testing.T) {
+	dir := t.TempDir()
+
+	// The command fails twice (counting attempts in a file) and then succeeds
+	flaky := `attempt() { echo x >> attempts; [ $(wc -l < attempts) -ge 3 ]; }
+mo_retry attempt
+`
+	if err := runPrelude(t, dir, flaky); err != nil {
+		t.Fatalf("retry of a flaky command failed: %s", err)
+	}
+	attempts, err := os.ReadFile(filepath.Join(dir, "attempts"))
+	if err != nil || len(attempts) != 6 {
+		t.Errorf("expected 3 attempts, found %q", attempts)
+	}
+
+	// A command that always fails gives up after the attempts
+	if err := runPrelude(t, dir, "mo_with_backoff 2 1 false"); err == nil {
+		t.Errorf("expected a command that always fails to fail")
+	}
+}
+
+func TestPreludeChecksumVerify(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("inputs for a run\n")
+	if err := os.WriteFile(filepath.Join(dir, "data.txt"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checksum := fmt.Sprintf("%x", sha256.Sum256(content))
+	if err := runPrelude(t, dir, "mo_checksum_verify data.txt "+checksum); err != nil {
+		t.Errorf("expected the checksum to verify: %s", err)
+	}
+	if err := runPrelude(t, dir, "mo_checksum_verify data.txt 0000"); err == nil {
+		t.Errorf("expected a wrong checksum to fail")
+	}
+}
+
+func TestPreludePhases(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("METRICS_OPERATOR_PHASES", filepath.Join(dir, "phases.txt"))
+
+	// Markers with and without a time are reported once, in order
+	block := `mo_phase init done
+echo "1700000000 timestep 100" >> ${METRICS_OPERATOR_PHASES}
+echo "finalize" >> ${METRICS_OPERATOR_PHASES}
+mo_phase_report > first.txt
+mo_phase_report > second.txt
+`
+	if err := runPrelude(t, dir, block); err != nil {
+		t.Fatalf("phase markers failed: %s", err)
+	}
+	first, err := os.ReadFile(filepath.Join(dir, "first.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(first)), "\n")
+	expected := []string{" init done", "METRICS OPERATOR PHASE 1700000000 timestep 100", " finalize"}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d markers, found %q", len(expected), first)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "METRICS OPERATOR PHASE ") || !strings.HasSuffix(line, expected[i]) {
+			t.Errorf("expected marker %q, found %q", expected[i], line)
+		}
+	}
+	second, err := os.ReadFile(filepath.Join(dir, "second.txt"))
+	if err != nil || len(second) != 0 {
+		t.Errorf("expected no new markers, found %q %v", second, err)
+	}
+}
+
+func TestPreludeFailure(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is required to run the prelude")
+	}
+	dir := t.TempDir()
+	message := filepath.Join(dir, "termination-log")
+	prelude := strings.ReplaceAll(Prelude, "/dev/termination-log", message)
+
+	tests := []struct {
+		name     string
+		block    string
+		code     int
+		expected string
+	}{
+		{name: "success", block: "mo_report ratio 0.9\ntrue", expected: "ratio=0.9\n"},
+		{name: "failure", block: "exit 3", code: 3, expected: "Failed with exit code 3\n"},
+		{
+			name:     "failure in a phase",
+			block:    "mo_report ratio 0.9\nmo_phase solve\nfalse\nexit 1",
+			code:     1,
+			expected: "Failed with exit code 1 in phase solve\nratio=0.9\n",
+		},
+		{name: "state", block: "echo DriversNotReady > " + message + "\nexit 1", code: 1, expected: "DriversNotReady\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Remove(message)
+			cmd := exec.Command(sh, "-c", prelude+test.block)
+			cmd.Env = append(os.Environ(), "METRICS_OPERATOR_PHASES="+filepath.Join(dir, "phases.txt"))
+			os.Remove(filepath.Join(dir, "phases.txt"))
+			err := cmd.Run()
+			code := 0
+			if exitError, ok := err.(*exec.ExitError); ok {
+				code = exitError.ExitCode()
+			}
+			if code != test.code {
+				t.Errorf("expected exit code %d, found %d (%v)", test.code, code, err)
+			}
+			found, _ := os.ReadFile(message)
+			if string(found) != test.expected {
+				t.Errorf("expected termination message %q, found %q", test.expected, found)
+			}
+		})
+	}
+}
+
+func TestPreludeTimeout(t *testing.T) {
+	dir := t.TempDir()
+	message := filepath.Join(dir, "termination-log")
+	prelude := strings.ReplaceAll(Prelude, "/dev/termination-log", message)
+
+	// The command (and its children) are stopped, and post processing and exit hooks still run
+	e := EntrypointScript{
+		Pre:     "mo_hook() { echo \"hook ran\"; }\nmo_exit_hooks=\"${mo_exit_hooks} mo_hook\"",
+		Command: "sh -c 'sleep 60; echo not stopped'\necho \"command done\"",
+		Post:    "echo \"post ran\"",
+	}
+	e.WithTimeout(1)
+	script := prelude + e.Pre + "\n" + e.Command + "\n" + e.Post + "\n"
+	for _, shell := range []string{"sh", "bash"} {
+		t.Run(shell, func(t *testing.T) {
+			path, err := exec.LookPath(shell)
+			if err != nil {
+				t.Skipf("%s is required to run the prelude", shell)
+			}
+			os.Remove(message)
+			start := time.Now()
+			out, err := exec.Command(path, "-c", script).CombinedOutput()
+			if err != nil {
+				t.Fatalf("expected a timeout to succeed: %s\n%s", err, out)
+			}
+			if time.Since(start) > 30*time.Second {
+				t.Errorf("expected the command to be stopped at the timeout")
+			}
+			for _, expected := range []string{"timeout of 1 seconds reached", "post ran", "hook ran"} {
+				if !strings.Contains(string(out), expected) {
+					t.Errorf("expected %q in the output:\n%s", expected, out)
+				}
+			}
+			if strings.Contains(string(out), "not stopped") || strings.Contains(string(out), "command done") {
+				t.Errorf("expected the command to be stopped:\n%s", out)
+			}
+			found, _ := os.ReadFile(message)
+			if strings.TrimSpace(string(found)) != TimedOut {
+				t.Errorf("expected termination message %q, found %q", TimedOut, found)
+			}
+		})
+	}
+
+	// Without a timeout, the exit code of the command is kept
+	e = EntrypointScript{Command: "exit 3"}
+	e.WithTimeout(10)
+	out, err := exec.Command("sh", "-c", prelude+e.Command+"\necho \"status $?\"").CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "status 3") {
+		t.Errorf("expected the exit code of the command to be kept: %v\n%s", err, out)
+	}
+}
+
+func TestCompressScript(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is required to run the entrypoint")
+	}
+	for _, tool := range []string{"base64", "gzip", "mktemp"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is required to decode the entrypoint", tool)
+		}
+	}
+	script := "echo args $@\n" + strings.Repeat("# padding for a large entrypoint\n", 2000) + "exit 3\n"
+	compressed, err := CompressScript(script, sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(script) {
+		t.Errorf("expected the entrypoint to be smaller, found %d bytes from %d", len(compressed), len(script))
+	}
+	again, _ := CompressScript(script, sh)
+	if again != compressed {
+		t.Error("expected the compressed entrypoint to be the same each time")
+	}
+
+	// The entrypoint runs the script with its arguments and exit code
+	path := filepath.Join(t.TempDir(), "entrypoint.sh")
+	if err := os.WriteFile(path, []byte(compressed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(sh, path, "one", "two").CombinedOutput()
+	exit, ok := err.(*exec.ExitError)
+	if !ok || exit.ExitCode() != 3 {
+		t.Errorf("expected the exit code of the script, found %v", err)
+	}
+	if strings.TrimSpace(string(out)) != "args one two" {
+		t.Errorf("expected the script to run with its arguments, found %q", out)
+	}
+}
+
+func TestPreludeFinishResults(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is required to run the prelude")
+	}
+	root := filepath.Join(t.TempDir(), "golden")
+	runs := []string{"20230801-150000-aaaaaaaa", "20230801-153000-bbbbbbbb", "20230801-160000-cccccccc"}
+	for _, run := range runs[:2] {
+		if err := os.MkdirAll(filepath.Join(root, run, "m", "golden-m-0-0"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// finish runs the prelude for the leader (or another rank) of the newest run
+	finish := func(index, compress, keep string) string {
+		t.Helper()
+		cmd := exec.Command(bash, "-c", Prelude+"echo result > ${METRICS_OPERATOR_RESULTS}/out.txt\nmo_finish_results\n")
+		cmd.Env = append(os.Environ(),
+			"METRICS_OPERATOR_RESULTS_RUN="+filepath.Join(root, runs[2]),
+			"METRICS_OPERATOR_JOB_NAME=m",
+			"JOB_COMPLETION_INDEX="+index,
+			"METRICS_OPERATOR_RESULTS_COMPRESS="+compress,
+			"METRICS_OPERATOR_RESULTS_KEEP="+keep,
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("finishing results failed: %s\n%s", err, out)
+		}
+		hostname, _ := os.Hostname()
+		return filepath.Join(root, runs[2], "m", hostname)
+	}
+
+	// A pod that is not the leader compresses its results, and does not prune
+	pod := finish("1", "true", "2")
+	if _, err := os.Stat(pod); !os.IsNotExist(err) {
+		t.Errorf("expected the pod directory to be replaced by an archive")
+	}
+	out, err := exec.Command("tar", "-xzOf", pod+".tar.gz").CombinedOutput()
+	if err != nil || string(out) != "result\n" {
+		t.Errorf("expected the results in the archive, found %q (%v)", out, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, runs[0])); err != nil {
+		t.Errorf("expected a pod that is not the leader to not prune runs")
+	}
+
+	// The leader keeps the newest runs
+	pod = finish("0", "false", "2")
+	if _, err := os.Stat(filepath.Join(pod, "out.txt")); err != nil {
+		t.Errorf("expected results to not be compressed: %s", err)
+	}
+	entries, _ := os.ReadDir(root)
+	kept := []string{}
+	for _, entry := range entries {
+		kept = append(kept, entry.Name())
+	}
+	if strings.Join(kept, " ") != strings.Join(runs[1:], " ") {
+		t.Errorf("expected the newest runs %v to be kept, found %v", runs[1:], kept)
+	}
+}
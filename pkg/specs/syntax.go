@@ -0,0 +1,620 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package specs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The operator image does not have a shell to run "bash -n", so entrypoints are
+// checked here for the mistakes a generated script usually has: quotes, here
+// documents, and expansions that are not closed, and if, loops, case, and
+// groups that are not matched. It is not a full parser, and scripts it accepts
+// can still have errors that only a shell finds.
+
+// SyntaxError is a problem found in a script by CheckSyntax
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// An assignment (e.g., a=b or a[0]+=b) before a command
+var assignmentRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\[[^]]*\])?\+?=`)
+
+// Blocks opened by a keyword, and the keyword that closes each
+var blockEnds = map[string]string{"if": "fi", "loop": "done", "do": "done", "case": "esac", "{": "}"}
+
+// States of a case block
+const (
+	caseWord = iota
+	casePattern
+	caseBody
+)
+
+// block is an open if, loop (before and after do), case, or group
+type block struct {
+	kind  string
+	line  int
+	state int
+}
+
+// heredoc is a here document to read after the line it starts on
+type heredoc struct {
+	delimiter string
+	strip     bool
+	line      int
+}
+
+type syntaxChecker struct {
+	s        string
+	i        int
+	line     int
+	heredocs []heredoc
+
+	// Inside backquotes, a backquote ends the command substitution
+	backquotes int
+}
+
+// CheckSyntax checks the structure of a (bash or sh) script
+func CheckSyntax(script string) error {
+	c := &syntaxChecker{s: script, line: 1}
+	err := c.code(0, 1)
+	if err != nil {
+		return err
+	}
+	if len(c.heredocs) > 0 {
+		return c.fail(c.heredocs[0].line, "here document %s is not terminated", c.heredocs[0].delimiter)
+	}
+	return nil
+}
+
+func (c *syntaxChecker) fail(line int, format string, args ...interface{}) error {
+	return &SyntaxError{Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// peek returns the byte at an offset from the current one, or 0 at the end
+func (c *syntaxChecker) peek(offset int) byte {
+	if c.i+offset < len(c.s) {
+		return c.s[c.i+offset]
+	}
+	return 0
+}
+
+// isMeta is a byte that ends a word
+func isMeta(ch byte) bool {
+	return strings.IndexByte(" \t\n;&|()<>", ch) >= 0
+}
+
+// code checks commands until the end byte (a ")" or "`"), or the end of the
+// script when it is 0. Blocks need to be closed in the same commands.
+func (c *syntaxChecker) code(end byte, start int) error {
+	if end == '`' {
+		c.backquotes++
+		defer func() { c.backquotes-- }()
+	}
+	blocks := []block{}
+	command := true
+	function := false
+	top := func() *block {
+		if len(blocks) == 0 {
+			return &block{}
+		}
+		return &blocks[len(blocks)-1]
+	}
+	expect := func(kind, keyword string) error {
+		if top().kind != kind {
+			return c.fail(c.line, "unexpected %s", keyword)
+		}
+		return nil
+	}
+
+	for c.i < len(c.s) {
+
+		// Patterns of a case are words up to a ")"
+		if top().kind == "case" && top().state == casePattern {
+			err := c.space()
+			if err != nil {
+				return err
+			}
+			if c.i >= len(c.s) {
+				break
+			}
+			if c.keyword("esac") {
+				blocks = blocks[:len(blocks)-1]
+				command = false
+				continue
+			}
+			err = c.pattern()
+			if err != nil {
+				return err
+			}
+			top().state = caseBody
+			command = true
+			continue
+		}
+
+		ch := c.s[c.i]
+		switch {
+		case ch == ' ' || ch == '\t':
+			c.i++
+		case ch == '\n':
+			c.i++
+			c.line++
+			err := c.readHeredocs()
+			if err != nil {
+				return err
+			}
+			command = true
+		case ch == '\\':
+			if c.peek(1) == '\n' {
+				c.line++
+			}
+			c.i += 2
+		case ch == '#':
+			for c.i < len(c.s) && c.s[c.i] != '\n' {
+				c.i++
+			}
+		case ch == ';':
+			if c.peek(1) == ';' || c.peek(1) == '&' {
+				if top().kind != "case" || top().state != caseBody {
+					return c.fail(c.line, "unexpected %s", c.s[c.i:c.i+2])
+				}
+				c.i += 2
+				if c.peek(0) == '&' {
+					c.i++
+				}
+				top().state = casePattern
+				continue
+			}
+			c.i++
+			command = true
+		case ch == '&' || ch == '|':
+			if ch == '&' && c.peek(1) == '>' {
+				c.i += 2
+				continue
+			}
+			c.i++
+			if c.peek(0) == ch || (ch == '|' && c.peek(0) == '&') {
+				c.i++
+			}
+			command = true
+		case ch == '(' && c.peek(1) == '(':
+			c.i += 2
+			err := c.arithmetic(c.line)
+			if err != nil {
+				return err
+			}
+			command = false
+		case ch == '(':
+			c.i++
+			if c.functionParens() {
+				command = true
+				function = false
+				continue
+			}
+			err := c.code(')', c.line)
+			if err != nil {
+				return err
+			}
+			command = false
+		case ch == ')' && end != ')':
+			return c.fail(c.line, "unexpected )")
+		case ch == end:
+			c.i++
+			return c.closed(blocks)
+		case (ch == '<' || ch == '>') && c.peek(1) == '(':
+			c.i += 2
+			err := c.code(')', c.line)
+			if err != nil {
+				return err
+			}
+		case ch == '<' && c.peek(1) == '<' && c.peek(2) != '<':
+			c.i += 2
+			err := c.addHeredoc()
+			if err != nil {
+				return err
+			}
+		case ch == '<' || ch == '>':
+			c.i++
+			for c.peek(0) == '<' || c.peek(0) == '>' || c.peek(0) == '&' || c.peek(0) == '|' {
+				c.i++
+			}
+
+		// A word, which can be a keyword in the position of a command
+		default:
+			line := c.line
+			word, err := c.word()
+			if err != nil {
+				return err
+			}
+			if top().kind == "case" && top().state == caseWord && word == "in" {
+				top().state = casePattern
+				continue
+			}
+			if function {
+				function = false
+				command = true
+				continue
+			}
+			if !command {
+				continue
+			}
+			command = false
+			switch word {
+			case "if", "while", "until":
+				kind := "if"
+				if word != "if" {
+					kind = "loop"
+				}
+				blocks = append(blocks, block{kind: kind, line: line})
+				command = true
+			case "for", "select":
+				blocks = append(blocks, block{kind: "loop", line: line})
+			case "case":
+				blocks = append(blocks, block{kind: "case", line: line, state: caseWord})
+			case "{":
+				blocks = append(blocks, block{kind: "{", line: line})
+				command = true
+			case "then", "elif", "else":
+				err = expect("if", word)
+				command = true
+			case "do":
+				err = expect("loop", word)
+				top().kind = "do"
+				command = true
+			case "fi", "done", "esac", "}":
+				kinds := map[string]string{"fi": "if", "done": "do", "esac": "case", "}": "{"}
+				err = expect(kinds[word], word)
+				if err == nil {
+					blocks = blocks[:len(blocks)-1]
+				}
+			case "[[":
+				err = c.testExpression(line)
+			case "function":
+				function = true
+			case "!":
+				command = true
+			default:
+				command = assignmentRegex.MatchString(word)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if end != 0 {
+		return c.fail(start, "%s is not closed", map[byte]string{')': "(", '`': "`"}[end])
+	}
+	return c.closed(blocks)
+}
+
+// closed checks that there are no open blocks at the end of commands
+func (c *syntaxChecker) closed(blocks []block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	open := blocks[len(blocks)-1]
+	name := open.kind
+	if name == "loop" || name == "do" {
+		name = "loop"
+	}
+	return c.fail(open.line, "%s is not closed with %s", name, blockEnds[open.kind])
+}
+
+// keyword consumes a word if it is the keyword
+func (c *syntaxChecker) keyword(keyword string) bool {
+	if !strings.HasPrefix(c.s[c.i:], keyword) {
+		return false
+	}
+	next := c.i + len(keyword)
+	if next < len(c.s) && !isMeta(c.s[next]) {
+		return false
+	}
+	c.i = next
+	return true
+}
+
+// space skips blanks, newlines, and comments
+func (c *syntaxChecker) space() error {
+	for c.i < len(c.s) {
+		switch c.s[c.i] {
+		case ' ', '\t':
+			c.i++
+		case '\n':
+			c.i++
+			c.line++
+			err := c.readHeredocs()
+			if err != nil {
+				return err
+			}
+		case '#':
+			for c.i < len(c.s) && c.s[c.i] != '\n' {
+				c.i++
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// functionParens consumes the "()" of a function definition, after the "("
+func (c *syntaxChecker) functionParens() bool {
+	j := c.i
+	for j < len(c.s) && (c.s[j] == ' ' || c.s[j] == '\t') {
+		j++
+	}
+	if j < len(c.s) && c.s[j] == ')' {
+		c.i = j + 1
+		return true
+	}
+	return false
+}
+
+// word consumes a word (with its quotes and expansions) and returns it
+func (c *syntaxChecker) word() (string, error) {
+	start := c.i
+	for c.i < len(c.s) {
+		ch := c.s[c.i]
+		if ch == '`' && c.backquotes > 0 {
+			break
+		}
+		if isMeta(ch) {
+
+			// An array assignment, e.g., a=(1 2 3)
+			if ch == '(' && c.i > start && c.s[c.i-1] == '=' {
+				c.i++
+				err := c.code(')', c.line)
+				if err != nil {
+					return "", err
+				}
+				continue
+			}
+			break
+		}
+		err := c.quoted()
+		if err != nil {
+			return "", err
+		}
+	}
+	return c.s[start:c.i], nil
+}
+
+// quoted consumes one byte, or a quote, expansion, or escape that starts there
+func (c *syntaxChecker) quoted() error {
+	line := c.line
+	switch c.s[c.i] {
+	case '\\':
+		if c.peek(1) == '\n' {
+			c.line++
+		}
+		c.i += 2
+	case '\'':
+		c.i++
+		return c.until('\'', false, line, "single quote")
+	case '"':
+		c.i++
+		return c.double(line)
+	case '`':
+		c.i++
+		return c.code('`', line)
+	case '$':
+		return c.dollar()
+	case '\n':
+		c.i++
+		c.line++
+	default:
+		c.i++
+	}
+	return nil
+}
+
+// until consumes up to and including a closing byte, with escapes if allowed
+func (c *syntaxChecker) until(end byte, escapes bool, line int, name string) error {
+	for c.i < len(c.s) {
+		ch := c.s[c.i]
+		switch {
+		case ch == end:
+			c.i++
+			return nil
+		case ch == '\\' && escapes:
+			c.i++
+			if c.peek(0) == '\n' {
+				c.line++
+			}
+		case ch == '\n':
+			c.line++
+		}
+		c.i++
+	}
+	return c.fail(line, "%s is not closed", name)
+}
+
+// double consumes a double quoted string, after the quote
+func (c *syntaxChecker) double(line int) error {
+	for c.i < len(c.s) {
+		switch c.s[c.i] {
+		case '"':
+			c.i++
+			return nil
+		case '\\', '`', '$', '\n':
+			err := c.quoted()
+			if err != nil {
+				return err
+			}
+		default:
+			c.i++
+		}
+	}
+	return c.fail(line, "double quote is not closed")
+}
+
+// dollar consumes an expansion starting with $
+func (c *syntaxChecker) dollar() error {
+	line := c.line
+	c.i++
+	switch c.peek(0) {
+	case '(':
+		if c.peek(1) == '(' {
+			c.i += 2
+			return c.arithmetic(line)
+		}
+		c.i++
+		return c.code(')', line)
+	case '{':
+		c.i++
+		return c.parameter(line)
+	case '\'':
+		c.i++
+		return c.until('\'', true, line, "$' quote")
+	case 0:
+		return nil
+	default:
+		c.i++
+	}
+	return nil
+}
+
+// parameter consumes a parameter expansion, after the ${
+func (c *syntaxChecker) parameter(line int) error {
+	for c.i < len(c.s) {
+		if c.s[c.i] == '}' {
+			c.i++
+			return nil
+		}
+		err := c.quoted()
+		if err != nil {
+			return err
+		}
+	}
+	return c.fail(line, "${ is not closed")
+}
+
+// arithmetic consumes an arithmetic expression, after the (( or $((
+func (c *syntaxChecker) arithmetic(line int) error {
+	depth := 0
+	for c.i < len(c.s) {
+		switch c.s[c.i] {
+		case '(':
+			depth++
+			c.i++
+		case ')':
+			if depth == 0 {
+				if c.peek(1) != ')' {
+					return c.fail(line, "(( is not closed with ))")
+				}
+				c.i += 2
+				return nil
+			}
+			depth--
+			c.i++
+		default:
+			err := c.quoted()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return c.fail(line, "(( is not closed")
+}
+
+// testExpression consumes a [[ test up to the ]], where parentheses and
+// operators (e.g., in a =~ regular expression) are not commands
+func (c *syntaxChecker) testExpression(line int) error {
+	for c.i < len(c.s) {
+		if c.s[c.i] == ']' && c.peek(1) == ']' && (c.i+2 >= len(c.s) || isMeta(c.s[c.i+2])) {
+			c.i += 2
+			return nil
+		}
+		err := c.quoted()
+		if err != nil {
+			return err
+		}
+	}
+	return c.fail(line, "[[ is not closed with ]]")
+}
+
+// pattern consumes the patterns of a case clause, up to and including the )
+func (c *syntaxChecker) pattern() error {
+	line := c.line
+	if c.peek(0) == '(' {
+		c.i++
+	}
+	for c.i < len(c.s) {
+		if c.s[c.i] == ')' {
+			c.i++
+			return nil
+		}
+		err := c.quoted()
+		if err != nil {
+			return err
+		}
+	}
+	return c.fail(line, "case pattern is not closed with )")
+}
+
+// addHeredoc reads the delimiter of a here document, after the <<
+func (c *syntaxChecker) addHeredoc() error {
+	doc := heredoc{line: c.line}
+	if c.peek(0) == '-' {
+		doc.strip = true
+		c.i++
+	}
+	for c.peek(0) == ' ' || c.peek(0) == '\t' {
+		c.i++
+	}
+	start := c.i
+	for c.i < len(c.s) && !isMeta(c.s[c.i]) {
+		err := c.quoted()
+		if err != nil {
+			return err
+		}
+	}
+	doc.delimiter = strings.NewReplacer(`'`, "", `"`, "", `\`, "").Replace(c.s[start:c.i])
+	if doc.delimiter == "" {
+		return c.fail(doc.line, "here document has no delimiter")
+	}
+	c.heredocs = append(c.heredocs, doc)
+	return nil
+}
+
+// readHeredocs consumes the here documents started on the last line
+func (c *syntaxChecker) readHeredocs() error {
+	docs := c.heredocs
+	c.heredocs = nil
+	for _, doc := range docs {
+		for {
+			if c.i >= len(c.s) {
+				return c.fail(doc.line, "here document %s is not terminated", doc.delimiter)
+			}
+			end := strings.IndexByte(c.s[c.i:], '\n')
+			next := len(c.s)
+			if end >= 0 {
+				next = c.i + end + 1
+			} else {
+				end = len(c.s) - c.i
+			}
+			text := c.s[c.i : c.i+end]
+			c.i = next
+			c.line++
+			if doc.strip {
+				text = strings.TrimLeft(text, "\t")
+			}
+			if text == doc.delimiter {
+				break
+			}
+		}
+	}
+	return nil
+}
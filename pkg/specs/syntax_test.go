@@ -0,0 +1,91 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package specs
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestCheckSyntax(t *testing.T) {
+	valid := []string{
+		Prelude,
+		"echo \"$(hostname) ${HOSTNAME%%.*} $((1 + $#))\" `date` $'a\\'b' # it's a comment",
+		"if [ -z \"$1\" ]; then\n    echo one\nelif true\nthen :\nelse echo two; fi >/dev/null 2>&1",
+		"for i in $(seq 1 3); do\n    while read line; do echo ${line}; done < /dev/null\ndone\nfor ((i=0; i<3; i++)); do :; done",
+		"case \"${x}\" in\n    \"\"|*=*) ;;\n    (a) echo a;;\n    *) case $y in b) echo b;; esac\nesac",
+		"mo_f() {\n    { echo \"$1\" >> /tmp/out; } 2>/dev/null\n}\nfunction g { (cd /tmp && ls); }",
+		"cat <<EOF > /tmp/a\nif then done )\n$(hostname)\nEOF\ncat <<-'END'\n\tdone\n\tEND\necho after",
+		"out=$(cat <<EOF\n)\nEOF\n)",
+		"arr=(a b \"c d\")\n[[ ${x} =~ ^(a|b)$ && -n \"${y}\" ]] && echo ${arr[@]}\n(( x += 1 ))",
+		"awk '{ if ($1 > 0) { print } }' file | sort -n |& tee -a log &\ndiff <(ls) >(cat)",
+		"echo a \\\n    b; export A=1 B=\"{ }\"\nA=1 if=2 echo }",
+	}
+	for _, script := range valid {
+		if err := CheckSyntax(script); err != nil {
+			t.Errorf("expected script to be valid, found %s:\n%s", err, script)
+		}
+	}
+
+	invalid := []struct {
+		script string
+		line   int
+
+		// bash only warns about a here document without its delimiter
+		warning bool
+	}{
+		{script: "echo \"hello\necho world", line: 1},
+		{script: "echo ok\necho 'hello", line: 2},
+		{script: "echo $(hostname", line: 1},
+		{script: "echo ${HOSTNAME", line: 1},
+		{script: "echo `date", line: 1},
+		{script: "echo $((1 + 2)", line: 1},
+		{script: "echo\nif true; then\n    echo\n", line: 2},
+		{script: "if true; then echo; done", line: 1},
+		{script: "for i in 1 2; do\n    echo\n", line: 1},
+		{script: "while true; do echo; fi", line: 1},
+		{script: "echo\nfi", line: 2},
+		{script: "case a in\n    a) echo;;\n", line: 1},
+		{script: "case a in\n    a echo;;\nesac", line: 2},
+		{script: "echo ;; echo", line: 1},
+		{script: "f() {\n    echo\n", line: 1},
+		{script: "echo )", line: 1},
+		{script: "(cd /tmp; ls", line: 1},
+		{script: "cat <<EOF\nhello\nEOFF\n", line: 1, warning: true},
+		{script: "[[ -n a", line: 1},
+		{script: "echo $(if true; then echo; )", line: 1},
+	}
+	for _, test := range invalid {
+		err := CheckSyntax(test.script)
+		var syntaxError *SyntaxError
+		if !errors.As(err, &syntaxError) {
+			t.Errorf("expected a syntax error, found %v:\n%s", err, test.script)
+			continue
+		}
+		if syntaxError.Line != test.line {
+			t.Errorf("expected an error on line %d, found %s:\n%s", test.line, err, test.script)
+		}
+	}
+
+	// The checker should agree with bash, when it is there to ask
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		return
+	}
+	for _, script := range valid {
+		if out, err := exec.Command(bash, "-n", "-c", script).CombinedOutput(); err != nil {
+			t.Errorf("bash does not accept a valid script: %s\n%s", out, script)
+		}
+	}
+	for _, test := range invalid {
+		if !test.warning && exec.Command(bash, "-n", "-c", test.script).Run() == nil {
+			t.Errorf("bash accepts an invalid script:\n%s", test.script)
+		}
+	}
+}
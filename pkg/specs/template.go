@@ -0,0 +1,210 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package specs
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+)
+
+// Blocks of entrypoints (for metrics and addons) are text templates rendered
+// with a context struct, so each value is named where it is used instead of
+// being the nth argument to fmt.Sprintf. For example:
+//
+//	var fioTemplate = specs.NewTemplate("io-fio", `
+//	echo "{{ collectionStart }}"
+//	fio --directory={{ .Directory }} {{ .Flags }}
+//	`, fioContext{})
+//
+//	block := fioTemplate.Render(fioContext{Directory: m.directory, Flags: flags})
+//
+// Templates are parsed when the package is loaded, and CheckTemplates (in the
+// tests) ensures the fields each one uses are in its context.
+
+// TemplateFuncs are the helpers available to all entrypoint templates
+var TemplateFuncs = template.FuncMap{
+
+	// Markers to echo around the output of a metric
+	"collectionStart": func() string { return metadata.CollectionStart },
+	"collectionEnd":   func() string { return metadata.CollectionEnd },
+	"separator":       func() string { return metadata.Separator },
+
+	// "sleep infinity" for an interactive metric, otherwise empty
+	"interactive": metadata.Interactive,
+
+	// A value in single quotes for the shell, or double quotes (so variables
+	// in it are expanded)
+	"quote":       ShellQuote,
+	"doubleQuote": DoubleQuote,
+
+	// Join a list, e.g., {{ join .Hosts "," }}
+	"join": func(values []string, separator string) string {
+		return strings.Join(values, separator)
+	},
+}
+
+// Template is a block of an entrypoint, and the type of context it renders with
+type Template struct {
+	template *template.Template
+	context  reflect.Type
+}
+
+// All templates, for CheckTemplates
+var templates = []*Template{}
+
+// NewTemplate parses a template for a block of an entrypoint, rendered with a
+// context of the same type as the one given. A template that does not parse is
+// a bug, so this panics (when the package is loaded) as regexp.MustCompile does.
+func NewTemplate(name, text string, context interface{}) *Template {
+	t := &Template{
+		template: template.Must(template.New(name).Funcs(TemplateFuncs).Option("missingkey=error").Parse(text)),
+		context:  reflect.TypeOf(context),
+	}
+	templates = append(templates, t)
+	return t
+}
+
+// Name of the template (usually the metric or addon)
+func (t *Template) Name() string {
+	return t.template.Name()
+}
+
+// Render the template with its context. A template that does not render is also
+// a bug, and since the entrypoint cannot run without it, the block fails instead.
+func (t *Template) Render(context interface{}) string {
+	out, err := t.Execute(context)
+	if err != nil {
+		return fmt.Sprintf("echo %s >&2\nexit 1\n", ShellQuote(err.Error()))
+	}
+	return out
+}
+
+// Execute renders the template with its context, or returns an error
+func (t *Template) Execute(context interface{}) (string, error) {
+	if reflect.TypeOf(context) != t.context {
+		return "", fmt.Errorf("template %s renders with a %s, not %T", t.Name(), t.context, context)
+	}
+	var out strings.Builder
+	err := t.template.Execute(&out, context)
+	if err != nil {
+		return "", fmt.Errorf("template %s: %s", t.Name(), err)
+	}
+	return out.String(), nil
+}
+
+// CheckTemplates checks that the fields used by each template are in its context.
+// Fields used inside a range or with (where the context changes) are not checked.
+func CheckTemplates() error {
+	for _, t := range templates {
+		err := checkNode(t.template.Tree.Root, t.context)
+		if err != nil {
+			return fmt.Errorf("template %s: %s", t.Name(), err)
+		}
+	}
+	return nil
+}
+
+// checkNode checks the fields used in a node of a template
+func checkNode(node parse.Node, context reflect.Type) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			err := checkNode(child, context)
+			if err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkPipe(n.Pipe, context)
+	case *parse.IfNode:
+		for _, err := range []error{
+			checkPipe(n.Pipe, context),
+			checkNode(n.List, context),
+			checkNode(n.ElseList, context),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+	case *parse.RangeNode:
+		return checkPipe(n.Pipe, context)
+	case *parse.WithNode:
+		return checkPipe(n.Pipe, context)
+	}
+	return nil
+}
+
+// checkPipe checks the fields used as arguments in a pipeline
+func checkPipe(pipe *parse.PipeNode, context reflect.Type) error {
+	if pipe == nil {
+		return nil
+	}
+	for _, command := range pipe.Cmds {
+		for _, arg := range command.Args {
+			switch a := arg.(type) {
+			case *parse.FieldNode:
+				err := checkField(a.Ident, context)
+				if err != nil {
+					return err
+				}
+			case *parse.PipeNode:
+				err := checkPipe(a, context)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkField checks that a chain of fields (e.g., .Metric.Name) is in a type
+func checkField(idents []string, context reflect.Type) error {
+	for i, ident := range idents {
+		_, ok := context.MethodByName(ident)
+		if ok {
+			return nil
+		}
+		for context.Kind() == reflect.Pointer {
+			context = context.Elem()
+		}
+		switch context.Kind() {
+		case reflect.Map, reflect.Interface:
+			return nil
+		case reflect.Struct:
+			field, ok := context.FieldByName(ident)
+			if !ok || !field.IsExported() {
+				return fmt.Errorf("%s has no field %s", context, strings.Join(idents[:i+1], "."))
+			}
+			context = field.Type
+		default:
+			return fmt.Errorf("%s of %s is not a struct", strings.Join(idents[:i], "."), context)
+		}
+	}
+	return nil
+}
+
+// ShellQuote quotes a value in single quotes for the shell
+func ShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
+
+// DoubleQuote quotes a value in double quotes for the shell, so variables
+// (e.g., ${METRICS_OPERATOR_CHECKPOINT}) are expanded
+func DoubleQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`")
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package specs
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/converged-computing/metrics-operator/pkg/metadata"
+)
+
+type testContext struct {
+	Name        string
+	Hosts       []string
+	Interactive bool
+}
+
+func TestTemplateRender(t *testing.T) {
+	tmpl := NewTemplate("test-render", `echo {{ quote .Name }}
+echo "{{ collectionStart }}"
+hosts={{ join .Hosts "," }}
+{{ interactive .Interactive }}`, testContext{})
+
+	out := tmpl.Render(testContext{Name: "it's", Hosts: []string{"a", "b"}, Interactive: true})
+	expected := "echo 'it'\"'\"'s'\necho \"" + metadata.CollectionStart + "\"\nhosts=a,b\nsleep infinity"
+	if out != expected {
+		t.Errorf("expected:\n%s\nfound:\n%s", expected, out)
+	}
+
+	// A context of another type is an error, and the rendered block fails
+	_, err := tmpl.Execute(wrapperContext{})
+	if err == nil {
+		t.Errorf("expected an error rendering with the wrong context")
+	}
+	out = tmpl.Render(wrapperContext{})
+	if !strings.HasSuffix(out, "exit 1\n") {
+		t.Errorf("expected a failing block, found:\n%s", out)
+	}
+}
+
+func TestCheckTemplates(t *testing.T) {
+	for _, text := range []string{
+		"{{ .Name }} {{ range .Hosts }}{{ . }}{{ end }}",
+		"{{ if .Interactive }}{{ .Name }}{{ else }}{{ join .Hosts \" \" }}{{ end }}",
+	} {
+		tmpl := NewTemplate("test-valid", text, testContext{})
+		err := checkNode(tmpl.template.Tree.Root, tmpl.context)
+		if err != nil {
+			t.Errorf("expected %q to be valid, found %s", text, err)
+		}
+	}
+	for _, text := range []string{
+		"{{ .Missing }}",
+		"{{ if .Interactive }}{{ .Name.Length }}{{ end }}",
+		"{{ quote .Host }}",
+	} {
+		tmpl := NewTemplate("test-invalid", text, testContext{})
+		err := checkNode(tmpl.template.Tree.Root, tmpl.context)
+		if err == nil {
+			t.Errorf("expected %q to be invalid", text)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	_, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not available")
+	}
+	for _, value := range []string{"plain", "it's", `a "b" $HOME \ ` + "`date`", ""} {
+		for _, quote := range []func(string) string{ShellQuote, DoubleQuote} {
+			out, err := exec.Command("bash", "-c", "HOME=home; printf %s "+quote(value)).Output()
+			if err != nil {
+				t.Fatalf("quote %q: %s", value, err)
+			}
+			expected := value
+			if strings.HasPrefix(quote(value), `"`) {
+				expected = strings.ReplaceAll(value, "$HOME", "home")
+			}
+			if string(out) != expected {
+				t.Errorf("quote %q: expected %q, found %q", value, expected, out)
+			}
+		}
+	}
+}
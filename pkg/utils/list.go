@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ListStrings converts a list option to strings. Integers in the list
+// are formatted, so a list can mix them with strings.
+func ListStrings(values []intstr.IntOrString) []string {
+	list := []string{}
+	for _, value := range values {
+		list = append(list, value.String())
+	}
+	return list
+}
+
+// StringList converts strings back into a list option
+func StringList(values []string) []intstr.IntOrString {
+	list := []intstr.IntOrString{}
+	for _, value := range values {
+		list = append(list, intstr.FromString(value))
+	}
+	return list
+}
+
+// UnknownListOptions returns the (sorted) names of list options that are
+// given but not declared, e.g., a typo that would otherwise be ignored
+func UnknownListOptions(given, declared map[string][]intstr.IntOrString) []string {
+	unknown := []string{}
+	for name := range given {
+		if _, ok := declared[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
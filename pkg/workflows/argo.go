@@ -0,0 +1,234 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// The Argo Workflow types are only the fields the generator uses, so the
+// operator does not depend on Argo (or its version of Kubernetes)
+const (
+	ArgoAPIVersion = "argoproj.io/v1alpha1"
+
+	// The image with kubectl to wait for runs and collect their logs
+	DefaultKubectlImage = "bitnami/kubectl:latest"
+
+	// Seconds between checks of a running workload
+	DefaultPollSeconds = 10
+
+	// Results are saved (and passed between steps) under this directory
+	resultsDirectory = "/tmp/results"
+)
+
+// ArgoOptions customize the Workflow for a pipeline
+type ArgoOptions struct {
+
+	// Service account of the workflow pods, which creates the objects of each run
+	// and gets the workload and logs of its pods
+	ServiceAccountName string
+
+	// Image with kubectl, to wait for runs
+	KubectlImage string
+
+	// Seconds between checks of a running workload
+	PollSeconds int32
+}
+
+// ArgoWorkflow is an Argo Workflow
+type ArgoWorkflow struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   argoMetadata     `json:"metadata"`
+	Spec       ArgoWorkflowSpec `json:"spec"`
+}
+
+type argoMetadata struct {
+	GenerateName string            `json:"generateName,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// ArgoWorkflowSpec is the entrypoint and templates of a Workflow
+type ArgoWorkflowSpec struct {
+	Entrypoint         string         `json:"entrypoint"`
+	ServiceAccountName string         `json:"serviceAccountName,omitempty"`
+	Templates          []ArgoTemplate `json:"templates"`
+}
+
+// ArgoTemplate is a steps, resource, or script template of a Workflow
+type ArgoTemplate struct {
+	Name     string        `json:"name"`
+	Inputs   *argoIO       `json:"inputs,omitempty"`
+	Outputs  *argoIO       `json:"outputs,omitempty"`
+	Steps    [][]ArgoStep  `json:"steps,omitempty"`
+	Resource *argoResource `json:"resource,omitempty"`
+	Script   *argoScript   `json:"script,omitempty"`
+}
+
+// ArgoStep runs a template. The steps of a group run at the same time.
+type ArgoStep struct {
+	Name      string  `json:"name"`
+	Template  string  `json:"template"`
+	Arguments *argoIO `json:"arguments,omitempty"`
+}
+
+type argoIO struct {
+	Artifacts []argoArtifact `json:"artifacts,omitempty"`
+}
+
+type argoArtifact struct {
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+	From string `json:"from,omitempty"`
+}
+
+type argoResource struct {
+	Action            string `json:"action"`
+	SetOwnerReference bool   `json:"setOwnerReference,omitempty"`
+	Manifest          string `json:"manifest"`
+}
+
+type argoScript struct {
+	Image   string   `json:"image"`
+	Command []string `json:"command"`
+	Source  string   `json:"source"`
+}
+
+// NewArgoWorkflow renders a pipeline as an Argo Workflow. Each stage is a group
+// of steps, one for each run, so the runs of a stage (e.g., the pod counts of a
+// scaling study) start together, and a stage starts when the one before it has
+// finished. A run applies the config maps and service of its MetricSet, creates
+// the JobSet (or Job), waits for it, and outputs the logs of its pods as the
+// "results" artifact. A last step collects the results of all runs.
+//
+// The objects of a run are owned by the Workflow, so they are deleted with it.
+func NewArgoWorkflow(pipeline *Pipeline, options ArgoOptions) (*ArgoWorkflow, error) {
+	if options.KubectlImage == "" {
+		options.KubectlImage = DefaultKubectlImage
+	}
+	if options.PollSeconds <= 0 {
+		options.PollSeconds = DefaultPollSeconds
+	}
+	workflow := &ArgoWorkflow{
+		APIVersion: ArgoAPIVersion,
+		Kind:       "Workflow",
+		Metadata: argoMetadata{
+			GenerateName: pipeline.Name + "-",
+			Labels:       map[string]string{"metrics-operator.io/pipeline": pipeline.Name},
+		},
+		Spec: ArgoWorkflowSpec{
+			Entrypoint:         "pipeline",
+			ServiceAccountName: options.ServiceAccountName,
+		},
+	}
+
+	entrypoint := ArgoTemplate{Name: "pipeline"}
+	report := ArgoTemplate{
+		Name:    "report",
+		Inputs:  &argoIO{},
+		Outputs: &argoIO{Artifacts: []argoArtifact{{Name: "results", Path: resultsDirectory}}},
+		Script: &argoScript{
+			Image:   options.KubectlImage,
+			Command: []string{"sh"},
+			Source:  fmt.Sprintf("find %s -type f\n", resultsDirectory),
+		},
+	}
+	reportStep := ArgoStep{Name: "report", Template: "report", Arguments: &argoIO{}}
+
+	seen := map[string]bool{}
+	for _, stage := range pipeline.Stages {
+		group := []ArgoStep{}
+		for _, run := range stage.Runs {
+			if seen[run.Name] {
+				return nil, fmt.Errorf("more than one run is named %s", run.Name)
+			}
+			seen[run.Name] = true
+
+			templates, err := newArgoRun(run, options)
+			if err != nil {
+				return nil, err
+			}
+			workflow.Spec.Templates = append(workflow.Spec.Templates, templates...)
+			group = append(group, ArgoStep{Name: run.Name, Template: run.Name})
+
+			// The report gets the results of each run in its own directory
+			report.Inputs.Artifacts = append(report.Inputs.Artifacts, argoArtifact{
+				Name: run.Name,
+				Path: filepath.Join(resultsDirectory, run.Name),
+			})
+			reportStep.Arguments.Artifacts = append(reportStep.Arguments.Artifacts, argoArtifact{
+				Name: run.Name,
+				From: fmt.Sprintf("{{steps.%s.outputs.artifacts.results}}", run.Name),
+			})
+		}
+		entrypoint.Steps = append(entrypoint.Steps, group)
+	}
+	entrypoint.Steps = append(entrypoint.Steps, []ArgoStep{reportStep})
+	workflow.Spec.Templates = append([]ArgoTemplate{entrypoint, report}, workflow.Spec.Templates...)
+	return workflow, nil
+}
+
+// newArgoRun returns the templates of a run: the steps of the run, a resource
+// template for each of its objects, and the script that waits for it
+func newArgoRun(run *Run, options ArgoOptions) ([]ArgoTemplate, error) {
+	steps := ArgoTemplate{
+		Name: run.Name,
+		Outputs: &argoIO{Artifacts: []argoArtifact{{
+			Name: "results",
+			From: "{{steps.wait.outputs.artifacts.results}}",
+		}}},
+	}
+	templates := []ArgoTemplate{}
+
+	// The config maps and service are applied before the workload is created
+	configs := []ArgoStep{}
+	workload := []ArgoStep{}
+	for i, object := range run.Objects {
+		manifest, err := Manifest(object)
+		if err != nil {
+			return nil, err
+		}
+		name := ObjectName(object)
+		action := "apply"
+		if i == len(run.Objects)-1 {
+			action = "create"
+		}
+		templates = append(templates, ArgoTemplate{
+			Name: fmt.Sprintf("%s-%s", run.Name, name),
+			Resource: &argoResource{
+				Action:            action,
+				SetOwnerReference: true,
+				Manifest:          manifest,
+			},
+		})
+		step := ArgoStep{Name: name, Template: fmt.Sprintf("%s-%s", run.Name, name)}
+		if action == "create" {
+			workload = append(workload, step)
+		} else {
+			configs = append(configs, step)
+		}
+	}
+	if len(configs) > 0 {
+		steps.Steps = append(steps.Steps, configs)
+	}
+	steps.Steps = append(steps.Steps, workload)
+
+	directory := filepath.Join(resultsDirectory, run.Name)
+	wait := ArgoTemplate{
+		Name:    run.Name + "-wait",
+		Outputs: &argoIO{Artifacts: []argoArtifact{{Name: "results", Path: directory}}},
+		Script: &argoScript{
+			Image:   options.KubectlImage,
+			Command: []string{"sh"},
+			Source:  run.WaitScript(directory, options.PollSeconds),
+		},
+	}
+	steps.Steps = append(steps.Steps, []ArgoStep{{Name: "wait", Template: wait.Name}})
+	return append([]ArgoTemplate{steps}, append(templates, wait)...), nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows_test
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/converged-computing/metrics-operator/pkg/workflows"
+)
+
+func TestNewArgoWorkflow(t *testing.T) {
+	pipeline, err := workflows.LoadPipeline("study", strings.NewReader(pipelineYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	workflow, err := workflows.NewArgoWorkflow(pipeline, workflows.ArgoOptions{ServiceAccountName: "runner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workflow.Metadata.GenerateName != "study-" || workflow.Spec.ServiceAccountName != "runner" {
+		t.Errorf("expected a workflow study- run by runner, found %s by %s", workflow.Metadata.GenerateName, workflow.Spec.ServiceAccountName)
+	}
+
+	templates := map[string]workflows.ArgoTemplate{}
+	for _, template := range workflow.Spec.Templates {
+		templates[template.Name] = template
+	}
+
+	// The pipeline is a group of steps for each stage, then the report
+	entrypoint := templates[workflow.Spec.Entrypoint]
+	groups := []string{}
+	for _, group := range entrypoint.Steps {
+		names := []string{}
+		for _, step := range group {
+			names = append(names, step.Name)
+		}
+		groups = append(groups, strings.Join(names, ","))
+	}
+	if strings.Join(groups, " ") != "fio-1,fio-2 lammps,disk report" {
+		t.Fatalf("expected the fan out of fio, then lammps and disk, then the report, found %v", groups)
+	}
+
+	// The report gets the results of each run
+	report := entrypoint.Steps[2][0]
+	if len(report.Arguments.Artifacts) != 4 {
+		t.Fatalf("expected the results of four runs, found %v", report.Arguments.Artifacts)
+	}
+	if report.Arguments.Artifacts[1].From != "{{steps.fio-2.outputs.artifacts.results}}" {
+		t.Errorf("expected the results of fio-2, found %s", report.Arguments.Artifacts[1].From)
+	}
+
+	// A run applies configs, creates the workload, and waits for it
+	run, ok := templates["fio-2"]
+	if !ok || len(run.Steps) != 3 {
+		t.Fatalf("expected three groups of steps for fio-2, found %v", run.Steps)
+	}
+	workload := templates[run.Steps[1][0].Template]
+	if workload.Resource == nil || workload.Resource.Action != "create" || !workload.Resource.SetOwnerReference {
+		t.Fatalf("expected fio-2 to create its JobSet, owned by the workflow")
+	}
+	if !strings.Contains(workload.Resource.Manifest, "name: fio-2") {
+		t.Errorf("expected the JobSet of fio-2:\n%s", workload.Resource.Manifest)
+	}
+	wait := templates[run.Steps[2][0].Template]
+	if wait.Script == nil || wait.Script.Image != workflows.DefaultKubectlImage {
+		t.Fatalf("expected fio-2 to wait with kubectl")
+	}
+	if run.Outputs.Artifacts[0].From != "{{steps.wait.outputs.artifacts.results}}" {
+		t.Errorf("expected the results of fio-2 from its wait step, found %s", run.Outputs.Artifacts[0].From)
+	}
+	if wait.Outputs.Artifacts[0].Path != "/tmp/results/fio-2" {
+		t.Errorf("expected the results of fio-2 in its own directory, found %s", wait.Outputs.Artifacts[0].Path)
+	}
+
+	// Entrypoints are not expanded as Argo templates
+	for name, template := range templates {
+		if template.Resource != nil && strings.Contains(template.Resource.Manifest, "{{") {
+			t.Errorf("expected no Argo template expressions in the manifest of %s", name)
+		}
+	}
+
+	_, err = yaml.Marshal(workflow)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
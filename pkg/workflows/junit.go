@@ -0,0 +1,138 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The JUnit report has a test suite for the runs, and a test case for each run,
+// which is failed when the run failed or a value regressed. CI systems (e.g.,
+// GitHub Actions with a test reporter, GitLab, or Jenkins) show these natively.
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// failure returns the message and type of a run that did not pass
+func (r *RunResult) failure() (string, string) {
+	if r.Failed {
+		return r.Message, "Failed"
+	}
+	names := []string{}
+	for _, regression := range r.Regressions() {
+		names = append(names, fmt.Sprintf("%s (%+.1f%%)", regression.Name, regression.Change))
+	}
+	return "worse than the baseline: " + strings.Join(names, ", "), "Regression"
+}
+
+// table is the values of a run, and the comparison to the baseline of each
+func (r *RunResult) table() string {
+	comparisons := map[string]Comparison{}
+	for _, comparison := range r.Comparisons {
+		comparisons[comparison.Name] = comparison
+	}
+	var out strings.Builder
+	for _, name := range r.Values.Names() {
+		fmt.Fprintf(&out, "%-40s %14g", name, r.Values[name])
+		comparison, ok := comparisons[name]
+		if ok {
+			fmt.Fprintf(&out, " %14g %+8.1f%%", comparison.Baseline, comparison.Change)
+			if comparison.Regression {
+				out.WriteString(" REGRESSION")
+			}
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// WriteJUnit writes the results of runs as a JUnit XML report
+func WriteJUnit(writer io.Writer, name string, results []*RunResult) error {
+	suite := junitSuite{Name: name, Tests: len(results)}
+	total := 0.0
+	for _, result := range results {
+		test := junitCase{
+			Name:      result.Name,
+			ClassName: fmt.Sprintf("%s.%s", name, result.Namespace),
+			Time:      fmt.Sprintf("%.3f", result.Seconds),
+			SystemOut: result.table(),
+		}
+		if !result.Passed() {
+			message, kind := result.failure()
+			test.Failure = &junitFailure{Message: message, Type: kind, Text: message}
+			suite.Failures++
+		}
+		total += result.Seconds
+		suite.Cases = append(suite.Cases, test)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+
+	out, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "%s%s\n", xml.Header, out)
+	return err
+}
+
+// WriteSummary writes the results of runs as a Markdown summary, e.g., for the
+// summary of a GitHub Actions job ($GITHUB_STEP_SUMMARY)
+func WriteSummary(writer io.Writer, name string, results []*RunResult) error {
+	var out strings.Builder
+	fmt.Fprintf(&out, "### %s\n\n", name)
+	out.WriteString("| MetricSet | Result | Seconds | Details |\n|-----------|--------|---------|---------|\n")
+	for _, result := range results {
+		state, details := "✅ passed", ""
+		if !result.Passed() {
+			message, kind := result.failure()
+			state, details = "❌ "+strings.ToLower(kind), message
+		}
+		fmt.Fprintf(&out, "| %s | %s | %.1f | %s |\n", result.Name, state, result.Seconds, strings.ReplaceAll(details, "|", "\\|"))
+	}
+	for _, result := range results {
+		if len(result.Comparisons) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "\n#### %s\n\n| Value | Baseline | Found | Change |\n|-------|----------|-------|--------|\n", result.Name)
+		for _, comparison := range result.Comparisons {
+			change := fmt.Sprintf("%+.1f%%", comparison.Change)
+			if comparison.Regression {
+				change += " ❌"
+			}
+			fmt.Fprintf(&out, "| %s | %g | %g | %s |\n", comparison.Name, comparison.Baseline, comparison.Value, change)
+		}
+	}
+	_, err := io.WriteString(writer, out.String())
+	return err
+}
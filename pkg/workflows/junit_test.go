@@ -0,0 +1,80 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/converged-computing/metrics-operator/pkg/workflows"
+)
+
+func TestReports(t *testing.T) {
+	results := []*workflows.RunResult{
+		{Name: "fio", Namespace: "default", Seconds: 90, Values: workflows.Values{"seconds": 90}},
+		{Name: "lammps", Namespace: "default", Failed: true, Message: "the workload failed"},
+		{
+			Name:      "stream",
+			Namespace: "default",
+			Seconds:   30,
+			Values:    workflows.Values{"seconds": 30},
+			Comparisons: []workflows.Comparison{
+				{Name: "seconds", Baseline: 20, Value: 30, Change: 50, Regression: true},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	err := workflows.WriteJUnit(&out, "benchmarks", results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := struct {
+		Suites []struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Cases    []struct {
+				Name    string `xml:"name,attr"`
+				Failure *struct {
+					Type string `xml:"type,attr"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}{}
+	err = xml.Unmarshal(out.Bytes(), &report)
+	if err != nil {
+		t.Fatalf("the JUnit report is not valid XML: %s\n%s", err, out.String())
+	}
+	if len(report.Suites) != 1 || report.Suites[0].Tests != 3 || report.Suites[0].Failures != 2 {
+		t.Fatalf("unexpected JUnit report:\n%s", out.String())
+	}
+	for i, kind := range []string{"", "Failed", "Regression"} {
+		test := report.Suites[0].Cases[i]
+		if (test.Failure == nil) != (kind == "") || (test.Failure != nil && test.Failure.Type != kind) {
+			t.Errorf("expected %s to have failure %q", test.Name, kind)
+		}
+	}
+
+	out.Reset()
+	err = workflows.WriteSummary(&out, "benchmarks", results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"| fio | ✅ passed | 90.0 |  |",
+		"| lammps | ❌ failed | 0.0 | the workload failed |",
+		"| stream | ❌ regression | 30.0 | worse than the baseline: seconds (+50.0%) |",
+		"| seconds | 20 | 30 | +50.0% ❌ |",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected the summary to have %q:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,352 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// As for Argo, the Tekton types are only the fields the generator uses
+const (
+	TektonAPIVersion = "tekton.dev/v1"
+
+	// A value more than this percent worse than its baseline is a regression
+	DefaultTolerance = 10
+)
+
+// TektonOptions customize the Tasks and Pipeline for a pipeline
+type TektonOptions struct {
+
+	// Image with kubectl (and awk and GNU date), to run the steps
+	KubectlImage string
+
+	// Seconds between checks of a running workload
+	PollSeconds int32
+
+	// Default percent a value can be worse than its baseline
+	Tolerance int32
+
+	// Values where lower is better (e.g., a latency), by name or by the name the
+	// metric reports. Seconds (of the run) are always lower is better, and other
+	// values are higher is better (e.g., a bandwidth).
+	LowerIsBetter []string
+}
+
+// TektonObject is a Tekton Task or Pipeline
+type TektonObject struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   tektonMetadata `json:"metadata"`
+	Spec       interface{}    `json:"spec"`
+}
+
+type tektonMetadata struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// TektonTaskSpec is the params, workspaces, and steps of a Task
+type TektonTaskSpec struct {
+	Description string            `json:"description,omitempty"`
+	Params      []tektonParam     `json:"params"`
+	Workspaces  []tektonWorkspace `json:"workspaces"`
+	Steps       []TektonStep      `json:"steps"`
+}
+
+// TektonStep is a script run in a container of a Task
+type TektonStep struct {
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Script string `json:"script"`
+}
+
+// TektonPipelineSpec is the params, workspaces, and tasks of a Pipeline
+type TektonPipelineSpec struct {
+	Params     []tektonParam        `json:"params"`
+	Workspaces []tektonWorkspace    `json:"workspaces"`
+	Tasks      []TektonPipelineTask `json:"tasks"`
+}
+
+// TektonPipelineTask runs a Task after the Tasks of the stage before it
+type TektonPipelineTask struct {
+	Name       string                   `json:"name"`
+	TaskRef    tektonTaskRef            `json:"taskRef"`
+	RunAfter   []string                 `json:"runAfter,omitempty"`
+	Params     []tektonParamValue       `json:"params"`
+	Workspaces []tektonWorkspaceBinding `json:"workspaces"`
+}
+
+type tektonParam struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     string `json:"default"`
+	Description string `json:"description,omitempty"`
+}
+
+type tektonParamValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type tektonWorkspace struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Optional    bool   `json:"optional,omitempty"`
+}
+
+type tektonWorkspaceBinding struct {
+	Name      string `json:"name"`
+	Workspace string `json:"workspace"`
+}
+
+type tektonTaskRef struct {
+	Name string `json:"name"`
+}
+
+// collectContext is the context of the script that collects the values of a run
+type collectContext struct {
+	Kind      string
+	Workload  string
+	Selector  string
+	Namespace string
+	Directory string
+	Condition string
+}
+
+// Values are written one per line (<name> <value>) to a file. Seconds are from
+// the creation of the workload until it completed, and values the metrics report
+// (with mo_report) are <container>/<name>, the mean over the pods.
+var collectTemplate = specs.NewTemplate("collect", `set -u
+namespace={{ quote .Namespace }}
+flags=""
+if [ -n "${namespace}" ]; then
+    flags="--namespace ${namespace}"
+fi
+mkdir -p {{ .Directory }}
+values={{ .Directory }}/values
+created=$(kubectl get ${flags} {{ .Kind }}/{{ .Workload }} -o jsonpath='{.metadata.creationTimestamp}')
+finished=$(kubectl get ${flags} {{ .Kind }}/{{ .Workload }} -o jsonpath='{.status.conditions[?(@.type=="{{ .Condition }}")].lastTransitionTime}')
+if [ -n "${created}" ] && [ -n "${finished}" ]; then
+    echo "seconds $(( $(date -d "${finished}" +%s) - $(date -d "${created}" +%s) ))" > ${values}
+else
+    : > ${values}
+fi
+for pod in $(kubectl get pods ${flags} -l {{ .Selector }} -o name); do
+    for container in $(kubectl get ${flags} ${pod} -o jsonpath='{.status.containerStatuses[*].name}'); do
+        kubectl get ${flags} ${pod} -o jsonpath="{.status.containerStatuses[?(@.name==\"${container}\")].state.terminated.message}" |
+            sed -n "s#^\([^= ]*\)=\(.*\)#${container}/\1 \2#p"
+    done
+done | awk '$2 ~ /^-?[0-9]*\.?[0-9]+([eE][-+]?[0-9]+)?$/ { sum[$1] += $2; count[$1]++ }
+    END { for (name in sum) printf "%s %g\n", name, sum[name] / count[name] }' | sort >> ${values}
+cat ${values}
+`, collectContext{})
+
+// compareContext is the context of the script that compares values to a baseline
+type compareContext struct {
+	Values        string
+	Baseline      string
+	Tolerance     string
+	LowerIsBetter string
+}
+
+// A value is a regression when it is worse than its baseline by more than the
+// tolerance (percent). Values without a baseline (or a baseline of 0) are not
+// compared, and without a baseline file the comparison is skipped.
+var compareTemplate = specs.NewTemplate("compare", `set -u
+baseline={{ .Baseline }}
+if [ ! -f "${baseline}" ]; then
+    echo "There is no baseline at ${baseline}, skipping the comparison"
+    exit 0
+fi
+awk -v tolerance={{ quote .Tolerance }} -v lower={{ quote .LowerIsBetter }} '
+BEGIN {
+    count = split("seconds," lower, names, ",")
+    for (i = 1; i <= count; i++) if (names[i] != "") smaller[names[i]] = 1
+    printf "%-40s %14s %14s %9s\n", "VALUE", "BASELINE", "FOUND", "CHANGE"
+}
+NR == FNR { base[$1] = $2; next }
+($1 in base) && base[$1] + 0 != 0 {
+    name = $1
+    sub(/.*\//, "", name)
+    change = ($2 - base[$1]) / base[$1] * 100
+    worse = (($1 in smaller) || (name in smaller)) ? change : -change
+    status = ""
+    if (worse > tolerance + 0) {
+        status = "REGRESSION"
+        failed = 1
+    }
+    printf "%-40s %14g %14g %+8.1f%% %s\n", $1, base[$1], $2, change, status
+}
+END {
+    if (failed) print "Values are worse than the baseline by more than " tolerance "%"
+    exit failed
+}' "${baseline}" {{ .Values }}
+`, compareContext{})
+
+// CompareScript is a script that compares the values of a run to a baseline, and
+// exits non-zero if a value regressed by more than the tolerance (percent)
+func CompareScript(values, baseline, tolerance string, lowerIsBetter []string) string {
+	return compareTemplate.Render(compareContext{
+		Values:        values,
+		Baseline:      baseline,
+		Tolerance:     tolerance,
+		LowerIsBetter: strings.Join(lowerIsBetter, ","),
+	})
+}
+
+// CollectScript is a script that writes the values of a finished run to a file
+// (values) in a directory
+func (r *Run) CollectScript(directory string) string {
+	condition := "Completed"
+	if r.Kind == "job" {
+		condition = "Complete"
+	}
+	return collectTemplate.Render(collectContext{
+		Kind:      r.Kind,
+		Workload:  r.Workload,
+		Selector:  r.Selector,
+		Namespace: r.Namespace,
+		Directory: directory,
+		Condition: condition,
+	})
+}
+
+// NewTektonPipeline renders a pipeline as a Task for each run and a Pipeline of
+// them. A Task creates the objects of its MetricSet (replacing the workload of
+// an earlier run), waits for it, saves the logs of its pods and its values in
+// the results workspace (under <run>), and compares the values to the values
+// in the optional baseline workspace (under <run>), failing on a regression.
+// The Tasks of a stage run at the same time, after the stage before it.
+func NewTektonPipeline(pipeline *Pipeline, options TektonOptions) ([]*TektonObject, error) {
+	if options.KubectlImage == "" {
+		options.KubectlImage = DefaultKubectlImage
+	}
+	if options.PollSeconds <= 0 {
+		options.PollSeconds = DefaultPollSeconds
+	}
+	if options.Tolerance <= 0 {
+		options.Tolerance = DefaultTolerance
+	}
+	labels := map[string]string{"metrics-operator.io/pipeline": pipeline.Name}
+	params := []tektonParam{
+		{
+			Name:        "tolerance",
+			Type:        "string",
+			Default:     fmt.Sprintf("%d", options.Tolerance),
+			Description: "Percent a value can be worse than its baseline",
+		},
+		{
+			Name:        "lower-is-better",
+			Type:        "string",
+			Default:     strings.Join(options.LowerIsBetter, ","),
+			Description: "Values where lower is better (comma separated), in addition to seconds",
+		},
+	}
+	workspaces := []tektonWorkspace{
+		{Name: "results", Description: "Logs and values of each run, under <run>"},
+		{Name: "baseline", Description: "Values to compare to, under <run>", Optional: true},
+	}
+
+	objects := []*TektonObject{}
+	spec := TektonPipelineSpec{Params: params, Workspaces: workspaces}
+	seen := map[string]bool{}
+	after := []string{}
+	for _, stage := range pipeline.Stages {
+		names := []string{}
+		for _, run := range stage.Runs {
+			if seen[run.Name] {
+				return nil, fmt.Errorf("more than one run is named %s", run.Name)
+			}
+			seen[run.Name] = true
+
+			task, err := newTektonTask(pipeline, run, options, &spec)
+			if err != nil {
+				return nil, err
+			}
+			task.Metadata.Labels = labels
+			objects = append(objects, task)
+
+			spec.Tasks = append(spec.Tasks, TektonPipelineTask{
+				Name:     run.Name,
+				TaskRef:  tektonTaskRef{Name: task.Metadata.Name},
+				RunAfter: after,
+				Params: []tektonParamValue{
+					{Name: "tolerance", Value: "$(params.tolerance)"},
+					{Name: "lower-is-better", Value: "$(params.lower-is-better)"},
+				},
+				Workspaces: []tektonWorkspaceBinding{
+					{Name: "results", Workspace: "results"},
+					{Name: "baseline", Workspace: "baseline"},
+				},
+			})
+			names = append(names, run.Name)
+		}
+		after = names
+	}
+	objects = append(objects, &TektonObject{
+		APIVersion: TektonAPIVersion,
+		Kind:       "Pipeline",
+		Metadata:   tektonMetadata{Name: pipeline.Name, Labels: labels},
+		Spec:       &spec,
+	})
+	return objects, nil
+}
+
+// newTektonTask returns the Task of a run: create, wait, collect, and compare.
+// It has the params and workspaces of the Pipeline.
+func newTektonTask(pipeline *Pipeline, run *Run, options TektonOptions, spec *TektonPipelineSpec) (*TektonObject, error) {
+	flags := ""
+	if run.Namespace != "" {
+		flags = " --namespace " + run.Namespace
+	}
+
+	// Manifests are base64 so the step script has nothing Tekton would replace,
+	// and the workload of an earlier run (of the same name) is deleted first
+	var create strings.Builder
+	create.WriteString("set -e\n")
+	for i, object := range run.Objects {
+		manifest, err := Manifest(object)
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(manifest))
+		if i == len(run.Objects)-1 {
+			fmt.Fprintf(&create, "kubectl delete%s --ignore-not-found --wait %s/%s\n", flags, run.Kind, run.Workload)
+			fmt.Fprintf(&create, "echo %s | base64 -d | kubectl create%s -f -\n", encoded, flags)
+			continue
+		}
+		fmt.Fprintf(&create, "echo %s | base64 -d | kubectl apply%s -f -\n", encoded, flags)
+	}
+
+	directory := fmt.Sprintf("$(workspaces.results.path)/%s", run.Name)
+	baseline := fmt.Sprintf("$(workspaces.baseline.path)/%s/values", run.Name)
+	return &TektonObject{
+		APIVersion: TektonAPIVersion,
+		Kind:       "Task",
+		Metadata:   tektonMetadata{Name: fmt.Sprintf("%s-%s", pipeline.Name, run.Name)},
+		Spec: &TektonTaskSpec{
+			Description: fmt.Sprintf("Run MetricSet %s and compare its values to a baseline", run.Name),
+			Params:      spec.Params,
+			Workspaces:  spec.Workspaces,
+			Steps: []TektonStep{
+				{Name: "create", Image: options.KubectlImage, Script: create.String()},
+				{Name: "wait", Image: options.KubectlImage, Script: run.WaitScript(directory, options.PollSeconds)},
+				{Name: "collect", Image: options.KubectlImage, Script: run.CollectScript(directory)},
+				{
+					Name:   "compare",
+					Image:  options.KubectlImage,
+					Script: CompareScript(directory+"/values", baseline, "$(params.tolerance)", []string{"$(params.lower-is-better)"}),
+				},
+			},
+		},
+	}, nil
+}
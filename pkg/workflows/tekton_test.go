@@ -0,0 +1,127 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/converged-computing/metrics-operator/pkg/workflows"
+)
+
+func TestNewTektonPipeline(t *testing.T) {
+	pipeline, err := workflows.LoadPipeline("study", strings.NewReader(pipelineYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := workflows.NewTektonPipeline(pipeline, workflows.TektonOptions{LowerIsBetter: []string{"latency"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A Task for each run, then the Pipeline
+	if len(objects) != 5 || objects[4].Kind != "Pipeline" {
+		t.Fatalf("expected four Tasks and a Pipeline, found %d objects", len(objects))
+	}
+	task := objects[1]
+	if task.Kind != "Task" || task.Metadata.Name != "study-fio-2" {
+		t.Fatalf("expected Task study-fio-2, found %s %s", task.Kind, task.Metadata.Name)
+	}
+	steps := []string{}
+	for _, step := range task.Spec.(*workflows.TektonTaskSpec).Steps {
+		steps = append(steps, step.Name)
+	}
+	if strings.Join(steps, " ") != "create wait collect compare" {
+		t.Errorf("expected steps to create, wait, collect, and compare, found %v", steps)
+	}
+
+	// The manifests are not in the script as is, so Tekton does not replace anything
+	create := task.Spec.(*workflows.TektonTaskSpec).Steps[0].Script
+	if strings.Contains(create, "kind: JobSet") || !strings.Contains(create, "kubectl delete --namespace default --ignore-not-found --wait jobset/fio-2") {
+		t.Errorf("expected encoded manifests, replacing the JobSet of an earlier run:\n%s", create)
+	}
+
+	// The Tasks of a stage run after the stage before it
+	spec := objects[4].Spec.(*workflows.TektonPipelineSpec)
+	for _, task := range spec.Tasks {
+		after := strings.Join(task.RunAfter, ",")
+		if strings.HasPrefix(task.Name, "fio") && after != "" {
+			t.Errorf("expected %s to run first, found after %s", task.Name, after)
+		}
+		if !strings.HasPrefix(task.Name, "fio") && after != "fio-1,fio-2" {
+			t.Errorf("expected %s to run after fio-1 and fio-2, found %s", task.Name, after)
+		}
+	}
+	if spec.Params[0].Default != "10" || spec.Params[1].Default != "latency" {
+		t.Errorf("expected the default tolerance and lower is better values, found %v", spec.Params)
+	}
+
+	for _, object := range objects {
+		_, err = yaml.Marshal(object)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompareScript(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is required to run the script")
+	}
+	if _, err := exec.LookPath("awk"); err != nil {
+		t.Skip("awk is required to run the script")
+	}
+	directory := t.TempDir()
+	baseline := filepath.Join(directory, "baseline")
+	err = os.WriteFile(baseline, []byte("seconds 100\nfio/bandwidth 200\nosu/latency 4\nfio/zero 0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		values    string
+		baseline  string
+		regressed bool
+	}{
+		{name: "same", values: "seconds 100\nfio/bandwidth 200\nosu/latency 4\n"},
+		{name: "within tolerance", values: "seconds 109\nfio/bandwidth 181\nosu/latency 4.3\n"},
+		{name: "faster", values: "seconds 50\nfio/bandwidth 400\nosu/latency 1\n"},
+		{name: "slower", values: "seconds 120\n", regressed: true},
+		{name: "less bandwidth", values: "fio/bandwidth 100\n", regressed: true},
+		{name: "more latency", values: "osu/latency 5\n", regressed: true},
+		{name: "no baseline value", values: "seconds 100\nfio/other 1\nfio/zero 10\n"},
+		{name: "no baseline", values: "seconds 1000\n", baseline: filepath.Join(directory, "missing")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := filepath.Join(directory, "values")
+			err := os.WriteFile(values, []byte(test.values), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.baseline == "" {
+				test.baseline = baseline
+			}
+			script := workflows.CompareScript(values, test.baseline, "10", []string{"latency"})
+			out, err := exec.Command(sh, "-c", script).CombinedOutput()
+			if test.regressed && err == nil {
+				t.Errorf("expected a regression:\n%s", out)
+			}
+			if !test.regressed && err != nil {
+				t.Errorf("expected no regression, found %s:\n%s", err, out)
+			}
+		})
+	}
+}
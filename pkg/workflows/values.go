@@ -0,0 +1,139 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Values are the numbers of a run to compare to a baseline: the seconds of the
+// run, and each value the metrics report (with mo_report) as <container>/<name>.
+// They are written one per line (<name> <value>), as the Tekton collect step does.
+type Values map[string]float64
+
+// ParseValues reads values, one per line. Lines that are not a name and a number
+// are skipped.
+func ParseValues(reader io.Reader) (Values, error) {
+	values := Values{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err == nil {
+			values[fields[0]] = value
+		}
+	}
+	return values, scanner.Err()
+}
+
+// Names of the values, sorted
+func (v Values) Names() []string {
+	names := []string{}
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write the values, one per line, sorted by name
+func (v Values) Write(writer io.Writer) error {
+	for _, name := range v.Names() {
+		_, err := fmt.Fprintf(writer, "%s %g\n", name, v[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReportedValues are the values the containers of pods reported in their
+// termination messages (<name>=<value> lines), the mean over the pods
+func ReportedValues(pods []corev1.Pod) Values {
+	sums := map[string]float64{}
+	counts := map[string]float64{}
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated == nil {
+				continue
+			}
+			for _, line := range strings.Split(status.State.Terminated.Message, "\n") {
+				name, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+				if !ok || name == "" || strings.Contains(name, " ") {
+					continue
+				}
+				number, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+				key := status.Name + "/" + name
+				sums[key] += number
+				counts[key]++
+			}
+		}
+	}
+	values := Values{}
+	for key, sum := range sums {
+		values[key] = sum / counts[key]
+	}
+	return values
+}
+
+// Comparison is a value of a run and its baseline
+type Comparison struct {
+	Name     string
+	Baseline float64
+	Value    float64
+
+	// Percent change from the baseline, and whether it is worse by more than
+	// the tolerance
+	Change     float64
+	Regression bool
+}
+
+// CompareValues compares values to a baseline, as the Tekton compare step does.
+// Seconds and the values named in lowerIsBetter (by name, or by the name the
+// metric reports) are better when lower, and others when higher. Values without
+// a baseline (or a baseline of 0) are not compared.
+func CompareValues(baseline, values Values, tolerance float64, lowerIsBetter []string) []Comparison {
+	smaller := map[string]bool{"seconds": true}
+	for _, name := range lowerIsBetter {
+		smaller[name] = true
+	}
+	comparisons := []Comparison{}
+	for _, name := range values.Names() {
+		base, ok := baseline[name]
+		if !ok || base == 0 {
+			continue
+		}
+		value := values[name]
+		change := (value - base) / base * 100
+		worse := -change
+		if smaller[name] || smaller[name[strings.LastIndex(name, "/")+1:]] {
+			worse = change
+		}
+		comparisons = append(comparisons, Comparison{
+			Name:       name,
+			Baseline:   base,
+			Value:      value,
+			Change:     change,
+			Regression: worse > tolerance,
+		})
+	}
+	return comparisons
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/converged-computing/metrics-operator/pkg/workflows"
+)
+
+func TestValues(t *testing.T) {
+	values, err := workflows.ParseValues(strings.NewReader("seconds 90\nfio/iops 1200\nnot a value\nfio/latency x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values["seconds"] != 90 || values["fio/iops"] != 1200 {
+		t.Fatalf("unexpected values %v", values)
+	}
+	var out bytes.Buffer
+	err = values.Write(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "fio/iops 1200\nseconds 90\n" {
+		t.Errorf("unexpected values written:\n%s", out.String())
+	}
+}
+
+func TestReportedValues(t *testing.T) {
+	pod := func(message string) corev1.Pod {
+		return corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "fio", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}}},
+			{Name: "app", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		}}}
+	}
+	values := workflows.ReportedValues([]corev1.Pod{
+		pod("iops=1000\nlatency=2\n"),
+		pod("iops=3000\nsummary=the run failed\n"),
+	})
+	if len(values) != 2 || values["fio/iops"] != 2000 || values["fio/latency"] != 2 {
+		t.Errorf("unexpected values %v", values)
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	baseline := workflows.Values{"seconds": 100, "fio/iops": 1000, "fio/latency": 2, "fio/new": 0}
+	values := workflows.Values{"seconds": 105, "fio/iops": 850, "fio/latency": 2.5, "fio/new": 1, "fio/other": 1}
+	comparisons := workflows.CompareValues(baseline, values, 10, []string{"latency"})
+
+	expected := map[string]bool{"seconds": false, "fio/iops": true, "fio/latency": true}
+	if len(comparisons) != len(expected) {
+		t.Fatalf("expected %d comparisons, found %+v", len(expected), comparisons)
+	}
+	for _, comparison := range comparisons {
+		regression, ok := expected[comparison.Name]
+		if !ok {
+			t.Errorf("unexpected comparison of %s", comparison.Name)
+		}
+		if comparison.Regression != regression {
+			t.Errorf("expected regression of %s to be %t (%+.1f%%)", comparison.Name, regression, comparison.Change)
+		}
+	}
+
+	// A higher value that is better is not a regression
+	comparisons = workflows.CompareValues(baseline, workflows.Values{"fio/iops": 2000}, 10, nil)
+	if len(comparisons) != 1 || comparisons[0].Regression || comparisons[0].Change != 100 {
+		t.Errorf("unexpected comparisons %+v", comparisons)
+	}
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/metrics"
+)
+
+// RunResult is the outcome of a MetricSet the operator ran, e.g., for a report in CI
+type RunResult struct {
+	Name      string
+	Namespace string
+
+	// The run failed, and why (e.g., the JobSet failed, or a metric timed out)
+	Failed  bool
+	Message string
+
+	// Seconds from creating the workload until it finished, if known
+	Seconds float64
+
+	// Values to compare to a baseline, and the comparisons
+	Values      Values
+	Comparisons []Comparison
+
+	// Pods of the run, e.g., to save their logs
+	Pods []corev1.Pod
+}
+
+// Regressions are the values worse than their baseline by more than the tolerance
+func (r *RunResult) Regressions() []Comparison {
+	regressions := []Comparison{}
+	for _, comparison := range r.Comparisons {
+		if comparison.Regression {
+			regressions = append(regressions, comparison)
+		}
+	}
+	return regressions
+}
+
+// Passed determines if a run finished without failing or regressing
+func (r *RunResult) Passed() bool {
+	return !r.Failed && len(r.Regressions()) == 0
+}
+
+// workload is what a run needs to know of its JobSet (or Job)
+type workload struct {
+	finished bool
+	failed   bool
+	created  time.Time
+	ended    time.Time
+}
+
+// jobSetWorkload is the state of a JobSet
+func jobSetWorkload(js *jobset.JobSet) *workload {
+	w := &workload{created: js.CreationTimestamp.Time}
+	for _, condition := range js.Status.Conditions {
+		if condition.Status != metav1.ConditionTrue {
+			continue
+		}
+		if condition.Type == string(jobset.JobSetCompleted) || condition.Type == string(jobset.JobSetFailed) {
+			w.finished = true
+			w.failed = condition.Type == string(jobset.JobSetFailed)
+			w.ended = condition.LastTransitionTime.Time
+		}
+	}
+	return w
+}
+
+// jobWorkload is the state of a Job
+func jobWorkload(job *batchv1.Job) *workload {
+	w := &workload{created: job.CreationTimestamp.Time}
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		if condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed {
+			w.finished = true
+			w.failed = condition.Type == batchv1.JobFailed
+			w.ended = condition.LastTransitionTime.Time
+		}
+	}
+	return w
+}
+
+// checkSupportedRun returns an error for MetricSets that do not finish
+func checkSupportedRun(set *api.MetricSet) error {
+	if set.Spec.Canary.Enabled() {
+		return fmt.Errorf("MetricSet %s is a canary, which runs until it is deleted", set.Name)
+	}
+	return nil
+}
+
+// checkRun determines if a run has finished, and its result, from the status of
+// the MetricSet and its workload (nil if it was not found). A scaling study,
+// sharded run, or acceptance run is finished when the operator has its results.
+func checkRun(set *api.MetricSet, w *workload) (*RunResult, bool) {
+	result := &RunResult{Name: set.Name, Namespace: set.Namespace, Values: Values{}}
+	if set.Status.Cancellation == api.CancelCancelled {
+		result.Failed, result.Message = true, "the run was cancelled"
+		return result, true
+	}
+
+	switch {
+	case set.Spec.Scaling.Enabled():
+		if len(set.Status.Scaling) < len(set.Spec.Scaling.Pods)*len(set.Spec.Metrics) {
+			return nil, false
+		}
+		failed := []string{}
+		for _, scaling := range set.Status.Scaling {
+			prefix := fmt.Sprintf("%s/%d/", scaling.Metric, scaling.Pods)
+			if scaling.State != "" {
+				failed = append(failed, fmt.Sprintf("%s at %d pods: %s", scaling.Metric, scaling.Pods, scaling.State))
+				continue
+			}
+			for name, value := range map[string]string{"seconds": scaling.Seconds, "efficiency": scaling.Efficiency} {
+				number, err := strconv.ParseFloat(value, 64)
+				if err == nil {
+					result.Values[prefix+name] = number
+				}
+			}
+		}
+		if len(failed) > 0 {
+			result.Failed, result.Message = true, strings.Join(failed, ", ")
+		}
+		return result, true
+
+	case set.IsSharded():
+		if len(set.Status.Shards) < int(set.Spec.Shards) {
+			return nil, false
+		}
+		completed := 0
+		for _, shard := range set.Status.Shards {
+			switch shard.State {
+			case "failed":
+				result.Failed, result.Message = true, fmt.Sprintf("shard %s failed", shard.Name)
+				return result, true
+			case "completed":
+				completed++
+			}
+		}
+		return result, completed == len(set.Status.Shards)
+	}
+
+	if w == nil || !w.finished {
+		return nil, false
+	}
+	if !w.ended.IsZero() && !w.created.IsZero() {
+		result.Seconds = w.ended.Sub(w.created).Seconds()
+		result.Values["seconds"] = result.Seconds
+	}
+	if set.Spec.Acceptance.Enabled() {
+		if set.Status.Acceptance == nil || len(set.Status.Acceptance.Nodes) == 0 {
+			return nil, false
+		}
+		if set.Status.Acceptance.Failed > 0 {
+			result.Failed = true
+			result.Message = fmt.Sprintf("%d of %d nodes failed acceptance", set.Status.Acceptance.Failed, len(set.Status.Acceptance.Nodes))
+		}
+	}
+	if w.failed {
+		result.Failed, result.Message = true, "the workload failed"
+		if set.Status.Failures != nil && len(set.Status.Failures.Summaries) > 0 {
+			summary := set.Status.Failures.Summaries[0]
+			result.Message += fmt.Sprintf(" (%s exited with %d", summary.Container, summary.ExitCode)
+			if summary.Message != "" {
+				result.Message += ": " + summary.Message
+			}
+			result.Message += ")"
+		}
+	}
+
+	// Metrics that did not finish normally (e.g., TimedOut) fail the run too
+	for _, metric := range set.Status.Metrics {
+		result.Failed = true
+		if result.Message != "" {
+			result.Message += ", "
+		}
+		result.Message += fmt.Sprintf("%s %s", metric.Name, metric.State)
+	}
+	return result, true
+}
+
+// getWorkload returns the JobSet (or Job, for the Job backend) of a run, or nil
+// if it does not exist yet
+func getWorkload(ctx context.Context, c client.Client, set *api.MetricSet) (*workload, error) {
+	if !set.UsesJobs() {
+		js := &jobset.JobSet{}
+		err := c.Get(ctx, types.NamespacedName{Name: set.Name, Namespace: set.Namespace}, js)
+		if err == nil {
+			return jobSetWorkload(js), nil
+		}
+
+		// Without the JobSet API, the operator runs a MetricSet without a backend
+		// with a Job
+		if !errors.IsNotFound(err) && !apimeta.IsNoMatchError(err) {
+			return nil, err
+		}
+	}
+	jobs := &batchv1.JobList{}
+	err := c.List(ctx, jobs, client.InNamespace(set.Namespace), client.MatchingLabels{metrics.MetricSetLabel: set.Name})
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs.Items {
+		if metav1.IsControlledBy(&jobs.Items[i], set) {
+			return jobWorkload(&jobs.Items[i]), nil
+		}
+	}
+	return nil, nil
+}
+
+// WaitForMetricSet waits (checking every poll) until the run of a MetricSet has
+// finished, or the context is done. The values of the run are its seconds (or
+// the seconds and efficiency of each pod count of a scaling study) and the values
+// its metrics reported.
+func WaitForMetricSet(ctx context.Context, c client.Client, key types.NamespacedName, poll time.Duration) (*RunResult, error) {
+	for {
+		set := &api.MetricSet{}
+		err := c.Get(ctx, key, set)
+		if err != nil {
+			return nil, err
+		}
+		err = checkSupportedRun(set)
+		if err != nil {
+			return nil, err
+		}
+		var w *workload
+		if !set.Spec.Scaling.Enabled() && !set.IsSharded() {
+			w, err = getWorkload(ctx, c, set)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result, finished := checkRun(set, w)
+		if finished {
+			pods := &corev1.PodList{}
+			err = c.List(ctx, pods, client.InNamespace(set.Namespace), client.MatchingLabels{metrics.MetricSetLabel: set.Name})
+			if err != nil {
+				return nil, err
+			}
+			result.Pods = pods.Items
+			for name, value := range ReportedValues(pods.Items) {
+				result.Values[name] = value
+			}
+			return result, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for MetricSet %s: %w", key.Name, ctx.Err())
+		case <-time.After(poll):
+		}
+	}
+}
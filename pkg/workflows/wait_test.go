@@ -0,0 +1,204 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+)
+
+func TestWorkloads(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	ended := created.Add(90 * time.Second)
+
+	js := &jobset.JobSet{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+	js.Status.Conditions = []metav1.Condition{
+		{Type: string(jobset.JobSetCompleted), Status: metav1.ConditionFalse},
+	}
+	w := jobSetWorkload(js)
+	if w.finished {
+		t.Errorf("a JobSet without a true condition is not finished")
+	}
+	js.Status.Conditions = append(js.Status.Conditions, metav1.Condition{
+		Type:               string(jobset.JobSetFailed),
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.NewTime(ended),
+	})
+	w = jobSetWorkload(js)
+	if !w.finished || !w.failed || !w.ended.Equal(ended) {
+		t.Errorf("expected a failed JobSet that ended at %s, found %+v", ended, w)
+	}
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+	job.Status.Conditions = []batchv1.JobCondition{
+		{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(ended)},
+	}
+	w = jobWorkload(job)
+	if !w.finished || w.failed || !w.created.Equal(created) {
+		t.Errorf("expected a completed Job, found %+v", w)
+	}
+}
+
+func TestCheckRun(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	completed := &workload{finished: true, created: created, ended: created.Add(90 * time.Second)}
+	failed := &workload{finished: true, failed: true, created: created, ended: created.Add(30 * time.Second)}
+
+	tests := map[string]struct {
+		set      func(set *api.MetricSet)
+		workload *workload
+		finished bool
+		failed   bool
+		message  string
+		values   Values
+	}{
+		"not created": {},
+		"running": {
+			workload: &workload{created: created},
+		},
+		"completed": {
+			workload: completed,
+			finished: true,
+			values:   Values{"seconds": 90},
+		},
+		"failed": {
+			set: func(set *api.MetricSet) {
+				set.Status.Failures = &api.FailureStatus{Summaries: []api.FailureSummary{
+					{Container: "app", ExitCode: 137, Message: "out of memory"},
+				}}
+			},
+			workload: failed,
+			finished: true,
+			failed:   true,
+			message:  "the workload failed (app exited with 137: out of memory)",
+			values:   Values{"seconds": 30},
+		},
+		"metric timed out": {
+			set: func(set *api.MetricSet) {
+				set.Status.Metrics = []api.MetricState{{Name: "io-fio", State: "TimedOut"}}
+			},
+			workload: completed,
+			finished: true,
+			failed:   true,
+			message:  "io-fio TimedOut",
+			values:   Values{"seconds": 90},
+		},
+		"cancelled": {
+			set: func(set *api.MetricSet) {
+				set.Status.Cancellation = api.CancelCancelled
+			},
+			finished: true,
+			failed:   true,
+			message:  "the run was cancelled",
+		},
+		"acceptance without a report": {
+			set: func(set *api.MetricSet) {
+				set.Spec.Acceptance.Checks = []api.AcceptanceCheck{{Metric: "io-fio", Value: "iops", Min: "100"}}
+			},
+			workload: completed,
+		},
+		"acceptance failed": {
+			set: func(set *api.MetricSet) {
+				set.Spec.Acceptance.Checks = []api.AcceptanceCheck{{Metric: "io-fio", Value: "iops", Min: "100"}}
+				set.Status.Acceptance = &api.AcceptanceStatus{
+					Nodes:  []api.NodeAcceptance{{Name: "a", Result: "Passed"}, {Name: "b", Result: "Failed"}},
+					Failed: 1,
+				}
+			},
+			workload: completed,
+			finished: true,
+			failed:   true,
+			message:  "1 of 2 nodes failed acceptance",
+			values:   Values{"seconds": 90},
+		},
+		"scaling running": {
+			set: func(set *api.MetricSet) {
+				set.Spec.Scaling.Pods = []int32{1, 2}
+				set.Status.Scaling = []api.ScalingResult{{Metric: "io-fio", Pods: 1, Seconds: "10", Efficiency: "1"}}
+			},
+		},
+		"scaling": {
+			set: func(set *api.MetricSet) {
+				set.Spec.Scaling.Pods = []int32{1, 2}
+				set.Status.Scaling = []api.ScalingResult{
+					{Metric: "io-fio", Pods: 1, Seconds: "10", Efficiency: "1"},
+					{Metric: "io-fio", Pods: 2, Seconds: "6", Efficiency: "0.8333"},
+				}
+			},
+			finished: true,
+			values: Values{
+				"io-fio/1/seconds":    10,
+				"io-fio/1/efficiency": 1,
+				"io-fio/2/seconds":    6,
+				"io-fio/2/efficiency": 0.8333,
+			},
+		},
+		"scaling failed": {
+			set: func(set *api.MetricSet) {
+				set.Spec.Scaling.Pods = []int32{1, 2}
+				set.Status.Scaling = []api.ScalingResult{
+					{Metric: "io-fio", Pods: 1, Seconds: "10", Efficiency: "1"},
+					{Metric: "io-fio", Pods: 2, State: "TimedOut"},
+				}
+			},
+			finished: true,
+			failed:   true,
+			message:  "io-fio at 2 pods: TimedOut",
+			values:   Values{"io-fio/1/seconds": 10, "io-fio/1/efficiency": 1},
+		},
+		"sharded running": {
+			set: func(set *api.MetricSet) {
+				set.Spec.Shards = 2
+				set.Status.Shards = []api.ShardStatus{{Name: "fio-s0", State: "completed"}, {Name: "fio-s1", State: "active"}}
+			},
+		},
+		"sharded failed": {
+			set: func(set *api.MetricSet) {
+				set.Spec.Shards = 2
+				set.Status.Shards = []api.ShardStatus{{Name: "fio-s0", State: "failed"}, {Name: "fio-s1", State: "active"}}
+			},
+			finished: true,
+			failed:   true,
+			message:  "shard fio-s0 failed",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			set := &api.MetricSet{ObjectMeta: metav1.ObjectMeta{Name: "fio", Namespace: "default"}}
+			set.Spec.Metrics = []api.Metric{{Name: "io-fio"}}
+			if test.set != nil {
+				test.set(set)
+			}
+			result, finished := checkRun(set, test.workload)
+			if finished != test.finished {
+				t.Fatalf("expected finished to be %t", test.finished)
+			}
+			if !finished {
+				return
+			}
+			if result.Failed != test.failed || result.Message != test.message {
+				t.Errorf("expected failed %t (%q), found %t (%q)", test.failed, test.message, result.Failed, result.Message)
+			}
+			if len(result.Values) != len(test.values) {
+				t.Fatalf("expected values %v, found %v", test.values, result.Values)
+			}
+			for name, value := range test.values {
+				if result.Values[name] != value {
+					t.Errorf("expected %s to be %g, found %g", name, value, result.Values[name])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+// Package workflows renders MetricSets for other orchestrators (e.g., Argo
+// Workflows), reusing the containers and entrypoints the operator generates.
+// Each MetricSet is rendered (without a cluster) to the objects the operator
+// would create for it, so the orchestrator can create them and wait for the run.
+// For CI, it also waits for MetricSets the operator runs, and reports the results
+// (e.g., as JUnit) and their comparison to a baseline.
+package workflows
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	jobset "sigs.k8s.io/jobset/api/jobset/v1alpha2"
+	"sigs.k8s.io/yaml"
+
+	api "github.com/converged-computing/metrics-operator/api/v1alpha2"
+	"github.com/converged-computing/metrics-operator/pkg/addons"
+	"github.com/converged-computing/metrics-operator/pkg/metrics"
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+)
+
+// StageAnnotation groups the MetricSets of a pipeline into a stage. MetricSets
+// without it are each their own stage.
+const StageAnnotation = "metrics-operator.io/stage"
+
+// Pipeline is stages of MetricSets, run in order. The MetricSets of a stage
+// (and the pod counts of a scaling study) run at the same time.
+type Pipeline struct {
+	Name   string
+	Stages []Stage
+}
+
+// Stage is the runs of a pipeline that start together
+type Stage struct {
+	Name string
+	Runs []*Run
+}
+
+// Run is a MetricSet rendered to the objects that run it without the operator:
+// the config maps of entrypoints, the headless service, and the JobSet (or Job)
+type Run struct {
+	Name      string
+	Namespace string
+	Objects   []runtime.Object
+
+	// The kind and name of the workload to wait for, and a selector for its pods
+	Kind     string
+	Workload string
+	Selector string
+}
+
+// LoadPipeline reads the MetricSets of a pipeline from YAML (or JSON) documents
+func LoadPipeline(name string, reader io.Reader) (*Pipeline, error) {
+	sets, err := LoadMetricSets(reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewPipeline(name, sets)
+}
+
+// LoadMetricSets reads MetricSets from YAML (or JSON) documents
+func LoadMetricSets(reader io.Reader) ([]*api.MetricSet, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(reader, 4096)
+	sets := []*api.MetricSet{}
+	for {
+		set := &api.MetricSet{}
+		err := decoder.Decode(set)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if set.Kind == "" && set.Name == "" {
+			continue
+		}
+		if set.Kind != "MetricSet" {
+			return nil, fmt.Errorf("expected MetricSets, found a %s", set.Kind)
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// NewPipeline renders each MetricSet of a pipeline. The stages are in the order
+// of their first MetricSet, and a scaling study is a run for each pod count.
+func NewPipeline(name string, sets []*api.MetricSet) (*Pipeline, error) {
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("a pipeline needs one or more MetricSets")
+	}
+	if name == "" {
+		name = sets[0].Name
+	}
+	pipeline := &Pipeline{Name: name}
+	stages := map[string]int{}
+	for i, set := range sets {
+		setDefaults(set)
+		stage := set.Annotations[StageAnnotation]
+		if stage == "" {
+			stage = fmt.Sprintf("stage-%d", i)
+		}
+		index, ok := stages[stage]
+		if !ok {
+			index = len(pipeline.Stages)
+			stages[stage] = index
+			pipeline.Stages = append(pipeline.Stages, Stage{Name: stage})
+		}
+		runs := []*api.MetricSet{set}
+		if set.Spec.Scaling.Enabled() {
+			runs = []*api.MetricSet{}
+			for _, pods := range set.Spec.Scaling.Pods {
+				runs = append(runs, set.ScalingSet(pods))
+			}
+		}
+		for _, spec := range runs {
+			run, err := NewRun(spec)
+			if err != nil {
+				return nil, fmt.Errorf("MetricSet %s: %w", spec.Name, err)
+			}
+			pipeline.Stages[index].Runs = append(pipeline.Stages[index].Runs, run)
+		}
+	}
+	return pipeline, nil
+}
+
+// setDefaults sets the defaults of the custom resource definition, which the API
+// server sets for MetricSets that are created
+func setDefaults(set *api.MetricSet) {
+	if set.Spec.ServiceName == "" {
+		set.Spec.ServiceName = "ms"
+	}
+	if set.Spec.Pods == 0 {
+		set.Spec.Pods = 1
+	}
+	if set.Spec.DeadlineSeconds == 0 {
+		set.Spec.DeadlineSeconds = 31500000
+	}
+	if set.Spec.Scaling.Enabled() && set.Spec.Scaling.Mode == "" {
+		set.Spec.Scaling.Mode = "strong"
+	}
+}
+
+// NewRun renders a MetricSet to the objects that run it
+func NewRun(spec *api.MetricSet) (*Run, error) {
+	err := checkSupported(spec)
+	if err != nil {
+		return nil, err
+	}
+	rendering, err := metrics.Render(spec)
+	if err != nil {
+		return nil, err
+	}
+	run := &Run{
+		Name:      spec.Name,
+		Namespace: spec.Namespace,
+		Selector:  fmt.Sprintf("%s=%s", metrics.MetricSetLabel, spec.Name),
+	}
+
+	// Entrypoints that look like a template of the orchestrator (e.g., {{ }} for
+	// Argo) are binary data, so they are not expanded
+	for _, shard := range rendering.ConfigMaps {
+		cm := &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: shard.Name, Namespace: spec.Namespace},
+			Data:       map[string]string{},
+		}
+		for key, value := range shard.Data {
+			if strings.Contains(value, "{{") {
+				if cm.BinaryData == nil {
+					cm.BinaryData = map[string][]byte{}
+				}
+				cm.BinaryData[key] = []byte(value)
+				continue
+			}
+			cm.Data[key] = value
+		}
+		run.Objects = append(run.Objects, cm)
+	}
+
+	// JobSet creates the headless service when it sets the hostnames
+	if !spec.Spec.Network.EnableDNSHostnames || spec.UsesJobs() {
+		run.Objects = append(run.Objects, &corev1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: metav1.ObjectMeta{Name: spec.Subdomain(), Namespace: spec.Namespace},
+			Spec: corev1.ServiceSpec{
+				ClusterIP:                "None",
+				Selector:                 map[string]string{metrics.MetricSetLabel: spec.Name},
+				PublishNotReadyAddresses: spec.Spec.Network.PublishNotReadyAddresses,
+			},
+		})
+	}
+
+	js := rendering.JobSet
+	if spec.UsesJobs() {
+		job, err := metrics.GetJob(js)
+		if err != nil {
+			return nil, err
+		}
+		job.TypeMeta = metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}
+		run.Kind, run.Workload = "job", job.Name
+		run.Objects = append(run.Objects, job)
+		return run, nil
+	}
+	js.TypeMeta = metav1.TypeMeta{APIVersion: jobset.GroupVersion.String(), Kind: "JobSet"}
+	run.Kind, run.Workload = "jobset", js.Name
+	run.Objects = append(run.Objects, js)
+	return run, nil
+}
+
+// checkSupported returns an error for features that need the operator, e.g., to
+// create objects other than the config maps, service, and workload, or to manage
+// the run while it is running
+func checkSupported(spec *api.MetricSet) error {
+	features := []string{}
+	for feature, used := range map[string]bool{
+		"shards":           spec.IsSharded(),
+		"acceptance":       spec.Spec.Acceptance.Enabled(),
+		"canary":           spec.Spec.Canary.Enabled(),
+		"scratch":          spec.Spec.Scratch.Enabled(),
+		"disruptionBudget": spec.Spec.DisruptionBudget,
+		"perfEvents":       spec.Spec.PerfEvents.Tune,
+		"gangScheduling":   spec.Spec.GangScheduling.Enabled(),
+		"InOrder startup":  spec.StartsInOrder(),
+	} {
+		if used {
+			features = append(features, feature)
+		}
+	}
+	for _, metric := range spec.Spec.Metrics {
+		for _, addon := range metric.Addons {
+			if addon.Name == addons.TLSIdentifier {
+				features = append(features, "the tls addon")
+			}
+		}
+	}
+	if len(features) > 0 {
+		sort.Strings(features)
+		return fmt.Errorf("%s need the operator", strings.Join(features, ", "))
+	}
+	return nil
+}
+
+// Manifest is the YAML of an object, without the empty status and creation
+// times that an object (and its templates) generated in code have
+func Manifest(object runtime.Object) (string, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		return "", err
+	}
+	delete(content, "status")
+	removeCreationTimestamps(content)
+	out, err := yaml.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(out)) + "\n", nil
+}
+
+// removeCreationTimestamps removes empty creation times from an object
+func removeCreationTimestamps(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		timestamp, ok := v["creationTimestamp"]
+		if ok && timestamp == nil {
+			delete(v, "creationTimestamp")
+		}
+		for _, child := range v {
+			removeCreationTimestamps(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			removeCreationTimestamps(child)
+		}
+	}
+}
+
+// ObjectName is the lowercase kind and name of an object, e.g., configmap-lammps
+func ObjectName(object runtime.Object) string {
+	accessor, err := apimeta.Accessor(object)
+	if err != nil {
+		return ""
+	}
+	kind := object.GetObjectKind().GroupVersionKind().Kind
+	return fmt.Sprintf("%s-%s", strings.ToLower(kind), accessor.GetName())
+}
+
+// waitContext is the context of the script that waits for a run
+type waitContext struct {
+	Kind      string
+	Workload  string
+	Selector  string
+	Namespace string
+	Directory string
+	Poll      int32
+}
+
+// The script waits for the workload to complete (or fail), and saves the logs
+// of its pods (the output of the metrics) in a directory, even when it failed.
+// It needs kubectl, and a service account that can get the workload and pods.
+var waitTemplate = specs.NewTemplate("wait", `set -u
+namespace={{ quote .Namespace }}
+flags=""
+if [ -n "${namespace}" ]; then
+    flags="--namespace ${namespace}"
+fi
+echo "Waiting for {{ .Kind }}/{{ .Workload }}"
+status=""
+while [ -z "${status}" ]; do
+    conditions=$(kubectl get ${flags} {{ .Kind }}/{{ .Workload }} -o jsonpath='{.status.conditions[?(@.status=="True")].type}')
+    case " ${conditions} " in
+        *" Complete "*|*" Completed "*) status=0 ;;
+        *" Failed "*) status=1 ;;
+        *) sleep {{ .Poll }} ;;
+    esac
+done
+mkdir -p {{ .Directory }}
+for pod in $(kubectl get pods ${flags} -l {{ .Selector }} -o name); do
+    kubectl logs ${flags} --all-containers ${pod} > {{ .Directory }}/${pod#pod/}.log || true
+done
+if [ "${status}" != "0" ]; then
+    echo "{{ .Kind }}/{{ .Workload }} failed, logs are in {{ .Directory }}"
+fi
+exit ${status}
+`, waitContext{})
+
+// WaitScript is a script (for bash or sh) that waits for a run to finish, saves
+// the logs of its pods in a directory, and exits with the status of the run.
+// It checks the workload every poll seconds. Without a namespace, the run is in
+// the namespace of kubectl (e.g., of the pod running the script).
+func (r *Run) WaitScript(directory string, poll int32) string {
+	return waitTemplate.Render(waitContext{
+		Kind:      r.Kind,
+		Workload:  r.Workload,
+		Selector:  r.Selector,
+		Namespace: r.Namespace,
+		Directory: directory,
+		Poll:      poll,
+	})
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2023 Lawrence Livermore National Security, LLC
+ (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+SPDX-License-Identifier: MIT
+*/
+
+package workflows_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/converged-computing/metrics-operator/pkg/specs"
+	"github.com/converged-computing/metrics-operator/pkg/workflows"
+
+	// Register the built-in metrics
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/app"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/io"
+	_ "github.com/converged-computing/metrics-operator/pkg/metrics/network"
+)
+
+// A pipeline of a scaling study of fio, then lammps and fio (with the Job backend) together
+var pipelineYAML = `
+apiVersion: flux-framework.org/v1alpha2
+kind: MetricSet
+metadata:
+  name: fio
+  namespace: default
+spec:
+  pods: 1
+  scaling:
+    pods: [1, 2]
+  metrics:
+    - name: io-fio
+---
+apiVersion: flux-framework.org/v1alpha2
+kind: MetricSet
+metadata:
+  name: lammps
+  namespace: default
+  annotations:
+    metrics-operator.io/stage: apps
+spec:
+  pods: 2
+  metrics:
+    - name: app-lammps
+---
+apiVersion: flux-framework.org/v1alpha2
+kind: MetricSet
+metadata:
+  name: disk
+  namespace: default
+  annotations:
+    metrics-operator.io/stage: apps
+spec:
+  pods: 2
+  backend: Job
+  metrics:
+    - name: io-fio
+`
+
+func TestLoadPipeline(t *testing.T) {
+	pipeline, err := workflows.LoadPipeline("study", strings.NewReader(pipelineYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipeline.Name != "study" || len(pipeline.Stages) != 2 {
+		t.Fatalf("expected two stages of pipeline study, found %d of %s", len(pipeline.Stages), pipeline.Name)
+	}
+
+	// The scaling study is a run for each pod count
+	runs := []string{}
+	for _, run := range pipeline.Stages[0].Runs {
+		runs = append(runs, run.Name)
+	}
+	if strings.Join(runs, " ") != "fio-1 fio-2" {
+		t.Errorf("expected runs fio-1 and fio-2 in the first stage, found %v", runs)
+	}
+	if pipeline.Stages[1].Name != "apps" || len(pipeline.Stages[1].Runs) != 2 {
+		t.Fatalf("expected lammps and disk in stage apps, found %v", pipeline.Stages[1])
+	}
+
+	// A run is the config maps, service, and workload (last)
+	lammps := pipeline.Stages[1].Runs[0]
+	names := []string{}
+	for _, object := range lammps.Objects {
+		names = append(names, workflows.ObjectName(object))
+	}
+	if strings.Join(names, " ") != "configmap-lammps service-ms jobset-lammps" {
+		t.Errorf("expected the config map, service, and JobSet of lammps, found %v", names)
+	}
+	if lammps.Kind != "jobset" || lammps.Workload != "lammps" || lammps.Selector != "metricset-name=lammps" {
+		t.Errorf("expected to wait for jobset/lammps, found %s/%s (%s)", lammps.Kind, lammps.Workload, lammps.Selector)
+	}
+	disk := pipeline.Stages[1].Runs[1]
+	if disk.Kind != "job" || !strings.HasPrefix(disk.Workload, "disk-") {
+		t.Errorf("expected to wait for the Job of disk, found %s/%s", disk.Kind, disk.Workload)
+	}
+
+	// Manifests are for kubectl (or an orchestrator), without empty fields
+	manifest, err := workflows.Manifest(lammps.Objects[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"creationTimestamp", "status:"} {
+		if strings.Contains(manifest, field) {
+			t.Errorf("expected the manifest to not have %s:\n%s", field, manifest)
+		}
+	}
+	if !strings.Contains(manifest, "kind: JobSet") {
+		t.Errorf("expected a JobSet manifest:\n%s", manifest)
+	}
+
+	// The script that waits saves logs, and exits with the status of the run
+	script := lammps.WaitScript("/tmp/results/lammps", 5)
+	for _, expected := range []string{
+		`namespace='default'`,
+		"kubectl get ${flags} jobset/lammps",
+		"-l metricset-name=lammps",
+		"sleep 5",
+		"exit ${status}",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected %q in the wait script:\n%s", expected, script)
+		}
+	}
+}
+
+func TestLoadPipelineUnsupported(t *testing.T) {
+	_, err := workflows.LoadPipeline("", strings.NewReader(`
+apiVersion: flux-framework.org/v1alpha2
+kind: MetricSet
+metadata:
+  name: fio
+spec:
+  shards: 2
+  disruptionBudget: true
+  metrics:
+    - name: io-fio
+`))
+	if err == nil || !strings.Contains(err.Error(), "disruptionBudget, shards need the operator") {
+		t.Errorf("expected features that need the operator to be an error, found %v", err)
+	}
+
+	_, err = workflows.LoadPipeline("", strings.NewReader(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: fio
+`))
+	if err == nil {
+		t.Errorf("expected a pipeline of a ConfigMap to be an error")
+	}
+}
+
+// TestTemplates checks the fields of the scripts (e.g., to wait) are in their contexts
+func TestTemplates(t *testing.T) {
+	err := specs.CheckTemplates()
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -1 +1,2 @@
 from .client import MetricsOperator  # noqa
+from .influx import InfluxSink  # noqa
@@ -9,6 +9,7 @@ from kubernetes import client, config
 
 import metricsoperator.metrics as mutils
 import metricsoperator.utils as utils
+from metricsoperator.result import MetricResult
 
 
 class MetricsOperator:
@@ -63,6 +64,86 @@ class MetricsOperator:
             for pod, container in parser.logging_containers(pod_prefix=pod_prefix):
                 yield parser.parse(pod=pod, container=container)
 
+    def collect(
+        self,
+        pod_prefix=None,
+        container_name=None,
+        fields=None,
+        percentiles=None,
+        outdir=None,
+        output_formats=None,
+        sinks=None,
+    ):
+        """
+        Wait for and parse the logs of each metric, and aggregate the numeric
+        fields the metric declares (and any extra fields) across pods and repetitions.
+        With an output directory (or object store URL) results are exported, and
+        the aggregate is written to each sink (e.g., an InfluxSink).
+        """
+        results = []
+        experiment_id = self.spec["spec"].get("experimentId")
+        metadata = self.spec["spec"].get("metadata")
+        dollars = self.get_cost()
+        for metric in self.spec["spec"]["metrics"]:
+            print("Collecting %s" % metric["name"])
+            parser = self.get_parser(metric["name"], container_name)
+            result = MetricResult(
+                metric.get("alias") or metric["name"],
+                fields=list(parser.aggregate_fields) + list(fields or []),
+                percentiles=percentiles,
+                metric=metric,
+                experiment_id=experiment_id,
+                metadata=metadata,
+            )
+            for pod, container in parser.logging_containers(pod_prefix=pod_prefix):
+                result.add(
+                    parser.parse(pod=pod, container=container),
+                    pod=pod.metadata.name,
+                    node_type=self.get_node_type(parser, pod.spec.node_name),
+                )
+            result.set_cost(dollars)
+            result.summarize()
+            if outdir:
+                result.export(outdir, output_formats)
+            for sink in sinks or []:
+                sink.write(result)
+            results.append(result)
+        return results
+
+    def get_cost(self):
+        """
+        Get the estimated dollars of the run from the MetricSet status, if the
+        MetricSet has a price table and the run is finished
+        """
+        if not self.spec["spec"].get("cost", {}).get("priceTable"):
+            return
+        try:
+            metricset = client.CustomObjectsApi().get_namespaced_custom_object(
+                group=self.group,
+                version=self.version,
+                namespace=self.namespace,
+                plural=self.plural,
+                name=self.name,
+            )
+        except Exception:
+            return
+        return (metricset.get("status") or {}).get("cost", {}).get("dollars")
+
+    def get_node_type(self, parser, node_name):
+        """
+        Get the instance type of a node from its labels, if we can see it
+        """
+        if not node_name:
+            return
+        try:
+            node = parser.core_v1.read_node(node_name)
+        except Exception:
+            return
+        labels = node.metadata.labels or {}
+        return labels.get("node.kubernetes.io/instance-type") or labels.get(
+            "beta.kubernetes.io/instance-type"
+        )
+
     def create(self):
         """
         Create the associated YAML file.
@@ -0,0 +1,115 @@
+# Copyright 2023 Lawrence Livermore National Security, LLC
+# (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+import csv
+import io
+import os
+
+columns = ["experiment_id", "metric", "pod", "iteration", "measurement", "value"]
+formats = ["csv", "parquet"]
+
+
+def flatten(entry, prefix=""):
+    """
+    Yield (measurement, value) for numeric values in a parsed entry, where the
+    measurement is the dotted path to the value (e.g., jobs.0.read.bw)
+    """
+    if isinstance(entry, dict):
+        items = entry.items()
+    elif isinstance(entry, list):
+        items = enumerate(entry)
+    else:
+        if not isinstance(entry, bool) and isinstance(entry, (int, float)):
+            yield prefix, entry
+        return
+    for key, value in items:
+        path = f"{prefix}.{key}" if prefix else str(key)
+        yield from flatten(value, path)
+
+
+def get_rows(name, results, pods=None, experiment_id=None):
+    """
+    Get a row for each pod, iteration (entry in data), and measurement
+    """
+    rows = []
+    for i, result in enumerate(results):
+        pod = pods[i] if pods and i < len(pods) else str(i)
+        for iteration, entry in enumerate(result.get("data") or []):
+            for measurement, value in flatten(entry):
+                rows.append(
+                    {
+                        "experiment_id": experiment_id or "",
+                        "metric": name,
+                        "pod": pod,
+                        "iteration": iteration,
+                        "measurement": measurement,
+                        "value": value,
+                    }
+                )
+    return rows
+
+
+def open_output(path, mode):
+    """
+    Open a local path, or an object store URL (e.g., s3://bucket/results.csv)
+    """
+    if "://" not in path:
+        return open(path, mode)
+    try:
+        import fsspec
+    except ImportError:
+        raise ValueError(f"Writing to {path} requires fsspec (and the store driver)")
+    return fsspec.open(path, mode).open()
+
+
+def write_csv(rows, path):
+    """
+    Write rows to csv
+    """
+    with open_output(path, "w") as fd:
+        writer = csv.DictWriter(fd, fieldnames=columns)
+        writer.writeheader()
+        writer.writerows(rows)
+
+
+def write_parquet(rows, path):
+    """
+    Write rows to parquet, which requires pyarrow
+    """
+    try:
+        import pyarrow
+        import pyarrow.parquet as parquet
+    except ImportError:
+        raise ValueError("Writing parquet requires pyarrow (metricsoperator[parquet])")
+
+    # Values are floats so the column has one type
+    values = {column: [row[column] for row in rows] for column in columns}
+    values["value"] = [float(value) for value in values["value"]]
+    table = pyarrow.table(values)
+    buffer = io.BytesIO()
+    parquet.write_table(table, buffer)
+    with open_output(path, "wb") as fd:
+        fd.write(buffer.getvalue())
+
+
+def export(name, results, outdir, pods=None, output_formats=None, experiment_id=None):
+    """
+    Export results for a metric as <outdir>/<name>.<format>, returning the paths
+    """
+    output_formats = output_formats or ["csv"]
+    for output_format in output_formats:
+        if output_format not in formats:
+            raise ValueError(f"{output_format} is not a known format: {formats}")
+    if "://" not in outdir and not os.path.exists(outdir):
+        os.makedirs(outdir)
+
+    rows = get_rows(name, results, pods, experiment_id)
+    paths = []
+    for output_format in output_formats:
+        path = f"{outdir.rstrip('/')}/{name}.{output_format}"
+        if output_format == "csv":
+            write_csv(rows, path)
+        else:
+            write_parquet(rows, path)
+        paths.append(path)
+    return paths
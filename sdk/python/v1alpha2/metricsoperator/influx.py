@@ -0,0 +1,122 @@
+# Copyright 2023 Lawrence Livermore National Security, LLC
+# (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+import hashlib
+import json
+import os
+import subprocess
+import time
+
+import requests
+
+measurement = "metrics_operator"
+
+
+def options_hash(metric):
+    """
+    A short hash of the options of a metric, to compare runs with the same options
+    """
+    options = {
+        key: metric.get(key) or {} for key in ["options", "listOptions", "mapOptions"]
+    }
+    content = json.dumps(options, sort_keys=True, default=str)
+    return hashlib.sha256(content.encode("utf-8")).hexdigest()[:12]
+
+
+def get_git_sha():
+    """
+    Get the git sha from the environment (GIT_SHA) or the working directory
+    """
+    if os.environ.get("GIT_SHA"):
+        return os.environ["GIT_SHA"]
+    try:
+        output = subprocess.check_output(
+            ["git", "rev-parse", "HEAD"], stderr=subprocess.DEVNULL
+        )
+    except (OSError, subprocess.CalledProcessError):
+        return "unknown"
+    return output.decode("utf-8").strip()
+
+
+def escape_tag(value):
+    """
+    Escape commas, spaces, and equals in a tag key or value
+    """
+    value = str(value) or "unknown"
+    for character in ["\\", ",", " ", "="]:
+        value = value.replace(character, "\\" + character)
+    return value
+
+
+def get_lines(result, labels=None, timestamp=None):
+    """
+    Get line protocol for the aggregate of a result, one line per field
+    """
+    if result.aggregate is None:
+        result.summarize()
+    timestamp = timestamp or int(time.time())
+    tags = {
+        "metric": result.name,
+        "options_hash": options_hash(result.metric),
+        "node_type": "+".join(sorted(result.node_types)) or "unknown",
+    }
+    if result.experiment_id:
+        tags["experiment_id"] = result.experiment_id
+    tags.update(labels or {})
+
+    lines = []
+    for field, summary in result.aggregate["fields"].items():
+        if not summary.get("count"):
+            continue
+        tagset = ",".join(
+            f"{escape_tag(key)}={escape_tag(value)}"
+            for key, value in sorted(dict(tags, field=field).items())
+        )
+        fieldset = ",".join(f"{key}={float(value)}" for key, value in summary.items())
+        lines.append(f"{measurement},{tagset} {fieldset} {timestamp}")
+    return lines
+
+
+class InfluxSink:
+    """
+    Write summarized results to a database that accepts InfluxDB line protocol.
+    With a bucket the InfluxDB v2 API is used, otherwise the v1 API with a database.
+    """
+
+    def __init__(
+        self, url, bucket=None, org=None, token=None, database=None, git_sha=None
+    ):
+        if not bucket and not database:
+            raise ValueError("A bucket (InfluxDB v2) or database (v1) is required.")
+        self.url = url.rstrip("/")
+        self.bucket = bucket
+        self.org = org
+        self.token = token
+        self.database = database
+        self.git_sha = git_sha or get_git_sha()
+
+    def write(self, result, labels=None):
+        """
+        Write the aggregate of a result, with labels (tags) added to the defaults
+        """
+        labels = dict({"git_sha": self.git_sha}, **(labels or {}))
+        lines = get_lines(result, labels)
+        if not lines:
+            print(f"Warning: {result.name} does not have fields to write")
+            return
+        headers = {"Content-Type": "text/plain; charset=utf-8"}
+        if self.token:
+            headers["Authorization"] = f"Token {self.token}"
+        if self.bucket:
+            url = f"{self.url}/api/v2/write"
+            params = {"bucket": self.bucket, "org": self.org, "precision": "s"}
+        else:
+            url = f"{self.url}/write"
+            params = {"db": self.database, "precision": "s"}
+        response = requests.post(
+            url, params=params, data="\n".join(lines), headers=headers
+        )
+        if response.status_code >= 300:
+            status = f"{response.status_code} {response.text}"
+            raise ValueError(f"Cannot write {result.name} to {url}: {status}")
+        return lines
@@ -12,8 +12,12 @@ metrics = {
     "io-sysstat": storage.io_sysstat,
     "network-osu-benchmark": network.network_osu_benchmark,
     "network-netmark": network.network_netmark,
+    "network-pps": network.network_pps,
     "perf-sysstat": perf.perf_sysstat,
+    "perf-throttle": perf.perf_throttle,
     "io-fio": storage.io_fio,
+    "io-mdtest": storage.io_mdtest,
+    "io-fsync": storage.io_fsync,
     "app-lammps": apps.app_lammps,
     "app-amg": apps.app_amg,
     "addon-mpitrace": addons.mpitrace,
@@ -18,6 +18,12 @@ class app_lammps(MetricBase):
     """
 
     container_name = "launcher"
+    aggregate_fields = [
+        "loop_time",
+        "total_wall_time_seconds",
+        "performance_ns_per_day",
+        "timesteps_per_second",
+    ]
 
     @property
     def pod_prefix(self):
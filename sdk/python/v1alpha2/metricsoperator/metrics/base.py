@@ -1,3 +1,4 @@
+import base64
 import json
 import time
 
@@ -15,8 +16,16 @@ class MetricBase:
     collection_end = "METRICS OPERATOR COLLECTION END"
     metadata_start = "METADATA START"
     metadata_end = "METADATA END"
+    frame_start = "METRICS OPERATOR FRAME START"
+    frame_end = "METRICS OPERATOR FRAME END"
+    phase = "METRICS OPERATOR PHASE"
+    clock = "METRICS OPERATOR CLOCK"
     container_name = None
 
+    # Numeric fields (dotted paths in each parsed entry) to aggregate across
+    # pods and repetitions, e.g., jobs.0.read.bw
+    aggregate_fields = []
+
     def __init__(self, spec=None, **kwargs):
         """
         Create a persistent client to interact with a MiniCluster
@@ -31,6 +40,15 @@ class MetricBase:
         if not self.container_name:
             self.container_name = kwargs.get("container_name") or "launcher"
 
+        # Markers can be customized in the MetricSet spec
+        if self.spec is not None:
+            markers = self.spec.get("spec", {}).get("markers") or {}
+            self.separator = markers.get("separator") or self.separator
+            self.collection_start = (
+                markers.get("collectionStart") or self.collection_start
+            )
+            self.collection_end = markers.get("collectionEnd") or self.collection_end
+
         # Load kubeconfig on Metricbase init only
         if self.spec is not None:
             self.load_kube_config()
@@ -73,7 +91,11 @@ class MetricBase:
         lines = self.stream_output(
             name=pod.metadata.name, namespace=self.namespace, container=container.name
         )
-        return self.parse_log(lines)
+        result = self.parse_log(lines)
+        clock = self.get_clock(lines)
+        if clock and isinstance(result, dict):
+            result["clock"] = clock
+        return result
 
     def parse_log(self, lines):
         """
@@ -183,10 +205,18 @@ class MetricBase:
     def _filter_pods(self, pods, name):
         """
         Filter a set of pods (associated with a job) to a name prefix.
+
+        The pods of a sharded MetricSet are named for the shard (<name>-s<i>),
+        so a prefix for the MetricSet matches the pods of every shard.
         """
+        prefixes = [name]
+        shards = (self.spec or {}).get("spec", {}).get("shards") or 0
+        if shards > 1 and name.startswith(self.name + "-"):
+            rest = name[len(self.name) :]
+            prefixes = [f"{self.name}-s{i}{rest}" for i in range(shards)]
         filtered = []
         for pod in pods.items:
-            if pod.metadata.name.startswith(name):
+            if any(pod.metadata.name.startswith(prefix) for prefix in prefixes):
                 filtered.append(pod)
         pods.items = filtered
         return pods
@@ -232,7 +262,71 @@ class MetricBase:
             return {}
         data = lines.split(self.collection_start, 1)[1:]
         data = "\n".join(data).split(self.collection_end, 1)[0]
-        return data.split(self.separator)
+
+        # Clock offsets (of the sys-clock addon) are not part of the metric output
+        data = "\n".join(
+            x for x in data.split("\n") if not x.strip().startswith(self.clock + " ")
+        )
+        return self.decode_frames(data).split(self.separator)
+
+    def get_phases(self, section):
+        """
+        Given a section of output, return the phase markers (time and name) in it
+        """
+        phases = []
+        for line in section.split("\n"):
+            line = line.strip()
+            if not line.startswith(self.phase + " "):
+                continue
+            parts = line[len(self.phase) + 1 :].split(" ", 1)
+            if len(parts) == 2 and parts[0].isdigit():
+                phases.append({"time": int(parts[0]), "name": parts[1]})
+        return phases
+
+    def get_clock(self, lines):
+        """
+        Given a log dump, return the clock offsets (of the sys-clock addon)
+        """
+        clock = []
+        for line in lines.split("\n"):
+            line = line.strip()
+            if not line.startswith(self.clock + " "):
+                continue
+            parts = line[len(self.clock) + 1 :].split(" ")
+            if len(parts) != 4:
+                continue
+            when, node, method, offset = parts
+            try:
+                offset = float(offset)
+            except ValueError:
+                offset = None
+            clock.append(
+                {"when": when, "node": node, "method": method, "offset": offset}
+            )
+        return clock
+
+    def decode_frames(self, data):
+        """
+        Decode output framed in base64 (one line each) between frame markers.
+        Separators in a frame are not encoded.
+        """
+        if self.frame_start not in data:
+            return data
+        decoded = []
+        framed = False
+        for line in data.split("\n"):
+            stripped = line.strip()
+            if stripped == self.frame_start:
+                framed = True
+            elif stripped == self.frame_end:
+                framed = False
+            elif framed and stripped and stripped != self.separator:
+                decoded.append(
+                    base64.b64decode(stripped).decode("utf-8", "replace").rstrip("\n")
+                )
+            else:
+                decoded.append(line)
+        return "\n".join(decoded)
 
     def stream_output(
         self,
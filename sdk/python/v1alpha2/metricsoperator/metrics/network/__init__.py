@@ -1,2 +1,3 @@
 from .netmark import network_netmark
 from .osu_benchmark import network_osu_benchmark
+from .pps import network_pps
@@ -36,6 +36,9 @@ column_lookup = {
     "osu_allreduce": average_latency_header,
 }
 
+# Sections of a matrix have a pair line after the command
+matrix_pair = "METRICS OPERATOR MATRIX PAIR"
+
 
 def parse_commented_header(section):
     """
@@ -248,6 +251,48 @@ def run_parsing_function(section):
     return result
 
 
+def parse_matrix_pair(line):
+    """
+    Parse the pair line of a matrix section (indices are 1-based)
+    """
+    parts = line[len(matrix_pair) :].split()
+    return {
+        "source": int(parts[0]) - 1,
+        "destination": int(parts[1]) - 1,
+        "hosts": parts[2:4],
+    }
+
+
+def get_matrices(results):
+    """
+    Assemble pair to pair results into an NxN matrix per command
+
+    The value for a pair is from the largest message size (the last row), and
+    is None for pairs that were not run (e.g., not sampled).
+    """
+    matrices = {}
+    for result in results:
+        pair = result.get("pair")
+        if not pair or not result["matrix"]:
+            continue
+        command = os.path.basename(result["command"].split(" ")[-1])
+        entry = matrices.setdefault(command, {"hosts": {}, "pairs": [], "column": result["columns"][-1]})
+        entry["hosts"][pair["source"]] = pair["hosts"][0]
+        entry["hosts"][pair["destination"]] = pair["hosts"][1]
+        row = result["matrix"][-1]
+        entry["size"] = row[0]
+        entry["pairs"].append((pair["source"], pair["destination"], row[-1]))
+
+    for command, entry in matrices.items():
+        size = max(entry["hosts"]) + 1
+        values = [[None] * size for _ in range(size)]
+        for source, destination, value in entry.pop("pairs"):
+            values[source][destination] = value
+        entry["hosts"] = [entry["hosts"].get(i) for i in range(size)]
+        entry["values"] = values
+    return matrices
+
+
 class network_osu_benchmark(MetricBase):
     """
     Parse the OSU benchmarks output into data!
@@ -279,8 +324,19 @@ class network_osu_benchmark(MetricBase):
             section = section.split("\n")
             section = [x.strip() for x in section if x.strip()]
 
+            # A matrix section has the pair after the command
+            pair = None
+            if len(section) > 1 and section[1].startswith(matrix_pair):
+                pair = parse_matrix_pair(section.pop(1))
+
             # Parse the section. If this fails, we want to know
             datum = run_parsing_function(section)
+            if pair:
+                datum["pair"] = pair
             results.append(datum)
 
-        return {"data": results, "metadata": metadata, "spec": self.spec}
+        result = {"data": results, "metadata": metadata, "spec": self.spec}
+        matrices = get_matrices(results)
+        if matrices:
+            result["matrices"] = matrices
+        return result
@@ -0,0 +1,66 @@
+# Copyright 2023 Lawrence Livermore National Security, LLC
+# (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+from metricsoperator.metrics.base import MetricBase
+
+
+class network_pps(MetricBase):
+    """
+    Parse the netperf key=value output of each test, size, and worker.
+    """
+
+    container_name = "launcher"
+
+    @property
+    def pod_prefix(self):
+        return f"{self.name}-l-0"
+
+    def parse_value(self, value):
+        """
+        Return a number if the value is one
+        """
+        try:
+            return float(value)
+        except ValueError:
+            return value
+
+    def add_packet_rate(self, result):
+        """
+        A transaction of UDP_RR is two packets, and UDP_STREAM sends calls
+        (one message each) of which the worker receives some.
+        """
+        elapsed = result.get("ELAPSED_TIME")
+        if result["test"] == "UDP_RR" and "THROUGHPUT" in result:
+            result["pps"] = 2 * result["THROUGHPUT"]
+        elif result["test"] == "UDP_STREAM" and elapsed:
+            if "LOCAL_SEND_CALLS" in result:
+                result["sent_pps"] = result["LOCAL_SEND_CALLS"] / elapsed
+            if "REMOTE_RECV_CALLS" in result:
+                result["pps"] = result["REMOTE_RECV_CALLS"] / elapsed
+        return result
+
+    def parse_log(self, lines):
+        """
+        Given lines of output, parse and return json
+        """
+        # Get the log metadata
+        metadata = self.get_log_metadata(lines)
+
+        results = []
+        sections = self.get_log_sections(lines)
+        for section in sections:
+            result = {}
+            for line in section.split("\n"):
+                line = line.strip()
+                if line.startswith("PPS TEST"):
+                    # PPS TEST <test> SIZE <size> HOST <host>
+                    parts = line.split()
+                    result.update(
+                        {"test": parts[2], "size": int(parts[4]), "host": parts[6]}
+                    )
+                elif "=" in line and result:
+                    key, value = line.split("=", 1)
+                    result[key.strip()] = self.parse_value(value.strip())
+            if "test" in result:
+                results.append(self.add_packet_rate(result))
+        return {"data": results, "metadata": metadata, "spec": self.spec}
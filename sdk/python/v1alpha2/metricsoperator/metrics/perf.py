@@ -45,11 +45,17 @@ class perf_sysstat(MetricBase):
 
         # Split lines by section separator
         results = []
+        phase = None
         sections = self.get_log_sections(lines)
         for section in sections:
             if not section.strip():
                 continue
 
+            # Phase markers of the application, printed before the sample
+            phases = self.get_phases(section)
+            if phases:
+                phase = phases[-1]["name"]
+
             # These will be parts for one timepoint
             parts = section.strip().split("\n")
             timepoint = {}
@@ -68,6 +74,9 @@ class perf_sysstat(MetricBase):
 
             # Only add timepoint if we collected data
             if timepoint:
+                if phase is not None:
+                    timepoint["phase"] = phase
+                    timepoint["phases"] = phases
                 results.append(timepoint)
 
         return {
@@ -76,3 +85,96 @@ class perf_sysstat(MetricBase):
             "command": command,
             "spec": self.spec,
         }
+
+
+class perf_throttle(MetricBase):
+    """
+    Parse windows of a CPU workload with frequencies and throttle counters.
+    """
+
+    container_name = "app"
+
+    @property
+    def pod_prefix(self):
+        return f"{self.name}-m-0"
+
+    def parse_numbers(self, line, start):
+        """
+        Parse the numbers of a line after the first start fields
+        """
+        return [float(x) for x in line.split()[start:]]
+
+    def parse_window(self, section):
+        """
+        Parse the window number, bogo ops, frequencies (kHz), and throttle counts
+        """
+        window = {}
+        for line in section.split("\n"):
+            line = line.strip()
+            if line.startswith("WINDOW"):
+                window["window"] = int(line.split()[1])
+            elif line.startswith("BOGO OPS"):
+                values = self.parse_numbers(line, 2)
+                window["bogo_ops"], window["bogo_ops_per_second"] = values[:2]
+            elif line.startswith("FREQUENCIES"):
+                window["frequencies"] = self.parse_numbers(line, 1)
+            elif line.startswith("THROTTLE core"):
+                window["core_throttle"] = self.parse_numbers(line, 2)
+            elif line.startswith("THROTTLE package"):
+                window["package_throttle"] = self.parse_numbers(line, 2)
+        return window
+
+    def parse_log(self, lines):
+        """
+        Given lines of output, parse and return json
+        """
+        # Get the log metadata
+        metadata = self.get_log_metadata(lines)
+
+        # The node, burst windows, and governor come before the collection
+        node = None
+        burst = 1
+        governor = None
+        for line in lines.split("\n"):
+            if line.startswith("THROTTLE NODE"):
+                parts = line.split()
+                node = parts[2] if len(parts) == 7 else None
+                burst = int(parts[-3])
+            elif line.startswith("GOVERNOR"):
+                governor = line.split()[-1]
+
+        windows = []
+        for section in self.get_log_sections(lines):
+            if section.strip():
+                windows.append(self.parse_window(section))
+
+        # Window 0 is the idle baseline, then burst windows, then sustained
+        loaded = [w for w in windows if w.get("window", 0) > 0]
+        rates = [w["bogo_ops_per_second"] for w in loaded if "bogo_ops_per_second" in w]
+        burst_rate = sustained_rate = ratio = None
+        if len(rates) > burst:
+            burst_rate = sum(rates[:burst]) / burst
+            sustained_rate = sum(rates[burst:]) / len(rates[burst:])
+            if burst_rate:
+                ratio = sustained_rate / burst_rate
+
+        # Throttle events are the difference of the counters over the run
+        throttled = {}
+        if windows:
+            for counter in ["core_throttle", "package_throttle"]:
+                first = windows[0].get(counter) or []
+                last = windows[-1].get(counter) or []
+                if first and len(first) == len(last):
+                    throttled[counter] = sum(last) - sum(first)
+
+        return {
+            "data": windows,
+            "node": node,
+            "governor": governor,
+            "burst_ops_per_second": burst_rate,
+            "sustained_ops_per_second": sustained_rate,
+            "sustained_ratio": ratio,
+            "throttle_events": throttled,
+            "metadata": metadata,
+            "spec": self.spec,
+        }
@@ -32,6 +32,12 @@ class io_sysstat(MetricBase):
 
 class io_fio(MetricBase):
     container_name = "io-fio"
+    aggregate_fields = [
+        "jobs.0.read.bw",
+        "jobs.0.read.iops",
+        "jobs.0.write.bw",
+        "jobs.0.write.iops",
+    ]
 
     @property
     def pod_prefix(self):
@@ -61,3 +67,132 @@ class io_fio(MetricBase):
             "spec": self.spec,
             "command": command,
         }
+
+
+class io_mdtest(MetricBase):
+    container_name = "storage"
+
+    @property
+    def pod_prefix(self):
+        return f"{self.name}-m-0"
+
+    def parse_mdtest(self, section):
+        """
+        Parse the rates (ops/sec) of each operation from the mdtest summary
+        """
+        rates = {}
+        in_rates = False
+        for line in section.split("\n"):
+            line = line.strip()
+            if line.startswith("SUMMARY"):
+                in_rates = line.startswith("SUMMARY rate")
+                continue
+            if not in_rates or ":" not in line:
+                continue
+            operation, values = line.split(":", 1)
+            values = values.split()
+            if len(values) < 4:
+                continue
+            try:
+                values = [float(x) for x in values[:4]]
+            except ValueError:
+                continue
+            rates[operation.strip()] = dict(
+                zip(["max", "min", "mean", "stddev"], values)
+            )
+        return rates
+
+    def parse_smallfile(self, section):
+        """
+        Parse the rate (files/sec) of the operation from smallfile output
+        """
+        operation = None
+        rate = None
+        for line in section.split("\n"):
+            line = line.strip()
+            if line.startswith("SMALLFILE OPERATION"):
+                operation = line.split()[-1]
+            elif line.startswith("files/sec"):
+                rate = float(line.split("=", 1)[-1].strip())
+        if not operation or rate is None:
+            return {}
+        return {operation: {"mean": rate}}
+
+    def parse_log(self, lines):
+        """
+        Given lines of output, parse and return json
+        """
+        # Get the log metadata
+        metadata = self.get_log_metadata(lines)
+        tool = "mdtest"
+        if "MDTEST TOOL smallfile" in lines:
+            tool = "smallfile"
+
+        # Each section is the run of mdtest, or one operation of smallfile
+        rates = {}
+        sections = self.get_log_sections(lines)
+        for section in sections:
+            if not section.strip():
+                continue
+            if tool == "mdtest":
+                rates.update(self.parse_mdtest(section))
+            else:
+                rates.update(self.parse_smallfile(section))
+        return {"data": rates, "tool": tool, "metadata": metadata, "spec": self.spec}
+
+
+class io_fsync(MetricBase):
+    container_name = "storage"
+
+    @property
+    def pod_prefix(self):
+        return f"{self.name}-m-0"
+
+    def get_fsync_latency(self, result):
+        """
+        Get the 99th percentile fdatasync latency (milliseconds) from fio json
+        """
+        for job in result.get("jobs", []):
+            percentiles = job.get("sync", {}).get("lat_ns", {}).get("percentile", {})
+            if "99.000000" in percentiles:
+                return percentiles["99.000000"] / 1e6
+
+    def parse_log(self, lines):
+        """
+        Given lines of output, parse and return json
+        """
+        # Get the log metadata
+        metadata = self.get_log_metadata(lines)
+
+        # The node and threshold (ms) come before the collection
+        node = None
+        threshold = None
+        for line in lines.split("\n"):
+            if line.startswith("FSYNC NODE"):
+                parts = line.split()
+                node = parts[2] if len(parts) == 5 else None
+                threshold = float(parts[-1])
+                break
+
+        results = []
+        sections = self.get_log_sections(lines)
+        for section in sections:
+            if not section.strip():
+                continue
+            results.append(json.loads(section))
+
+        p99 = None
+        if results:
+            p99 = self.get_fsync_latency(results[0])
+        qualifies = None
+        if p99 is not None and threshold is not None:
+            qualifies = p99 < threshold
+        return {
+            "data": results,
+            "node": node,
+            "fsync_p99_ms": p99,
+            "threshold_ms": threshold,
+            "qualifies": qualifies,
+            "metadata": metadata,
+            "spec": self.spec,
+        }
@@ -0,0 +1,100 @@
+# Copyright 2023 Lawrence Livermore National Security, LLC
+# (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+import metricsoperator.export as export
+import metricsoperator.stats as stats
+
+
+class MetricResult:
+    """
+    The parsed results of a metric for each pod, and the aggregate (statistics)
+    for the numeric fields the metric declares.
+    """
+
+    def __init__(
+        self,
+        name,
+        results=None,
+        fields=None,
+        percentiles=None,
+        metric=None,
+        experiment_id=None,
+        metadata=None,
+    ):
+        self.name = name
+        self.results = results or []
+        self.fields = fields or []
+        self.percentiles = percentiles
+        self.aggregate = None
+        self.pods = []
+        self.node_types = []
+
+        # The metric from the MetricSet spec (e.g., with options)
+        self.metric = metric or {}
+
+        # Provenance (experimentId and metadata) of the MetricSet, to join
+        # results to experiment tracking
+        self.experiment_id = experiment_id
+        self.metadata = metadata or {}
+
+        # Estimated dollars for the run of the MetricSet (all metrics), if known
+        self.dollars = None
+
+    def add(self, result, pod=None, node_type=None):
+        """
+        Add the parsed result of a pod, and the instance type of its node
+        """
+        self.results.append(result)
+        self.pods.append(pod or str(len(self.results) - 1))
+        if node_type and node_type not in self.node_types:
+            self.node_types.append(node_type)
+
+    def set_cost(self, dollars):
+        """
+        Set the estimated cost of the run (from the MetricSet status)
+        """
+        self.dollars = float(dollars) if dollars is not None else None
+
+    @property
+    def dollars_per_result(self):
+        """
+        The cost of the run divided by the results (one per pod), for perf/$
+        """
+        if self.dollars is None or not self.results:
+            return
+        return self.dollars / len(self.results)
+
+    def summarize(self):
+        """
+        Calculate the aggregate across pods and repetitions
+        """
+        self.aggregate = stats.aggregate(self.results, self.fields, self.percentiles)
+        return self.aggregate
+
+    def export(self, outdir, output_formats=None):
+        """
+        Write a row per pod, iteration, and measurement as csv and/or parquet
+        """
+        return export.export(
+            self.name,
+            self.results,
+            outdir,
+            self.pods,
+            output_formats,
+            experiment_id=self.experiment_id,
+        )
+
+    def to_dict(self):
+        if self.aggregate is None:
+            self.summarize()
+        return {
+            "metric": self.name,
+            "experimentId": self.experiment_id,
+            "metadata": self.metadata,
+            "results": self.results,
+            "aggregate": self.aggregate,
+            "cost": {
+                "dollars": self.dollars,
+                "dollarsPerResult": self.dollars_per_result,
+            },
+        }
@@ -0,0 +1,84 @@
+# Copyright 2023 Lawrence Livermore National Security, LLC
+# (c.f. AUTHORS, NOTICE.LLNS, COPYING)
+
+import math
+
+default_percentiles = [50, 90, 99]
+
+
+def get_field(entry, field):
+    """
+    Get a (dotted) field from a parsed entry, e.g., jobs.0.read.bw
+    """
+    value = entry
+    for key in field.split("."):
+        if isinstance(value, list) and key.isdigit() and int(key) < len(value):
+            value = value[int(key)]
+        elif isinstance(value, dict) and key in value:
+            value = value[key]
+        else:
+            return None
+    if isinstance(value, bool) or not isinstance(value, (int, float)):
+        return None
+    return value
+
+
+def percentile(values, percent):
+    """
+    Percentile of sorted values, interpolating between the closest ranks
+    """
+    if len(values) == 1:
+        return values[0]
+    rank = (len(values) - 1) * percent / 100
+    lower = math.floor(rank)
+    upper = math.ceil(rank)
+    return values[lower] + (values[upper] - values[lower]) * (rank - lower)
+
+
+def summarize(values, percentiles=None):
+    """
+    Summarize numeric values with min, max, mean, stddev, and percentiles
+    """
+    values = sorted(values)
+    if not values:
+        return {"count": 0}
+    mean = sum(values) / len(values)
+
+    # This is the sample standard deviation (0 for a single value)
+    stddev = 0
+    if len(values) > 1:
+        stddev = math.sqrt(sum((x - mean) ** 2 for x in values) / (len(values) - 1))
+    summary = {
+        "count": len(values),
+        "min": values[0],
+        "max": values[-1],
+        "mean": mean,
+        "stddev": stddev,
+    }
+    for percent in percentiles or default_percentiles:
+        summary[f"p{percent}"] = percentile(values, percent)
+    return summary
+
+
+def aggregate(results, fields, percentiles=None):
+    """
+    Aggregate fields across the parsed results of each pod, and the repetitions
+    (entries in data) for each. Fields that are not found or are not numeric
+    are skipped.
+    """
+    values = {field: [] for field in fields}
+    repetitions = 0
+    for result in results:
+        for entry in result.get("data") or []:
+            repetitions += 1
+            for field in fields:
+                value = get_field(entry, field)
+                if value is not None:
+                    values[field].append(value)
+    return {
+        "pods": len(results),
+        "repetitions": repetitions,
+        "fields": {
+            field: summarize(found, percentiles) for field, found in values.items()
+        },
+    }
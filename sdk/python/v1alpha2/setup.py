@@ -30,7 +30,7 @@ except Exception:
 if __name__ == "__main__":
     setup(
         name="metricsoperator",
-        version="0.1.13",
+        version="0.1.27",
         author="Vanessasaurus",
         author_email="vsoch@users.noreply.github.com",
         maintainer="Vanessasaurus",
@@ -45,6 +45,10 @@ if __name__ == "__main__":
         keywords="metrics-operator,hpc,kubernetes,metrics,storage,applications",
         setup_requires=["pytest-runner"],
         install_requires=["kubernetes", "requests", "pyyaml"],
+        extras_require={
+            "parquet": ["pyarrow"],
+            "all": ["pyarrow", "fsspec"],
+        },
         tests_require=["pytest", "pytest-cov"],
         classifiers=[
             "Intended Audience :: Science/Research",